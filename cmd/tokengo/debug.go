@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/binn/tokengo/internal/dht"
+)
+
+// routingTableSource 可输出 DHT 路由表快照的节点 (Client/Relay/Exit)
+type routingTableSource func(sample int) *dht.RoutingTableReport
+
+// logRoutingTableOnSignal 收到 routingTableDumpSignals 时把路由表快照写入日志，直到 ctx 取消
+// 只读诊断工具，不影响节点运行；当前平台不支持该信号时不做任何事
+func logRoutingTableOnSignal(ctx context.Context, name string, source routingTableSource) {
+	if len(routingTableDumpSignals) == 0 {
+		return
+	}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, routingTableDumpSignals...)
+	go func() {
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigCh:
+				logRoutingTable(name, source(dht.DefaultRoutingTableSample))
+			}
+		}
+	}()
+}
+
+// logRoutingTable 输出一次路由表快照
+func logRoutingTable(name string, report *dht.RoutingTableReport) {
+	if report == nil {
+		log.Printf("%s 未启用 DHT 或尚未启动，无路由表可输出", name)
+		return
+	}
+	var b strings.Builder
+	report.Print(&b)
+	log.Printf("%s DHT 路由表:\n%s", name, b.String())
+}
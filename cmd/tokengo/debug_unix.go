@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// routingTableDumpSignals 触发路由表输出的信号 (kill -USR1 <pid>)
+var routingTableDumpSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// routingTableDumpSignals Windows 没有 SIGUSR1，不支持按信号输出路由表
+var routingTableDumpSignals []os.Signal
@@ -1,14 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/binn/tokengo/internal/client"
@@ -16,6 +16,7 @@ import (
 	"github.com/binn/tokengo/internal/crypto"
 	"github.com/binn/tokengo/internal/exit"
 	"github.com/binn/tokengo/internal/identity"
+	"github.com/binn/tokengo/internal/logging"
 	"github.com/binn/tokengo/internal/relay"
 	"github.com/spf13/cobra"
 )
@@ -32,12 +33,23 @@ func main() {
 		Version: version,
 	}
 
+	// 日志格式和级别对所有子命令生效，在创建节点之前配置
+	var logFormat, logLevel string
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logging.FormatText, "日志格式: text (默认，人类可读) 或 json (结构化)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "日志级别: debug/info/warn/error")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return logging.Setup(logFormat, logLevel)
+	}
+
 	// 添加子命令
 	rootCmd.AddCommand(clientCmd())
 	rootCmd.AddCommand(relayCmd())
 	rootCmd.AddCommand(exitCmd())
 	rootCmd.AddCommand(serveCmd())
 	rootCmd.AddCommand(keygenCmd())
+	rootCmd.AddCommand(diagnoseCmd())
+	rootCmd.AddCommand(statusCmd())
+	rootCmd.AddCommand(validateCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
@@ -49,6 +61,7 @@ func clientCmd() *cobra.Command {
 	var configPath string
 	var listen string
 	var bootstrapPeers []string
+	var basePath string
 
 	cmd := &cobra.Command{
 		Use:   "client",
@@ -89,13 +102,19 @@ func clientCmd() *cobra.Command {
 			if len(bootstrapPeers) > 0 {
 				cfg.BootstrapPeers = bootstrapPeers
 			}
+			if cmd.Flags().Changed("base-path") {
+				cfg.BasePath = basePath
+			}
 
 			proxy, err := client.NewLocalProxy(cfg)
 			if err != nil {
 				return fmt.Errorf("创建代理失败: %w", err)
 			}
 
-			return proxy.Start()
+			ctx, stop := shutdownContext()
+			defer stop()
+			logRoutingTableOnSignal(ctx, "Client", proxy.RoutingTableReport)
+			return runUntilShutdown(ctx.Done(), proxy.Start, component{name: "Client", stop: proxy.Stop})
 		},
 	}
 
@@ -103,6 +122,7 @@ func clientCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&listen, "listen", "l", "127.0.0.1:8080", "监听地址")
 	cmd.Flags().StringArrayVar(&bootstrapPeers, "bootstrap-peer", nil,
 		"自定义引导节点 (multiaddr 格式，可多次指定)")
+	cmd.Flags().StringVar(&basePath, "base-path", "", "路由前缀 (如 /ai)，部署在反向代理之后时使用")
 
 	return cmd
 }
@@ -111,6 +131,7 @@ func clientCmd() *cobra.Command {
 func relayCmd() *cobra.Command {
 	var configPath string
 	var listen string
+	var noAutoGenerate bool
 
 	cmd := &cobra.Command{
 		Use:   "relay",
@@ -142,18 +163,28 @@ TLS 证书自动生成（绑定 PeerID），无需配置证书文件。
 					return fmt.Errorf("加载配置失败: %w", err)
 				}
 			}
+			if noAutoGenerate {
+				cfg.NoAutoGenerate = true
+			}
 
 			r, err := relay.New(cfg)
 			if err != nil {
 				return fmt.Errorf("创建中继节点失败: %w", err)
 			}
 
-			return r.Start()
+			ctx, stop := shutdownContext()
+			defer stop()
+			logRoutingTableOnSignal(ctx, "Relay", r.RoutingTableReport)
+			return runUntilShutdown(ctx.Done(), r.Start, component{
+				name: "Relay",
+				stop: drainThenStop(r.Drain, r.Stop, relayDrainTimeout),
+			})
 		},
 	}
 
 	cmd.Flags().StringVarP(&configPath, "config", "c", "configs/relay-dht.yaml", "配置文件路径")
 	cmd.Flags().StringVarP(&listen, "listen", "l", ":4433", "监听地址")
+	cmd.Flags().BoolVar(&noAutoGenerate, "no-auto-generate", false, "密钥缺失时报错而不是自动生成")
 
 	return cmd
 }
@@ -163,6 +194,7 @@ func exitCmd() *cobra.Command {
 	var configPath string
 	var backend, apiKey, privateKeyFile string
 	var headers []string
+	var noAutoGenerate bool
 
 	cmd := &cobra.Command{
 		Use:   "exit",
@@ -193,7 +225,7 @@ TLS 证书验证通过 PeerID 自动完成，无需配置 insecure_skip_verify
 				// 如果没有指定密钥，自动生成
 				if privateKeyFile == "" {
 					cfg.OHTTPPrivateKeyFile = "keys/ohttp_private.key"
-					pubKey, err := ensureOHTTPKey(cfg.OHTTPPrivateKeyFile)
+					pubKey, err := ensureOHTTPKey(cfg.OHTTPPrivateKeyFile, !noAutoGenerate)
 					if err != nil {
 						return err
 					}
@@ -205,13 +237,19 @@ TLS 证书验证通过 PeerID 自动完成，无需配置 insecure_skip_verify
 					return fmt.Errorf("加载配置失败: %w", err)
 				}
 			}
+			if noAutoGenerate {
+				cfg.NoAutoGenerate = true
+			}
 
 			e, err := exit.New(cfg)
 			if err != nil {
 				return fmt.Errorf("创建出口节点失败: %w", err)
 			}
 
-			return e.Start()
+			ctx, stop := shutdownContext()
+			defer stop()
+			logRoutingTableOnSignal(ctx, "Exit", e.RoutingTableReport)
+			return runUntilShutdown(ctx.Done(), e.Start, component{name: "Exit", stop: e.Stop})
 		},
 	}
 
@@ -220,14 +258,16 @@ TLS 证书验证通过 PeerID 自动完成，无需配置 insecure_skip_verify
 	cmd.Flags().StringVar(&apiKey, "api-key", "", "AI 后端 API Key")
 	cmd.Flags().StringArrayVar(&headers, "header", nil, "自定义后端请求头 (格式: Key:Value，可多次指定)")
 	cmd.Flags().StringVar(&privateKeyFile, "private-key", "", "OHTTP 私钥文件")
+	cmd.Flags().BoolVar(&noAutoGenerate, "no-auto-generate", false, "密钥缺失时报错而不是自动生成")
 
 	return cmd
 }
 
 // serveCmd 一体化服务命令
 func serveCmd() *cobra.Command {
-	var listen, backend, apiKey string
+	var listen, backend, apiKey, basePath string
 	var headers []string
+	var noAutoGenerate bool
 
 	cmd := &cobra.Command{
 		Use:   "serve",
@@ -254,9 +294,12 @@ TLS 证书自动生成（绑定 PeerID），无需配置证书文件。
 				return fmt.Errorf("必须指定 --backend 参数")
 			}
 
+			ctx, stop := shutdownContext()
+			defer stop()
+
 			// 确保 OHTTP 密钥存在
 			privateKeyFile := "keys/ohttp_private.key"
-			pubKey, err := ensureOHTTPKey(privateKeyFile)
+			pubKey, err := ensureOHTTPKey(privateKeyFile, !noAutoGenerate)
 			if err != nil {
 				return err
 			}
@@ -268,10 +311,12 @@ TLS 证书自动生成（绑定 PeerID），无需配置证书文件。
 			exitCfg := &config.ExitConfig{
 				OHTTPPrivateKeyFile: privateKeyFile,
 				AIBackend:           config.AIBackend{URL: backend, APIKey: apiKey, Headers: headerMap},
+				NoAutoGenerate:      noAutoGenerate,
 			}
 
 			relayCfg := &config.RelayConfig{
-				Listen: relayListen,
+				Listen:         relayListen,
+				NoAutoGenerate: noAutoGenerate,
 			}
 
 			// 解析 Exit 公钥
@@ -301,14 +346,18 @@ TLS 证书自动生成（绑定 PeerID），无需配置证书文件。
 				return fmt.Errorf("创建 Exit 节点失败: %w", err)
 			}
 			go func() {
-				if err := e.Start(); err != nil {
+				// 就绪前的启动失败由下方 Ready/Err 处理
+				if err := e.Start(); err != nil && e.Err() == nil {
 					log.Fatalf("Exit 节点错误: %v", err)
 				}
 			}()
 
-			// 等待 Exit 隧道建立
+			// 等待 Exit 隧道建立 (注册失败时 Ready 同样关闭，由 Err 返回原因)
 			select {
 			case <-e.Ready():
+				if err := e.Err(); err != nil {
+					return fmt.Errorf("Exit 启动失败: %w", err)
+				}
 				log.Printf("Exit 已就绪")
 			case <-time.After(5 * time.Second):
 				return fmt.Errorf("Exit 启动超时")
@@ -324,6 +373,8 @@ TLS 证书自动生成（绑定 PeerID），无需配置证书文件。
 			if err != nil {
 				return fmt.Errorf("创建 Client 失败: %w", err)
 			}
+			basePath = strings.TrimRight(basePath, "/")
+			proxy.SetBasePath(basePath)
 			go func() {
 				if err := proxy.Start(); err != nil {
 					log.Fatalf("Client 错误: %v", err)
@@ -331,21 +382,22 @@ TLS 证书自动生成（绑定 PeerID），无需配置证书文件。
 			}()
 
 			log.Printf("TokenGo 服务已启动!")
-			log.Printf("  本地 API: http://127.0.0.1%s", listen)
+			log.Printf("  本地 API: http://127.0.0.1%s%s", listen, basePath)
 			log.Printf("  AI 后端:  %s", backend)
 			log.Printf("")
 			log.Printf("测试命令:")
-			log.Printf(`  curl http://127.0.0.1%s/v1/chat/completions \`, listen)
+			log.Printf(`  curl http://127.0.0.1%s%s/v1/chat/completions \`, listen, basePath)
 			log.Printf(`    -H "Content-Type: application/json" \`)
 			log.Printf(`    -d '{"model":"llama3.2:1b","messages":[{"role":"user","content":"hello"}]}'`)
 
-			// 等待信号
-			sigCh := make(chan os.Signal, 1)
-			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-			<-sigCh
-			log.Println("收到停止信号，正在关闭...")
-
-			return nil
+			// 等待信号，按 Client → Exit → Relay 顺序关闭
+			<-ctx.Done()
+			log.Println("收到关闭信号，正在关闭...")
+			return shutdownAll(
+				component{name: "Client", stop: proxy.Stop},
+				component{name: "Exit", stop: e.Stop},
+				component{name: "Relay", stop: r.Stop},
+			)
 		},
 	}
 
@@ -353,6 +405,8 @@ TLS 证书自动生成（绑定 PeerID），无需配置证书文件。
 	cmd.Flags().StringVarP(&backend, "backend", "b", "", "AI 后端地址 (必需)")
 	cmd.Flags().StringVar(&apiKey, "api-key", "", "AI 后端 API Key")
 	cmd.Flags().StringArrayVar(&headers, "header", nil, "自定义后端请求头 (格式: Key:Value，可多次指定)")
+	cmd.Flags().BoolVar(&noAutoGenerate, "no-auto-generate", false, "密钥缺失时报错而不是自动生成")
+	cmd.Flags().StringVar(&basePath, "base-path", "", "本地 API 路由前缀 (如 /ai)")
 
 	return cmd
 }
@@ -388,6 +442,104 @@ func keygenCmd() *cobra.Command {
 	return cmd
 }
 
+// diagnoseCmd 路径诊断命令
+func diagnoseCmd() *cobra.Command {
+	var relayAddr string
+	var exitHash string
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "diagnose",
+		Short: "诊断指定 Relay → Exit 路径",
+		Long:  `连接指定 Relay，向指定 Exit 发送 canary OHTTP 请求，逐跳报告 Relay 可达性、Exit 注册状态和后端响应。`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if relayAddr == "" || exitHash == "" {
+				return fmt.Errorf("必须指定 --relay 和 --exit")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			report := client.Diagnose(ctx, relayAddr, exitHash)
+			report.Print(os.Stdout)
+			if !report.OK() {
+				return fmt.Errorf("诊断失败: %s", report.Failed().Detail)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&relayAddr, "relay", "", "Relay 地址 (host:port)")
+	cmd.Flags().StringVar(&exitHash, "exit", "", "Exit 公钥哈希")
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Second, "诊断总超时")
+
+	return cmd
+}
+
+// statusCmd Relay 状态查询命令
+func statusCmd() *cobra.Command {
+	var relayAddr string
+	var asJSON bool
+	var showModels bool
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "查询 Relay 运行状态",
+		Long: `连接指定 Relay，查询运行时间、已注册 Exit 的 pubKeyHash、实例数和最近心跳时间。
+指定 --models 时改为查询各 Exit 通告的可服务模型。`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if relayAddr == "" {
+				return fmt.Errorf("必须指定 --relay")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			c, _ := client.NewClientDynamic()
+			defer c.Close()
+			c.SetRelay(relayAddr)
+			if err := c.Connect(ctx); err != nil {
+				return fmt.Errorf("连接 Relay 失败: %w", err)
+			}
+
+			if showModels {
+				models, err := c.QueryExitModels(ctx)
+				if err != nil {
+					return fmt.Errorf("查询 Exit 模型列表失败: %w", err)
+				}
+				if asJSON {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(models)
+				}
+				client.PrintExitModels(os.Stdout, models)
+				return nil
+			}
+
+			status, err := c.QueryStatus(ctx)
+			if err != nil {
+				return fmt.Errorf("查询 Relay 状态失败: %w", err)
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(status)
+			}
+			client.PrintStatus(os.Stdout, relayAddr, status)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&relayAddr, "relay", "", "Relay 地址 (host:port)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "以 JSON 格式输出")
+	cmd.Flags().BoolVar(&showModels, "models", false, "查询各 Exit 通告的可服务模型")
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Second, "查询超时")
+
+	return cmd
+}
+
 // generateOHTTPKey 生成 OHTTP 密钥
 func generateOHTTPKey(outputDir string) error {
 	kp, err := crypto.GenerateKeyPair()
@@ -449,34 +601,14 @@ func parseHeaders(headers []string) map[string]string {
 }
 
 // ensureOHTTPKey 确保 OHTTP 密钥存在，返回公钥
-func ensureOHTTPKey(keyFile string) (string, error) {
-	dir := filepath.Dir(keyFile)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", fmt.Errorf("创建目录失败: %w", err)
-	}
-
-	// 检查私钥是否存在
-	if _, err := os.Stat(keyFile); os.IsNotExist(err) {
-		log.Printf("OHTTP 密钥不存在，自动生成...")
-		kp, err := crypto.GenerateKeyPair()
-		if err != nil {
-			return "", fmt.Errorf("生成密钥对失败: %w", err)
-		}
-
-		pubPath := keyFile + ".pub"
-		if err := crypto.SaveKeyPair(kp, pubPath, keyFile); err != nil {
-			return "", fmt.Errorf("保存密钥失败: %w", err)
-		}
-		log.Printf("密钥已生成: %s", keyFile)
-	}
-
-	// 读取公钥
-	pubPath := keyFile + ".pub"
-	pubData, err := os.ReadFile(pubPath)
+// autoGenerate 为 false 时密钥缺失直接报错，避免挂载失败时静默生成新密钥
+func ensureOHTTPKey(keyFile string, autoGenerate bool) (string, error) {
+	pubKey, generated, err := crypto.EnsureKeyPair(keyFile, autoGenerate)
 	if err != nil {
-		return "", fmt.Errorf("读取公钥失败: %w", err)
+		return "", err
 	}
-
-	return string(pubData), nil
+	if generated {
+		log.Printf("OHTTP 密钥不存在，已自动生成: %s", keyFile)
+	}
+	return pubKey, nil
 }
-
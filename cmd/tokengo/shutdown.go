@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// relayDrainTimeout Relay 关闭前等待进行中请求完成的最长时间
+const relayDrainTimeout = 30 * time.Second
+
+// component 由 CLI 统一关闭的组件
+type component struct {
+	name string
+	stop func() error
+}
+
+// shutdownContext 返回收到 SIGINT/SIGTERM 时取消的 context
+// 信号只在 CLI 层注册一次，各节点不再自行监听
+func shutdownContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// drainThenStop 先在 timeout 内优雅排空，再执行 stop (排空失败只记录日志，不阻止关闭)
+func drainThenStop(drain func(context.Context) error, stop func() error, timeout time.Duration) func() error {
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := drain(ctx); err != nil {
+			log.Printf("排空未完成: %v", err)
+		}
+		return stop()
+	}
+}
+
+// shutdownAll 按顺序停止组件，单个组件失败不影响后续组件
+func shutdownAll(components ...component) error {
+	var errs []error
+	for _, c := range components {
+		log.Printf("正在关闭 %s...", c.name)
+		if err := c.stop(); err != nil {
+			errs = append(errs, fmt.Errorf("关闭 %s 失败: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runUntilShutdown 运行阻塞的 start，直到其返回或 trigger 关闭，然后按顺序停止组件
+func runUntilShutdown(trigger <-chan struct{}, start func() error, components ...component) error {
+	errCh := make(chan error, 1)
+	go func() { errCh <- start() }()
+
+	select {
+	case err := <-errCh:
+		// 启动失败或自行退出，仍释放已启动的资源
+		if stopErr := shutdownAll(components...); stopErr != nil {
+			log.Printf("关闭失败: %v", stopErr)
+		}
+		return err
+	case <-trigger:
+		log.Println("收到关闭信号，正在关闭...")
+		return shutdownAll(components...)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShutdownAll_StopsInOrder(t *testing.T) {
+	var order []string
+	stopErr := errors.New("stop failed")
+	components := []component{
+		{name: "Client", stop: func() error { order = append(order, "Client"); return nil }},
+		{name: "Exit", stop: func() error { order = append(order, "Exit"); return stopErr }},
+		{name: "Relay", stop: func() error { order = append(order, "Relay"); return nil }},
+	}
+
+	err := shutdownAll(components...)
+	if !errors.Is(err, stopErr) {
+		t.Fatalf("应返回组件关闭错误, got %v", err)
+	}
+	// 单个组件失败不应阻止后续组件关闭
+	if want := []string{"Client", "Exit", "Relay"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("关闭顺序 = %v, want %v", order, want)
+	}
+}
+
+func TestRunUntilShutdown_Trigger(t *testing.T) {
+	trigger := make(chan struct{})
+	release := make(chan struct{})
+	stopped := false
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runUntilShutdown(trigger, func() error {
+			<-release
+			return nil
+		}, component{name: "Node", stop: func() error {
+			stopped = true
+			close(release)
+			return nil
+		}})
+	}()
+
+	close(trigger)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runUntilShutdown 返回错误: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("收到关闭信号后未返回")
+	}
+	if !stopped {
+		t.Fatal("组件未被关闭")
+	}
+}
+
+func TestRunUntilShutdown_StartError(t *testing.T) {
+	startErr := errors.New("listen failed")
+	stopped := false
+
+	err := runUntilShutdown(make(chan struct{}), func() error {
+		return startErr
+	}, component{name: "Node", stop: func() error {
+		stopped = true
+		return nil
+	}})
+	if !errors.Is(err, startErr) {
+		t.Fatalf("应返回启动错误, got %v", err)
+	}
+	if !stopped {
+		t.Fatal("启动失败后应释放组件")
+	}
+}
+
+func TestDrainThenStop(t *testing.T) {
+	var order []string
+	drainErr := errors.New("drain timed out")
+	stop := drainThenStop(func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("排空 context 应带截止时间")
+		}
+		order = append(order, "drain")
+		return drainErr
+	}, func() error {
+		order = append(order, "stop")
+		return nil
+	}, time.Second)
+
+	// 排空失败不阻止关闭
+	if err := stop(); err != nil {
+		t.Fatalf("stop 返回错误: %v", err)
+	}
+	if want := []string{"drain", "stop"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("调用顺序 = %v, want %v", order, want)
+	}
+}
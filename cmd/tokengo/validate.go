@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/binn/tokengo/internal/cert"
+	"github.com/binn/tokengo/internal/client"
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/dht"
+	"github.com/binn/tokengo/internal/loadbalancer"
+	"github.com/binn/tokengo/internal/netutil"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/spf13/cobra"
+)
+
+// validateCmd 配置文件检查命令
+func validateCmd() *cobra.Command {
+	var configPath string
+	var nodeType string
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "检查配置文件 (不启动服务)",
+		Long: `加载配置文件并执行语义检查: 监听地址、密钥文件、后端地址、DHT 参数等，逐项报告问题。
+不会启动任何服务，也不会自动生成缺失的密钥。
+
+示例:
+  tokengo validate --config configs/exit-dht.yaml --type exit`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			problems, err := validateConfig(nodeType, configPath)
+			if err != nil {
+				return err
+			}
+			printValidateReport(os.Stdout, nodeType, configPath, problems)
+			if len(problems) > 0 {
+				cmd.SilenceUsage = true // 配置问题已逐项输出，不再附带用法说明
+				return fmt.Errorf("配置检查失败: %d 个问题", len(problems))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&configPath, "config", "c", "", "配置文件路径")
+	cmd.Flags().StringVarP(&nodeType, "type", "t", "", "配置类型 (client、relay 或 exit)")
+	cmd.MarkFlagRequired("config")
+	cmd.MarkFlagRequired("type")
+
+	return cmd
+}
+
+// validateConfig 加载并检查配置，返回发现的问题；配置无法加载或类型未知时返回 error
+// 除配置自身的 Validate 外，还检查需要由其他模块解析的字段 (选择策略、地址族、公钥内容等)
+func validateConfig(nodeType, path string) ([]error, error) {
+	var errs []error
+	switch nodeType {
+	case "client":
+		cfg, err := config.LoadClientConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, cfg.Validate())
+		if _, err := loadbalancer.NewSelector(cfg.RelaySelector); err != nil {
+			errs = append(errs, err)
+		}
+		if _, err := netutil.ParseAddrFamily(cfg.AddressFamily); err != nil {
+			errs = append(errs, err)
+		}
+		if err := dht.ValidateNetworkID(cfg.NetworkID); err != nil {
+			errs = append(errs, err)
+		}
+		if cfg.SessionKey != "" {
+			if _, err := client.NewSessionRouter(cfg.SessionKey); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	case "relay":
+		cfg, err := config.LoadRelayConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, cfg.Validate())
+		if _, err := cert.ParseSANs(cfg.CertSANs); err != nil {
+			errs = append(errs, err)
+		}
+		if err := dht.ValidateNetworkID(cfg.DHT.NetworkID); err != nil {
+			errs = append(errs, err)
+		}
+	case "exit":
+		cfg, err := config.LoadExitConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, cfg.Validate())
+		if err := protocol.ValidateCapabilities(cfg.Capabilities); err != nil {
+			errs = append(errs, err)
+		}
+		if _, err := crypto.ParseAEADs(cfg.OHTTPAEADs); err != nil {
+			errs = append(errs, err)
+		}
+		if err := dht.ValidateNetworkID(cfg.DHT.NetworkID); err != nil {
+			errs = append(errs, err)
+		}
+		if _, err := netutil.ParseAddrFamily(cfg.AddressFamily); err != nil {
+			errs = append(errs, err)
+		}
+		pubKeyFile := cfg.OHTTPPublicKeyFile
+		if pubKeyFile == "" && cfg.OHTTPPrivateKeyFile != "" {
+			pubKeyFile = cfg.OHTTPPrivateKeyFile + ".pub"
+		}
+		pubKeyFiles := []string{pubKeyFile}
+		for _, path := range cfg.AdditionalOHTTPKeyFiles {
+			pubKeyFiles = append(pubKeyFiles, path+".pub")
+		}
+		for _, path := range pubKeyFiles {
+			// 文件缺失已由 Validate 报告，这里只检查内容能否解码
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			if _, _, err := crypto.LoadPublicKeyConfig(string(data)); err != nil {
+				errs = append(errs, fmt.Errorf("公钥文件 %s 无效: %w", path, err))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("未知的配置类型: %s (支持: client, relay, exit)", nodeType)
+	}
+	return flattenErrors(errs), nil
+}
+
+// flattenErrors 展开 errors.Join 的结果，每个问题单独一项
+func flattenErrors(errs []error) []error {
+	var flat []error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			flat = append(flat, flattenErrors(joined.Unwrap())...)
+			continue
+		}
+		flat = append(flat, err)
+	}
+	return flat
+}
+
+// printValidateReport 输出检查结果
+func printValidateReport(w io.Writer, nodeType, path string, problems []error) {
+	if len(problems) == 0 {
+		fmt.Fprintf(w, "✓ %s 配置 %s 检查通过\n", nodeType, path)
+		return
+	}
+	fmt.Fprintf(w, "✗ %s 配置 %s 发现 %d 个问题:\n", nodeType, path, len(problems))
+	for _, err := range problems {
+		fmt.Fprintf(w, "  - %v\n", err)
+	}
+}
@@ -0,0 +1,58 @@
+// Package bootstrap 提供 Bootstrap API (bootstrap.json) 客户端，作为 DHT 不可用时的备用 Relay 来源
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/binn/tokengo/internal/dht"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Client 从 bootstrap.json 的 relays 字段获取 Relay 服务地址
+// 内置的 bootstrap.json 只发布 DHT bootstrap peers，不含 relays，需指定发布了 Relay 地址的 URL
+type Client struct {
+	urls   []string
+	client *http.Client
+}
+
+// NewClient 创建 Bootstrap API 客户端，按顺序尝试 urls
+func NewClient(urls []string) *Client {
+	return &Client{
+		urls:   urls,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// FetchRelays 依次尝试各地址，返回第一个非空的 Relay 列表；全部失败时返回最后一个错误
+func (c *Client) FetchRelays(ctx context.Context) ([]peer.AddrInfo, error) {
+	lastErr := fmt.Errorf("bootstrap.json 未提供 Relay 地址")
+	for _, url := range c.urls {
+		peerList, err := dht.FetchBootstrapPeerList(ctx, c.client, url)
+		if err != nil {
+			lastErr = fmt.Errorf("从 %s 获取 bootstrap.json 失败: %w", url, err)
+			continue
+		}
+		if relays := parseRelays(peerList.Relays); len(relays) > 0 {
+			return relays, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// parseRelays 解析 Relay 的 QUIC multiaddr (需包含 /p2p/<PeerID>)，跳过无效地址
+func parseRelays(addrs []string) []peer.AddrInfo {
+	var relays []peer.AddrInfo
+	for _, addr := range addrs {
+		info, err := peer.AddrInfoFromString(addr)
+		if err != nil {
+			log.Printf("警告: 解析 bootstrap relays 地址失败 %s: %v", addr, err)
+			continue
+		}
+		relays = append(relays, *info)
+	}
+	return relays
+}
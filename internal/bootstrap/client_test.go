@@ -0,0 +1,46 @@
+package bootstrap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const relayAddr = "/ip4/127.0.0.1/udp/4433/quic-v1/p2p/12D3KooWCjYH5XUjVRi6DymRZpLj2pDAFxnK3xJ8gcJQMgswT6fU"
+
+func serveJSON(t *testing.T, body string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestClient_FetchRelays(t *testing.T) {
+	broken := serveJSON(t, `not json`)
+	peersOnly := serveJSON(t, `{"version":1,"peers":["/ip4/1.2.3.4/tcp/4003/p2p/12D3KooWCjYH5XUjVRi6DymRZpLj2pDAFxnK3xJ8gcJQMgswT6fU"]}`)
+	withRelays := serveJSON(t, `{"version":1,"peers":[],"relays":["not-a-multiaddr","`+relayAddr+`"]}`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 跳过失败和不含 relays 的地址，忽略无效的 Relay 地址
+	relays, err := NewClient([]string{broken, peersOnly, withRelays}).FetchRelays(ctx)
+	if err != nil {
+		t.Fatalf("FetchRelays: %v", err)
+	}
+	if len(relays) != 1 || relays[0].ID.String() != "12D3KooWCjYH5XUjVRi6DymRZpLj2pDAFxnK3xJ8gcJQMgswT6fU" || len(relays[0].Addrs) != 1 {
+		t.Errorf("relays = %v, want the single valid relay", relays)
+	}
+
+	// 没有地址提供 relays 时返回错误
+	if relays, err := NewClient([]string{peersOnly}).FetchRelays(ctx); err == nil {
+		t.Errorf("FetchRelays = %v, want an error when no relays are published", relays)
+	}
+	if _, err := NewClient(nil).FetchRelays(ctx); err == nil {
+		t.Error("FetchRelays with no URLs should fail")
+	}
+}
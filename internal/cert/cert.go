@@ -8,11 +8,15 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"math/big"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
@@ -23,9 +27,67 @@ import (
 const CertFileName = "relay-cert.pem"
 const KeyFileName = "relay-key.pem"
 
+// libp2p TLS 规范的签名公钥扩展
+// 节点身份私钥对 "libp2p-tls-handshake:" + 证书 SubjectPublicKeyInfo 签名，
+// 证明 TLS 密钥由该身份授权，而不只是 CommonName 中写了对应的 PeerID
+var signedKeyExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 53594, 1, 1}
+
+const signedKeyPrefix = "libp2p-tls-handshake:"
+
+// 过渡身份签名扩展 (TokenGo 私有，非关键扩展，旧版本验证方忽略)
+// 身份密钥轮换期间，旧身份私钥同样签名 TLS 公钥，证书可按新旧任一 PeerID 验证
+var transitionalKeysExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 53594, 1, 1, 1}
+
+// signedKey 签名公钥扩展的 ASN.1 结构
+type signedKey struct {
+	PubKey    []byte // protobuf 编码的 libp2p 公钥
+	Signature []byte
+}
+
+// ErrNoSignedKey 证书缺少身份签名扩展 (旧版本生成或伪造的证书)
+var ErrNoSignedKey = errors.New("证书缺少身份签名扩展")
+
+// SANs 证书附加的 Subject Alternative Names (PeerID 之外)
+// 供不使用 PeerID 验证的客户端按 Relay 的真实域名/IP 校验主机名
+type SANs struct {
+	DNSNames []string
+	IPs      []net.IP
+}
+
+// ParseSANs 解析 SAN 列表: 可解析为 IP 的条目作为 IP SAN，其余作为 DNS 名称
+func ParseSANs(entries []string) (SANs, error) {
+	var sans SANs
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			return SANs{}, fmt.Errorf("SAN 条目为空")
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			sans.IPs = append(sans.IPs, ip)
+			continue
+		}
+		if strings.ContainsAny(entry, " /:") {
+			return SANs{}, fmt.Errorf("无效的 SAN 条目: %q", entry)
+		}
+		sans.DNSNames = append(sans.DNSNames, entry)
+	}
+	return sans, nil
+}
+
 // GeneratePeerIDCert 生成绑定 PeerID 的自签名证书
 // 如果certDir 为空，则不保存到文件
 func GeneratePeerIDCert(privKey crypto.PrivKey, certDir string) (*tls.Certificate, error) {
+	return GeneratePeerIDCertWithSANs(privKey, certDir, SANs{})
+}
+
+// GeneratePeerIDCertWithSANs 生成绑定 PeerID 的自签名证书，并附加指定的 DNS/IP SAN
+func GeneratePeerIDCertWithSANs(privKey crypto.PrivKey, certDir string, sans SANs) (*tls.Certificate, error) {
+	return GenerateTransitionalPeerIDCert(privKey, nil, certDir, sans)
+}
+
+// GenerateTransitionalPeerIDCert 生成同时绑定主身份和过渡身份的自签名证书
+// CommonName 和签名公钥扩展使用主身份；过渡身份的签名写入独立扩展，PeerID 追加为 SAN
+func GenerateTransitionalPeerIDCert(privKey crypto.PrivKey, transitional []crypto.PrivKey, certDir string, sans SANs) (*tls.Certificate, error) {
 	// 从 libp2p 私钥提取 ECDSA 私钥
 	ecdsaPrivKey, err := extractECDSAPrivKey(privKey)
 	if err != nil {
@@ -38,6 +100,36 @@ func GeneratePeerIDCert(privKey crypto.PrivKey, certDir string) (*tls.Certificat
 		return nil, fmt.Errorf("计算 PeerID 失败: %w", err)
 	}
 
+	// 用身份私钥签名 TLS 公钥
+	extension, err := newSignedKeyExtension(privKey, &ecdsaPrivKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	extensions := []pkix.Extension{extension}
+	dnsNames := []string{peerID.String()} // PeerID 作为首个 SAN
+
+	// 过渡身份同样签名 TLS 公钥
+	if len(transitional) > 0 {
+		keys := make([]signedKey, 0, len(transitional))
+		for _, key := range transitional {
+			sk, err := signTLSKey(key, &ecdsaPrivKey.PublicKey)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, sk)
+			id, err := peer.IDFromPrivateKey(key)
+			if err != nil {
+				return nil, fmt.Errorf("计算过渡 PeerID 失败: %w", err)
+			}
+			dnsNames = append(dnsNames, id.String())
+		}
+		value, err := asn1.Marshal(keys)
+		if err != nil {
+			return nil, fmt.Errorf("编码过渡身份扩展失败: %w", err)
+		}
+		extensions = append(extensions, pkix.Extension{Id: transitionalKeysExtensionOID, Value: value})
+	}
+
 	// 生成证书模板
 	serialNumber, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	template := &x509.Certificate{
@@ -51,7 +143,9 @@ func GeneratePeerIDCert(privKey crypto.PrivKey, certDir string) (*tls.Certificat
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
-		DNSNames:              []string{peerID.String()}, // 将 PeerID 作为 SAN
+		DNSNames:              append(dnsNames, sans.DNSNames...),
+		IPAddresses:           sans.IPs,
+		ExtraExtensions:       extensions,
 	}
 
 	// 生成证书
@@ -77,16 +171,117 @@ func GeneratePeerIDCert(privKey crypto.PrivKey, certDir string) (*tls.Certificat
 	return cert, nil
 }
 
-// extractECDSAPrivKey 从 libp2p 私钥提取/生成 ECDSA 私钥
-// libp2p 使用 Ed25519 或 ECDSA (secp256k1)
-// 我们需要生成新的 ECDSA P-256 密钥对用于 TLS
-// 证书仍然绑定 PeerID（通过 CommonName 字段）
+// extractECDSAPrivKey 为 TLS 生成 ECDSA P-256 密钥对
+// libp2p 身份密钥 (Ed25519 等) 不直接用于 TLS，由 newSignedKeyExtension 签名授权该密钥
 func extractECDSAPrivKey(privKey crypto.PrivKey) (*ecdsa.PrivateKey, error) {
-	// 为 TLS 生成新的 ECDSA P-256 密钥对
-	// 证书的 CommonName 会设置为 PeerID，保证身份绑定
 	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 }
 
+// newSignedKeyExtension 构造签名公钥扩展: 身份私钥签名 TLS 公钥的 SubjectPublicKeyInfo
+func newSignedKeyExtension(identity crypto.PrivKey, tlsPub *ecdsa.PublicKey) (pkix.Extension, error) {
+	sk, err := signTLSKey(identity, tlsPub)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	value, err := asn1.Marshal(sk)
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("编码签名扩展失败: %w", err)
+	}
+	return pkix.Extension{Id: signedKeyExtensionOID, Value: value}, nil
+}
+
+// signTLSKey 用身份私钥签名 TLS 公钥的 SubjectPublicKeyInfo
+func signTLSKey(identity crypto.PrivKey, tlsPub *ecdsa.PublicKey) (signedKey, error) {
+	spki, err := x509.MarshalPKIXPublicKey(tlsPub)
+	if err != nil {
+		return signedKey{}, fmt.Errorf("编码 TLS 公钥失败: %w", err)
+	}
+	signature, err := identity.Sign(append([]byte(signedKeyPrefix), spki...))
+	if err != nil {
+		return signedKey{}, fmt.Errorf("身份私钥签名失败: %w", err)
+	}
+	pubKey, err := crypto.MarshalPublicKey(identity.GetPublic())
+	if err != nil {
+		return signedKey{}, fmt.Errorf("编码身份公钥失败: %w", err)
+	}
+	return signedKey{PubKey: pubKey, Signature: signature}, nil
+}
+
+// verifySignedKey 校验签名公钥扩展中的签名覆盖证书的 TLS 公钥，返回签名身份的 PeerID
+func verifySignedKey(cert *x509.Certificate, sk signedKey) (peer.ID, error) {
+	pubKey, err := crypto.UnmarshalPublicKey(sk.PubKey)
+	if err != nil {
+		return "", fmt.Errorf("解析身份公钥失败: %w", err)
+	}
+	ok, err := pubKey.Verify(append([]byte(signedKeyPrefix), cert.RawSubjectPublicKeyInfo...), sk.Signature)
+	if err != nil || !ok {
+		return "", fmt.Errorf("身份签名无效")
+	}
+	return peer.IDFromPublicKey(pubKey)
+}
+
+// PeerIDsFromCert 返回证书可验证的全部 PeerID: 主身份在前，随后是过渡身份
+// 任一过渡身份签名无效时整体拒绝，避免伪造的扩展借用合法证书
+func PeerIDsFromCert(cert *x509.Certificate) ([]peer.ID, error) {
+	primary, err := PeerIDFromCert(cert)
+	if err != nil {
+		return nil, err
+	}
+	ids := []peer.ID{primary}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(transitionalKeysExtensionOID) {
+			continue
+		}
+		var keys []signedKey
+		if rest, err := asn1.Unmarshal(ext.Value, &keys); err != nil || len(rest) > 0 {
+			return nil, fmt.Errorf("解析过渡身份扩展失败")
+		}
+		for _, sk := range keys {
+			id, err := verifySignedKey(cert, sk)
+			if err != nil {
+				return nil, fmt.Errorf("过渡身份: %w", err)
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// PeerIDFromCert 校验证书的身份签名扩展，返回签发该证书的节点 PeerID
+// 同时校验证书自签名和有效期，确保扩展签名的公钥就是证书 (即 TLS 握手) 使用的公钥
+func PeerIDFromCert(cert *x509.Certificate) (peer.ID, error) {
+	var raw []byte
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(signedKeyExtensionOID) {
+			raw = ext.Value
+			break
+		}
+	}
+	if raw == nil {
+		return "", ErrNoSignedKey
+	}
+
+	var sk signedKey
+	if rest, err := asn1.Unmarshal(raw, &sk); err != nil || len(rest) > 0 {
+		return "", fmt.Errorf("解析身份签名扩展失败")
+	}
+	id, err := verifySignedKey(cert, sk)
+	if err != nil {
+		return "", err
+	}
+
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		return "", fmt.Errorf("证书自签名无效: %w", err)
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return "", fmt.Errorf("证书不在有效期内")
+	}
+
+	return id, nil
+}
+
 // saveCertFiles 保存证书和私钥到文件
 func saveCertFiles(dir string, certDER []byte, privKey *ecdsa.PrivateKey) error {
 	// 确保目录存在
@@ -126,7 +321,7 @@ func LoadOrGenerateCert(certDir string, privKey crypto.PrivKey) (*tls.Certificat
 	if _, err := os.Stat(certPath); err == nil {
 		if _, err := os.Stat(keyPath); err == nil {
 			cert, err := tls.LoadX509KeyPair(certPath, keyPath)
-			if err == nil {
+			if err == nil && certMatchesIdentity(&cert, privKey) {
 				return &cert, nil
 			}
 		}
@@ -136,8 +331,21 @@ func LoadOrGenerateCert(certDir string, privKey crypto.PrivKey) (*tls.Certificat
 	return GeneratePeerIDCert(privKey, certDir)
 }
 
-// VerifyPeerID 验证证书中的 PeerID 是否匹配期望的 PeerID
-// 返回 nil 表示验证通过
+// certMatchesIdentity 检查已有证书是否由当前身份签发 (旧版本证书缺少签名扩展，需重新生成)
+func certMatchesIdentity(cert *tls.Certificate, privKey crypto.PrivKey) bool {
+	if len(cert.Certificate) == 0 {
+		return false
+	}
+	expected, err := peer.IDFromPrivateKey(privKey)
+	if err != nil {
+		return false
+	}
+	return VerifyPeerID(cert.Certificate, expected) == nil
+}
+
+// VerifyPeerID 验证证书由期望 PeerID 对应的身份私钥签发 (主身份或过渡身份均可)
+// 只比对 CommonName/SAN 字符串无法防止冒充 (任何人都能签发写有某 PeerID 的证书)，
+// 因此要求证书携带身份签名扩展并校验签名；返回 nil 表示验证通过
 func VerifyPeerID(rawCerts [][]byte, expectedPeerID peer.ID) error {
 	if len(rawCerts) == 0 {
 		return fmt.Errorf("没有证书")
@@ -148,20 +356,16 @@ func VerifyPeerID(rawCerts [][]byte, expectedPeerID peer.ID) error {
 		return fmt.Errorf("解析证书失败: %w", err)
 	}
 
-	// 检查 CommonName 或 DNSNames 是否包含期望的 PeerID
-	peerIDStr := expectedPeerID.String()
-
-	if cert.Subject.CommonName == peerIDStr {
-		return nil
+	peerIDs, err := PeerIDsFromCert(cert)
+	if err != nil {
+		return fmt.Errorf("验证证书身份失败 (期望 %s): %w", expectedPeerID, err)
 	}
-
-	for _, name := range cert.DNSNames {
-		if name == peerIDStr {
+	for _, id := range peerIDs {
+		if id == expectedPeerID {
 			return nil
 		}
 	}
-
-	return fmt.Errorf("证书 PeerID 不匹配: 期望 %s, 证书中为 %s", peerIDStr, cert.Subject.CommonName)
+	return fmt.Errorf("证书 PeerID 不匹配: 期望 %s, 证书签发者为 %v", expectedPeerID, peerIDs)
 }
 
 // CreatePeerIDVerifyTLSConfig 创建验证 PeerID 的 TLS 配置 (Client 使用)
@@ -173,6 +377,7 @@ func CreatePeerIDVerifyTLSConfig(expectedPeerID peer.ID) *tls.Config {
 		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
 			return VerifyPeerID(rawCerts, expectedPeerID)
 		},
+		VerifyConnection: verifyResumedPeerID(expectedPeerID),
 	}
 }
 
@@ -185,7 +390,52 @@ func CreateExitTLSConfig(expectedPeerID peer.ID) *tls.Config {
 		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
 			return VerifyPeerID(rawCerts, expectedPeerID)
 		},
+		VerifyConnection: verifyResumedPeerID(expectedPeerID),
+	}
+}
+
+// verifyResumedPeerID 会话恢复时不会调用 VerifyPeerCertificate，改为校验会话中保存的证书
+func verifyResumedPeerID(expectedPeerID peer.ID) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if !cs.DidResume {
+			return nil // 完整握手已由 VerifyPeerCertificate 校验
+		}
+		rawCerts := make([][]byte, len(cs.PeerCertificates))
+		for i, c := range cs.PeerCertificates {
+			rawCerts[i] = c.Raw
+		}
+		return VerifyPeerID(rawCerts, expectedPeerID)
+	}
+}
+
+// sessionCacheCapacity 会话票据缓存的容量 (按 Relay 计)
+const sessionCacheCapacity = 64
+
+// NewSessionCache 创建 TLS 会话票据缓存，在重连同一 Relay 时恢复会话，省去完整握手
+func NewSessionCache() tls.ClientSessionCache {
+	return tls.NewLRUClientSessionCache(sessionCacheCapacity)
+}
+
+// peerSessionCache 按 Relay PeerID 存取会话票据 (默认按拨号地址)，同一 Relay 换地址重连时也能恢复会话
+type peerSessionCache struct {
+	cache tls.ClientSessionCache
+	key   string
+}
+
+func (c peerSessionCache) Get(string) (*tls.ClientSessionState, bool) { return c.cache.Get(c.key) }
+func (c peerSessionCache) Put(_ string, cs *tls.ClientSessionState)   { c.cache.Put(c.key, cs) }
+
+// UseSessionCache 为客户端 TLS 配置启用会话恢复，cache 为 nil 时不做修改
+// peerID 不为空时按 PeerID 缓存票据 (恢复的会话仍校验证书 PeerID)，否则按拨号地址缓存
+func UseSessionCache(cfg *tls.Config, cache tls.ClientSessionCache, peerID peer.ID) {
+	if cache == nil {
+		return
+	}
+	if peerID != "" {
+		cfg.ClientSessionCache = peerSessionCache{cache: cache, key: "peer/" + peerID.String()}
+		return
 	}
+	cfg.ClientSessionCache = cache
 }
 
 // CreateServerTLSConfig 创建服务器端 TLS 配置
@@ -1,11 +1,19 @@
 package cert
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	libp2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -95,6 +103,62 @@ func TestGeneratePeerIDCert_SaveToDir(t *testing.T) {
 	}
 }
 
+func TestGeneratePeerIDCertWithSANs(t *testing.T) {
+	privKey, peerID := generateTestIdentity(t)
+
+	sans, err := ParseSANs([]string{"relay.example.com", "*.relay.example.com", "203.0.113.7", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("ParseSANs failed: %v", err)
+	}
+	cert, err := GeneratePeerIDCertWithSANs(privKey, "", sans)
+	if err != nil {
+		t.Fatalf("GeneratePeerIDCertWithSANs failed: %v", err)
+	}
+
+	x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate failed: %v", err)
+	}
+
+	wantDNS := []string{peerID.String(), "relay.example.com", "*.relay.example.com"}
+	if len(x509Cert.DNSNames) != len(wantDNS) {
+		t.Fatalf("DNSNames = %v, want %v", x509Cert.DNSNames, wantDNS)
+	}
+	for i, name := range wantDNS {
+		if x509Cert.DNSNames[i] != name {
+			t.Errorf("DNSNames[%d] = %q, want %q", i, x509Cert.DNSNames[i], name)
+		}
+	}
+
+	wantIPs := []net.IP{net.ParseIP("203.0.113.7"), net.ParseIP("2001:db8::1")}
+	if len(x509Cert.IPAddresses) != len(wantIPs) {
+		t.Fatalf("IPAddresses = %v, want %v", x509Cert.IPAddresses, wantIPs)
+	}
+	for i, ip := range wantIPs {
+		if !x509Cert.IPAddresses[i].Equal(ip) {
+			t.Errorf("IPAddresses[%d] = %v, want %v", i, x509Cert.IPAddresses[i], ip)
+		}
+	}
+
+	// 主机名校验按配置的域名/IP 通过
+	for _, host := range []string{"relay.example.com", "a.relay.example.com", "203.0.113.7", "2001:db8::1"} {
+		if err := x509Cert.VerifyHostname(host); err != nil {
+			t.Errorf("VerifyHostname(%q) failed: %v", host, err)
+		}
+	}
+	if err := x509Cert.VerifyHostname("other.example.com"); err == nil {
+		t.Error("VerifyHostname should fail for unconfigured host")
+	}
+}
+
+func TestParseSANs_Invalid(t *testing.T) {
+	for _, entry := range []string{"", "  ", "relay example.com", "https://relay.example.com"} {
+		if _, err := ParseSANs([]string{entry}); err == nil {
+			t.Errorf("ParseSANs(%q) should fail", entry)
+		}
+	}
+}
+
 func TestVerifyPeerID_Match(t *testing.T) {
 	privKey, peerID := generateTestIdentity(t)
 
@@ -225,3 +289,218 @@ func TestLoadOrGenerateCert_Generate(t *testing.T) {
 		t.Fatal("reloaded cert should not be nil")
 	}
 }
+
+// forgeCert 用全新的 TLS 密钥签发写有 peerID 的证书，可附加任意扩展 (模拟冒充者)
+func forgeCert(t *testing.T, peerID peer.ID, exts ...pkix.Extension) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: peerID.String()},
+		DNSNames:        []string{peerID.String()},
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: exts,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	return der
+}
+
+func TestVerifyPeerID_RejectsNameOnlyCert(t *testing.T) {
+	_, peerID := generateTestIdentity(t)
+
+	err := VerifyPeerID([][]byte{forgeCert(t, peerID)}, peerID)
+	if !errors.Is(err, ErrNoSignedKey) {
+		t.Fatalf("cert with only PeerID name should be rejected with ErrNoSignedKey, got %v", err)
+	}
+}
+
+func TestVerifyPeerID_RejectsCopiedExtension(t *testing.T) {
+	privKey, peerID := generateTestIdentity(t)
+	legit, err := GeneratePeerIDCert(privKey, "")
+	if err != nil {
+		t.Fatalf("GeneratePeerIDCert failed: %v", err)
+	}
+	parsed, _ := x509.ParseCertificate(legit.Certificate[0])
+
+	// 把合法证书的签名扩展搬到冒充者自己的 TLS 密钥上
+	var ext pkix.Extension
+	for _, e := range parsed.Extensions {
+		if e.Id.Equal(signedKeyExtensionOID) {
+			ext = e
+		}
+	}
+	if ext.Id == nil {
+		t.Fatal("generated cert missing signed key extension")
+	}
+
+	if err := VerifyPeerID([][]byte{forgeCert(t, peerID, ext)}, peerID); err == nil {
+		t.Fatal("copied extension over a different TLS key should fail verification")
+	}
+}
+
+func TestVerifyPeerID_RejectsOtherIdentitySignature(t *testing.T) {
+	_, victim := generateTestIdentity(t)
+	attackerKey, attacker := generateTestIdentity(t)
+
+	// 攻击者用自己的身份签名，但证书名称写受害者的 PeerID
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ext, err := newSignedKeyExtension(attackerKey, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("newSignedKeyExtension failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: victim.String()},
+		DNSNames:        []string{victim.String()},
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{ext},
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err := VerifyPeerID([][]byte{der}, victim); err == nil {
+		t.Fatal("cert signed by another identity should not verify as victim")
+	}
+	if err := VerifyPeerID([][]byte{der}, attacker); err != nil {
+		t.Fatalf("cert should verify as the signing identity: %v", err)
+	}
+}
+
+func TestPeerIDFromCert(t *testing.T) {
+	privKey, peerID := generateTestIdentity(t)
+	cert, err := GeneratePeerIDCert(privKey, "")
+	if err != nil {
+		t.Fatalf("GeneratePeerIDCert failed: %v", err)
+	}
+	parsed, _ := x509.ParseCertificate(cert.Certificate[0])
+
+	got, err := PeerIDFromCert(parsed)
+	if err != nil {
+		t.Fatalf("PeerIDFromCert failed: %v", err)
+	}
+	if got != peerID {
+		t.Fatalf("PeerIDFromCert = %s, want %s", got, peerID)
+	}
+}
+
+func TestLoadOrGenerateCert_RegeneratesLegacyCert(t *testing.T) {
+	privKey, peerID := generateTestIdentity(t)
+	tmpDir := t.TempDir()
+
+	// 旧版本生成的证书: 只有 PeerID 名称，没有签名扩展
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: peerID.String()},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err := saveCertFiles(tmpDir, der, key); err != nil {
+		t.Fatalf("saveCertFiles failed: %v", err)
+	}
+
+	cert, err := LoadOrGenerateCert(tmpDir, privKey)
+	if err != nil {
+		t.Fatalf("LoadOrGenerateCert failed: %v", err)
+	}
+	if err := VerifyPeerID(cert.Certificate, peerID); err != nil {
+		t.Fatalf("legacy cert should be regenerated with signed key extension: %v", err)
+	}
+}
+
+// handshake 使用 cert 作为服务端证书完成一次 TLS 握手，Client 按 expected 验证 PeerID
+func handshake(t *testing.T, cert *tls.Certificate, expected peer.ID) error {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		server := tls.Server(serverConn, CreateServerTLSConfig(cert))
+		server.Handshake()
+		server.Close()
+	}()
+	return tls.Client(clientConn, CreatePeerIDVerifyTLSConfig(expected)).Handshake()
+}
+
+func TestGenerateTransitionalPeerIDCert_VerifiesUnderBothPeerIDs(t *testing.T) {
+	newKey, newID := generateTestIdentity(t)
+	oldKey, oldID := generateTestIdentity(t)
+	_, otherID := generateTestIdentity(t)
+
+	cert, err := GenerateTransitionalPeerIDCert(newKey, []libp2pcrypto.PrivKey{oldKey}, "", SANs{})
+	if err != nil {
+		t.Fatalf("GenerateTransitionalPeerIDCert failed: %v", err)
+	}
+	parsed, _ := x509.ParseCertificate(cert.Certificate[0])
+
+	// 主身份仍是 CommonName 和签名公钥扩展 (旧版本验证方只看这一项)
+	if parsed.Subject.CommonName != newID.String() {
+		t.Errorf("CommonName = %q, want primary %q", parsed.Subject.CommonName, newID)
+	}
+	if got, err := PeerIDFromCert(parsed); err != nil || got != newID {
+		t.Errorf("PeerIDFromCert = %s, %v; want primary %s", got, err, newID)
+	}
+	ids, err := PeerIDsFromCert(parsed)
+	if err != nil || len(ids) != 2 || ids[0] != newID || ids[1] != oldID {
+		t.Errorf("PeerIDsFromCert = %v, %v; want [%s %s]", ids, err, newID, oldID)
+	}
+
+	for _, id := range []peer.ID{newID, oldID} {
+		if err := handshake(t, cert, id); err != nil {
+			t.Errorf("handshake expecting %s failed: %v", id, err)
+		}
+	}
+	if err := handshake(t, cert, otherID); err == nil {
+		t.Error("handshake expecting an unrelated PeerID should fail")
+	}
+}
+
+func TestVerifyPeerID_RejectsCopiedTransitionalExtension(t *testing.T) {
+	victimKey, victim := generateTestIdentity(t)
+	attackerKey, _ := generateTestIdentity(t)
+	newKey, _ := generateTestIdentity(t)
+
+	// 合法节点轮换期间的证书，过渡身份为受害者
+	legit, err := GenerateTransitionalPeerIDCert(newKey, []libp2pcrypto.PrivKey{victimKey}, "", SANs{})
+	if err != nil {
+		t.Fatalf("GenerateTransitionalPeerIDCert failed: %v", err)
+	}
+	parsed, _ := x509.ParseCertificate(legit.Certificate[0])
+	var copied pkix.Extension
+	for _, e := range parsed.Extensions {
+		if e.Id.Equal(transitionalKeysExtensionOID) {
+			copied = e
+		}
+	}
+	if copied.Id == nil {
+		t.Fatal("generated cert missing transitional keys extension")
+	}
+
+	// 攻击者用自己的身份合法签发证书，再附上复制来的过渡身份扩展
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ext, err := newSignedKeyExtension(attackerKey, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("newSignedKeyExtension failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: victim.String()},
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{ext, copied},
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err := VerifyPeerID([][]byte{der}, victim); err == nil {
+		t.Fatal("copied transitional extension over a different TLS key should fail verification")
+	}
+}
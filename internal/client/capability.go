@@ -0,0 +1,224 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// ErrNoCapableExit 没有支持请求端点族的 Exit
+var ErrNoCapableExit = errors.New("没有支持该端点的 Exit")
+
+// ErrNoModelExit 没有通告可服务请求模型的 Exit
+var ErrNoModelExit = errors.New("没有支持该模型的 Exit")
+
+// newExitTargets 由 Relay 返回的 Exit 公钥条目创建请求目标列表 (无法解析的条目会被跳过)
+func newExitTargets(entries []protocol.ExitKeyEntry) []*ExitTarget {
+	exits := make([]*ExitTarget, 0, len(entries))
+	for _, entry := range entries {
+		target, err := NewExitTarget(entry)
+		if err != nil {
+			log.Printf("跳过 Exit %s: %v", entry.PubKeyHash, err)
+			continue
+		}
+		exits = append(exits, target)
+	}
+	return exits
+}
+
+// setExits 记录最近一次发现的 Exit 列表，供按端点能力路由
+func (p *LocalProxy) setExits(entries []protocol.ExitKeyEntry) {
+	exits := newExitTargets(entries)
+
+	p.exitsMu.Lock()
+	p.exits = exits
+	p.exitsMu.Unlock()
+}
+
+// RefreshExits 从已连接的 Relay 重新查询 Exit 列表，更新会话粘性和端点能力路由
+// 静态模式下不经过发现流程，需要通过它获取其他 Exit 的能力
+func (p *LocalProxy) RefreshExits(ctx context.Context) error {
+	exits, current, err := p.client.discoverExits(ctx)
+	if err != nil {
+		return fmt.Errorf("从 Relay 查询 Exit 公钥失败: %w", err)
+	}
+	entries := exitEntriesVia(exits, current)
+	p.setExits(entries)
+	if p.sessions != nil {
+		p.sessions.SetExits(entries)
+	}
+	return nil
+}
+
+// knownExit 按公钥哈希查找最近一次发现的 Exit，不存在时返回 nil
+func (p *LocalProxy) knownExit(pubKeyHash string) *ExitTarget {
+	p.exitsMu.RLock()
+	defer p.exitsMu.RUnlock()
+	for _, exit := range p.exits {
+		if exit.PubKeyHash == pubKeyHash {
+			return exit
+		}
+	}
+	return nil
+}
+
+// capableExit 选择支持指定端点族和模型的 Exit，返回 nil 表示使用当前 Exit
+// 当前 Exit 满足条件、或 Exit 能力未知 (静态配置的 Exit) 时使用当前 Exit
+// 配置 exit_load_threshold 时负载达到阈值的 Exit 只在没有其他候选时使用
+func (p *LocalProxy) capableExit(capability, model string) (*ExitTarget, error) {
+	if capability == "" && model == "" {
+		return nil, nil
+	}
+
+	p.exitsMu.RLock()
+	defer p.exitsMu.RUnlock()
+
+	// 明确通告该能力的 Exit 优先于未通告能力的旧版 Exit，同类中选择通告权重最大的
+	current := p.client.GetExitPubKeyHash()
+	now := time.Now()
+	var advertised, legacy, busy *ExitTarget
+	known, capable, currentBusy := false, false, false
+	for _, exit := range p.exits {
+		if exit.PubKeyHash == current {
+			known = true
+		}
+		if !exit.Supports(capability) {
+			continue
+		}
+		capable = true
+		if !exit.SupportsModel(model) {
+			continue
+		}
+		switch {
+		case exit.Overloaded(p.cfg.ExitLoadThreshold, now):
+			if exit.PubKeyHash == current {
+				currentBusy = true
+			} else {
+				busy = lighter(busy, exit)
+			}
+		case exit.PubKeyHash == current:
+			return nil, nil
+		case capability != "" && len(exit.Capabilities) > 0:
+			advertised = heavier(advertised, exit)
+		default:
+			legacy = heavier(legacy, exit)
+		}
+	}
+	if !known {
+		return nil, nil
+	}
+	if advertised != nil {
+		return advertised, nil
+	}
+	if legacy != nil {
+		return legacy, nil
+	}
+	// 全部候选负载过高时，当前 Exit 优先，其次选择负载最低的
+	if currentBusy {
+		return nil, nil
+	}
+	if busy != nil {
+		return busy, nil
+	}
+	if !capable {
+		return nil, ErrNoCapableExit
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoModelExit, model)
+}
+
+// heavier 返回通告权重更大的 Exit，权重相同时保留先出现的 best
+func heavier(best, exit *ExitTarget) *ExitTarget {
+	if best == nil || exit.Weight > best.Weight {
+		return exit
+	}
+	return best
+}
+
+// lighter 返回通告负载更低的 Exit，负载相同时按权重选择
+func lighter(best, exit *ExitTarget) *ExitTarget {
+	if best == nil || exit.Load < best.Load {
+		return exit
+	}
+	if exit.Load == best.Load {
+		return heavier(best, exit)
+	}
+	return best
+}
+
+// exitsForModel 返回通告了指定模型的 Exit 条目 (未通告模型的 Exit 视为支持)，model 为空时返回全部
+func exitsForModel(entries []protocol.ExitKeyEntry, model string) []protocol.ExitKeyEntry {
+	if model == "" {
+		return entries
+	}
+	var matched []protocol.ExitKeyEntry
+	for _, e := range entries {
+		if protocol.SupportsModel(e.Models, model) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// pickExitEntry 选择初始 Exit: 在线的 Exit 按通告权重加权随机选择，宽限期内重连中的 Exit 作为兜底
+// loadThreshold > 0 时负载达到阈值的在线 Exit 只在全部在线 Exit 都达到阈值时参与选择
+func pickExitEntry(entries []protocol.ExitKeyEntry, loadThreshold int) protocol.ExitKeyEntry {
+	var online, idle []protocol.ExitKeyEntry
+	for _, e := range entries {
+		if e.Reconnecting {
+			continue
+		}
+		online = append(online, e)
+		if loadThreshold <= 0 || e.Load < loadThreshold {
+			idle = append(idle, e)
+		}
+	}
+	if len(online) == 0 {
+		return entries[0]
+	}
+	if len(idle) > 0 {
+		online = idle
+	}
+
+	total := 0
+	for _, e := range online {
+		total += e.SelectionWeight()
+	}
+	r := rand.Intn(total)
+	for _, e := range online {
+		if r -= e.SelectionWeight(); r < 0 {
+			return e
+		}
+	}
+	return online[len(online)-1]
+}
+
+// requestModel 提取请求体顶层的 model 字段，非 JSON 或未指定时返回空字符串
+func requestModel(body []byte) string {
+	var partial struct {
+		Model string `json:"model"`
+	}
+	if json.Unmarshal(body, &partial) != nil {
+		return ""
+	}
+	return partial.Model
+}
+
+// routeExit 选择请求的目标 Exit，返回 nil 表示使用当前 Exit
+// 会话粘性路由优先，只在支持请求端点族和模型的 Exit 中选择
+func (p *LocalProxy) routeExit(r *http.Request, body []byte) (*ExitTarget, error) {
+	capability := protocol.EndpointCapability(r.URL.Path)
+	model := requestModel(body)
+	if p.sessions != nil {
+		if target := p.sessions.PickFor(p.sessions.SessionKey(r, body), capability, model); target != nil {
+			return target, nil
+		}
+	}
+	return p.capableExit(capability, model)
+}
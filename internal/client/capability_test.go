@@ -0,0 +1,308 @@
+package client
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// newCapabilityProxy 创建当前 Exit 为 entries[0] 的代理，并记录全部 Exit
+func newCapabilityProxy(t *testing.T, entries []protocol.ExitKeyEntry) *LocalProxy {
+	t.Helper()
+	keyID, publicKey, err := crypto.DecodeKeyConfig(entries[0].KeyConfig)
+	if err != nil {
+		t.Fatalf("DecodeKeyConfig failed: %v", err)
+	}
+	c, err := NewClient("127.0.0.1:1", keyID, publicKey)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	p := &LocalProxy{cfg: &config.ClientConfig{}, client: c, progress: NewSilentProgress()}
+	p.setExits(entries)
+	return p
+}
+
+func TestRouteExit_EmbeddingsOnlyTargetsCapableExits(t *testing.T) {
+	entries := newTestExitEntries(t, 3)
+	entries[0].Capabilities = []string{protocol.CapabilityChat}
+	entries[1].Capabilities = []string{protocol.CapabilityChat, protocol.CapabilityImages}
+	entries[2].Capabilities = []string{protocol.CapabilityEmbeddings}
+	p := newCapabilityProxy(t, entries)
+
+	req := httptest.NewRequest("POST", "/v1/embeddings", nil)
+	for i := 0; i < 10; i++ {
+		target, err := p.routeExit(req, nil)
+		if err != nil {
+			t.Fatalf("routeExit failed: %v", err)
+		}
+		if target == nil || target.PubKeyHash != entries[2].PubKeyHash {
+			t.Fatalf("embeddings request routed to %v, want embeddings exit %s", target, entries[2].PubKeyHash)
+		}
+	}
+
+	// 当前 Exit 支持的端点不切换
+	target, err := p.routeExit(httptest.NewRequest("POST", "/v1/chat/completions", nil), nil)
+	if err != nil || target != nil {
+		t.Errorf("chat request = (%v, %v), want current exit", target, err)
+	}
+
+	// 不属于任何端点族的请求使用当前 Exit
+	target, err = p.routeExit(httptest.NewRequest("GET", "/v1/models", nil), nil)
+	if err != nil || target != nil {
+		t.Errorf("models request = (%v, %v), want current exit", target, err)
+	}
+
+	target, err = p.routeExit(httptest.NewRequest("POST", "/v1/images/generations", nil), nil)
+	if err != nil || target == nil || target.PubKeyHash != entries[1].PubKeyHash {
+		t.Errorf("images request = (%v, %v), want images exit", target, err)
+	}
+}
+
+func TestRouteExit_NoCapableExit(t *testing.T) {
+	entries := newTestExitEntries(t, 2)
+	entries[0].Capabilities = []string{protocol.CapabilityChat}
+	entries[1].Capabilities = []string{protocol.CapabilityChat}
+	p := newCapabilityProxy(t, entries)
+
+	_, err := p.routeExit(httptest.NewRequest("POST", "/v1/embeddings", nil), nil)
+	if !errors.Is(err, ErrNoCapableExit) {
+		t.Errorf("err = %v, want ErrNoCapableExit", err)
+	}
+}
+
+func TestRouteExit_LegacyExitsSupportEverything(t *testing.T) {
+	p := newCapabilityProxy(t, newTestExitEntries(t, 2))
+
+	target, err := p.routeExit(httptest.NewRequest("POST", "/v1/embeddings", nil), nil)
+	if err != nil || target != nil {
+		t.Errorf("legacy exits = (%v, %v), want current exit", target, err)
+	}
+}
+
+func TestRouteExit_SessionsOnlyPickCapableExits(t *testing.T) {
+	entries := newTestExitEntries(t, 4)
+	entries[0].Capabilities = []string{protocol.CapabilityChat}
+	entries[1].Capabilities = []string{protocol.CapabilityChat}
+	entries[2].Capabilities = []string{protocol.CapabilityEmbeddings}
+	entries[3].Capabilities = []string{protocol.CapabilityChat}
+	p := newCapabilityProxy(t, entries)
+	p.sessions, _ = NewSessionRouter("header:X-Session-ID")
+	p.sessions.SetExits(entries)
+
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest("POST", "/v1/embeddings", nil)
+		req.Header.Set("X-Session-ID", string(rune('a'+i)))
+		target, err := p.routeExit(req, nil)
+		if err != nil {
+			t.Fatalf("routeExit failed: %v", err)
+		}
+		if target == nil || target.PubKeyHash != entries[2].PubKeyHash {
+			t.Fatalf("session %d routed to %v, want embeddings exit", i, target)
+		}
+	}
+}
+
+func TestRouteExit_FiltersByModel(t *testing.T) {
+	entries := newTestExitEntries(t, 3)
+	entries[0].Models = []string{"llama3:8b"}
+	entries[1].Models = []string{"qwen2*"}
+	entries[2].Models = []string{"qwen2:72b", "llama3:70b"}
+	p := newCapabilityProxy(t, entries)
+
+	route := func(model string) (*ExitTarget, error) {
+		body := []byte(`{"model":"` + model + `"}`)
+		return p.routeExit(httptest.NewRequest("POST", "/v1/chat/completions", nil), body)
+	}
+
+	// 当前 Exit 可服务的模型不切换
+	if target, err := route("llama3:8b"); err != nil || target != nil {
+		t.Errorf("llama3:8b = (%v, %v), want current exit", target, err)
+	}
+	if target, err := route("llama3:70b"); err != nil || target == nil || target.PubKeyHash != entries[2].PubKeyHash {
+		t.Errorf("llama3:70b = (%v, %v), want exit 2", target, err)
+	}
+	if target, err := route("qwen2:7b"); err != nil || target == nil || target.PubKeyHash != entries[1].PubKeyHash {
+		t.Errorf("qwen2:7b = (%v, %v), want prefix-matching exit 1", target, err)
+	}
+	if _, err := route("mistral"); !errors.Is(err, ErrNoModelExit) {
+		t.Errorf("mistral err = %v, want ErrNoModelExit", err)
+	}
+}
+
+func TestRouteExit_PrefersHigherWeight(t *testing.T) {
+	entries := newTestExitEntries(t, 4)
+	entries[0].Models = []string{"llama3:8b"}
+	entries[1].Weight = 2
+	entries[2].Weight = 10
+	entries[3].Weight = 10
+	p := newCapabilityProxy(t, entries)
+
+	body := []byte(`{"model":"qwen2:72b"}`)
+	target, err := p.routeExit(httptest.NewRequest("POST", "/v1/chat/completions", nil), body)
+	if err != nil || target == nil || target.PubKeyHash != entries[2].PubKeyHash {
+		t.Errorf("routeExit = (%v, %v), want first highest-weight exit", target, err)
+	}
+}
+
+func TestPickExitEntry_WeightedByCapacity(t *testing.T) {
+	entries := newTestExitEntries(t, 3)
+	entries[0].Reconnecting = true
+	entries[0].Weight = 100
+	entries[1].Weight = 9
+	// entries[2] 未通告权重，按 1 处理
+
+	counts := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		counts[pickExitEntry(entries, 0).PubKeyHash]++
+	}
+	if counts[entries[0].PubKeyHash] != 0 {
+		t.Error("reconnecting exit picked while online exits exist")
+	}
+	if heavy, light := counts[entries[1].PubKeyHash], counts[entries[2].PubKeyHash]; light == 0 || heavy < 5*light {
+		t.Errorf("picks = %d (weight 9) vs %d (weight 1), want roughly 9:1", heavy, light)
+	}
+
+	// 全部重连中时使用第一个
+	entries[1].Reconnecting, entries[2].Reconnecting = true, true
+	if got := pickExitEntry(entries, 0); got.PubKeyHash != entries[0].PubKeyHash {
+		t.Errorf("all reconnecting picked %s, want first entry", got.PubKeyHash)
+	}
+}
+
+func TestPickExitEntry_DeprioritizesLoadedExit(t *testing.T) {
+	entries := newTestExitEntries(t, 2)
+	entries[0].Weight = 10
+	entries[0].Load = 95
+	entries[1].Load = 10
+
+	for i := 0; i < 200; i++ {
+		if got := pickExitEntry(entries, 80); got.PubKeyHash != entries[1].PubKeyHash {
+			t.Fatalf("picked loaded exit %s, want lightly-loaded exit", got.PubKeyHash)
+		}
+	}
+
+	// 全部在线 Exit 负载过高时仍按权重选择
+	entries[1].Load = 90
+	counts := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		counts[pickExitEntry(entries, 80).PubKeyHash]++
+	}
+	if counts[entries[0].PubKeyHash] == 0 {
+		t.Error("all exits loaded: heavier exit never picked")
+	}
+}
+
+func TestRouteExit_DeprioritizesLoadedExit(t *testing.T) {
+	entries := newTestExitEntries(t, 3)
+	entries[0].Load = 95
+	entries[1].Weight = 10
+	entries[1].Load = 90
+	entries[2].Load = 20
+	p := newCapabilityProxy(t, entries)
+	p.cfg.ExitLoadThreshold = 80
+
+	route := func() *ExitTarget {
+		target, err := p.routeExit(httptest.NewRequest("POST", "/v1/chat/completions", nil), []byte(`{"model":"m"}`))
+		if err != nil {
+			t.Fatalf("routeExit failed: %v", err)
+		}
+		return target
+	}
+
+	// 当前 Exit 负载过高时切换到负载低的 Exit，即使其权重更小
+	if target := route(); target == nil || target.PubKeyHash != entries[2].PubKeyHash {
+		t.Errorf("routeExit = %v, want lightly-loaded exit", target)
+	}
+
+	// 负载数据过期后不再影响选择
+	p.exitsMu.Lock()
+	for _, exit := range p.exits {
+		exit.loadAt = time.Now().Add(-2 * exitLoadMaxAge)
+	}
+	p.exitsMu.Unlock()
+	if target := route(); target != nil {
+		t.Errorf("stale load: routeExit = %v, want current exit", target)
+	}
+}
+
+func TestRouteExit_SessionsAvoidLoadedExit(t *testing.T) {
+	entries := newTestExitEntries(t, 3)
+	p := newCapabilityProxy(t, entries)
+	p.sessions, _ = NewSessionRouter("header:X-Session-ID")
+	p.sessions.SetLoadThreshold(80)
+	p.sessions.SetExits(entries)
+
+	// 找到一个落在 entries[1] 的会话，再让 entries[1] 负载过高
+	var session string
+	for i := 0; session == "" && i < 100; i++ {
+		key := string(rune('a' + i))
+		if target := p.sessions.Pick(key); target != nil && target.PubKeyHash == entries[1].PubKeyHash {
+			session = key
+		}
+	}
+	if session == "" {
+		t.Fatal("no session mapped to exit 1")
+	}
+
+	entries[1].Load = 100
+	p.sessions.SetExits(entries)
+	if target := p.sessions.Pick(session); target == nil || target.PubKeyHash == entries[1].PubKeyHash {
+		t.Errorf("session stayed on loaded exit: %v", target)
+	}
+
+	// 没有其他候选时仍使用负载过高的 Exit
+	p.sessions.SetExits(entries[1:2])
+	if target := p.sessions.Pick(session); target == nil || target.PubKeyHash != entries[1].PubKeyHash {
+		t.Errorf("only loaded exit available: %v", target)
+	}
+}
+
+func TestRequestTimeout_AdoptsExitRecommendation(t *testing.T) {
+	entries := newTestExitEntries(t, 5)
+	entries[0].RequestTimeoutMs = (2 * time.Minute).Milliseconds()
+	entries[1].RequestTimeoutMs = 0                                 // 未通告
+	entries[2].RequestTimeoutMs = (time.Second).Milliseconds()      // 低于下限
+	entries[3].RequestTimeoutMs = (24 * time.Hour).Milliseconds()   // 高于上限
+	entries[4].RequestTimeoutMs = (45 * time.Second).Milliseconds() // 范围内
+	p := newCapabilityProxy(t, entries)
+	p.cfg.Timeout = 20 * time.Second
+
+	exits := newExitTargets(entries)
+	tests := []struct {
+		name   string
+		target *ExitTarget
+		want   time.Duration
+	}{
+		{"current exit", nil, 2 * time.Minute},
+		{"not advertised", exits[1], 20 * time.Second},
+		{"clamped to min", exits[2], minExitRequestTimeout},
+		{"clamped to max", exits[3], maxExitRequestTimeout},
+		{"within bounds", exits[4], 45 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.requestTimeout(tt.target); got != tt.want {
+				t.Errorf("requestTimeout = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestTimeout_UnknownCurrentExitUsesGlobal(t *testing.T) {
+	entries := newTestExitEntries(t, 1)
+	p := newCapabilityProxy(t, entries)
+	p.cfg.Timeout = 15 * time.Second
+
+	// 静态模式尚未获取 Exit 列表时使用全局超时
+	p.setExits(nil)
+	if got := p.requestTimeout(nil); got != 15*time.Second {
+		t.Errorf("requestTimeout = %v, want global timeout", got)
+	}
+}
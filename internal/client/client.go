@@ -1,18 +1,23 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/textproto"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/binn/tokengo/internal/cert"
+	"github.com/binn/tokengo/internal/config"
 	"github.com/binn/tokengo/internal/crypto"
 	"github.com/binn/tokengo/internal/dht"
 	"github.com/binn/tokengo/internal/loadbalancer"
@@ -20,6 +25,7 @@ import (
 	"github.com/binn/tokengo/internal/protocol"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/quic-go/quic-go"
+	"golang.org/x/sync/singleflight"
 )
 
 // Client 客户端核心逻辑
@@ -27,49 +33,94 @@ type Client struct {
 	relayAddr      string
 	exitPubKeyHash string // Exit 公钥哈希 (由 Client 指定，Relay 盲转发)
 	ohttpClient    *crypto.OHTTPClient
-	conn           quic.Connection
-	connMu         sync.Mutex // 保护 conn 字段读写（快速操作）
-	reconnectMu    sync.Mutex // 序列化重连操作（慢操作）
+	conn           *relayConn         // 当前 Relay 连接，请求使用期间持有引用
+	connMu         sync.Mutex         // 保护 conn 字段读写（快速操作）
+	reconnectMu    sync.Mutex         // 序列化重连操作（慢操作）
+	connectFlight  singleflight.Group // 合并并发的重连触发，共享同一次发现/连接结果
 	dhtNode        *dht.Node
 	discovery      *dht.Discovery
+	discoverFn     func(ctx context.Context) ([]peer.AddrInfo, error) // Relay 发现实现，nil 时使用 discovery
 	selector       loadbalancer.Selector
 	currentRelayID peer.ID
+	lastActive     atomic.Int64  // 最近一次使用连接的时间 (UnixNano)
+	stopPing       chan struct{} // 关闭以停止空闲探活
+	stopPingOnce   sync.Once
+	pingTimeout    time.Duration
+	maxRetries     int                    // Relay 失败时换 Relay 重试的次数
+	failedRelay    peer.ID                // 最近失败的 Relay，重连时优先排除
+	addrFamily     netutil.AddrFamily     // Relay 同时通告 IPv4/IPv6 时的拨号偏好
+	quicParams     config.QUICParams      // 到 Relay 的 QUIC 连接保活参数
+	sessionCache   tls.ClientSessionCache // TLS 会话票据，重连同一 Relay 时恢复会话
+
+	hedgeAfter   time.Duration // 非流式幂等请求超过该时间未响应时经另一个 Relay 对冲，0 表示禁用
+	hedgeConn    *relayConn    // 对冲请求使用的另一个 Relay 的连接 (受 connMu 保护)
+	hedgeRelayID peer.ID       // hedgeConn 所属的 Relay
+
+	compression     byte // 内层请求体压缩算法 (protocol.Compression*)，CompressionNone 表示不压缩
+	compressMinSize int  // 请求体达到该字节数才压缩
+
+	exitKeyTTL         time.Duration  // 缓存的 Exit 公钥有效期，0 表示不过期
+	exitKeyMaxFailures int            // 同一 Exit 连续解密失败多少次后淘汰公钥，0 表示不按失败淘汰
+	exitKeySetAt       time.Time      // 当前 Exit 公钥的设置时间
+	exitKeyStale       bool           // 当前 Exit 公钥已淘汰，等待重新获取
+	exitKeyFailures    map[string]int // 各 Exit 连续解密失败的次数
+	exitFeatures       []string       // 当前 Exit 通告的协议特性 (静态配置的 Exit 未通告)
+
+	statsMu     sync.Mutex               // 保护拓扑统计
+	relayRTT    map[string]time.Duration // Relay 握手耗时 (PeerID 或静态地址)
+	exitLatency map[string]time.Duration // Exit 请求往返耗时
 }
 
+// defaultPingTimeout 空闲探活等待心跳确认的默认超时
+const defaultPingTimeout = 5 * time.Second
+
 // NewClient 创建客户端 (静态模式，跳过 PeerID 验证)
 func NewClient(relayAddr string, keyID uint8, exitPublicKey []byte) (*Client, error) {
 	ohttpClient, err := crypto.NewOHTTPClient(keyID, exitPublicKey)
 	if err != nil {
 		return nil, fmt.Errorf("创建 OHTTP 客户端失败: %w", err)
 	}
+	// 静态配置的 Exit 未通告是否支持 Binary HTTP，按旧版格式编码
+	ohttpClient.SetLegacyEncoding(true)
 
 	return &Client{
 		relayAddr:      relayAddr,
 		exitPubKeyHash: crypto.PubKeyHash(exitPublicKey),
 		ohttpClient:    ohttpClient,
 		selector:       loadbalancer.NewWeightedSelector(),
+		stopPing:       make(chan struct{}),
+		pingTimeout:    defaultPingTimeout,
+		maxRetries:     DefaultMaxRetries,
+		quicParams:     config.DefaultQUICParams(),
+		sessionCache:   cert.NewSessionCache(),
 	}, nil
 }
 
 // NewClientDynamic 创建动态发现模式的客户端（不预设 Relay/Exit）
 func NewClientDynamic() (*Client, error) {
 	return &Client{
-		selector: loadbalancer.NewWeightedSelector(),
+		selector:     loadbalancer.NewWeightedSelector(),
+		stopPing:     make(chan struct{}),
+		pingTimeout:  defaultPingTimeout,
+		maxRetries:   DefaultMaxRetries,
+		quicParams:   config.DefaultQUICParams(),
+		sessionCache: cert.NewSessionCache(),
 	}, nil
 }
 
 // connect 连接到 Relay 节点（调用者需持有 reconnectMu）
 func (c *Client) connect(ctx context.Context) error {
-	// 关闭旧连接
+	// 退役旧连接: 其上进行中的请求完成后才关闭
 	c.connMu.Lock()
-	if c.conn != nil {
-		c.conn.CloseWithError(0, "reconnecting")
-		c.conn = nil
-	}
+	old := c.conn
+	c.conn = nil
 	c.connMu.Unlock()
+	if old != nil {
+		old.retire("reconnecting")
+	}
 
 	// DHT 发现和 QUIC 连接（不持锁）
-	if c.discovery != nil {
+	if c.discovery != nil || c.discoverFn != nil {
 		return c.connectWithDiscovery(ctx)
 	}
 
@@ -80,7 +131,11 @@ func (c *Client) connect(ctx context.Context) error {
 // connectWithDiscovery 使用 DHT 发现连接
 func (c *Client) connectWithDiscovery(ctx context.Context) error {
 	// 从 DHT 发现 Relay 节点
-	relays, err := c.discovery.DiscoverRelays(ctx)
+	discover := c.discoverFn
+	if discover == nil {
+		discover = c.discovery.DiscoverRelays
+	}
+	relays, err := discover(ctx)
 	if err != nil {
 		return fmt.Errorf("DHT 发现 Relay 失败: %w", err)
 	}
@@ -90,21 +145,21 @@ func (c *Client) connectWithDiscovery(ctx context.Context) error {
 
 	log.Printf("从 DHT 发现 %d 个 Relay 节点", len(relays))
 
-	// 选择一个 Relay 节点
-	selected, err := c.selector.Select(ctx, relays)
+	// 选择一个 Relay 节点 (跳过刚失败的 Relay)
+	selected, err := c.selector.Select(ctx, c.excludeFailedRelay(relays))
 	if err != nil {
 		return fmt.Errorf("选择 Relay 失败: %w", err)
 	}
 
-	// 提取地址
-	relayAddr := netutil.ExtractQUICAddress(selected.Addrs)
-	if relayAddr == "" {
+	// 按地址族偏好提取地址
+	relayAddrs := netutil.ResolveQUICAddresses(ctx, selected.Addrs, c.addrFamily)
+	if len(relayAddrs) == 0 {
 		c.selector.ReportFailure(selected.ID)
 		return fmt.Errorf("无法提取 Relay 地址")
 	}
 
 	// 尝试连接
-	if err := c.connectToAddr(ctx, relayAddr, selected.ID); err != nil {
+	if err := c.connectToRelay(ctx, relayAddrs, selected.ID); err != nil {
 		c.selector.ReportFailure(selected.ID)
 		return fmt.Errorf("连接 Relay 失败: %w", err)
 	}
@@ -123,13 +178,80 @@ func (c *Client) SetDiscovery(d *dht.Discovery) {
 // connectToAddr 连接到指定地址
 // 如果peerID 不为空，则验证证书中的 PeerID
 func (c *Client) connectToAddr(ctx context.Context, addr string, peerID peer.ID) error {
-	if addr == "" {
-		return fmt.Errorf("Relay 地址为空")
+	return c.connectToRelay(ctx, []string{addr}, peerID)
+}
+
+// connectToRelay 连接到 Relay 的候选地址之一 (多个地址时竞速)
+func (c *Client) connectToRelay(ctx context.Context, addrs []string, peerID peer.ID) error {
+	conn, addr, rtt, err := c.dialRelay(ctx, addrs, peerID)
+	if err != nil {
+		return err
+	}
+
+	c.connMu.Lock()
+	c.conn = newRelayConn(conn)
+	c.relayAddr = addr
+	c.currentRelayID = peerID
+	if peerID != c.failedRelay {
+		c.failedRelay = ""
+	}
+	c.connMu.Unlock()
+
+	c.reportRelayLatency(rtt)
+	return nil
+}
+
+// dialRelay 建立到 Relay 的 QUIC 连接并记录握手耗时，返回连通的地址
+// 有多个候选地址 (happy-eyeballs) 时竞速拨号，使用先完成握手的一个
+func (c *Client) dialRelay(ctx context.Context, addrs []string, peerID peer.ID) (quic.Connection, string, time.Duration, error) {
+	if len(addrs) == 0 || addrs[0] == "" {
+		return nil, "", 0, fmt.Errorf("Relay 地址为空")
+	}
+
+	type dialed struct {
+		conn quic.Connection
+		rtt  time.Duration
+	}
+	d, addr, err := netutil.RaceDial(ctx, addrs, netutil.HappyEyeballsDelay,
+		func(ctx context.Context, addr string) (dialed, error) {
+			conn, rtt, err := dialQUIC(ctx, addr, peerID, c.quicParams, c.sessionCache)
+			return dialed{conn: conn, rtt: rtt}, err
+		},
+		func(d dialed) { d.conn.CloseWithError(0, "another address connected first") })
+	if err != nil {
+		return nil, "", 0, err
+	}
+	c.recordRelayRTT(relayKey(addr, peerID), d.rtt)
+	return d.conn, addr, d.rtt, nil
+}
+
+// probeRelay 探测 Relay 是否可达 (完成 QUIC 握手后立即关闭)，用于验证磁盘缓存的 Relay
+func (c *Client) probeRelay(ctx context.Context, info peer.AddrInfo) error {
+	addrs := netutil.ResolveQUICAddresses(ctx, info.Addrs, c.addrFamily)
+	if len(addrs) == 0 {
+		return fmt.Errorf("无法提取 Relay 地址")
 	}
+	conn, _, err := netutil.RaceDial(ctx, addrs, netutil.HappyEyeballsDelay,
+		func(ctx context.Context, addr string) (quic.Connection, error) {
+			conn, _, err := dialQUIC(ctx, addr, info.ID, c.quicParams, c.sessionCache)
+			return conn, err
+		},
+		func(conn quic.Connection) { conn.CloseWithError(0, "probe") })
+	if err != nil {
+		return err
+	}
+	conn.CloseWithError(0, "probe")
+	return nil
+}
+
+// dialQUIC 建立到单个地址的 QUIC 连接，返回握手耗时
+// 如果peerID 不为空，则验证证书中的 PeerID；cache 不为空时恢复此前与该 Relay 的 TLS 会话
+// 启用 0-RTT 时握手完成前即返回连接，首个请求随握手一起发送
+func dialQUIC(ctx context.Context, addr string, peerID peer.ID, params config.QUICParams, cache tls.ClientSessionCache) (quic.Connection, time.Duration, error) {
 
 	quicConfig := &quic.Config{
-		MaxIdleTimeout:  120_000_000_000, // 120 秒
-		KeepAlivePeriod: 30_000_000_000,  // 30 秒
+		MaxIdleTimeout:  params.MaxIdleTimeout,
+		KeepAlivePeriod: params.KeepAlivePeriod,
 	}
 
 	// 根据是否有 PeerID 选择 TLS 配置
@@ -146,17 +268,56 @@ func (c *Client) connectToAddr(ctx context.Context, addr string, peerID peer.ID)
 		}
 	}
 
-	conn, err := quic.DialAddr(ctx, addr, tlsConfig, quicConfig)
+	cert.UseSessionCache(tlsConfig, cache, peerID)
+
+	start := time.Now()
+	var conn quic.Connection
+	var err error
+	if params.Enable0RTT {
+		conn, err = quic.DialAddrEarly(ctx, addr, tlsConfig, quicConfig)
+	} else {
+		conn, err = quic.DialAddr(ctx, addr, tlsConfig, quicConfig)
+	}
 	if err != nil {
-		return fmt.Errorf("连接 Relay 失败: %w", err)
+		return nil, 0, fmt.Errorf("连接 Relay 失败: %w", err)
 	}
+	return conn, time.Since(start), nil
+}
+
+// relayKey Relay 的标识: PeerID，静态模式为地址
+func relayKey(addr string, peerID peer.ID) string {
+	if peerID != "" {
+		return peerID.String()
+	}
+	return addr
+}
 
+// reportRelayLatency 将当前 Relay 的延迟观测反馈给支持延迟感知的选择器
+func (c *Client) reportRelayLatency(d time.Duration) {
 	c.connMu.Lock()
-	c.conn = conn
-	c.relayAddr = addr
-	c.currentRelayID = peerID
+	relayID := c.currentRelayID
 	c.connMu.Unlock()
-	return nil
+	if relayID == "" {
+		return
+	}
+	if lr, ok := c.selector.(loadbalancer.LatencyReporter); ok {
+		lr.ReportLatency(relayID, d)
+	}
+}
+
+// SetSelector 设置 Relay 选择器 (需在连接前调用)
+func (c *Client) SetSelector(s loadbalancer.Selector) {
+	c.selector = s
+}
+
+// SetAddressFamily 设置 Relay 同时通告 IPv4/IPv6 时的拨号偏好 (需在连接前调用)
+func (c *Client) SetAddressFamily(f netutil.AddrFamily) {
+	c.addrFamily = f
+}
+
+// SetQUICParams 设置到 Relay 的 QUIC 连接保活参数 (需在连接前调用)，未设置的字段使用默认值
+func (c *Client) SetQUICParams(p config.QUICParams) {
+	c.quicParams = p.WithDefaults(config.DefaultQUICParams())
 }
 
 // Connect 公开的连接方法
@@ -166,8 +327,13 @@ func (c *Client) Connect(ctx context.Context) error {
 	return c.connect(ctx)
 }
 
-// getConnection 获取或建立连接
-func (c *Client) getConnection(ctx context.Context) (quic.Connection, error) {
+// connectTimeout 由 singleflight 共享的发现和建连的超时上限 (不随发起者的请求取消而中断)
+const connectTimeout = 30 * time.Second
+
+// getConnection 获取或建立连接，返回的连接已持有引用，调用者使用结束后需 release
+func (c *Client) getConnection(ctx context.Context) (*relayConn, error) {
+	c.lastActive.Store(time.Now().UnixNano())
+
 	// 快速路径：检查现有连接（短暂持锁）
 	c.connMu.Lock()
 	if c.conn != nil {
@@ -176,73 +342,208 @@ func (c *Client) getConnection(ctx context.Context) (quic.Connection, error) {
 			// 连接已断开，需要重连
 		default:
 			conn := c.conn
+			conn.acquire()
 			c.connMu.Unlock()
 			return conn, nil
 		}
 	}
 	c.connMu.Unlock()
 
-	// 慢路径：重连（用 reconnectMu 防止多 goroutine 同时重连）
-	c.reconnectMu.Lock()
-	defer c.reconnectMu.Unlock()
-
-	// Double-check: 等待 reconnectMu 期间可能已有其他 goroutine 完成重连
-	c.connMu.Lock()
-	if c.conn != nil {
-		select {
-		case <-c.conn.Context().Done():
-		default:
-			conn := c.conn
-			c.connMu.Unlock()
-			return conn, nil
+	// 慢路径：重连（singleflight 合并并发触发，失败结果也由等待者共享，避免逐个重试 DHT 发现）
+	_, err, _ := c.connectFlight.Do("connect", func() (any, error) {
+		c.reconnectMu.Lock()
+		defer c.reconnectMu.Unlock()
+
+		// Double-check: 等待 reconnectMu 期间可能已有 Connect 完成重连
+		c.connMu.Lock()
+		if c.conn != nil {
+			select {
+			case <-c.conn.Context().Done():
+			default:
+				c.connMu.Unlock()
+				return nil, nil
+			}
 		}
-	}
-	c.connMu.Unlock()
+		c.connMu.Unlock()
 
-	// 执行重连（不持有 connMu）
-	if err := c.connect(ctx); err != nil {
+		// 执行重连（不持有 connMu）；结果由所有等待者共享，不随首个请求取消而中断
+		cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), connectTimeout)
+		defer cancel()
+		return nil, c.connect(cctx)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	c.connMu.Lock()
+	defer c.connMu.Unlock()
 	conn := c.conn
-	c.connMu.Unlock()
+	if conn == nil {
+		// 重连后连接随即被并发的失败处理丢弃
+		return nil, fmt.Errorf("连接不可用")
+	}
+	conn.acquire()
 	return conn, nil
 }
 
-// SendRequest 发送 HTTP 请求
+// ExitTarget 请求目标 Exit (公钥哈希 + 对应的 OHTTP 客户端)
+type ExitTarget struct {
+	PubKeyHash     string
+	Capabilities   []string      // Exit 通告的端点族，为空表示全部支持
+	RequestTimeout time.Duration // Exit 通告的推荐请求超时，0 表示未通告
+	Weight         int           // Exit 通告的选择权重，未通告时为 1
+	Models         []string      // Exit 通告的可服务模型，为空表示不限制
+	Load           int           // Exit 通告的负载百分比，0 表示空闲或未通告
+	Features       []string      // Exit 通告的协议特性，为空表示未通告 (按旧版 Exit 处理)
+	loadAt         time.Time     // 获取负载的时间
+	ohttpClient    *crypto.OHTTPClient
+}
+
+// exitLoadMaxAge Exit 列表中的负载超过该时间未刷新时视为未知，不再影响选择
+const exitLoadMaxAge = 2 * time.Minute
+
+// Overloaded 检查 Exit 通告的负载是否达到阈值 (threshold <= 0 或负载已过期时返回 false)
+func (t *ExitTarget) Overloaded(threshold int, now time.Time) bool {
+	return threshold > 0 && t.Load >= threshold && now.Sub(t.loadAt) <= exitLoadMaxAge
+}
+
+// Supports 检查 Exit 是否支持指定端点族
+func (t *ExitTarget) Supports(capability string) bool {
+	return protocol.SupportsCapability(t.Capabilities, capability)
+}
+
+// SupportsFeature 检查 Exit 是否通告了指定协议特性
+func (t *ExitTarget) SupportsFeature(feature string) bool {
+	return protocol.SupportsFeature(t.Features, feature)
+}
+
+// SupportsModel 检查 Exit 是否可服务指定模型
+func (t *ExitTarget) SupportsModel(model string) bool {
+	return protocol.SupportsModel(t.Models, model)
+}
+
+// NewExitTarget 从 Relay 返回的 Exit 公钥条目创建请求目标
+func NewExitTarget(entry protocol.ExitKeyEntry) (*ExitTarget, error) {
+	keyConfigs, err := crypto.DecodeKeyConfigs(entry.KeyConfig)
+	if err != nil {
+		return nil, fmt.Errorf("解析 Exit KeyConfig 失败: %w", err)
+	}
+	// 使用主密钥，AEAD 取 Exit 通告的首个双方都支持的算法
+	publicKey := keyConfigs[0].PublicKey
+	ohttpClient, err := crypto.NewOHTTPClient(keyConfigs[0].KeyID, publicKey, keyConfigs[0].AEAD())
+	if err != nil {
+		return nil, fmt.Errorf("创建 OHTTP 客户端失败: %w", err)
+	}
+	ohttpClient.SetLegacyEncoding(!protocol.SupportsFeature(entry.Features, protocol.FeatureBinaryHTTP))
+	return &ExitTarget{
+		PubKeyHash:     crypto.PubKeyHash(publicKey),
+		Capabilities:   entry.Capabilities,
+		RequestTimeout: entry.RequestTimeout(),
+		Weight:         entry.SelectionWeight(),
+		Models:         entry.Models,
+		Load:           entry.Load,
+		Features:       entry.Features,
+		loadAt:         time.Now(),
+		ohttpClient:    ohttpClient,
+	}, nil
+}
+
+// resolveExit 返回请求目标，target 为 nil 时使用当前 Exit
+func (c *Client) resolveExit(target *ExitTarget) *ExitTarget {
+	if target != nil {
+		return target
+	}
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return &ExitTarget{PubKeyHash: c.exitPubKeyHash, Features: c.exitFeatures, ohttpClient: c.ohttpClient}
+}
+
+// SendRequest 发送 HTTP 请求到当前 Exit
 func (c *Client) SendRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return c.SendRequestTo(ctx, nil, req)
+}
+
+// SendRequestTo 发送 HTTP 请求到指定 Exit (target 为 nil 时使用当前 Exit)
+// Relay 失败时换 Relay 重试: 请求尚未送达，或方法幂等
+// 请求体超过 ChunkedUploadThreshold 且 Exit 支持分块上传时，改经流式请求上传请求体
+func (c *Client) SendRequestTo(ctx context.Context, target *ExitTarget, req *http.Request) (*http.Response, error) {
+	if needsChunkedUpload(req) && c.resolveExit(target).SupportsFeature(protocol.FeatureChunkedUpload) {
+		return c.sendUploadRequest(ctx, target, req)
+	}
+	if c.hedgeAfter > 0 && hedgeable(req) {
+		resp, err := c.sendHedged(ctx, target, req)
+		c.observeExitKey(target, err)
+		return resp, err
+	}
+	resp, err := c.sendWithRelayRetry(ctx, target, req)
+	c.observeExitKey(target, err)
+	return resp, err
+}
+
+// sendWithRelayRetry 在当前 Relay 连接上发送请求，Relay 失败时换 Relay 重试
+func (c *Client) sendWithRelayRetry(ctx context.Context, target *ExitTarget, req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	retryable := func(rf *relayFailure) bool { return !rf.sent || isIdempotent(req.Method) }
+	err := c.withRelayRetry(ctx, req, retryable, func() error {
+		var err error
+		resp, err = c.sendRequest(ctx, target, req)
+		return err
+	})
+	return resp, err
+}
+
+// sendRequest 在当前 Relay 连接上发送一次请求
+func (c *Client) sendRequest(ctx context.Context, target *ExitTarget, req *http.Request) (*http.Response, error) {
 	// 获取连接
 	conn, err := c.getConnection(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("获取连接失败: %w", err)
+		return nil, &relayFailure{err: fmt.Errorf("获取连接失败: %w", err)}
 	}
+	defer conn.release()
+	return c.sendRequestOn(ctx, conn, target, req)
+}
+
+// sendRequestOn 在指定 Relay 连接上发送一次请求，ctx 取消时中断等待响应
+func (c *Client) sendRequestOn(ctx context.Context, conn quic.Connection, target *ExitTarget, req *http.Request) (*http.Response, error) {
+	exit := c.resolveExit(target)
 
 	// 创建新流
 	stream, err := conn.OpenStreamSync(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("创建流失败: %w", err)
+		return nil, &relayFailure{conn: conn, err: fmt.Errorf("创建流失败: %w", err)}
 	}
+	stop := context.AfterFunc(ctx, func() { stream.CancelRead(0) })
+	defer stop()
 
-	// OHTTP 加密请求
-	ohttpReq, clientCtx, err := c.ohttpClient.EncapsulateRequest(req)
+	// OHTTP 加密请求 (启用压缩时先压缩请求体)
+	inner, err := c.compressRequest(req)
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+	ohttpReq, clientCtx, err := exit.ohttpClient.EncapsulateRequest(inner)
 	if err != nil {
 		stream.Close()
 		return nil, fmt.Errorf("加密请求失败: %w", err)
 	}
 
 	// 构建协议消息 (包含 Exit 公钥哈希)
-	msg := protocol.NewRequestMessage(c.exitPubKeyHash, ohttpReq)
+	msg := protocol.NewRequestMessage(exit.PubKeyHash, ohttpReq)
+	msg.Tenant = tenantFromContext(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.Deadline = deadline // Relay 据此在超时后中断 Exit 流
+	}
 
 	// 发送请求
-	if _, err := stream.Write(msg.Encode()); err != nil {
+	sentAt := time.Now()
+	if err := protocol.WriteMessage(stream, msg); err != nil {
 		stream.Close()
-		return nil, fmt.Errorf("发送请求失败: %w", err)
+		return nil, &relayFailure{conn: conn, err: fmt.Errorf("发送请求失败: %w", err)}
 	}
 
 	// 关闭写入端，表示请求发送完成（但保持读取端开放）
 	if err := stream.Close(); err != nil {
-		return nil, fmt.Errorf("关闭写入端失败: %w", err)
+		return nil, &relayFailure{conn: conn, err: fmt.Errorf("关闭写入端失败: %w", err)}
 	}
 
 	// 设置读取超时，避免 Decode 无限阻塞
@@ -255,12 +556,15 @@ func (c *Client) SendRequest(ctx context.Context, req *http.Request) (*http.Resp
 	// 读取响应
 	respMsg, err := protocol.Decode(stream)
 	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %w", err)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("读取响应失败: %w", ctxErr)
+		}
+		return nil, &relayFailure{conn: conn, sent: true, err: fmt.Errorf("读取响应失败: %w", err)}
 	}
 
 	// 检查响应类型
 	if respMsg.Type == protocol.MessageTypeError {
-		return nil, fmt.Errorf("服务端错误: %s", string(respMsg.Payload))
+		return nil, serverError(conn, respMsg.Payload)
 	}
 
 	if respMsg.Type != protocol.MessageTypeResponse {
@@ -270,72 +574,255 @@ func (c *Client) SendRequest(ctx context.Context, req *http.Request) (*http.Resp
 	// OHTTP 解密响应
 	resp, err := clientCtx.DecapsulateResponse(respMsg.Payload)
 	if err != nil {
-		return nil, fmt.Errorf("解密响应失败: %w", err)
+		return nil, fmt.Errorf("%w: %w", errDecryptResponse, err)
+	}
+	if err := decompressResponse(resp); err != nil {
+		return nil, err
 	}
+	roundTrip := time.Since(sentAt)
+	c.recordExitLatency(exit.PubKeyHash, roundTrip)
+	c.reportRelayLatency(roundTrip)
 
 	return resp, nil
 }
 
 // StreamResponse 封装流式响应读取
 type StreamResponse struct {
-	stream    quic.Stream
-	decryptor *crypto.StreamDecryptor
+	// Header 后端响应头 (Exit 在首个块之前通过 StreamHead 发送)，旧版 Exit 不发送时为空
+	Header http.Header
+	// StatusCode 后端响应状态码: Exit 在 StreamHead 中通告非 200 状态码时为该值 (数据块为后端的原始响应体)，否则为 200
+	StatusCode int
+
+	stream     quic.Stream
+	conn       quic.Connection // 流所属的 Relay 连接
+	release    func()          // 释放连接引用，Close 时调用一次
+	decryptor  *crypto.StreamDecryptor
+	uploadDone chan struct{} // 分块上传请求体时，上传结束后关闭
+
+	delivered   bool            // 已有数据块交给调用方 (之后的 Relay 失败不可重试)
+	reorder     *chunkReorderer // Exit 在 StreamHead 中确认序号协商后创建，nil 表示按到达顺序处理
+	ready       [][]byte        // 已按序重排、尚未交给调用方的块
+	ended       chan struct{}   // 收到 StreamEnd 后创建，结束后多余数据检测完成时关闭
+	trailingErr error           // StreamEnd 之后收到数据时为 ErrDataAfterStreamEnd (ended 关闭后可读)
 }
 
+// ErrDataAfterStreamEnd 协议违规: Relay/Exit 在 StreamEnd 之后仍发送消息
+var ErrDataAfterStreamEnd = errors.New("流式响应结束后收到多余数据")
+
+// trailingDataTimeout StreamEnd 之后等待 Relay 关闭流的最长时间，超时视为正常结束
+const trailingDataTimeout = 5 * time.Second
+
 // ReadChunk 读取并解密下一个 SSE 事件，返回 io.EOF 表示流结束
+// 流式响应头 (StreamHead) 在读取时解析到 Header，不作为数据块返回
+// 流结束后再次调用时，若 StreamEnd 之后收到了多余数据则返回 ErrDataAfterStreamEnd
 func (sr *StreamResponse) ReadChunk() ([]byte, error) {
+	if sr.ended != nil {
+		<-sr.ended
+		if sr.trailingErr != nil {
+			return nil, sr.trailingErr
+		}
+		return nil, io.EOF
+	}
+
+	for {
+		if len(sr.ready) > 0 {
+			chunk := sr.ready[0]
+			sr.ready = sr.ready[1:]
+			sr.delivered = true
+			return chunk, nil
+		}
+
+		msg, err := protocol.Decode(sr.stream)
+		if err != nil {
+			return nil, &relayFailure{conn: sr.conn, sent: true, delivered: sr.delivered, err: fmt.Errorf("读取流式响应失败: %w", err)}
+		}
+
+		switch msg.Type {
+		case protocol.MessageTypeStreamHead:
+			if err := sr.readHead(msg.Payload); err != nil {
+				return nil, err
+			}
+		case protocol.MessageTypeStreamChunk:
+			if sr.reorder == nil {
+				sr.delivered = true
+				return sr.decryptor.DecryptChunk(msg.Payload)
+			}
+			seq, chunk, err := sr.decryptor.DecryptSequencedChunk(msg.Payload)
+			if err != nil {
+				return nil, err
+			}
+			ready, err := sr.reorder.Push(seq, chunk)
+			if err != nil {
+				return nil, err
+			}
+			sr.ready = ready
+		case protocol.MessageTypeStreamEnd:
+			if sr.reorder != nil {
+				if err := sr.reorder.Finish(); err != nil {
+					return nil, err
+				}
+			}
+			sr.ended = make(chan struct{})
+			go sr.checkTrailing()
+			return nil, io.EOF
+		case protocol.MessageTypeError:
+			return nil, serverError(sr.conn, msg.Payload)
+		default:
+			return nil, fmt.Errorf("无效的流式响应类型: %d", msg.Type)
+		}
+	}
+}
+
+// checkTrailing 检测 StreamEnd 之后的多余数据: 正常情况下 Relay 转发 StreamEnd 后立即关闭流
+// 收到任何消息均视为协议违规，记录日志并丢弃流上的剩余数据
+func (sr *StreamResponse) checkTrailing() {
+	defer close(sr.ended)
+
+	sr.stream.SetReadDeadline(time.Now().Add(trailingDataTimeout))
 	msg, err := protocol.Decode(sr.stream)
 	if err != nil {
-		return nil, fmt.Errorf("读取流式响应失败: %w", err)
+		// 流正常关闭、超时或已被 Close 取消
+		return
 	}
+	sr.trailingErr = fmt.Errorf("%w (类型 0x%02x)", ErrDataAfterStreamEnd, msg.Type)
+	log.Printf("警告: 流式响应结束后收到多余的消息 (类型 0x%02x)，已丢弃", msg.Type)
+	sr.stream.CancelRead(0)
+}
 
-	switch msg.Type {
-	case protocol.MessageTypeStreamChunk:
-		return sr.decryptor.DecryptChunk(msg.Payload)
-	case protocol.MessageTypeStreamEnd:
-		return nil, io.EOF
-	case protocol.MessageTypeError:
-		return nil, fmt.Errorf("服务端错误: %s", string(msg.Payload))
-	default:
-		return nil, fmt.Errorf("无效的流式响应类型: %d", msg.Type)
+// readHead 解密并解析流式响应头
+func (sr *StreamResponse) readHead(payload []byte) error {
+	block, err := sr.decryptor.DecryptChunk(payload)
+	if err != nil {
+		return fmt.Errorf("解密流式响应头失败: %w", err)
 	}
+	// Header.Write 输出的 header 块不含结束空行
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(block, '\r', '\n'))))
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return fmt.Errorf("解析流式响应头失败: %w", err)
+	}
+	sr.Header = http.Header(header)
+
+	// Exit 确认序号协商后，之后的块带序号，按序号重排
+	if sr.Header.Get(protocol.StreamSeqHeader) != "" {
+		sr.Header.Del(protocol.StreamSeqHeader)
+		sr.reorder = newChunkReorderer(chunkReorderWindow)
+	}
+	if status := sr.Header.Get(protocol.StreamStatusHeader); status != "" {
+		sr.Header.Del(protocol.StreamStatusHeader)
+		code, err := strconv.Atoi(status)
+		if err != nil || code < 100 || code > 999 {
+			return fmt.Errorf("无效的流式响应状态码: %q", status)
+		}
+		sr.StatusCode = code
+	}
+	return nil
 }
 
-// Close 关闭流式响应
+// Close 关闭流式响应，请求体仍在上传时一并中止，并释放对 Relay 连接的引用
 func (sr *StreamResponse) Close() error {
 	sr.stream.CancelRead(0)
+	if sr.uploadDone != nil {
+		select {
+		case <-sr.uploadDone:
+		default:
+			sr.stream.CancelWrite(0)
+		}
+	}
+	if sr.release != nil {
+		sr.release()
+	}
 	return nil
 }
 
-// SendStreamRequest 发送流式请求，返回可逐块解密的 StreamResponse
+// SendStreamRequest 发送流式请求到当前 Exit，返回可逐块解密的 StreamResponse
 func (c *Client) SendStreamRequest(ctx context.Context, req *http.Request) (*StreamResponse, error) {
+	return c.SendStreamRequestTo(ctx, nil, req)
+}
+
+// SendStreamRequestTo 发送流式请求到指定 Exit (target 为 nil 时使用当前 Exit)
+// 请求送达前 Relay 失败时换 Relay 重试；需要在首个块之前也能重试时使用 OpenStream
+func (c *Client) SendStreamRequestTo(ctx context.Context, target *ExitTarget, req *http.Request) (*StreamResponse, error) {
+	var resp *StreamResponse
+	retryable := func(rf *relayFailure) bool { return !rf.sent }
+	err := c.withRelayRetry(ctx, req, retryable, func() error {
+		var err error
+		resp, err = c.sendStreamRequest(ctx, target, req)
+		return err
+	})
+	return resp, err
+}
+
+// sendStreamRequest 在当前 Relay 连接上发送一次流式请求，响应关闭前持有连接引用
+func (c *Client) sendStreamRequest(ctx context.Context, target *ExitTarget, req *http.Request) (*StreamResponse, error) {
 	conn, err := c.getConnection(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("获取连接失败: %w", err)
+		return nil, &relayFailure{err: fmt.Errorf("获取连接失败: %w", err)}
 	}
+	resp, err := c.sendStreamRequestOn(ctx, conn, target, req)
+	if err != nil {
+		conn.release()
+		return nil, err
+	}
+	resp.release = sync.OnceFunc(conn.release)
+	return resp, nil
+}
+
+// sendStreamRequestOn 在指定 Relay 连接上发送一次流式请求
+func (c *Client) sendStreamRequestOn(ctx context.Context, conn quic.Connection, target *ExitTarget, req *http.Request) (*StreamResponse, error) {
+	exit := c.resolveExit(target)
 
 	stream, err := conn.OpenStreamSync(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("创建流失败: %w", err)
+		return nil, &relayFailure{conn: conn, err: fmt.Errorf("创建流失败: %w", err)}
 	}
 
-	// OHTTP 加密请求
-	ohttpReq, clientCtx, err := c.ohttpClient.EncapsulateRequest(req)
+	// 声明可处理 StreamHead，Exit 在首个块之前返回后端响应头
+	req.Header.Set(protocol.StreamHeadHeader, "1")
+	// 声明可处理带序号的块，Exit 确认后 Client 按序号重排并检测缺失
+	req.Header.Set(protocol.StreamSeqHeader, "1")
+
+	// OHTTP 加密请求 (Exit 支持时大请求体只加密请求头部，请求体随后分块上传；随请求发送的请求体按配置压缩)
+	upload := needsChunkedUpload(req) && exit.SupportsFeature(protocol.FeatureChunkedUpload)
+	head := req
+	if upload {
+		head = chunkedUploadHead(req)
+	} else if head, err = c.compressRequest(req); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	ohttpReq, clientCtx, err := exit.ohttpClient.EncapsulateRequest(head)
 	if err != nil {
 		stream.Close()
 		return nil, fmt.Errorf("加密请求失败: %w", err)
 	}
+	var sealer *crypto.RequestBodySealer
+	if upload {
+		if sealer, err = clientCtx.NewRequestBodySealer(); err != nil {
+			stream.Close()
+			return nil, fmt.Errorf("创建请求体加密器失败: %w", err)
+		}
+	}
 
 	// 发送 StreamRequest 消息 (包含 Exit 公钥哈希)
-	msg := protocol.NewStreamRequestMessage(c.exitPubKeyHash, ohttpReq)
-	if _, err := stream.Write(msg.Encode()); err != nil {
+	msg := protocol.NewStreamRequestMessage(exit.PubKeyHash, ohttpReq)
+	msg.Tenant = tenantFromContext(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.Deadline = deadline // Relay 据此在超时后中断 Exit 流
+	}
+	if err := protocol.WriteMessage(stream, msg); err != nil {
 		stream.Close()
-		return nil, fmt.Errorf("发送请求失败: %w", err)
+		return nil, &relayFailure{conn: conn, err: fmt.Errorf("发送请求失败: %w", err)}
 	}
 
-	// 关闭写入端，保持读取端开放
-	if err := stream.Close(); err != nil {
-		return nil, fmt.Errorf("关闭写入端失败: %w", err)
+	var uploadDone chan struct{}
+	if upload {
+		// 后台上传请求体，与读取响应并行 (后端可能在读完请求体前返回错误)
+		uploadDone = make(chan struct{})
+		go uploadRequestBody(stream, req.Body, sealer, uploadDone)
+	} else if err := stream.Close(); err != nil {
+		// 关闭写入端，保持读取端开放
+		return nil, &relayFailure{conn: conn, err: fmt.Errorf("关闭写入端失败: %w", err)}
 	}
 
 	// 设置首次 chunk 读取超时
@@ -352,13 +839,21 @@ func (c *Client) SendStreamRequest(ctx context.Context, req *http.Request) (*Str
 	}
 
 	return &StreamResponse{
-		stream:    stream,
-		decryptor: decryptor,
+		StatusCode: http.StatusOK,
+		stream:     stream,
+		conn:       conn,
+		decryptor:  decryptor,
+		uploadDone: uploadDone,
 	}, nil
 }
 
-// SendRequestRaw 发送原始 HTTP 请求并返回响应体
-func (c *Client) SendRequestRaw(ctx context.Context, method, path string, body []byte, headers map[string]string) ([]byte, int, error) {
+// SendRequestRaw 发送原始 HTTP 请求到当前 Exit 并返回响应体、状态码和响应头
+func (c *Client) SendRequestRaw(ctx context.Context, method, path string, body []byte, headers map[string]string) ([]byte, int, http.Header, error) {
+	return c.SendRequestRawTo(ctx, nil, method, path, body, headers)
+}
+
+// SendRequestRawTo 发送原始 HTTP 请求到指定 Exit 并返回响应体、状态码和响应头 (target 为 nil 时使用当前 Exit)
+func (c *Client) SendRequestRawTo(ctx context.Context, target *ExitTarget, method, path string, body []byte, headers map[string]string) ([]byte, int, http.Header, error) {
 	// 构建请求
 	var bodyReader io.Reader
 	if len(body) > 0 {
@@ -367,7 +862,7 @@ func (c *Client) SendRequestRaw(ctx context.Context, method, path string, body [
 
 	req, err := http.NewRequestWithContext(ctx, method, "http://ai-backend"+path, bodyReader)
 	if err != nil {
-		return nil, 0, fmt.Errorf("创建请求失败: %w", err)
+		return nil, 0, nil, fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	// 设置 Content-Length
@@ -380,23 +875,110 @@ func (c *Client) SendRequestRaw(ctx context.Context, method, path string, body [
 	}
 
 	// 发送请求
-	resp, err := c.SendRequest(ctx, req)
+	resp, err := c.SendRequestTo(ctx, target, req)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, nil, err
 	}
 	defer resp.Body.Close()
 
 	// 读取响应
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, 0, fmt.Errorf("读取响应体失败: %w", err)
+		return nil, 0, nil, fmt.Errorf("读取响应体失败: %w", err)
+	}
+
+	return respBody, resp.StatusCode, resp.Header, nil
+}
+
+// Ping 在当前连接上发送应用层心跳，检测半开连接 (不触发重连)
+func (c *Client) Ping(ctx context.Context) error {
+	c.connMu.Lock()
+	conn := c.conn
+	if conn != nil {
+		conn.acquire()
+	}
+	c.connMu.Unlock()
+	if conn == nil {
+		return fmt.Errorf("连接不可用")
+	}
+	defer conn.release()
+
+	ctx, cancel := context.WithTimeout(ctx, c.pingTimeout)
+	defer cancel()
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return fmt.Errorf("打开心跳流失败: %w", err)
+	}
+	defer stream.CancelRead(0)
+
+	if err := protocol.WriteMessage(stream, protocol.NewHeartbeatMessage()); err != nil {
+		stream.Close()
+		return fmt.Errorf("写入心跳消息失败: %w", err)
+	}
+	stream.Close()
+
+	deadline, _ := ctx.Deadline()
+	stream.SetReadDeadline(deadline)
+	ackMsg, err := protocol.Decode(stream)
+	if err != nil {
+		return fmt.Errorf("读取心跳确认失败: %w", err)
+	}
+	if ackMsg.Type != protocol.MessageTypeHeartbeatAck {
+		return fmt.Errorf("期望 HeartbeatAck，收到类型 0x%02x", ackMsg.Type)
+	}
+	return nil
+}
+
+// StartIdlePing 启动空闲连接探活 (interval <= 0 时不启动)
+// 连接空闲超过 interval 时发送心跳，失败则主动重连，避免用户请求撞上已失效的连接
+func (c *Client) StartIdlePing(interval time.Duration) {
+	if interval <= 0 {
+		return
 	}
+	go c.idlePingLoop(interval)
+}
+
+// idlePingLoop 空闲探活循环
+func (c *Client) idlePingLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopPing:
+			return
+		case <-ticker.C:
+		}
+
+		idle := time.Since(time.Unix(0, c.lastActive.Load()))
+		if idle < interval {
+			continue
+		}
+
+		c.connMu.Lock()
+		hasConn := c.conn != nil
+		c.connMu.Unlock()
+		if !hasConn {
+			continue
+		}
 
-	return respBody, resp.StatusCode, nil
+		ctx := context.Background()
+		if err := c.Ping(ctx); err != nil {
+			log.Printf("空闲连接探活失败: %v，主动重连 Relay", err)
+			if err := c.Connect(ctx); err != nil {
+				log.Printf("重连 Relay 失败: %v (将在首次请求时重试)", err)
+			}
+		}
+	}
 }
 
 // Close 关闭客户端连接
 func (c *Client) Close() error {
+	if c.stopPing != nil {
+		c.stopPingOnce.Do(func() { close(c.stopPing) })
+	}
+
 	c.connMu.Lock()
 	defer c.connMu.Unlock()
 
@@ -405,6 +987,11 @@ func (c *Client) Close() error {
 		c.discovery.Stop()
 	}
 
+	if c.hedgeConn != nil {
+		c.hedgeConn.CloseWithError(0, "client closed")
+		c.hedgeConn = nil
+	}
+
 	if c.conn != nil {
 		err := c.conn.CloseWithError(0, "client closed")
 		c.conn = nil
@@ -440,7 +1027,12 @@ func (c *Client) QueryExitKeys(ctx context.Context) ([]protocol.ExitKeyEntry, er
 	if err != nil {
 		return nil, fmt.Errorf("获取连接失败: %w", err)
 	}
+	defer conn.release()
+	return queryExitKeys(ctx, conn)
+}
 
+// queryExitKeys 在指定 Relay 连接上查询 Exit 公钥列表
+func queryExitKeys(ctx context.Context, conn quic.Connection) ([]protocol.ExitKeyEntry, error) {
 	stream, err := conn.OpenStreamSync(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("创建流失败: %w", err)
@@ -448,51 +1040,78 @@ func (c *Client) QueryExitKeys(ctx context.Context) ([]protocol.ExitKeyEntry, er
 	defer stream.Close()
 
 	// 发送查询消息
-	queryMsg := protocol.NewQueryExitKeysMessage()
-	if _, err := stream.Write(queryMsg.Encode()); err != nil {
+	queryMsg := protocol.NewQueryExitKeysMessage(protocol.ExitKeysEncodingGzip)
+	if err := protocol.WriteMessage(stream, queryMsg); err != nil {
 		return nil, fmt.Errorf("发送查询消息失败: %w", err)
 	}
 
 	// 读取响应
 	respMsg, err := protocol.Decode(stream)
 	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %w", err)
+		return nil, &relayFailure{conn: conn, sent: true, err: fmt.Errorf("读取响应失败: %w", err)}
 	}
 
 	if respMsg.Type == protocol.MessageTypeError {
-		return nil, fmt.Errorf("服务端错误: %s", string(respMsg.Payload))
+		return nil, serverError(conn, respMsg.Payload)
 	}
 
 	if respMsg.Type != protocol.MessageTypeExitKeysResponse {
 		return nil, fmt.Errorf("期望 ExitKeysResponse，收到类型 0x%02x", respMsg.Type)
 	}
 
-	// 解析 JSON payload
-	var entries []protocol.ExitKeyEntry
-	if err := json.Unmarshal(respMsg.Payload, &entries); err != nil {
-		return nil, fmt.Errorf("解析 Exit 公钥列表失败: %w", err)
-	}
-
-	return entries, nil
+	// 解析 JSON payload (Relay 可能按协商结果 gzip 压缩)
+	return protocol.DecodeExitKeysResponse(respMsg.Payload)
 }
 
-// SetExit 设置 Exit 节点（自动计算公钥哈希）
+// SetExit 设置 Exit 节点（自动计算公钥哈希），静态配置的 Exit 未通告协议特性
 func (c *Client) SetExit(keyID uint8, publicKey []byte) error {
-	c.connMu.Lock()
-	defer c.connMu.Unlock()
-
-	c.exitPubKeyHash = crypto.PubKeyHash(publicKey)
-
 	// 重新创建 OHTTP 客户端
 	ohttpClient, err := crypto.NewOHTTPClient(keyID, publicKey)
 	if err != nil {
 		return fmt.Errorf("创建 OHTTP 客户端失败: %w", err)
 	}
-	c.ohttpClient = ohttpClient
+	ohttpClient.SetLegacyEncoding(true)
+	c.setExit(&ExitTarget{PubKeyHash: crypto.PubKeyHash(publicKey), ohttpClient: ohttpClient})
+	return nil
+}
 
+// SetExitEntry 按 Relay 返回的 Exit 公钥条目设置 Exit，并记录其通告的协议特性
+func (c *Client) SetExitEntry(entry protocol.ExitKeyEntry) error {
+	target, err := NewExitTarget(entry)
+	if err != nil {
+		return err
+	}
+	c.setExit(target)
 	return nil
 }
 
+// setExit 切换当前 Exit 并重置公钥淘汰状态
+func (c *Client) setExit(target *ExitTarget) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	c.exitPubKeyHash = target.PubKeyHash
+	c.ohttpClient = target.ohttpClient
+	c.exitFeatures = target.Features
+	c.exitKeySetAt = time.Now()
+	c.exitKeyStale = false
+	clear(c.exitKeyFailures)
+}
+
+// HasExit 是否已设置 Exit 公钥
+// 公钥已按 TTL 或解密失败淘汰时返回 false，由调用方重新获取
+func (c *Client) HasExit() bool {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if c.ohttpClient == nil {
+		return false
+	}
+	if !c.exitKeyStale && c.exitKeyTTL > 0 && time.Since(c.exitKeySetAt) >= c.exitKeyTTL {
+		c.evictExitKeyLocked(fmt.Sprintf("超过 %v 有效期", c.exitKeyTTL))
+	}
+	return !c.exitKeyStale
+}
+
 // GetExitPubKeyHash 获取当前 Exit 公钥哈希
 func (c *Client) GetExitPubKeyHash() string {
 	c.connMu.Lock()
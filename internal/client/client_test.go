@@ -2,13 +2,24 @@ package client
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/binn/tokengo/internal/cert"
+	"github.com/binn/tokengo/internal/config"
 	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/identity"
+	"github.com/binn/tokengo/internal/loadbalancer"
 	"github.com/binn/tokengo/internal/protocol"
 	"github.com/binn/tokengo/internal/testutil"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/quic-go/quic-go"
 )
 
 func createDummyHTTPRequest() (*http.Request, error) {
@@ -257,3 +268,249 @@ func TestStreamResponse_ReadChunk_UnknownType(t *testing.T) {
 		t.Fatal("ReadChunk should return error for unknown type")
 	}
 }
+
+func TestStreamResponse_ReadChunk_DataAfterStreamEnd(t *testing.T) {
+	sr, serverStream, _ := newTestStreamResponse(t)
+
+	sr.ReadChunk()
+	sr.ReadChunk()
+	if _, err := sr.ReadChunk(); err != io.EOF {
+		t.Fatalf("expected io.EOF at StreamEnd, got %v", err)
+	}
+
+	// StreamEnd 之后收到的数据是协议违规，不应作为数据块返回
+	go serverStream.Write(protocol.NewStreamChunkMessage([]byte("late")).Encode())
+
+	if _, err := sr.ReadChunk(); !errors.Is(err, ErrDataAfterStreamEnd) {
+		t.Fatalf("expected ErrDataAfterStreamEnd, got %v", err)
+	}
+}
+
+func TestStreamResponse_ReadChunk_EOFAfterStreamEnd(t *testing.T) {
+	sr, serverStream, _ := newTestStreamResponse(t)
+
+	sr.ReadChunk()
+	sr.ReadChunk()
+	sr.ReadChunk()
+
+	// Relay 在 StreamEnd 之后正常关闭流
+	serverStream.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := sr.ReadChunk(); err != io.EOF {
+			t.Fatalf("read %d after StreamEnd: expected io.EOF, got %v", i, err)
+		}
+	}
+}
+
+// startPingRelay 启动测试 Relay：第一个连接静默丢弃心跳 (模拟半开连接)，之后的连接正常回复
+func startPingRelay(t *testing.T) (addr string, conns *atomic.Int32) {
+	t.Helper()
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("identity.Generate: %v", err)
+	}
+	tlsCert, err := cert.GeneratePeerIDCert(id.PrivKey, "")
+	if err != nil {
+		t.Fatalf("GeneratePeerIDCert: %v", err)
+	}
+	listener, err := quic.ListenAddr("127.0.0.1:0", cert.CreateServerTLSConfig(tlsCert), nil)
+	if err != nil {
+		t.Fatalf("ListenAddr: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	conns = &atomic.Int32{}
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			silent := conns.Add(1) == 1
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					if _, err := protocol.Decode(stream); err != nil || silent {
+						continue
+					}
+					stream.Write(protocol.NewHeartbeatAckMessage().Encode())
+					stream.Close()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), conns
+}
+
+func TestClient_IdlePingReconnectsDeadConnection(t *testing.T) {
+	addr, conns := startPingRelay(t)
+
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	c, err := NewClient(addr, kp.KeyID, kp.PublicKey)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer c.Close()
+	c.pingTimeout = 100 * time.Millisecond
+
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := c.Ping(context.Background()); err == nil {
+		t.Fatal("ping on silently dropped connection should fail")
+	}
+
+	c.StartIdlePing(50 * time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for conns.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle ping did not reconnect dead connection")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err := c.Ping(context.Background()); err != nil {
+		t.Errorf("ping after reconnect failed: %v", err)
+	}
+}
+
+func TestClient_ConnectFeedsLatencySelector(t *testing.T) {
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("identity.Generate: %v", err)
+	}
+	tlsCert, err := cert.GeneratePeerIDCert(id.PrivKey, "")
+	if err != nil {
+		t.Fatalf("GeneratePeerIDCert: %v", err)
+	}
+	listener, err := quic.ListenAddr("127.0.0.1:0", cert.CreateServerTLSConfig(tlsCert), nil)
+	if err != nil {
+		t.Fatalf("ListenAddr: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			if _, err := listener.Accept(context.Background()); err != nil {
+				return
+			}
+		}
+	}()
+
+	selector := loadbalancer.NewLatencySelector()
+	c, _ := NewClientDynamic()
+	c.SetSelector(selector)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.connectToAddr(ctx, listener.Addr().String(), id.PeerID); err != nil {
+		t.Fatalf("connectToAddr: %v", err)
+	}
+
+	if d, ok := selector.Latency(id.PeerID); !ok || d <= 0 {
+		t.Errorf("握手 RTT 应反馈给选择器, got %v, %v", d, ok)
+	}
+}
+
+// startResumptionRelay 启动回复心跳的测试 Relay，记录每个连接是否恢复了 TLS 会话
+func startResumptionRelay(t *testing.T, allow0RTT bool) (addr string, peerID peer.ID, resumed chan bool) {
+	t.Helper()
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("identity.Generate: %v", err)
+	}
+	tlsCert, err := cert.GeneratePeerIDCert(id.PrivKey, "")
+	if err != nil {
+		t.Fatalf("GeneratePeerIDCert: %v", err)
+	}
+	listener, err := quic.ListenAddrEarly("127.0.0.1:0", cert.CreateServerTLSConfig(tlsCert), &quic.Config{Allow0RTT: allow0RTT})
+	if err != nil {
+		t.Fatalf("ListenAddrEarly: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	resumed = make(chan bool, 4)
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				<-conn.HandshakeComplete()
+				resumed <- conn.ConnectionState().TLS.DidResume
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					if _, err := protocol.Decode(stream); err != nil {
+						continue
+					}
+					stream.Write(protocol.NewHeartbeatAckMessage().Encode())
+					stream.Close()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), id.PeerID, resumed
+}
+
+func TestClient_ReconnectResumesTLSSession(t *testing.T) {
+	for _, enable0RTT := range []bool{false, true} {
+		t.Run(fmt.Sprintf("0rtt=%v", enable0RTT), func(t *testing.T) {
+			addr, peerID, resumed := startResumptionRelay(t, enable0RTT)
+
+			c, _ := NewClientDynamic()
+			c.SetQUICParams(config.QUICParams{Enable0RTT: enable0RTT})
+			defer c.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// 首次连接: 完整握手，之后 Relay 签发的票据按 PeerID 存入缓存
+			if err := c.connectToAddr(ctx, addr, peerID); err != nil {
+				t.Fatalf("first connect: %v", err)
+			}
+			if <-resumed {
+				t.Fatal("first handshake should not resume a session")
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				if _, ok := c.sessionCache.Get("peer/" + peerID.String()); ok {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("session ticket not cached after first handshake")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			c.conn.CloseWithError(0, "reconnect")
+
+			// 重连同一 Relay: 使用缓存的票据恢复会话，恢复的会话仍校验 PeerID
+			if err := c.connectToAddr(ctx, addr, peerID); err != nil {
+				t.Fatalf("reconnect: %v", err)
+			}
+			if err := c.Ping(ctx); err != nil {
+				t.Fatalf("ping after reconnect: %v", err)
+			}
+			if !<-resumed {
+				t.Error("relay: second handshake did not resume the session")
+			}
+			state := c.conn.ConnectionState()
+			if !state.TLS.DidResume {
+				t.Error("client: second handshake did not resume the session")
+			}
+			if state.Used0RTT != enable0RTT {
+				t.Errorf("Used0RTT = %v, want %v", state.Used0RTT, enable0RTT)
+			}
+		})
+	}
+}
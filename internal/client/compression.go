@@ -0,0 +1,79 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// SetCompression 设置内层 HTTP 体压缩: 请求体在 HPKE 加密前按 cfg.Algorithm 压缩 (小于 cfg.MinSize 时不压缩)，
+// 并声明接受 Exit 以同一算法压缩的非流式响应；未配置算法时不压缩 (默认)
+// 旧版 Exit 无法识别压缩的请求体，需在所有 Exit 升级后再启用
+func (c *Client) SetCompression(cfg config.Compression) error {
+	flag, err := protocol.ParseCompression(cfg.Algorithm)
+	if err != nil {
+		return err
+	}
+	minSize := cfg.MinSize
+	if minSize <= 0 {
+		minSize = protocol.DefaultCompressionMinSize
+	}
+	c.compression, c.compressMinSize = flag, minSize
+	return nil
+}
+
+// compressRequest 返回请求体加上压缩标志字节 (达到阈值时压缩) 的请求副本，并声明接受压缩的响应
+// 未启用压缩时返回原请求；原请求的请求体读取后还原，重试时仍可使用
+func (c *Client) compressRequest(req *http.Request) (*http.Request, error) {
+	if c.compression == protocol.CompressionNone {
+		return req, nil
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取请求体失败: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	framed, err := protocol.CompressBody(body, c.compression, c.compressMinSize)
+	if err != nil {
+		return nil, err
+	}
+
+	out := req.Clone(req.Context())
+	out.Header.Set(protocol.CompressionHeader, protocol.CompressionName(c.compression))
+	out.Body = io.NopCloser(bytes.NewReader(framed))
+	out.ContentLength = int64(len(framed))
+	out.GetBody = nil
+	return out, nil
+}
+
+// decompressResponse Exit 回显压缩头时解析标志字节并还原响应体，旧版 Exit 的响应原样返回
+func decompressResponse(resp *http.Response) error {
+	if resp.Header.Get(protocol.CompressionHeader) == "" {
+		return nil
+	}
+	resp.Header.Del(protocol.CompressionHeader)
+
+	framed, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("读取响应体失败: %w", err)
+	}
+	body, err := protocol.DecompressBody(framed, 0)
+	if err != nil {
+		return fmt.Errorf("解压响应失败: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length") // 压缩后的长度，不再适用
+	return nil
+}
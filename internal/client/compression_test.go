@@ -0,0 +1,92 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/exit"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/quic-go/quic-go"
+)
+
+func TestClient_CompressionRoundTrip(t *testing.T) {
+	prompt := []byte(`{"model":"gpt-4","messages":[` + strings.Repeat(`{"role":"user","content":"summarize this paragraph"},`, 300) + `{}]}`)
+	completion := []byte(`{"choices":[{"message":{"content":"` + strings.Repeat("lorem ipsum ", 2000) + `"}}]}`)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(protocol.CompressionHeader) != "" || !bytes.Equal(body, prompt) {
+			http.Error(w, "backend received a compressed request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(completion)
+	}))
+	t.Cleanup(backend.Close)
+
+	kp, _ := crypto.GenerateKeyPair()
+	handler, err := exit.NewOHTTPHandler(kp.KeyID, kp.PrivateKey, kp.PublicKey, exit.NewAIClient(backend.URL, "", nil))
+	if err != nil {
+		t.Fatalf("NewOHTTPHandler: %v", err)
+	}
+	if err := handler.SetCompression(config.Compression{Algorithm: "zstd"}); err != nil {
+		t.Fatalf("exit SetCompression: %v", err)
+	}
+	var requestSize, responseSize atomic.Int64
+	relay, _ := startTestRelay(t, func(stream quic.Stream, msg *protocol.Message) {
+		defer stream.Close()
+		requestSize.Store(int64(len(msg.Payload)))
+		resp, err := handler.ProcessRequest(msg.Payload)
+		if err != nil {
+			stream.Write(protocol.NewErrorMessage(err.Error()).Encode())
+			return
+		}
+		responseSize.Store(int64(len(resp)))
+		stream.Write(protocol.NewResponseMessage(resp).Encode())
+	})
+	c, _ := newFailoverClient(t, kp, relay)
+	if err := c.SetCompression(config.Compression{Algorithm: "zstd"}); err != nil {
+		t.Fatalf("client SetCompression: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	body, status, header, err := c.SendRequestRaw(ctx, http.MethodPost, "/v1/chat/completions", prompt, map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		t.Fatalf("SendRequestRaw: %v", err)
+	}
+	if status != http.StatusOK || !bytes.Equal(body, completion) {
+		t.Fatalf("response = %d (%d bytes), want 200 with the original completion", status, len(body))
+	}
+	if header.Get(protocol.CompressionHeader) != "" {
+		t.Error("compression header leaked to the caller")
+	}
+	if got := requestSize.Load(); got >= int64(len(prompt))/2 {
+		t.Errorf("encrypted request = %d bytes, want compressed well below the %d byte prompt", got, len(prompt))
+	}
+	if got := responseSize.Load(); got >= int64(len(completion))/2 {
+		t.Errorf("encrypted response = %d bytes, want compressed well below the %d byte completion", got, len(completion))
+	}
+}
+
+func TestCompressRequest_Disabled(t *testing.T) {
+	c, _ := NewClientDynamic()
+	defer c.Close()
+	req, _ := http.NewRequest(http.MethodPost, "http://ai-backend/v1/chat/completions", strings.NewReader(strings.Repeat("x", 4096)))
+	got, err := c.compressRequest(req)
+	if err != nil || got != req {
+		t.Errorf("compressRequest without compression = %v, %v; want the original request", got, err)
+	}
+	if err := c.SetCompression(config.Compression{Algorithm: "brotli"}); err == nil {
+		t.Error("SetCompression accepted an unknown algorithm")
+	}
+}
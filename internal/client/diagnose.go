@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// 诊断步骤名称
+const (
+	StepRelayReachable  = "relay reachable"
+	StepExitRegistered  = "exit registered"
+	StepBackendResponse = "backend responded"
+)
+
+// diagnosePath 诊断使用的 canary 请求路径
+const diagnosePath = "/v1/models"
+
+// DiagnoseStep 单个诊断步骤的结果
+type DiagnoseStep struct {
+	Name    string
+	OK      bool
+	Latency time.Duration
+	Detail  string
+}
+
+// DiagnoseReport 一条 Relay → Exit 路径的诊断报告
+type DiagnoseReport struct {
+	RelayAddr string
+	ExitHash  string
+	Steps     []DiagnoseStep
+}
+
+// OK 所有步骤均成功时返回 true
+func (r *DiagnoseReport) OK() bool {
+	for _, s := range r.Steps {
+		if !s.OK {
+			return false
+		}
+	}
+	return len(r.Steps) > 0
+}
+
+// Failed 返回第一个失败的步骤，全部成功时返回 nil
+func (r *DiagnoseReport) Failed() *DiagnoseStep {
+	for i := range r.Steps {
+		if !r.Steps[i].OK {
+			return &r.Steps[i]
+		}
+	}
+	return nil
+}
+
+// Print 输出逐步诊断报告
+func (r *DiagnoseReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "诊断路径: Relay %s → Exit %s\n", r.RelayAddr, r.ExitHash)
+	for i, s := range r.Steps {
+		status := "OK"
+		if !s.OK {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "  [%d] %-18s %-4s %8s  %s\n", i+1, s.Name, status, s.Latency.Round(time.Millisecond), s.Detail)
+	}
+	if r.OK() {
+		fmt.Fprintln(w, "结果: 路径可用")
+	} else {
+		fmt.Fprintf(w, "结果: 路径不可用 (失败于 %s)\n", r.Failed().Name)
+	}
+}
+
+func (r *DiagnoseReport) add(name string, start time.Time, err error, detail string) bool {
+	step := DiagnoseStep{Name: name, OK: err == nil, Latency: time.Since(start), Detail: detail}
+	if err != nil {
+		step.Detail = err.Error()
+	}
+	r.Steps = append(r.Steps, step)
+	return err == nil
+}
+
+// Diagnose 连接指定 Relay，向指定 Exit 发送 canary OHTTP 请求，逐跳报告结果
+// 遇到失败的步骤即停止，后续步骤不会出现在报告中
+func Diagnose(ctx context.Context, relayAddr, exitHash string) *DiagnoseReport {
+	report := &DiagnoseReport{RelayAddr: relayAddr, ExitHash: exitHash}
+
+	c, _ := NewClientDynamic()
+	defer c.Close()
+	c.SetRelay(relayAddr)
+
+	// 1. Relay 可达
+	start := time.Now()
+	if !report.add(StepRelayReachable, start, c.Connect(ctx), "QUIC 连接已建立") {
+		return report
+	}
+
+	// 2. Exit 已在 Relay 注册
+	start = time.Now()
+	entries, err := c.QueryExitKeys(ctx)
+	if err != nil {
+		report.add(StepExitRegistered, start, fmt.Errorf("查询 Exit 公钥失败: %w", err), "")
+		return report
+	}
+	i := slices.IndexFunc(entries, func(e protocol.ExitKeyEntry) bool { return e.PubKeyHash == exitHash })
+	if i < 0 {
+		report.add(StepExitRegistered, start, fmt.Errorf("Exit %s 未在 Relay 注册 (已注册 %d 个)", exitHash, len(entries)), "")
+		return report
+	}
+	keyID, _, err := crypto.DecodeKeyConfig(entries[i].KeyConfig)
+	if err == nil {
+		err = c.SetExitEntry(entries[i])
+	}
+	if !report.add(StepExitRegistered, start, err, fmt.Sprintf("KeyID %d", keyID)) {
+		return report
+	}
+
+	// 3. 后端响应 canary 请求
+	start = time.Now()
+	_, status, _, err := c.SendRequestRaw(ctx, http.MethodGet, diagnosePath, nil, nil)
+	if err == nil && status >= http.StatusInternalServerError {
+		err = fmt.Errorf("GET %s 返回 HTTP %d", diagnosePath, status)
+	}
+	report.add(StepBackendResponse, start, err, fmt.Sprintf("GET %s 返回 HTTP %d", diagnosePath, status))
+
+	return report
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/binn/tokengo/pkg/openai"
+)
+
+// OpenAI 错误类型
+const (
+	errorTypeGateway        = "gateway_error"
+	errorTypeInvalidRequest = "invalid_request_error"
+)
+
+// ServerError Relay/Exit 通过 Error 消息返回的错误
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return "服务端错误: " + e.Message
+}
+
+// gatewayError 网关内部错误对应的 HTTP 状态码和 OpenAI 错误码
+type gatewayError struct {
+	status int
+	code   string
+}
+
+// serverErrorCodes Relay/Exit 错误原因 → OpenAI 错误码
+var serverErrorCodes = map[string]gatewayError{
+	protocol.ErrExitNotFound:         {http.StatusServiceUnavailable, "exit_unavailable"},
+	protocol.ErrExitReconnecting:     {http.StatusServiceUnavailable, "exit_reconnecting"},
+	protocol.ErrRelayDraining:        {http.StatusServiceUnavailable, "relay_draining"},
+	protocol.ErrConnectionExpired:    {http.StatusServiceUnavailable, "relay_connection_expired"},
+	protocol.ErrExitConnectionFailed: {http.StatusServiceUnavailable, "exit_unavailable"},
+	protocol.ErrWriteToExitFailed:    {http.StatusBadGateway, "exit_communication_failed"},
+	protocol.ErrReadExitResponse:     {http.StatusBadGateway, "exit_communication_failed"},
+	protocol.ErrMissingTarget:        {http.StatusBadGateway, "exit_not_selected"},
+	protocol.ErrInvalidMessageType:   {http.StatusBadGateway, "protocol_error"},
+	protocol.ErrIncompatibleVersion:  {http.StatusBadGateway, "protocol_error"},
+	protocol.ErrSerializeExitKeys:    {http.StatusBadGateway, "relay_internal_error"},
+	protocol.ErrTooManyRequests:      {http.StatusTooManyRequests, "exit_overloaded"},
+	protocol.ErrRequestTooLarge:      {http.StatusRequestEntityTooLarge, "request_too_large"},
+	protocol.ErrDecryptRequest:       {http.StatusBadGateway, "exit_key_mismatch"},
+	protocol.ErrQueueTimeout:         {http.StatusServiceUnavailable, "exit_queue_timeout"},
+	protocol.ErrRateLimited:          {http.StatusTooManyRequests, "relay_rate_limited"},
+	protocol.ErrAccessDenied:         {http.StatusForbidden, "access_denied"},
+}
+
+// serverErrorPrefixes Exit 返回的带详情错误 (格式 "<prefix>: <detail>")
+var serverErrorPrefixes = []struct {
+	prefix string
+	gatewayError
+}{
+	{protocol.ErrDecodePrefix, gatewayError{http.StatusBadGateway, "protocol_error"}},
+	{protocol.ErrUnknownMessagePrefix, gatewayError{http.StatusBadGateway, "protocol_error"}},
+	{protocol.ErrProcessPrefix, gatewayError{http.StatusBadGateway, "exit_processing_failed"}},
+	{protocol.ErrStreamPrefix, gatewayError{http.StatusBadGateway, "exit_stream_failed"}},
+}
+
+// toOpenAIError 将网关内部错误映射为 HTTP 状态码和 OpenAI 风格的错误对象
+func toOpenAIError(err error) (int, openai.ErrorDetail) {
+	var srvErr *ServerError
+	if errors.As(err, &srvErr) {
+		ge := lookupServerError(srvErr.Message)
+		return ge.status, openai.ErrorDetail{
+			Message: srvErr.Message,
+			Type:    errorTypeGateway,
+			Code:    ge.code,
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, openai.ErrorDetail{
+			Message: "请求超时",
+			Type:    errorTypeGateway,
+			Code:    "gateway_timeout",
+		}
+	}
+
+	return http.StatusBadGateway, openai.ErrorDetail{
+		Message: err.Error(),
+		Type:    errorTypeGateway,
+		Code:    "relay_unavailable",
+	}
+}
+
+// lookupServerError 查找错误原因对应的状态码和错误码，未知原因归为 upstream_error
+func lookupServerError(message string) gatewayError {
+	if ge, ok := serverErrorCodes[message]; ok {
+		return ge
+	}
+	for _, p := range serverErrorPrefixes {
+		if strings.HasPrefix(message, p.prefix) {
+			return p.gatewayError
+		}
+	}
+	return gatewayError{http.StatusBadGateway, "upstream_error"}
+}
+
+// isExitFailure 判断错误是否表明目标 Exit 已失效 (未注册或无法通信)
+func isExitFailure(err error) bool {
+	var srvErr *ServerError
+	if !errors.As(err, &srvErr) {
+		return false
+	}
+	switch lookupServerError(srvErr.Message).code {
+	case "exit_unavailable", "exit_communication_failed":
+		return true
+	}
+	return false
+}
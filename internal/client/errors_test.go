@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/binn/tokengo/pkg/openai"
+)
+
+func TestToOpenAIError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"exit not found", &ServerError{Message: protocol.ErrExitNotFound}, http.StatusServiceUnavailable, "exit_unavailable"},
+		{"exit connection failed", &ServerError{Message: protocol.ErrExitConnectionFailed}, http.StatusServiceUnavailable, "exit_unavailable"},
+		{"write to exit failed", &ServerError{Message: protocol.ErrWriteToExitFailed}, http.StatusBadGateway, "exit_communication_failed"},
+		{"read exit response failed", &ServerError{Message: protocol.ErrReadExitResponse}, http.StatusBadGateway, "exit_communication_failed"},
+		{"missing target", &ServerError{Message: protocol.ErrMissingTarget}, http.StatusBadGateway, "exit_not_selected"},
+		{"invalid message type", &ServerError{Message: protocol.ErrInvalidMessageType}, http.StatusBadGateway, "protocol_error"},
+		{"serialize exit keys", &ServerError{Message: protocol.ErrSerializeExitKeys}, http.StatusBadGateway, "relay_internal_error"},
+		{"too many requests", &ServerError{Message: protocol.ErrTooManyRequests}, http.StatusTooManyRequests, "exit_overloaded"},
+		{"request too large", &ServerError{Message: protocol.ErrRequestTooLarge}, http.StatusRequestEntityTooLarge, "request_too_large"},
+		{"exit key mismatch", &ServerError{Message: protocol.ErrDecryptRequest}, http.StatusBadGateway, "exit_key_mismatch"},
+		{"exit queue timeout", &ServerError{Message: protocol.ErrQueueTimeout}, http.StatusServiceUnavailable, "exit_queue_timeout"},
+		{"exit decode error", &ServerError{Message: protocol.ErrDecodePrefix + ": EOF"}, http.StatusBadGateway, "protocol_error"},
+		{"exit unknown message", &ServerError{Message: protocol.ErrUnknownMessagePrefix + ": 0x42"}, http.StatusBadGateway, "protocol_error"},
+		{"exit process error", &ServerError{Message: protocol.ErrProcessPrefix + ": KeyID 不匹配"}, http.StatusBadGateway, "exit_processing_failed"},
+		{"exit stream error", &ServerError{Message: protocol.ErrStreamPrefix + ": AI 后端返回错误"}, http.StatusBadGateway, "exit_stream_failed"},
+		{"unknown server error", &ServerError{Message: "something else"}, http.StatusBadGateway, "upstream_error"},
+		{"wrapped server error", fmt.Errorf("wrap: %w", &ServerError{Message: protocol.ErrExitNotFound}), http.StatusServiceUnavailable, "exit_unavailable"},
+		{"timeout", fmt.Errorf("读取响应失败: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "gateway_timeout"},
+		{"connection error", fmt.Errorf("获取连接失败: dial failed"), http.StatusBadGateway, "relay_unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, detail := toOpenAIError(tt.err)
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if detail.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", detail.Code, tt.wantCode)
+			}
+			if detail.Type != errorTypeGateway {
+				t.Errorf("type = %q, want %q", detail.Type, errorTypeGateway)
+			}
+			if detail.Message == "" {
+				t.Error("message should not be empty")
+			}
+		})
+	}
+}
+
+func TestLocalProxy_WriteGatewayError(t *testing.T) {
+	p := &LocalProxy{}
+	rec := httptest.NewRecorder()
+
+	p.writeGatewayError(rec, &ServerError{Message: protocol.ErrExitNotFound})
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	// 响应必须符合 OpenAI 错误结构: {"error":{"message","type","param","code"}}
+	var raw map[string]map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	for _, field := range []string{"message", "type", "param", "code"} {
+		if _, ok := raw["error"][field]; !ok {
+			t.Errorf("error object missing field %q: %s", field, rec.Body.String())
+		}
+	}
+
+	var resp openai.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if resp.Error.Type != "gateway_error" || resp.Error.Code != "exit_unavailable" {
+		t.Errorf("error = %+v, want gateway_error/exit_unavailable", resp.Error)
+	}
+}
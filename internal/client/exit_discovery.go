@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/netutil"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DiscoveredExit 跨 Relay 聚合后的 Exit，同一公钥哈希只出现一次
+type DiscoveredExit struct {
+	protocol.ExitKeyEntry
+	Relays []string // 可达该 Exit 的 Relay (PeerID，静态模式为地址)
+}
+
+// exitSource 单个 Relay 返回的 Exit 列表
+type exitSource struct {
+	relay   string
+	entries []protocol.ExitKeyEntry
+}
+
+// mergeExitEntries 按公钥哈希去重并合并可达路径，保持首次出现的顺序
+// 同时注册到多个 Relay 的 Exit 只要在任一 Relay 上在线即视为在线，元数据以在线的来源为准
+func mergeExitEntries(sources []exitSource) []DiscoveredExit {
+	index := make(map[string]int)
+	var exits []DiscoveredExit
+	for _, src := range sources {
+		for _, entry := range src.entries {
+			i, seen := index[entry.PubKeyHash]
+			if !seen {
+				index[entry.PubKeyHash] = len(exits)
+				exits = append(exits, DiscoveredExit{ExitKeyEntry: entry, Relays: []string{src.relay}})
+				continue
+			}
+			exit := &exits[i]
+			if !slices.Contains(exit.Relays, src.relay) {
+				exit.Relays = append(exit.Relays, src.relay)
+			}
+			if exit.Reconnecting && !entry.Reconnecting {
+				exit.ExitKeyEntry = entry
+			}
+		}
+	}
+	return exits
+}
+
+// DiscoverExits 查询当前 Relay 及其他已发现 Relay 上的 Exit 列表，按公钥哈希去重
+// 当前 Relay 查询失败时返回错误；其他 Relay 仅用于补充可达路径，查询失败时跳过
+func (c *Client) DiscoverExits(ctx context.Context) ([]DiscoveredExit, error) {
+	exits, _, err := c.discoverExits(ctx)
+	return exits, err
+}
+
+// discoverExits 同 DiscoverExits，并返回查询时的当前 Relay (DiscoveredExit.Relays 中的标识)
+func (c *Client) discoverExits(ctx context.Context) ([]DiscoveredExit, string, error) {
+	entries, err := c.QueryExitKeys(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	c.connMu.Lock()
+	currentID := c.currentRelayID
+	current := relayKey(c.relayAddr, currentID)
+	c.connMu.Unlock()
+
+	sources := []exitSource{{relay: current, entries: entries}}
+	if currentID != "" {
+		sources = append(sources, c.queryOtherRelays(ctx, currentID)...)
+	}
+	return mergeExitEntries(sources), current, nil
+}
+
+// exitEntriesVia 返回可经指定 Relay 到达的 Exit (保持发现顺序)，relay 为空时返回全部
+// 请求只经当前 Relay 转发，仅注册在其他 Relay 上的 Exit 不可选
+func exitEntriesVia(exits []DiscoveredExit, relay string) []protocol.ExitKeyEntry {
+	var entries []protocol.ExitKeyEntry
+	for _, exit := range exits {
+		if relay == "" || slices.Contains(exit.Relays, relay) {
+			entries = append(entries, exit.ExitKeyEntry)
+		}
+	}
+	return entries
+}
+
+// knownRelays 返回已发现的 Relay (不触发新的 DHT 查询)，静态模式返回 nil
+func (c *Client) knownRelays(ctx context.Context) []peer.AddrInfo {
+	if c.discoverFn != nil {
+		relays, _ := c.discoverFn(ctx)
+		return relays
+	}
+	c.connMu.Lock()
+	discovery := c.discovery
+	c.connMu.Unlock()
+	if discovery == nil {
+		return nil
+	}
+	return discovery.GetCachedRelays()
+}
+
+// queryOtherRelays 并行连接除当前 Relay 外的已发现 Relay 查询 Exit 列表，按发现顺序返回成功的结果
+func (c *Client) queryOtherRelays(ctx context.Context, current peer.ID) []exitSource {
+	var relays []peer.AddrInfo
+	for _, r := range c.knownRelays(ctx) {
+		if r.ID != current {
+			relays = append(relays, r)
+		}
+	}
+
+	results := make([]*exitSource, len(relays))
+	var wg sync.WaitGroup
+	for i, r := range relays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addrs := netutil.ResolveQUICAddresses(ctx, r.Addrs, c.addrFamily)
+			conn, _, _, err := c.dialRelay(ctx, addrs, r.ID)
+			if err != nil {
+				log.Printf("查询 Relay %s 上的 Exit 失败: %v", r.ID, err)
+				return
+			}
+			defer conn.CloseWithError(0, "exit keys queried")
+
+			entries, err := queryExitKeys(ctx, conn)
+			if err != nil {
+				log.Printf("查询 Relay %s 上的 Exit 失败: %v", r.ID, err)
+				return
+			}
+			results[i] = &exitSource{relay: r.ID.String(), entries: entries}
+		}()
+	}
+	wg.Wait()
+
+	var sources []exitSource
+	for _, src := range results {
+		if src != nil {
+			sources = append(sources, *src)
+		}
+	}
+	return sources
+}
+
+// usableExitKey 解析 Exit 公钥并试加密一个请求，确认可以用它建立 OHTTP 客户端
+// KeyConfig 只做长度检查，公钥本身是否有效要到加密时才能发现
+func usableExitKey(entry protocol.ExitKeyEntry) (keyID uint8, publicKey []byte, err error) {
+	keyConfigs, err := crypto.DecodeKeyConfigs(entry.KeyConfig)
+	if err != nil {
+		return 0, nil, fmt.Errorf("解析 Exit KeyConfig 失败: %w", err)
+	}
+	keyID, publicKey = keyConfigs[0].KeyID, keyConfigs[0].PublicKey
+	ohttpClient, err := crypto.NewOHTTPClient(keyID, publicKey, keyConfigs[0].AEAD())
+	if err != nil {
+		return 0, nil, fmt.Errorf("创建 OHTTP 客户端失败: %w", err)
+	}
+	probe, _ := http.NewRequest(http.MethodGet, "/", nil)
+	if _, _, err := ohttpClient.EncapsulateRequest(probe); err != nil {
+		return 0, nil, fmt.Errorf("Exit 公钥无法加密请求: %w", err)
+	}
+	return keyID, publicKey, nil
+}
@@ -0,0 +1,245 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/quic-go/quic-go"
+)
+
+func TestMergeExitEntries(t *testing.T) {
+	a := protocol.ExitKeyEntry{PubKeyHash: "a", Reconnecting: true}
+	aOnline := protocol.ExitKeyEntry{PubKeyHash: "a", Capabilities: []string{"chat"}}
+	b := protocol.ExitKeyEntry{PubKeyHash: "b"}
+
+	exits := mergeExitEntries([]exitSource{
+		{relay: "r1", entries: []protocol.ExitKeyEntry{a, b}},
+		{relay: "r2", entries: []protocol.ExitKeyEntry{aOnline}},
+		{relay: "r2", entries: []protocol.ExitKeyEntry{aOnline}},
+	})
+
+	if len(exits) != 2 || exits[0].PubKeyHash != "a" || exits[1].PubKeyHash != "b" {
+		t.Fatalf("exits = %+v, want a, b", exits)
+	}
+	if !slices.Equal(exits[0].Relays, []string{"r1", "r2"}) {
+		t.Errorf("a relays = %v, want [r1 r2]", exits[0].Relays)
+	}
+	// 任一 Relay 上在线即视为在线，元数据取在线来源
+	if exits[0].Reconnecting || !slices.Equal(exits[0].Capabilities, []string{"chat"}) {
+		t.Errorf("a = %+v, want online entry from r2", exits[0].ExitKeyEntry)
+	}
+	if !slices.Equal(exits[1].Relays, []string{"r1"}) {
+		t.Errorf("b relays = %v, want [r1]", exits[1].Relays)
+	}
+}
+
+// serveExitKeys 返回一个对 QueryExitKeys 回复固定 Exit 列表的 Relay 处理函数
+func serveExitKeys(t *testing.T, entries ...protocol.ExitKeyEntry) func(quic.Stream, *protocol.Message) {
+	t.Helper()
+	resp, err := protocol.NewExitKeysResponseMessage(entries)
+	if err != nil {
+		t.Fatalf("NewExitKeysResponseMessage: %v", err)
+	}
+	return func(stream quic.Stream, msg *protocol.Message) {
+		defer stream.Close()
+		if msg.Type == protocol.MessageTypeQueryExitKeys {
+			stream.Write(resp.Encode())
+		}
+	}
+}
+
+// testExitEntry 生成一个带有效 KeyConfig 的 Exit 条目
+func testExitEntry(t *testing.T) protocol.ExitKeyEntry {
+	t.Helper()
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	return protocol.ExitKeyEntry{
+		PubKeyHash: crypto.PubKeyHash(kp.PublicKey),
+		KeyConfig:  crypto.EncodeKeyConfig(kp.KeyID, kp.PublicKey),
+	}
+}
+
+func TestClient_DiscoverExitsDedupsAcrossRelays(t *testing.T) {
+	shared, onlyB := testExitEntry(t), testExitEntry(t)
+	relayA, _ := startTestRelay(t, serveExitKeys(t, shared))
+	relayB, _ := startTestRelay(t, serveExitKeys(t, onlyB, shared))
+	kp, _ := crypto.GenerateKeyPair()
+	c, _ := newFailoverClient(t, kp, relayA, relayB)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	exits, err := c.DiscoverExits(ctx)
+	if err != nil {
+		t.Fatalf("DiscoverExits: %v", err)
+	}
+
+	if len(exits) != 2 {
+		t.Fatalf("got %d exits, want 2: %+v", len(exits), exits)
+	}
+	if exits[0].PubKeyHash != shared.PubKeyHash || !slices.Equal(exits[0].Relays, []string{relayA.ID.String(), relayB.ID.String()}) {
+		t.Errorf("shared exit = %s via %v, want both relays", exits[0].PubKeyHash, exits[0].Relays)
+	}
+	if exits[1].PubKeyHash != onlyB.PubKeyHash || !slices.Equal(exits[1].Relays, []string{relayB.ID.String()}) {
+		t.Errorf("second exit = %s via %v, want relay B only", exits[1].PubKeyHash, exits[1].Relays)
+	}
+
+	// 其他 Relay 不可达时仍返回当前 Relay 的结果
+	relayB.Addrs = nil
+	c.discoverFn = func(ctx context.Context) ([]peer.AddrInfo, error) {
+		return []peer.AddrInfo{relayA, relayB}, nil
+	}
+	exits, err = c.DiscoverExits(ctx)
+	if err != nil || len(exits) != 1 || exits[0].PubKeyHash != shared.PubKeyHash {
+		t.Errorf("with relay B unreachable: %+v, %v", exits, err)
+	}
+}
+
+func TestLocalProxy_DiscoverExitSkipsBadKeys(t *testing.T) {
+	good := testExitEntry(t)
+	truncated := protocol.ExitKeyEntry{PubKeyHash: "truncated", KeyConfig: good.KeyConfig[:8]}
+	badKey := protocol.ExitKeyEntry{PubKeyHash: "bad-key", KeyConfig: crypto.EncodeKeyConfig(1, []byte("not a public key"))}
+
+	relay, _ := startTestRelay(t, serveExitKeys(t, truncated, badKey, good))
+	kp, _ := crypto.GenerateKeyPair()
+	c, _ := newFailoverClient(t, kp, relay)
+	p := &LocalProxy{cfg: &config.ClientConfig{}, client: c, progress: NewSilentProgress()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// 选择按权重随机，多次发现都应跳过公钥不可用的 Exit
+	for i := 0; i < 10; i++ {
+		entry, err := p.discoverExit(ctx)
+		if err != nil {
+			t.Fatalf("discoverExit: %v", err)
+		}
+		if entry.PubKeyHash != good.PubKeyHash {
+			t.Fatalf("selected key %s, want the valid exit %s", entry.PubKeyHash, good.PubKeyHash)
+		}
+	}
+
+	// 全部公钥不可用时报告错误
+	relay, _ = startTestRelay(t, serveExitKeys(t, truncated, badKey))
+	c, _ = newFailoverClient(t, kp, relay)
+	p.client = c
+	if _, err := p.discoverExit(ctx); err == nil {
+		t.Error("discoverExit should fail when no exit has a usable key")
+	}
+}
+
+func TestLocalProxy_DiscoverExitUsesMergedExits(t *testing.T) {
+	shared, onlyA, onlyB := testExitEntry(t), testExitEntry(t), testExitEntry(t)
+	relayA, _ := startTestRelay(t, serveExitKeys(t, shared, onlyA, shared))
+	relayB, _ := startTestRelay(t, serveExitKeys(t, onlyB, shared))
+	kp, _ := crypto.GenerateKeyPair()
+	c, _ := newFailoverClient(t, kp, relayA, relayB)
+	sessions, err := NewSessionRouter("header:X-Session-ID")
+	if err != nil {
+		t.Fatalf("NewSessionRouter: %v", err)
+	}
+	p := &LocalProxy{cfg: &config.ClientConfig{}, client: c, progress: NewSilentProgress(), sessions: sessions}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// 只注册在其他 Relay 上的 Exit 无法经当前 Relay 到达，不参与选择
+	for i := 0; i < 10; i++ {
+		entry, err := p.discoverExit(ctx)
+		if err != nil {
+			t.Fatalf("discoverExit: %v", err)
+		}
+		if entry.PubKeyHash == onlyB.PubKeyHash {
+			t.Fatalf("selected %s, which is only reachable via another relay", entry.PubKeyHash)
+		}
+	}
+
+	p.exitsMu.RLock()
+	var known []string
+	for _, exit := range p.exits {
+		known = append(known, exit.PubKeyHash)
+	}
+	p.exitsMu.RUnlock()
+	if want := []string{shared.PubKeyHash, onlyA.PubKeyHash}; !slices.Equal(known, want) {
+		t.Errorf("known exits = %v, want %v (deduplicated, current relay only)", known, want)
+	}
+	sessions.mu.RLock()
+	n := len(sessions.exits)
+	sessions.mu.RUnlock()
+	if n != 2 {
+		t.Errorf("session router has %d exits, want 2", n)
+	}
+}
+
+func TestLocalProxy_DiscoverExitFiltersByModel(t *testing.T) {
+	gpt, llama := testExitEntry(t), testExitEntry(t)
+	gpt.Models, gpt.Weight = []string{"gpt-4o"}, 100
+	llama.Models = []string{"llama3*"}
+
+	relay, _ := startTestRelay(t, serveExitKeys(t, gpt, llama))
+	kp, _ := crypto.GenerateKeyPair()
+	c, _ := newFailoverClient(t, kp, relay)
+	p := &LocalProxy{cfg: &config.ClientConfig{ExitModel: "llama3:8b"}, client: c, progress: NewSilentProgress()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// 权重更高的 Exit 未通告该模型，不参与选择
+	for i := 0; i < 10; i++ {
+		entry, err := p.discoverExit(ctx)
+		if err != nil {
+			t.Fatalf("discoverExit: %v", err)
+		}
+		if entry.PubKeyHash != llama.PubKeyHash {
+			t.Fatalf("selected %s, want the exit advertising llama3*", entry.PubKeyHash)
+		}
+	}
+	// 全部 Exit 仍记录下来，供按请求模型路由
+	if p.knownExit(gpt.PubKeyHash) == nil {
+		t.Error("filtered exits should still be known for per-request routing")
+	}
+
+	p.cfg.ExitModel = "o1"
+	if _, err := p.discoverExit(ctx); !errors.Is(err, ErrNoModelExit) {
+		t.Errorf("discoverExit err = %v, want ErrNoModelExit", err)
+	}
+}
+
+func TestClient_QueryExitModels(t *testing.T) {
+	want := protocol.ExitModels{"hash-a": {"gpt-4o", "o1"}}
+	resp, err := protocol.NewExitModelsResponseMessage(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay, _ := startTestRelay(t, func(stream quic.Stream, msg *protocol.Message) {
+		defer stream.Close()
+		if msg.Type == protocol.MessageTypeQueryExitModels {
+			protocol.WriteMessage(stream, resp)
+		}
+	})
+	kp, _ := crypto.GenerateKeyPair()
+	c, _ := newFailoverClient(t, kp, relay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	got, err := c.QueryExitModels(ctx)
+	if err != nil {
+		t.Fatalf("QueryExitModels: %v", err)
+	}
+	if len(got) != 1 || !slices.Equal(got["hash-a"], want["hash-a"]) {
+		t.Errorf("QueryExitModels = %v, want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	PrintExitModels(&buf, got)
+	if !strings.Contains(buf.String(), "hash-a") || !strings.Contains(buf.String(), "gpt-4o, o1") {
+		t.Errorf("PrintExitModels output:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// DefaultMaxExitAttempts 单个请求默认最多尝试的 Exit 数 (含首选 Exit)
+const DefaultMaxExitAttempts = 2
+
+// maxExitAttempts 解析配置的 Exit 尝试次数: 0 使用默认值，小于 1 时只尝试首选 Exit
+func maxExitAttempts(n int) int {
+	switch {
+	case n == 0:
+		return DefaultMaxExitAttempts
+	case n < 1:
+		return 1
+	default:
+		return n
+	}
+}
+
+// exitRetryable 判断 Exit 失败后能否换其他 Exit 重试
+// Exit 不可用、并发已满或排队超时时请求尚未送达后端；与 Exit 通信中途失败时请求可能已被处理，只有幂等方法可重放
+func exitRetryable(err error, method string) bool {
+	var srvErr *ServerError
+	if !errors.As(err, &srvErr) {
+		return false
+	}
+	switch lookupServerError(srvErr.Message).code {
+	case "exit_unavailable", "exit_reconnecting", "exit_overloaded", "exit_queue_timeout":
+		return true
+	case "exit_communication_failed":
+		return isIdempotent(method)
+	}
+	return false
+}
+
+// targetHash 返回请求目标的公钥哈希 (nil 表示当前 Exit)
+func (p *LocalProxy) targetHash(target *ExitTarget) string {
+	if target != nil {
+		return target.PubKeyHash
+	}
+	return p.client.GetExitPubKeyHash()
+}
+
+// nextExit 选择一个尚未尝试过、支持请求端点族的 Exit，没有时返回 nil
+func (p *LocalProxy) nextExit(capability string, tried map[string]bool) *ExitTarget {
+	p.exitsMu.RLock()
+	defer p.exitsMu.RUnlock()
+	for _, exit := range p.exits {
+		if !tried[exit.PubKeyHash] && exit.Supports(capability) {
+			return exit
+		}
+	}
+	return nil
+}
+
+// withExitFallback 执行请求，目标 Exit 失败且可重试时换其他 Exit，最多尝试 max_exit_attempts 个 Exit
+// 每次失败都会通知会话路由；达到上限后直接返回最后一次的错误，避免遍历全部 Exit 造成长时间等待
+func (p *LocalProxy) withExitFallback(r *http.Request, target *ExitTarget, attempt func(*ExitTarget) error) error {
+	limit := maxExitAttempts(p.cfg.MaxExitAttempts)
+	capability := protocol.EndpointCapability(r.URL.Path)
+	tried := make(map[string]bool, limit)
+
+	for i := 1; ; i++ {
+		err := attempt(target)
+		if err == nil {
+			return nil
+		}
+		p.reportExitFailure(target, err)
+		if !exitRetryable(err, r.Method) {
+			return err
+		}
+
+		failed := p.targetHash(target)
+		tried[failed] = true
+		if i >= limit {
+			if limit > 1 {
+				log.Printf("已尝试 %d 个 Exit 均失败，放弃请求", i)
+			}
+			return err
+		}
+		next := p.nextExit(capability, tried)
+		if next == nil {
+			return err
+		}
+		log.Printf("Exit %s 失败: %v，切换到 Exit %s 重试 (%d/%d)", failed, err, next.PubKeyHash, i+1, limit)
+		target = next
+	}
+}
+
+// rewindBody 重置请求体以便重新发送 (newBackendRequest 创建的请求总是可重放)
+func rewindBody(req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return fmt.Errorf("重放请求体失败: %w", err)
+	}
+	req.Body = body
+	return nil
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/quic-go/quic-go"
+)
+
+// targetRecorder 记录 Relay 收到的请求目标，并以固定错误拒绝所有请求
+type targetRecorder struct {
+	mu      sync.Mutex
+	targets []string
+	errMsg  string
+}
+
+func (r *targetRecorder) handle(stream quic.Stream, msg *protocol.Message) {
+	r.mu.Lock()
+	r.targets = append(r.targets, msg.Target)
+	r.mu.Unlock()
+	stream.Write(protocol.NewErrorMessage(r.errMsg).Encode())
+	stream.Close()
+}
+
+// distinct 返回尝试过的不同 Exit 数
+func (r *targetRecorder) distinct() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := make(map[string]bool)
+	for _, target := range r.targets {
+		seen[target] = true
+	}
+	return len(seen)
+}
+
+// newExitFailoverProxy 创建已知 4 个 Exit、经 Relay 返回 errMsg 的代理
+func newExitFailoverProxy(t *testing.T, maxAttempts int, errMsg string) (*LocalProxy, *targetRecorder) {
+	t.Helper()
+	kp, _ := crypto.GenerateKeyPair()
+	recorder := &targetRecorder{errMsg: errMsg}
+	relay, _ := startTestRelay(t, recorder.handle)
+	c, _ := newFailoverClient(t, kp, relay)
+
+	p := &LocalProxy{
+		cfg:      &config.ClientConfig{MaxExitAttempts: maxAttempts},
+		client:   c,
+		progress: NewSilentProgress(),
+	}
+	p.setExits(newTestExitEntries(t, 4))
+	return p, recorder
+}
+
+func TestExitFallback_GivesUpAfterMaxAttempts(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		body        string
+		want        int
+	}{
+		{"default", 0, `{"model":"m"}`, DefaultMaxExitAttempts},
+		{"three", 3, `{"model":"m"}`, 3},
+		{"disabled", 1, `{"model":"m"}`, 1},
+		{"streaming", 3, `{"model":"m","stream":true}`, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, recorder := newExitFailoverProxy(t, tt.maxAttempts, protocol.ErrExitNotFound)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			p.handleRequest(w, req)
+
+			if w.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+			}
+			if got := recorder.distinct(); got != tt.want {
+				t.Errorf("tried %d exits, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitFallback_NonIdempotentCommunicationFailureNotRetried(t *testing.T) {
+	p, recorder := newExitFailoverProxy(t, 3, protocol.ErrReadExitResponse)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+	w := httptest.NewRecorder()
+	p.handleRequest(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+	if got := recorder.distinct(); got != 1 {
+		t.Errorf("tried %d exits, want 1", got)
+	}
+}
+
+func TestMaxExitAttempts(t *testing.T) {
+	tests := []struct {
+		in, want int
+	}{
+		{0, DefaultMaxExitAttempts},
+		{-1, 1},
+		{1, 1},
+		{5, 5},
+	}
+	for _, tt := range tests {
+		if got := maxExitAttempts(tt.in); got != tt.want {
+			t.Errorf("maxExitAttempts(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExitRetryable(t *testing.T) {
+	tests := []struct {
+		err    error
+		method string
+		want   bool
+	}{
+		{&ServerError{Message: protocol.ErrExitNotFound}, http.MethodPost, true},
+		{&ServerError{Message: protocol.ErrExitReconnecting}, http.MethodPost, true},
+		{&ServerError{Message: protocol.ErrTooManyRequests}, http.MethodPost, true},
+		{&ServerError{Message: protocol.ErrQueueTimeout}, http.MethodPost, true},
+		{&ServerError{Message: protocol.ErrReadExitResponse}, http.MethodGet, true},
+		{&ServerError{Message: protocol.ErrReadExitResponse}, http.MethodPost, false},
+		{&ServerError{Message: "backend error"}, http.MethodGet, false},
+		{errors.New("context canceled"), http.MethodGet, false},
+	}
+	for _, tt := range tests {
+		if got := exitRetryable(tt.err, tt.method); got != tt.want {
+			t.Errorf("exitRetryable(%v, %s) = %v, want %v", tt.err, tt.method, got, tt.want)
+		}
+	}
+}
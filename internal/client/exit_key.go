@@ -0,0 +1,90 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// defaultExitKeyMaxFailures 同一 Exit 连续解密失败多少次后淘汰缓存的公钥
+const defaultExitKeyMaxFailures = 3
+
+// errDecryptResponse 无法解密 Exit 的响应
+var errDecryptResponse = errors.New("解密响应失败")
+
+// SetExitKeyEviction 设置缓存的 Exit 公钥 (OHTTP 客户端) 的淘汰策略
+// ttl > 0 时公钥设置超过 ttl 后淘汰；maxFailures > 0 时同一 Exit 连续 maxFailures 次解密失败后淘汰
+// 淘汰后 HasExit 返回 false，LocalProxy 在下一个请求时从 Relay 重新获取 Exit 的当前公钥
+func (c *Client) SetExitKeyEviction(ttl time.Duration, maxFailures int) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.exitKeyTTL = ttl
+	c.exitKeyMaxFailures = maxFailures
+	c.exitKeyFailures = make(map[string]int)
+}
+
+// exitKeyMaxFailures 解析配置的解密失败淘汰阈值: 0 使用默认值，负数禁用
+func exitKeyMaxFailures(n int) int {
+	switch {
+	case n == 0:
+		return defaultExitKeyMaxFailures
+	case n < 0:
+		return 0
+	default:
+		return n
+	}
+}
+
+// isExitKeyFailure 检查错误是否表明 Client 使用的 Exit 公钥已失效
+// Exit 无法解密请求 (公钥已轮换)，或 Client 无法解密 Exit 的响应
+func isExitKeyFailure(err error) bool {
+	var srvErr *ServerError
+	if errors.As(err, &srvErr) {
+		return srvErr.Message == protocol.ErrDecryptRequest
+	}
+	return errors.Is(err, errDecryptResponse)
+}
+
+// observeExitKey 按请求结果统计目标 Exit 的连续解密失败次数 (target 为 nil 时为当前 Exit)
+// 达到阈值时淘汰缓存的公钥；其他错误不影响计数
+func (c *Client) observeExitKey(target *ExitTarget, err error) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if c.exitKeyMaxFailures <= 0 {
+		return
+	}
+	hash := c.exitPubKeyHash
+	if target != nil {
+		hash = target.PubKeyHash
+	}
+	if err == nil {
+		delete(c.exitKeyFailures, hash)
+		return
+	}
+	if !isExitKeyFailure(err) {
+		return
+	}
+	c.exitKeyFailures[hash]++
+	if n := c.exitKeyFailures[hash]; n >= c.exitKeyMaxFailures && !c.exitKeyStale {
+		// Exit 列表与当前 Exit 在重新发现时一起刷新
+		c.evictExitKeyLocked(fmt.Sprintf("Exit %s 连续 %d 次解密失败", hash, n))
+	}
+}
+
+// evictExitKeyLocked 淘汰缓存的 Exit 公钥 (调用者需持有 connMu)
+// 进行中的请求继续使用旧的 OHTTP 客户端，新请求等待重新获取
+func (c *Client) evictExitKeyLocked(reason string) {
+	c.exitKeyStale = true
+	clear(c.exitKeyFailures)
+	log.Printf("淘汰缓存的 Exit 公钥 %s (%s)，下次请求时重新获取", c.exitPubKeyHash, reason)
+}
+
+// exitKeyEvicted 当前 Exit 公钥是否已被淘汰 (区别于从未设置)
+func (c *Client) exitKeyEvicted() bool {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.ohttpClient != nil && c.exitKeyStale
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/exit"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/quic-go/quic-go"
+)
+
+// serveRotatedExit 模拟已轮换公钥的 Exit: Relay 只通告新公钥，用旧公钥加密的请求返回 ErrDecryptRequest
+func serveRotatedExit(t *testing.T, current *crypto.KeyPair, queries *atomic.Int32) func(quic.Stream, *protocol.Message) {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"object":"list"}`))
+	}))
+	t.Cleanup(backend.Close)
+	handler, err := exit.NewOHTTPHandler(current.KeyID, current.PrivateKey, current.PublicKey, exit.NewAIClient(backend.URL, "", nil))
+	if err != nil {
+		t.Fatalf("NewOHTTPHandler: %v", err)
+	}
+	keys, _ := protocol.NewExitKeysResponseMessage([]protocol.ExitKeyEntry{{
+		PubKeyHash: crypto.PubKeyHash(current.PublicKey),
+		KeyConfig:  crypto.EncodeKeyConfig(current.KeyID, current.PublicKey),
+	}})
+	return func(stream quic.Stream, msg *protocol.Message) {
+		defer stream.Close()
+		switch msg.Type {
+		case protocol.MessageTypeQueryExitKeys:
+			queries.Add(1)
+			stream.Write(keys.Encode())
+		case protocol.MessageTypeRequest:
+			resp, err := handler.ProcessRequest(msg.Payload)
+			if errors.Is(err, exit.ErrDecryptRequest) {
+				stream.Write(protocol.NewErrorMessage(protocol.ErrDecryptRequest).Encode())
+				return
+			}
+			if err != nil {
+				stream.Write(protocol.NewErrorMessage(err.Error()).Encode())
+				return
+			}
+			stream.Write(protocol.NewResponseMessage(resp).Encode())
+		}
+	}
+}
+
+// newRotatedExitProxy 创建仍缓存旧公钥的代理，Relay 后的 Exit 已换用新公钥
+func newRotatedExitProxy(t *testing.T, ttl time.Duration, maxFailures int) (p *LocalProxy, current *crypto.KeyPair, queries *atomic.Int32) {
+	t.Helper()
+	stale, _ := crypto.GenerateKeyPair()
+	current, _ = crypto.GenerateKeyPair()
+	queries = new(atomic.Int32)
+	relay, _ := startTestRelay(t, serveRotatedExit(t, current, queries))
+	c, _ := newFailoverClient(t, stale, relay)
+	c.SetExitKeyEviction(ttl, maxFailures)
+	if err := c.SetExit(stale.KeyID, stale.PublicKey); err != nil {
+		t.Fatalf("SetExit: %v", err)
+	}
+	return &LocalProxy{cfg: &config.ClientConfig{}, client: c, progress: NewSilentProgress()}, current, queries
+}
+
+func proxyGet(p *LocalProxy) int {
+	rec := httptest.NewRecorder()
+	p.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	return rec.Code
+}
+
+func TestExitKey_EvictedAfterRepeatedDecryptFailures(t *testing.T) {
+	p, current, queries := newRotatedExitProxy(t, 0, 2)
+
+	// 达到阈值之前继续使用缓存的公钥
+	for i := 0; i < 2; i++ {
+		if code := proxyGet(p); code != http.StatusBadGateway {
+			t.Fatalf("request %d with stale key = %d, want 502", i+1, code)
+		}
+	}
+	if queries.Load() != 0 {
+		t.Fatalf("exit keys queried %d times before eviction, want 0", queries.Load())
+	}
+
+	// 淘汰后重新获取 Exit 的当前公钥
+	if code := proxyGet(p); code != http.StatusOK {
+		t.Fatalf("request after eviction = %d, want 200", code)
+	}
+	if queries.Load() != 1 || p.client.GetExitPubKeyHash() != crypto.PubKeyHash(current.PublicKey) {
+		t.Errorf("queries = %d, exit = %s; want one refetch of the current key", queries.Load(), p.client.GetExitPubKeyHash())
+	}
+
+	// 重建后的 OHTTP 客户端继续使用，不再重复获取
+	if code := proxyGet(p); code != http.StatusOK || queries.Load() != 1 {
+		t.Errorf("next request = %d after %d queries, want 200 with the cached key", code, queries.Load())
+	}
+}
+
+func TestExitKey_EvictedAfterTTL(t *testing.T) {
+	p, current, queries := newRotatedExitProxy(t, time.Hour, 0)
+
+	// TTL 内使用缓存的公钥，不按失败次数淘汰
+	for i := 0; i < 3; i++ {
+		if code := proxyGet(p); code != http.StatusBadGateway {
+			t.Fatalf("request %d within TTL = %d, want 502", i+1, code)
+		}
+	}
+
+	p.client.connMu.Lock()
+	p.client.exitKeySetAt = time.Now().Add(-time.Hour)
+	p.client.connMu.Unlock()
+
+	if code := proxyGet(p); code != http.StatusOK {
+		t.Fatalf("request after TTL = %d, want 200", code)
+	}
+	if queries.Load() != 1 || p.client.GetExitPubKeyHash() != crypto.PubKeyHash(current.PublicKey) {
+		t.Errorf("queries = %d, exit = %s; want one refetch of the current key", queries.Load(), p.client.GetExitPubKeyHash())
+	}
+}
+
+func TestExitKeyMaxFailures(t *testing.T) {
+	for n, want := range map[int]int{0: defaultExitKeyMaxFailures, -1: 0, 5: 5} {
+		if got := exitKeyMaxFailures(n); got != want {
+			t.Errorf("exitKeyMaxFailures(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestNewExitTarget_UsesExitAdvertisedAEAD(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"object":"list"}`))
+	}))
+	t.Cleanup(backend.Close)
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	// Exit 只接受 ChaCha20-Poly1305，Client 必须按 KeyConfig 选择
+	handler, err := exit.NewOHTTPHandlerWithKeys([]*crypto.KeyPair{kp}, exit.NewAIClient(backend.URL, "", nil), crypto.AEADChaCha20Poly1305)
+	if err != nil {
+		t.Fatalf("NewOHTTPHandlerWithKeys: %v", err)
+	}
+	entry := protocol.ExitKeyEntry{PubKeyHash: crypto.PubKeyHash(kp.PublicKey), KeyConfig: handler.KeyConfig()}
+
+	if _, _, err := usableExitKey(entry); err != nil {
+		t.Fatalf("usableExitKey: %v", err)
+	}
+	target, err := NewExitTarget(entry)
+	if err != nil {
+		t.Fatalf("NewExitTarget: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://ai-backend/v1/models", nil)
+	ohttpReq, clientCtx, err := target.ohttpClient.EncapsulateRequest(req)
+	if err != nil {
+		t.Fatalf("EncapsulateRequest: %v", err)
+	}
+	ohttpResp, err := handler.ProcessRequest(ohttpReq)
+	if err != nil {
+		t.Fatalf("ProcessRequest: %v", err)
+	}
+	resp, err := clientCtx.DecapsulateResponse(ohttpResp)
+	if err != nil {
+		t.Fatalf("DecapsulateResponse: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/binn/tokengo/internal/netutil"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// errNoHedgeRelay 没有当前 Relay 之外的可用 Relay，无法发送对冲请求
+var errNoHedgeRelay = errors.New("没有其他可用的 Relay")
+
+// SetHedgeAfter 设置对冲延迟: 非流式幂等请求超过 d 未收到响应时，经另一个 Relay 发送相同请求，
+// 使用先返回的响应并取消另一个；d <= 0 表示禁用 (默认)
+func (c *Client) SetHedgeAfter(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	c.hedgeAfter = d
+}
+
+// hedgeable 请求是否可以对冲 (同时发送两次): 方法幂等，或调用方携带 Idempotency-Key 声明可安全重放
+func hedgeable(req *http.Request) bool {
+	return isIdempotent(req.Method) || req.Header.Get("Idempotency-Key") != ""
+}
+
+// sendHedged 发送请求，hedgeAfter 内未收到响应时经另一个 Relay 发送对冲请求
+// 只返回一个响应: 先成功的一方胜出，另一方被取消，随后到达的响应被丢弃；都失败时返回主请求的错误
+func (c *Client) sendHedged(ctx context.Context, target *ExitTarget, req *http.Request) (*http.Response, error) {
+	if err := replayableBody(req); err != nil {
+		return nil, err
+	}
+	// 对冲请求使用独立的请求体，与主请求 (及其换 Relay 重试) 互不影响
+	hedgeReq := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("重放请求体失败: %w", err)
+		}
+		hedgeReq.Body = body
+	}
+
+	type result struct {
+		resp  *http.Response
+		err   error
+		hedge bool
+	}
+	results := make(chan result, 2)
+
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	defer cancelPrimary()
+	go func() {
+		resp, err := c.sendWithRelayRetry(primaryCtx, target, req)
+		results <- result{resp: resp, err: err}
+	}()
+
+	hedgeCtx, cancelHedge := context.WithCancel(ctx)
+	defer cancelHedge()
+
+	timer := time.NewTimer(c.hedgeAfter)
+	defer timer.Stop()
+
+	pending := 1
+	var primaryErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				if r.hedge {
+					log.Printf("对冲请求失败: %v", r.err)
+				} else {
+					primaryErr = r.err
+				}
+				continue
+			}
+			// 取消仍在进行的请求，并释放其随后到达的响应
+			cancelPrimary()
+			cancelHedge()
+			go func(n int) {
+				for i := 0; i < n; i++ {
+					if late := <-results; late.err == nil {
+						late.resp.Body.Close()
+					}
+				}
+			}(pending)
+			return r.resp, nil
+		case <-timer.C:
+			pending++
+			go func() {
+				conn, err := c.hedgeConnection(hedgeCtx)
+				if err != nil {
+					results <- result{err: fmt.Errorf("无法发送对冲请求: %w", err), hedge: true}
+					return
+				}
+				defer conn.release()
+				resp, err := c.sendRequestOn(hedgeCtx, conn, target, hedgeReq)
+				results <- result{resp: resp, err: err, hedge: true}
+			}()
+		}
+	}
+	// 主请求失败 (对冲请求未发出或同样失败)，返回主请求的错误
+	return nil, primaryErr
+}
+
+// hedgeConnection 返回到另一个 Relay (不同于当前连接的 Relay) 的连接，已有可用连接时复用
+// 返回的连接已持有引用，调用者使用结束后需 release；静态模式或没有其他 Relay 时返回 errNoHedgeRelay
+func (c *Client) hedgeConnection(ctx context.Context) (*relayConn, error) {
+	if conn, ok := c.cachedHedgeConn(); ok {
+		return conn, nil
+	}
+
+	_, err, _ := c.connectFlight.Do("hedge", func() (any, error) {
+		c.connMu.Lock()
+		_, ok := c.peekHedgeConn()
+		c.connMu.Unlock()
+		if ok {
+			return nil, nil
+		}
+
+		// 连接由所有等待者共享，不随发起对冲的请求结束而中断
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), connectTimeout)
+		defer cancel()
+
+		discover := c.discoverFn
+		if discover == nil {
+			if c.discovery == nil {
+				return nil, errNoHedgeRelay
+			}
+			discover = c.discovery.DiscoverRelays
+		}
+		relays, err := discover(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("DHT 发现 Relay 失败: %w", err)
+		}
+
+		c.connMu.Lock()
+		current := c.currentRelayID
+		c.connMu.Unlock()
+		candidates := make([]peer.AddrInfo, 0, len(relays))
+		for _, r := range relays {
+			if r.ID != current {
+				candidates = append(candidates, r)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, errNoHedgeRelay
+		}
+
+		selected, err := c.selector.Select(ctx, candidates)
+		if err != nil {
+			return nil, fmt.Errorf("选择 Relay 失败: %w", err)
+		}
+		addrs := netutil.ResolveQUICAddresses(ctx, selected.Addrs, c.addrFamily)
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("无法提取 Relay 地址")
+		}
+		conn, _, _, err := c.dialRelay(ctx, addrs, selected.ID)
+		if err != nil {
+			c.selector.ReportFailure(selected.ID)
+			return nil, fmt.Errorf("连接 Relay 失败: %w", err)
+		}
+
+		c.connMu.Lock()
+		old := c.hedgeConn
+		c.hedgeConn, c.hedgeRelayID = newRelayConn(conn), selected.ID
+		c.connMu.Unlock()
+		if old != nil {
+			old.retire("hedge relay replaced")
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if conn, ok := c.cachedHedgeConn(); ok {
+		return conn, nil
+	}
+	// 新连接随即因当前 Relay 切换而不再可用
+	return nil, errNoHedgeRelay
+}
+
+// cachedHedgeConn 返回仍可用且不属于当前 Relay 的对冲连接，并为调用者持有引用
+func (c *Client) cachedHedgeConn() (*relayConn, bool) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	conn, ok := c.peekHedgeConn()
+	if ok {
+		conn.acquire()
+	}
+	return conn, ok
+}
+
+// peekHedgeConn 返回仍可用且不属于当前 Relay 的对冲连接 (调用者需持有 connMu，不持有引用)
+func (c *Client) peekHedgeConn() (*relayConn, bool) {
+	if c.hedgeConn == nil || c.hedgeRelayID == c.currentRelayID || c.hedgeConn.Context().Err() != nil {
+		return nil, false
+	}
+	return c.hedgeConn, true
+}
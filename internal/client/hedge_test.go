@@ -0,0 +1,164 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/quic-go/quic-go"
+)
+
+// stallingRelay 返回一个延迟 delay 后才交给 serve 处理的 Relay 处理函数
+// 等待期间 Client 取消读取 (放弃该请求) 时不再响应，并记录到 cancelled
+func stallingRelay(delay time.Duration, serve func(quic.Stream, *protocol.Message), cancelled *atomic.Bool) func(quic.Stream, *protocol.Message) {
+	return func(stream quic.Stream, msg *protocol.Message) {
+		select {
+		case <-stream.Context().Done():
+			cancelled.Store(true)
+		case <-time.After(delay):
+			serve(stream, msg)
+		}
+	}
+}
+
+// backendReply 返回固定响应体的后端，并统计收到的请求
+func backendReply(body string, hits *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}
+}
+
+func TestClient_HedgeWinsWhenFirstRelayStalls(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	var slowHits, fastHits atomic.Int32
+	var cancelled atomic.Bool
+	stalled, stalledRequests := startTestRelay(t, stallingRelay(5*time.Second, serveWithBackend(t, kp, backendReply(`{"from":"stalled"}`, &slowHits)), &cancelled))
+	healthy, healthyRequests := startTestRelay(t, serveWithBackend(t, kp, backendReply(`{"from":"hedge"}`, &fastHits)))
+	c, _ := newFailoverClient(t, kp, stalled, healthy)
+	c.SetHedgeAfter(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://ai-backend/v1/chat/completions", bytes.NewReader([]byte(`{"model":"m"}`)))
+	req.Header.Set("Idempotency-Key", "req-1")
+
+	start := time.Now()
+	resp, err := c.SendRequestTo(ctx, nil, req)
+	if err != nil {
+		t.Fatalf("hedged request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `{"from":"hedge"}` {
+		t.Errorf("response = %s, want the hedge relay's response", body)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("hedged request took %v, want well under the stalled relay's delay", elapsed)
+	}
+
+	// 两个 Relay 各收到一次请求，落后的一方被取消，后端只处理胜出的请求
+	if stalledRequests.Load() != 1 || healthyRequests.Load() != 1 {
+		t.Errorf("relay requests: stalled=%d hedge=%d, want 1/1", stalledRequests.Load(), healthyRequests.Load())
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !cancelled.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !cancelled.Load() {
+		t.Error("losing request on the stalled relay was not cancelled")
+	}
+	if slowHits.Load() != 0 || fastHits.Load() != 1 {
+		t.Errorf("backend hits: stalled=%d hedge=%d, want 0/1", slowHits.Load(), fastHits.Load())
+	}
+	// 对冲不会切换主连接
+	if got := c.GetCurrentRelayID(); got != stalled.ID {
+		t.Errorf("current relay = %s, want the original relay", got)
+	}
+}
+
+func TestClient_HedgeSkipsNonIdempotentRequest(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	var slowHits, fastHits atomic.Int32
+	var cancelled atomic.Bool
+	slow, _ := startTestRelay(t, stallingRelay(300*time.Millisecond, serveWithBackend(t, kp, backendReply(`{"from":"slow"}`, &slowHits)), &cancelled))
+	other, otherRequests := startTestRelay(t, serveWithBackend(t, kp, backendReply(`{"from":"other"}`, &fastHits)))
+	c, _ := newFailoverClient(t, kp, slow, other)
+	c.SetHedgeAfter(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// POST 且未携带 Idempotency-Key: 不对冲，等待唯一的请求
+	body, status, _, err := c.SendRequestRaw(ctx, http.MethodPost, "/v1/chat/completions", []byte(`{"model":"m"}`), nil)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if status != http.StatusOK || string(body) != `{"from":"slow"}` {
+		t.Errorf("response = %d %s, want the slow relay's response", status, body)
+	}
+	if otherRequests.Load() != 0 {
+		t.Errorf("other relay received %d requests, want none", otherRequests.Load())
+	}
+}
+
+func TestClient_SharedHedgeConnectionSurvivesLeaderCancel(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	primary, _ := startTestRelay(t, serveWithExit(t, kp))
+	second, _ := startTestRelay(t, serveWithExit(t, kp))
+	c, _ := newFailoverClient(t, kp, primary, second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := c.getConnection(ctx)
+	if err != nil {
+		t.Fatalf("getConnection: %v", err)
+	}
+	conn.release()
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	c.discoverFn = func(ctx context.Context) ([]peer.AddrInfo, error) {
+		once.Do(func() { close(entered) })
+		select {
+		case <-release:
+			return []peer.AddrInfo{primary, second}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// 发起对冲的请求在建立连接期间结束
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	go func() {
+		if conn, err := c.hedgeConnection(leaderCtx); err == nil {
+			conn.release()
+		}
+	}()
+	<-entered
+
+	waiter := make(chan error, 1)
+	go func() {
+		conn, err := c.hedgeConnection(ctx)
+		if err == nil {
+			conn.release()
+		}
+		waiter <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // 等待者加入进行中的连接
+	cancelLeader()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-waiter; err != nil {
+		t.Errorf("waiter hedgeConnection: %v, want the shared connection to survive the leader's cancellation", err)
+	}
+}
@@ -4,19 +4,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
+	"slices"
 	"strings"
-	"syscall"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/binn/tokengo/internal/config"
-	"github.com/binn/tokengo/internal/crypto"
 	"github.com/binn/tokengo/internal/dht"
+	"github.com/binn/tokengo/internal/loadbalancer"
+	"github.com/binn/tokengo/internal/netutil"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/binn/tokengo/pkg/openai"
+	"golang.org/x/sync/singleflight"
 )
 
 // LocalProxy 本地 HTTP 代理服务器
@@ -25,8 +30,19 @@ type LocalProxy struct {
 	client   *Client
 	server   *http.Server
 	dhtNode  *dht.Node
+	dhtMu     sync.Mutex // 保护 DHT 启动失败时置空 dhtNode，诊断信号可能在 Start 期间并发读取
 	discovery *dht.Discovery
 	progress ProgressReporter
+	sessions  *SessionRouter // 会话粘性路由 (未配置时为 nil)
+	cache     *responseCache // GET 响应缓存 (未配置 cache_ttl 时为 nil)
+
+	exitsMu sync.RWMutex
+	exits   []*ExitTarget // 最近一次发现的 Exit 列表 (按端点能力路由)
+
+	discoverFlight singleflight.Group              // 合并并发的首次请求发现
+	discoverFn     func(ctx context.Context) error // 发现实现，nil 时使用 discoverAndConnect
+
+	inFlight atomic.Int64 // 进行中的代理请求数，Stop 等待其完成后才关闭 Relay 连接
 }
 
 // NewLocalProxy 创建本地代理
@@ -34,14 +50,68 @@ func NewLocalProxy(cfg *config.ClientConfig) (*LocalProxy, error) {
 	proxy := &LocalProxy{
 		cfg:      cfg,
 		progress: NewConsoleProgress(),
+		cache:    newResponseCache(cfg.CacheTTL, defaultResponseCacheSize),
+	}
+
+	if cfg.SessionKey != "" {
+		sessions, err := NewSessionRouter(cfg.SessionKey)
+		if err != nil {
+			return nil, fmt.Errorf("解析会话粘性配置失败: %w", err)
+		}
+		sessions.SetLoadThreshold(cfg.ExitLoadThreshold)
+		proxy.sessions = sessions
+	}
+
+	if cfg.ExitLoadThreshold < 0 || cfg.ExitLoadThreshold > 100 {
+		return nil, fmt.Errorf("exit_load_threshold 应在 0-100 之间: %d", cfg.ExitLoadThreshold)
+	}
+
+	if cfg.ExitKeyTTL < 0 {
+		return nil, fmt.Errorf("exit_key_ttl 不能为负数: %v", cfg.ExitKeyTTL)
+	}
+
+	if cfg.HedgeAfter < 0 {
+		return nil, fmt.Errorf("hedge_after 不能为负数: %v", cfg.HedgeAfter)
+	}
+
+	if err := protocol.ValidateTenant(cfg.Tenant); err != nil {
+		return nil, fmt.Errorf("解析计费租户失败: %w", err)
+	}
+
+	if err := validateResponseModes(cfg.ResponseModes); err != nil {
+		return nil, fmt.Errorf("解析响应处理模式失败: %w", err)
+	}
+
+	if err := validateContentTypes(cfg.ContentTypes); err != nil {
+		return nil, fmt.Errorf("解析响应 Content-Type 配置失败: %w", err)
+	}
+
+	selector, err := loadbalancer.NewSelector(cfg.RelaySelector)
+	if err != nil {
+		return nil, fmt.Errorf("解析 Relay 选择策略失败: %w", err)
+	}
+	selector = withCircuitBreaker(selector, cfg.RelayCircuitBreaker)
+
+	addrFamily, err := netutil.ParseAddrFamily(cfg.AddressFamily)
+	if err != nil {
+		return nil, fmt.Errorf("解析地址族偏好失败: %w", err)
+	}
+
+	quicParams := cfg.QUIC.WithDefaults(config.DefaultQUICParams())
+	if err := quicParams.Validate(); err != nil {
+		return nil, err
 	}
 
 	// DHT 始终启用（私有网络）
 	dhtCfg := &dht.Config{
-		BootstrapPeers: cfg.BootstrapPeers, // 可选覆盖
-		ListenAddrs:    []string{"/ip4/0.0.0.0/tcp/0"},
-		Mode:           "client",
-		ServiceType:    "client",
+		BootstrapPeers:  cfg.BootstrapPeers, // 可选覆盖
+		ListenAddrs:     []string{"/ip4/0.0.0.0/tcp/0"},
+		Mode:            "client",
+		ServiceType:     "client",
+		ProviderTimeout: cfg.DHTProviderTimeout,
+		EnableMDNS:      cfg.EnableMDNS,
+		CacheFile:       cfg.PeerCacheFile,
+		NetworkID:       cfg.NetworkID,
 	}
 
 	dhtNode, err := dht.NewNode(dhtCfg)
@@ -56,6 +126,16 @@ func NewLocalProxy(cfg *config.ClientConfig) (*LocalProxy, error) {
 		proxy.dhtNode.Stop()
 		return nil, fmt.Errorf("创建客户端失败: %w", err)
 	}
+	client.SetSelector(selector)
+	client.SetAddressFamily(addrFamily)
+	client.SetQUICParams(quicParams)
+	client.SetMaxRetries(maxRetries(cfg.MaxRetries))
+	client.SetExitKeyEviction(cfg.ExitKeyTTL, exitKeyMaxFailures(cfg.ExitKeyMaxFailures))
+	client.SetHedgeAfter(cfg.HedgeAfter)
+	if err := client.SetCompression(cfg.Compression); err != nil {
+		proxy.dhtNode.Stop()
+		return nil, fmt.Errorf("解析压缩配置失败: %w", err)
+	}
 	proxy.client = client
 
 	return proxy, nil
@@ -85,18 +165,8 @@ func (p *LocalProxy) Start() error {
 
 	// 动态发现模式
 	if p.client.GetRelayAddr() == "" {
-		// 启动 DHT 节点
-		if p.dhtNode != nil {
-			p.progress.OnBootstrapConnecting()
-			if err := p.dhtNode.Start(ctx); err != nil {
-				return fmt.Errorf("启动 DHT 节点失败: %w", err)
-			}
-			p.progress.OnBootstrapConnected(1, 1) // 简化处理
-		}
-
-		// 动态发现并连接
-		if err := p.discoverAndConnect(ctx); err != nil {
-			log.Printf("警告: 节点发现失败: %v (将在首次请求时重试)", err)
+		if err := p.startDiscovery(ctx); err != nil {
+			return err
 		}
 	} else {
 		// 静态模式，直接连接
@@ -105,36 +175,102 @@ func (p *LocalProxy) Start() error {
 		} else {
 			log.Printf("已连接到 Relay: %s", p.client.GetRelayAddr())
 			log.Printf("Exit 公钥哈希: %s", p.client.GetExitPubKeyHash())
+			if err := p.RefreshExits(ctx); err != nil {
+				log.Printf("警告: 获取 Exit 列表失败: %v (按端点能力路由不可用)", err)
+			}
 		}
 	}
 
-	mux := http.NewServeMux()
-
-	// 统一路由：协议无关的透明转发
-	mux.HandleFunc("/", p.handleRequest)
+	p.client.StartIdlePing(p.cfg.IdlePing)
 
 	p.server = &http.Server{
 		Addr:         p.cfg.Listen,
-		Handler:      mux,
+		Handler:      p.Handler(),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 120 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
 
-	// 处理关闭信号
-	go p.handleShutdown()
-
 	p.progress.OnReady(p.cfg.Listen)
-	return p.server.ListenAndServe()
+	// Stop 触发的关闭属于正常退出
+	if err := p.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// SetBasePath 设置路由前缀，用于部署在按路径分发的反向代理之后
+func (p *LocalProxy) SetBasePath(prefix string) {
+	p.cfg.BasePath = prefix
+}
+
+// Handler 返回代理的 HTTP 处理器
+// 配置 BasePath 时仅处理该前缀下的请求，并在转发前剥离前缀
+func (p *LocalProxy) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	// 统一路由：协议无关的透明转发
+	prefix := strings.TrimRight(p.cfg.BasePath, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	mux.HandleFunc(prefix+TopologyPath, p.handleTopology)
+	if prefix == "" {
+		mux.HandleFunc("/", p.handleRequest)
+	} else {
+		mux.Handle(prefix+"/", http.StripPrefix(prefix, http.HandlerFunc(p.handleRequest)))
+	}
+	return p.trackInFlight(mux)
+}
+
+// trackInFlight 统计进行中的请求数
+func (p *LocalProxy) trackInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.inFlight.Add(1)
+		defer p.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startDiscovery 启动 DHT 节点并发现连接
+// DHT 启动失败时，若配置了 static_relay 则禁用 DHT 回退到静态 Relay，否则返回错误
+func (p *LocalProxy) startDiscovery(ctx context.Context) error {
+	if p.dhtNode != nil {
+		p.progress.OnBootstrapConnecting()
+		if err := p.dhtNode.Start(ctx); err != nil {
+			if p.cfg.StaticRelay == "" {
+				return fmt.Errorf("启动 DHT 节点失败: %w", err)
+			}
+			log.Printf("警告: 启动 DHT 节点失败: %v (禁用 DHT，回退到静态 Relay %s)", err, p.cfg.StaticRelay)
+			p.dhtNode.Stop()
+			p.dhtMu.Lock()
+			p.dhtNode = nil
+			p.dhtMu.Unlock()
+		} else {
+			p.progress.OnBootstrapConnected(1, 1) // 简化处理
+		}
+	}
+
+	// DHT 不可用时使用静态 Relay
+	if p.dhtNode == nil && p.cfg.StaticRelay != "" {
+		p.client.SetRelay(p.cfg.StaticRelay)
+	}
+
+	// 动态发现并连接
+	if err := p.discoverAndConnect(ctx); err != nil {
+		log.Printf("警告: 节点发现失败: %v (将在首次请求时重试)", err)
+	}
+	return nil
 }
 
 // discoverAndConnect 发现节点并连接
 // 新架构：先连接 Relay，再从 Relay 查询 Exit 公钥
 func (p *LocalProxy) discoverAndConnect(ctx context.Context) error {
-	// 1. 创建 Discovery 并持久化
-	if p.dhtNode != nil {
+	// 1. 创建 Discovery 并持久化 (重试时复用)
+	if p.dhtNode != nil && p.discovery == nil {
 		p.progress.OnDiscoveringRelays()
 		p.discovery = dht.NewDiscovery(p.dhtNode)
+		p.discovery.SetRelayProbe(p.client.probeRelay)
 		p.discovery.Start()
 		p.client.SetDiscovery(p.discovery)
 	}
@@ -146,13 +282,13 @@ func (p *LocalProxy) discoverAndConnect(ctx context.Context) error {
 	log.Printf("已连接到 Relay: %s", p.client.GetRelayAddr())
 
 	// 3. 从 Relay 查询 Exit 公钥
-	keyID, publicKey, err := p.discoverExit(ctx)
+	entry, err := p.discoverExit(ctx)
 	if err != nil {
 		return fmt.Errorf("发现 Exit 失败: %w", err)
 	}
 
 	// 4. 设置 Exit
-	if err := p.client.SetExit(keyID, publicKey); err != nil {
+	if err := p.client.SetExitEntry(entry); err != nil {
 		return fmt.Errorf("设置 Exit 失败: %w", err)
 	}
 	log.Printf("已选择 Exit 公钥哈希: %s", p.client.GetExitPubKeyHash())
@@ -160,29 +296,102 @@ func (p *LocalProxy) discoverAndConnect(ctx context.Context) error {
 	return nil
 }
 
-// discoverExit 从 Relay 查询 Exit 公钥
-func (p *LocalProxy) discoverExit(ctx context.Context) (keyID uint8, publicKey []byte, err error) {
+// refreshExitKey 缓存的 Exit 公钥被淘汰后，经现有 Relay 连接重新获取 Exit 列表和公钥
+func (p *LocalProxy) refreshExitKey(ctx context.Context) error {
+	entry, err := p.discoverExit(ctx)
+	if err != nil {
+		return fmt.Errorf("重新获取 Exit 公钥失败: %w", err)
+	}
+	if err := p.client.SetExitEntry(entry); err != nil {
+		return fmt.Errorf("设置 Exit 失败: %w", err)
+	}
+	log.Printf("已更新 Exit 公钥哈希: %s", p.client.GetExitPubKeyHash())
+	return nil
+}
+
+// ensureExit 确保已发现 Exit，启动时发现失败的情况下由首次请求触发
+// 并发请求只触发一次发现，结果由所有等待者共享
+func (p *LocalProxy) ensureExit(ctx context.Context) error {
+	if p.client.HasExit() {
+		return nil
+	}
+	discover := p.discoverFn
+	if discover == nil {
+		discover = p.discoverAndConnect
+		if p.client.exitKeyEvicted() {
+			discover = p.refreshExitKey
+		}
+	}
+	_, err, _ := p.discoverFlight.Do("discover", func() (any, error) {
+		if p.client.HasExit() {
+			return nil, nil
+		}
+		// 发现结果由所有等待者共享，不随首个请求取消而中断
+		dctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.getTimeout())
+		defer cancel()
+		return nil, discover(dctx)
+	})
+	return err
+}
+
+// cachedExits 返回磁盘节点缓存中的 Exit 公钥 (未启用 DHT 或未配置 peer_cache_file 时为空)
+func (p *LocalProxy) cachedExits() []protocol.ExitKeyEntry {
+	if p.discovery == nil {
+		return nil
+	}
+	return p.discovery.CachedExits()
+}
+
+// discoverExit 从 Relay 查询 Exit 公钥，返回选中的 Exit 条目
+func (p *LocalProxy) discoverExit(ctx context.Context) (protocol.ExitKeyEntry, error) {
 	p.progress.OnFetchingExitKeys()
 
-	// 从已连接的 Relay 查询 Exit 公钥列表
-	entries, queryErr := p.client.QueryExitKeys(ctx)
+	// 从已连接的 Relay 查询 Exit 公钥列表，并与其他已发现 Relay 上的 Exit 按公钥哈希合并
+	exits, current, queryErr := p.client.discoverExits(ctx)
+	entries := exitEntriesVia(exits, current)
+	if queryErr == nil && len(entries) == 0 {
+		queryErr = fmt.Errorf("Relay 没有已注册的 Exit 节点")
+	}
 	if queryErr != nil {
-		return 0, nil, fmt.Errorf("从 Relay 查询 Exit 公钥失败: %w", queryErr)
+		// 查询失败时回退到磁盘缓存中最近一次可用的 Exit 公钥
+		if entries = p.cachedExits(); len(entries) == 0 {
+			return protocol.ExitKeyEntry{}, fmt.Errorf("从 Relay 查询 Exit 公钥失败: %w", queryErr)
+		}
+		log.Printf("警告: 从 Relay 查询 Exit 公钥失败: %v (使用缓存的 %d 个 Exit)", queryErr, len(entries))
+	} else if p.discovery != nil {
+		// 缓存所有 Relay 上的 Exit，切换 Relay 后查询失败时仍可回退
+		p.discovery.SaveExits(exitEntriesVia(exits, ""))
 	}
 
-	if len(entries) == 0 {
-		return 0, nil, fmt.Errorf("Relay 没有已注册的 Exit 节点")
+	p.setExits(entries)
+	if p.sessions != nil {
+		p.sessions.SetExits(entries)
 	}
 
-	entry := entries[0]
-	kid, pubKey, decodeErr := crypto.DecodeKeyConfig(entry.KeyConfig)
-	if decodeErr != nil {
-		return 0, nil, fmt.Errorf("解析 Exit KeyConfig 失败: %w", decodeErr)
+	// 配置 exit_model 时只选择通告该模型的 Exit (其余 Exit 仍按请求的模型参与路由)
+	candidates := exitsForModel(entries, p.cfg.ExitModel)
+	if len(candidates) == 0 {
+		return protocol.ExitKeyEntry{}, fmt.Errorf("%w: %s", ErrNoModelExit, p.cfg.ExitModel)
 	}
 
-	p.progress.OnExitKeyFetched(entry.PubKeyHash)
-	log.Printf("从 Relay 获取 Exit 公钥 (KeyID: %d, Hash: %s)", kid, entry.PubKeyHash)
-	return kid, pubKey, nil
+	// 优先选择在线的 Exit (按通告权重加权)，宽限期内重连中的 Exit 作为兜底
+	// 公钥无法使用的 Exit 跳过，依次尝试其余 Exit
+	var lastErr error
+	for len(candidates) > 0 {
+		entry := pickExitEntry(candidates, p.cfg.ExitLoadThreshold)
+		kid, _, keyErr := usableExitKey(entry)
+		if keyErr == nil {
+			p.progress.OnExitKeyFetched(entry.PubKeyHash)
+			log.Printf("从 Relay 获取 Exit 公钥 (KeyID: %d, Hash: %s)", kid, entry.PubKeyHash)
+			return entry, nil
+		}
+		log.Printf("跳过公钥不可用的 Exit %s: %v", entry.PubKeyHash, keyErr)
+		lastErr = keyErr
+		candidates = slices.DeleteFunc(slices.Clone(candidates), func(e protocol.ExitKeyEntry) bool {
+			return e.PubKeyHash == entry.PubKeyHash
+		})
+	}
+	return protocol.ExitKeyEntry{}, fmt.Errorf("没有公钥可用的 Exit: %w", lastErr)
 }
 
 // handleRequest 统一请求处理 (协议无关)
@@ -193,37 +402,174 @@ func (p *LocalProxy) handleRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Body != nil {
 		body, err = io.ReadAll(r.Body)
 		if err != nil {
-			p.writeError(w, "读取请求失败", http.StatusBadRequest)
+			p.writeError(w, http.StatusBadRequest, openai.ErrorDetail{
+				Message: "读取请求失败",
+				Type:    errorTypeInvalidRequest,
+				Code:    "invalid_request_body",
+			})
 			return
 		}
 		defer r.Body.Close()
 	}
 
-	// 检测是否为流式请求
-	if detectStreaming(body, r) {
-		p.handleStreamingRequest(w, r, body)
+	// 校验 model 字段，避免将必然失败的请求转发到后端
+	if err := openai.ValidateModel(r.URL.Path, body); err != nil {
+		p.writeError(w, http.StatusBadRequest, openai.ModelRequiredError())
 		return
 	}
 
-	// 非流式: 收集 headers 并转发
-	headers := make(map[string]string)
-	for key := range r.Header {
-		headers[key] = r.Header.Get(key)
+	// 计费租户随协议消息头发送给 Relay
+	tenant := p.tenantFor(r)
+	if err := protocol.ValidateTenant(tenant); err != nil {
+		p.writeError(w, http.StatusBadRequest, openai.ErrorDetail{
+			Message: err.Error(),
+			Type:    errorTypeInvalidRequest,
+			Code:    "invalid_tenant",
+		})
+		return
+	}
+	r = r.WithContext(withTenant(r.Context(), tenant))
+
+	// 检测是否为流式请求，流式请求不使用缓存
+	clientStreaming := detectStreaming(body, r)
+	var key string
+	if !clientStreaming {
+		key = cacheKey(r, tenant)
+	}
+	if cached, ok := p.cache.Get(key); ok {
+		p.writeBufferedResponse(w, r, cached.status, cached.header, cached.body, false)
+		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), p.getTimeout())
+	if err := p.ensureExit(r.Context()); err != nil {
+		log.Printf("节点发现失败: %v", err)
+		p.writeGatewayError(w, err)
+		return
+	}
+
+	// 选择目标 Exit: 会话粘性 + 端点能力 + 模型
+	target, err := p.routeExit(r, body)
+	if err != nil {
+		detail := openai.ErrorDetail{
+			Message: fmt.Sprintf("%v: %s", err, r.URL.Path),
+			Type:    errorTypeGateway,
+			Code:    "exit_capability_unavailable",
+		}
+		if errors.Is(err, ErrNoModelExit) {
+			detail.Message, detail.Code = err.Error(), "exit_model_unavailable"
+		}
+		p.writeError(w, http.StatusServiceUnavailable, detail)
+		return
+	}
+
+	// 按路径配置决定内部是否流式传输
+	if p.streamInternally(r.URL.Path, clientStreaming) {
+		p.handleStreamingRequest(w, r, body, target, clientStreaming)
+		return
+	}
+
+	// 非流式: 整体转发，响应 Content-Type 沿用 Exit 返回的值
+	ctx, cancel := context.WithTimeout(r.Context(), p.requestTimeout(target))
 	defer cancel()
 
-	respBody, statusCode, err := p.client.SendRequestRaw(ctx, r.Method, r.URL.Path, body, headers)
+	httpReq, err := newBackendRequest(ctx, r, body)
+	if err != nil {
+		p.writeError(w, http.StatusBadRequest, openai.ErrorDetail{
+			Message: "创建请求失败",
+			Type:    errorTypeInvalidRequest,
+			Code:    "invalid_request",
+		})
+		return
+	}
+
+	// 目标 Exit 不可用时换其他 Exit 重试 (受 max_exit_attempts 限制)
+	var resp *http.Response
+	err = p.withExitFallback(r, target, func(target *ExitTarget) error {
+		if err := rewindBody(httpReq); err != nil {
+			return err
+		}
+		var err error
+		resp, err = p.client.SendRequestTo(ctx, target, httpReq)
+		return err
+	})
+	var respBody []byte
+	if err == nil {
+		defer resp.Body.Close()
+		respBody, err = io.ReadAll(resp.Body)
+		if err != nil {
+			err = fmt.Errorf("读取响应体失败: %w", err)
+		}
+	}
 	if err != nil {
 		log.Printf("请求失败: %v", err)
-		p.writeError(w, "请求转发失败", http.StatusBadGateway)
+		p.writeGatewayError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	w.Write(respBody)
+	if storable(r, resp.Header) {
+		p.cache.Put(key, resp.StatusCode, resp.Header, respBody)
+	}
+	p.writeBufferedResponse(w, r, resp.StatusCode, resp.Header, respBody, clientStreaming)
+}
+
+// writeBufferedResponse 写回整体缓冲的后端响应 (含缓存命中的响应)
+func (p *LocalProxy) writeBufferedResponse(w http.ResponseWriter, r *http.Request, status int, header http.Header, body []byte, clientStreaming bool) {
+	// 透传后端响应头 (限流 x-ratelimit-*、Retry-After、请求 ID 等)
+	copyResponseHeaders(w.Header(), header)
+	if clientStreaming && status == http.StatusOK {
+		// 流式请求被整体缓冲时，响应体仍是完整的 SSE 事件序列
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "text/event-stream")
+		}
+	} else {
+		// 后端未声明时按 JSON 返回
+		w.Header().Set("Content-Type", p.responseContentType(r.URL.Path, header, "application/json"))
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// unforwardedResponseHeaders 不透传给调用方的响应头: hop-by-hop 头及由本地 HTTP 服务重新计算的头
+var unforwardedResponseHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Length":      true,
+}
+
+// copyResponseHeaders 将 Exit 返回的响应头复制到本地响应，跳过不应透传的头
+func copyResponseHeaders(dst, src http.Header) {
+	for key, values := range src {
+		if unforwardedResponseHeaders[http.CanonicalHeaderKey(key)] {
+			continue
+		}
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+}
+
+// newBackendRequest 构建发往 Exit 的内层请求，使用原始路径和 headers 透明转发
+func newBackendRequest(ctx context.Context, r *http.Request, body []byte) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, r.Method, "http://ai-backend"+r.URL.Path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range r.Header {
+		if key == http.CanonicalHeaderKey(TenantHeader) {
+			continue // 租户标识只交给 Relay
+		}
+		for _, value := range values {
+			httpReq.Header.Add(key, value)
+		}
+	}
+	httpReq.ContentLength = int64(len(body))
+	return httpReq, nil
 }
 
 // detectStreaming 协议无关的流式请求检测
@@ -252,59 +598,116 @@ func detectStreaming(body []byte, r *http.Request) bool {
 }
 
 // handleStreamingRequest 处理流式请求
-func (p *LocalProxy) handleStreamingRequest(w http.ResponseWriter, r *http.Request, body []byte) {
+// target 为 nil 时使用当前 Exit；sse 为 false 时客户端请求的是非流式响应，内部流式接收后按原格式边收边写
+func (p *LocalProxy) handleStreamingRequest(w http.ResponseWriter, r *http.Request, body []byte, target *ExitTarget, sse bool) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		p.writeError(w, "Streaming not supported", http.StatusInternalServerError)
+		p.writeError(w, http.StatusInternalServerError, openai.ErrorDetail{
+			Message: "Streaming not supported",
+			Type:    errorTypeGateway,
+			Code:    "streaming_unsupported",
+		})
 		return
 	}
 
-	// 构建 HTTP 请求，使用原始路径透明转发
-	httpReq, err := http.NewRequestWithContext(r.Context(), r.Method, "http://ai-backend"+r.URL.Path, bytes.NewReader(body))
+	httpReq, err := newBackendRequest(r.Context(), r, body)
 	if err != nil {
-		p.writeError(w, "创建请求失败", http.StatusInternalServerError)
+		p.writeError(w, http.StatusBadRequest, openai.ErrorDetail{
+			Message: "创建请求失败",
+			Type:    errorTypeInvalidRequest,
+			Code:    "invalid_request",
+		})
 		return
 	}
 
-	// 复制原始请求的 headers
-	for key, values := range r.Header {
-		for _, value := range values {
-			httpReq.Header.Add(key, value)
+	// 发送流式请求，先读取首个块再写响应头，使 Relay/Exit 的错误能以正确的状态码返回
+	// 首个块之前尚未向客户端写出任何数据，Relay 失败时可换 Relay 重试
+	// 目标 Exit 不可用时换其他 Exit 重试 (受 max_exit_attempts 限制)
+	var streamResp *StreamResponse
+	var chunk []byte
+	var firstErr error // 首个块的读取结果，io.EOF 表示流立即结束
+	err = p.withExitFallback(r, target, func(target *ExitTarget) error {
+		if err := rewindBody(httpReq); err != nil {
+			return err
 		}
-	}
-	httpReq.ContentLength = int64(len(body))
-
-	// 发送流式请求
-	streamResp, err := p.client.SendStreamRequest(r.Context(), httpReq)
+		streamResp, chunk, firstErr = p.client.OpenStream(r.Context(), target, httpReq)
+		if firstErr == io.EOF {
+			return nil
+		}
+		return firstErr
+	})
 	if err != nil {
 		log.Printf("流式请求失败: %v", err)
-		p.writeError(w, "AI 服务请求失败", http.StatusBadGateway)
+		p.writeGatewayError(w, err)
 		return
 	}
 	defer streamResp.Close()
-
-	// 设置 SSE 响应头
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.WriteHeader(http.StatusOK)
+	err = firstErr
+
+	// 透传后端响应头 (旧版 Exit 不返回流式响应头时为空)
+	copyResponseHeaders(w.Header(), streamResp.Header)
+	if streamResp.StatusCode != http.StatusOK {
+		// 后端的错误响应 (如 400、带 Retry-After 的 429) 原样返回，Content-Type 沿用后端的
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+	} else if sse {
+		// 设置 SSE 响应头
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+	} else {
+		w.Header().Set("Content-Type", p.responseContentType(r.URL.Path, streamResp.Header, "application/json"))
+	}
+	w.WriteHeader(streamResp.StatusCode)
 	flusher.Flush()
 
 	// 逐块读取并转发
-	for {
-		chunk, err := streamResp.ReadChunk()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Printf("读取流式块失败: %v", err)
-			break
-		}
-		if _, err := w.Write(chunk); err != nil {
-			log.Printf("写入流式响应失败: %v", err)
-			break
+	for err == nil {
+		if _, werr := w.Write(chunk); werr != nil {
+			log.Printf("写入流式响应失败: %v", werr)
+			return
 		}
 		flusher.Flush()
+
+		chunk, err = streamResp.ReadChunk()
+	}
+	if err != io.EOF {
+		log.Printf("读取流式块失败: %v", err)
+	}
+}
+
+// reportExitFailure Exit 失效时通知会话路由，后续同会话请求迁移到其他 Exit
+func (p *LocalProxy) reportExitFailure(target *ExitTarget, err error) {
+	if p.sessions != nil && target != nil && isExitFailure(err) {
+		p.sessions.ReportFailure(target.PubKeyHash)
+	}
+}
+
+// defaultCircuitCooldown 未配置 relay_circuit_breaker.cooldown 时的熔断时长
+const defaultCircuitCooldown = 30 * time.Second
+
+// withCircuitBreaker 配置了熔断阈值时用熔断选择器包装 Relay 选择器
+func withCircuitBreaker(selector loadbalancer.Selector, cb config.CircuitBreaker) loadbalancer.Selector {
+	if cb.Threshold <= 0 {
+		return selector
+	}
+	cooldown := cb.Cooldown
+	if cooldown == 0 {
+		cooldown = defaultCircuitCooldown
+	}
+	return loadbalancer.NewCircuitBreakerSelector(selector, cb.Threshold, cb.Window, cooldown)
+}
+
+// maxRetries 解析配置的重试次数: 0 使用默认值，负数禁用重试
+func maxRetries(n int) int {
+	switch {
+	case n == 0:
+		return DefaultMaxRetries
+	case n < 0:
+		return 0
+	default:
+		return n
 	}
 }
 
@@ -316,33 +719,54 @@ func (p *LocalProxy) getTimeout() time.Duration {
 	return 30 * time.Second
 }
 
-// writeError 写入通用错误响应
-func (p *LocalProxy) writeError(w http.ResponseWriter, message string, status int) {
-	resp := map[string]interface{}{
-		"error": map[string]interface{}{
-			"message": message,
-			"type":    "api_error",
-			"code":    fmt.Sprintf("%d", status),
-		},
+// Exit 通告的推荐请求超时的合理范围，避免异常通告导致请求立即超时或长期挂起
+const (
+	minExitRequestTimeout = 5 * time.Second
+	maxExitRequestTimeout = 10 * time.Minute
+)
+
+// requestTimeout 返回发往目标 Exit 的请求超时 (target 为 nil 时为当前 Exit)
+// Exit 通告了推荐超时时使用该值 (限制在合理范围内)，否则使用全局 Timeout
+func (p *LocalProxy) requestTimeout(target *ExitTarget) time.Duration {
+	if target == nil {
+		target = p.knownExit(p.client.GetExitPubKeyHash())
+	}
+	if target == nil || target.RequestTimeout <= 0 {
+		return p.getTimeout()
 	}
+	return min(max(target.RequestTimeout, minExitRequestTimeout), maxExitRequestTimeout)
+}
 
+// writeError 写入 OpenAI 风格的错误响应
+func (p *LocalProxy) writeError(w http.ResponseWriter, status int, detail openai.ErrorDetail) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(resp)
+	json.NewEncoder(w).Encode(openai.ErrorResponse{Error: detail})
 }
 
-// handleShutdown 处理优雅关闭
-func (p *LocalProxy) handleShutdown() {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	<-sigChan
-	log.Println("收到关闭信号，正在关闭...")
-	p.Stop()
+// writeGatewayError 将网关内部错误映射为 OpenAI 错误对象后写入
+func (p *LocalProxy) writeGatewayError(w http.ResponseWriter, err error) {
+	status, detail := toOpenAIError(err)
+	p.writeError(w, status, detail)
 }
 
 // Stop 停止代理服务器
+// 先停止 HTTP 服务器并等待进行中的请求完成 (最多 30s)，再关闭 Relay 连接，
+// 避免正在转发的请求因连接关闭而返回 502
 func (p *LocalProxy) Stop() error {
+	var err error
+	if p.server != nil {
+		if n := p.inFlight.Load(); n > 0 {
+			log.Printf("正在关闭本地代理, 等待 %d 个进行中的请求完成...", n)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = p.server.Shutdown(ctx)
+		cancel()
+		if n := p.inFlight.Load(); n > 0 {
+			log.Printf("警告: 关闭本地代理时仍有 %d 个请求未完成: %v", n, err)
+		}
+	}
+
 	// 停止 Discovery（在关闭 Client 前）
 	if p.discovery != nil {
 		p.discovery.Stop()
@@ -357,12 +781,16 @@ func (p *LocalProxy) Stop() error {
 	if p.dhtNode != nil {
 		p.dhtNode.Stop()
 	}
+	return err
+}
 
-	// 停止 HTTP 服务器
-	if p.server != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		return p.server.Shutdown(ctx)
+// RoutingTableReport 返回 DHT 路由表快照，静态模式 (无 DHT) 或未启动时返回 nil
+func (p *LocalProxy) RoutingTableReport(sample int) *dht.RoutingTableReport {
+	p.dhtMu.Lock()
+	node := p.dhtNode
+	p.dhtMu.Unlock()
+	if node == nil {
+		return nil
 	}
-	return nil
+	return node.RoutingTableReport(sample)
 }
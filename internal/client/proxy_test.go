@@ -1,10 +1,75 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/dht"
+	"github.com/binn/tokengo/internal/loadbalancer"
+	"github.com/binn/tokengo/pkg/openai"
+	"github.com/libp2p/go-libp2p/core/peer"
 )
 
+// newFailingDHTProxy 创建 DHT 节点必定启动失败 (非法监听地址) 的代理
+func newFailingDHTProxy(t *testing.T, cfg *config.ClientConfig) *LocalProxy {
+	t.Helper()
+	node, err := dht.NewNode(&dht.Config{
+		ListenAddrs: []string{"not-a-multiaddr"},
+		Mode:        "client",
+		ServiceType: "client",
+	})
+	if err != nil {
+		t.Fatalf("NewNode failed: %v", err)
+	}
+	c, _ := NewClientDynamic()
+	p := &LocalProxy{cfg: cfg, client: c, dhtNode: node, progress: NewSilentProgress()}
+	t.Cleanup(func() { p.Stop() })
+	return p
+}
+
+func TestLocalProxy_StartDiscovery_DHTFailsWithoutFallback(t *testing.T) {
+	p := newFailingDHTProxy(t, &config.ClientConfig{})
+
+	err := p.startDiscovery(context.Background())
+	if err == nil {
+		t.Fatal("expected error when DHT is the only discovery source")
+	}
+	if !strings.Contains(err.Error(), "启动 DHT 节点失败") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLocalProxy_StartDiscovery_DHTFailsWithStaticRelay(t *testing.T) {
+	p := newFailingDHTProxy(t, &config.ClientConfig{StaticRelay: "127.0.0.1:1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	if err := p.startDiscovery(ctx); err != nil {
+		t.Fatalf("DHT failure should be non-fatal with static relay, got: %v", err)
+	}
+	if p.dhtNode != nil {
+		t.Error("DHT node should be disabled after start failure")
+	}
+	if got := p.client.GetRelayAddr(); got != "127.0.0.1:1" {
+		t.Errorf("relay addr = %q, want static relay 127.0.0.1:1", got)
+	}
+}
+
 func TestDetectStreaming(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -84,3 +149,455 @@ func TestDetectStreaming(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleRequest_ModelRequired(t *testing.T) {
+	// Relay 地址不可达: 校验失败的请求不应发起任何连接
+	p, err := NewStaticProxy("127.0.0.1:0", "127.0.0.1:1", 1, make([]byte, 32))
+	if err != nil {
+		t.Fatalf("NewStaticProxy failed: %v", err)
+	}
+	t.Cleanup(func() { p.Stop() })
+
+	bodies := map[string]string{
+		"empty":      `{"model":"","messages":[{"role":"user","content":"hi"}]}`,
+		"missing":    `{"messages":[{"role":"user","content":"hi"}]}`,
+		"whitespace": `{"model":"   ","messages":[{"role":"user","content":"hi"}],"stream":true}`,
+	}
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			p.handleRequest(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("StatusCode = %d, want 400", rec.Code)
+			}
+			var resp openai.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode error response: %v", err)
+			}
+			if resp.Error.Message != "model is required" || resp.Error.Code != "model_required" {
+				t.Errorf("error = %+v, want model is required", resp.Error)
+			}
+		})
+	}
+}
+
+func TestHandleRequest_ConcurrentFirstRequestsShareDiscovery(t *testing.T) {
+	c, _ := NewClientDynamic()
+	p := &LocalProxy{cfg: &config.ClientConfig{}, client: c, progress: NewSilentProgress()}
+	t.Cleanup(func() { p.Stop() })
+
+	var calls atomic.Int32
+	p.discoverFn = func(ctx context.Context) error {
+		calls.Add(1)
+		time.Sleep(100 * time.Millisecond) // 保证其余请求在发现进行中到达
+		return errors.New("no relay found")
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	codes := make([]int, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"test"}`))
+			rec := httptest.NewRecorder()
+			p.handleRequest(rec, req)
+			codes[i] = rec.Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("discovery runs = %d, want 1", got)
+	}
+	for i, code := range codes {
+		if code != http.StatusBadGateway {
+			t.Errorf("request %d: StatusCode = %d, want 502", i, code)
+		}
+	}
+
+	// 失败结果不缓存，后续请求重新触发发现
+	if err := p.ensureExit(context.Background()); err == nil {
+		t.Error("ensureExit should fail again")
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("discovery runs after retry = %d, want 2", got)
+	}
+}
+
+func TestCopyResponseHeaders(t *testing.T) {
+	src := http.Header{}
+	src.Set("Content-Type", "application/json")
+	src.Set("X-Request-Id", "req-123")
+	src.Add("X-Ratelimit-Remaining-Requests", "42")
+	src.Set("Retry-After", "7")
+	src.Add("Set-Cookie", "a=1")
+	src.Add("Set-Cookie", "b=2")
+	src.Set("Connection", "keep-alive")
+	src.Set("Transfer-Encoding", "chunked")
+	src.Set("Content-Length", "999")
+
+	dst := http.Header{}
+	copyResponseHeaders(dst, src)
+
+	for _, key := range []string{"Content-Type", "X-Request-Id", "X-Ratelimit-Remaining-Requests", "Retry-After"} {
+		if dst.Get(key) != src.Get(key) {
+			t.Errorf("%s = %q, want %q", key, dst.Get(key), src.Get(key))
+		}
+	}
+	if len(dst.Values("Set-Cookie")) != 2 {
+		t.Errorf("Set-Cookie = %v, want both values", dst.Values("Set-Cookie"))
+	}
+	for _, key := range []string{"Connection", "Transfer-Encoding", "Content-Length"} {
+		if dst.Get(key) != "" {
+			t.Errorf("%s should not be forwarded", key)
+		}
+	}
+}
+
+// newBackendProxy 创建经测试 Relay 和本地 Exit 把请求转发给 backend 的代理
+func newBackendProxy(t *testing.T, cfg *config.ClientConfig, backend http.HandlerFunc) *LocalProxy {
+	t.Helper()
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	relay, _ := startTestRelay(t, serveWithBackend(t, kp, backend))
+	c, _ := newFailoverClient(t, kp, relay)
+	return &LocalProxy{cfg: cfg, client: c, progress: NewSilentProgress()}
+}
+
+// pngBytes 最小的 PNG 文件头，模拟图片生成接口返回的二进制响应
+var pngBytes = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestHandleRequest_ForwardsUpstreamContentType(t *testing.T) {
+	imageBackend := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("X-Request-Id", "img-1")
+		w.Write(pngBytes)
+	}
+
+	tests := []struct {
+		name  string
+		modes map[string]string
+	}{
+		{"buffered", nil},
+		{"streamed internally", map[string]string{"/v1/images/*": ResponseModeStream}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newBackendProxy(t, &config.ClientConfig{ResponseModes: tt.modes}, imageBackend)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/images/generations", strings.NewReader(`{"model":"img","prompt":"cat"}`))
+			w := httptest.NewRecorder()
+			p.handleRequest(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+				t.Errorf("Content-Type = %q, want image/png", ct)
+			}
+			if got := w.Header().Get("X-Request-Id"); got != "img-1" {
+				t.Errorf("X-Request-Id = %q, want img-1", got)
+			}
+			if !bytes.Equal(w.Body.Bytes(), pngBytes) {
+				t.Errorf("body = %q, want PNG bytes", w.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestHandleRequest_StreamedBackendErrorPassesThrough(t *testing.T) {
+	const errBody = `{"error":{"message":"model not found","type":"invalid_request_error"}}`
+	tests := []struct {
+		name   string
+		status int
+		modes  map[string]string
+		body   string
+	}{
+		{"forced stream mode 400", http.StatusBadRequest, map[string]string{"/v1/chat/*": ResponseModeStream}, `{"model":"nope"}`},
+		{"sse request 429", http.StatusTooManyRequests, nil, `{"model":"gpt-4o","stream":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newBackendProxy(t, &config.ClientConfig{ResponseModes: tt.modes}, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", "7")
+				w.WriteHeader(tt.status)
+				io.WriteString(w, errBody)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			p.handleRequest(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want the backend's %d (body %s)", w.Code, tt.status, w.Body.String())
+			}
+			if got := w.Body.String(); got != errBody {
+				t.Errorf("body = %s, want the backend body unchanged", got)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q", got)
+			}
+			if got := w.Header().Get("Retry-After"); got != "7" {
+				t.Errorf("Retry-After = %q, want 7", got)
+			}
+		})
+	}
+}
+
+func TestHandleRequest_ContentTypeOverride(t *testing.T) {
+	// 后端声明了不准确的类型，按路径固定为 audio/mpeg
+	backend := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("ID3"))
+	}
+	for _, mode := range []string{ResponseModeBuffer, ResponseModeStream} {
+		t.Run(mode, func(t *testing.T) {
+			p := newBackendProxy(t, &config.ClientConfig{
+				ResponseModes: map[string]string{"/v1/audio/speech": mode},
+				ContentTypes:  map[string]string{"/v1/audio/*": "audio/mpeg"},
+			}, backend)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/audio/speech", strings.NewReader(`{"model":"tts","input":"hi"}`))
+			w := httptest.NewRecorder()
+			p.handleRequest(w, req)
+
+			if ct := w.Header().Get("Content-Type"); ct != "audio/mpeg" {
+				t.Errorf("Content-Type = %q, want audio/mpeg", ct)
+			}
+		})
+	}
+}
+
+func TestValidateContentTypes(t *testing.T) {
+	if err := validateContentTypes(map[string]string{"/v1/audio/*": "audio/mpeg"}); err != nil {
+		t.Errorf("valid content type rejected: %v", err)
+	}
+	if err := validateContentTypes(map[string]string{"/v1/audio/*": "not a type"}); err == nil {
+		t.Error("expected invalid content type to be rejected")
+	}
+}
+
+func TestHandleRequest_CachesGETResponses(t *testing.T) {
+	var hits atomic.Int32
+	p := newBackendProxy(t, &config.ClientConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":[{"id":"m1"}]}`))
+	})
+	now := time.Now()
+	p.cache = newResponseCache(time.Minute, defaultResponseCacheSize)
+	p.cache.now = func() time.Time { return now }
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		p.handleRequest(w, req)
+		return w
+	}
+
+	first := get(nil)
+	second := get(nil)
+	if hits.Load() != 1 {
+		t.Fatalf("backend hits = %d, want 1 (second request served from cache)", hits.Load())
+	}
+	if second.Code != http.StatusOK || second.Body.String() != first.Body.String() {
+		t.Errorf("cached response = %d %q, want %d %q", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+	if ct := second.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("cached Content-Type = %q, want application/json", ct)
+	}
+
+	// 流式请求不使用缓存
+	get(http.Header{"Accept": {"text/event-stream"}})
+	if hits.Load() != 2 {
+		t.Errorf("backend hits = %d, streaming GET should bypass the cache", hits.Load())
+	}
+
+	// 过期后重新请求后端
+	now = now.Add(2 * time.Minute)
+	get(nil)
+	if hits.Load() != 3 {
+		t.Errorf("backend hits = %d, expired entry should be refetched", hits.Load())
+	}
+}
+
+func TestHandleRequest_DoesNotCachePOST(t *testing.T) {
+	var hits atomic.Int32
+	p := newBackendProxy(t, &config.ClientConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"ok"}`))
+	})
+	p.cache = newResponseCache(time.Minute, defaultResponseCacheSize)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+		p.handleRequest(httptest.NewRecorder(), req)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("backend hits = %d, POST requests must not be cached", hits.Load())
+	}
+}
+
+func TestHandleRequest_CacheSeparatesTenantsAndQueries(t *testing.T) {
+	var hits atomic.Int32
+	p := newBackendProxy(t, &config.ClientConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"hit":%d}`, n)
+	})
+	p.cache = newResponseCache(time.Minute, defaultResponseCacheSize)
+
+	get := func(target, tenant string) string {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if tenant != "" {
+			req.Header.Set(TenantHeader, tenant)
+		}
+		w := httptest.NewRecorder()
+		p.handleRequest(w, req)
+		return w.Body.String()
+	}
+
+	teamA := get("/v1/models", "team-a")
+	if teamB := get("/v1/models", "team-b"); teamB == teamA {
+		t.Errorf("tenant team-b got team-a's cached response %s", teamB)
+	}
+	if again := get("/v1/models", "team-a"); again != teamA {
+		t.Errorf("team-a response = %s, want its cached %s", again, teamA)
+	}
+	if other := get("/v1/models?limit=1", "team-a"); other == teamA {
+		t.Error("different query string should not share a cache entry")
+	}
+	if hits.Load() != 3 {
+		t.Errorf("backend hits = %d, want 3", hits.Load())
+	}
+}
+
+func TestHandleRequest_CacheSkipsAuthorizedUnlessPublic(t *testing.T) {
+	var hits atomic.Int32
+	var public atomic.Bool
+	p := newBackendProxy(t, &config.ClientConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if public.Load() {
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":[]}`))
+	})
+	p.cache = newResponseCache(time.Minute, defaultResponseCacheSize)
+
+	get := func(apiKey string) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		p.handleRequest(httptest.NewRecorder(), req)
+	}
+
+	get("sk-a")
+	get("sk-b")
+	if hits.Load() != 2 {
+		t.Fatalf("backend hits = %d, authorized responses must not be shared", hits.Load())
+	}
+
+	public.Store(true)
+	get("sk-a")
+	get("sk-b")
+	if hits.Load() != 3 {
+		t.Errorf("backend hits = %d, public response should be cached", hits.Load())
+	}
+}
+
+func TestLocalProxy_StopDrainsInFlightRequest(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	var hits atomic.Int32
+	var cancelled atomic.Bool
+	relay, _ := startTestRelay(t, stallingRelay(300*time.Millisecond, serveWithBackend(t, kp, backendReply(`{"id":"ok"}`, &hits)), &cancelled))
+	c, _ := newFailoverClient(t, kp, relay)
+	p := &LocalProxy{cfg: &config.ClientConfig{}, client: c, progress: NewSilentProgress()}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	p.server = &http.Server{Handler: p.Handler()}
+	go p.server.Serve(ln)
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := http.Post("http://"+ln.Addr().String()+"/v1/chat/completions", "application/json", strings.NewReader(`{"model":"m"}`))
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		done <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	// 请求进入处理器后立即停止代理
+	deadline := time.Now().Add(5 * time.Second)
+	for p.inFlight.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if p.inFlight.Load() == 0 {
+		t.Fatal("request did not reach the proxy")
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	r := <-done
+	if r.err != nil || r.status != http.StatusOK || r.body != `{"id":"ok"}` {
+		t.Errorf("in-flight request = %d %q, %v; want 200 from the backend", r.status, r.body, r.err)
+	}
+	if cancelled.Load() {
+		t.Error("in-flight request was cancelled by Stop")
+	}
+	c.connMu.Lock()
+	conn := c.conn
+	c.connMu.Unlock()
+	if conn != nil {
+		t.Error("relay connection should be closed after Stop")
+	}
+}
+
+func TestWithCircuitBreaker(t *testing.T) {
+	inner := &orderedSelector{failures: make(map[peer.ID]int)}
+	if got := withCircuitBreaker(inner, config.CircuitBreaker{}); got != inner {
+		t.Fatalf("selector without threshold = %T, want the inner selector", got)
+	}
+
+	selector := withCircuitBreaker(inner, config.CircuitBreaker{Threshold: 1})
+	if _, ok := selector.(*loadbalancer.CircuitBreakerSelector); !ok {
+		t.Fatalf("selector = %T, want *loadbalancer.CircuitBreakerSelector", selector)
+	}
+	failing, healthy := peer.AddrInfo{ID: "relay-a"}, peer.AddrInfo{ID: "relay-b"}
+	selector.ReportFailure(failing.ID)
+	selected, err := selector.Select(context.Background(), []peer.AddrInfo{failing, healthy})
+	if err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+	if selected.ID != healthy.ID {
+		t.Errorf("selected %s, want the open relay skipped", selected.ID)
+	}
+	if got := inner.Failures(failing.ID); got != 1 {
+		t.Errorf("inner failures = %d, want the report forwarded", got)
+	}
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/quic-go/quic-go"
+)
+
+// relayConn 带引用计数的 Relay 连接，多个并发请求共享同一条 QUIC 连接
+// 请求在使用期间持有引用；重连只将旧连接标记为退役，最后一个引用释放后才关闭，
+// 避免重连中断其上仍在进行的请求
+type relayConn struct {
+	quic.Connection
+
+	mu      sync.Mutex
+	refs    int
+	retired bool
+	reason  string // 退役原因，关闭连接时发送给 Relay
+}
+
+func newRelayConn(conn quic.Connection) *relayConn {
+	return &relayConn{Connection: conn}
+}
+
+// early 返回以 0-RTT 拨号的底层连接，用于在 0-RTT 被拒绝后换用握手完成的连接
+func (rc *relayConn) early() (quic.EarlyConnection, bool) {
+	early, ok := rc.Connection.(quic.EarlyConnection)
+	return early, ok
+}
+
+// acquire 增加一个引用 (调用者需在使用结束后 release)
+func (rc *relayConn) acquire() {
+	rc.mu.Lock()
+	rc.refs++
+	rc.mu.Unlock()
+}
+
+// release 释放一个引用，连接已退役且没有其他引用时关闭
+func (rc *relayConn) release() {
+	rc.mu.Lock()
+	rc.refs--
+	closeNow := rc.retired && rc.refs == 0
+	rc.mu.Unlock()
+	if closeNow {
+		rc.CloseWithError(0, rc.reason)
+	}
+}
+
+// retire 标记连接退役: 不再分配给新请求，没有引用时立即关闭，否则等最后一个引用释放后关闭
+func (rc *relayConn) retire(reason string) {
+	rc.mu.Lock()
+	if rc.retired {
+		rc.mu.Unlock()
+		return
+	}
+	rc.retired, rc.reason = true, reason
+	closeNow := rc.refs == 0
+	rc.mu.Unlock()
+	if closeNow {
+		rc.CloseWithError(0, reason)
+	}
+}
@@ -0,0 +1,249 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/binn/tokengo/internal/testutil"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/quic-go/quic-go"
+)
+
+func TestRelayConn_RetireWaitsForLastRelease(t *testing.T) {
+	mock := testutil.NewMockConn(1)
+	rc := newRelayConn(mock)
+	rc.acquire()
+	rc.acquire()
+
+	rc.retire("reconnecting")
+	if mock.CloseCalls.Load() != 0 {
+		t.Fatal("retired connection closed while requests still hold it")
+	}
+	rc.release()
+	if mock.CloseCalls.Load() != 0 {
+		t.Fatal("retired connection closed before the last release")
+	}
+	rc.release()
+	if mock.CloseCalls.Load() != 1 {
+		t.Errorf("close calls after last release = %d, want 1", mock.CloseCalls.Load())
+	}
+
+	// 重复退役不会再次关闭
+	rc.retire("reconnecting")
+	if mock.CloseCalls.Load() != 1 {
+		t.Errorf("close calls after second retire = %d, want 1", mock.CloseCalls.Load())
+	}
+}
+
+func TestRelayConn_RetireIdleClosesImmediately(t *testing.T) {
+	mock := testutil.NewMockConn(1)
+	rc := newRelayConn(mock)
+	rc.acquire()
+	rc.release()
+	if mock.CloseCalls.Load() != 0 {
+		t.Fatal("active connection closed on release")
+	}
+	rc.retire("reconnecting")
+	if mock.CloseCalls.Load() != 1 {
+		t.Errorf("close calls = %d, want 1", mock.CloseCalls.Load())
+	}
+}
+
+func TestClient_ReconnectKeepsInFlightRequests(t *testing.T) {
+	const n = 50
+	kp, _ := crypto.GenerateKeyPair()
+	serve := serveWithExit(t, kp)
+	release := make(chan struct{})
+	relay, requests := startTestRelay(t, func(stream quic.Stream, msg *protocol.Message) {
+		<-release // 所有请求都在旧连接上等待，直到重连完成
+		serve(stream, msg)
+	})
+	c, _ := newFailoverClient(t, kp, relay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	c.connMu.Lock()
+	old := c.conn
+	c.connMu.Unlock()
+
+	// 非幂等请求和流式请求在发送后都不会重试，任何失败都会直接暴露
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				body, status, _, err := c.SendRequestRaw(ctx, http.MethodPost, "/v1/models", nil, nil)
+				if err == nil && (status != http.StatusOK || string(body) == "") {
+					err = fmt.Errorf("unexpected response %d %q", status, body)
+				}
+				errs <- err
+				return
+			}
+			req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://ai-backend/v1/chat/completions", nil)
+			resp, err := c.SendStreamRequest(ctx, req)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer resp.Close()
+			for {
+				if _, err := resp.ReadChunk(); err != nil {
+					if err != io.EOF {
+						errs <- err
+						return
+					}
+					break
+				}
+			}
+			errs <- nil
+		}(i)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for requests.Load() < n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := requests.Load(); got != n {
+		t.Fatalf("relay received %d requests, want %d", got, n)
+	}
+
+	// 请求进行中强制重连: 旧连接只退役，不中断其上的请求
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+	if old.Context().Err() != nil {
+		t.Fatal("reconnect closed the connection while requests were in flight")
+	}
+	close(release)
+
+	wg.Wait()
+	close(errs)
+	var failed int
+	for err := range errs {
+		if err != nil {
+			failed++
+			t.Errorf("request failed across reconnect: %v", err)
+		}
+	}
+	if failed > 0 {
+		t.Fatalf("%d of %d requests failed", failed, n)
+	}
+
+	// 最后一个请求结束后旧连接关闭，新请求使用新连接
+	select {
+	case <-old.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Error("retired connection not closed after in-flight requests finished")
+	}
+	if _, _, _, err := c.SendRequestRaw(ctx, http.MethodGet, "/v1/models", nil, nil); err != nil {
+		t.Errorf("request after reconnect: %v", err)
+	}
+}
+
+// earlyMockConn 以 0-RTT 拨号的 mock 连接，握手完成后换用 next
+type earlyMockConn struct {
+	*testutil.MockConn
+	next quic.Connection
+}
+
+func (m *earlyMockConn) HandshakeComplete() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+func (m *earlyMockConn) NextConnection() quic.Connection { return m.next }
+
+func TestClient_ResumeAfter0RTTRejectedSwitchesToNextConnection(t *testing.T) {
+	rejected := &earlyMockConn{MockConn: testutil.NewMockConn(1), next: testutil.NewMockConn(2)}
+	c, _ := NewClientDynamic()
+	c.conn = newRelayConn(rejected)
+	c.conn.acquire()
+
+	c.resumeAfter0RTTRejected(c.conn)
+	if c.conn == nil || c.conn.Connection != rejected.next {
+		t.Fatalf("current connection = %v, want the handshake-completed connection", c.conn)
+	}
+	if rejected.CloseCalls.Load() != 0 {
+		t.Error("connection closed after 0-RTT rejection, want it kept for the handshake-completed connection")
+	}
+}
+
+func TestClient_FailoverRetiresInUseConnection(t *testing.T) {
+	mock := testutil.NewMockConn(1)
+	c, _ := NewClientDynamic()
+	c.conn = newRelayConn(mock)
+	rc := c.conn
+	rc.acquire()
+
+	// 其他请求仍持有连接: 失败切换只退役，最后一个引用释放后才关闭
+	c.failover(rc)
+	if c.conn != nil {
+		t.Error("failed connection still current")
+	}
+	if mock.CloseCalls.Load() != 0 {
+		t.Fatal("failover closed a connection still used by other requests")
+	}
+	rc.release()
+	if mock.CloseCalls.Load() != 1 {
+		t.Errorf("close calls after last release = %d, want 1", mock.CloseCalls.Load())
+	}
+}
+
+func TestClient_SharedReconnectSurvivesLeaderCancel(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	relay, _ := startTestRelay(t, serveWithExit(t, kp))
+	c, _ := newFailoverClient(t, kp, relay)
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	c.discoverFn = func(ctx context.Context) ([]peer.AddrInfo, error) {
+		once.Do(func() { close(entered) })
+		select {
+		case <-release:
+			return []peer.AddrInfo{relay}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// 首个请求触发重连后被取消
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	go func() {
+		if conn, err := c.getConnection(leaderCtx); err == nil {
+			conn.release()
+		}
+	}()
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	waiter := make(chan error, 1)
+	go func() {
+		conn, err := c.getConnection(ctx)
+		if err == nil {
+			conn.release()
+		}
+		waiter <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // 等待者加入进行中的重连
+	cancelLeader()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-waiter; err != nil {
+		t.Errorf("waiter getConnection: %v, want the shared reconnect to survive the leader's cancellation", err)
+	}
+}
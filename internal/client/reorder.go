@@ -0,0 +1,57 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// chunkReorderWindow 等待缺失块时最多缓存的乱序块数，超出视为块已丢失
+const chunkReorderWindow = 64
+
+var (
+	// ErrStreamChunkGap 流式响应缺少数据块 (乱序窗口已满或流结束时仍有缺失)
+	ErrStreamChunkGap = errors.New("流式响应数据块缺失")
+	// ErrStreamChunkDuplicate 流式响应收到重复的数据块
+	ErrStreamChunkDuplicate = errors.New("流式响应数据块重复")
+)
+
+// chunkReorderer 按序号重排带序号的 StreamChunk，按序交付并检测缺失和重复的块
+type chunkReorderer struct {
+	next    uint64            // 下一个应交付的序号
+	pending map[uint64][]byte // 已到达但尚不能交付的块
+	window  int
+}
+
+func newChunkReorderer(window int) *chunkReorderer {
+	return &chunkReorderer{pending: make(map[uint64][]byte), window: window}
+}
+
+// Push 加入一个块，返回因此可以按序交付的块 (可能为空)
+func (r *chunkReorderer) Push(seq uint64, data []byte) ([][]byte, error) {
+	if _, dup := r.pending[seq]; dup || seq < r.next {
+		return nil, fmt.Errorf("%w: 序号 %d", ErrStreamChunkDuplicate, seq)
+	}
+	if seq-r.next >= uint64(r.window) {
+		return nil, fmt.Errorf("%w: 等待序号 %d 时收到 %d", ErrStreamChunkGap, r.next, seq)
+	}
+	r.pending[seq] = data
+
+	var ready [][]byte
+	for {
+		chunk, ok := r.pending[r.next]
+		if !ok {
+			return ready, nil
+		}
+		delete(r.pending, r.next)
+		ready = append(ready, chunk)
+		r.next++
+	}
+}
+
+// Finish 流结束时检查是否仍有缺失的块
+func (r *chunkReorderer) Finish() error {
+	if len(r.pending) > 0 {
+		return fmt.Errorf("%w: 流结束时缺少序号 %d (%d 个后续块未交付)", ErrStreamChunkGap, r.next, len(r.pending))
+	}
+	return nil
+}
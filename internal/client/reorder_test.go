@@ -0,0 +1,150 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/binn/tokengo/internal/testutil"
+)
+
+func TestChunkReorderer(t *testing.T) {
+	r := newChunkReorderer(4)
+
+	// 乱序到达的块缓存到缺失的块补齐后一起交付
+	steps := []struct {
+		seq  uint64
+		want string
+	}{
+		{1, ""},
+		{2, ""},
+		{0, "abc"},
+		{3, "d"},
+	}
+	for _, step := range steps {
+		ready, err := r.Push(step.seq, []byte(string(rune('a'+step.seq))))
+		if err != nil {
+			t.Fatalf("Push(%d) failed: %v", step.seq, err)
+		}
+		var got strings.Builder
+		for _, chunk := range ready {
+			got.Write(chunk)
+		}
+		if got.String() != step.want {
+			t.Errorf("Push(%d) delivered %q, want %q", step.seq, got.String(), step.want)
+		}
+	}
+	if err := r.Finish(); err != nil {
+		t.Errorf("Finish = %v, want nil", err)
+	}
+
+	// 重复的块
+	if _, err := r.Push(2, nil); !errors.Is(err, ErrStreamChunkDuplicate) {
+		t.Errorf("Push(already delivered) = %v, want ErrStreamChunkDuplicate", err)
+	}
+	r.Push(5, nil)
+	if _, err := r.Push(5, nil); !errors.Is(err, ErrStreamChunkDuplicate) {
+		t.Errorf("Push(already pending) = %v, want ErrStreamChunkDuplicate", err)
+	}
+
+	// 缺失的块: 超出乱序窗口，或流结束时仍未到达
+	if _, err := r.Push(8, nil); !errors.Is(err, ErrStreamChunkGap) {
+		t.Errorf("Push(beyond window) = %v, want ErrStreamChunkGap", err)
+	}
+	if err := r.Finish(); !errors.Is(err, ErrStreamChunkGap) {
+		t.Errorf("Finish with missing chunk = %v, want ErrStreamChunkGap", err)
+	}
+}
+
+// newSequencedStreamResponse 返回 StreamResponse、Exit 侧的流和加密器
+func newSequencedStreamResponse(t *testing.T) (*StreamResponse, *testutil.MockPipeStream, *crypto.StreamEncryptor) {
+	t.Helper()
+
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	ohttpClient, _ := crypto.NewOHTTPClient(kp.KeyID, kp.PublicKey)
+	ohttpServer, _ := crypto.NewOHTTPServer(kp.KeyID, kp.PrivateKey)
+	req, _ := createDummyHTTPRequest()
+	ohttpReq, clientCtx, err := ohttpClient.EncapsulateRequest(req)
+	if err != nil {
+		t.Fatalf("EncapsulateRequest failed: %v", err)
+	}
+	_, serverCtx, err := ohttpServer.DecapsulateRequest(ohttpReq)
+	if err != nil {
+		t.Fatalf("DecapsulateRequest failed: %v", err)
+	}
+	encryptor, _ := serverCtx.NewStreamEncryptor()
+	decryptor, _ := clientCtx.NewStreamDecryptor()
+
+	clientStream, serverStream := testutil.NewStreamPair()
+	t.Cleanup(func() {
+		clientStream.Close()
+		serverStream.Close()
+	})
+
+	return &StreamResponse{stream: clientStream, decryptor: decryptor}, serverStream, encryptor
+}
+
+// writeSequenced 发送确认序号协商的 StreamHead，再按给定顺序发送带序号的块，最后发送 StreamEnd
+func writeSequenced(t *testing.T, w io.Writer, encryptor *crypto.StreamEncryptor, events []string, order []uint64) {
+	t.Helper()
+	head := http.Header{"Content-Type": {"text/event-stream"}}
+	head.Set(protocol.StreamSeqHeader, "1")
+	var buf strings.Builder
+	head.Write(&buf)
+	encryptedHead, _ := encryptor.EncryptChunk([]byte(buf.String()))
+	frames := protocol.NewStreamHeadMessage(encryptedHead).Encode()
+	for _, seq := range order {
+		encrypted, err := encryptor.EncryptSequencedChunk(seq, []byte(events[seq]))
+		if err != nil {
+			t.Fatalf("EncryptSequencedChunk failed: %v", err)
+		}
+		frames = append(frames, protocol.NewStreamChunkMessage(encrypted).Encode()...)
+	}
+	frames = append(frames, protocol.NewStreamEndMessage().Encode()...)
+	go w.Write(frames)
+}
+
+func TestStreamResponse_ReordersSequencedChunks(t *testing.T) {
+	sr, exitStream, encryptor := newSequencedStreamResponse(t)
+	events := []string{"data: 0\n\n", "data: 1\n\n", "data: 2\n\n", "data: 3\n\n"}
+	writeSequenced(t, exitStream, encryptor, events, []uint64{2, 0, 3, 1})
+
+	for i, want := range events {
+		chunk, err := sr.ReadChunk()
+		if err != nil {
+			t.Fatalf("ReadChunk %d failed: %v", i, err)
+		}
+		if string(chunk) != want {
+			t.Errorf("chunk %d = %q, want %q", i, chunk, want)
+		}
+	}
+	if _, err := sr.ReadChunk(); err != io.EOF {
+		t.Errorf("after last chunk err = %v, want io.EOF", err)
+	}
+
+	// 协商标记不会出现在交给调用方的响应头中
+	if sr.Header.Get(protocol.StreamSeqHeader) != "" || sr.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Header = %v, want Content-Type only", sr.Header)
+	}
+}
+
+func TestStreamResponse_DetectsMissingSequencedChunk(t *testing.T) {
+	sr, exitStream, encryptor := newSequencedStreamResponse(t)
+	events := []string{"data: 0\n\n", "data: 1\n\n", "data: 2\n\n"}
+	writeSequenced(t, exitStream, encryptor, events, []uint64{0, 2})
+
+	if chunk, err := sr.ReadChunk(); err != nil || string(chunk) != events[0] {
+		t.Fatalf("first chunk = %q, %v; want %q", chunk, err, events[0])
+	}
+	// 块 1 缺失: 块 2 不能交付，流结束时报告缺失而不是正常结束
+	if _, err := sr.ReadChunk(); !errors.Is(err, ErrStreamChunkGap) {
+		t.Errorf("ReadChunk err = %v, want ErrStreamChunkGap", err)
+	}
+}
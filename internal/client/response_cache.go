@@ -0,0 +1,157 @@
+package client
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultResponseCacheSize 响应缓存最多保存的条目数，超出时淘汰最久未使用的条目
+const defaultResponseCacheSize = 64
+
+// cachedResponse 缓存的 GET 响应
+type cachedResponse struct {
+	key       string
+	status    int
+	header    http.Header
+	body      []byte
+	expiresAt time.Time
+}
+
+// responseCache GET 响应的内存 LRU 缓存，按 method+URI+租户索引
+// 条目有效期取后端 Cache-Control: max-age，未声明时使用默认 TTL
+type responseCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]*list.Element
+	order   *list.List // 最近使用的条目在前
+	now     func() time.Time
+}
+
+// newResponseCache 创建响应缓存，ttl <= 0 时返回 nil (不缓存)
+func newResponseCache(ttl time.Duration, size int) *responseCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &responseCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// cacheKey 返回请求的缓存键，不可缓存的请求 (非 GET) 返回空串
+// 键包含查询参数和计费租户，不同租户的相同请求不共享缓存条目
+func cacheKey(r *http.Request, tenant string) string {
+	if r.Method != http.MethodGet {
+		return ""
+	}
+	return r.Method + " " + r.URL.RequestURI() + " tenant=" + tenant
+}
+
+// credentialHeaders 携带调用方凭据的请求头，响应可能与凭据相关
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "X-Api-Key", "Api-Key", "Cookie"}
+
+// storable 判断响应能否写入共享缓存: 携带凭据 (Authorization、x-api-key、Cookie 等) 的请求的响应
+// 可能与调用方的身份相关，只有后端声明 Cache-Control: public 时才缓存
+func storable(r *http.Request, header http.Header) bool {
+	if !hasCredentials(r.Header) {
+		return true
+	}
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "public") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCredentials 判断请求是否携带任一凭据头
+func hasCredentials(header http.Header) bool {
+	for _, name := range credentialHeaders {
+		if header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Get 返回未过期的缓存响应，过期条目被移除
+func (c *responseCache) Get(key string) (*cachedResponse, bool) {
+	if c == nil || key == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cachedResponse)
+	if !c.now().Before(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry, true
+}
+
+// Put 缓存 200 响应，后端声明 no-store/no-cache 或 max-age=0 时不缓存
+func (c *responseCache) Put(key string, status int, header http.Header, body []byte) {
+	if c == nil || key == "" || status != http.StatusOK {
+		return
+	}
+	ttl, ok := cacheTTL(header, c.ttl)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cachedResponse{
+		key:       key,
+		status:    status,
+		header:    header.Clone(),
+		body:      body,
+		expiresAt: c.now().Add(ttl),
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+// cacheTTL 按响应的 Cache-Control 计算缓存时间，不可缓存时返回 false
+func cacheTTL(header http.Header, fallback time.Duration) (time.Duration, bool) {
+	ttl := fallback
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0, false
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil {
+				continue
+			}
+			ttl = time.Duration(seconds) * time.Second
+		}
+	}
+	return ttl, ttl > 0
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		want         time.Duration
+		ok           bool
+	}{
+		{"", time.Minute, true},
+		{"max-age=300", 300 * time.Second, true},
+		{"public, max-age=10", 10 * time.Second, true},
+		{"max-age=0", 0, false},
+		{"no-store", 0, false},
+		{"no-cache, max-age=60", 0, false},
+		{"max-age=abc", time.Minute, true},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.cacheControl != "" {
+			header.Set("Cache-Control", tt.cacheControl)
+		}
+		got, ok := cacheTTL(header, time.Minute)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("cacheTTL(%q) = %v, %v; want %v, %v", tt.cacheControl, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestResponseCache_Expiry(t *testing.T) {
+	now := time.Now()
+	c := newResponseCache(time.Minute, 8)
+	c.now = func() time.Time { return now }
+
+	c.Put("GET /v1/models", http.StatusOK, http.Header{"Cache-Control": {"max-age=30"}}, []byte("models"))
+	if got, ok := c.Get("GET /v1/models"); !ok || string(got.body) != "models" {
+		t.Fatalf("Get = %v, %v; want cached models", got, ok)
+	}
+
+	now = now.Add(31 * time.Second)
+	if _, ok := c.Get("GET /v1/models"); ok {
+		t.Error("entry should expire after max-age")
+	}
+
+	c.Put("GET /v1/error", http.StatusInternalServerError, http.Header{}, []byte("boom"))
+	if _, ok := c.Get("GET /v1/error"); ok {
+		t.Error("non-200 responses should not be cached")
+	}
+}
+
+func TestResponseCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newResponseCache(time.Minute, 2)
+	for i := 0; i < 2; i++ {
+		c.Put(fmt.Sprintf("GET /%d", i), http.StatusOK, http.Header{}, nil)
+	}
+	c.Get("GET /0") // /0 最近使用，/1 最久未使用
+	c.Put("GET /2", http.StatusOK, http.Header{}, nil)
+
+	if _, ok := c.Get("GET /1"); ok {
+		t.Error("least recently used entry should be evicted")
+	}
+	for _, key := range []string{"GET /0", "GET /2"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s should remain cached", key)
+		}
+	}
+}
+
+func TestNewResponseCache_Disabled(t *testing.T) {
+	c := newResponseCache(0, 8)
+	if c != nil {
+		t.Fatal("zero TTL should disable the cache")
+	}
+	// nil 缓存的方法可安全调用
+	c.Put("GET /v1/models", http.StatusOK, http.Header{}, nil)
+	if _, ok := c.Get("GET /v1/models"); ok {
+		t.Error("disabled cache should never hit")
+	}
+}
+
+func TestStorable_CredentialHeaders(t *testing.T) {
+	for _, name := range []string{"Authorization", "Proxy-Authorization", "x-api-key", "api-key", "Cookie"} {
+		r := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		r.Header.Set(name, "secret")
+		if storable(r, http.Header{}) {
+			t.Errorf("response to a request with %s should not be cached", name)
+		}
+		if !storable(r, http.Header{"Cache-Control": {"max-age=60, public"}}) {
+			t.Errorf("public response to a request with %s should be cached", name)
+		}
+	}
+	if !storable(httptest.NewRequest(http.MethodGet, "/v1/models", nil), http.Header{}) {
+		t.Error("response to an anonymous request should be cached")
+	}
+}
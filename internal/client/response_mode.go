@@ -0,0 +1,95 @@
+package client
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// 响应处理模式 (按路径配置，控制代理内部是否流式传输响应)
+const (
+	ResponseModeAuto   = "auto"   // 按客户端的 stream 标志决定 (默认)
+	ResponseModeBuffer = "buffer" // 始终整体缓冲后返回，流式请求的事件一次性写出
+	ResponseModeStream = "stream" // 始终内部流式传输，非流式请求也边收边写，降低内存占用
+)
+
+// validateResponseModes 校验按路径配置的响应处理模式
+// 路径以 * 结尾时按前缀匹配，如 /v1beta/models/*
+func validateResponseModes(modes map[string]string) error {
+	for path, mode := range modes {
+		switch mode {
+		case ResponseModeAuto, ResponseModeBuffer, ResponseModeStream:
+		default:
+			return fmt.Errorf("路径 %s 的响应处理模式无效: %q (支持: auto, buffer, stream)", path, mode)
+		}
+	}
+	return nil
+}
+
+// responseModeFor 查找路径对应的响应处理模式，精确匹配优先，其次最长前缀
+func responseModeFor(modes map[string]string, path string) string {
+	if mode, ok := matchPathRule(modes, path); ok {
+		return mode
+	}
+	return ResponseModeAuto
+}
+
+// matchPathRule 查找路径对应的配置值，精确匹配优先，其次最长前缀 (路径以 * 结尾)
+func matchPathRule(rules map[string]string, path string) (string, bool) {
+	if v, ok := rules[path]; ok {
+		return v, true
+	}
+
+	value, longest := "", -1
+	for pattern, v := range rules {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			value, longest = v, len(prefix)
+		}
+	}
+	return value, longest >= 0
+}
+
+// validateContentTypes 校验按路径固定的 Content-Type
+func validateContentTypes(types map[string]string) error {
+	for path, ct := range types {
+		if _, _, err := mime.ParseMediaType(ct); err != nil {
+			return fmt.Errorf("路径 %s 的 Content-Type 无效: %q", path, ct)
+		}
+	}
+	return nil
+}
+
+// responseContentType 决定非 SSE 响应返回给调用方的 Content-Type
+// 优先使用按路径固定的值，其次沿用后端响应，后端未声明时使用 fallback
+func (p *LocalProxy) responseContentType(path string, upstream http.Header, fallback string) string {
+	if ct, ok := matchPathRule(p.cfg.ContentTypes, path); ok {
+		return ct
+	}
+	if ct := upstream.Get("Content-Type"); ct != "" {
+		return ct
+	}
+	return fallback
+}
+
+// SetResponseModes 设置按路径的响应处理模式
+func (p *LocalProxy) SetResponseModes(modes map[string]string) error {
+	if err := validateResponseModes(modes); err != nil {
+		return err
+	}
+	p.cfg.ResponseModes = modes
+	return nil
+}
+
+// streamInternally 决定请求是否走内部流式通道
+func (p *LocalProxy) streamInternally(path string, clientStreaming bool) bool {
+	switch responseModeFor(p.cfg.ResponseModes, path) {
+	case ResponseModeBuffer:
+		return false
+	case ResponseModeStream:
+		return true
+	default:
+		return clientStreaming
+	}
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/binn/tokengo/internal/config"
+)
+
+func TestResponseModeFor(t *testing.T) {
+	modes := map[string]string{
+		"/v1/chat/completions": ResponseModeBuffer,
+		"/v1/*":                ResponseModeStream,
+		"/v1beta/models/*":     ResponseModeBuffer,
+		"/v1beta/*":            ResponseModeStream,
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v1/chat/completions", ResponseModeBuffer},
+		{"/v1/embeddings", ResponseModeStream},
+		{"/v1beta/models/gemini:generateContent", ResponseModeBuffer},
+		{"/v1beta/files", ResponseModeStream},
+		{"/other", ResponseModeAuto},
+	}
+	for _, tt := range tests {
+		if got := responseModeFor(modes, tt.path); got != tt.want {
+			t.Errorf("responseModeFor(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	if got := responseModeFor(nil, "/v1/chat/completions"); got != ResponseModeAuto {
+		t.Errorf("nil modes = %q, want auto", got)
+	}
+}
+
+func TestSetResponseModes(t *testing.T) {
+	p := &LocalProxy{cfg: &config.ClientConfig{}}
+
+	if err := p.SetResponseModes(map[string]string{"/v1/*": "chunked"}); err == nil {
+		t.Fatal("invalid mode should be rejected")
+	}
+	if p.cfg.ResponseModes != nil {
+		t.Error("invalid modes should not be applied")
+	}
+
+	if err := p.SetResponseModes(map[string]string{
+		"/v1/embeddings": ResponseModeStream,
+		"/v1/messages":   ResponseModeBuffer,
+	}); err != nil {
+		t.Fatalf("SetResponseModes failed: %v", err)
+	}
+
+	tests := []struct {
+		path      string
+		streaming bool
+		want      bool
+	}{
+		{"/v1/embeddings", false, true},
+		{"/v1/messages", true, false},
+		{"/v1/chat/completions", true, true},
+		{"/v1/chat/completions", false, false},
+	}
+	for _, tt := range tests {
+		if got := p.streamInternally(tt.path, tt.streaming); got != tt.want {
+			t.Errorf("streamInternally(%q, %v) = %v, want %v", tt.path, tt.streaming, got, tt.want)
+		}
+	}
+}
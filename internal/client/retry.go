@@ -0,0 +1,241 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/quic-go/quic-go"
+)
+
+// DefaultMaxRetries Relay 失败时换 Relay 重试的默认次数
+const DefaultMaxRetries = 2
+
+// relayFailure Relay 连接或流在请求过程中失败，可换 Relay 重试
+type relayFailure struct {
+	conn      quic.Connection // 失败时使用的连接
+	sent      bool            // 请求已完整发送给 Relay，Exit 可能已处理
+	delivered bool            // 流式响应已有数据块交给调用方，重试会重复输出
+	expired   bool            // 连接达到 Relay 的最长存活时间，Relay 本身可用
+	err       error
+}
+
+func (e *relayFailure) Error() string { return e.err.Error() }
+func (e *relayFailure) Unwrap() error { return e.err }
+
+// serverError 将 Relay/Exit 返回的 Error 消息转为错误
+// Relay 排空或连接到期时请求尚未转发，视为可重试的失败
+func serverError(conn quic.Connection, payload []byte) error {
+	err := &ServerError{Message: string(payload)}
+	switch err.Message {
+	case protocol.ErrRelayDraining:
+		return &relayFailure{conn: conn, err: err}
+	case protocol.ErrConnectionExpired:
+		return &relayFailure{conn: conn, expired: true, err: err}
+	}
+	return err
+}
+
+// asRelayFailure 判断错误是否为可换 Relay 重试的失败 (超时和上下文取消不重试)
+func asRelayFailure(err error) (*relayFailure, bool) {
+	var rf *relayFailure
+	if !errors.As(err, &rf) {
+		return nil, false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil, false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return nil, false
+	}
+	return rf, true
+}
+
+// isIdempotent 请求方法是否幂等 (请求已送达后仍可安全重放)
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetMaxRetries 设置 Relay 失败时换 Relay 重试的次数 (<=0 表示不重试)
+func (c *Client) SetMaxRetries(n int) {
+	if n < 0 {
+		n = 0
+	}
+	c.maxRetries = n
+}
+
+// replayableBody 确保请求体可重放 (重试时需重新加密)
+func replayableBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return fmt.Errorf("读取请求体失败: %w", err)
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return nil
+}
+
+// withRelayRetry 执行请求，Relay 失败且 retryable 允许时切换 Relay 重试，最多 maxRetries 次
+func (c *Client) withRelayRetry(ctx context.Context, req *http.Request, retryable func(*relayFailure) bool, attempt func() error) error {
+	if err := replayableBody(req); err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		err := attempt()
+		if err == nil || i >= c.maxRetries || ctx.Err() != nil {
+			return err
+		}
+		rf, ok := asRelayFailure(err)
+		if !ok {
+			return err
+		}
+		// Relay 拒绝 0-RTT 时丢弃了随握手发送的请求，Relay 本身可用，重试不会重复处理
+		rejected := errors.Is(err, quic.Err0RTTRejected)
+		if !rejected && !retryable(rf) {
+			return err
+		}
+
+		if rejected {
+			log.Printf("Relay 拒绝 0-RTT 数据，在握手完成的连接上重试 (%d/%d)", i+1, c.maxRetries)
+			c.resumeAfter0RTTRejected(rf.conn)
+		} else if rf.expired {
+			log.Printf("Relay 连接已到期，建立新连接重试 (%d/%d)", i+1, c.maxRetries)
+			c.recycle(rf.conn)
+		} else {
+			log.Printf("Relay 请求失败: %v，切换 Relay 重试 (%d/%d)", err, i+1, c.maxRetries)
+			c.failover(rf.conn)
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return fmt.Errorf("重放请求体失败: %w", err)
+			}
+			req.Body = body
+		}
+	}
+}
+
+// failover 当前 Relay 失败: 反馈给选择器降低权重，断开连接，下次重连时优先选择其他 Relay
+// 只处理仍为当前连接的失败，避免并发请求关闭已重连的新连接
+func (c *Client) failover(failed quic.Connection) {
+	c.connMu.Lock()
+	if failed == nil || c.conn != failed {
+		c.connMu.Unlock()
+		return
+	}
+	relayID := c.currentRelayID
+	old := c.conn
+	c.conn = nil
+	c.failedRelay = relayID
+	c.connMu.Unlock()
+	// 只将连接退役: 其上仍在进行的其他请求完成后才关闭
+	old.retire("relay failed")
+
+	if relayID != "" {
+		c.selector.ReportFailure(relayID)
+	}
+}
+
+// recycle 丢弃已到期的连接，下次请求重新连接 (可能仍是同一 Relay)
+// 只将连接退役: 其上进行中的请求完成后才关闭
+func (c *Client) recycle(expired quic.Connection) {
+	c.connMu.Lock()
+	if expired == nil || c.conn != expired {
+		c.connMu.Unlock()
+		return
+	}
+	old := c.conn
+	c.conn = nil
+	c.connMu.Unlock()
+	old.retire("connection expired")
+}
+
+// resumeAfter0RTTRejected 0-RTT 被拒绝 (如 Relay 重启后票据失效) 后连接仍完成了握手，换用握手后的连接
+func (c *Client) resumeAfter0RTTRejected(rejected quic.Connection) {
+	rc, ok := rejected.(*relayConn)
+	var early quic.EarlyConnection
+	if ok {
+		early, ok = rc.early()
+	}
+	if !ok {
+		c.recycle(rejected)
+		return
+	}
+	next := early.NextConnection()
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if c.conn == rejected {
+		// 握手后的连接与原连接共享底层连接，不退役原连接；仍持有原连接引用的请求照常释放
+		c.conn = newRelayConn(next)
+	}
+}
+
+// excludeFailedRelay 从候选 Relay 中排除最近失败的 Relay (只剩该 Relay 时保留)
+func (c *Client) excludeFailedRelay(relays []peer.AddrInfo) []peer.AddrInfo {
+	c.connMu.Lock()
+	failed := c.failedRelay
+	c.connMu.Unlock()
+	if failed == "" || len(relays) < 2 {
+		return relays
+	}
+
+	remaining := make([]peer.AddrInfo, 0, len(relays))
+	for _, r := range relays {
+		if r.ID != failed {
+			remaining = append(remaining, r)
+		}
+	}
+	if len(remaining) == 0 {
+		return relays
+	}
+	return remaining
+}
+
+// OpenStream 发送流式请求并读取首个块，流立即结束时返回 io.EOF (此时仍需 Close)
+// 首个块交给调用方之前 Relay 失败 (包括已转发请求甚至响应头之后) 时，调用方尚未输出任何数据，
+// 可安全地换 Relay 重试；只有已交付数据块的失败不重试
+func (c *Client) OpenStream(ctx context.Context, target *ExitTarget, req *http.Request) (*StreamResponse, []byte, error) {
+	var streamResp *StreamResponse
+	var chunk []byte
+	var firstErr error
+	undelivered := func(rf *relayFailure) bool { return !rf.delivered }
+	err := c.withRelayRetry(ctx, req, undelivered, func() error {
+		resp, err := c.sendStreamRequest(ctx, target, req)
+		if err != nil {
+			return err
+		}
+		chunk, firstErr = resp.ReadChunk()
+		if firstErr != nil && firstErr != io.EOF {
+			resp.Close()
+			return firstErr
+		}
+		streamResp = resp
+		return nil
+	})
+	c.observeExitKey(target, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	return streamResp, chunk, firstErr
+}
@@ -0,0 +1,337 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/cert"
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/exit"
+	"github.com/binn/tokengo/internal/identity"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/quic-go/quic-go"
+)
+
+// orderedSelector 总是选择第一个候选 Relay，并记录失败反馈
+type orderedSelector struct {
+	mu       sync.Mutex
+	failures map[peer.ID]int
+}
+
+func (s *orderedSelector) Select(ctx context.Context, candidates []peer.AddrInfo) (*peer.AddrInfo, error) {
+	return &candidates[0], nil
+}
+
+func (s *orderedSelector) ReportSuccess(peer.ID) {}
+
+func (s *orderedSelector) ReportFailure(id peer.ID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[id]++
+}
+
+func (s *orderedSelector) Failures(id peer.ID) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failures[id]
+}
+
+// startTestRelay 启动测试 Relay，每条请求流交给 handle 处理，返回 Relay 地址信息和请求计数
+func startTestRelay(t *testing.T, handle func(stream quic.Stream, msg *protocol.Message)) (peer.AddrInfo, *atomic.Int32) {
+	t.Helper()
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("identity.Generate: %v", err)
+	}
+	tlsCert, err := cert.GeneratePeerIDCert(id.PrivKey, "")
+	if err != nil {
+		t.Fatalf("GeneratePeerIDCert: %v", err)
+	}
+	listener, err := quic.ListenAddr("127.0.0.1:0", cert.CreateServerTLSConfig(tlsCert), nil)
+	if err != nil {
+		t.Fatalf("ListenAddr: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	requests := &atomic.Int32{}
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					msg, err := protocol.Decode(stream)
+					if err != nil {
+						continue
+					}
+					requests.Add(1)
+					go handle(stream, msg)
+				}
+			}()
+		}
+	}()
+
+	addr, err := ma.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/udp/%d/quic-v1", listener.Addr().(*net.UDPAddr).Port))
+	if err != nil {
+		t.Fatalf("NewMultiaddr: %v", err)
+	}
+	return peer.AddrInfo{ID: id.PeerID, Addrs: []ma.Multiaddr{addr}}, requests
+}
+
+// resetStream 模拟 Relay 在请求中途掉线: 读取请求后重置流
+func resetStream(stream quic.Stream, _ *protocol.Message) {
+	stream.CancelRead(1)
+	stream.CancelWrite(1)
+}
+
+// serveWithExit 返回一个把请求交给本地 OHTTPHandler 处理的 Relay 处理函数
+func serveWithExit(t *testing.T, kp *crypto.KeyPair) func(quic.Stream, *protocol.Message) {
+	t.Helper()
+	return serveWithBackend(t, kp, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"ok\":true}\n\ndata: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list"}`))
+	})
+}
+
+// serveWithBackend 返回一个经本地 OHTTPHandler 把请求转发给 backend 的 Relay 处理函数
+func serveWithBackend(t *testing.T, kp *crypto.KeyPair, backendHandler http.HandlerFunc) func(quic.Stream, *protocol.Message) {
+	t.Helper()
+	backend := httptest.NewServer(backendHandler)
+	t.Cleanup(backend.Close)
+
+	handler, err := exit.NewOHTTPHandler(kp.KeyID, kp.PrivateKey, kp.PublicKey, exit.NewAIClient(backend.URL, "", nil))
+	if err != nil {
+		t.Fatalf("NewOHTTPHandler: %v", err)
+	}
+	return func(stream quic.Stream, msg *protocol.Message) {
+		defer stream.Close()
+		switch msg.Type {
+		case protocol.MessageTypeRequest:
+			resp, err := handler.ProcessRequest(msg.Payload)
+			if err != nil {
+				stream.Write(protocol.NewErrorMessage(err.Error()).Encode())
+				return
+			}
+			stream.Write(protocol.NewResponseMessage(resp).Encode())
+		case protocol.MessageTypeStreamRequest:
+			handler.ProcessStreamRequest(msg.Payload, stream)
+		}
+	}
+}
+
+// newFailoverClient 创建依次尝试 relays 的客户端
+func newFailoverClient(t *testing.T, kp *crypto.KeyPair, relays ...peer.AddrInfo) (*Client, *orderedSelector) {
+	t.Helper()
+	c, _ := NewClientDynamic()
+	t.Cleanup(func() { c.Close() })
+	if err := c.SetExit(kp.KeyID, kp.PublicKey); err != nil {
+		t.Fatalf("SetExit: %v", err)
+	}
+	selector := &orderedSelector{failures: make(map[peer.ID]int)}
+	c.SetSelector(selector)
+	c.discoverFn = func(ctx context.Context) ([]peer.AddrInfo, error) {
+		return relays, nil
+	}
+	return c, selector
+}
+
+func TestClient_RetriesIdempotentRequestOnAnotherRelay(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	dropping, droppedRequests := startTestRelay(t, resetStream)
+	healthy, servedRequests := startTestRelay(t, serveWithExit(t, kp))
+	c, selector := newFailoverClient(t, kp, dropping, healthy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	body, status, _, err := c.SendRequestRaw(ctx, http.MethodGet, "/v1/models", nil, nil)
+	if err != nil {
+		t.Fatalf("request should succeed on the second relay: %v", err)
+	}
+	if status != http.StatusOK || string(body) != `{"object":"list"}` {
+		t.Errorf("response = %d %s", status, body)
+	}
+
+	if droppedRequests.Load() != 1 || servedRequests.Load() != 1 {
+		t.Errorf("requests: dropping=%d healthy=%d, want 1/1", droppedRequests.Load(), servedRequests.Load())
+	}
+	if got := selector.Failures(dropping.ID); got != 1 {
+		t.Errorf("dropping relay failures = %d, want 1", got)
+	}
+	if got := c.GetCurrentRelayID(); got != healthy.ID {
+		t.Errorf("current relay = %s, want healthy relay", got)
+	}
+}
+
+func TestClient_OpenStreamRetriesBeforeFirstChunk(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	dropping, _ := startTestRelay(t, resetStream)
+	healthy, servedRequests := startTestRelay(t, serveWithExit(t, kp))
+	c, _ := newFailoverClient(t, kp, dropping, healthy)
+
+	req, err := http.NewRequest(http.MethodPost, "http://ai-backend/v1/chat/completions",
+		strings.NewReader(`{"model":"test","stream":true}`))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	streamResp, chunk, err := c.OpenStream(ctx, nil, req)
+	if err != nil {
+		t.Fatalf("stream should succeed on the second relay: %v", err)
+	}
+	defer streamResp.Close()
+
+	var got strings.Builder
+	for err == nil {
+		got.Write(chunk)
+		chunk, err = streamResp.ReadChunk()
+	}
+	if err != io.EOF {
+		t.Fatalf("ReadChunk: %v", err)
+	}
+	if !strings.Contains(got.String(), `data: {"ok":true}`) {
+		t.Errorf("stream body = %q", got.String())
+	}
+	if servedRequests.Load() != 1 {
+		t.Errorf("healthy relay requests = %d, want 1", servedRequests.Load())
+	}
+}
+
+// chunkResetStream 转发 Exit 的响应头，在写出首个数据块时重置流，模拟 Relay 在首个块送达前掉线
+type chunkResetStream struct {
+	quic.Stream
+}
+
+func (s *chunkResetStream) Write(p []byte) (int, error) {
+	if len(p) > 0 && protocol.MessageType(p[0]) == protocol.MessageTypeStreamChunk {
+		s.CancelRead(1)
+		s.CancelWrite(1)
+		return 0, errors.New("relay reset")
+	}
+	return s.Stream.Write(p)
+}
+
+func TestHandleRequest_StreamRetriedWhenRelayResetsBeforeFirstChunk(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	serve := serveWithExit(t, kp)
+	dropping, droppedRequests := startTestRelay(t, func(stream quic.Stream, msg *protocol.Message) {
+		serve(&chunkResetStream{Stream: stream}, msg)
+	})
+	healthy, servedRequests := startTestRelay(t, serveWithExit(t, kp))
+	c, _ := newFailoverClient(t, kp, dropping, healthy)
+	p := &LocalProxy{cfg: &config.ClientConfig{}, client: c, progress: NewSilentProgress()}
+
+	// 请求和响应头均已经过第一个 Relay，但调用方尚未收到任何数据块，仍应换 Relay 重试
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"test","stream":true}`))
+	w := httptest.NewRecorder()
+	p.handleRequest(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `data: {"ok":true}`) {
+		t.Fatalf("response = %d %q, want streamed body from the second relay", w.Code, w.Body.String())
+	}
+	if droppedRequests.Load() != 1 || servedRequests.Load() != 1 {
+		t.Errorf("requests: dropping=%d healthy=%d, want 1/1", droppedRequests.Load(), servedRequests.Load())
+	}
+}
+
+func TestClient_DeliveredNonIdempotentRequestNotRetried(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	dropping, _ := startTestRelay(t, resetStream)
+	healthy, servedRequests := startTestRelay(t, serveWithExit(t, kp))
+	c, _ := newFailoverClient(t, kp, dropping, healthy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _, _, err := c.SendRequestRaw(ctx, http.MethodPost, "/v1/chat/completions", []byte(`{"model":"test"}`), nil)
+	if err == nil {
+		t.Fatal("delivered POST should not be replayed on another relay")
+	}
+	if servedRequests.Load() != 0 {
+		t.Errorf("healthy relay requests = %d, want 0", servedRequests.Load())
+	}
+}
+
+// rejectDraining 模拟正在排空的 Relay: 不转发请求，直接返回排空错误
+func rejectDraining(stream quic.Stream, _ *protocol.Message) {
+	stream.Write(protocol.NewErrorMessage(protocol.ErrRelayDraining).Encode())
+	stream.Close()
+}
+
+func TestClient_DrainingRelayFailsOverNonIdempotentRequest(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	draining, _ := startTestRelay(t, rejectDraining)
+	healthy, servedRequests := startTestRelay(t, serveWithExit(t, kp))
+	c, selector := newFailoverClient(t, kp, draining, healthy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// 排空中的 Relay 未转发请求，POST 也可以安全地换 Relay 重试
+	body, status, _, err := c.SendRequestRaw(ctx, http.MethodPost, "/v1/chat/completions", []byte(`{"model":"test"}`), nil)
+	if err != nil {
+		t.Fatalf("SendRequestRaw: %v", err)
+	}
+	if status != http.StatusOK || !strings.Contains(string(body), "ok") {
+		t.Errorf("status = %d, body = %q", status, body)
+	}
+	if servedRequests.Load() != 1 {
+		t.Errorf("healthy relay requests = %d, want 1", servedRequests.Load())
+	}
+	if selector.Failures(draining.ID) != 1 {
+		t.Errorf("draining relay failures = %d, want 1", selector.Failures(draining.ID))
+	}
+}
+
+func TestClient_MaxRetriesZeroDisablesFailover(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	dropping, _ := startTestRelay(t, resetStream)
+	healthy, servedRequests := startTestRelay(t, serveWithExit(t, kp))
+	c, _ := newFailoverClient(t, kp, dropping, healthy)
+	c.SetMaxRetries(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, _, _, err := c.SendRequestRaw(ctx, http.MethodGet, "/v1/models", nil, nil); err == nil {
+		t.Fatal("request should fail without retries")
+	}
+	if servedRequests.Load() != 0 {
+		t.Errorf("healthy relay requests = %d, want 0", servedRequests.Load())
+	}
+}
+
+func TestMaxRetries(t *testing.T) {
+	tests := []struct{ in, want int }{
+		{0, DefaultMaxRetries},
+		{-1, 0},
+		{5, 5},
+	}
+	for _, tt := range tests {
+		if got := maxRetries(tt.in); got != tt.want {
+			t.Errorf("maxRetries(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
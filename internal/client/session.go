@@ -0,0 +1,182 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// 会话键来源
+const (
+	sessionSourceHeaderPrefix = "header:"      // 从请求 header 读取，如 header:X-Session-ID
+	sessionSourceConversation = "conversation" // 由对话上下文 (首条消息) 哈希得到
+)
+
+// sessionFailureCooldown Exit 失效后暂不分配会话的时长，过后会话回到原 Exit
+const sessionFailureCooldown = 30 * time.Second
+
+// SessionRouter 会话粘性路由: 同一会话键的请求固定发往同一个 Exit
+// 使用 rendezvous 哈希选择 Exit，无需保存会话表；Exit 失效后会话在冷却期内迁移到剩余 Exit 中得分最高者
+type SessionRouter struct {
+	header        string // 非空时从该 header 读取会话键
+	conversation  bool   // 从对话上下文计算会话键
+	loadThreshold int    // Exit 负载达到该值时会话迁移到其他 Exit，0 表示不按负载迁移
+
+	mu       sync.RWMutex
+	exits    []*ExitTarget
+	failedAt map[string]time.Time // Exit 最近一次失效的时间 (按 pubKeyHash)
+	cooldown time.Duration
+	now      func() time.Time
+}
+
+// NewSessionRouter 根据会话键来源创建路由器
+// source: "header:<Name>" 或 "conversation"
+func NewSessionRouter(source string) (*SessionRouter, error) {
+	switch {
+	case strings.HasPrefix(source, sessionSourceHeaderPrefix):
+		header := strings.TrimSpace(strings.TrimPrefix(source, sessionSourceHeaderPrefix))
+		if header == "" {
+			return nil, fmt.Errorf("会话键 header 名称为空")
+		}
+		return newSessionRouter(&SessionRouter{header: http.CanonicalHeaderKey(header)}), nil
+	case source == sessionSourceConversation:
+		return newSessionRouter(&SessionRouter{conversation: true}), nil
+	default:
+		return nil, fmt.Errorf("未知的会话键来源: %q (支持: header:<Name>, conversation)", source)
+	}
+}
+
+// newSessionRouter 填充路由器的默认值
+func newSessionRouter(r *SessionRouter) *SessionRouter {
+	r.failedAt = make(map[string]time.Time)
+	r.cooldown = sessionFailureCooldown
+	r.now = time.Now
+	return r
+}
+
+// SetLoadThreshold 设置负载阈值: 负载达到阈值的 Exit 只在没有其他候选时分配会话
+func (r *SessionRouter) SetLoadThreshold(threshold int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loadThreshold = threshold
+}
+
+// SetExits 更新可选的 Exit 列表 (无法解析的条目会被跳过)
+func (r *SessionRouter) SetExits(entries []protocol.ExitKeyEntry) {
+	exits := newExitTargets(entries)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exits = exits
+	// 只保留仍在列表中的 Exit 的失效记录
+	for hash := range r.failedAt {
+		if !slices.ContainsFunc(exits, func(e *ExitTarget) bool { return e.PubKeyHash == hash }) {
+			delete(r.failedAt, hash)
+		}
+	}
+}
+
+// SessionKey 提取请求的会话键，无会话键时返回空字符串
+func (r *SessionRouter) SessionKey(req *http.Request, body []byte) string {
+	if r.header != "" {
+		return req.Header.Get(r.header)
+	}
+	if r.conversation {
+		return conversationKey(body)
+	}
+	return ""
+}
+
+// Pick 为会话键选择 Exit，会话键为空或没有可用 Exit 时返回 nil (使用默认 Exit)
+func (r *SessionRouter) Pick(key string) *ExitTarget {
+	return r.PickFor(key, "", "")
+}
+
+// PickFor 在支持指定端点族和模型的 Exit 中为会话键选择 Exit
+// 按 Exit 通告的权重做加权 rendezvous 哈希，权重大的 Exit 分得成比例更多的会话
+func (r *SessionRouter) PickFor(key, capability, model string) *ExitTarget {
+	if key == "" {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// 负载过高的 Exit 单独排序，只在没有其他候选时使用；负载恢复后会话回到原 Exit
+	now := r.now()
+	var best, busy *ExitTarget
+	var bestScore, busyScore float64
+	for _, exit := range r.exits {
+		if !exit.Supports(capability) || !exit.SupportsModel(model) {
+			continue
+		}
+		if failed, ok := r.failedAt[exit.PubKeyHash]; ok && now.Sub(failed) < r.cooldown {
+			continue
+		}
+		score := weightedRendezvousScore(key, exit.PubKeyHash, exit.Weight)
+		if exit.Overloaded(r.loadThreshold, now) {
+			if busy == nil || score > busyScore {
+				busy, busyScore = exit, score
+			}
+			continue
+		}
+		if best == nil || score > bestScore {
+			best, bestScore = exit, score
+		}
+	}
+	if best == nil {
+		return busy
+	}
+	return best
+}
+
+// ReportFailure 标记 Exit 失效，使用该 Exit 的会话在冷却期内迁移到其他 Exit
+// 冷却期过后 Exit 重新参与选择，会话回到原 Exit (再次失效时重新计时)
+func (r *SessionRouter) ReportFailure(pubKeyHash string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, exit := range r.exits {
+		if exit.PubKeyHash == pubKeyHash {
+			r.failedAt[pubKeyHash] = r.now()
+			log.Printf("Exit %s 失效，相关会话将在 %v 内迁移到其他 Exit", pubKeyHash, r.cooldown)
+			return
+		}
+	}
+}
+
+// rendezvousScore 计算会话键与 Exit 的 rendezvous 哈希得分
+func rendezvousScore(key, pubKeyHash string) uint64 {
+	sum := sha256.Sum256([]byte(key + "\x00" + pubKeyHash))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// weightedRendezvousScore 加权 rendezvous 得分: -w / ln(u)，u 为哈希映射到 (0,1) 的值
+// 权重相同时与 rendezvousScore 的排序一致
+func weightedRendezvousScore(key, pubKeyHash string, weight int) float64 {
+	u := (float64(rendezvousScore(key, pubKeyHash)>>11) + 0.5) / (1 << 53)
+	return -float64(max(weight, 1)) / math.Log(u)
+}
+
+// conversationKey 由对话首条消息计算会话键
+// 多轮对话中首条消息 (通常为 system prompt 或首个用户问题) 保持不变
+func conversationKey(body []byte) string {
+	var partial struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	if json.Unmarshal(body, &partial) != nil || len(partial.Messages) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(partial.Messages[0])
+	return fmt.Sprintf("%x", sum[:16])
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// newTestExitEntries 生成 n 个 Exit 公钥条目
+func newTestExitEntries(t *testing.T, n int) []protocol.ExitKeyEntry {
+	t.Helper()
+	entries := make([]protocol.ExitKeyEntry, 0, n)
+	for i := 0; i < n; i++ {
+		kp, err := crypto.GenerateKeyPair()
+		if err != nil {
+			t.Fatalf("GenerateKeyPair failed: %v", err)
+		}
+		entries = append(entries, protocol.ExitKeyEntry{
+			PubKeyHash: crypto.PubKeyHash(kp.PublicKey),
+			KeyConfig:  crypto.EncodeKeyConfig(kp.KeyID, kp.PublicKey),
+		})
+	}
+	return entries
+}
+
+func TestNewSessionRouter(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr bool
+	}{
+		{"header:X-Session-ID", false},
+		{"conversation", false},
+		{"header:", true},
+		{"cookie:session", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			_, err := NewSessionRouter(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSessionRouter(%q) err = %v, wantErr %v", tt.source, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionRouter_SameKeySameExit(t *testing.T) {
+	r, _ := NewSessionRouter("header:X-Session-ID")
+	r.SetExits(newTestExitEntries(t, 5))
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("session-%d", i)
+		first := r.Pick(key)
+		if first == nil {
+			t.Fatal("Pick returned nil with exits available")
+		}
+		for j := 0; j < 5; j++ {
+			if got := r.Pick(key); got.PubKeyHash != first.PubKeyHash {
+				t.Fatalf("session %s moved from %s to %s", key, first.PubKeyHash, got.PubKeyHash)
+			}
+		}
+	}
+}
+
+func TestSessionRouter_SpreadsSessions(t *testing.T) {
+	r, _ := NewSessionRouter("conversation")
+	r.SetExits(newTestExitEntries(t, 3))
+
+	used := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		used[r.Pick(fmt.Sprintf("session-%d", i)).PubKeyHash] = true
+	}
+	if len(used) != 3 {
+		t.Errorf("sessions spread across %d exits, want 3", len(used))
+	}
+}
+
+func TestSessionRouter_WeightedSpread(t *testing.T) {
+	entries := newTestExitEntries(t, 2)
+	entries[0].Weight = 4
+	r, _ := NewSessionRouter("conversation")
+	r.SetExits(entries)
+
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		counts[r.Pick(fmt.Sprintf("session-%d", i)).PubKeyHash]++
+	}
+	if heavy, light := counts[entries[0].PubKeyHash], counts[entries[1].PubKeyHash]; light == 0 || heavy < 2*light {
+		t.Errorf("sessions = %d (weight 4) vs %d (weight 1), want roughly 4:1", heavy, light)
+	}
+}
+
+func TestSessionRouter_RehomeOnFailure(t *testing.T) {
+	r, _ := NewSessionRouter("header:X-Session-ID")
+	r.SetExits(newTestExitEntries(t, 3))
+
+	original := r.Pick("session-a")
+	r.ReportFailure(original.PubKeyHash)
+
+	rehomed := r.Pick("session-a")
+	if rehomed == nil {
+		t.Fatal("Pick returned nil with remaining exits")
+	}
+	if rehomed.PubKeyHash == original.PubKeyHash {
+		t.Error("session should move away from failed exit")
+	}
+	if again := r.Pick("session-a"); again.PubKeyHash != rehomed.PubKeyHash {
+		t.Error("rehomed session should stay on its new exit")
+	}
+}
+
+func TestSessionRouter_ReturnsAfterCooldown(t *testing.T) {
+	r, _ := NewSessionRouter("header:X-Session-ID")
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	entries := newTestExitEntries(t, 3)
+	r.SetExits(entries)
+
+	original := r.Pick("session-a")
+	r.ReportFailure(original.PubKeyHash)
+	if rehomed := r.Pick("session-a"); rehomed.PubKeyHash == original.PubKeyHash {
+		t.Fatal("session should move away from failed exit during cooldown")
+	}
+
+	// 刷新 Exit 列表不清除仍在列表中的 Exit 的失效记录
+	r.SetExits(entries)
+	if again := r.Pick("session-a"); again.PubKeyHash == original.PubKeyHash {
+		t.Error("failed exit should stay excluded until cooldown ends")
+	}
+
+	// 冷却期过后 Exit 恢复，会话回到原 Exit
+	now = now.Add(sessionFailureCooldown)
+	if recovered := r.Pick("session-a"); recovered.PubKeyHash != original.PubKeyHash {
+		t.Errorf("session should return to recovered exit %s, got %s", original.PubKeyHash, recovered.PubKeyHash)
+	}
+}
+
+func TestSessionRouter_NoKeyOrExits(t *testing.T) {
+	r, _ := NewSessionRouter("header:X-Session-ID")
+	if r.Pick("session-a") != nil {
+		t.Error("Pick without exits should return nil")
+	}
+
+	r.SetExits(newTestExitEntries(t, 1))
+	if r.Pick("") != nil {
+		t.Error("Pick without session key should return nil")
+	}
+}
+
+func TestSessionRouter_SessionKey(t *testing.T) {
+	hr, _ := NewSessionRouter("header:x-session-id")
+	req, _ := http.NewRequest("POST", "http://localhost/v1/chat/completions", nil)
+	req.Header.Set("X-Session-ID", "abc")
+	if got := hr.SessionKey(req, nil); got != "abc" {
+		t.Errorf("header SessionKey = %q, want abc", got)
+	}
+
+	cr, _ := NewSessionRouter("conversation")
+	turn1 := []byte(`{"messages":[{"role":"system","content":"you are helpful"},{"role":"user","content":"hi"}]}`)
+	turn2 := []byte(`{"messages":[{"role":"system","content":"you are helpful"},{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"more"}]}`)
+	other := []byte(`{"messages":[{"role":"system","content":"you are a pirate"}]}`)
+
+	k1, k2, k3 := cr.SessionKey(req, turn1), cr.SessionKey(req, turn2), cr.SessionKey(req, other)
+	if k1 == "" || k1 != k2 {
+		t.Errorf("turns of one conversation should share a key: %q vs %q", k1, k2)
+	}
+	if k1 == k3 {
+		t.Error("different conversations should have different keys")
+	}
+	if cr.SessionKey(req, []byte(`not json`)) != "" {
+		t.Error("invalid body should yield empty key")
+	}
+}
+
+func TestIsExitFailure(t *testing.T) {
+	if !isExitFailure(&ServerError{Message: protocol.ErrExitNotFound}) {
+		t.Error("ErrExitNotFound should be an exit failure")
+	}
+	if !isExitFailure(fmt.Errorf("wrapped: %w", &ServerError{Message: protocol.ErrWriteToExitFailed})) {
+		t.Error("wrapped ErrWriteToExitFailed should be an exit failure")
+	}
+	if isExitFailure(&ServerError{Message: protocol.ErrMissingTarget}) {
+		t.Error("ErrMissingTarget should not be an exit failure")
+	}
+	if isExitFailure(fmt.Errorf("network down")) {
+		t.Error("plain error should not be an exit failure")
+	}
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// QueryStatus 从已连接的 Relay 查询运行状态 (运行时间、已注册 Exit 及其心跳)
+func (c *Client) QueryStatus(ctx context.Context) (*protocol.RelayStatus, error) {
+	conn, err := c.getConnection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取连接失败: %w", err)
+	}
+	defer conn.release()
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("创建流失败: %w", err)
+	}
+	defer stream.Close()
+
+	if err := protocol.WriteMessage(stream, protocol.NewStatusMessage()); err != nil {
+		return nil, fmt.Errorf("发送查询消息失败: %w", err)
+	}
+
+	respMsg, err := protocol.Decode(stream)
+	if err != nil {
+		return nil, &relayFailure{conn: conn, sent: true, err: fmt.Errorf("读取响应失败: %w", err)}
+	}
+
+	if respMsg.Type == protocol.MessageTypeError {
+		return nil, serverError(conn, respMsg.Payload)
+	}
+
+	if respMsg.Type != protocol.MessageTypeStatusResponse {
+		return nil, fmt.Errorf("期望 StatusResponse，收到类型 0x%02x", respMsg.Type)
+	}
+
+	return protocol.DecodeStatusResponse(respMsg.Payload)
+}
+
+// QueryExitModels 查询当前 Relay 上各 Exit 通告的可服务模型 (未通告模型的 Exit 不列出)
+func (c *Client) QueryExitModels(ctx context.Context) (protocol.ExitModels, error) {
+	conn, err := c.getConnection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取连接失败: %w", err)
+	}
+	defer conn.release()
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("创建流失败: %w", err)
+	}
+	defer stream.Close()
+
+	if err := protocol.WriteMessage(stream, protocol.NewQueryExitModelsMessage()); err != nil {
+		return nil, fmt.Errorf("发送查询消息失败: %w", err)
+	}
+
+	respMsg, err := protocol.Decode(stream)
+	if err != nil {
+		return nil, &relayFailure{conn: conn, sent: true, err: fmt.Errorf("读取响应失败: %w", err)}
+	}
+
+	if respMsg.Type == protocol.MessageTypeError {
+		return nil, serverError(conn, respMsg.Payload)
+	}
+
+	if respMsg.Type != protocol.MessageTypeExitModelsResponse {
+		return nil, fmt.Errorf("期望 ExitModelsResponse，收到类型 0x%02x", respMsg.Type)
+	}
+
+	return protocol.DecodeExitModelsResponse(respMsg.Payload)
+}
+
+// PrintExitModels 按 pubKeyHash 排序输出各 Exit 通告的可服务模型
+func PrintExitModels(w io.Writer, models protocol.ExitModels) {
+	if len(models) == 0 {
+		fmt.Fprintln(w, "没有通告模型的 Exit")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PUBKEY HASH\tMODELS")
+	hashes := make([]string, 0, len(models))
+	for hash := range models {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	for _, hash := range hashes {
+		fmt.Fprintf(tw, "%s\t%s\n", hash, strings.Join(models[hash], ", "))
+	}
+	tw.Flush()
+}
+
+// PrintStatus 以表格输出 Relay 运行状态
+func PrintStatus(w io.Writer, relayAddr string, status *protocol.RelayStatus) {
+	fmt.Fprintf(w, "Relay: %s\n", relayAddr)
+	fmt.Fprintf(w, "运行时间: %s\n", status.Uptime().Round(time.Second))
+	fmt.Fprintf(w, "已注册 Exit: %d\n", len(status.Exits))
+	if len(status.Exits) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PUBKEY HASH\tINSTANCES\tLAST HEARTBEAT\tRTT\tSTATE")
+	for _, e := range status.Exits {
+		state := "online"
+		if e.Reconnecting {
+			state = "reconnecting"
+		}
+		rtt := "-"
+		if d := e.HeartbeatRTT(); d > 0 {
+			rtt = d.Round(100 * time.Microsecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s ago\t%s\t%s\n", e.PubKeyHash, e.Instances, e.LastHeartbeatAge().Round(time.Second), rtt, state)
+	}
+	tw.Flush()
+}
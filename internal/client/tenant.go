@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// TenantHeader 按请求指定计费租户的 header，优先于配置的 tenant
+// 仅写入协议消息头供 Relay 统计用量，不会转发给 Exit 和后端
+const TenantHeader = "X-TokenGo-Tenant"
+
+// tenantKey context 中租户标识的键
+type tenantKey struct{}
+
+// withTenant 返回携带租户标识的 context，tenant 为空时原样返回
+func withTenant(ctx context.Context, tenant string) context.Context {
+	if tenant == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantFromContext 取出 context 中的租户标识
+func tenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// tenantFor 解析请求的计费租户: 请求 header 优先，否则使用配置值
+func (p *LocalProxy) tenantFor(r *http.Request) string {
+	if tenant := r.Header.Get(TenantHeader); tenant != "" {
+		return tenant
+	}
+	return p.cfg.Tenant
+}
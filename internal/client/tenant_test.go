@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/binn/tokengo/internal/config"
+)
+
+func TestLocalProxy_TenantFor(t *testing.T) {
+	p := &LocalProxy{cfg: &config.ClientConfig{Tenant: "default-team"}}
+
+	r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	if got := p.tenantFor(r); got != "default-team" {
+		t.Errorf("tenantFor = %q, want configured default", got)
+	}
+
+	r.Header.Set(TenantHeader, "team-a")
+	if got := p.tenantFor(r); got != "team-a" {
+		t.Errorf("tenantFor = %q, want header value", got)
+	}
+}
+
+func TestTenantContext(t *testing.T) {
+	ctx := context.Background()
+	if got := tenantFromContext(ctx); got != "" {
+		t.Errorf("tenantFromContext = %q, want empty", got)
+	}
+	if got := tenantFromContext(withTenant(ctx, "team-a")); got != "team-a" {
+		t.Errorf("tenantFromContext = %q, want team-a", got)
+	}
+}
+
+func TestNewBackendRequest_StripsTenantHeader(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	r.Header.Set(TenantHeader, "team-a")
+	r.Header.Set("Authorization", "Bearer x")
+
+	req, err := newBackendRequest(context.Background(), r, []byte("{}"))
+	if err != nil {
+		t.Fatalf("newBackendRequest failed: %v", err)
+	}
+	if req.Header.Get(TenantHeader) != "" {
+		t.Error("租户 header 不应转发给后端")
+	}
+	if req.Header.Get("Authorization") != "Bearer x" {
+		t.Error("其他 header 应原样转发")
+	}
+}
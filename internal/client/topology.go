@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/binn/tokengo/internal/loadbalancer"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TopologyPath 拓扑导出端点 (相对 BasePath)
+const TopologyPath = "/debug/topology"
+
+// Topology 当前节点视角下的网络拓扑快照
+type Topology struct {
+	GeneratedAt  time.Time   `json:"generated_at"`
+	CurrentRelay string      `json:"current_relay,omitempty"`
+	CurrentExit  string      `json:"current_exit,omitempty"`
+	Relays       []RelayInfo `json:"relays"`
+	Exits        []ExitInfo  `json:"exits"`
+	Error        string      `json:"error,omitempty"` // 查询 Exit 列表失败时的原因
+}
+
+// RelayInfo 已发现的 Relay 节点
+type RelayInfo struct {
+	PeerID  string   `json:"peer_id,omitempty"`
+	Addrs   []string `json:"addrs"`
+	Weight  float64  `json:"weight"`
+	Healthy bool     `json:"healthy"`
+	RTTMs   float64  `json:"rtt_ms,omitempty"` // 最近一次 QUIC 握手耗时
+}
+
+// ExitInfo 已发现的 Exit 节点 (注册到多个 Relay 时只出现一次)
+type ExitInfo struct {
+	PubKeyHash   string   `json:"pub_key_hash"`
+	Relays       []string `json:"relays"` // 可达该 Exit 的 Relay (PeerID，静态模式为地址)
+	Reconnecting bool     `json:"reconnecting,omitempty"`
+	LatencyMs    float64  `json:"latency_ms,omitempty"` // 最近一次请求往返耗时
+}
+
+// Topology 汇总 Discovery 缓存、选择器权重和各 Relay 上的 Exit 列表
+func (c *Client) Topology(ctx context.Context) *Topology {
+	// Exit: 从当前及其他已发现的 Relay 实时查询并去重 (先查询，确保连接已建立并记录握手耗时)
+	exits, queryErr := c.DiscoverExits(ctx)
+
+	c.connMu.Lock()
+	discovery := c.discovery
+	topo := &Topology{
+		GeneratedAt:  time.Now(),
+		CurrentRelay: c.relayAddr,
+		CurrentExit:  c.exitPubKeyHash,
+		Relays:       []RelayInfo{},
+		Exits:        []ExitInfo{},
+	}
+	c.connMu.Unlock()
+
+	// Relay: DHT 模式取 Discovery 缓存，静态模式仅有当前 Relay
+	var relays []peer.AddrInfo
+	if discovery != nil {
+		relays = discovery.GetCachedRelays()
+	}
+	var infos []loadbalancer.NodeInfo
+	if d, ok := c.selector.(interface {
+		Describe([]peer.AddrInfo) []loadbalancer.NodeInfo
+	}); ok {
+		infos = d.Describe(relays)
+	}
+
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	for i, r := range relays {
+		info := RelayInfo{PeerID: r.ID.String(), Addrs: []string{}, Weight: 1.0, Healthy: true}
+		if i < len(infos) {
+			info.Addrs = infos[i].Addrs
+			info.Weight = infos[i].Weight
+			info.Healthy = infos[i].Healthy
+		}
+		info.RTTMs = durationMs(c.relayRTT[r.ID.String()])
+		topo.Relays = append(topo.Relays, info)
+	}
+	if discovery == nil && topo.CurrentRelay != "" {
+		topo.Relays = append(topo.Relays, RelayInfo{
+			Addrs:   []string{topo.CurrentRelay},
+			Weight:  1.0,
+			Healthy: true,
+			RTTMs:   durationMs(c.relayRTT[topo.CurrentRelay]),
+		})
+	}
+
+	if queryErr != nil {
+		topo.Error = queryErr.Error()
+		return topo
+	}
+	for _, e := range exits {
+		topo.Exits = append(topo.Exits, ExitInfo{
+			PubKeyHash:   e.PubKeyHash,
+			Relays:       e.Relays,
+			Reconnecting: e.Reconnecting,
+			LatencyMs:    durationMs(c.exitLatency[e.PubKeyHash]),
+		})
+	}
+	return topo
+}
+
+// recordRelayRTT 记录 Relay 握手耗时 (key 为 PeerID，静态模式为地址)
+func (c *Client) recordRelayRTT(key string, rtt time.Duration) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	if c.relayRTT == nil {
+		c.relayRTT = make(map[string]time.Duration)
+	}
+	c.relayRTT[key] = rtt
+}
+
+// recordExitLatency 记录 Exit 请求往返耗时
+func (c *Client) recordExitLatency(pubKeyHash string, latency time.Duration) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	if c.exitLatency == nil {
+		c.exitLatency = make(map[string]time.Duration)
+	}
+	c.exitLatency[pubKeyHash] = latency
+}
+
+// durationMs 将耗时转换为毫秒 (保留小数)
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// handleTopology 导出拓扑快照 JSON，每次请求实时刷新
+func (p *LocalProxy) handleTopology(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.getTimeout())
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.client.Topology(ctx))
+}
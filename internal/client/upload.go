@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/quic-go/quic-go"
+)
+
+// ChunkedUploadThreshold 请求体超过该大小 (或长度未知) 时，对通告了 protocol.FeatureChunkedUpload 的 Exit 改为分块上传
+// 请求体不再整体封装进一次 HPKE 加密，也不受单条协议消息 16MB 的限制；旧版 Exit 仍随请求整体发送
+const ChunkedUploadThreshold = 1 << 20
+
+// uploadChunkSize 分块上传的块大小
+const uploadChunkSize = 64 * 1024
+
+// needsChunkedUpload 判断请求体是否需要分块上传 (还需 Exit 支持)
+func needsChunkedUpload(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return false
+	}
+	return req.ContentLength < 0 || req.ContentLength > ChunkedUploadThreshold
+}
+
+// chunkedUploadHead 构建分块上传的请求头部: 不含请求体，以 ChunkedBodyHeader 声明原始长度
+func chunkedUploadHead(req *http.Request) *http.Request {
+	head := req.Clone(req.Context())
+	head.Body = http.NoBody
+	head.GetBody = nil
+	head.ContentLength = 0
+	head.Header.Set(protocol.ChunkedBodyHeader, strconv.FormatInt(req.ContentLength, 10))
+	return head
+}
+
+// uploadRequestBody 将请求体按块加密，依次写入 RequestChunk 和 RequestEnd 后关闭写入端
+// 读取请求体或写入失败时重置写入端，Exit 收不到 RequestEnd 会拒绝不完整的请求体
+func uploadRequestBody(stream quic.Stream, body io.Reader, sealer *crypto.RequestBodySealer, done chan<- struct{}) {
+	defer close(done)
+
+	buf := make([]byte, uploadChunkSize)
+	for {
+		n, readErr := io.ReadFull(body, buf)
+		if n > 0 {
+			msg := protocol.NewRequestChunkMessage(sealer.SealChunk(buf[:n]))
+			if err := protocol.WriteMessage(stream, msg); err != nil {
+				stream.CancelWrite(0)
+				return
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			log.Printf("读取上传请求体失败: %v", readErr)
+			stream.CancelWrite(0)
+			return
+		}
+	}
+
+	if err := protocol.WriteMessage(stream, protocol.NewRequestEndMessage(sealer.SealFinal())); err != nil {
+		stream.CancelWrite(0)
+		return
+	}
+	stream.Close()
+}
+
+// sendUploadRequest 非流式请求经流式请求分块上传请求体，并将流式响应还原为普通响应
+// Exit 在 StreamHead 中返回后端的状态码和响应头，响应体为按块解密的后端原始响应体
+func (c *Client) sendUploadRequest(ctx context.Context, target *ExitTarget, req *http.Request) (*http.Response, error) {
+	streamResp, chunk, err := c.OpenStream(ctx, target, req)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	header := streamResp.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		StatusCode:    streamResp.StatusCode,
+		Status:        fmt.Sprintf("%d %s", streamResp.StatusCode, http.StatusText(streamResp.StatusCode)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          &streamBody{resp: streamResp, buf: chunk, err: err},
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+// streamBody 将流式响应的数据块拼接为响应体
+type streamBody struct {
+	resp *StreamResponse
+	buf  []byte
+	err  error // 读取下一个块的错误，io.EOF 表示流已结束
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		b.buf, b.err = b.resp.ReadChunk()
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+// Close 关闭流式响应并释放 Relay 连接
+func (b *streamBody) Close() error {
+	return b.resp.Close()
+}
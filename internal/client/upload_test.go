@@ -0,0 +1,250 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/exit"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/quic-go/quic-go"
+)
+
+// uploadDigest 测试后端收到的请求体摘要
+type uploadDigest struct {
+	ContentLength int64  `json:"content_length"`
+	Bytes         int64  `json:"bytes"`
+	SHA256        string `json:"sha256"`
+	Marker        string `json:"marker"`
+}
+
+func TestClient_ChunkedUploadRoundTrip(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := sha256.New()
+		n, err := io.Copy(h, r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(uploadDigest{
+			ContentLength: r.ContentLength,
+			Bytes:         n,
+			SHA256:        hex.EncodeToString(h.Sum(nil)),
+			Marker:        r.Header.Get(protocol.ChunkedBodyHeader),
+		})
+	}))
+	t.Cleanup(backend.Close)
+
+	handler, err := exit.NewOHTTPHandler(kp.KeyID, kp.PrivateKey, kp.PublicKey, exit.NewAIClient(backend.URL, "", nil))
+	if err != nil {
+		t.Fatalf("NewOHTTPHandler: %v", err)
+	}
+	var requestSize atomic.Int64
+	relay, _ := startTestRelay(t, func(stream quic.Stream, msg *protocol.Message) {
+		defer stream.Close()
+		requestSize.Store(int64(len(msg.Payload)))
+		if err := handler.ProcessStreamRequest(msg.Payload, stream); err != nil {
+			stream.Write(protocol.NewErrorMessage(err.Error()).Encode())
+		}
+	})
+	c, _ := newFailoverClient(t, kp, relay)
+	setChunkedUploadExit(t, c, kp)
+
+	body := make([]byte, 5<<20)
+	rand.Read(body)
+	sum := sha256.Sum256(body)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://ai-backend/v1/audio/transcriptions", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, chunk, err := c.OpenStream(ctx, nil, req)
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	defer resp.Close()
+
+	var out []byte
+	for err == nil {
+		out = append(out, chunk...)
+		chunk, err = resp.ReadChunk()
+	}
+	if err != io.EOF {
+		t.Fatalf("ReadChunk: %v", err)
+	}
+
+	var got uploadDigest
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("decode backend response %q: %v", out, err)
+	}
+	if got.Bytes != int64(len(body)) || got.ContentLength != int64(len(body)) {
+		t.Errorf("backend received %d bytes (Content-Length %d), want %d", got.Bytes, got.ContentLength, len(body))
+	}
+	if got.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Error("backend received a corrupted body")
+	}
+	if got.Marker != "" {
+		t.Errorf("chunked upload marker leaked to backend: %q", got.Marker)
+	}
+	if n := requestSize.Load(); n > ChunkedUploadThreshold {
+		t.Errorf("StreamRequest carried %d bytes, want the body uploaded in chunks", n)
+	}
+}
+
+// setChunkedUploadExit 将 Client 的当前 Exit 设置为通告了分块上传的 kp
+func setChunkedUploadExit(t *testing.T, c *Client, kp *crypto.KeyPair) {
+	t.Helper()
+	err := c.SetExitEntry(protocol.ExitKeyEntry{
+		PubKeyHash: crypto.PubKeyHash(kp.PublicKey),
+		KeyConfig:  crypto.EncodeKeyConfig(kp.KeyID, kp.PublicKey),
+		Features:   []string{protocol.FeatureChunkedUpload},
+	})
+	if err != nil {
+		t.Fatalf("SetExitEntry: %v", err)
+	}
+}
+
+// recordMessageTypes 记录 Relay 收到的请求消息类型后交给 serve 处理
+func recordMessageTypes(serve func(quic.Stream, *protocol.Message), types chan<- protocol.MessageType) func(quic.Stream, *protocol.Message) {
+	return func(stream quic.Stream, msg *protocol.Message) {
+		types <- msg.Type
+		serve(stream, msg)
+	}
+}
+
+// digestBackend 返回收到的请求体摘要 (状态码 201，便于确认状态码经 StreamHead 还原)
+func digestBackend(w http.ResponseWriter, r *http.Request) {
+	h := sha256.New()
+	n, _ := io.Copy(h, r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(uploadDigest{
+		ContentLength: r.ContentLength,
+		Bytes:         n,
+		SHA256:        hex.EncodeToString(h.Sum(nil)),
+		Marker:        r.Header.Get(protocol.ChunkedBodyHeader),
+	})
+}
+
+func TestClient_LargeNonStreamingRequestUploadsInChunks(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	types := make(chan protocol.MessageType, 1)
+	relay, _ := startTestRelay(t, recordMessageTypes(serveWithBackend(t, kp, digestBackend), types))
+	c, _ := newFailoverClient(t, kp, relay)
+	setChunkedUploadExit(t, c, kp)
+
+	body := make([]byte, 3<<20)
+	rand.Read(body)
+	sum := sha256.Sum256(body)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	respBody, status, header, err := c.SendRequestRaw(ctx, http.MethodPost, "/v1/files", body, nil)
+	if err != nil {
+		t.Fatalf("SendRequestRaw: %v", err)
+	}
+	if typ := <-types; typ != protocol.MessageTypeStreamRequest {
+		t.Errorf("relay received message type 0x%02x, want StreamRequest with a chunked body", typ)
+	}
+	if status != http.StatusCreated || header.Get("Content-Type") != "application/json" {
+		t.Errorf("response = %d %q, want the backend's 201 application/json", status, header.Get("Content-Type"))
+	}
+	var got uploadDigest
+	if err := json.Unmarshal(respBody, &got); err != nil {
+		t.Fatalf("decode backend response %q: %v", respBody, err)
+	}
+	if got.Bytes != int64(len(body)) || got.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("backend received %d bytes (sha256 %s), want the original body", got.Bytes, got.SHA256)
+	}
+}
+
+func TestClient_LargeRequestInlineForExitWithoutChunkedUpload(t *testing.T) {
+	kp, _ := crypto.GenerateKeyPair()
+	types := make(chan protocol.MessageType, 1)
+	relay, _ := startTestRelay(t, recordMessageTypes(serveWithBackend(t, kp, digestBackend), types))
+	// 旧版 Exit 不通告 FeatureChunkedUpload，请求体仍随请求整体加密发送
+	c, _ := newFailoverClient(t, kp, relay)
+	if err := c.SetExitEntry(protocol.ExitKeyEntry{KeyConfig: crypto.EncodeKeyConfig(kp.KeyID, kp.PublicKey)}); err != nil {
+		t.Fatalf("SetExitEntry: %v", err)
+	}
+
+	body := make([]byte, ChunkedUploadThreshold+1)
+	rand.Read(body)
+	sum := sha256.Sum256(body)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	respBody, _, _, err := c.SendRequestRaw(ctx, http.MethodPost, "/v1/files", body, nil)
+	if err != nil {
+		t.Fatalf("SendRequestRaw: %v", err)
+	}
+	if typ := <-types; typ != protocol.MessageTypeRequest {
+		t.Errorf("relay received message type 0x%02x, want an inline Request", typ)
+	}
+	var got uploadDigest
+	json.Unmarshal(respBody, &got)
+	if got.Bytes != int64(len(body)) || got.SHA256 != hex.EncodeToString(sum[:]) || got.Marker != "" {
+		t.Errorf("non-streaming: backend received %+v, want the full body inline", got)
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://ai-backend/v1/audio/transcriptions", bytes.NewReader(body))
+	resp, chunk, err := c.OpenStream(ctx, nil, req)
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	defer resp.Close()
+	out := chunk
+	for err == nil {
+		chunk, err = resp.ReadChunk()
+		out = append(out, chunk...)
+	}
+	if typ := <-types; typ != protocol.MessageTypeStreamRequest {
+		t.Errorf("relay received message type 0x%02x, want StreamRequest", typ)
+	}
+	got = uploadDigest{}
+	json.Unmarshal(out, &got)
+	if got.Bytes != int64(len(body)) || got.SHA256 != hex.EncodeToString(sum[:]) || got.Marker != "" {
+		t.Errorf("streaming: backend received %+v, want the full body inline", got)
+	}
+}
+
+func TestNeedsChunkedUpload(t *testing.T) {
+	small, _ := http.NewRequest(http.MethodPost, "http://ai-backend/v1/chat/completions", bytes.NewReader([]byte(`{}`)))
+	if needsChunkedUpload(small) {
+		t.Error("small body should be sent inline")
+	}
+
+	large, _ := http.NewRequest(http.MethodPost, "http://ai-backend/v1/files", bytes.NewReader(make([]byte, ChunkedUploadThreshold+1)))
+	if !needsChunkedUpload(large) {
+		t.Error("body above threshold should be uploaded in chunks")
+	}
+
+	unknown, _ := http.NewRequest(http.MethodPost, "http://ai-backend/v1/files", io.NopCloser(bytes.NewReader([]byte("x"))))
+	unknown.ContentLength = -1
+	if !needsChunkedUpload(unknown) {
+		t.Error("body of unknown length should be uploaded in chunks")
+	}
+
+	get, _ := http.NewRequest(http.MethodGet, "http://ai-backend/v1/models", nil)
+	if needsChunkedUpload(get) {
+		t.Error("request without body should not upload")
+	}
+}
@@ -10,41 +10,370 @@ import (
 
 // ClientConfig 客户端配置
 type ClientConfig struct {
-	Listen         string        `yaml:"listen"`
-	Timeout        time.Duration `yaml:"timeout"`
-	BootstrapPeers []string      `yaml:"bootstrap_peers,omitempty"` // 可选，覆盖内置默认值
+	Listen             string        `yaml:"listen"`
+	Timeout            time.Duration `yaml:"timeout"`
+	BootstrapPeers     []string      `yaml:"bootstrap_peers,omitempty"`       // 可选，覆盖内置默认值
+	NetworkID          string        `yaml:"network_id,omitempty"`            // 可选，私有网络 ID (须与 Relay/Exit 的 dht.network_id 一致)，默认公共网络 /tokengo
+	StaticRelay        string        `yaml:"static_relay,omitempty"`          // 可选，DHT 不可用时回退的 Relay 地址
+	IdlePing           time.Duration `yaml:"idle_ping,omitempty"`             // 可选，空闲连接应用层探活间隔，0 表示禁用
+	SessionKey         string        `yaml:"session_key,omitempty"`           // 可选，会话粘性键来源: header:<Name> 或 conversation
+	BasePath           string        `yaml:"base_path,omitempty"`             // 可选，路由前缀 (如 /ai)，转发前剥离
+	DHTProviderTimeout time.Duration `yaml:"dht_provider_timeout,omitempty"`  // 可选，单次 DHT Provider 查询超时，默认 10s
+	RelaySelector      string        `yaml:"relay_selector,omitempty"`        // 可选，Relay 选择策略: weighted (默认) 或 latency
+	MaxRetries         int           `yaml:"max_retries,omitempty"`           // 可选，Relay 失败时换 Relay 重试的次数，默认 2，负数禁用
+	Tenant             string        `yaml:"tenant,omitempty"`                // 可选，计费租户标识，随请求发送给 Relay 统计用量 (不会到达后端)
+	MaxExitAttempts    int           `yaml:"max_exit_attempts,omitempty"`     // 可选，单个请求最多尝试的 Exit 数 (含首选)，默认 2，1 表示不切换 Exit
+	AddressFamily      string        `yaml:"address_family,omitempty"`        // 可选，Relay 同时通告 IPv4/IPv6 时的拨号偏好: prefer-v4、prefer-v6 或 happy-eyeballs
+	EnableMDNS         bool          `yaml:"enable_mdns,omitempty"`           // 可选，启用 mDNS 局域网发现，局域网 Relay 优先
+	QUIC               QUICParams    `yaml:"quic,omitempty"`                  // 可选，到 Relay 的 QUIC 连接保活参数
+	CacheTTL           time.Duration `yaml:"cache_ttl,omitempty"`             // 可选，GET 响应的本地缓存时间 (后端 Cache-Control: max-age 优先)，0 表示不缓存
+	ExitLoadThreshold  int           `yaml:"exit_load_threshold,omitempty"`   // 可选，Exit 通告负载 (0-100) 达到该值时降低其选择优先级，0 表示不按负载选择
+	ExitKeyTTL         time.Duration `yaml:"exit_key_ttl,omitempty"`          // 可选，缓存的 Exit 公钥超过该时间后重新从 Relay 获取，0 表示不过期
+	ExitKeyMaxFailures int           `yaml:"exit_key_max_failures,omitempty"` // 可选，同一 Exit 连续解密失败该次数后重新获取公钥，默认 3，负数禁用
+	PeerCacheFile      string        `yaml:"peer_cache_file,omitempty"`       // 可选，持久化 Relay 和 Exit 公钥的缓存文件，冷启动时在 DHT 发现完成前使用
+	HedgeAfter         time.Duration `yaml:"hedge_after,omitempty"`           // 可选，非流式幂等请求超过该时间未响应时经另一个 Relay 对冲，0 表示禁用
+	ExitModel          string        `yaml:"exit_model,omitempty"`            // 可选，启动时只选择通告该模型的 Exit (未通告模型的 Exit 视为支持)，为空表示不限制
+
+	// 可选，按路径覆盖响应处理模式: auto (按客户端 stream 标志)、buffer、stream；路径以 * 结尾时按前缀匹配
+	ResponseModes map[string]string `yaml:"response_modes,omitempty"`
+
+	// 可选，按路径固定非 SSE 响应的 Content-Type (如 /v1/audio/speech: audio/mpeg)；未配置的路径沿用后端响应的 Content-Type
+	ContentTypes map[string]string `yaml:"content_types,omitempty"`
+
+	// 可选，HPKE 加密前压缩内层请求体并接受压缩的响应，默认关闭 (需所有 Exit 均已支持)
+	Compression Compression `yaml:"compression,omitempty"`
+
+	// 可选，Relay 熔断: 连续失败达到阈值的 Relay 在冷却期内不再被选择，默认关闭
+	RelayCircuitBreaker CircuitBreaker `yaml:"relay_circuit_breaker,omitempty"`
 }
 
 // RelayConfig 中继节点配置 (盲转发模式)
 // TLS 证书自动生成（绑定 PeerID），无需配置
 type RelayConfig struct {
-	Listen string    `yaml:"listen"`
-	DHT    DHTConfig `yaml:"dht,omitempty"`
+	Listen             string        `yaml:"listen"`
+	DHT                DHTConfig     `yaml:"dht,omitempty"`
+	NoAutoGenerate     bool          `yaml:"no_auto_generate,omitempty"`     // 密钥缺失时报错而不是自动生成
+	ExitReconnectGrace time.Duration `yaml:"exit_reconnect_grace,omitempty"` // Exit 断线后保留通告的宽限期，0 表示立即移除
+	CertSANs           []string      `yaml:"cert_sans,omitempty"`            // 自动生成证书附加的 SAN (域名或 IP)，供不使用 PeerID 验证的客户端
+	Metrics            MetricsConfig `yaml:"metrics,omitempty"`              // 可选，指标输出 (Prometheus 或 StatsD)
+	QUIC               QUICParams    `yaml:"quic,omitempty"`                 // 可选，Client/Exit 连接的 QUIC 保活参数
+
+	// 可选，Client 携带请求截止时间时 Exit 流生命周期的上限，默认 10m
+	MaxRequestTimeout time.Duration `yaml:"max_request_timeout,omitempty"`
+
+	Admin AdminConfig `yaml:"admin,omitempty"` // 可选，管理 HTTP 接口 (如踢出异常 Exit)
+
+	ClientRateLimit RateLimitConfig `yaml:"client_rate_limit,omitempty"` // 可选，按 Client 来源 IP 限制转发请求速率
+}
+
+// RateLimitConfig 令牌桶限流配置，requests_per_second 为 0 时不限流
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second,omitempty"` // 每秒允许的请求数
+	Burst             int     `yaml:"burst,omitempty"`               // 允许的突发请求数，默认取 requests_per_second 向上取整
+}
+
+// AdminConfig Relay 管理接口配置，listen 为空时不启动
+type AdminConfig struct {
+	Listen string `yaml:"listen,omitempty"` // 管理 HTTP 服务监听地址，建议只监听本机或内网
+	Token  string `yaml:"token,omitempty"`  // 管理请求需携带的 Bearer token，启用时必填
 }
 
 // ExitConfig 出口节点配置
 // TLS 证书验证通过 PeerID 自动完成，无需配置 insecure_skip_verify
 type ExitConfig struct {
-	OHTTPPrivateKeyFile string    `yaml:"ohttp_private_key_file"`
-	OHTTPPublicKeyFile  string    `yaml:"ohttp_public_key_file,omitempty"` // 可选，默认为私钥文件 + ".pub"
-	AIBackend           AIBackend `yaml:"ai_backend"`
-	DHT                 DHTConfig `yaml:"dht,omitempty"`
+	Listen                  string    `yaml:"listen,omitempty"` // 可选，直连模式 HTTP OHTTP 服务监听地址，为空时不启动 (纯隧道模式)
+	OHTTPPrivateKeyFile     string    `yaml:"ohttp_private_key_file"`
+	OHTTPPublicKeyFile      string    `yaml:"ohttp_public_key_file,omitempty"`      // 可选，默认为私钥文件 + ".pub"
+	AdditionalOHTTPKeyFiles []string  `yaml:"additional_ohttp_key_files,omitempty"` // 密钥轮换重叠期内仍接受的私钥文件 (公钥为同名 .pub)
+	OHTTPAEADs              []string  `yaml:"ohttp_aeads,omitempty"`                // 接受的 AEAD 算法 (aes-128-gcm/chacha20-poly1305)，按偏好顺序在 KeyConfig 中通告，默认 aes-128-gcm
+	AIBackend               AIBackend `yaml:"ai_backend"`
+	DHT                     DHTConfig `yaml:"dht,omitempty"`
+	NoAutoGenerate          bool      `yaml:"no_auto_generate,omitempty"`          // 密钥缺失时报错而不是自动生成
+	RelayProbeConcurrency   int       `yaml:"relay_probe_concurrency,omitempty"`   // 并行探测 Relay 的并发上限，默认 4
+	MaxResponseHeaders      int       `yaml:"max_response_headers,omitempty"`      // 转发给 Client 的响应头最大行数，默认 100
+	MaxResponseHeaderBytes  int       `yaml:"max_response_header_bytes,omitempty"` // 转发给 Client 的响应头最大字节数，默认 64KB
+	MaxRegisterAttempts     int       `yaml:"max_register_attempts,omitempty"`     // 连续注册失败上限，达到后退出；0 表示无限重试
+	Capabilities            []string  `yaml:"capabilities,omitempty"`              // 后端支持的端点族 (chat/embeddings/images/audio)，为空表示全部
+
+	// 可选，向 Client 通告的推荐请求超时 (慢速后端可调大)，0 表示不通告，Client 使用自身 timeout
+	RequestTimeout time.Duration `yaml:"request_timeout,omitempty"`
+
+	// 可选，单个 Relay 连接上同时处理的请求流上限，超出时立即返回 "too many requests"，0 表示不限制
+	MaxConcurrentStreams int `yaml:"max_concurrent_streams,omitempty"`
+
+	// 可选，入站流处理池的 worker 数 (默认每 CPU 64 个) 和等待队列长度 (默认同 worker 数)
+	// worker 和队列均满时新流立即返回 "too many requests"，限制突发流量下的 goroutine 数和后端压力
+	StreamWorkers int `yaml:"stream_workers,omitempty"`
+	StreamQueue   int `yaml:"stream_queue,omitempty"`
+
+	// 可选，解密后请求体的最大字节数，超出时返回 413 且不转发，0 表示不限制
+	MaxRequestBytes int64 `yaml:"max_request_bytes,omitempty"`
+
+	// 可选，AI 后端响应体的最大字节数 (流式响应按累计字节数)，超出时丢弃响应或中止流，0 表示不限制
+	MaxResponseBytes int64 `yaml:"max_response_bytes,omitempty"`
+
+	// 可选，流式 SSE 响应超过该时间未收到后端数据时注入注释保活 (": keepalive")，
+	// 避免慢速首 token 期间中间代理或 Client 写超时断开，0 表示禁用
+	SSEKeepalive time.Duration `yaml:"sse_keepalive,omitempty"`
+
+	// 可选，按 model 字段路由到不同后端，按顺序匹配，未匹配时使用 ai_backend
+	Backends []BackendRule `yaml:"backends,omitempty"`
+
+	// 可选，Exit 级别的访问控制: 只处理匹配路径前缀和模型的请求，其余返回 403，默认不限制
+	AccessControl AccessControl `yaml:"access_control,omitempty"`
+
+	// 可选，启动时等待 AI 后端健康检查 (ai_backend.health_check) 通过后再注册到 Relay 和 DHT
+	WaitForBackend bool `yaml:"wait_for_backend,omitempty"`
+
+	// 可选，指标输出 (Prometheus 或 StatsD)
+	Metrics MetricsConfig `yaml:"metrics,omitempty"`
+
+	// 可选，每个请求记录一行访问日志 (方法、路径、状态、耗时、网关请求 ID、后端响应 ID)
+	AccessLog bool `yaml:"access_log,omitempty"`
+
+	// 可选，按模型输出累计 token 用量日志的间隔 (期间没有新用量时不输出)，默认 5m
+	UsageLogInterval time.Duration `yaml:"usage_log_interval,omitempty"`
+
+	// 可选，后端瞬时错误 (连接失败/重置、502/503/504 等) 时在 Exit 内指数退避重试，对所有后端生效
+	BackendRetry BackendRetry `yaml:"backend_retry,omitempty"`
+
+	// 可选，Relay 同时通告 IPv4/IPv6 时的拨号偏好: prefer-v4、prefer-v6 或 happy-eyeballs (竞速)，默认使用第一个通告地址
+	AddressFamily string `yaml:"address_family,omitempty"`
+
+	// 可选，DHT 发现 Relay 失败或为空 (如网络屏蔽了 DHT) 时，从 bootstrap.json 的 relays 列表选择 Relay
+	BootstrapRelayFallback bool `yaml:"bootstrap_relay_fallback,omitempty"`
+
+	// 备用 Relay 列表使用的 bootstrap.json 地址 (启用 bootstrap_relay_fallback 时必填，内置的 bootstrap.json 不含 relays)
+	BootstrapRelayURLs []string `yaml:"bootstrap_relay_urls,omitempty"`
+
+	// 可选，Client 声明接受压缩时在 HPKE 加密前压缩非流式响应体，默认关闭 (压缩的请求体始终可以解压)
+	Compression Compression `yaml:"compression,omitempty"`
+
+	// 可选，注册时通告的选择权重和可服务模型，Client 据此偏向容量大的 Exit 并按请求 model 筛选
+	Advertise ExitAdvertise `yaml:"advertise,omitempty"`
+
+	// 可选，反向隧道 QUIC 连接保活参数 (默认保活 10s、空闲超时 60s，便于维持 NAT 映射)
+	QUIC QUICParams `yaml:"quic,omitempty"`
+}
+
+// ExitAdvertise Exit 按后端容量通告的选择信息
+type ExitAdvertise struct {
+	Weight int      `yaml:"weight,omitempty"` // 选择权重 (如后端 GPU 数)，0 表示不通告 (Client 按 1 处理)
+	Models []string `yaml:"models,omitempty"` // 可服务的模型，以 * 结尾时按前缀匹配；为空表示不限制
+
+	// 额定并发请求数，心跳按进行中请求数占它的比例通告负载；0 时取 max_concurrent_streams，两者均未配置时不通告负载
+	Capacity int `yaml:"capacity,omitempty"`
+
+	// 从各后端的 GET /v1/models 查询可服务的模型，与 models 合并后通告，并按 models_refresh 定期刷新 (默认 10m)
+	DiscoverModels bool          `yaml:"discover_models,omitempty"`
+	ModelsRefresh  time.Duration `yaml:"models_refresh,omitempty"`
+}
+
+// QUIC 连接保活默认值 (Client 和 Relay)
+const (
+	DefaultQUICKeepAlivePeriod = 30 * time.Second
+	DefaultQUICMaxIdleTimeout  = 120 * time.Second
+)
+
+// Exit 反向隧道的保活默认值: Exit 通常位于 NAT 之后，使用更短的保活间隔
+const (
+	DefaultExitQUICKeepAlivePeriod = 10 * time.Second
+	DefaultExitQUICMaxIdleTimeout  = 60 * time.Second
+)
+
+// QUICParams QUIC 连接保活参数
+// 位于激进 NAT 之后时可调小保活间隔，链路稳定时可调大空闲超时；未配置的字段使用默认值
+type QUICParams struct {
+	KeepAlivePeriod time.Duration `yaml:"keep_alive_period,omitempty"` // 空闲时发送保活包的间隔
+	MaxIdleTimeout  time.Duration `yaml:"max_idle_timeout,omitempty"`  // 无任何数据往来时关闭连接的时间
+
+	// 启用 QUIC datagram (RFC 9221): Exit 以 datagram 发送心跳，省去每次打开流的开销
+	// 仅在 Relay 和 Exit 均启用时生效，否则回退到流；Client 不使用
+	EnableDatagrams bool `yaml:"enable_datagrams,omitempty"`
+
+	// 单个连接的最长存活时间，到期后优雅回收 (先建立新连接，进行中的请求完成后关闭旧连接)，0 表示不限制
+	// Relay 作用于 Client 连接，Exit 作用于反向隧道；Client 不使用
+	MaxLifetime time.Duration `yaml:"max_lifetime,omitempty"`
+
+	// 启用 0-RTT: 恢复会话时请求随握手一起发送，省去一个往返
+	// 0-RTT 数据可被重放，默认仅恢复会话；Relay 启用后才接受 0-RTT，Client/Exit 启用后才发送
+	Enable0RTT bool `yaml:"enable_0rtt,omitempty"`
+}
+
+// DefaultQUICParams 返回 Client 和 Relay 的默认 QUIC 保活参数
+func DefaultQUICParams() QUICParams {
+	return QUICParams{
+		KeepAlivePeriod: DefaultQUICKeepAlivePeriod,
+		MaxIdleTimeout:  DefaultQUICMaxIdleTimeout,
+	}
+}
+
+// DefaultExitQUICParams 返回 Exit 反向隧道的默认 QUIC 保活参数
+func DefaultExitQUICParams() QUICParams {
+	return QUICParams{
+		KeepAlivePeriod: DefaultExitQUICKeepAlivePeriod,
+		MaxIdleTimeout:  DefaultExitQUICMaxIdleTimeout,
+	}
+}
+
+// WithDefaults 用 defaults 填充未配置 (<=0) 的字段
+func (p QUICParams) WithDefaults(defaults QUICParams) QUICParams {
+	if p.KeepAlivePeriod <= 0 {
+		p.KeepAlivePeriod = defaults.KeepAlivePeriod
+	}
+	if p.MaxIdleTimeout <= 0 {
+		p.MaxIdleTimeout = defaults.MaxIdleTimeout
+	}
+	return p
+}
+
+// Validate 检查保活间隔小于空闲超时，否则连接会在保活包发出前因空闲被关闭
+func (p QUICParams) Validate() error {
+	if p.KeepAlivePeriod >= p.MaxIdleTimeout {
+		return fmt.Errorf("quic.keep_alive_period (%s) 必须小于 quic.max_idle_timeout (%s)", p.KeepAlivePeriod, p.MaxIdleTimeout)
+	}
+	if p.MaxLifetime < 0 {
+		return fmt.Errorf("quic.max_lifetime (%s) 不能为负数", p.MaxLifetime)
+	}
+	return nil
+}
+
+// MetricsConfig 指标输出配置
+// backend 为空时不输出指标
+type MetricsConfig struct {
+	Backend string `yaml:"backend,omitempty"` // prometheus 或 statsd
+	Listen  string `yaml:"listen,omitempty"`  // prometheus: /metrics HTTP 服务监听地址
+	Address string `yaml:"address,omitempty"` // statsd: 推送目标 host:port (UDP)
+	Prefix  string `yaml:"prefix,omitempty"`  // 指标名前缀，默认 tokengo
+}
+
+// Compression 内层 HTTP 体压缩配置 (HPKE 加密前压缩，与传输层无关)，algorithm 为空时不压缩
+type Compression struct {
+	Algorithm string `yaml:"algorithm,omitempty"` // gzip 或 zstd
+	MinSize   int    `yaml:"min_size,omitempty"`  // 体积达到该字节数才压缩，默认 1024
+}
+
+// CircuitBreaker 节点熔断配置，threshold 为 0 时不启用
+type CircuitBreaker struct {
+	Threshold int           `yaml:"threshold,omitempty"` // window 内连续失败该次数后熔断节点
+	Window    time.Duration `yaml:"window,omitempty"`    // 统计连续失败的时间窗口，0 表示不限
+	Cooldown  time.Duration `yaml:"cooldown,omitempty"`  // 熔断时长，结束后放行一个探测请求，默认 30s
+}
+
+// AccessControl Exit 的请求允许列表，对所有后端生效，字段为空表示该项不限制
+type AccessControl struct {
+	AllowedPaths  []string `yaml:"allowed_paths,omitempty"`  // 允许的路径前缀 (按路径段匹配)
+	AllowedModels []string `yaml:"allowed_models,omitempty"` // 允许的模型名模式，语法同 backends[].models；不含 model 字段的请求不受限制
+}
+
+// BackendRule 按请求体 model 字段选择 AI 后端的路由规则
+type BackendRule struct {
+	Models  []string  `yaml:"models"`  // 模型名模式: 精确匹配、前缀 (gpt-4*) 或通配符 (llama3*:?b)
+	Backend AIBackend `yaml:"backend"` // 匹配时使用的后端
 }
 
 // AIBackend AI 后端配置
 type AIBackend struct {
-	URL     string            `yaml:"url"`
-	APIKey  string            `yaml:"api_key"`
-	Headers map[string]string `yaml:"headers,omitempty"`
+	URL         string            `yaml:"url"`
+	URLs        []string          `yaml:"urls,omitempty"` // 同一服务的其他实例，与 url 组成故障转移池 (url 优先)
+	APIKey      string            `yaml:"api_key"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	HealthCheck HealthCheck       `yaml:"health_check,omitempty"`
+	ModelSplits []ModelSplit      `yaml:"model_splits,omitempty"`
+	RequestID   RequestID         `yaml:"request_id,omitempty"`
+	Normalize   Normalize         `yaml:"normalize,omitempty"`
+
+	// 可选，后端返回 429 时在 Exit 内按 Retry-After 等待后重试，未配置时原样返回 429
+	RateLimitRetry RateLimitRetry `yaml:"rate_limit_retry,omitempty"`
+
+	// 可选，允许转发到后端的请求路径前缀 (按路径段匹配，如 /v1/chat)，为空表示不限制；含 . 或 .. 段的路径始终拒绝
+	AllowedPaths []string `yaml:"allowed_paths,omitempty"`
+
+	// 可选，同时转发到该后端的请求上限，0 表示不限制；达到上限时按模型加权公平排队，一个模型的突发请求不会饿死其他模型
+	MaxConcurrent int `yaml:"max_concurrent,omitempty"`
+	// 可选，按模型的公平排队权重 (默认 1)，权重 2 的模型在竞争时获得两倍份额；需配置 max_concurrent
+	ModelWeights map[string]int `yaml:"model_weights,omitempty"`
+	// 可选，请求排队等待并发配额的上限，超时后以 queue timeout 拒绝 (Client 可换 Exit 重试)，0 表示一直等待；需配置 max_concurrent
+	QueueTimeout time.Duration `yaml:"queue_timeout,omitempty"`
+}
+
+// RateLimitRetry 后端限流 (429) 重试配置
+// Retry-After 超过 MaxWait 时不再等待，直接返回 429；缺少 Retry-After 时等待 1s (不超过 MaxWait)
+type RateLimitRetry struct {
+	MaxAttempts int           `yaml:"max_attempts,omitempty"` // 含首次请求的总尝试次数，<= 1 表示不重试
+	MaxWait     time.Duration `yaml:"max_wait,omitempty"`     // 单次等待上限，默认 10s
+}
+
+// BackendRetry 后端瞬时错误的指数退避重试配置
+// 第 n 次重试前等待 base_delay * 2^(n-1) (不超过 max_delay)，响应带 Retry-After 时按其等待；Retry-After 超过 max_delay 时不重试
+type BackendRetry struct {
+	MaxRetries int           `yaml:"max_retries,omitempty"` // 首次请求之外的最大重试次数，0 表示不重试
+	BaseDelay  time.Duration `yaml:"base_delay,omitempty"`  // 首次重试前的等待时间，默认 200ms
+	MaxDelay   time.Duration `yaml:"max_delay,omitempty"`   // 单次等待上限，默认 5s
+	Statuses   []int         `yaml:"statuses,omitempty"`    // 可重试的响应状态码，默认 429/502/503/504
+}
+
+// ModelSplit 模型版本流量拆分 (A/B 测试)
+// 请求 Model 的流量按 CanaryPercent 比例改写为 Canary 模型，其余发往 Primary
+type ModelSplit struct {
+	Model         string  `yaml:"model"`          // 客户端请求的模型名
+	Primary       string  `yaml:"primary"`        // 主版本模型，默认为 Model
+	Canary        string  `yaml:"canary"`         // 实验版本模型
+	CanaryPercent float64 `yaml:"canary_percent"` // 发往 Canary 的百分比 (0-100)
+}
+
+// Normalize 响应归一化配置，将非标准后端的响应改写为 OpenAI 规范格式
+// 未配置任何规则时不改写响应
+type Normalize struct {
+	FinishReasons   map[string]string `yaml:"finish_reasons,omitempty"`   // finish_reason 映射，如 stop_sequence: stop
+	SynthesizeUsage bool              `yaml:"synthesize_usage,omitempty"` // 非流式响应缺少 usage 时补全零值 usage
+}
+
+// RequestID 请求 ID 关联配置
+// Header 为空时不做任何处理；客户端提供的 ID 原样转发，缺失时按 Generate 决定是否生成
+type RequestID struct {
+	Header   string `yaml:"header,omitempty"`   // 转发给后端及回显给客户端的 header，如 X-Request-ID
+	Generate bool   `yaml:"generate,omitempty"` // 客户端未提供时生成新 ID
+}
+
+// HealthCheck AI 后端健康检查配置 (就绪检查和多实例故障转移使用)
+// 不同后端的健康端点不同，如 /health、/v1/models、/api/tags
+type HealthCheck struct {
+	Path           string        `yaml:"path,omitempty"`            // 默认 /v1/models
+	Method         string        `yaml:"method,omitempty"`          // 默认 GET
+	Interval       time.Duration `yaml:"interval,omitempty"`        // 配置多个实例时的后台探测间隔，默认 10s
+	ExpectedStatus int           `yaml:"expected_status,omitempty"` // 默认 200
+	Disabled       bool          `yaml:"disabled,omitempty"`        // 后端无健康端点时禁用探测
 }
 
 // DHTConfig DHT 配置
 type DHTConfig struct {
-	BootstrapPeers []string `yaml:"bootstrap_peers,omitempty"`
-	ListenAddrs    []string `yaml:"listen_addrs,omitempty"`
-	ExternalAddrs  []string `yaml:"external_addrs,omitempty"`
-	PrivateKeyFile string   `yaml:"private_key_file,omitempty"`
-	Mode           string   `yaml:"mode,omitempty"` // "server" or "client"
+	BootstrapPeers  []string      `yaml:"bootstrap_peers,omitempty"`
+	ListenAddrs     []string      `yaml:"listen_addrs,omitempty"`
+	ExternalAddrs   []string      `yaml:"external_addrs,omitempty"`
+	PrivateKeyFile  string        `yaml:"private_key_file,omitempty"`
+	Mode            string        `yaml:"mode,omitempty"`             // "server" or "client"
+	ProviderTimeout time.Duration `yaml:"provider_timeout,omitempty"` // 单次 Provider 查询超时，默认 10s
+
+	// 可选，服务注册重试: 首次等待 (默认 3s)、等待上限 (默认 30s)、启动时最大尝试次数 (默认 5)
+	// 尝试耗尽后在后台继续重试
+	RegisterMinBackoff time.Duration `yaml:"register_min_backoff,omitempty"`
+	RegisterMaxBackoff time.Duration `yaml:"register_max_backoff,omitempty"`
+	RegisterMaxRetries int           `yaml:"register_max_retries,omitempty"`
+
+	// 可选，启用 mDNS 局域网发现: 同一子网的节点无需 Bootstrap 即可互相发现
+	EnableMDNS bool `yaml:"enable_mdns,omitempty"`
+
+	// 可选，节点缓存文件: 持久化最近发现的 Relay，冷启动时探测可达后立即使用，DHT 发现在后台继续
+	CacheFile string `yaml:"cache_file,omitempty"`
+
+	// 可选，网络 ID: DHT 协议前缀和服务命名空间变为 /tokengo/<id>，私有部署以此与公共网络隔离
+	// Client、Relay、Exit 须配置相同的值，不同网络 ID 的节点互不发现
+	NetworkID string `yaml:"network_id,omitempty"`
+
+	// 可选，身份密钥轮换期间的旧身份密钥文件 (必须存在)
+	// 节点同时以新旧 PeerID 在 DHT 通告，证书可按任一 PeerID 验证；迁移完成后移除
+	TransitionalPrivateKeyFile string `yaml:"transitional_private_key_file,omitempty"`
 }
 
 // LoadClientConfig 加载客户端配置
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQUICParams_WithDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   QUICParams
+		defaults QUICParams
+		want     QUICParams
+	}{
+		{"empty uses defaults", QUICParams{}, DefaultQUICParams(), QUICParams{KeepAlivePeriod: 30 * time.Second, MaxIdleTimeout: 120 * time.Second}},
+		{"exit defaults", QUICParams{}, DefaultExitQUICParams(), QUICParams{KeepAlivePeriod: 10 * time.Second, MaxIdleTimeout: 60 * time.Second}},
+		{"keepalive only", QUICParams{KeepAlivePeriod: 5 * time.Second}, DefaultQUICParams(), QUICParams{KeepAlivePeriod: 5 * time.Second, MaxIdleTimeout: 120 * time.Second}},
+		{"idle only", QUICParams{MaxIdleTimeout: 10 * time.Minute}, DefaultQUICParams(), QUICParams{KeepAlivePeriod: 30 * time.Second, MaxIdleTimeout: 10 * time.Minute}},
+		{"datagrams preserved", QUICParams{EnableDatagrams: true}, DefaultQUICParams(), QUICParams{KeepAlivePeriod: 30 * time.Second, MaxIdleTimeout: 120 * time.Second, EnableDatagrams: true}},
+		{"negative treated as unset", QUICParams{KeepAlivePeriod: -time.Second, MaxIdleTimeout: -time.Second}, DefaultQUICParams(), DefaultQUICParams()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.params.WithDefaults(tt.defaults); got != tt.want {
+				t.Errorf("WithDefaults = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQUICParams_Validate(t *testing.T) {
+	if err := DefaultQUICParams().Validate(); err != nil {
+		t.Errorf("default params invalid: %v", err)
+	}
+	if err := DefaultExitQUICParams().Validate(); err != nil {
+		t.Errorf("default exit params invalid: %v", err)
+	}
+
+	// 只调大保活间隔而未调大空闲超时时，默认空闲超时不足以覆盖保活间隔
+	p := QUICParams{KeepAlivePeriod: 3 * time.Minute}.WithDefaults(DefaultQUICParams())
+	if err := p.Validate(); err == nil {
+		t.Error("keepalive >= idle timeout should be rejected")
+	}
+	if err := (QUICParams{KeepAlivePeriod: time.Minute, MaxIdleTimeout: time.Minute}).Validate(); err == nil {
+		t.Error("keepalive == idle timeout should be rejected")
+	}
+	if err := (QUICParams{KeepAlivePeriod: time.Second, MaxIdleTimeout: time.Minute, MaxLifetime: -time.Hour}).Validate(); err == nil {
+		t.Error("negative max lifetime should be rejected")
+	}
+}
+
+// writeConfig 写入 YAML 配置文件并返回路径
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestClientConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string // 为空表示应通过
+	}{
+		{"defaults", "", ""},
+		{"listen without port", "listen: 127.0.0.1", "listen 地址无效"},
+		{"listen bad port", "listen: 127.0.0.1:http", "listen 端口无效"},
+		{"bad bootstrap peer", "bootstrap_peers: [not-a-multiaddr]", "bootstrap_peers 地址"},
+		{"load threshold out of range", "exit_load_threshold: 150", "exit_load_threshold"},
+		{"negative exit key ttl", "exit_key_ttl: -1s", "exit_key_ttl 不能为负数"},
+		{"unknown response mode", "response_modes: {/v1/chat/completions: fast}", "未知的响应模式"},
+		{"keepalive exceeds idle timeout", "quic: {keep_alive_period: 5m}", "quic.keep_alive_period"},
+		{"unknown compression", "compression: {algorithm: brotli}", "compression.algorithm"},
+		{"negative circuit cooldown", "relay_circuit_breaker: {threshold: 3, cooldown: -1s}", "relay_circuit_breaker.cooldown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadClientConfig(writeConfig(t, tt.yaml))
+			if err != nil {
+				t.Fatalf("LoadClientConfig failed: %v", err)
+			}
+			checkValidateErr(t, cfg.Validate(), tt.wantErr)
+		})
+	}
+}
+
+func TestRelayConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"defaults", "", ""},
+		{"admin without token", "admin: {listen: 127.0.0.1:9090}", "admin.token"},
+		{"unknown dht mode", "dht: {mode: peer}", "dht.mode"},
+		{"missing transitional key", "dht: {transitional_private_key_file: /nonexistent/old.key}", "dht.transitional_private_key_file"},
+		{"prometheus without listen", "metrics: {backend: prometheus}", "metrics.listen"},
+		{"unknown metrics backend", "metrics: {backend: graphite}", "未知的指标后端"},
+		{"negative rate limit", "client_rate_limit: {requests_per_second: -1}", "client_rate_limit.requests_per_second"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadRelayConfig(writeConfig(t, tt.yaml))
+			if err != nil {
+				t.Fatalf("LoadRelayConfig failed: %v", err)
+			}
+			checkValidateErr(t, cfg.Validate(), tt.wantErr)
+		})
+	}
+}
+
+func TestExitConfig_Validate(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "ohttp_private.key")
+	os.WriteFile(keyFile, []byte("priv"), 0600)
+	os.WriteFile(keyFile+".pub", []byte("pub"), 0600)
+	keys := "ohttp_private_key_file: " + keyFile + "\n"
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"valid", keys, ""},
+		{"missing key file setting", "", "必须配置 ohttp_private_key_file"},
+		{"key file does not exist", "ohttp_private_key_file: " + filepath.Join(dir, "missing.key"), "ohttp_private_key_file 文件不可用"},
+		{"public key does not exist", keys + "ohttp_public_key_file: " + filepath.Join(dir, "missing.pub"), "ohttp_public_key_file 文件不可用"},
+		{"additional key does not exist", keys + "additional_ohttp_key_files: [" + filepath.Join(dir, "old.key") + "]", "additional_ohttp_key_files"},
+		{"backend url without scheme", keys + "ai_backend: {url: localhost:11434}", "ai_backend.url"},
+		{"routed backend without models", keys + "backends: [{backend: {url: http://localhost:8000}}]", "backends[0].models"},
+		{"non-positive model weight", keys + "ai_backend: {max_concurrent: 4, model_weights: {gpt-4o: 0}}", "model_weights[gpt-4o]"},
+		{"negative queue timeout", keys + "ai_backend: {queue_timeout: -1s}", "queue_timeout 不能为负数"},
+		{"bad listen", keys + "listen: :99999", "listen 端口无效"},
+		{"bad dht listen addr", keys + "dht: {listen_addrs: [0.0.0.0:4001]}", "dht.listen_addrs"},
+		{"relative access control path", keys + "access_control: {allowed_paths: [v1/chat]}", "access_control.allowed_paths"},
+		{"bad access control model pattern", keys + "access_control: {allowed_models: [\"gpt-[\"]}", "access_control.allowed_models"},
+		{"bad bootstrap relay url", keys + "bootstrap_relay_urls: [\"ftp://example.com/bootstrap.json\"]", "bootstrap_relay_urls"},
+		{"bootstrap relay fallback without urls", keys + "bootstrap_relay_fallback: true", "bootstrap_relay_urls"},
+		{"negative compression min size", keys + "compression: {algorithm: gzip, min_size: -1}", "compression.min_size"},
+		{"negative models refresh", keys + "advertise: {discover_models: true, models_refresh: -1m}", "advertise.models_refresh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadExitConfig(writeConfig(t, tt.yaml))
+			if err != nil {
+				t.Fatalf("LoadExitConfig failed: %v", err)
+			}
+			checkValidateErr(t, cfg.Validate(), tt.wantErr)
+		})
+	}
+}
+
+func checkValidateErr(t *testing.T, err error, want string) {
+	t.Helper()
+	if want == "" {
+		if err != nil {
+			t.Errorf("Validate = %v, want nil", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Validate = %v, want error containing %q", err, want)
+	}
+}
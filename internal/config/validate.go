@@ -0,0 +1,329 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Validate 检查客户端配置的语义错误 (不启动任何服务)，返回发现的全部问题
+func (c *ClientConfig) Validate() error {
+	errs := []error{checkHostPort("listen", c.Listen)}
+	if c.StaticRelay != "" {
+		errs = append(errs, checkHostPort("static_relay", c.StaticRelay))
+	}
+	errs = append(errs,
+		checkMultiaddrs("bootstrap_peers", c.BootstrapPeers),
+		checkNonNegative("timeout", c.Timeout),
+		checkNonNegative("idle_ping", c.IdlePing),
+		checkNonNegative("dht_provider_timeout", c.DHTProviderTimeout),
+		checkNonNegative("cache_ttl", c.CacheTTL),
+		checkNonNegative("exit_key_ttl", c.ExitKeyTTL),
+		checkNonNegative("hedge_after", c.HedgeAfter),
+		c.QUIC.WithDefaults(DefaultQUICParams()).Validate(),
+		c.Compression.validate(),
+		c.RelayCircuitBreaker.validate("relay_circuit_breaker"),
+	)
+	if c.MaxExitAttempts < 0 {
+		errs = append(errs, fmt.Errorf("max_exit_attempts 不能为负数: %d", c.MaxExitAttempts))
+	}
+	if c.ExitLoadThreshold < 0 || c.ExitLoadThreshold > 100 {
+		errs = append(errs, fmt.Errorf("exit_load_threshold 必须在 0-100 之间: %d", c.ExitLoadThreshold))
+	}
+	for path, mode := range c.ResponseModes {
+		switch mode {
+		case "auto", "buffer", "stream":
+		default:
+			errs = append(errs, fmt.Errorf("response_modes[%s] 未知的响应模式: %q (支持: auto, buffer, stream)", path, mode))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate 检查中继节点配置的语义错误 (不启动任何服务)，返回发现的全部问题
+func (c *RelayConfig) Validate() error {
+	errs := []error{
+		checkHostPort("listen", c.Listen),
+		c.DHT.validate(),
+		checkNonNegative("exit_reconnect_grace", c.ExitReconnectGrace),
+		checkNonNegative("max_request_timeout", c.MaxRequestTimeout),
+		c.Metrics.validate(),
+		c.QUIC.WithDefaults(DefaultQUICParams()).Validate(),
+	}
+	if c.ClientRateLimit.RequestsPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("client_rate_limit.requests_per_second 不能为负数: %v", c.ClientRateLimit.RequestsPerSecond))
+	}
+	if c.ClientRateLimit.Burst < 0 {
+		errs = append(errs, fmt.Errorf("client_rate_limit.burst 不能为负数: %d", c.ClientRateLimit.Burst))
+	}
+	if c.Admin.Listen != "" {
+		errs = append(errs, checkHostPort("admin.listen", c.Admin.Listen))
+		if c.Admin.Token == "" {
+			errs = append(errs, fmt.Errorf("启用 admin.listen 时必须配置 admin.token"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate 检查出口节点配置的语义错误 (不启动任何服务)，返回发现的全部问题
+// 密钥文件只检查是否存在，内容由加载时解析
+func (c *ExitConfig) Validate() error {
+	var errs []error
+	if c.Listen != "" {
+		errs = append(errs, checkHostPort("listen", c.Listen))
+	}
+	if c.OHTTPPrivateKeyFile == "" {
+		errs = append(errs, fmt.Errorf("必须配置 ohttp_private_key_file"))
+	} else {
+		pubKeyFile := c.OHTTPPublicKeyFile
+		if pubKeyFile == "" {
+			pubKeyFile = c.OHTTPPrivateKeyFile + ".pub"
+		}
+		errs = append(errs,
+			checkFileExists("ohttp_private_key_file", c.OHTTPPrivateKeyFile),
+			checkFileExists("ohttp_public_key_file", pubKeyFile),
+		)
+	}
+	for _, path := range c.AdditionalOHTTPKeyFiles {
+		errs = append(errs,
+			checkFileExists("additional_ohttp_key_files", path),
+			checkFileExists("additional_ohttp_key_files", path+".pub"),
+		)
+	}
+
+	errs = append(errs, c.AIBackend.validate("ai_backend"))
+	for i, rule := range c.Backends {
+		prefix := fmt.Sprintf("backends[%d]", i)
+		if len(rule.Models) == 0 {
+			errs = append(errs, fmt.Errorf("%s.models 不能为空", prefix))
+		}
+		errs = append(errs, rule.Backend.validate(prefix+".backend"))
+	}
+	errs = append(errs, c.AccessControl.validate(), c.Compression.validate())
+	if c.BootstrapRelayFallback && len(c.BootstrapRelayURLs) == 0 {
+		// 内置的 bootstrap.json 只发布 DHT bootstrap peers，不含 relays
+		errs = append(errs, fmt.Errorf("启用 bootstrap_relay_fallback 时必须配置 bootstrap_relay_urls"))
+	}
+	for _, u := range c.BootstrapRelayURLs {
+		if err := checkHTTPURL(u); err != nil {
+			errs = append(errs, fmt.Errorf("bootstrap_relay_urls %q 无效: %w", u, err))
+		}
+	}
+
+	errs = append(errs,
+		c.DHT.validate(),
+		checkNonNegative("request_timeout", c.RequestTimeout),
+		checkNonNegative("sse_keepalive", c.SSEKeepalive),
+		checkNonNegative("usage_log_interval", c.UsageLogInterval),
+		checkNonNegative("advertise.models_refresh", c.Advertise.ModelsRefresh),
+		checkNonNegative("backend_retry.base_delay", c.BackendRetry.BaseDelay),
+		checkNonNegative("backend_retry.max_delay", c.BackendRetry.MaxDelay),
+		c.Metrics.validate(),
+		c.QUIC.WithDefaults(DefaultExitQUICParams()).Validate(),
+	)
+	for _, f := range []struct {
+		name string
+		n    int
+	}{
+		{"max_concurrent_streams", c.MaxConcurrentStreams},
+		{"stream_workers", c.StreamWorkers},
+		{"stream_queue", c.StreamQueue},
+		{"max_register_attempts", c.MaxRegisterAttempts},
+		{"backend_retry.max_retries", c.BackendRetry.MaxRetries},
+		{"advertise.weight", c.Advertise.Weight},
+		{"advertise.capacity", c.Advertise.Capacity},
+	} {
+		if f.n < 0 {
+			errs = append(errs, fmt.Errorf("%s 不能为负数: %d", f.name, f.n))
+		}
+	}
+	if c.MaxRequestBytes < 0 {
+		errs = append(errs, fmt.Errorf("max_request_bytes 不能为负数: %d", c.MaxRequestBytes))
+	}
+	if c.MaxResponseBytes < 0 {
+		errs = append(errs, fmt.Errorf("max_response_bytes 不能为负数: %d", c.MaxResponseBytes))
+	}
+	return errors.Join(errs...)
+}
+
+// validate 检查 AI 后端地址和排队参数，prefix 为错误信息中的字段路径
+func (b *AIBackend) validate(prefix string) error {
+	var errs []error
+	for _, u := range append([]string{b.URL}, b.URLs...) {
+		if err := checkHTTPURL(u); err != nil {
+			errs = append(errs, fmt.Errorf("%s.url %q 无效: %w", prefix, u, err))
+		}
+	}
+	if b.MaxConcurrent < 0 {
+		errs = append(errs, fmt.Errorf("%s.max_concurrent 不能为负数: %d", prefix, b.MaxConcurrent))
+	}
+	for model, weight := range b.ModelWeights {
+		if weight <= 0 {
+			errs = append(errs, fmt.Errorf("%s.model_weights[%s] 必须为正数: %d", prefix, model, weight))
+		}
+	}
+	if b.QueueTimeout < 0 {
+		errs = append(errs, fmt.Errorf("%s.queue_timeout 不能为负数: %v", prefix, b.QueueTimeout))
+	}
+	for _, split := range b.ModelSplits {
+		if split.CanaryPercent < 0 || split.CanaryPercent > 100 {
+			errs = append(errs, fmt.Errorf("%s.model_splits[%s].canary_percent 必须在 0-100 之间: %v", prefix, split.Model, split.CanaryPercent))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate 检查访问控制的路径前缀和模型模式
+func (a *AccessControl) validate() error {
+	var errs []error
+	for _, p := range a.AllowedPaths {
+		if !strings.HasPrefix(p, "/") {
+			errs = append(errs, fmt.Errorf("access_control.allowed_paths 路径必须以 / 开头: %q", p))
+		}
+	}
+	for _, m := range a.AllowedModels {
+		if m == "" {
+			errs = append(errs, fmt.Errorf("access_control.allowed_models 模型模式不能为空"))
+			continue
+		}
+		if _, err := path.Match(m, ""); err != nil {
+			errs = append(errs, fmt.Errorf("access_control.allowed_models 无效的模型模式 %q: %w", m, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate 检查压缩算法和最小压缩体积
+func (c *Compression) validate() error {
+	var errs []error
+	switch c.Algorithm {
+	case "", "none", "gzip", "zstd":
+	default:
+		errs = append(errs, fmt.Errorf("compression.algorithm 未知的压缩算法: %q (支持: gzip, zstd)", c.Algorithm))
+	}
+	if c.MinSize < 0 {
+		errs = append(errs, fmt.Errorf("compression.min_size 不能为负数: %d", c.MinSize))
+	}
+	return errors.Join(errs...)
+}
+
+// validate 检查熔断阈值和时长，field 为错误信息中的配置项前缀
+func (c *CircuitBreaker) validate(field string) error {
+	var errs []error
+	if c.Threshold < 0 {
+		errs = append(errs, fmt.Errorf("%s.threshold 不能为负数: %d", field, c.Threshold))
+	}
+	errs = append(errs,
+		checkNonNegative(field+".window", c.Window),
+		checkNonNegative(field+".cooldown", c.Cooldown),
+	)
+	return errors.Join(errs...)
+}
+
+// validate 检查 DHT 地址、模式和身份密钥文件
+func (d *DHTConfig) validate() error {
+	errs := []error{
+		checkMultiaddrs("dht.bootstrap_peers", d.BootstrapPeers),
+		checkMultiaddrs("dht.listen_addrs", d.ListenAddrs),
+		checkMultiaddrs("dht.external_addrs", d.ExternalAddrs),
+		checkNonNegative("dht.provider_timeout", d.ProviderTimeout),
+		checkNonNegative("dht.register_min_backoff", d.RegisterMinBackoff),
+		checkNonNegative("dht.register_max_backoff", d.RegisterMaxBackoff),
+	}
+	switch d.Mode {
+	case "", "server", "client":
+	default:
+		errs = append(errs, fmt.Errorf("dht.mode 未知的模式: %q (支持: server, client)", d.Mode))
+	}
+	if d.TransitionalPrivateKeyFile != "" {
+		errs = append(errs, checkFileExists("dht.transitional_private_key_file", d.TransitionalPrivateKeyFile))
+	}
+	return errors.Join(errs...)
+}
+
+// validate 检查指标后端及其必填地址
+func (m *MetricsConfig) validate() error {
+	switch m.Backend {
+	case "", "none":
+	case "prometheus":
+		if m.Listen == "" {
+			return fmt.Errorf("prometheus 指标需要配置 metrics.listen")
+		}
+		return checkHostPort("metrics.listen", m.Listen)
+	case "statsd":
+		if m.Address == "" {
+			return fmt.Errorf("statsd 指标需要配置 metrics.address")
+		}
+		return checkHostPort("metrics.address", m.Address)
+	default:
+		return fmt.Errorf("未知的指标后端: %q (支持: prometheus, statsd)", m.Backend)
+	}
+	return nil
+}
+
+// checkHostPort 检查 host:port 格式的地址 (host 可为空，表示所有地址)
+func checkHostPort(field, addr string) error {
+	if addr == "" {
+		return fmt.Errorf("%s 不能为空", field)
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%s 地址无效: %w", field, err)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("%s 端口无效: %q", field, port)
+	}
+	return nil
+}
+
+// checkMultiaddrs 检查 multiaddr 列表
+func checkMultiaddrs(field string, addrs []string) error {
+	var errs []error
+	for _, addr := range addrs {
+		if _, err := ma.NewMultiaddr(addr); err != nil {
+			errs = append(errs, fmt.Errorf("%s 地址 %q 无效: %w", field, addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkHTTPURL 检查后端地址为带主机名的 http/https URL
+func checkHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("协议必须为 http 或 https")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("缺少主机名")
+	}
+	return nil
+}
+
+func checkNonNegative(field string, d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("%s 不能为负数: %v", field, d)
+	}
+	return nil
+}
+
+func checkFileExists(field, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s 文件不可用: %w", field, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s 是目录而不是文件: %s", field, path)
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Binary HTTP (RFC 9292) 帧类型
+const (
+	bhttpKnownLengthRequest         = 0
+	bhttpIndeterminateLengthRequest = 2
+)
+
+// ErrBHTTPTruncated BHTTP 消息在字段中途截断
+var ErrBHTTPTruncated = errors.New("BHTTP 消息不完整")
+
+// bhttpSkipHeaders 由 BHTTP 帧本身表达、不写入字段段的 header
+var bhttpSkipHeaders = map[string]bool{
+	"host":              true,
+	"content-length":    true,
+	"transfer-encoding": true,
+	"connection":        true,
+}
+
+// EncodeBHTTPRequest 将 HTTP 请求编码为 known-length Binary HTTP 请求 (RFC 9292)
+// 会读取并还原 req.Body，调用后请求仍可继续使用
+func EncodeBHTTPRequest(req *http.Request) ([]byte, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取请求体失败: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	scheme, authority, path := "https", req.Host, "/"
+	if req.URL != nil {
+		if req.URL.Scheme != "" {
+			scheme = req.URL.Scheme
+		}
+		if authority == "" {
+			authority = req.URL.Host
+		}
+		path = req.URL.RequestURI()
+	}
+
+	var buf []byte
+	buf = appendVarint(buf, bhttpKnownLengthRequest)
+
+	// 控制数据: method, scheme, authority, path
+	for _, s := range []string{method, scheme, authority, path} {
+		buf = appendVarintBytes(buf, []byte(s))
+	}
+
+	buf = appendVarintBytes(buf, encodeFieldSection(req.Header))
+	buf = appendVarintBytes(buf, body)
+	buf = appendVarintBytes(buf, encodeFieldSection(req.Trailer))
+	return buf, nil
+}
+
+// encodeLegacyRequest 将 HTTP 请求编码为 HTTP/1.1 文本 (旧版 Exit 的内层格式)
+func encodeLegacyRequest(req *http.Request) ([]byte, error) {
+	// 确保 Content-Length 被设置（http.ReadRequest 需要这个来正确读取 body）
+	if req.Body != nil && req.ContentLength > 0 {
+		req.Header.Set("Content-Length", strconv.FormatInt(req.ContentLength, 10))
+	}
+	return httputil.DumpRequest(req, true)
+}
+
+// decodeRequest 解析内层请求: Binary HTTP 以帧类型 (0 或 2) 开头，旧版 Client 的 HTTP/1.1 文本以请求方法开头
+func decodeRequest(data []byte) (*http.Request, error) {
+	if len(data) > 0 && ('A' <= data[0] && data[0] <= 'Z' || 'a' <= data[0] && data[0] <= 'z') {
+		return http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	}
+	return DecodeBHTTPRequest(data)
+}
+
+// DecodeBHTTPRequest 解码 Binary HTTP 请求 (支持 known-length 与 indeterminate-length 两种帧)
+// 允许 RFC 9292 规定的截断 (省略内容与 trailer) 和尾部零填充
+func DecodeBHTTPRequest(data []byte) (*http.Request, error) {
+	r := &bhttpReader{data: data}
+
+	framing, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if framing != bhttpKnownLengthRequest && framing != bhttpIndeterminateLengthRequest {
+		return nil, fmt.Errorf("不支持的 BHTTP 帧类型: %d", framing)
+	}
+	indeterminate := framing == bhttpIndeterminateLengthRequest
+
+	var control [4]string
+	for i := range control {
+		b, err := r.varintBytes()
+		if err != nil {
+			return nil, fmt.Errorf("解析控制数据失败: %w", err)
+		}
+		control[i] = string(b)
+	}
+	method, scheme, authority, path := control[0], control[1], control[2], control[3]
+	if method == "" {
+		return nil, fmt.Errorf("BHTTP 请求缺少 method")
+	}
+
+	header, err := r.fieldSection(indeterminate)
+	if err != nil {
+		return nil, fmt.Errorf("解析 header 失败: %w", err)
+	}
+
+	body, err := r.content(indeterminate)
+	if err != nil {
+		return nil, fmt.Errorf("解析请求体失败: %w", err)
+	}
+
+	trailer, err := r.fieldSection(indeterminate)
+	if err != nil {
+		return nil, fmt.Errorf("解析 trailer 失败: %w", err)
+	}
+
+	if !r.onlyPadding() {
+		return nil, fmt.Errorf("BHTTP 消息尾部存在非零数据")
+	}
+
+	if path == "" {
+		path = "/"
+	}
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return nil, fmt.Errorf("解析请求路径失败: %w", err)
+	}
+	u.Scheme = scheme
+	u.Host = authority
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("构建请求失败: %w", err)
+	}
+	req.Host = authority
+	req.RequestURI = path
+	req.Header = header
+	req.ContentLength = int64(len(body))
+	if len(body) == 0 {
+		req.Body = http.NoBody
+	}
+	if len(trailer) > 0 {
+		req.Trailer = trailer
+	}
+	return req, nil
+}
+
+// encodeFieldSection 编码 known-length 字段段内容 (不含外层长度)
+// 字段名按 RFC 9292 要求小写，并按名称排序保证输出确定
+func encodeFieldSection(h http.Header) []byte {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		if !bhttpSkipHeaders[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var buf []byte
+	for _, name := range names {
+		lower := []byte(strings.ToLower(name))
+		for _, v := range h[name] {
+			buf = appendVarintBytes(buf, lower)
+			buf = appendVarintBytes(buf, []byte(v))
+		}
+	}
+	return buf
+}
+
+// appendVarint 追加 QUIC 变长整数 (RFC 9000 §16)
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, byte(v>>8)|0x40, byte(v))
+	case v < 1<<30:
+		return append(b, byte(v>>24)|0x80, byte(v>>16), byte(v>>8), byte(v))
+	default:
+		return append(b, byte(v>>56)|0xc0, byte(v>>48), byte(v>>40), byte(v>>32),
+			byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
+
+// appendVarintBytes 追加长度前缀的字节串
+func appendVarintBytes(b, data []byte) []byte {
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// bhttpReader BHTTP 消息解析游标
+type bhttpReader struct {
+	data []byte
+	off  int
+}
+
+// eof 是否已读完全部数据
+func (r *bhttpReader) eof() bool {
+	return r.off >= len(r.data)
+}
+
+// varint 读取一个 QUIC 变长整数
+func (r *bhttpReader) varint() (uint64, error) {
+	if r.eof() {
+		return 0, ErrBHTTPTruncated
+	}
+	n := 1 << (r.data[r.off] >> 6)
+	if len(r.data)-r.off < n {
+		return 0, ErrBHTTPTruncated
+	}
+	v := uint64(r.data[r.off] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(r.data[r.off+i])
+	}
+	r.off += n
+	return v, nil
+}
+
+// varintBytes 读取长度前缀的字节串
+func (r *bhttpReader) varintBytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.data)-r.off) {
+		return nil, ErrBHTTPTruncated
+	}
+	b := r.data[r.off : r.off+int(n)]
+	r.off += int(n)
+	return b, nil
+}
+
+// fieldSection 读取字段段，消息在段开始前截断时返回空 header
+func (r *bhttpReader) fieldSection(indeterminate bool) (http.Header, error) {
+	h := http.Header{}
+	if r.eof() {
+		return h, nil
+	}
+
+	if !indeterminate {
+		section, err := r.varintBytes()
+		if err != nil {
+			return nil, err
+		}
+		sub := &bhttpReader{data: section}
+		for !sub.eof() {
+			if err := sub.fieldLine(h); err != nil {
+				return nil, err
+			}
+		}
+		return h, nil
+	}
+
+	// indeterminate-length: 字段行序列以长度为 0 的名称结束
+	for {
+		done, err := r.fieldLineOrEnd(h)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return h, nil
+		}
+	}
+}
+
+// fieldLineOrEnd 读取一行字段，遇到结束标记时返回 true
+func (r *bhttpReader) fieldLineOrEnd(h http.Header) (bool, error) {
+	name, err := r.varintBytes()
+	if err != nil {
+		return false, err
+	}
+	if len(name) == 0 {
+		return true, nil
+	}
+	value, err := r.varintBytes()
+	if err != nil {
+		return false, err
+	}
+	h.Add(string(name), string(value))
+	return false, nil
+}
+
+// fieldLine 读取一行字段 (名称不允许为空)
+func (r *bhttpReader) fieldLine(h http.Header) error {
+	done, err := r.fieldLineOrEnd(h)
+	if err != nil {
+		return err
+	}
+	if done {
+		return fmt.Errorf("字段名为空")
+	}
+	return nil
+}
+
+// content 读取请求体，indeterminate-length 时拼接各分块直到长度为 0 的分块
+func (r *bhttpReader) content(indeterminate bool) ([]byte, error) {
+	if r.eof() {
+		return nil, nil
+	}
+	if !indeterminate {
+		return r.varintBytes()
+	}
+
+	var body []byte
+	for {
+		chunk, err := r.varintBytes()
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk) == 0 {
+			return body, nil
+		}
+		body = append(body, chunk...)
+	}
+}
+
+// onlyPadding 剩余数据是否全部为零填充
+func (r *bhttpReader) onlyPadding() bool {
+	for _, b := range r.data[r.off:] {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
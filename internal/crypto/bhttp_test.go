@@ -0,0 +1,289 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// roundTripBHTTP 编码后再解码请求
+func roundTripBHTTP(t *testing.T, req *http.Request) *http.Request {
+	t.Helper()
+	data, err := EncodeBHTTPRequest(req)
+	if err != nil {
+		t.Fatalf("EncodeBHTTPRequest failed: %v", err)
+	}
+	decoded, err := DecodeBHTTPRequest(data)
+	if err != nil {
+		t.Fatalf("DecodeBHTTPRequest failed: %v", err)
+	}
+	return decoded
+}
+
+func readBody(t *testing.T, req *http.Request) string {
+	t.Helper()
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("读取请求体失败: %v", err)
+	}
+	return string(b)
+}
+
+func TestBHTTPRequest_RoundTrip(t *testing.T) {
+	body := `{"model":"llama3","messages":[]}`
+	req, err := http.NewRequest("POST", "http://ai-backend/v1/chat/completions?stream=true", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	got := roundTripBHTTP(t, req)
+
+	if got.Method != "POST" {
+		t.Errorf("Method = %s, want POST", got.Method)
+	}
+	if got.URL.Path != "/v1/chat/completions" || got.URL.RawQuery != "stream=true" {
+		t.Errorf("URL = %s, want path /v1/chat/completions with query stream=true", got.URL)
+	}
+	if got.Host != "ai-backend" {
+		t.Errorf("Host = %s, want ai-backend", got.Host)
+	}
+	if got.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q", got.Header.Get("Content-Type"))
+	}
+	if got.ContentLength != int64(len(body)) {
+		t.Errorf("ContentLength = %d, want %d", got.ContentLength, len(body))
+	}
+	if b := readBody(t, got); b != body {
+		t.Errorf("Body = %q, want %q", b, body)
+	}
+
+	// 编码后原请求体仍可读取 (重试时需要)
+	if b := readBody(t, req); b != body {
+		t.Errorf("原请求体被消耗: %q", b)
+	}
+}
+
+func TestBHTTPRequest_EmptyBody(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://ai-backend/v1/models", nil)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+
+	got := roundTripBHTTP(t, req)
+
+	if got.Method != "GET" {
+		t.Errorf("Method = %s, want GET", got.Method)
+	}
+	if got.ContentLength != 0 {
+		t.Errorf("ContentLength = %d, want 0", got.ContentLength)
+	}
+	if b := readBody(t, got); b != "" {
+		t.Errorf("Body = %q, want empty", b)
+	}
+}
+
+func TestBHTTPRequest_UnknownLengthBody(t *testing.T) {
+	// 未知长度的请求体 (HTTP/1.1 下会走 chunked 编码)
+	body := strings.Repeat("chunk-", 2000)
+	req, err := http.NewRequest("POST", "http://ai-backend/v1/embeddings", io.NopCloser(strings.NewReader(body)))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.ContentLength = -1
+	req.TransferEncoding = []string{"chunked"}
+	req.Header.Set("Transfer-Encoding", "chunked")
+
+	got := roundTripBHTTP(t, req)
+
+	if got.ContentLength != int64(len(body)) {
+		t.Errorf("ContentLength = %d, want %d", got.ContentLength, len(body))
+	}
+	if got.Header.Get("Transfer-Encoding") != "" {
+		t.Error("Transfer-Encoding 不应写入 BHTTP 字段段")
+	}
+	if b := readBody(t, got); b != body {
+		t.Errorf("Body 长度 = %d, want %d", len(b), len(body))
+	}
+}
+
+func TestBHTTPRequest_MultipleHeaderValues(t *testing.T) {
+	req, err := http.NewRequest("POST", "http://ai-backend/v1/chat/completions", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.Header.Add("Accept", "text/event-stream")
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("X-Custom", "a")
+	req.Header.Add("X-Custom", "")
+	req.Header.Add("X-Custom", "c")
+	req.Trailer = http.Header{"X-Checksum": {"abc"}}
+
+	got := roundTripBHTTP(t, req)
+
+	for _, name := range []string{"Accept", "X-Custom"} {
+		if !reflect.DeepEqual(got.Header[name], req.Header[name]) {
+			t.Errorf("%s = %v, want %v", name, got.Header[name], req.Header[name])
+		}
+	}
+	if got.Trailer.Get("X-Checksum") != "abc" {
+		t.Errorf("Trailer X-Checksum = %q, want abc", got.Trailer.Get("X-Checksum"))
+	}
+}
+
+func TestEncodeBHTTPRequest_LowercaseFieldNames(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://ai-backend/", nil)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer x")
+
+	data, err := EncodeBHTTPRequest(req)
+	if err != nil {
+		t.Fatalf("EncodeBHTTPRequest failed: %v", err)
+	}
+	if !bytes.Contains(data, []byte("authorization")) || bytes.Contains(data, []byte("Authorization")) {
+		t.Error("字段名应按 RFC 9292 编码为小写")
+	}
+}
+
+func TestDecodeBHTTPRequest_IndeterminateLength(t *testing.T) {
+	var data []byte
+	data = appendVarint(data, bhttpIndeterminateLengthRequest)
+	for _, s := range []string{"POST", "https", "example.com", "/v1/completions"} {
+		data = appendVarintBytes(data, []byte(s))
+	}
+	// header 字段行，以空名称结束
+	data = appendVarintBytes(data, []byte("content-type"))
+	data = appendVarintBytes(data, []byte("application/json"))
+	data = appendVarint(data, 0)
+	// 内容分块，以空分块结束
+	data = appendVarintBytes(data, []byte(`{"prompt":`))
+	data = appendVarintBytes(data, []byte(`"hi"}`))
+	data = appendVarint(data, 0)
+	// 空 trailer
+	data = appendVarint(data, 0)
+
+	got, err := DecodeBHTTPRequest(data)
+	if err != nil {
+		t.Fatalf("DecodeBHTTPRequest failed: %v", err)
+	}
+	if got.URL.Path != "/v1/completions" || got.Host != "example.com" {
+		t.Errorf("URL = %s, Host = %s", got.URL, got.Host)
+	}
+	if got.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q", got.Header.Get("Content-Type"))
+	}
+	if b := readBody(t, got); b != `{"prompt":"hi"}` {
+		t.Errorf("Body = %q", b)
+	}
+}
+
+func TestDecodeBHTTPRequest_TruncatedAndPadding(t *testing.T) {
+	var base []byte
+	base = appendVarint(base, bhttpKnownLengthRequest)
+	for _, s := range []string{"GET", "https", "example.com", "/"} {
+		base = appendVarintBytes(base, []byte(s))
+	}
+
+	// RFC 9292 允许省略内容与 trailer
+	if _, err := DecodeBHTTPRequest(base); err != nil {
+		t.Errorf("截断的合法消息应可解码: %v", err)
+	}
+
+	// 尾部零填充
+	padded := append(append([]byte{}, base...), make([]byte, 16)...)
+	if _, err := DecodeBHTTPRequest(padded); err != nil {
+		t.Errorf("带零填充的消息应可解码: %v", err)
+	}
+
+	// 字段中途截断
+	if _, err := DecodeBHTTPRequest(base[:len(base)-1]); !errors.Is(err, ErrBHTTPTruncated) {
+		t.Errorf("err = %v, want ErrBHTTPTruncated", err)
+	}
+
+	// 尾部非零数据
+	garbage := append(append([]byte{}, base...), 0, 0, 0, 0, 1)
+	if _, err := DecodeBHTTPRequest(garbage); err == nil {
+		t.Error("尾部存在非零数据时应失败")
+	}
+}
+
+func TestDecodeBHTTPRequest_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"response framing", appendVarint(nil, 1)},
+		{"empty method", append(appendVarint(nil, bhttpKnownLengthRequest), 0, 0, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeBHTTPRequest(tt.data); err == nil {
+				t.Error("应返回错误")
+			}
+		})
+	}
+}
+
+func TestVarint_RoundTrip(t *testing.T) {
+	for _, v := range []uint64{0, 63, 64, 16383, 16384, 1<<30 - 1, 1 << 30, 1<<62 - 1} {
+		r := &bhttpReader{data: appendVarint(nil, v)}
+		got, err := r.varint()
+		if err != nil {
+			t.Fatalf("varint(%d) failed: %v", v, err)
+		}
+		if got != v || !r.eof() {
+			t.Errorf("varint round trip = %d, want %d", got, v)
+		}
+	}
+}
+
+func TestDecapsulateRequest_LegacyEncoding(t *testing.T) {
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	server, _ := NewOHTTPServer(kp.KeyID, kp.PrivateKey)
+
+	// 旧版 Client 以 HTTP/1.1 文本编码内层请求，服务端仍可解析；默认使用 Binary HTTP
+	for _, legacy := range []bool{true, false} {
+		client, _ := NewOHTTPClient(kp.KeyID, kp.PublicKey)
+		client.SetLegacyEncoding(legacy)
+
+		body := `{"model":"llama3"}`
+		req, _ := http.NewRequest("POST", "http://ai-backend/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		ohttpReq, _, err := client.EncapsulateRequest(req)
+		if err != nil {
+			t.Fatalf("legacy=%v: EncapsulateRequest failed: %v", legacy, err)
+		}
+
+		got, _, err := server.DecapsulateRequest(ohttpReq)
+		if err != nil {
+			t.Fatalf("legacy=%v: DecapsulateRequest failed: %v", legacy, err)
+		}
+		if got.Method != "POST" || got.URL.Path != "/v1/chat/completions" || got.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("legacy=%v: request = %s %s %v", legacy, got.Method, got.URL, got.Header)
+		}
+		if b := readBody(t, got); b != body {
+			t.Errorf("legacy=%v: body = %q, want %q", legacy, b, body)
+		}
+	}
+}
+
+func TestEncodeLegacyRequest_NotBinaryHTTP(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://ai-backend/v1/models", nil)
+	data, err := encodeLegacyRequest(req)
+	if err != nil {
+		t.Fatalf("encodeLegacyRequest failed: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("GET /v1/models HTTP/1.1\r\n")) {
+		t.Errorf("legacy encoding = %q, want an HTTP/1.1 request line", data)
+	}
+}
@@ -2,9 +2,17 @@ package crypto
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/cloudflare/circl/hpke"
 )
 
 func TestGenerateKeyPair(t *testing.T) {
@@ -294,6 +302,100 @@ func TestStreamEncryptorDifferentNonces(t *testing.T) {
 	}
 }
 
+// newRequestBodyPair 建立 HPKE 会话并派生分块上传的加密器和解密器
+func newRequestBodyPair(t *testing.T) (*RequestBodySealer, *RequestBodyOpener) {
+	t.Helper()
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	client, _ := NewOHTTPClient(kp.KeyID, kp.PublicKey)
+	server, _ := NewOHTTPServer(kp.KeyID, kp.PrivateKey)
+
+	req, _ := http.NewRequest("POST", "http://example.com/v1/audio/transcriptions", nil)
+	encryptedReq, clientCtx, err := client.EncapsulateRequest(req)
+	if err != nil {
+		t.Fatalf("EncapsulateRequest failed: %v", err)
+	}
+	_, serverCtx, err := server.DecapsulateRequest(encryptedReq)
+	if err != nil {
+		t.Fatalf("DecapsulateRequest failed: %v", err)
+	}
+
+	sealer, err := clientCtx.NewRequestBodySealer()
+	if err != nil {
+		t.Fatalf("NewRequestBodySealer failed: %v", err)
+	}
+	opener, err := serverCtx.NewRequestBodyOpener()
+	if err != nil {
+		t.Fatalf("NewRequestBodyOpener failed: %v", err)
+	}
+	return sealer, opener
+}
+
+func TestRequestBodySealOpen(t *testing.T) {
+	sealer, opener := newRequestBodyPair(t)
+
+	chunks := []string{"part-1", "part-2", ""}
+	for i, chunk := range chunks {
+		got, err := opener.OpenChunk(sealer.SealChunk([]byte(chunk)))
+		if err != nil {
+			t.Fatalf("OpenChunk[%d] failed: %v", i, err)
+		}
+		if string(got) != chunk {
+			t.Errorf("Chunk[%d]: got %q, want %q", i, got, chunk)
+		}
+	}
+	if err := opener.OpenFinal(sealer.SealFinal()); err != nil {
+		t.Fatalf("OpenFinal failed: %v", err)
+	}
+}
+
+func TestRequestBodyOpen_RejectsReorder(t *testing.T) {
+	sealer, opener := newRequestBodyPair(t)
+
+	first := sealer.SealChunk([]byte("first"))
+	second := sealer.SealChunk([]byte("second"))
+	if _, err := opener.OpenChunk(second); err == nil {
+		t.Fatal("expected out-of-order chunk to be rejected")
+	}
+	if _, err := opener.OpenChunk(first); err != nil {
+		t.Fatalf("in-order chunk should still open: %v", err)
+	}
+	if _, err := opener.OpenChunk(first); err == nil {
+		t.Fatal("expected replayed chunk to be rejected")
+	}
+}
+
+func TestRequestBodyOpen_RejectsDroppedChunk(t *testing.T) {
+	sealer, opener := newRequestBodyPair(t)
+
+	first := sealer.SealChunk([]byte("first"))
+	sealer.SealChunk([]byte("dropped"))
+	final := sealer.SealFinal()
+
+	if _, err := opener.OpenChunk(first); err != nil {
+		t.Fatalf("OpenChunk failed: %v", err)
+	}
+	if err := opener.OpenFinal(final); err == nil {
+		t.Fatal("expected final block after a dropped chunk to be rejected")
+	}
+}
+
+func TestRequestBodyOpen_FinalNotInterchangeable(t *testing.T) {
+	sealer, opener := newRequestBodyPair(t)
+
+	final := sealer.SealFinal()
+	if _, err := opener.OpenChunk(final); err == nil {
+		t.Fatal("final block must not open as a data chunk")
+	}
+
+	sealer, opener = newRequestBodyPair(t)
+	if err := opener.OpenFinal(sealer.SealChunk(nil)); err == nil {
+		t.Fatal("empty data chunk must not open as the final block")
+	}
+}
+
 func TestDecodeKeyConfigInvalid(t *testing.T) {
 	// 测试空数据
 	_, _, err := DecodeKeyConfig([]byte{})
@@ -320,3 +422,451 @@ func newReadCloser(data []byte) *readCloser {
 func (r *readCloser) Close() error {
 	return nil
 }
+
+func TestEnsureKeyPair_NoAutoGenerate(t *testing.T) {
+	privPath := filepath.Join(t.TempDir(), "keys", "ohttp_private.key")
+
+	_, _, err := EnsureKeyPair(privPath, false)
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("err = %v, want ErrKeyNotFound", err)
+	}
+
+	// 禁用自动生成时不应创建任何文件
+	if _, err := os.Stat(privPath); !os.IsNotExist(err) {
+		t.Errorf("private key should not be created, stat err = %v", err)
+	}
+}
+
+func TestEnsureKeyPair_AutoGenerate(t *testing.T) {
+	privPath := filepath.Join(t.TempDir(), "keys", "ohttp_private.key")
+
+	pub1, generated, err := EnsureKeyPair(privPath, true)
+	if err != nil {
+		t.Fatalf("EnsureKeyPair failed: %v", err)
+	}
+	if !generated {
+		t.Error("first call should generate key pair")
+	}
+	if _, _, err := LoadPublicKeyConfig(pub1); err != nil {
+		t.Fatalf("generated public key invalid: %v", err)
+	}
+
+	// 已存在时不重新生成，禁用自动生成也能正常加载
+	pub2, generated, err := EnsureKeyPair(privPath, false)
+	if err != nil {
+		t.Fatalf("EnsureKeyPair (existing) failed: %v", err)
+	}
+	if generated {
+		t.Error("existing key pair should not be regenerated")
+	}
+	if pub1 != pub2 {
+		t.Error("public key changed for existing key pair")
+	}
+}
+
+// newDistinctKeyPairs 生成 n 个 KeyID 互不相同的密钥对
+func newDistinctKeyPairs(t *testing.T, n int) []*KeyPair {
+	t.Helper()
+	pairs := make([]*KeyPair, 0, n)
+	for i := 0; i < n; i++ {
+		kp, err := GenerateKeyPair()
+		if err != nil {
+			t.Fatalf("GenerateKeyPair failed: %v", err)
+		}
+		kp.KeyID = uint8(10 + i)
+		pairs = append(pairs, kp)
+	}
+	return pairs
+}
+
+func TestOHTTPServer_MultipleKeys(t *testing.T) {
+	pairs := newDistinctKeyPairs(t, 2)
+	server, err := NewOHTTPServerWithKeys(map[uint8][]byte{
+		pairs[0].KeyID: pairs[0].PrivateKey,
+		pairs[1].KeyID: pairs[1].PrivateKey,
+	})
+	if err != nil {
+		t.Fatalf("NewOHTTPServerWithKeys failed: %v", err)
+	}
+
+	// 新旧密钥加密的请求均可解密
+	for _, kp := range pairs {
+		client, err := NewOHTTPClient(kp.KeyID, kp.PublicKey)
+		if err != nil {
+			t.Fatalf("NewOHTTPClient failed: %v", err)
+		}
+		req, _ := http.NewRequest("GET", "http://example.com/test", nil)
+		encryptedReq, _, err := client.EncapsulateRequest(req)
+		if err != nil {
+			t.Fatalf("EncapsulateRequest failed: %v", err)
+		}
+		decrypted, _, err := server.DecapsulateRequest(encryptedReq)
+		if err != nil {
+			t.Fatalf("KeyID %d: DecapsulateRequest failed: %v", kp.KeyID, err)
+		}
+		if decrypted.URL.Path != "/test" {
+			t.Errorf("KeyID %d: path = %q, want /test", kp.KeyID, decrypted.URL.Path)
+		}
+	}
+}
+
+func TestOHTTPServer_UnknownKeyID(t *testing.T) {
+	pairs := newDistinctKeyPairs(t, 2)
+	server, err := NewOHTTPServer(pairs[0].KeyID, pairs[0].PrivateKey)
+	if err != nil {
+		t.Fatalf("NewOHTTPServer failed: %v", err)
+	}
+
+	client, _ := NewOHTTPClient(pairs[1].KeyID, pairs[1].PublicKey)
+	req, _ := http.NewRequest("GET", "http://example.com/test", nil)
+	encryptedReq, _, _ := client.EncapsulateRequest(req)
+
+	_, _, err = server.DecapsulateRequest(encryptedReq)
+	if !errors.Is(err, ErrUnknownKeyID) {
+		t.Fatalf("err = %v, want ErrUnknownKeyID", err)
+	}
+}
+
+func TestNewOHTTPServerWithKeys_Empty(t *testing.T) {
+	if _, err := NewOHTTPServerWithKeys(nil); err == nil {
+		t.Error("NewOHTTPServerWithKeys(nil) should fail")
+	}
+}
+
+func TestEncodeDecodeKeyConfigs(t *testing.T) {
+	pairs := newDistinctKeyPairs(t, 3)
+	configs := make([]KeyConfig, 0, len(pairs))
+	for _, kp := range pairs {
+		configs = append(configs, KeyConfig{KeyID: kp.KeyID, PublicKey: kp.PublicKey})
+	}
+
+	encoded := EncodeKeyConfigs(configs)
+
+	decoded, err := DecodeKeyConfigs(encoded)
+	if err != nil {
+		t.Fatalf("DecodeKeyConfigs failed: %v", err)
+	}
+	if len(decoded) != len(configs) {
+		t.Fatalf("decoded %d configs, want %d", len(decoded), len(configs))
+	}
+	for i := range configs {
+		if decoded[i].KeyID != configs[i].KeyID || !bytes.Equal(decoded[i].PublicKey, configs[i].PublicKey) {
+			t.Errorf("config %d mismatch", i)
+		}
+	}
+
+	// 只解析单个 KeyConfig 的旧调用方取得首个 (主) 密钥
+	keyID, pubKey, err := DecodeKeyConfig(encoded)
+	if err != nil {
+		t.Fatalf("DecodeKeyConfig failed: %v", err)
+	}
+	if keyID != configs[0].KeyID || !bytes.Equal(pubKey, configs[0].PublicKey) {
+		t.Error("DecodeKeyConfig should return the first config")
+	}
+
+	if _, err := DecodeKeyConfigs(encoded[:len(encoded)-1]); err == nil {
+		t.Error("DecodeKeyConfigs should fail on truncated data")
+	}
+}
+
+func TestOHTTP_ChaCha20Poly1305RoundTrip(t *testing.T) {
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	client, err := NewOHTTPClient(kp.KeyID, kp.PublicKey, AEADChaCha20Poly1305)
+	if err != nil {
+		t.Fatalf("NewOHTTPClient failed: %v", err)
+	}
+	server, err := NewOHTTPServer(kp.KeyID, kp.PrivateKey, AEADChaCha20Poly1305)
+	if err != nil {
+		t.Fatalf("NewOHTTPServer failed: %v", err)
+	}
+
+	body := `{"model":"llama3","messages":[{"role":"user","content":"hi"}]}`
+	req, _ := http.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(body))
+	encryptedReq, clientCtx, err := client.EncapsulateRequest(req)
+	if err != nil {
+		t.Fatalf("EncapsulateRequest failed: %v", err)
+	}
+
+	// 请求头 (AAD) 中的 AEAD_ID 为 ChaCha20-Poly1305
+	if got := uint16(encryptedReq[5])<<8 | uint16(encryptedReq[6]); got != uint16(AEADChaCha20Poly1305) {
+		t.Errorf("AEAD_ID = 0x%04x, want 0x%04x", got, uint16(AEADChaCha20Poly1305))
+	}
+
+	decryptedReq, serverCtx, err := server.DecapsulateRequest(encryptedReq)
+	if err != nil {
+		t.Fatalf("DecapsulateRequest failed: %v", err)
+	}
+	if decryptedReq.URL.Path != "/v1/chat/completions" {
+		t.Errorf("path = %q, want /v1/chat/completions", decryptedReq.URL.Path)
+	}
+
+	// 非流式响应
+	respBody := `{"id":"resp"}`
+	resp := &http.Response{
+		StatusCode:    200,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          newReadCloser([]byte(respBody)),
+		ContentLength: int64(len(respBody)),
+	}
+	encryptedResp, err := serverCtx.EncapsulateResponse(resp)
+	if err != nil {
+		t.Fatalf("EncapsulateResponse failed: %v", err)
+	}
+	decryptedResp, err := clientCtx.DecapsulateResponse(encryptedResp)
+	if err != nil {
+		t.Fatalf("DecapsulateResponse failed: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(decryptedResp.Body)
+	if buf.String() != respBody {
+		t.Errorf("response body = %q, want %q", buf.String(), respBody)
+	}
+
+	// 流式响应和分块上传的请求体使用同一 AEAD
+	encryptor, err := serverCtx.NewStreamEncryptor()
+	if err != nil {
+		t.Fatalf("NewStreamEncryptor failed: %v", err)
+	}
+	decryptor, err := clientCtx.NewStreamDecryptor()
+	if err != nil {
+		t.Fatalf("NewStreamDecryptor failed: %v", err)
+	}
+	chunk, _ := encryptor.EncryptChunk([]byte("data: [DONE]\n\n"))
+	if got, err := decryptor.DecryptChunk(chunk); err != nil || string(got) != "data: [DONE]\n\n" {
+		t.Errorf("DecryptChunk = %q, %v", got, err)
+	}
+
+	sealer, _ := clientCtx.NewRequestBodySealer()
+	opener, _ := serverCtx.NewRequestBodyOpener()
+	if got, err := opener.OpenChunk(sealer.SealChunk([]byte("part"))); err != nil || string(got) != "part" {
+		t.Errorf("OpenChunk = %q, %v", got, err)
+	}
+}
+
+func TestOHTTPServer_RejectsUnsupportedAEAD(t *testing.T) {
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	// 默认只接受 AES-128-GCM
+	server, _ := NewOHTTPServer(kp.KeyID, kp.PrivateKey)
+	client, _ := NewOHTTPClient(kp.KeyID, kp.PublicKey, AEADChaCha20Poly1305)
+	req, _ := http.NewRequest("GET", "http://example.com/test", nil)
+	encryptedReq, _, _ := client.EncapsulateRequest(req)
+	if _, _, err := server.DecapsulateRequest(encryptedReq); !errors.Is(err, ErrUnsupportedSuite) {
+		t.Errorf("err = %v, want ErrUnsupportedSuite", err)
+	}
+
+	// 同时接受两种算法的服务端可解密任一算法的请求
+	both, _ := NewOHTTPServer(kp.KeyID, kp.PrivateKey, AEADChaCha20Poly1305, AEADAES128GCM)
+	for _, aead := range both.AEADs() {
+		client, _ := NewOHTTPClient(kp.KeyID, kp.PublicKey, aead)
+		encryptedReq, _, _ := client.EncapsulateRequest(req)
+		if _, _, err := both.DecapsulateRequest(encryptedReq); err != nil {
+			t.Errorf("AEAD 0x%04x: DecapsulateRequest failed: %v", uint16(aead), err)
+		}
+	}
+
+	if _, err := NewOHTTPClient(kp.KeyID, kp.PublicKey, hpke.AEAD_AES256GCM); err == nil {
+		t.Error("NewOHTTPClient should reject unsupported AEAD")
+	}
+	if _, err := NewOHTTPServer(kp.KeyID, kp.PrivateKey, hpke.AEAD_AES256GCM); err == nil {
+		t.Error("NewOHTTPServer should reject unsupported AEAD")
+	}
+}
+
+func TestKeyConfig_CipherSuites(t *testing.T) {
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	encoded := EncodeKeyConfig(kp.KeyID, kp.PublicKey, AEADChaCha20Poly1305, AEADAES128GCM)
+	configs, err := DecodeKeyConfigs(encoded)
+	if err != nil {
+		t.Fatalf("DecodeKeyConfigs failed: %v", err)
+	}
+	want := []hpke.AEAD{AEADChaCha20Poly1305, AEADAES128GCM}
+	if len(configs) != 1 || !slices.Equal(configs[0].AEADs, want) {
+		t.Errorf("AEADs = %v, want %v", configs[0].AEADs, want)
+	}
+
+	// 未指定时只通告 AES-128-GCM
+	configs, _ = DecodeKeyConfigs(EncodeKeyConfig(kp.KeyID, kp.PublicKey))
+	if !slices.Equal(configs[0].AEADs, []hpke.AEAD{AEADAES128GCM}) {
+		t.Errorf("default AEADs = %v, want AES-128-GCM only", configs[0].AEADs)
+	}
+
+	if aead, err := ParseAEAD("ChaCha20-Poly1305"); err != nil || aead != AEADChaCha20Poly1305 {
+		t.Errorf("ParseAEAD = %v, %v", aead, err)
+	}
+	if _, err := ParseAEAD("aes-256-gcm"); err == nil {
+		t.Error("ParseAEAD should reject unknown names")
+	}
+}
+
+// hkdfSHA256 独立实现的单块 HKDF-SHA256 (RFC 5869)，用于校验响应密钥派生
+func hkdfSHA256(secret, salt, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:length]
+}
+
+func TestEncapsulateResponse_RFC9458KeySchedule(t *testing.T) {
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+
+	for _, tt := range []struct {
+		aead     hpke.AEAD
+		nonceLen int // max(Nn, Nk)
+	}{
+		{AEADAES128GCM, 16},
+		{AEADChaCha20Poly1305, 32},
+	} {
+		client, _ := NewOHTTPClient(kp.KeyID, kp.PublicKey, tt.aead)
+		server, _ := NewOHTTPServer(kp.KeyID, kp.PrivateKey, tt.aead)
+
+		req, _ := http.NewRequest("GET", "http://example.com/v1/models", nil)
+		encryptedReq, clientCtx, err := client.EncapsulateRequest(req)
+		if err != nil {
+			t.Fatalf("EncapsulateRequest failed: %v", err)
+		}
+		_, serverCtx, err := server.DecapsulateRequest(encryptedReq)
+		if err != nil {
+			t.Fatalf("DecapsulateRequest failed: %v", err)
+		}
+
+		body := `{"object":"list"}`
+		encrypted, err := serverCtx.EncapsulateResponse(&http.Response{
+			StatusCode:    200,
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{},
+			Body:          newReadCloser([]byte(body)),
+			ContentLength: int64(len(body)),
+		})
+		if err != nil {
+			t.Fatalf("EncapsulateResponse failed: %v", err)
+		}
+
+		// 按 RFC 9458 Section 4.4 独立推导 aead_key / aead_nonce 并解密
+		enc := encryptedReq[7 : 7+GetKEMScheme().CiphertextSize()]
+		responseNonce := encrypted[:tt.nonceLen]
+		secret := clientCtx.sealer.Export([]byte("message/bhttp response"), uint(tt.nonceLen))
+		salt := append(append([]byte{}, enc...), responseNonce...)
+		key := hkdfSHA256(secret, salt, []byte("key"), int(tt.aead.KeySize()))
+		nonce := hkdfSHA256(secret, salt, []byte("nonce"), int(tt.aead.NonceSize()))
+
+		aead, err := tt.aead.New(key)
+		if err != nil {
+			t.Fatalf("AEAD New failed: %v", err)
+		}
+		plaintext, err := aead.Open(nil, nonce, encrypted[tt.nonceLen:], nil)
+		if err != nil {
+			t.Fatalf("AEAD 0x%04x: response not encrypted per RFC 9458: %v", uint16(tt.aead), err)
+		}
+		if !bytes.HasPrefix(plaintext, []byte("HTTP/1.1 200")) || !bytes.HasSuffix(plaintext, []byte(body)) {
+			t.Errorf("plaintext = %q", plaintext)
+		}
+
+		// response_nonce 参与派生，被篡改时解密失败
+		tampered := bytes.Clone(encrypted)
+		tampered[0] ^= 0xff
+		if _, err := clientCtx.DecapsulateResponse(tampered); err == nil {
+			t.Error("DecapsulateResponse should fail with tampered response nonce")
+		}
+		if resp, err := clientCtx.DecapsulateResponse(encrypted); err != nil || resp.StatusCode != 200 {
+			t.Errorf("DecapsulateResponse = %v, %v", resp, err)
+		}
+	}
+}
+
+func TestStreamSequencedChunk(t *testing.T) {
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	client, _ := NewOHTTPClient(kp.KeyID, kp.PublicKey)
+	server, _ := NewOHTTPServer(kp.KeyID, kp.PrivateKey)
+
+	req, _ := http.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(`{}`))
+	req.ContentLength = 2
+	encryptedReq, clientCtx, err := client.EncapsulateRequest(req)
+	if err != nil {
+		t.Fatalf("EncapsulateRequest failed: %v", err)
+	}
+	_, serverCtx, err := server.DecapsulateRequest(encryptedReq)
+	if err != nil {
+		t.Fatalf("DecapsulateRequest failed: %v", err)
+	}
+	encryptor, _ := serverCtx.NewStreamEncryptor()
+	decryptor, _ := clientCtx.NewStreamDecryptor()
+
+	encrypted, err := encryptor.EncryptSequencedChunk(42, []byte("data: hi\n\n"))
+	if err != nil {
+		t.Fatalf("EncryptSequencedChunk failed: %v", err)
+	}
+	seq, plaintext, err := decryptor.DecryptSequencedChunk(encrypted)
+	if err != nil || seq != 42 || string(plaintext) != "data: hi\n\n" {
+		t.Fatalf("DecryptSequencedChunk = %d, %q, %v; want 42, event", seq, plaintext, err)
+	}
+
+	// 序号参与认证，被篡改时解密失败
+	encrypted[7] ^= 1
+	if _, _, err := decryptor.DecryptSequencedChunk(encrypted); err == nil {
+		t.Error("tampered sequence number should fail authentication")
+	}
+}
+
+func TestKeyConfig_AEAD(t *testing.T) {
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	tests := []struct {
+		name  string
+		aeads []hpke.AEAD
+		want  hpke.AEAD
+	}{
+		{"default", nil, AEADAES128GCM},
+		{"exit prefers chacha", []hpke.AEAD{AEADChaCha20Poly1305, AEADAES128GCM}, AEADChaCha20Poly1305},
+		{"chacha only", []hpke.AEAD{AEADChaCha20Poly1305}, AEADChaCha20Poly1305},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configs, err := DecodeKeyConfigs(EncodeKeyConfig(kp.KeyID, kp.PublicKey, tt.aeads...))
+			if err != nil {
+				t.Fatalf("DecodeKeyConfigs failed: %v", err)
+			}
+			if got := configs[0].AEAD(); got != tt.want {
+				t.Errorf("AEAD() = 0x%04x, want 0x%04x", uint16(got), uint16(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseAEADs(t *testing.T) {
+	aeads, err := ParseAEADs([]string{"chacha20-poly1305", "aes-128-gcm"})
+	if err != nil {
+		t.Fatalf("ParseAEADs failed: %v", err)
+	}
+	if !slices.Equal(aeads, []hpke.AEAD{AEADChaCha20Poly1305, AEADAES128GCM}) {
+		t.Errorf("ParseAEADs = %v", aeads)
+	}
+	if _, err := ParseAEADs([]string{"aes-256-gcm"}); err == nil {
+		t.Error("expected error for unsupported AEAD name")
+	}
+}
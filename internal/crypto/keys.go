@@ -6,8 +6,11 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/cloudflare/circl/hpke"
 	"github.com/cloudflare/circl/kem"
@@ -21,6 +24,35 @@ const (
 	AEADID hpke.AEAD = hpke.AEAD_AES128GCM
 )
 
+// 可选的 AEAD 算法: 默认 AES-128-GCM；无 AES 硬件加速的平台 (如运行 Ollama 的 ARM 单板机) 可选 ChaCha20-Poly1305
+const (
+	AEADAES128GCM        hpke.AEAD = hpke.AEAD_AES128GCM
+	AEADChaCha20Poly1305 hpke.AEAD = hpke.AEAD_ChaCha20Poly1305
+)
+
+// aeadNames AEAD 算法的配置名称
+var aeadNames = map[string]hpke.AEAD{
+	"aes-128-gcm":       AEADAES128GCM,
+	"chacha20-poly1305": AEADChaCha20Poly1305,
+}
+
+// ParseAEAD 按名称解析 AEAD 算法 (aes-128-gcm 或 chacha20-poly1305)
+func ParseAEAD(name string) (hpke.AEAD, error) {
+	aead, ok := aeadNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return 0, fmt.Errorf("不支持的 AEAD 算法: %q (支持: aes-128-gcm, chacha20-poly1305)", name)
+	}
+	return aead, nil
+}
+
+// supportedAEAD 检查是否为支持的 AEAD 算法
+func supportedAEAD(aead hpke.AEAD) bool {
+	return aead == AEADAES128GCM || aead == AEADChaCha20Poly1305
+}
+
+// ErrKeyNotFound 密钥文件不存在且禁用了自动生成
+var ErrKeyNotFound = errors.New("OHTTP 密钥文件不存在")
+
 // KeyPair OHTTP 密钥对
 type KeyPair struct {
 	PublicKey  []byte
@@ -82,6 +114,37 @@ func SaveKeyPair(kp *KeyPair, pubPath, privPath string) error {
 	return nil
 }
 
+// EnsureKeyPair 确保 OHTTP 密钥对存在，返回 base64 编码的公钥 KeyConfig
+// 私钥缺失时: autoGenerate 为 true 则生成新密钥对 (generated=true)，否则返回 ErrKeyNotFound
+func EnsureKeyPair(privPath string, autoGenerate bool) (pubConfig string, generated bool, err error) {
+	pubPath := privPath + ".pub"
+
+	if _, err := os.Stat(privPath); os.IsNotExist(err) {
+		if !autoGenerate {
+			return "", false, fmt.Errorf("%w: %s (已禁用自动生成)", ErrKeyNotFound, privPath)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(privPath), 0755); err != nil {
+			return "", false, fmt.Errorf("创建目录失败: %w", err)
+		}
+		kp, err := GenerateKeyPair()
+		if err != nil {
+			return "", false, err
+		}
+		if err := SaveKeyPair(kp, pubPath, privPath); err != nil {
+			return "", false, fmt.Errorf("保存密钥失败: %w", err)
+		}
+		generated = true
+	}
+
+	pubData, err := os.ReadFile(pubPath)
+	if err != nil {
+		return "", false, fmt.Errorf("读取公钥失败: %w", err)
+	}
+
+	return string(pubData), generated, nil
+}
+
 // LoadPrivateKey 从文件加载私钥
 func LoadPrivateKey(path string) ([]byte, error) {
 	data, err := os.ReadFile(path)
@@ -114,15 +177,22 @@ func LoadPublicKeyConfigBytes(data []byte) (keyID uint8, pubKey []byte, err erro
 
 // EncodeKeyConfig 编码 OHTTP KeyConfig (RFC 9458 Section 3)
 // 格式: KeyID(1) || KEM_ID(2) || PublicKey(Npk) || CipherSuites
-func EncodeKeyConfig(keyID uint8, publicKey []byte) []byte {
+// aeads 为支持的 AEAD 算法 (按偏好顺序)，未指定时只通告 AES-128-GCM
+func EncodeKeyConfig(keyID uint8, publicKey []byte, aeads ...hpke.AEAD) []byte {
+	if len(aeads) == 0 {
+		aeads = []hpke.AEAD{AEADID}
+	}
+
 	// CipherSuite: KDF_ID(2) || AEAD_ID(2)
-	cipherSuite := make([]byte, 4)
-	binary.BigEndian.PutUint16(cipherSuite[0:2], uint16(KDFID))
-	binary.BigEndian.PutUint16(cipherSuite[2:4], uint16(AEADID))
+	cipherSuites := make([]byte, 4*len(aeads))
+	for i, aead := range aeads {
+		binary.BigEndian.PutUint16(cipherSuites[4*i:4*i+2], uint16(KDFID))
+		binary.BigEndian.PutUint16(cipherSuites[4*i+2:4*i+4], uint16(aead))
+	}
 
 	// KeyConfig 长度计算
-	// KeyID(1) + KEM_ID(2) + PublicKeyLen(2) + PublicKey(N) + CipherSuiteLen(2) + CipherSuites(4)
-	buf := make([]byte, 0, 1+2+2+len(publicKey)+2+4)
+	// KeyID(1) + KEM_ID(2) + PublicKeyLen(2) + PublicKey(N) + CipherSuiteLen(2) + CipherSuites(4*M)
+	buf := make([]byte, 0, 1+2+2+len(publicKey)+2+len(cipherSuites))
 	buf = append(buf, keyID)
 
 	kemID := make([]byte, 2)
@@ -135,9 +205,9 @@ func EncodeKeyConfig(keyID uint8, publicKey []byte) []byte {
 	buf = append(buf, publicKey...)
 
 	cipherSuiteLen := make([]byte, 2)
-	binary.BigEndian.PutUint16(cipherSuiteLen, uint16(len(cipherSuite)))
+	binary.BigEndian.PutUint16(cipherSuiteLen, uint16(len(cipherSuites)))
 	buf = append(buf, cipherSuiteLen...)
-	buf = append(buf, cipherSuite...)
+	buf = append(buf, cipherSuites...)
 
 	return buf
 }
@@ -160,6 +230,83 @@ func DecodeKeyConfig(data []byte) (keyID uint8, publicKey []byte, err error) {
 	return keyID, publicKey, nil
 }
 
+// KeyConfig 解码后的单个 OHTTP KeyConfig
+type KeyConfig struct {
+	KeyID     uint8
+	PublicKey []byte
+	AEADs     []hpke.AEAD // 通告的 AEAD 算法 (按偏好顺序)，编码时为空表示只通告 AES-128-GCM
+}
+
+// AEAD 返回请求应使用的 AEAD 算法: Exit 通告的首个本实现支持的算法，未通告时为 AES-128-GCM
+func (c KeyConfig) AEAD() hpke.AEAD {
+	if len(c.AEADs) == 0 {
+		return AEADID
+	}
+	return c.AEADs[0]
+}
+
+// ParseAEADs 按名称解析 AEAD 算法列表 (按偏好顺序)，为空时返回 nil (使用默认 AES-128-GCM)
+func ParseAEADs(names []string) ([]hpke.AEAD, error) {
+	var aeads []hpke.AEAD
+	for _, name := range names {
+		aead, err := ParseAEAD(name)
+		if err != nil {
+			return nil, err
+		}
+		aeads = append(aeads, aead)
+	}
+	return aeads, nil
+}
+
+// EncodeKeyConfigs 编码多个 KeyConfig，按顺序直接拼接
+// 每个 KeyConfig 自带长度信息，只解析首个的旧版 DecodeKeyConfig 仍然可用 (取得首个密钥)
+func EncodeKeyConfigs(configs []KeyConfig) []byte {
+	var buf []byte
+	for _, c := range configs {
+		buf = append(buf, EncodeKeyConfig(c.KeyID, c.PublicKey, c.AEADs...)...)
+	}
+	return buf
+}
+
+// DecodeKeyConfigs 解码拼接的 KeyConfig 列表
+func DecodeKeyConfigs(data []byte) ([]KeyConfig, error) {
+	var configs []KeyConfig
+	for len(data) > 0 {
+		keyID, publicKey, err := DecodeKeyConfig(data)
+		if err != nil {
+			return nil, err
+		}
+
+		// KeyID(1) + KEM_ID(2) + PublicKeyLen(2) + PublicKey(N) + CipherSuiteLen(2) + CipherSuites(M)
+		off := 5 + len(publicKey)
+		if len(data) < off+2 {
+			return nil, fmt.Errorf("KeyConfig 缺少加密套件")
+		}
+		suitesLen := int(binary.BigEndian.Uint16(data[off : off+2]))
+		suites := data[off+2:]
+		off += 2 + suitesLen
+		if len(data) < off {
+			return nil, fmt.Errorf("加密套件数据不完整")
+		}
+
+		// 每个 CipherSuite 为 KDF_ID(2) || AEAD_ID(2)，只保留本实现支持的 AEAD
+		var aeads []hpke.AEAD
+		for i := 0; i+4 <= suitesLen; i += 4 {
+			aead := hpke.AEAD(binary.BigEndian.Uint16(suites[i+2 : i+4]))
+			if hpke.KDF(binary.BigEndian.Uint16(suites[i:i+2])) == KDFID && supportedAEAD(aead) {
+				aeads = append(aeads, aead)
+			}
+		}
+
+		configs = append(configs, KeyConfig{KeyID: keyID, PublicKey: publicKey, AEADs: aeads})
+		data = data[off:]
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("KeyConfig 数据为空")
+	}
+	return configs, nil
+}
+
 // PubKeyHash 计算公钥的 SHA-256 哈希（取前16字节，返回32字符 hex 字符串）
 func PubKeyHash(publicKey []byte) string {
 	hash := sha256.Sum256(publicKey)
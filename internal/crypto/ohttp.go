@@ -3,46 +3,63 @@ package crypto
 import (
 	"bufio"
 	"bytes"
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"net/http/httputil"
+	"slices"
 
 	"github.com/cloudflare/circl/hpke"
 )
 
 // OHTTPClient 客户端 OHTTP 处理器
 type OHTTPClient struct {
-	keyID     uint8
-	pubKeyRaw []byte
-	suite     hpke.Suite
+	keyID      uint8
+	pubKeyRaw  []byte
+	aead       hpke.AEAD
+	suite      hpke.Suite
+	legacyHTTP bool // 内层请求使用 HTTP/1.1 文本编码 (兼容不支持 Binary HTTP 的旧版 Exit)
 }
 
 // NewOHTTPClient 创建 OHTTP 客户端
-func NewOHTTPClient(keyID uint8, publicKeyBytes []byte) (*OHTTPClient, error) {
-	suite := hpke.NewSuite(KEMID, KDFID, AEADID)
+// aead 可选，指定请求使用的 AEAD 算法 (需在 Exit 支持的集合内)，默认 AES-128-GCM
+func NewOHTTPClient(keyID uint8, publicKeyBytes []byte, aead ...hpke.AEAD) (*OHTTPClient, error) {
+	id := AEADID
+	if len(aead) > 0 {
+		id = aead[0]
+	}
+	if !supportedAEAD(id) {
+		return nil, fmt.Errorf("不支持的 AEAD 算法: 0x%04x", uint16(id))
+	}
 
 	return &OHTTPClient{
 		keyID:     keyID,
 		pubKeyRaw: publicKeyBytes,
-		suite:     suite,
+		aead:      id,
+		suite:     hpke.NewSuite(KEMID, KDFID, id),
 	}, nil
 }
 
+// SetLegacyEncoding 设置内层请求是否使用 HTTP/1.1 文本编码 (默认 Binary HTTP)
+// 旧版 Exit 只能解析 HTTP/1.1 文本，Client 对未通告 Binary HTTP 支持的 Exit 启用
+func (c *OHTTPClient) SetLegacyEncoding(legacy bool) {
+	c.legacyHTTP = legacy
+}
+
 // EncapsulateRequest 封装 HTTP 请求为 OHTTP 格式
 // 返回加密后的 OHTTP 请求和用于解密响应的上下文
 func (c *OHTTPClient) EncapsulateRequest(req *http.Request) ([]byte, *ClientContext, error) {
-	// 确保 Content-Length 被设置（http.ReadRequest 需要这个来正确读取 body）
-	if req.Body != nil && req.ContentLength > 0 {
-		req.Header.Set("Content-Length", fmt.Sprintf("%d", req.ContentLength))
+	// 1. 将 HTTP 请求序列化为 Binary HTTP (RFC 9292)，旧版 Exit 使用 HTTP/1.1 文本
+	var reqBytes []byte
+	var err error
+	if c.legacyHTTP {
+		reqBytes, err = encodeLegacyRequest(req)
+	} else {
+		reqBytes, err = EncodeBHTTPRequest(req)
 	}
-
-	// 1. 将 HTTP 请求序列化为 Binary HTTP (简化版: 使用 HTTP/1.1 格式)
-	reqBytes, err := httputil.DumpRequest(req, true)
 	if err != nil {
 		return nil, nil, fmt.Errorf("序列化请求失败: %w", err)
 	}
@@ -70,7 +87,7 @@ func (c *OHTTPClient) EncapsulateRequest(req *http.Request) ([]byte, *ClientCont
 	aad[0] = c.keyID
 	binary.BigEndian.PutUint16(aad[1:3], uint16(KEMID))
 	binary.BigEndian.PutUint16(aad[3:5], uint16(KDFID))
-	binary.BigEndian.PutUint16(aad[5:7], uint16(AEADID))
+	binary.BigEndian.PutUint16(aad[5:7], uint16(c.aead))
 
 	// 4. 加密请求
 	ct, err := sealer.Seal(reqBytes, aad)
@@ -88,6 +105,8 @@ func (c *OHTTPClient) EncapsulateRequest(req *http.Request) ([]byte, *ClientCont
 	// 保存上下文用于解密响应
 	ctx := &ClientContext{
 		sealer: sealer,
+		aead:   c.aead,
+		enc:    enc,
 	}
 
 	return ohttpReq, ctx, nil
@@ -96,52 +115,29 @@ func (c *OHTTPClient) EncapsulateRequest(req *http.Request) ([]byte, *ClientCont
 // ClientContext 客户端上下文，用于解密响应
 type ClientContext struct {
 	sealer hpke.Sealer
+	aead   hpke.AEAD
+	enc    []byte // 请求的 HPKE 封装密钥，参与响应密钥派生
 }
 
 // DecapsulateResponse 解密 OHTTP 响应
 func (ctx *ClientContext) DecapsulateResponse(data []byte) (*http.Response, error) {
-	// OHTTP 响应格式: nonce(16) || ct(N)
-	// 使用 AES-128-GCM，nonce 为 16 字节
-	const nonceLen = 16
+	// OHTTP 响应格式 (RFC 9458 Section 4.4): response_nonce(max(Nn, Nk)) || ct(N)
+	nonceLen := responseNonceSize(ctx.aead)
 	if len(data) < nonceLen+16 { // 至少需要 nonce + tag
 		return nil, fmt.Errorf("响应数据太短")
 	}
 
-	nonce := data[:nonceLen]
+	responseNonce := data[:nonceLen]
 	ct := data[nonceLen:]
 
-	// 使用 Export 导出响应密钥
-	secret := ctx.sealer.Export([]byte("message/bhttp response"), 16)
-
-	// 使用 XOR 生成响应密钥
-	respKey := make([]byte, 16)
-	for i := range respKey {
-		respKey[i] = secret[i] ^ nonce[i]
-	}
-
-	// 创建 AES-GCM 解密器
-	block, err := aes.NewCipher(respKey)
-	if err != nil {
-		return nil, fmt.Errorf("创建 AES 失败: %w", err)
-	}
-
-	aead, err := cipher.NewGCM(block)
+	secret := ctx.sealer.Export([]byte(responseExportLabel), uint(nonceLen))
+	aead, aeadNonce, err := responseAEAD(ctx.aead, secret, ctx.enc, responseNonce)
 	if err != nil {
-		return nil, fmt.Errorf("创建 GCM 失败: %w", err)
-	}
-
-	// 检查密文长度（需要包含 GCM nonce）
-	gcmNonceSize := aead.NonceSize()
-	if len(ct) < gcmNonceSize+aead.Overhead() {
-		return nil, fmt.Errorf("密文太短")
+		return nil, err
 	}
 
-	// 提取 GCM nonce 和实际密文
-	gcmNonce := ct[:gcmNonceSize]
-	actualCt := ct[gcmNonceSize:]
-
 	// 解密响应
-	respBytes, err := aead.Open(nil, gcmNonce, actualCt, nil)
+	respBytes, err := aead.Open(nil, aeadNonce, ct, nil)
 	if err != nil {
 		return nil, fmt.Errorf("解密响应失败: %w", err)
 	}
@@ -162,8 +158,8 @@ type StreamEncryptor struct {
 
 // NewStreamEncryptor 从 HPKE 会话派生流加密密钥
 func (ctx *ServerContext) NewStreamEncryptor() (*StreamEncryptor, error) {
-	streamKey := ctx.opener.Export([]byte("ohttp-stream"), 16)
-	aead, err := newAEAD(streamKey)
+	streamKey := ctx.opener.Export([]byte("ohttp-stream"), ctx.aead.KeySize())
+	aead, err := newAEAD(ctx.aead, streamKey)
 	if err != nil {
 		return nil, err
 	}
@@ -171,7 +167,7 @@ func (ctx *ServerContext) NewStreamEncryptor() (*StreamEncryptor, error) {
 }
 
 // EncryptChunk 加密单个流式数据块
-// 输出格式: gcmNonce(12) || ciphertext+tag(N)
+// 输出格式: nonce(12) || ciphertext+tag(N)
 func (e *StreamEncryptor) EncryptChunk(data []byte) ([]byte, error) {
 	nonce := make([]byte, e.aead.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
@@ -183,6 +179,22 @@ func (e *StreamEncryptor) EncryptChunk(data []byte) ([]byte, error) {
 	return ct, nil
 }
 
+// sequencedChunkHeaderSize 带序号数据块的序号长度
+const sequencedChunkHeaderSize = 8
+
+// EncryptSequencedChunk 加密带序号的流式数据块，序号作为 AAD 参与认证 (Relay 无法篡改)
+// 输出格式: seq(8, 大端) || nonce(12) || ciphertext+tag(N)
+func (e *StreamEncryptor) EncryptSequencedChunk(seq uint64, data []byte) ([]byte, error) {
+	out := make([]byte, sequencedChunkHeaderSize, sequencedChunkHeaderSize+e.aead.NonceSize()+len(data)+e.aead.Overhead())
+	binary.BigEndian.PutUint64(out, seq)
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("生成 nonce 失败: %w", err)
+	}
+	out = append(out, nonce...)
+	return e.aead.Seal(out, nonce, data, out[:sequencedChunkHeaderSize]), nil
+}
+
 // StreamDecryptor 流式解密器 (Client 侧使用)
 type StreamDecryptor struct {
 	aead cipher.AEAD
@@ -190,8 +202,8 @@ type StreamDecryptor struct {
 
 // NewStreamDecryptor 从 HPKE 会话派生流解密密钥
 func (ctx *ClientContext) NewStreamDecryptor() (*StreamDecryptor, error) {
-	streamKey := ctx.sealer.Export([]byte("ohttp-stream"), 16)
-	aead, err := newAEAD(streamKey)
+	streamKey := ctx.sealer.Export([]byte("ohttp-stream"), ctx.aead.KeySize())
+	aead, err := newAEAD(ctx.aead, streamKey)
 	if err != nil {
 		return nil, err
 	}
@@ -216,40 +228,198 @@ func (d *StreamDecryptor) DecryptChunk(data []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
-// newAEAD 创建 AES-128-GCM AEAD 实例
-func newAEAD(key []byte) (cipher.AEAD, error) {
-	block, err := aes.NewCipher(key)
+// DecryptSequencedChunk 解密带序号的流式数据块，返回块序号和明文
+func (d *StreamDecryptor) DecryptSequencedChunk(data []byte) (uint64, []byte, error) {
+	if len(data) < sequencedChunkHeaderSize {
+		return 0, nil, fmt.Errorf("密文太短")
+	}
+	aad := data[:sequencedChunkHeaderSize]
+	rest := data[sequencedChunkHeaderSize:]
+	nonceSize := d.aead.NonceSize()
+	if len(rest) < nonceSize+d.aead.Overhead() {
+		return 0, nil, fmt.Errorf("密文太短")
+	}
+	plaintext, err := d.aead.Open(nil, rest[:nonceSize], rest[nonceSize:], aad)
+	if err != nil {
+		return 0, nil, fmt.Errorf("解密失败: %w", err)
+	}
+	return binary.BigEndian.Uint64(aad), plaintext, nil
+}
+
+// 分块上传的请求体块类型，作为 AAD 参与认证，结束块无法被伪造为数据块 (反之亦然)
+var (
+	requestChunkAAD = []byte{0}
+	requestFinalAAD = []byte{1}
+)
+
+// RequestBodySealer 分块上传请求体的加密器 (Client 侧使用)
+// 每块使用递增序号作为 AEAD nonce，块被丢弃、重排或重放时 Exit 解密失败
+type RequestBodySealer struct {
+	aead cipher.AEAD
+	seq  uint64
+}
+
+// NewRequestBodySealer 从 HPKE 会话派生请求体加密密钥 (与响应流密钥相互独立)
+func (ctx *ClientContext) NewRequestBodySealer() (*RequestBodySealer, error) {
+	key := ctx.sealer.Export([]byte("ohttp-request-stream"), ctx.aead.KeySize())
+	aead, err := newAEAD(ctx.aead, key)
+	if err != nil {
+		return nil, err
+	}
+	return &RequestBodySealer{aead: aead}, nil
+}
+
+// SealChunk 加密单个请求体块
+// 输出格式: ciphertext+tag(N)，nonce 由双方按块序号推算，不随数据发送
+func (s *RequestBodySealer) SealChunk(data []byte) []byte {
+	return s.seal(data, requestChunkAAD)
+}
+
+// SealFinal 生成结束块，之后不能再加密数据块
+func (s *RequestBodySealer) SealFinal() []byte {
+	return s.seal(nil, requestFinalAAD)
+}
+
+func (s *RequestBodySealer) seal(data, aad []byte) []byte {
+	nonce := sequenceNonce(s.aead.NonceSize(), s.seq)
+	s.seq++
+	return s.aead.Seal(nil, nonce, data, aad)
+}
+
+// RequestBodyOpener 分块上传请求体的解密器 (Exit 侧使用)
+type RequestBodyOpener struct {
+	aead cipher.AEAD
+	seq  uint64
+}
+
+// NewRequestBodyOpener 从 HPKE 会话派生请求体解密密钥
+func (ctx *ServerContext) NewRequestBodyOpener() (*RequestBodyOpener, error) {
+	key := ctx.opener.Export([]byte("ohttp-request-stream"), ctx.aead.KeySize())
+	aead, err := newAEAD(ctx.aead, key)
+	if err != nil {
+		return nil, err
+	}
+	return &RequestBodyOpener{aead: aead}, nil
+}
+
+// OpenChunk 按顺序解密下一个请求体块
+func (o *RequestBodyOpener) OpenChunk(data []byte) ([]byte, error) {
+	return o.open(data, requestChunkAAD)
+}
+
+// OpenFinal 校验结束块，确认请求体完整
+func (o *RequestBodyOpener) OpenFinal(data []byte) error {
+	_, err := o.open(data, requestFinalAAD)
+	return err
+}
+
+func (o *RequestBodyOpener) open(data, aad []byte) ([]byte, error) {
+	nonce := sequenceNonce(o.aead.NonceSize(), o.seq)
+	plaintext, err := o.aead.Open(nil, nonce, data, aad)
 	if err != nil {
-		return nil, fmt.Errorf("创建 AES 失败: %w", err)
+		return nil, fmt.Errorf("解密请求体块 %d 失败: %w", o.seq, err)
 	}
-	aead, err := cipher.NewGCM(block)
+	o.seq++
+	return plaintext, nil
+}
+
+// sequenceNonce 将块序号编码为大端 AEAD nonce
+func sequenceNonce(size int, seq uint64) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce[size-8:], seq)
+	return nonce
+}
+
+// newAEAD 按协商的算法创建 AEAD 实例 (AES-128-GCM 或 ChaCha20-Poly1305)
+func newAEAD(id hpke.AEAD, key []byte) (cipher.AEAD, error) {
+	aead, err := id.New(key)
 	if err != nil {
-		return nil, fmt.Errorf("创建 GCM 失败: %w", err)
+		return nil, fmt.Errorf("创建 AEAD 失败: %w", err)
 	}
 	return aead, nil
 }
 
+// responseExportLabel 导出响应密钥的 HPKE exporter context (RFC 9458 Section 4.4)
+const responseExportLabel = "message/bhttp response"
+
+// responseNonceSize 响应 nonce 长度: max(Nn, Nk)
+func responseNonceSize(aead hpke.AEAD) int {
+	return int(max(aead.NonceSize(), aead.KeySize()))
+}
+
+// responseAEAD 按 RFC 9458 Section 4.4 派生响应的 AEAD 密钥和 nonce:
+//
+//	secret     = context.Export("message/bhttp response", max(Nn, Nk))
+//	salt       = enc || response_nonce
+//	prk        = Extract(salt, secret)
+//	aead_key   = Expand(prk, "key", Nk)
+//	aead_nonce = Expand(prk, "nonce", Nn)
+func responseAEAD(id hpke.AEAD, secret, enc, responseNonce []byte) (cipher.AEAD, []byte, error) {
+	salt := make([]byte, 0, len(enc)+len(responseNonce))
+	salt = append(salt, enc...)
+	salt = append(salt, responseNonce...)
+
+	prk := KDFID.Extract(secret, salt)
+	aead, err := newAEAD(id, KDFID.Expand(prk, []byte("key"), id.KeySize()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, KDFID.Expand(prk, []byte("nonce"), id.NonceSize()), nil
+}
+
 // OHTTPServer 服务端 OHTTP 处理器
+// 支持同时持有多个密钥 (按 KeyID 区分)，密钥轮换的重叠期内新旧密钥加密的请求均可解密
 type OHTTPServer struct {
-	keyID      uint8
-	privateKey []byte
-	suite      hpke.Suite
+	keys  map[uint8][]byte // KeyID → 私钥
+	aeads []hpke.AEAD      // 接受的 AEAD 算法
 }
 
+// ErrUnknownKeyID 请求使用的 KeyID 不属于本服务端
+var ErrUnknownKeyID = errors.New("未知的 KeyID")
+
+// ErrUnsupportedSuite 请求使用的加密套件不在服务端支持的集合内
+var ErrUnsupportedSuite = errors.New("不支持的加密套件")
+
 // NewOHTTPServer 创建 OHTTP 服务端
-func NewOHTTPServer(keyID uint8, privateKeyBytes []byte) (*OHTTPServer, error) {
-	suite := hpke.NewSuite(KEMID, KDFID, AEADID)
+// aeads 为接受的 AEAD 算法，未指定时只接受 AES-128-GCM
+func NewOHTTPServer(keyID uint8, privateKeyBytes []byte, aeads ...hpke.AEAD) (*OHTTPServer, error) {
+	return NewOHTTPServerWithKeys(map[uint8][]byte{keyID: privateKeyBytes}, aeads...)
+}
+
+// NewOHTTPServerWithKeys 创建持有多个密钥的 OHTTP 服务端 (KeyID → 私钥)
+func NewOHTTPServerWithKeys(keys map[uint8][]byte, aeads ...hpke.AEAD) (*OHTTPServer, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("至少需要一个 OHTTP 私钥")
+	}
+	if len(aeads) == 0 {
+		aeads = []hpke.AEAD{AEADID}
+	}
+	for _, aead := range aeads {
+		if !supportedAEAD(aead) {
+			return nil, fmt.Errorf("不支持的 AEAD 算法: 0x%04x", uint16(aead))
+		}
+	}
 
+	copied := make(map[uint8][]byte, len(keys))
+	for id, key := range keys {
+		copied[id] = key
+	}
 	return &OHTTPServer{
-		keyID:      keyID,
-		privateKey: privateKeyBytes,
-		suite:      suite,
+		keys:  copied,
+		aeads: slices.Clone(aeads),
 	}, nil
 }
 
+// AEADs 返回服务端接受的 AEAD 算法 (用于在 KeyConfig 中通告)
+func (s *OHTTPServer) AEADs() []hpke.AEAD {
+	return slices.Clone(s.aeads)
+}
+
 // ServerContext 服务端响应上下文
 type ServerContext struct {
 	opener hpke.Opener
+	aead   hpke.AEAD
+	enc    []byte // 请求的 HPKE 封装密钥，参与响应密钥派生
 }
 
 // DecapsulateRequest 解密 OHTTP 请求
@@ -258,19 +428,20 @@ func (s *OHTTPServer) DecapsulateRequest(data []byte) (*http.Request, *ServerCon
 		return nil, nil, fmt.Errorf("OHTTP 请求数据太短")
 	}
 
-	// 解析头部
+	// 解析头部，按 KeyID 选择私钥
 	keyID := data[0]
-	if keyID != s.keyID {
-		return nil, nil, fmt.Errorf("KeyID 不匹配: 期望 %d, 收到 %d", s.keyID, keyID)
+	privateKey, ok := s.keys[keyID]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %d", ErrUnknownKeyID, keyID)
 	}
 
 	kemID := hpke.KEM(binary.BigEndian.Uint16(data[1:3]))
 	kdfID := hpke.KDF(binary.BigEndian.Uint16(data[3:5]))
 	aeadID := hpke.AEAD(binary.BigEndian.Uint16(data[5:7]))
 
-	// 验证加密套件
-	if kemID != KEMID || kdfID != KDFID || aeadID != AEADID {
-		return nil, nil, fmt.Errorf("不支持的加密套件")
+	// 验证加密套件: AEAD 须在服务端接受的集合内
+	if kemID != KEMID || kdfID != KDFID || !slices.Contains(s.aeads, aeadID) {
+		return nil, nil, fmt.Errorf("%w: KEM 0x%04x, KDF 0x%04x, AEAD 0x%04x", ErrUnsupportedSuite, uint16(kemID), uint16(kdfID), uint16(aeadID))
 	}
 
 	// 解析 enc 和密文
@@ -286,12 +457,12 @@ func (s *OHTTPServer) DecapsulateRequest(data []byte) (*http.Request, *ServerCon
 	aad := data[:7]
 
 	// 解密
-	privKey, err := kemScheme.UnmarshalBinaryPrivateKey(s.privateKey)
+	privKey, err := kemScheme.UnmarshalBinaryPrivateKey(privateKey)
 	if err != nil {
 		return nil, nil, fmt.Errorf("解析私钥失败: %w", err)
 	}
 
-	receiver, err := s.suite.NewReceiver(privKey, nil)
+	receiver, err := hpke.NewSuite(KEMID, KDFID, aeadID).NewReceiver(privKey, nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("创建 receiver 失败: %w", err)
 	}
@@ -306,20 +477,23 @@ func (s *OHTTPServer) DecapsulateRequest(data []byte) (*http.Request, *ServerCon
 		return nil, nil, fmt.Errorf("解密请求失败: %w", err)
 	}
 
-	// 解析 HTTP 请求
-	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(reqBytes)))
+	// 解析内层请求 (Binary HTTP，或旧版 Client 的 HTTP/1.1 文本)
+	req, err := decodeRequest(reqBytes)
 	if err != nil {
 		return nil, nil, fmt.Errorf("解析请求失败: %w", err)
 	}
 
 	ctx := &ServerContext{
 		opener: opener,
+		aead:   aeadID,
+		enc:    bytes.Clone(enc),
 	}
 
 	return req, ctx, nil
 }
 
 // EncapsulateResponse 加密 HTTP 响应
+// 密钥派生和封装格式遵循 RFC 9458 Section 4.4 (见 responseAEAD)，内层响应为 HTTP/1.1 序列化
 func (ctx *ServerContext) EncapsulateResponse(resp *http.Response) ([]byte, error) {
 	// 序列化响应
 	var buf bytes.Buffer
@@ -328,45 +502,21 @@ func (ctx *ServerContext) EncapsulateResponse(resp *http.Response) ([]byte, erro
 	}
 	respBytes := buf.Bytes()
 
-	// 使用 Export 导出响应密钥
-	secret := ctx.opener.Export([]byte("message/bhttp response"), 16)
-
-	// 生成随机 nonce
-	nonce := make([]byte, 16)
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+	// 生成随机 response_nonce，按 RFC 9458 派生本次响应的密钥和 nonce
+	responseNonce := make([]byte, responseNonceSize(ctx.aead))
+	if _, err := io.ReadFull(rand.Reader, responseNonce); err != nil {
 		return nil, fmt.Errorf("生成 nonce 失败: %w", err)
 	}
-
-	// XOR 生成响应密钥
-	respKey := make([]byte, 16)
-	for i := range respKey {
-		respKey[i] = secret[i] ^ nonce[i]
-	}
-
-	// 创建 AES-GCM 加密器
-	block, err := aes.NewCipher(respKey)
-	if err != nil {
-		return nil, fmt.Errorf("创建 AES 失败: %w", err)
-	}
-
-	aead, err := cipher.NewGCM(block)
+	secret := ctx.opener.Export([]byte(responseExportLabel), uint(len(responseNonce)))
+	aead, aeadNonce, err := responseAEAD(ctx.aead, secret, ctx.enc, responseNonce)
 	if err != nil {
-		return nil, fmt.Errorf("创建 GCM 失败: %w", err)
-	}
-
-	// 生成随机 GCM nonce
-	gcmNonce := make([]byte, aead.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, gcmNonce); err != nil {
-		return nil, fmt.Errorf("生成 GCM nonce 失败: %w", err)
+		return nil, err
 	}
 
-	// 加密响应（nonce || 密文）
-	ct := aead.Seal(gcmNonce, gcmNonce, respBytes, nil)
-
-	// 返回: nonce || ct
-	result := make([]byte, 0, len(nonce)+len(ct))
-	result = append(result, nonce...)
-	result = append(result, ct...)
+	// 返回: response_nonce || ct
+	result := make([]byte, 0, len(responseNonce)+len(respBytes)+aead.Overhead())
+	result = append(result, responseNonce...)
+	result = aead.Seal(result, aeadNonce, respBytes, nil)
 
 	return result, nil
 }
@@ -7,14 +7,17 @@ import (
 	"sync"
 	"time"
 
+	"github.com/binn/tokengo/internal/protocol"
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multihash"
 )
 
 const (
-	// 发现超时
+	// 发现超时 (整轮发现)
 	DiscoveryTimeout = 30 * time.Second
+	// 单次 Provider 查询超时 (默认值，可通过 Config.ProviderTimeout 覆盖)
+	ProviderLookupTimeout = 10 * time.Second
 	// 缓存刷新间隔
 	CacheRefreshInterval = 2 * time.Minute
 	// 最大发现数量
@@ -28,6 +31,15 @@ type Discovery struct {
 	ctx   context.Context
 	cancel context.CancelFunc
 	wg    sync.WaitGroup
+
+	providerTimeout    time.Duration // 单次 Provider 查询超时，避免一次慢查询耗尽整轮发现时间
+	findProvidersAsync func(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo
+
+	isRelay     func(id peer.ID) bool // 局域网节点是否通告了 Relay 服务
+	isReachable func(id peer.ID) bool // 局域网节点当前是否仍保持连接
+
+	store      *peerStore                                         // 磁盘节点缓存 (未配置 CacheFile 时为 nil)
+	probeRelay func(ctx context.Context, info peer.AddrInfo) error // 使用磁盘缓存的 Relay 前探测可达性，nil 时不探测
 }
 
 // serviceCache 服务缓存
@@ -35,17 +47,83 @@ type serviceCache struct {
 	mu       sync.RWMutex
 	relays   []peer.AddrInfo
 	relayTTL time.Time
+	local    []peer.AddrInfo // mDNS 发现的局域网 Relay (按发现顺序)
+	fromDisk bool            // relays 来自磁盘缓存，DHT 尚未返回结果
+	diskUsed bool            // 已尝试过磁盘缓存 (只在冷启动时使用一次)
 }
 
 // NewDiscovery 创建服务发现器
 func NewDiscovery(node *Node) *Discovery {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Discovery{
-		node:   node,
-		cache:  &serviceCache{},
-		ctx:    ctx,
-		cancel: cancel,
+	d := &Discovery{
+		node:            node,
+		cache:           &serviceCache{},
+		ctx:             ctx,
+		cancel:          cancel,
+		providerTimeout: ProviderLookupTimeout,
+	}
+	if node.config != nil && node.config.ProviderTimeout > 0 {
+		d.providerTimeout = node.config.ProviderTimeout
+	}
+	if node.config != nil && node.config.CacheFile != "" {
+		d.store = openPeerStore(node.config.CacheFile)
+	}
+	d.findProvidersAsync = func(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+		return d.node.DHT().FindProvidersAsync(ctx, c, count)
+	}
+	d.isRelay = func(id peer.ID) bool {
+		return d.node.peerProvides(id, d.node.ServiceNamespace("relay"))
+	}
+	d.isReachable = d.node.isConnected
+	node.onLocalPeer(d.handleLocalPeer)
+	return d
+}
+
+// handleLocalPeer 记录 mDNS 发现的局域网 Relay，非 Relay 节点忽略
+func (d *Discovery) handleLocalPeer(info peer.AddrInfo) {
+	if d.node.IsSelf(info.ID) || len(info.Addrs) == 0 || !d.isRelay(info.ID) {
+		return
+	}
+
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	for i := range d.cache.local {
+		if d.cache.local[i].ID == info.ID {
+			d.cache.local[i] = info
+			return
+		}
+	}
+	d.cache.local = append(d.cache.local, info)
+	log.Printf("mDNS 发现局域网 Relay: %s", info.ID)
+}
+
+// mergedRelaysLocked 合并可达的局域网 Relay 与 DHT 发现结果，返回合并列表和其中局域网 Relay 的数量
+// 局域网 Relay 排在前面；同时出现在 DHT 结果中的节点合并地址 (局域网地址在前)。调用者需持有 cache.mu
+func (d *Discovery) mergedRelaysLocked() ([]peer.AddrInfo, int) {
+	var local []peer.AddrInfo
+	for _, info := range d.cache.local {
+		if d.isReachable(info.ID) {
+			local = append(local, info)
+		}
 	}
+	return mergeRelays(local, d.cache.relays), len(local)
+}
+
+// mergeRelays 按 PeerID 合并 Relay 列表，保持先后顺序
+func mergeRelays(lists ...[]peer.AddrInfo) []peer.AddrInfo {
+	var merged []peer.AddrInfo
+	index := make(map[peer.ID]int)
+	for _, list := range lists {
+		for _, p := range list {
+			if i, ok := index[p.ID]; ok {
+				merged[i].Addrs = mergeAddrs(merged[i].Addrs, p.Addrs)
+				continue
+			}
+			index[p.ID] = len(merged)
+			merged = append(merged, peer.AddrInfo{ID: p.ID, Addrs: mergeAddrs(p.Addrs)})
+		}
+	}
+	return merged
 }
 
 // Start 启动后台发现任务
@@ -85,19 +163,26 @@ func (d *Discovery) refreshRelays() {
 	ctx, cancel := context.WithTimeout(d.ctx, DiscoveryTimeout)
 	defer cancel()
 
-	peers, err := d.findProviders(ctx, RelayServiceNamespace)
+	peers, err := d.findProviders(ctx, d.node.ServiceNamespace("relay"))
 	if err != nil {
 		log.Printf("警告: 发现 Relay 节点失败: %v", err)
 		return
 	}
 
 	d.cache.mu.Lock()
+	if len(peers) == 0 && d.cache.fromDisk {
+		// DHT 暂无结果，继续使用磁盘缓存中已探测可达的 Relay
+		d.cache.mu.Unlock()
+		return
+	}
 	d.cache.relays = peers
 	d.cache.relayTTL = time.Now().Add(CacheRefreshInterval)
+	d.cache.fromDisk = false
 	d.cache.mu.Unlock()
 
 	if len(peers) > 0 {
 		log.Printf("发现 %d 个 Relay 节点", len(peers))
+		d.saveRelays(peers)
 	}
 }
 
@@ -110,13 +195,15 @@ func (d *Discovery) findProviders(ctx context.Context, namespace string) ([]peer
 	}
 	c := cid.NewCidV1(cid.Raw, hash)
 
-	// 查找提供者
-	peerChan := d.node.DHT().FindProvidersAsync(ctx, c, MaxDiscoveryCount)
+	// 查找提供者 (单独限时，超时后返回已找到的部分结果)
+	ctx, cancel := context.WithTimeout(ctx, d.providerTimeout)
+	defer cancel()
+	peerChan := d.findProvidersAsync(ctx, c, MaxDiscoveryCount)
 
 	var peers []peer.AddrInfo
 	for p := range peerChan {
-		if p.ID == d.node.PeerID() {
-			// 跳过自己
+		if d.node.IsSelf(p.ID) {
+			// 跳过自己 (含过渡身份)
 			continue
 		}
 		if len(p.Addrs) > 0 {
@@ -127,46 +214,119 @@ func (d *Discovery) findProviders(ctx context.Context, namespace string) ([]peer
 	return peers, nil
 }
 
-// DiscoverRelays 发现 Relay 节点
+// DiscoverRelays 发现 Relay 节点 (mDNS 发现的可达局域网 Relay 优先)
 func (d *Discovery) DiscoverRelays(ctx context.Context) ([]peer.AddrInfo, error) {
-	// 检查缓存
+	// 检查缓存: 缓存有效或已有可达的局域网 Relay 时直接返回，DHT 结果由后台刷新
 	d.cache.mu.RLock()
-	if time.Now().Before(d.cache.relayTTL) && len(d.cache.relays) > 0 {
-		peers := make([]peer.AddrInfo, len(d.cache.relays))
-		copy(peers, d.cache.relays)
-		d.cache.mu.RUnlock()
+	peers, local := d.mergedRelaysLocked()
+	fresh := time.Now().Before(d.cache.relayTTL) && len(d.cache.relays) > 0
+	d.cache.mu.RUnlock()
+	if fresh || local > 0 {
 		return peers, nil
 	}
-	d.cache.mu.RUnlock()
+
+	// 冷启动时先使用磁盘缓存中可达的 Relay，DHT 发现由后台刷新继续
+	if cached := d.cachedRelays(ctx); len(cached) > 0 {
+		return cached, nil
+	}
 
 	// 重新发现
-	peers, err := d.findProviders(ctx, RelayServiceNamespace)
+	found, err := d.findProviders(ctx, d.node.ServiceNamespace("relay"))
 	if err != nil {
 		return nil, err
 	}
 
 	// 更新缓存
 	d.cache.mu.Lock()
-	d.cache.relays = peers
+	d.cache.relays = found
 	d.cache.relayTTL = time.Now().Add(CacheRefreshInterval)
+	d.cache.fromDisk = false
+	peers, _ = d.mergedRelaysLocked()
 	d.cache.mu.Unlock()
 
+	if len(found) > 0 {
+		d.saveRelays(found)
+	}
 	return peers, nil
 }
 
-// GetCachedRelays 获取缓存的 Relay 节点
+// SetRelayProbe 设置使用磁盘缓存的 Relay 前的可达性探测 (如 QUIC 握手)
+func (d *Discovery) SetRelayProbe(probe func(ctx context.Context, info peer.AddrInfo) error) {
+	d.probeRelay = probe
+}
+
+// cachedRelays 返回磁盘缓存中探测可达的 Relay，只在首次需要时尝试一次
+// DHT 在探测期间已返回结果时以 DHT 结果为准
+func (d *Discovery) cachedRelays(ctx context.Context) []peer.AddrInfo {
+	if d.store == nil {
+		return nil
+	}
+	d.cache.mu.Lock()
+	used := d.cache.diskUsed
+	d.cache.diskUsed = true
+	d.cache.mu.Unlock()
+	if used {
+		return nil
+	}
+
+	relays := d.store.relays()
+	if d.probeRelay != nil && len(relays) > 0 {
+		relays = probeRelays(ctx, relays, d.probeRelay)
+	}
+	if len(relays) == 0 {
+		return nil
+	}
+
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+	if len(d.cache.relays) == 0 {
+		d.cache.relays = relays
+		d.cache.relayTTL = time.Now().Add(CacheRefreshInterval)
+		d.cache.fromDisk = true
+		log.Printf("使用磁盘缓存的 %d 个 Relay 节点 (DHT 发现在后台继续)", len(relays))
+	}
+	peers, _ := d.mergedRelaysLocked()
+	return peers
+}
+
+// saveRelays 将 DHT 发现的 Relay 写入磁盘缓存
+func (d *Discovery) saveRelays(relays []peer.AddrInfo) {
+	if d.store == nil {
+		return
+	}
+	d.store.update(func(c *PeerCache) { c.Relays = relays })
+}
+
+// CachedExits 返回磁盘缓存中最近一次可用的 Exit 公钥 (未配置 CacheFile 时为空)
+func (d *Discovery) CachedExits() []protocol.ExitKeyEntry {
+	if d.store == nil {
+		return nil
+	}
+	return d.store.exits()
+}
+
+// SaveExits 将从 Relay 获取的 Exit 公钥写入磁盘缓存 (未配置 CacheFile 时忽略)
+func (d *Discovery) SaveExits(exits []protocol.ExitKeyEntry) {
+	if d.store == nil || len(exits) == 0 {
+		return
+	}
+	d.store.update(func(c *PeerCache) { c.Exits = exits })
+}
+
+// GetCachedRelays 获取缓存的 Relay 节点 (含可达的局域网 Relay)
 func (d *Discovery) GetCachedRelays() []peer.AddrInfo {
 	d.cache.mu.RLock()
 	defer d.cache.mu.RUnlock()
 
-	peers := make([]peer.AddrInfo, len(d.cache.relays))
-	copy(peers, d.cache.relays)
+	peers, _ := d.mergedRelaysLocked()
 	return peers
 }
 
-// RelayCount 返回已发现的 Relay 数量
+// RelayCount 返回已发现的 Relay 数量 (含可达的局域网 Relay)
 func (d *Discovery) RelayCount() int {
 	d.cache.mu.RLock()
 	defer d.cache.mu.RUnlock()
-	return len(d.cache.relays)
+
+	peers, _ := d.mergedRelaysLocked()
+	return len(peers)
 }
@@ -0,0 +1,295 @@
+package dht
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/identity"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func newTestDiscovery(t *testing.T, cfg *Config) *Discovery {
+	t.Helper()
+	node, err := NewNode(cfg)
+	if err != nil {
+		t.Fatalf("NewNode failed: %v", err)
+	}
+	d := NewDiscovery(node)
+	t.Cleanup(d.Stop)
+	return d
+}
+
+func TestNewDiscovery_ProviderTimeout(t *testing.T) {
+	d := newTestDiscovery(t, &Config{})
+	if d.providerTimeout != ProviderLookupTimeout {
+		t.Errorf("default providerTimeout = %v, want %v", d.providerTimeout, ProviderLookupTimeout)
+	}
+
+	d = newTestDiscovery(t, &Config{ProviderTimeout: 3 * time.Second})
+	if d.providerTimeout != 3*time.Second {
+		t.Errorf("providerTimeout = %v, want 3s", d.providerTimeout)
+	}
+}
+
+func TestDiscovery_SlowProviderLookupBounded(t *testing.T) {
+	d := newTestDiscovery(t, &Config{ProviderTimeout: 50 * time.Millisecond})
+
+	addr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/udp/4433/quic-v1")
+	found := peer.AddrInfo{ID: peer.ID("relay-1"), Addrs: []ma.Multiaddr{addr}}
+	d.findProvidersAsync = func(ctx context.Context, _ cid.Cid, _ int) <-chan peer.AddrInfo {
+		ch := make(chan peer.AddrInfo, 1)
+		ch <- found
+		go func() {
+			defer close(ch)
+			// 模拟慢查询: 返回一个结果后挂起，直到 context 取消才结束
+			<-ctx.Done()
+		}()
+		return ch
+	}
+
+	// 整轮发现预算远大于单次查询超时
+	ctx, cancel := context.WithTimeout(context.Background(), DiscoveryTimeout)
+	defer cancel()
+
+	start := time.Now()
+	peers, err := d.findProviders(ctx, RelayServiceNamespace)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("findProviders failed: %v", err)
+	}
+	if len(peers) != 1 || peers[0].ID != found.ID {
+		t.Errorf("peers = %v, want partial result %s", peers, found.ID)
+	}
+	if elapsed > time.Second {
+		t.Errorf("slow lookup took %v, should be bounded by provider timeout", elapsed)
+	}
+}
+
+// saveTestIdentity 生成身份并保存到临时目录，返回密钥路径
+func saveTestIdentity(t *testing.T, name string) (string, peer.ID) {
+	t.Helper()
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := id.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	return path, id.PeerID
+}
+
+// startTestNode 启动只连接指定 Bootstrap 节点的本地 DHT 节点
+func startTestNode(t *testing.T, cfg *Config, bootstrap []peer.AddrInfo) *Node {
+	t.Helper()
+	cfg.ListenAddrs = []string{"/ip4/127.0.0.1/tcp/0"}
+	node, err := NewNode(cfg)
+	if err != nil {
+		t.Fatalf("NewNode failed: %v", err)
+	}
+	node.resolveBootstrap = func(context.Context, []string) []peer.AddrInfo { return bootstrap }
+	node.routingTableTimeout = 5 * time.Second
+	if len(bootstrap) == 0 {
+		node.routingTableTimeout = 0 // 种子节点无需等待
+	}
+	if err := node.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() { node.Stop() })
+	return node
+}
+
+func TestNode_TransitionalIdentityDiscoverableUnderBothPeerIDs(t *testing.T) {
+	seed := startTestNode(t, &Config{Mode: "server"}, nil)
+	seedInfo := []peer.AddrInfo{{ID: seed.PeerID(), Addrs: seed.Addrs()}}
+
+	newKey, newID := saveTestIdentity(t, "identity.key")
+	oldKey, oldID := saveTestIdentity(t, "old-identity.key")
+	relay := startTestNode(t, &Config{Mode: "server", PrivateKeyPath: newKey, TransitionalKeyPath: oldKey}, seedInfo)
+	if got := relay.PeerIDs(); len(got) != 2 || got[0] != newID || got[1] != oldID {
+		t.Fatalf("PeerIDs = %v, want [%s %s]", got, newID, oldID)
+	}
+
+	provider := NewProvider(relay, "relay")
+	if err := provider.Register(&ServiceInfo{ServiceType: "relay"}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	t.Cleanup(provider.Unregister)
+
+	client := startTestNode(t, &Config{Mode: "client"}, seedInfo)
+	d := NewDiscovery(client)
+	t.Cleanup(d.Stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	peers, err := d.DiscoverRelays(ctx)
+	if err != nil {
+		t.Fatalf("DiscoverRelays failed: %v", err)
+	}
+	found := make(map[peer.ID]bool)
+	for _, p := range peers {
+		found[p.ID] = true
+	}
+	if !found[newID] || !found[oldID] {
+		t.Errorf("discovered %v, want both new %s and transitional %s", peers, newID, oldID)
+	}
+
+	// 节点自身发现时跳过两个身份
+	own, err := NewDiscovery(relay).findProviders(ctx, RelayServiceNamespace)
+	if err != nil {
+		t.Fatalf("findProviders failed: %v", err)
+	}
+	for _, p := range own {
+		if relay.IsSelf(p.ID) {
+			t.Errorf("node discovered itself as %s", p.ID)
+		}
+	}
+}
+
+func TestNode_ServiceNamespaceByNetworkID(t *testing.T) {
+	node, err := NewNode(&Config{})
+	if err != nil {
+		t.Fatalf("NewNode failed: %v", err)
+	}
+	if got := node.ServiceNamespace("relay"); got != RelayServiceNamespace {
+		t.Errorf("default relay namespace = %s, want %s", got, RelayServiceNamespace)
+	}
+	if got := node.ServiceNamespace("exit"); got != ExitServiceNamespace {
+		t.Errorf("default exit namespace = %s, want %s", got, ExitServiceNamespace)
+	}
+
+	node, err = NewNode(&Config{NetworkID: "acme"})
+	if err != nil {
+		t.Fatalf("NewNode failed: %v", err)
+	}
+	if got := NetworkProtocolPrefix("acme"); got != "/tokengo/acme" {
+		t.Errorf("protocol prefix = %s, want /tokengo/acme", got)
+	}
+	if got := node.ServiceNamespace("relay"); got != "/tokengo/acme/relay/v1" {
+		t.Errorf("relay namespace = %s, want /tokengo/acme/relay/v1", got)
+	}
+
+	for _, id := range []string{"acme/prod", "a b", "../x"} {
+		if _, err := NewNode(&Config{NetworkID: id}); err == nil {
+			t.Errorf("NewNode accepted invalid network ID %q", id)
+		}
+	}
+}
+
+func TestDiscovery_NetworkIDIsolation(t *testing.T) {
+	seed := startTestNode(t, &Config{Mode: "server", NetworkID: "acme"}, nil)
+	seedInfo := []peer.AddrInfo{{ID: seed.PeerID(), Addrs: seed.Addrs()}}
+
+	relay := startTestNode(t, &Config{Mode: "server", NetworkID: "acme"}, seedInfo)
+	provider := NewProvider(relay, "relay")
+	if provider.Namespace() != "/tokengo/acme/relay/v1" {
+		t.Fatalf("provider namespace = %s, want /tokengo/acme/relay/v1", provider.Namespace())
+	}
+	if err := provider.Register(&ServiceInfo{ServiceType: "relay"}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	t.Cleanup(provider.Unregister)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	// 同一网络的 Client 发现该 Relay
+	member := NewDiscovery(startTestNode(t, &Config{Mode: "client", NetworkID: "acme"}, seedInfo))
+	t.Cleanup(member.Stop)
+	peers, err := member.DiscoverRelays(ctx)
+	if err != nil {
+		t.Fatalf("DiscoverRelays failed: %v", err)
+	}
+	if len(peers) != 1 || peers[0].ID != relay.PeerID() {
+		t.Errorf("same network discovered %v, want relay %s", peers, relay.PeerID())
+	}
+
+	// 其他网络 (含默认网络) 的 Client 即使连接同一 Bootstrap 节点、直接查询 acme 的命名空间也无法发现
+	for _, networkID := range []string{"", "other"} {
+		outsider := NewDiscovery(startTestNode(t, &Config{Mode: "client", NetworkID: networkID}, seedInfo))
+		t.Cleanup(outsider.Stop)
+		peers, _ := outsider.findProviders(ctx, provider.Namespace())
+		for _, p := range peers {
+			if p.ID == relay.PeerID() {
+				t.Errorf("network %q discovered relay %s of network acme", networkID, p.ID)
+			}
+		}
+	}
+}
+
+func TestNewNode_TransitionalIdentity(t *testing.T) {
+	key, _ := saveTestIdentity(t, "identity.key")
+
+	if _, err := NewNode(&Config{PrivateKeyPath: key, TransitionalKeyPath: key}); err == nil {
+		t.Error("transitional identity equal to the primary should be rejected")
+	}
+	missing := filepath.Join(t.TempDir(), "missing.key")
+	if _, err := NewNode(&Config{PrivateKeyPath: key, TransitionalKeyPath: missing}); !errors.Is(err, identity.ErrKeyNotFound) {
+		t.Errorf("missing transitional key err = %v, want ErrKeyNotFound", err)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Error("transitional key must not be generated")
+	}
+}
+
+func TestDiscovery_LocalRelayPreferred(t *testing.T) {
+	d := newTestDiscovery(t, &Config{})
+
+	lanAddr, _ := ma.NewMultiaddr("/ip4/192.168.1.10/udp/4433/quic-v1")
+	wanAddr, _ := ma.NewMultiaddr("/ip4/203.0.113.10/udp/4433/quic-v1")
+	otherAddr, _ := ma.NewMultiaddr("/ip4/203.0.113.20/udp/4433/quic-v1")
+	local := peer.ID("relay-lan")
+	exitPeer := peer.ID("exit-lan")
+
+	d.isRelay = func(id peer.ID) bool { return id == local }
+	reachable := true
+	d.isReachable = func(peer.ID) bool { return reachable }
+	d.findProvidersAsync = func(ctx context.Context, _ cid.Cid, _ int) <-chan peer.AddrInfo {
+		ch := make(chan peer.AddrInfo, 2)
+		ch <- peer.AddrInfo{ID: peer.ID("relay-wan"), Addrs: []ma.Multiaddr{otherAddr}}
+		ch <- peer.AddrInfo{ID: local, Addrs: []ma.Multiaddr{wanAddr}}
+		close(ch)
+		return ch
+	}
+
+	// 模拟 mDNS 回调: Relay 进入缓存，非 Relay 节点被忽略
+	d.node.notifyLocalPeer(peer.AddrInfo{ID: local, Addrs: []ma.Multiaddr{lanAddr}})
+	d.node.notifyLocalPeer(peer.AddrInfo{ID: exitPeer, Addrs: []ma.Multiaddr{lanAddr}})
+
+	cached := d.GetCachedRelays()
+	if len(cached) != 1 || cached[0].ID != local {
+		t.Fatalf("cached relays = %v, want only %s", cached, local)
+	}
+
+	// 已有局域网 Relay 时不阻塞等待 DHT 查询
+	peers, err := d.DiscoverRelays(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverRelays failed: %v", err)
+	}
+	if len(peers) != 1 || peers[0].ID != local {
+		t.Fatalf("DiscoverRelays = %v, want the local relay", peers)
+	}
+
+	// DHT 结果与局域网结果合并: 局域网 Relay 在前，地址以局域网地址优先
+	d.refreshRelays()
+	peers = d.GetCachedRelays()
+	if len(peers) != 2 || peers[0].ID != local || peers[1].ID != peer.ID("relay-wan") {
+		t.Fatalf("merged relays = %v, want local relay first", peers)
+	}
+	if len(peers[0].Addrs) != 2 || !peers[0].Addrs[0].Equal(lanAddr) || !peers[0].Addrs[1].Equal(wanAddr) {
+		t.Errorf("local relay addrs = %v, want LAN address before DHT address", peers[0].Addrs)
+	}
+
+	// 局域网 Relay 不可达时只保留 DHT 结果
+	reachable = false
+	peers = d.GetCachedRelays()
+	if len(peers) != 2 || peers[0].ID != peer.ID("relay-wan") || len(peers[1].Addrs) != 1 {
+		t.Errorf("relays with unreachable LAN peer = %v, want DHT results only", peers)
+	}
+}
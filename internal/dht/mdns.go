@@ -0,0 +1,134 @@
+package dht
+
+import (
+	"context"
+	"io"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// MDNSServiceName 局域网 mDNS 服务名 (与 libp2p 默认服务名区分，只发现 TokenGo 节点)
+	MDNSServiceName = "_tokengo._udp"
+
+	// localConnectTimeout 连接 mDNS 发现的局域网节点的超时
+	localConnectTimeout = 10 * time.Second
+)
+
+// startLocalDiscovery 启动 mDNS 局域网发现 (Config.EnableMDNS)
+// 发现的节点直接连接，无需经过公网 Bootstrap 即可填充路由表
+func (n *Node) startLocalDiscovery(h host.Host) {
+	// 以服务命名空间作为 libp2p 协议通告服务类型，发现方经 identify 区分 Relay/Exit
+	h.SetStreamHandler(protocol.ID(n.ServiceNamespace(n.config.ServiceType)), func(s network.Stream) {
+		s.Reset()
+	})
+
+	svc, err := newMDNSService(h, MDNSServiceName, n.handleLocalPeer)
+	if err != nil {
+		log.Printf("警告: 启动 mDNS 局域网发现失败: %v", err)
+		return
+	}
+	n.mdns = svc
+	log.Printf("已启用 mDNS 局域网发现: %s", MDNSServiceName)
+}
+
+// mdnsNotifee 将 mDNS 发现回调转为异步处理，避免连接耗时阻塞解析循环
+type mdnsNotifee func(peer.AddrInfo)
+
+func (f mdnsNotifee) HandlePeerFound(pi peer.AddrInfo) {
+	go f(pi)
+}
+
+// newMDNSService 启动 libp2p mDNS 服务: 在局域网通告本节点并发现同一服务名的其他节点
+func newMDNSService(h host.Host, serviceName string, found func(peer.AddrInfo)) (io.Closer, error) {
+	svc := mdns.NewMdnsService(h, serviceName, mdnsNotifee(found))
+	if err := svc.Start(); err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+// handleLocalPeer 处理 mDNS 发现的节点: 连接并在 identify 完成后通知发现器
+func (n *Node) handleLocalPeer(pi peer.AddrInfo) {
+	if n.IsSelf(pi.ID) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(n.ctx, localConnectTimeout)
+	defer cancel()
+	if err := n.host.Connect(ctx, pi); err != nil {
+		log.Printf("警告: 连接局域网节点 %s 失败: %v", pi.ID, err)
+		return
+	}
+
+	// identify 完成后 peerstore 中包含对端通告的全部地址 (含 QUIC 外部地址)，局域网地址在前
+	n.notifyLocalPeer(peer.AddrInfo{ID: pi.ID, Addrs: mergeAddrs(pi.Addrs, n.host.Peerstore().Addrs(pi.ID))})
+}
+
+// notifyLocalPeer 记录已连接的局域网节点并通知各回调
+func (n *Node) notifyLocalPeer(info peer.AddrInfo) {
+	n.localMu.Lock()
+	if n.localPeers == nil {
+		n.localPeers = make(map[peer.ID]peer.AddrInfo)
+	}
+	n.localPeers[info.ID] = info
+	handlers := slices.Clone(n.localHandlers)
+	n.localMu.Unlock()
+
+	for _, handle := range handlers {
+		handle(info)
+	}
+}
+
+// onLocalPeer 注册局域网节点回调，已发现的节点立即回放
+func (n *Node) onLocalPeer(handle func(peer.AddrInfo)) {
+	n.localMu.Lock()
+	n.localHandlers = append(n.localHandlers, handle)
+	found := make([]peer.AddrInfo, 0, len(n.localPeers))
+	for _, info := range n.localPeers {
+		found = append(found, info)
+	}
+	n.localMu.Unlock()
+
+	for _, info := range found {
+		handle(info)
+	}
+}
+
+// peerProvides 判断已连接节点是否通告了指定服务 (由 identify 交换的协议列表得知)
+func (n *Node) peerProvides(id peer.ID, namespace string) bool {
+	if n.host == nil {
+		return false
+	}
+	supported, err := n.host.Peerstore().SupportsProtocols(id, protocol.ID(namespace))
+	return err == nil && len(supported) > 0
+}
+
+// isConnected 判断是否与节点保持连接
+func (n *Node) isConnected(id peer.ID) bool {
+	if n.host == nil {
+		return false
+	}
+	return n.host.Network().Connectedness(id) == network.Connected
+}
+
+// mergeAddrs 合并地址列表并去重，保持先后顺序
+func mergeAddrs(lists ...[]multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	var merged []multiaddr.Multiaddr
+	for _, addrs := range lists {
+		for _, addr := range addrs {
+			if !slices.ContainsFunc(merged, addr.Equal) {
+				merged = append(merged, addr)
+			}
+		}
+	}
+	return merged
+}
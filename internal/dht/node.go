@@ -3,6 +3,7 @@ package dht
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"sync"
 	"sync/atomic"
@@ -39,6 +40,32 @@ type Config struct {
 
 	// 服务类型: "relay", "exit", "client"
 	ServiceType string `yaml:"service_type,omitempty"`
+
+	// 禁用身份密钥自动生成 (PrivateKeyPath 指向的文件必须存在)
+	NoAutoGenerate bool `yaml:"no_auto_generate,omitempty"`
+
+	// 单次 Provider 查询超时 (0 使用默认值 ProviderLookupTimeout)
+	ProviderTimeout time.Duration `yaml:"provider_timeout,omitempty"`
+
+	// 服务注册重试 (0 使用默认值): 首次等待、等待上限、启动时的最大尝试次数
+	// 尝试耗尽后 Provider 转入后台继续重试，不会放弃注册
+	RegisterMinBackoff time.Duration `yaml:"register_min_backoff,omitempty"`
+	RegisterMaxBackoff time.Duration `yaml:"register_max_backoff,omitempty"`
+	RegisterMaxRetries int           `yaml:"register_max_retries,omitempty"`
+
+	// 过渡身份密钥 (可选，文件必须存在): 身份密钥轮换期间同时以旧 PeerID 通告服务，
+	// 使仍按旧 PeerID 查找的节点能够发现并验证此节点；迁移完成后移除
+	TransitionalKeyPath string `yaml:"transitional_private_key_file,omitempty"`
+
+	// 启用 mDNS 局域网发现: 同一子网的节点直接互连，发现的 Relay 优先加入 Relay 列表
+	EnableMDNS bool `yaml:"enable_mdns,omitempty"`
+
+	// 节点缓存文件 (可选): 持久化最近发现的 Relay 和 Exit 公钥，冷启动时在 DHT 发现完成前使用
+	CacheFile string `yaml:"cache_file,omitempty"`
+
+	// 网络 ID (可选): 派生 DHT 协议前缀和服务命名空间 (如 acme → /tokengo/acme)，
+	// 私有部署以此与公共网络隔离，不同网络 ID 的节点互不发现；为空时使用默认网络 /tokengo
+	NetworkID string `yaml:"network_id,omitempty"`
 }
 
 // Node DHT 节点
@@ -51,23 +78,62 @@ type Node struct {
 	cancel   context.CancelFunc
 	mu       sync.RWMutex
 	started  bool
+
+	// 过渡身份: 以旧 PeerID 运行的第二个 Host/DHT，只用于通告服务 (未配置时为 nil)
+	transitional     *identity.Identity
+	transitionalHost host.Host
+	transitionalDHT  *dht.IpfsDHT
+
+	resolveBootstrap    func(ctx context.Context, configPeers []string) []peer.AddrInfo
+	routingTableTimeout time.Duration // 启动时等待路由表填充的最长时间
+
+	// mDNS 局域网发现 (未启用时为 nil)
+	mdns          io.Closer
+	localMu       sync.Mutex
+	localPeers    map[peer.ID]peer.AddrInfo // 已连接的局域网节点
+	localHandlers []func(peer.AddrInfo)     // 局域网节点回调 (Discovery)
 }
 
 // NewNode 创建 DHT 节点
 func NewNode(cfg *Config) (*Node, error) {
+	if err := ValidateNetworkID(cfg.NetworkID); err != nil {
+		return nil, err
+	}
+
 	// 加载或生成节点身份
-	id, err := identity.LoadOrGenerate(cfg.PrivateKeyPath)
+	var id *identity.Identity
+	var err error
+	if cfg.NoAutoGenerate && cfg.PrivateKeyPath != "" {
+		id, err = identity.LoadExisting(cfg.PrivateKeyPath)
+	} else {
+		id, err = identity.LoadOrGenerate(cfg.PrivateKeyPath)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("加载节点身份失败: %w", err)
 	}
 
+	// 过渡身份只能是已有的旧密钥，不自动生成
+	var transitional *identity.Identity
+	if cfg.TransitionalKeyPath != "" {
+		transitional, err = identity.LoadExisting(cfg.TransitionalKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("加载过渡身份失败: %w", err)
+		}
+		if transitional.PeerID == id.PeerID {
+			return nil, fmt.Errorf("过渡身份与当前身份相同: %s", id.PeerID)
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Node{
-		identity: id,
-		config:   cfg,
-		ctx:      ctx,
-		cancel:   cancel,
+		identity:            id,
+		transitional:        transitional,
+		config:              cfg,
+		ctx:                 ctx,
+		cancel:              cancel,
+		resolveBootstrap:    ResolveBootstrapPeers,
+		routingTableTimeout: 10 * time.Second,
 	}, nil
 }
 
@@ -90,6 +156,68 @@ func (n *Node) Start(ctx context.Context) error {
 		listenAddrs = append(listenAddrs, ma)
 	}
 
+	h, kdht, err := n.newHost(ctx, n.identity, listenAddrs)
+	if err != nil {
+		return err
+	}
+	n.host = h
+	n.dht = kdht
+
+	if n.config.EnableMDNS {
+		n.startLocalDiscovery(h)
+	}
+
+	// 过渡身份的 Host 使用相同的监听地址 (端口由系统分配)，通告相同的外部地址
+	if n.transitional != nil {
+		th, tdht, err := n.newHost(ctx, n.transitional, ephemeralListenAddrs(listenAddrs))
+		if err != nil {
+			kdht.Close()
+			h.Close()
+			return fmt.Errorf("启动过渡身份失败: %w", err)
+		}
+		n.transitionalHost = th
+		n.transitionalDHT = tdht
+	}
+
+	// 连接 Bootstrap 节点
+	addrInfos := n.resolveBootstrap(ctx, n.config.BootstrapPeers)
+	if err := n.connectBootstrapPeers(ctx, n.host, addrInfos); err != nil {
+		log.Printf("警告: 连接 Bootstrap 节点失败: %v", err)
+	}
+	if n.transitionalHost != nil {
+		if err := n.connectBootstrapPeers(ctx, n.transitionalHost, addrInfos); err != nil {
+			log.Printf("警告: 过渡身份连接 Bootstrap 节点失败: %v", err)
+		}
+	}
+
+	// Bootstrap DHT
+	for _, d := range n.dhts() {
+		if err := d.Bootstrap(ctx); err != nil {
+			return fmt.Errorf("Bootstrap DHT 失败: %w", err)
+		}
+	}
+
+	// 等待路由表填充 (轮询替代硬编码 Sleep)
+	log.Printf("等待 DHT 路由表填充...")
+	if err := n.waitForRoutingTable(ctx); err != nil {
+		log.Printf("警告: %v", err)
+	}
+	log.Printf("DHT 路由表大小: %d", n.dht.RoutingTable().Size())
+
+	n.started = true
+	log.Printf("DHT 节点已启动, PeerID: %s", n.identity.PeerID)
+	for _, addr := range n.host.Addrs() {
+		log.Printf("  监听: %s/p2p/%s", addr, n.identity.PeerID)
+	}
+	if n.transitionalHost != nil {
+		log.Printf("过渡身份已启动, 同时以旧 PeerID 通告服务: %s", n.transitional.PeerID)
+	}
+
+	return nil
+}
+
+// newHost 为指定身份创建 libp2p Host 和 Kademlia DHT
+func (n *Node) newHost(ctx context.Context, id *identity.Identity, listenAddrs []multiaddr.Multiaddr) (host.Host, *dht.IpfsDHT, error) {
 	// 创建连接管理器
 	connMgr, err := connmgr.NewConnManager(
 		100, // 最小连接数
@@ -97,7 +225,7 @@ func (n *Node) Start(ctx context.Context) error {
 		connmgr.WithGracePeriod(time.Minute),
 	)
 	if err != nil {
-		return fmt.Errorf("创建连接管理器失败: %w", err)
+		return nil, nil, fmt.Errorf("创建连接管理器失败: %w", err)
 	}
 
 	// 确定 DHT 模式选项
@@ -107,13 +235,13 @@ func (n *Node) Start(ctx context.Context) error {
 	} else {
 		dhtOpts = append(dhtOpts, dht.Mode(dht.ModeClient))
 	}
-	// 使用私有 DHT 协议前缀，与公共 IPFS DHT 隔离
-	dhtOpts = append(dhtOpts, dht.ProtocolPrefix(protocol.ID("/tokengo")))
+	// 使用私有 DHT 协议前缀，与公共 IPFS DHT 及其他 TokenGo 网络隔离
+	dhtOpts = append(dhtOpts, dht.ProtocolPrefix(protocol.ID(NetworkProtocolPrefix(n.config.NetworkID))))
 
 	// 创建 libp2p Host
 	var kdht *dht.IpfsDHT
 	opts := []libp2p.Option{
-		libp2p.Identity(n.identity.PrivKey),
+		libp2p.Identity(id.PrivKey),
 		libp2p.ListenAddrs(listenAddrs...),
 		libp2p.ConnectionManager(connMgr),
 		libp2p.Security(noise.ID, noise.New),
@@ -148,47 +276,45 @@ func (n *Node) Start(ctx context.Context) error {
 
 	h, err := libp2p.New(opts...)
 	if err != nil {
-		return fmt.Errorf("创建 libp2p Host 失败: %w", err)
-	}
-
-	n.host = h
-	n.dht = kdht
-
-	// 连接 Bootstrap 节点
-	if err := n.connectBootstrapPeers(ctx); err != nil {
-		log.Printf("警告: 连接 Bootstrap 节点失败: %v", err)
+		return nil, nil, fmt.Errorf("创建 libp2p Host 失败: %w", err)
 	}
+	return h, kdht, nil
+}
 
-	// Bootstrap DHT
-	if err := n.dht.Bootstrap(ctx); err != nil {
-		return fmt.Errorf("Bootstrap DHT 失败: %w", err)
+// ephemeralListenAddrs 将监听地址的 TCP/UDP 端口替换为 0 (由系统分配)，避免与主身份的 Host 冲突
+func ephemeralListenAddrs(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	result := make([]multiaddr.Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		parts := multiaddr.Split(addr)
+		for i, part := range parts {
+			p := part.Protocols()[0]
+			if p.Code != multiaddr.P_TCP && p.Code != multiaddr.P_UDP {
+				continue
+			}
+			if c, err := multiaddr.NewComponent(p.Name, "0"); err == nil {
+				parts[i] = c
+			}
+		}
+		result = append(result, multiaddr.Join(parts...))
 	}
+	return result
+}
 
-	// 等待路由表填充 (轮询替代硬编码 Sleep)
-	log.Printf("等待 DHT 路由表填充...")
-	if err := n.waitForRoutingTable(ctx); err != nil {
-		log.Printf("警告: %v", err)
+// dhts 返回节点的全部 DHT (主身份在前，过渡身份在后)
+func (n *Node) dhts() []*dht.IpfsDHT {
+	if n.transitionalDHT == nil {
+		return []*dht.IpfsDHT{n.dht}
 	}
-	log.Printf("DHT 路由表大小: %d", n.dht.RoutingTable().Size())
-
-	n.started = true
-	log.Printf("DHT 节点已启动, PeerID: %s", n.identity.PeerID)
-	for _, addr := range n.host.Addrs() {
-		log.Printf("  监听: %s/p2p/%s", addr, n.identity.PeerID)
-	}
-
-	return nil
+	return []*dht.IpfsDHT{n.dht, n.transitionalDHT}
 }
 
-// connectBootstrapPeers 连接 Bootstrap 节点
-func (n *Node) connectBootstrapPeers(ctx context.Context) error {
-	// 使用 ResolveBootstrapPeers 获取所有 bootstrap peers (硬编码 + GitHub JSON + 配置)
-	addrInfos := ResolveBootstrapPeers(ctx, n.config.BootstrapPeers)
-
+// connectBootstrapPeers 将 Host 连接到 Bootstrap 节点
+// addrInfos 由 resolveBootstrap 获取 (硬编码 + GitHub JSON + 配置)
+func (n *Node) connectBootstrapPeers(ctx context.Context, h host.Host, addrInfos []peer.AddrInfo) error {
 	// 过滤掉自己的地址（种子节点不需要连接自己）
 	var filteredAddrInfos []peer.AddrInfo
 	for _, info := range addrInfos {
-		if info.ID != n.identity.PeerID {
+		if !n.IsSelf(info.ID) {
 			filteredAddrInfos = append(filteredAddrInfos, info)
 		}
 	}
@@ -207,7 +333,7 @@ func (n *Node) connectBootstrapPeers(ctx context.Context) error {
 		wg.Add(1)
 		go func(info peer.AddrInfo) {
 			defer wg.Done()
-			if err := n.host.Connect(ctx, info); err != nil {
+			if err := h.Connect(ctx, info); err != nil {
 				log.Printf("警告: 连接 Bootstrap 节点失败 %s: %v", info.ID, err)
 			} else {
 				atomic.AddInt32(&connected, 1)
@@ -226,7 +352,7 @@ func (n *Node) waitForRoutingTable(ctx context.Context) error {
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
-	timeout := time.After(10 * time.Second)
+	timeout := time.After(n.routingTableTimeout)
 
 	for {
 		select {
@@ -235,10 +361,9 @@ func (n *Node) waitForRoutingTable(ctx context.Context) error {
 			if size > 0 {
 				return nil // 有节点就行
 			}
-			return fmt.Errorf("路由表在 10s 后仍为空")
+			return fmt.Errorf("路由表在 %v 后仍为空", n.routingTableTimeout)
 		case <-ticker.C:
-			size := n.dht.RoutingTable().Size()
-			if size > 0 {
+			if n.routingTablesReady() {
 				return nil
 			}
 		case <-ctx.Done():
@@ -247,6 +372,16 @@ func (n *Node) waitForRoutingTable(ctx context.Context) error {
 	}
 }
 
+// routingTablesReady 所有身份的路由表均已有节点 (过渡身份也需要能通告服务)
+func (n *Node) routingTablesReady() bool {
+	for _, d := range n.dhts() {
+		if d.RoutingTable().Size() == 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // Stop 停止 DHT 节点
 func (n *Node) Stop() error {
 	n.mu.Lock()
@@ -258,6 +393,21 @@ func (n *Node) Stop() error {
 
 	n.cancel()
 
+	if n.mdns != nil {
+		n.mdns.Close()
+	}
+
+	if n.transitionalDHT != nil {
+		if err := n.transitionalDHT.Close(); err != nil {
+			log.Printf("警告: 关闭过渡身份 DHT 失败: %v", err)
+		}
+	}
+	if n.transitionalHost != nil {
+		if err := n.transitionalHost.Close(); err != nil {
+			log.Printf("警告: 关闭过渡身份 Host 失败: %v", err)
+		}
+	}
+
 	if n.dht != nil {
 		if err := n.dht.Close(); err != nil {
 			log.Printf("警告: 关闭 DHT 失败: %v", err)
@@ -290,11 +440,34 @@ func (n *Node) PeerID() peer.ID {
 	return n.identity.PeerID
 }
 
+// ServiceNamespace 返回本节点所在网络中服务类型 ("relay"、"exit") 的命名空间
+func (n *Node) ServiceNamespace(serviceType string) string {
+	return serviceNamespace(n.config.NetworkID, serviceType)
+}
+
 // Identity 返回节点身份
 func (n *Node) Identity() *identity.Identity {
 	return n.identity
 }
 
+// TransitionalIdentity 返回过渡身份，未配置时返回 nil
+func (n *Node) TransitionalIdentity() *identity.Identity {
+	return n.transitional
+}
+
+// PeerIDs 返回节点通告服务使用的全部 PeerID (主身份在前)
+func (n *Node) PeerIDs() []peer.ID {
+	if n.transitional == nil {
+		return []peer.ID{n.identity.PeerID}
+	}
+	return []peer.ID{n.identity.PeerID, n.transitional.PeerID}
+}
+
+// IsSelf 判断 PeerID 是否属于本节点 (主身份或过渡身份)
+func (n *Node) IsSelf(id peer.ID) bool {
+	return id == n.identity.PeerID || (n.transitional != nil && id == n.transitional.PeerID)
+}
+
 // Addrs 返回节点地址列表
 func (n *Node) Addrs() []multiaddr.Multiaddr {
 	if n.host == nil {
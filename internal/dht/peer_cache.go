@@ -0,0 +1,148 @@
+package dht
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// PeerCacheMaxAge 磁盘节点缓存的最长有效期，超过后整体忽略
+	PeerCacheMaxAge = 7 * 24 * time.Hour
+	// peerCacheProbeTimeout 启动时探测缓存 Relay 的超时 (所有 Relay 并行探测)
+	peerCacheProbeTimeout = 3 * time.Second
+)
+
+// PeerCache 持久化到磁盘的节点缓存: 最近一次可用的 Relay 和 Exit 公钥
+// 冷启动时作为 DHT 发现完成前的临时来源
+type PeerCache struct {
+	SavedAt time.Time               `json:"saved_at"`
+	Relays  []peer.AddrInfo         `json:"relays,omitempty"`
+	Exits   []protocol.ExitKeyEntry `json:"exits,omitempty"`
+}
+
+// LoadPeerCache 读取节点缓存文件
+func LoadPeerCache(path string) (*PeerCache, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c PeerCache
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("解析节点缓存失败: %w", err)
+	}
+	return &c, nil
+}
+
+// Save 写入节点缓存文件 (先写临时文件再重命名，避免中途退出留下不完整的文件)
+func (c *PeerCache) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化节点缓存失败: %w", err)
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("创建节点缓存目录失败: %w", err)
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入节点缓存失败: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入节点缓存失败: %w", err)
+	}
+	return nil
+}
+
+// Stale 检查缓存是否超过 maxAge
+func (c *PeerCache) Stale(maxAge time.Duration, now time.Time) bool {
+	return now.Sub(c.SavedAt) > maxAge
+}
+
+// peerStore 节点缓存文件的读写 (未配置文件时为 nil)
+type peerStore struct {
+	path string
+
+	mu      sync.Mutex
+	current PeerCache // 最近一次写入或启动时加载的内容
+}
+
+// openPeerStore 打开节点缓存文件，文件不存在、无法解析或已过期时从空缓存开始
+func openPeerStore(path string) *peerStore {
+	s := &peerStore{path: path}
+	c, err := LoadPeerCache(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		log.Printf("警告: 读取节点缓存 %s 失败: %v (忽略)", path, err)
+	case c.Stale(PeerCacheMaxAge, time.Now()):
+		log.Printf("节点缓存 %s 已超过 %v 未更新，忽略", path, PeerCacheMaxAge)
+	default:
+		s.current = *c
+	}
+	return s
+}
+
+// relays 返回加载或最近写入的 Relay
+func (s *peerStore) relays() []peer.AddrInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current.Relays
+}
+
+// exits 返回加载或最近写入的 Exit 公钥
+func (s *peerStore) exits() []protocol.ExitKeyEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current.Exits
+}
+
+// update 修改缓存内容并写回文件，写入失败只记录日志
+func (s *peerStore) update(modify func(c *PeerCache)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	modify(&s.current)
+	s.current.SavedAt = time.Now()
+	if err := s.current.Save(s.path); err != nil {
+		log.Printf("警告: %v", err)
+	}
+}
+
+// probeRelays 并行探测 Relay，返回可达的 Relay (保持原顺序)
+func probeRelays(ctx context.Context, relays []peer.AddrInfo, probe func(ctx context.Context, info peer.AddrInfo) error) []peer.AddrInfo {
+	ctx, cancel := context.WithTimeout(ctx, peerCacheProbeTimeout)
+	defer cancel()
+
+	ok := make([]bool, len(relays))
+	var wg sync.WaitGroup
+	for i, info := range relays {
+		wg.Add(1)
+		go func(i int, info peer.AddrInfo) {
+			defer wg.Done()
+			if err := probe(ctx, info); err != nil {
+				log.Printf("缓存的 Relay %s 不可达: %v", info.ID, err)
+				return
+			}
+			ok[i] = true
+		}(i, info)
+	}
+	wg.Wait()
+
+	var reachable []peer.AddrInfo
+	for i, info := range relays {
+		if ok[i] {
+			reachable = append(reachable, info)
+		}
+	}
+	return reachable
+}
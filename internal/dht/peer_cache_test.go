@@ -0,0 +1,174 @@
+package dht
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/identity"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// testRelayInfo 生成一个带合法 PeerID 的 Relay 地址信息 (PeerID 需能经 JSON 往返)
+func testRelayInfo(t *testing.T, addr string) peer.AddrInfo {
+	t.Helper()
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("identity.Generate failed: %v", err)
+	}
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		t.Fatalf("NewMultiaddr failed: %v", err)
+	}
+	return peer.AddrInfo{ID: id.PeerID, Addrs: []ma.Multiaddr{maddr}}
+}
+
+func TestPeerCache_SaveLoadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "peers.json")
+	relay := testRelayInfo(t, "/ip4/203.0.113.10/udp/4433/quic-v1")
+	want := &PeerCache{
+		SavedAt: time.Now().UTC().Truncate(time.Second),
+		Relays:  []peer.AddrInfo{relay},
+		Exits:   []protocol.ExitKeyEntry{{PubKeyHash: "exit-1", KeyConfig: []byte{1, 2, 3}, Models: []string{"gpt-4o"}}},
+	}
+	if err := want.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	got, err := LoadPeerCache(path)
+	if err != nil {
+		t.Fatalf("LoadPeerCache failed: %v", err)
+	}
+	if !got.SavedAt.Equal(want.SavedAt) {
+		t.Errorf("SavedAt = %v, want %v", got.SavedAt, want.SavedAt)
+	}
+	if len(got.Relays) != 1 || got.Relays[0].ID != relay.ID || !got.Relays[0].Addrs[0].Equal(relay.Addrs[0]) {
+		t.Errorf("Relays = %v, want %v", got.Relays, want.Relays)
+	}
+	if len(got.Exits) != 1 || got.Exits[0].PubKeyHash != "exit-1" || string(got.Exits[0].KeyConfig) != "\x01\x02\x03" || got.Exits[0].Models[0] != "gpt-4o" {
+		t.Errorf("Exits = %+v, want %+v", got.Exits, want.Exits)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("cache file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestOpenPeerStore_IgnoresStaleOrBrokenCache(t *testing.T) {
+	dir := t.TempDir()
+	relays := []peer.AddrInfo{testRelayInfo(t, "/ip4/203.0.113.10/udp/4433/quic-v1")}
+
+	fresh := filepath.Join(dir, "fresh.json")
+	(&PeerCache{SavedAt: time.Now().Add(-time.Hour), Relays: relays}).Save(fresh)
+	if got := openPeerStore(fresh).relays(); len(got) != 1 {
+		t.Errorf("fresh cache relays = %v, want 1", got)
+	}
+
+	stale := filepath.Join(dir, "stale.json")
+	(&PeerCache{SavedAt: time.Now().Add(-PeerCacheMaxAge - time.Hour), Relays: relays}).Save(stale)
+	if got := openPeerStore(stale).relays(); len(got) != 0 {
+		t.Errorf("stale cache relays = %v, want none", got)
+	}
+
+	broken := filepath.Join(dir, "broken.json")
+	os.WriteFile(broken, []byte("{not json"), 0600)
+	if got := openPeerStore(broken).relays(); len(got) != 0 {
+		t.Errorf("broken cache relays = %v, want none", got)
+	}
+
+	if got := openPeerStore(filepath.Join(dir, "missing.json")).relays(); len(got) != 0 {
+		t.Errorf("missing cache relays = %v, want none", got)
+	}
+}
+
+func TestDiscovery_ColdStartUsesProbedCachedRelays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	up := testRelayInfo(t, "/ip4/203.0.113.10/udp/4433/quic-v1")
+	down := testRelayInfo(t, "/ip4/203.0.113.20/udp/4433/quic-v1")
+	(&PeerCache{SavedAt: time.Now(), Relays: []peer.AddrInfo{down, up}}).Save(path)
+
+	d := newTestDiscovery(t, &Config{CacheFile: path})
+	var dhtResults []peer.AddrInfo
+	d.findProvidersAsync = func(ctx context.Context, _ cid.Cid, _ int) <-chan peer.AddrInfo {
+		ch := make(chan peer.AddrInfo, len(dhtResults))
+		for _, p := range dhtResults {
+			ch <- p
+		}
+		close(ch)
+		return ch
+	}
+	var probed atomic.Int32
+	d.SetRelayProbe(func(ctx context.Context, info peer.AddrInfo) error {
+		probed.Add(1)
+		if info.ID == down.ID {
+			return errors.New("unreachable")
+		}
+		return nil
+	})
+
+	// DHT 尚未返回结果: 只使用探测可达的缓存 Relay
+	peers, err := d.DiscoverRelays(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverRelays failed: %v", err)
+	}
+	if len(peers) != 1 || peers[0].ID != up.ID || probed.Load() != 2 {
+		t.Fatalf("DiscoverRelays = %v after %d probes, want only the reachable cached relay", peers, probed.Load())
+	}
+
+	// DHT 暂无结果时保留缓存的 Relay
+	d.refreshRelays()
+	if peers := d.GetCachedRelays(); len(peers) != 1 || peers[0].ID != up.ID {
+		t.Errorf("relays after empty DHT refresh = %v, want cached relay kept", peers)
+	}
+
+	// DHT 返回结果后取代缓存，并写回磁盘
+	found := testRelayInfo(t, "/ip4/203.0.113.30/udp/4433/quic-v1")
+	dhtResults = []peer.AddrInfo{found}
+	d.refreshRelays()
+	if peers := d.GetCachedRelays(); len(peers) != 1 || peers[0].ID != found.ID {
+		t.Errorf("relays after DHT refresh = %v, want %s", peers, found.ID)
+	}
+	saved, err := LoadPeerCache(path)
+	if err != nil || len(saved.Relays) != 1 || saved.Relays[0].ID != found.ID {
+		t.Errorf("saved relays = %v (%v), want DHT result", saved, err)
+	}
+
+	// Exit 公钥与 Relay 一起持久化，重启后可用
+	d.SaveExits([]protocol.ExitKeyEntry{{PubKeyHash: "exit-1", KeyConfig: []byte{1}}})
+	restarted := newTestDiscovery(t, &Config{CacheFile: path})
+	if exits := restarted.CachedExits(); len(exits) != 1 || exits[0].PubKeyHash != "exit-1" {
+		t.Errorf("cached exits after restart = %+v, want exit-1", exits)
+	}
+	if relays := restarted.store.relays(); len(relays) != 1 || relays[0].ID != found.ID {
+		t.Errorf("cached relays after restart = %v, want %s", relays, found.ID)
+	}
+}
+
+func TestDiscovery_AllCachedRelaysUnreachableFallsBackToDHT(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	(&PeerCache{SavedAt: time.Now(), Relays: []peer.AddrInfo{testRelayInfo(t, "/ip4/203.0.113.10/udp/4433/quic-v1")}}).Save(path)
+
+	d := newTestDiscovery(t, &Config{CacheFile: path})
+	found := testRelayInfo(t, "/ip4/203.0.113.30/udp/4433/quic-v1")
+	d.findProvidersAsync = func(ctx context.Context, _ cid.Cid, _ int) <-chan peer.AddrInfo {
+		ch := make(chan peer.AddrInfo, 1)
+		ch <- found
+		close(ch)
+		return ch
+	}
+	d.SetRelayProbe(func(context.Context, peer.AddrInfo) error { return errors.New("unreachable") })
+
+	peers, err := d.DiscoverRelays(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverRelays failed: %v", err)
+	}
+	if len(peers) != 1 || peers[0].ID != found.ID {
+		t.Errorf("DiscoverRelays = %v, want DHT result", peers)
+	}
+}
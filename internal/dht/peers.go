@@ -31,11 +31,33 @@ var bootstrapJSONURLs = []string{
 type BootstrapPeerList struct {
 	Version int      `json:"version"`
 	Peers   []string `json:"peers"`
+	Relays  []string `json:"relays,omitempty"` // Relay 的 QUIC 服务地址 (含 /p2p/)，供 DHT 不可用时直接连接
 }
 
-// ProtocolPrefix 私有 DHT 协议前缀
+// ProtocolPrefix 默认网络的私有 DHT 协议前缀
 const ProtocolPrefix = "/tokengo"
 
+// NetworkProtocolPrefix 返回网络 ID 对应的 DHT 协议前缀: 空 ID 为默认网络 (/tokengo)，
+// 否则为 /tokengo/<id>；不同网络的节点使用不同的 DHT 协议和服务命名空间，互不发现
+func NetworkProtocolPrefix(networkID string) string {
+	if networkID == "" {
+		return ProtocolPrefix
+	}
+	return ProtocolPrefix + "/" + networkID
+}
+
+// ValidateNetworkID 检查网络 ID: 只能包含字母、数字、'-'、'_' 和 '.'，空表示默认网络
+func ValidateNetworkID(networkID string) error {
+	for _, r := range networkID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return fmt.Errorf("无效的网络 ID %q: 只能包含字母、数字、'-'、'_' 和 '.'", networkID)
+		}
+	}
+	return nil
+}
+
 // ResolveBootstrapPeers 解析 bootstrap peers
 // 从三个来源获取并合并：硬编码默认值、GitHub JSON、配置文件
 func ResolveBootstrapPeers(ctx context.Context, configPeers []string) []peer.AddrInfo {
@@ -157,8 +179,17 @@ func fetchBootstrapPeers(ctx context.Context) []peer.AddrInfo {
 	return nil
 }
 
-// fetchFromURL 从指定 URL 获取并解析 bootstrap.json
+// fetchFromURL 从指定 URL 获取 bootstrap.json 并解析其中的 bootstrap peers
 func fetchFromURL(ctx context.Context, client *http.Client, url string) ([]peer.AddrInfo, error) {
+	peerList, err := FetchBootstrapPeerList(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	return parseMultiaddrs(peerList.Peers, "github"), nil
+}
+
+// FetchBootstrapPeerList 从指定 URL 获取并解析 bootstrap.json
+func FetchBootstrapPeerList(ctx context.Context, client *http.Client, url string) (*BootstrapPeerList, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %w", err)
@@ -188,5 +219,5 @@ func fetchFromURL(ctx context.Context, client *http.Client, url string) ([]peer.
 		return nil, fmt.Errorf("不支持的 bootstrap.json 版本: %d", peerList.Version)
 	}
 
-	return parseMultiaddrs(peerList.Peers, "github"), nil
+	return &peerList, nil
 }
@@ -2,6 +2,7 @@ package dht
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -13,12 +14,20 @@ import (
 )
 
 const (
-	// 服务命名空间
-	RelayServiceNamespace = "/tokengo/relay/v1"
-	ExitServiceNamespace  = "/tokengo/exit/v1"
+	// 默认网络的服务命名空间 (配置 NetworkID 时由 serviceNamespace 派生)
+	RelayServiceNamespace = ProtocolPrefix + "/relay/v1"
+	ExitServiceNamespace  = ProtocolPrefix + "/exit/v1"
 
 	// Provider 刷新间隔
 	ProviderRefreshInterval = 3 * time.Minute
+
+	// 注册重试默认值 (可通过 Config 覆盖)
+	DefaultRegisterMinBackoff = 3 * time.Second
+	DefaultRegisterMaxBackoff = 30 * time.Second
+	DefaultRegisterMaxRetries = 5
+
+	// 后台重试间隔: 种子节点等待路由表填充，或启动时重试耗尽后继续注册
+	ProviderRetryInterval = 10 * time.Second
 )
 
 // ServiceInfo 服务信息
@@ -41,32 +50,61 @@ type Provider struct {
 	wg          sync.WaitGroup
 	mu          sync.RWMutex
 	registered  bool
+
+	minBackoff    time.Duration // 首次重试等待时间
+	maxBackoff    time.Duration // 重试等待上限
+	maxRetries    int           // 启动时的最大尝试次数，耗尽后转入后台重试
+	retryInterval time.Duration // 后台重试间隔
+
+	provideFn        func(c cid.Cid) error // 通告服务 (测试可替换)
+	routingTableSize func() int            // 路由表大小 (测试可替换)
+}
+
+// serviceNamespace 返回网络中服务类型对应的命名空间
+func serviceNamespace(networkID, serviceType string) string {
+	return NetworkProtocolPrefix(networkID) + "/" + serviceType + "/v1"
 }
 
 // NewProvider 创建服务提供者
 func NewProvider(node *Node, serviceType string) *Provider {
-	var namespace string
-	switch serviceType {
-	case "relay":
-		namespace = RelayServiceNamespace
-	case "exit":
-		namespace = ExitServiceNamespace
-	default:
-		namespace = "/tokengo/" + serviceType + "/v1"
-	}
+	namespace := node.ServiceNamespace(serviceType)
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Provider{
-		node:        node,
-		serviceType: serviceType,
-		namespace:   namespace,
-		ctx:         ctx,
-		cancel:      cancel,
+	p := &Provider{
+		node:          node,
+		serviceType:   serviceType,
+		namespace:     namespace,
+		ctx:           ctx,
+		cancel:        cancel,
+		minBackoff:    DefaultRegisterMinBackoff,
+		maxBackoff:    DefaultRegisterMaxBackoff,
+		maxRetries:    DefaultRegisterMaxRetries,
+		retryInterval: ProviderRetryInterval,
 	}
+	if cfg := node.config; cfg != nil {
+		if cfg.RegisterMinBackoff > 0 {
+			p.minBackoff = cfg.RegisterMinBackoff
+		}
+		if cfg.RegisterMaxBackoff > 0 {
+			p.maxBackoff = cfg.RegisterMaxBackoff
+		}
+		if cfg.RegisterMaxRetries > 0 {
+			p.maxRetries = cfg.RegisterMaxRetries
+		}
+	}
+	if p.maxBackoff < p.minBackoff {
+		p.maxBackoff = p.minBackoff
+	}
+	p.provideFn = p.provide
+	p.routingTableSize = func() int {
+		return p.node.DHT().RoutingTable().Size()
+	}
+	return p
 }
 
 // Register 注册服务到 DHT（带重试）
+// 重试耗尽时返回错误，但仍在后台按 retryInterval 继续注册直到成功或 Unregister
 func (p *Provider) Register(info *ServiceInfo) error {
 	p.mu.Lock()
 	p.serviceInfo = info
@@ -79,8 +117,7 @@ func (p *Provider) Register(info *ServiceInfo) error {
 	}
 
 	// 检查路由表是否为空（种子节点模式）
-	routingTableSize := p.node.DHT().RoutingTable().Size()
-	if routingTableSize == 0 {
+	if p.routingTableSize() == 0 {
 		log.Printf("种子节点模式: 路由表为空，跳过 DHT Provide（其他节点将连接到此节点）")
 		p.mu.Lock()
 		p.registered = true
@@ -92,26 +129,24 @@ func (p *Provider) Register(info *ServiceInfo) error {
 	}
 
 	// 带重试的注册（等待 DHT 路由表填充）
-	backoff := 3 * time.Second
-	const maxBackoff = 30 * time.Second
-	const maxRetries = 5
+	backoff := p.minBackoff
 
 	var lastErr error
-	for i := 0; i < maxRetries; i++ {
+	for i := 0; i < p.maxRetries; i++ {
 		if i > 0 {
-			log.Printf("DHT 注册重试 (%d/%d)，等待 %v...", i+1, maxRetries, backoff)
+			log.Printf("DHT 注册重试 (%d/%d)，等待 %v...", i+1, p.maxRetries, backoff)
 			select {
 			case <-time.After(backoff):
 			case <-p.ctx.Done():
 				return fmt.Errorf("服务已停止")
 			}
 			backoff = time.Duration(float64(backoff) * 2)
-			if backoff > maxBackoff {
-				backoff = maxBackoff
+			if backoff > p.maxBackoff {
+				backoff = p.maxBackoff
 			}
 		}
 
-		if err := p.node.DHT().Provide(p.ctx, c, true); err != nil {
+		if err := p.provideFn(c); err != nil {
 			lastErr = err
 			log.Printf("DHT Provide 失败: %v", err)
 			continue
@@ -123,13 +158,16 @@ func (p *Provider) Register(info *ServiceInfo) error {
 	}
 
 	if lastErr != nil {
-		return fmt.Errorf("注册服务失败（重试 %d 次）: %w", maxRetries, lastErr)
+		// 不放弃注册: 由 refreshLoop 在后台继续重试
+		p.wg.Add(1)
+		go p.refreshLoop()
+		return fmt.Errorf("注册服务失败（重试 %d 次，后台继续重试）: %w", p.maxRetries, lastErr)
 	}
 
 	p.mu.Lock()
 	p.registered = true
 	p.mu.Unlock()
-	log.Printf("已注册服务到 DHT: %s (PeerID: %s)", p.namespace, p.node.PeerID())
+	log.Printf("已注册服务到 DHT: %s (PeerID: %v)", p.namespace, p.node.PeerIDs())
 
 	// 启动心跳刷新
 	p.wg.Add(1)
@@ -138,6 +176,17 @@ func (p *Provider) Register(info *ServiceInfo) error {
 	return nil
 }
 
+// provide 以节点的全部身份通告服务 (配置过渡身份时新旧 PeerID 均可被发现)
+func (p *Provider) provide(c cid.Cid) error {
+	var errs []error
+	for _, d := range p.node.dhts() {
+		if err := d.Provide(p.ctx, c, true); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // createServiceCID 创建服务标识 CID
 func (p *Provider) createServiceCID() (cid.Cid, error) {
 	// 使用命名空间创建 CID
@@ -155,8 +204,8 @@ func (p *Provider) refreshLoop() {
 	ticker := time.NewTicker(ProviderRefreshInterval)
 	defer ticker.Stop()
 
-	// 快速重试定时器（用于种子节点在路由表填充后注册）
-	retryTicker := time.NewTicker(10 * time.Second)
+	// 快速重试定时器（用于种子节点在路由表填充后注册，或启动时重试耗尽后继续注册）
+	retryTicker := time.NewTicker(p.retryInterval)
 	defer retryTicker.Stop()
 
 	registered := false
@@ -179,25 +228,28 @@ func (p *Provider) refreshLoop() {
 				continue
 			}
 
-			if err := p.node.DHT().Provide(p.ctx, c, true); err != nil {
+			if err := p.provideFn(c); err != nil {
 				log.Printf("警告: 刷新服务注册失败: %v", err)
 			} else {
 				log.Printf("已刷新服务注册: %s", p.namespace)
 				if !registered {
 					registered = true
-					log.Printf("已注册服务到 DHT: %s (PeerID: %s)", p.namespace, p.node.PeerID())
+					log.Printf("已注册服务到 DHT: %s (PeerID: %v)", p.namespace, p.node.PeerIDs())
 				}
 			}
 		case <-retryTicker.C:
-			// 种子节点：当路由表有新节点时尝试注册
-			if !registered && p.node.DHT().RoutingTable().Size() > 0 {
+			// 种子节点或重试耗尽：当路由表有新节点时尝试注册
+			if !registered && p.routingTableSize() > 0 {
 				c, err := p.createServiceCID()
 				if err != nil {
 					continue
 				}
-				if err := p.node.DHT().Provide(p.ctx, c, true); err == nil {
+				if err := p.provideFn(c); err == nil {
 					registered = true
-					log.Printf("种子节点已注册服务到 DHT: %s (PeerID: %s)", p.namespace, p.node.PeerID())
+					p.mu.Lock()
+					p.registered = true
+					p.mu.Unlock()
+					log.Printf("已在后台注册服务到 DHT: %s (PeerID: %v)", p.namespace, p.node.PeerIDs())
 				}
 			}
 		}
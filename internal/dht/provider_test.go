@@ -0,0 +1,95 @@
+package dht
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// newTestProvider 创建 Provider，通告由 fail 次失败后成功的桩函数代替
+func newTestProvider(t *testing.T, cfg *Config, fail int32) (*Provider, *atomic.Int32) {
+	t.Helper()
+	node, err := NewNode(cfg)
+	if err != nil {
+		t.Fatalf("NewNode failed: %v", err)
+	}
+	p := NewProvider(node, "exit")
+	t.Cleanup(p.Unregister)
+
+	var calls atomic.Int32
+	p.provideFn = func(cid.Cid) error {
+		if calls.Add(1) <= fail {
+			return errors.New("routing table not ready")
+		}
+		return nil
+	}
+	p.routingTableSize = func() int { return 1 }
+	return p, &calls
+}
+
+func TestNewProvider_RegisterBackoffConfig(t *testing.T) {
+	p, _ := newTestProvider(t, &Config{}, 0)
+	if p.minBackoff != DefaultRegisterMinBackoff || p.maxBackoff != DefaultRegisterMaxBackoff || p.maxRetries != DefaultRegisterMaxRetries {
+		t.Errorf("defaults = (%v, %v, %d), want (%v, %v, %d)",
+			p.minBackoff, p.maxBackoff, p.maxRetries,
+			DefaultRegisterMinBackoff, DefaultRegisterMaxBackoff, DefaultRegisterMaxRetries)
+	}
+
+	p, _ = newTestProvider(t, &Config{
+		RegisterMinBackoff: time.Second,
+		RegisterMaxBackoff: time.Minute,
+		RegisterMaxRetries: 12,
+	}, 0)
+	if p.minBackoff != time.Second || p.maxBackoff != time.Minute || p.maxRetries != 12 {
+		t.Errorf("configured = (%v, %v, %d), want (1s, 1m0s, 12)", p.minBackoff, p.maxBackoff, p.maxRetries)
+	}
+}
+
+func TestProvider_RegisterSucceedsAfterMoreThanDefaultRetries(t *testing.T) {
+	fail := int32(DefaultRegisterMaxRetries + 2)
+	p, calls := newTestProvider(t, &Config{
+		RegisterMinBackoff: time.Millisecond,
+		RegisterMaxBackoff: 5 * time.Millisecond,
+		RegisterMaxRetries: DefaultRegisterMaxRetries + 5,
+	}, fail)
+
+	if err := p.Register(&ServiceInfo{ServiceType: "exit"}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if got := calls.Load(); got != fail+1 {
+		t.Errorf("provide calls = %d, want %d", got, fail+1)
+	}
+	if !p.IsRegistered() {
+		t.Error("provider should be registered")
+	}
+}
+
+func TestProvider_RetriesInBackgroundAfterExhaustion(t *testing.T) {
+	p, calls := newTestProvider(t, &Config{
+		RegisterMinBackoff: time.Millisecond,
+		RegisterMaxBackoff: time.Millisecond,
+		RegisterMaxRetries: 2,
+	}, 4)
+	p.retryInterval = 5 * time.Millisecond
+
+	if err := p.Register(&ServiceInfo{ServiceType: "exit"}); err == nil {
+		t.Fatal("Register should report exhausted retries")
+	}
+	if p.IsRegistered() {
+		t.Fatal("provider should not be registered yet")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !p.IsRegistered() {
+		if time.Now().After(deadline) {
+			t.Fatalf("provider not registered in background after %d attempts", calls.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := calls.Load(); got != 5 {
+		t.Errorf("provide calls = %d, want 5", got)
+	}
+}
@@ -0,0 +1,115 @@
+package dht
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	kb "github.com/libp2p/go-libp2p-kbucket"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// DefaultRoutingTableSample 路由表报告中默认列出的节点数
+const DefaultRoutingTableSample = 10
+
+// BucketStat 单个 K 桶的节点数 (CPL 为与本节点 ID 的公共前缀长度)
+type BucketStat struct {
+	CPL   int
+	Peers int
+}
+
+// RoutingPeer 路由表中的节点样本
+type RoutingPeer struct {
+	ID           peer.ID
+	CPL          int
+	Connected    bool
+	Addrs        []multiaddr.Multiaddr
+	AddedAt      time.Time
+	LastUsefulAt time.Time
+}
+
+// RoutingTableReport 主身份 DHT 路由表的只读快照，用于排查发现问题
+type RoutingTableReport struct {
+	PeerID    peer.ID
+	Size      int
+	Connected int           // Host 当前连接的节点数 (含不在路由表中的节点)
+	Buckets   []BucketStat  // 按 CPL 升序，只包含非空的桶
+	Peers     []RoutingPeer // 最多 sample 个，最近加入的在前
+}
+
+// RoutingTableReport 返回路由表快照，最多列出 sample 个节点 (sample <= 0 时使用默认值)
+// 节点未启动或已停止时返回 nil
+func (n *Node) RoutingTableReport(sample int) *RoutingTableReport {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if !n.started {
+		return nil
+	}
+	if sample <= 0 {
+		sample = DefaultRoutingTableSample
+	}
+
+	self := kb.ConvertPeerID(n.identity.PeerID)
+	infos := n.dht.RoutingTable().GetPeerInfos()
+	report := &RoutingTableReport{
+		PeerID:    n.identity.PeerID,
+		Size:      len(infos),
+		Connected: len(n.host.Network().Peers()),
+	}
+
+	buckets := make(map[int]int)
+	peers := make([]RoutingPeer, 0, len(infos))
+	for _, info := range infos {
+		cpl := kb.CommonPrefixLen(self, kb.ConvertPeerID(info.Id))
+		buckets[cpl]++
+		peers = append(peers, RoutingPeer{
+			ID:           info.Id,
+			CPL:          cpl,
+			AddedAt:      info.AddedAt,
+			LastUsefulAt: info.LastUsefulAt,
+		})
+	}
+	for cpl, count := range buckets {
+		report.Buckets = append(report.Buckets, BucketStat{CPL: cpl, Peers: count})
+	}
+	sort.Slice(report.Buckets, func(i, j int) bool { return report.Buckets[i].CPL < report.Buckets[j].CPL })
+
+	sort.Slice(peers, func(i, j int) bool { return peers[i].AddedAt.After(peers[j].AddedAt) })
+	if len(peers) > sample {
+		peers = peers[:sample]
+	}
+	for i := range peers {
+		peers[i].Connected = n.host.Network().Connectedness(peers[i].ID) == network.Connected
+		peers[i].Addrs = n.host.Peerstore().Addrs(peers[i].ID)
+	}
+	report.Peers = peers
+	return report
+}
+
+// Print 以文本输出路由表报告
+func (r *RoutingTableReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "PeerID: %s\n", r.PeerID)
+	fmt.Fprintf(w, "路由表大小: %d (已连接节点: %d)\n", r.Size, r.Connected)
+	if r.Size == 0 {
+		return
+	}
+
+	fmt.Fprint(w, "K 桶分布:")
+	for _, b := range r.Buckets {
+		fmt.Fprintf(w, " cpl%d=%d", b.CPL, b.Peers)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "节点样本 (%d/%d):\n", len(r.Peers), r.Size)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PEER ID\tCPL\tCONNECTED\tADDED\tADDRS")
+	for _, p := range r.Peers {
+		fmt.Fprintf(tw, "%s\t%d\t%t\t%s ago\t%v\n", p.ID, p.CPL, p.Connected, time.Since(p.AddedAt).Round(time.Second), p.Addrs)
+	}
+	tw.Flush()
+}
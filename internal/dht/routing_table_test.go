@@ -0,0 +1,55 @@
+package dht
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestNode_RoutingTableReport(t *testing.T) {
+	seed := startTestNode(t, &Config{Mode: "server"}, nil)
+	seedInfo := []peer.AddrInfo{{ID: seed.PeerID(), Addrs: seed.Addrs()}}
+	node := startTestNode(t, &Config{Mode: "server"}, seedInfo)
+
+	report := node.RoutingTableReport(0)
+	if report == nil {
+		t.Fatal("RoutingTableReport returned nil for started node")
+	}
+	if report.PeerID != node.PeerID() || report.Size == 0 || report.Connected == 0 {
+		t.Fatalf("report = %+v, want non-empty table for %s", report, node.PeerID())
+	}
+
+	bucketTotal := 0
+	for _, b := range report.Buckets {
+		bucketTotal += b.Peers
+	}
+	if bucketTotal != report.Size {
+		t.Errorf("bucket total = %d, want %d", bucketTotal, report.Size)
+	}
+
+	var sampled bool
+	for _, p := range report.Peers {
+		if p.ID == seed.PeerID() {
+			sampled = true
+			if !p.Connected || len(p.Addrs) == 0 {
+				t.Errorf("seed sample = %+v, want connected with addrs", p)
+			}
+		}
+	}
+	if !sampled {
+		t.Errorf("seed %s not in sample %+v", seed.PeerID(), report.Peers)
+	}
+
+	var buf bytes.Buffer
+	report.Print(&buf)
+	if out := buf.String(); !strings.Contains(out, seed.PeerID().String()) || !strings.Contains(out, "K 桶分布") {
+		t.Errorf("Print output missing peers or buckets:\n%s", out)
+	}
+
+	node.Stop()
+	if node.RoutingTableReport(0) != nil {
+		t.Error("stopped node should not report a routing table")
+	}
+}
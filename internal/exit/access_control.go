@@ -0,0 +1,83 @@
+package exit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/pkg/openai"
+)
+
+// ErrAccessDenied 请求路径或模型不在 Exit 的访问控制允许列表内
+var ErrAccessDenied = errors.New("请求被访问控制拒绝")
+
+// errModelNotAllowed 请求的 model 不在 Exit 允许的模型内
+var errModelNotAllowed = errors.New("model not allowed")
+
+// accessControl Exit 级别的请求允许列表 (解密后、转发前检查)，对所有后端生效
+type accessControl struct {
+	paths  []string // 允许的路径前缀，为空表示不限制
+	models []string // 允许的模型名模式，为空表示不限制
+}
+
+// SetAccessControl 设置 Exit 的访问控制: 只转发路径匹配 AllowedPaths 前缀、model 匹配 AllowedModels 的请求，
+// 其余请求返回 403 且不转发；字段为空表示该项不限制 (默认全部允许)
+func (h *OHTTPHandler) SetAccessControl(acl config.AccessControl) error {
+	for _, m := range acl.AllowedModels {
+		if m == "" {
+			return fmt.Errorf("模型模式不能为空")
+		}
+		if _, err := path.Match(m, ""); err != nil {
+			return fmt.Errorf("无效的模型模式 %q: %w", m, err)
+		}
+	}
+	h.access = accessControl{paths: acl.AllowedPaths, models: acl.AllowedModels}
+	return nil
+}
+
+// check 检查请求是否允许转发，需要检查 model 时读取请求体后还原 (分块上传的请求体只读取前缀)
+// 不带请求体的请求 (如 GET /v1/models) 只按路径检查；配置了 allowed_models 时，带请求体却找不到 model 的请求被拒绝
+func (a accessControl) check(req *http.Request) error {
+	if len(a.paths) > 0 {
+		if err := checkPath(req.URL, a.paths); err != nil {
+			return fmt.Errorf("%w: %w", ErrAccessDenied, err)
+		}
+	}
+	if len(a.models) == 0 {
+		return nil
+	}
+
+	model, hasBody, err := requestModel(req)
+	if err != nil {
+		return err
+	}
+	if model == "" {
+		if !hasBody {
+			return nil
+		}
+		return fmt.Errorf("%w: %w: 请求未指定 model", ErrAccessDenied, errModelNotAllowed)
+	}
+	for _, p := range a.models {
+		if matchModel(p, model) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %w: %s", ErrAccessDenied, errModelNotAllowed, model)
+}
+
+// accessDeniedResponse 访问控制拒绝请求时返回给 Client 的 403 错误 (不转发到后端)
+func accessDeniedResponse(err error) *http.Response {
+	if errors.Is(err, errModelNotAllowed) {
+		return newErrorResponse(http.StatusForbidden, openai.ErrorDetail{
+			Message: "The requested model is not served by this exit",
+			Type:    "invalid_request_error",
+			Code:    "model_not_allowed",
+		})
+	}
+	if errors.Is(err, errInvalidPath) {
+		return pathErrorResponse(errInvalidPath)
+	}
+	return pathErrorResponse(errPathNotAllowed)
+}
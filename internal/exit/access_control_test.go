@@ -0,0 +1,263 @@
+package exit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+func TestOHTTPHandler_AccessControl(t *testing.T) {
+	var calls atomic.Int32
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"ok"}`))
+	})
+	if err := handler.SetAccessControl(config.AccessControl{
+		AllowedPaths:  []string{"/v1/chat/completions"},
+		AllowedModels: []string{"gpt-4o", "llama3*"},
+	}); err != nil {
+		t.Fatalf("SetAccessControl: %v", err)
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		calls.Store(0)
+		ohttpReq, clientCtx := encryptRequest(t, ohttpClient, http.MethodPost, "/v1/chat/completions", []byte(`{"model":"llama3:8b","messages":[]}`))
+		ohttpResp, err := handler.ProcessRequest(ohttpReq)
+		if err != nil {
+			t.Fatalf("ProcessRequest: %v", err)
+		}
+		resp, err := clientCtx.DecapsulateResponse(ohttpResp)
+		if err != nil {
+			t.Fatalf("DecapsulateResponse: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != `{"id":"ok"}` {
+			t.Errorf("response = %d %s, want the backend response", resp.StatusCode, body)
+		}
+		if calls.Load() != 1 {
+			t.Errorf("backend calls = %d, want 1", calls.Load())
+		}
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		wantCode string
+	}{
+		{"denied model", "/v1/chat/completions", `{"model":"gpt-3.5-turbo","messages":[]}`, "model_not_allowed"},
+		{"missing model", "/v1/chat/completions", `{"messages":[]}`, "model_not_allowed"},
+		{"non-JSON body", "/v1/chat/completions", `model=gpt-4o`, "model_not_allowed"},
+		{"denied path", "/v1/fine_tunes", `{"model":"gpt-4o"}`, "path_not_allowed"},
+		{"path prefix is segment based", "/v1/chat/completionsx", `{"model":"gpt-4o"}`, "path_not_allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			ohttpReq, clientCtx := encryptRequest(t, ohttpClient, http.MethodPost, tt.path, []byte(tt.body))
+			ohttpResp, err := handler.ProcessRequest(ohttpReq)
+			if err != nil {
+				t.Fatalf("ProcessRequest: %v", err)
+			}
+			// 拒绝响应同样加密，只有 Client 能读取
+			status, code := decryptErrorCode(t, clientCtx, ohttpResp)
+			if status != http.StatusForbidden || code != tt.wantCode {
+				t.Errorf("response = %d %q, want 403 %q", status, code, tt.wantCode)
+			}
+			if calls.Load() != 0 {
+				t.Error("denied request was forwarded to the backend")
+			}
+		})
+	}
+
+	t.Run("stream denied", func(t *testing.T) {
+		calls.Store(0)
+		// 旧 Client 不处理 StreamHead，只能收到协议错误
+		ohttpReq, _ := encryptRequest(t, ohttpClient, http.MethodPost, "/v1/chat/completions", []byte(`{"model":"gpt-3.5-turbo","stream":true}`))
+		if _, err := handler.prepareStream(ohttpReq, nil); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("prepareStream err = %v, want ErrAccessDenied", err)
+		}
+		if calls.Load() != 0 {
+			t.Error("denied stream request was forwarded to the backend")
+		}
+	})
+
+	t.Run("stream denied with head", func(t *testing.T) {
+		calls.Store(0)
+		req, _ := http.NewRequest(http.MethodPost, "http://ai-backend/v1/chat/completions", strings.NewReader(`{"model":"gpt-3.5-turbo","stream":true}`))
+		req.Header.Set(protocol.StreamHeadHeader, "1")
+		ohttpReq, clientCtx, err := ohttpClient.EncapsulateRequest(req)
+		if err != nil {
+			t.Fatalf("EncapsulateRequest: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := handler.ProcessStreamRequest(ohttpReq, &buf); err != nil {
+			t.Fatalf("ProcessStreamRequest: %v", err)
+		}
+		if calls.Load() != 0 {
+			t.Error("denied stream request was forwarded to the backend")
+		}
+
+		// 403 随加密的 StreamHead 返回，错误体在其后的数据块中
+		decryptor, _ := clientCtx.NewStreamDecryptor()
+		reader := bytes.NewReader(buf.Bytes())
+		head, err := protocol.Decode(reader)
+		if err != nil || head.Type != protocol.MessageTypeStreamHead {
+			t.Fatalf("first message = %v, %v; want StreamHead", head, err)
+		}
+		block, _ := decryptor.DecryptChunk(head.Payload)
+		if !strings.Contains(string(block), protocol.StreamStatusHeader+": 403") {
+			t.Errorf("StreamHead = %q, want status 403", block)
+		}
+		chunk, err := protocol.Decode(reader)
+		if err != nil || chunk.Type != protocol.MessageTypeStreamChunk {
+			t.Fatalf("second message = %v, %v; want StreamChunk", chunk, err)
+		}
+		body, _ := decryptor.DecryptChunk(chunk.Payload)
+		if !strings.Contains(string(body), "model_not_allowed") {
+			t.Errorf("body = %s, want model_not_allowed", body)
+		}
+	})
+}
+
+func TestOHTTPHandler_AccessControlMultipartModel(t *testing.T) {
+	var calls atomic.Int32
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"text":"ok"}`))
+	})
+	if err := handler.SetAccessControl(config.AccessControl{AllowedModels: []string{"whisper-1"}}); err != nil {
+		t.Fatalf("SetAccessControl: %v", err)
+	}
+
+	tests := []struct {
+		model      string
+		wantStatus int
+	}{
+		{"whisper-1", http.StatusOK},
+		{"whisper-large", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		calls.Store(0)
+		body, contentType := multipartBody(t, tt.model, []byte("audio"))
+		req, _ := http.NewRequest(http.MethodPost, "http://ai-backend/v1/audio/transcriptions", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		ohttpReq, clientCtx, err := ohttpClient.EncapsulateRequest(req)
+		if err != nil {
+			t.Fatalf("EncapsulateRequest: %v", err)
+		}
+		ohttpResp, err := handler.ProcessRequest(ohttpReq)
+		if err != nil {
+			t.Fatalf("ProcessRequest: %v", err)
+		}
+		status, _ := decryptErrorCode(t, clientCtx, ohttpResp)
+		if status != tt.wantStatus {
+			t.Errorf("model %q: status = %d, want %d", tt.model, status, tt.wantStatus)
+		}
+		if forwarded := calls.Load() == 1; forwarded != (tt.wantStatus == http.StatusOK) {
+			t.Errorf("model %q: forwarded = %v", tt.model, forwarded)
+		}
+	}
+}
+
+func TestAccessControl_ChunkedUploadStaysStreamed(t *testing.T) {
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {})
+	acl := accessControl{models: []string{"whisper-1"}}
+
+	// model 字段在前，文件远大于检查 model 时读取的前缀
+	audio := bytes.Repeat([]byte("a"), 3*modelPeekSize)
+	body, contentType := multipartBody(t, "whisper-1", audio)
+	var chunks [][]byte
+	for rest := body; len(rest) > 0; {
+		n := min(len(rest), 16<<10)
+		chunks, rest = append(chunks, rest[:n]), rest[n:]
+	}
+	ohttpReq, upload := encryptChunkedRequest(t, ohttpClient, "/v1/audio/transcriptions", int64(len(body)), chunks, true)
+
+	req, serverCtx, err := handler.ohttpServer.DecapsulateRequest(ohttpReq)
+	if err != nil {
+		t.Fatalf("DecapsulateRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if err := attachUploadBody(req, serverCtx, upload); err != nil {
+		t.Fatalf("attachUploadBody: %v", err)
+	}
+
+	if err := acl.check(req); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	upBody, ok := req.Body.(*uploadBody)
+	if !ok {
+		t.Fatalf("body = %T, want *uploadBody kept for streaming", req.Body)
+	}
+	if upBody.read > modelPeekSize+16<<10 {
+		t.Errorf("check decrypted %d bytes, want at most the peeked prefix", upBody.read)
+	}
+	got, err := io.ReadAll(req.Body)
+	if err != nil || !bytes.Equal(got, body) {
+		t.Errorf("body after check: %d bytes, %v; want the original %d bytes", len(got), err, len(body))
+	}
+
+	// 前缀之内找不到 model: 拒绝
+	body, contentType = multipartBody(t, "", audio)
+	ohttpReq, upload = encryptChunkedRequest(t, ohttpClient, "/v1/audio/transcriptions", int64(len(body)), [][]byte{body}, true)
+	req, serverCtx, _ = handler.ohttpServer.DecapsulateRequest(ohttpReq)
+	req.Header.Set("Content-Type", contentType)
+	attachUploadBody(req, serverCtx, upload)
+	if err := acl.check(req); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("check without model: err = %v, want ErrAccessDenied", err)
+	}
+}
+
+// multipartBody 构造音频转写的 multipart 表单: model 非空时作为第一个字段，其后为文件
+func multipartBody(t *testing.T, model string, file []byte) ([]byte, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if model != "" {
+		w.WriteField("model", model)
+	}
+	fw, err := w.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	fw.Write(file)
+	w.Close()
+	return buf.Bytes(), w.FormDataContentType()
+}
+
+func TestOHTTPHandler_AccessControlAllowsAllByDefault(t *testing.T) {
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	ohttpReq, clientCtx := encryptRequest(t, ohttpClient, http.MethodPost, "/v1/fine_tunes", []byte(`{"model":"any"}`))
+	ohttpResp, err := handler.ProcessRequest(ohttpReq)
+	if err != nil {
+		t.Fatalf("ProcessRequest: %v", err)
+	}
+	resp, err := clientCtx.DecapsulateResponse(ohttpResp)
+	if err != nil {
+		t.Fatalf("DecapsulateResponse: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200 with no access control configured", resp.StatusCode)
+	}
+}
+
+func TestOHTTPHandler_SetAccessControlInvalidPattern(t *testing.T) {
+	handler, _, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {})
+	if err := handler.SetAccessControl(config.AccessControl{AllowedModels: []string{"gpt-["}}); err == nil {
+		t.Error("SetAccessControl accepted an invalid model pattern")
+	}
+}
@@ -2,28 +2,122 @@ package exit
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/pkg/openai"
+)
+
+// 健康检查默认值
+const (
+	defaultHealthPath   = "/v1/models"
+	defaultHealthMethod = http.MethodGet
+	defaultHealthStatus = http.StatusOK
+	healthCheckTimeout  = 5 * time.Second
+
+	// defaultHealthInterval 多实例时后台探测的默认间隔
+	defaultHealthInterval = 10 * time.Second
+)
+
+// 限流重试默认值
+const (
+	defaultRateLimitMaxWait = 10 * time.Second
+	// defaultRateLimitWait 429 响应缺少 Retry-After 时的等待时间
+	defaultRateLimitWait = time.Second
+)
+
+// 瞬时错误重试默认值
+const (
+	defaultBackendRetryBaseDelay = 200 * time.Millisecond
+	defaultBackendRetryMaxDelay  = 5 * time.Second
 )
 
+// defaultRetryStatuses 默认按瞬时错误重试的后端状态码
+var defaultRetryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
 // AIClient AI 后端客户端
+// 可配置同一服务的多个后端实例: 按顺序优先使用健康的实例，连接失败时切换到下一个
 type AIClient struct {
-	baseURL      string
+	baseURL      string     // 首选后端地址
+	backends     []*backend // 故障转移池 (首选在前)
 	apiKey       string
 	headers      map[string]string
 	httpClient   *http.Client
 	streamClient *http.Client // 无全局 Timeout，用于 SSE 流式响应
+	healthCheck  config.HealthCheck
+	transformers []RequestTransformer
+	normalizer   *ResponseNormalizer // 响应归一化，nil 表示不改写响应
+	requestID    config.RequestID
+	rateLimit    config.RateLimitRetry // 429 重试策略，MaxAttempts <= 1 时不重试
+	retry        config.BackendRetry   // 瞬时错误的指数退避重试，MaxRetries <= 0 时不重试
+	allowedPaths []string              // 允许转发的路径前缀，为空表示不限制 (路径穿越始终拒绝)
+	accessLog    bool                  // 每个请求记录一行访问日志，含后端返回的响应 ID
+	scheduler    *fairScheduler        // 后端并发上限与按模型公平排队，nil 表示不限制
+	queueTimeout time.Duration         // 排队等待并发配额的上限，0 表示不限制
+
+	ctx      context.Context // 所有后端请求共享的上下文，Shutdown 超过宽限期后取消
+	cancel   context.CancelFunc
+	mu       sync.Mutex
+	closing  bool           // Shutdown 开始后不再接受新请求 (受 mu 保护)
+	inflight sync.WaitGroup // 进行中的后端请求 (响应体关闭前)
+}
+
+// ErrAIClientClosed Exit 正在关闭，不再向后端转发新请求
+var ErrAIClientClosed = errors.New("AI 后端客户端已关闭")
+
+// backend 故障转移池中的一个后端实例
+type backend struct {
+	url     string
+	healthy atomic.Bool
+}
+
+// BackendStatus 后端实例的健康状态
+type BackendStatus struct {
+	URL     string
+	Healthy bool
 }
 
 // NewAIClient 创建 AI 客户端
 func NewAIClient(baseURL, apiKey string, headers map[string]string) *AIClient {
+	return NewAIClientWithBackends([]string{baseURL}, apiKey, headers)
+}
+
+// NewAIClientWithBackends 创建带故障转移的 AI 客户端，baseURLs 为同一服务的多个实例 (首个优先)
+func NewAIClientWithBackends(baseURLs []string, apiKey string, headers map[string]string) *AIClient {
+	backends := make([]*backend, 0, len(baseURLs))
+	for _, u := range baseURLs {
+		b := &backend{url: u}
+		b.healthy.Store(true) // 探测前视为健康
+		backends = append(backends, b)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &AIClient{
-		baseURL: baseURL,
-		apiKey:  apiKey,
-		headers: headers,
+		ctx:      ctx,
+		cancel:   cancel,
+		baseURL:  baseURLs[0],
+		backends: backends,
+		apiKey:   apiKey,
+		headers:  headers,
 		httpClient: &http.Client{
 			Timeout: 120 * time.Second, // AI 响应可能较慢
 			Transport: &http.Transport{
@@ -38,33 +132,559 @@ func NewAIClient(baseURL, apiKey string, headers map[string]string) *AIClient {
 				ResponseHeaderTimeout: 30 * time.Second,
 			},
 		},
+		healthCheck: config.HealthCheck{
+			Path:           defaultHealthPath,
+			Method:         defaultHealthMethod,
+			ExpectedStatus: defaultHealthStatus,
+		},
+	}
+}
+
+// SetHealthCheck 设置健康检查配置，未填写的字段使用默认值 (GET /v1/models → 200)
+func (c *AIClient) SetHealthCheck(hc config.HealthCheck) {
+	if hc.Path == "" {
+		hc.Path = defaultHealthPath
+	}
+	if hc.Method == "" {
+		hc.Method = defaultHealthMethod
+	}
+	if hc.ExpectedStatus == 0 {
+		hc.ExpectedStatus = defaultHealthStatus
+	}
+	c.healthCheck = hc
+}
+
+// SetRequestID 设置请求 ID 转发与生成策略
+func (c *AIClient) SetRequestID(cfg config.RequestID) {
+	cfg.Header = http.CanonicalHeaderKey(cfg.Header)
+	c.requestID = cfg
+}
+
+// applyRequestID 确保转发请求携带请求 ID，返回实际使用的 ID (未配置或未提供时为空)
+func (c *AIClient) applyRequestID(req *http.Request) string {
+	if c.requestID.Header == "" {
+		return ""
+	}
+	id := req.Header.Get(c.requestID.Header)
+	if id == "" && c.requestID.Generate {
+		id = generateRequestID()
+		req.Header.Set(c.requestID.Header, id)
+	}
+	return id
+}
+
+// SetRateLimitRetry 设置后端 429 响应的重试策略，MaxWait 未填写时默认 10s
+func (c *AIClient) SetRateLimitRetry(cfg config.RateLimitRetry) {
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = defaultRateLimitMaxWait
+	}
+	c.rateLimit = cfg
+}
+
+// rateLimitWait 判断 429 响应是否应在 Exit 内重试，返回等待时间
+// attempt 为已完成的尝试次数；次数用尽或 Retry-After 超过等待上限时返回 false
+func (c *AIClient) rateLimitWait(resp *http.Response, attempt int) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests || attempt >= c.rateLimit.MaxAttempts {
+		return 0, false
+	}
+	wait := defaultRateLimitWait
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		d, ok := parseRetryAfter(v, time.Now())
+		if !ok {
+			return 0, false
+		}
+		wait = d
+	}
+	if wait > c.rateLimit.MaxWait {
+		return 0, false
+	}
+	return wait, true
+}
+
+// SetBackendRetry 设置瞬时错误 (连接失败/重置、可重试状态码) 的指数退避重试，未填写的字段使用默认值
+func (c *AIClient) SetBackendRetry(cfg config.BackendRetry) {
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = defaultBackendRetryBaseDelay
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = defaultBackendRetryMaxDelay
+	}
+	if len(cfg.Statuses) == 0 {
+		cfg.Statuses = defaultRetryStatuses
+	}
+	c.retry = cfg
+}
+
+// retryWait 判断请求结果是否为可重试的瞬时错误，返回等待时间
+// attempt 为已完成的尝试次数；第 n 次重试前等待 BaseDelay*2^(n-1) (不超过 MaxDelay)，响应带 Retry-After 时按其等待
+func (c *AIClient) retryWait(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt > c.retry.MaxRetries {
+		return 0, false
+	}
+	backoff := c.retry.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		if d := c.retry.BaseDelay << shift; d > 0 && d < backoff {
+			backoff = d
+		}
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, false
+		}
+		return backoff, true
+	}
+	if !slices.Contains(c.retry.Statuses, resp.StatusCode) {
+		return 0, false
+	}
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		d, ok := parseRetryAfter(v, time.Now())
+		if !ok || d > c.retry.MaxDelay {
+			return 0, false
+		}
+		return d, true
+	}
+	return backoff, true
+}
+
+// parseRetryAfter 解析 Retry-After (秒数或 HTTP 日期)
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if secs, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// SetAllowedPaths 设置允许转发到后端的路径前缀 (按路径段匹配)，为空表示不限制
+func (c *AIClient) SetAllowedPaths(prefixes []string) {
+	c.allowedPaths = prefixes
+}
+
+// SetConcurrency 设置同时转发到后端的请求上限 (<=0 表示不限制)，达到上限时按模型权重公平排队
+func (c *AIClient) SetConcurrency(max int, modelWeights map[string]int) {
+	if max <= 0 {
+		c.scheduler = nil
+		return
+	}
+	c.scheduler = newFairScheduler(max, modelWeights)
+	c.scheduler.queueTimeout = c.queueTimeout
+}
+
+// SetQueueTimeout 设置请求排队等待后端并发配额的上限 (0 表示不限制)，超时的请求以 ErrQueueTimeout 拒绝
+func (c *AIClient) SetQueueTimeout(d time.Duration) {
+	c.queueTimeout = d
+	if c.scheduler != nil {
+		c.scheduler.queueTimeout = d
+	}
+}
+
+// SetAccessLog 开启或关闭访问日志
+func (c *AIClient) SetAccessLog(enabled bool) {
+	c.accessLog = enabled
+}
+
+// generateRequestID 生成随机请求 ID
+func generateRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "req-" + hex.EncodeToString(b)
+}
+
+// AddTransformer 添加请求改写钩子 (按添加顺序执行)
+func (c *AIClient) AddTransformer(t RequestTransformer) {
+	c.transformers = append(c.transformers, t)
+}
+
+// SetResponseNormalizer 设置响应归一化器 (nil 表示不改写响应)
+func (c *AIClient) SetResponseNormalizer(n *ResponseNormalizer) {
+	c.normalizer = n
+}
+
+// normalizeResponse 按后端配置归一化响应，未配置时不做任何处理
+func (c *AIClient) normalizeResponse(resp *http.Response) error {
+	if c.normalizer == nil {
+		return nil
+	}
+	return c.normalizer.NormalizeResponse(resp)
+}
+
+// CheckHealth 探测所有后端实例的健康端点并更新其状态，任一实例健康即返回 nil
+// 状态码与期望值不符或不可达时视为不健康
+func (c *AIClient) CheckHealth(ctx context.Context) error {
+	if c.healthCheck.Disabled {
+		return nil
+	}
+
+	var errs []error
+	for _, b := range c.backends {
+		err := c.probe(ctx, b.url)
+		c.setHealthy(b, err)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// probe 探测单个后端实例的健康端点
+func (c *AIClient) probe(ctx context.Context, baseURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, c.healthCheck.Method, baseURL+c.healthCheck.Path, nil)
+	if err != nil {
+		return fmt.Errorf("创建健康检查请求失败: %w", err)
+	}
+	c.injectAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("AI 后端不可达: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != c.healthCheck.ExpectedStatus {
+		return fmt.Errorf("AI 后端健康检查失败: %s %s 返回 %d, 期望 %d",
+			c.healthCheck.Method, c.healthCheck.Path, resp.StatusCode, c.healthCheck.ExpectedStatus)
+	}
+	return nil
+}
+
+// setHealthy 按探测或转发结果更新实例状态，状态变化时记录日志 (单实例时无需记录)
+func (c *AIClient) setHealthy(b *backend, err error) {
+	healthy := err == nil
+	if b.healthy.Swap(healthy) == healthy || len(c.backends) == 1 {
+		return
+	}
+	if healthy {
+		log.Printf("AI 后端 %s 已恢复", b.url)
+	} else {
+		log.Printf("AI 后端 %s 不可用: %v", b.url, err)
+	}
+}
+
+// StartHealthProbe 在后台按 health_check.interval 定期探测所有实例，ctx 取消时停止
+// 只有一个实例或禁用健康检查时不探测 (无可切换的实例)
+func (c *AIClient) StartHealthProbe(ctx context.Context) {
+	if c.healthCheck.Disabled || len(c.backends) < 2 {
+		return
+	}
+	interval := c.healthCheck.Interval
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, b := range c.backends {
+					c.setHealthy(b, c.probe(ctx, b.url))
+				}
+			}
+		}
+	}()
+}
+
+// BackendHealth 返回各后端实例当前的健康状态 (按配置顺序)
+func (c *AIClient) BackendHealth() []BackendStatus {
+	statuses := make([]BackendStatus, 0, len(c.backends))
+	for _, b := range c.backends {
+		statuses = append(statuses, BackendStatus{URL: b.url, Healthy: b.healthy.Load()})
+	}
+	return statuses
+}
+
+// candidates 返回转发时依次尝试的实例: 健康的在前，不健康的在后 (状态可能已过时，全部不健康时仍会尝试)
+func (c *AIClient) candidates() []*backend {
+	if len(c.backends) == 1 {
+		return c.backends
+	}
+	ordered := make([]*backend, 0, len(c.backends))
+	var down []*backend
+	for _, b := range c.backends {
+		if b.healthy.Load() {
+			ordered = append(ordered, b)
+		} else {
+			down = append(down, b)
+		}
+	}
+	return append(ordered, down...)
+}
+
+// isDialError 判断错误是否为建立连接失败 (请求尚未发出，可安全地换实例重试)
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// injectAuth 注入认证 headers
+// 优先级: 配置 headers > api_key
+func (c *AIClient) injectAuth(req *http.Request) {
+	if len(c.headers) > 0 {
+		for key, value := range c.headers {
+			req.Header.Set(key, value)
+		}
+	} else if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	}
 }
 
 // buildRequest 构建并发送请求到 AI 后端 (消除 Forward/ForwardStream 重复)
 func (c *AIClient) buildRequest(req *http.Request, httpClient *http.Client) (*http.Response, error) {
-	// 构建目标 URL
-	targetURL := c.baseURL + req.URL.Path
-	if req.URL.RawQuery != "" {
-		targetURL += "?" + req.URL.RawQuery
+	// 路径来自解密后的客户端请求，拼接到后端地址前先校验，拒绝路径穿越和允许列表外的路径
+	if err := checkPath(req.URL, c.allowedPaths); err != nil {
+		log.Printf("拒绝转发请求 %s %q: %v", req.Method, req.URL.Path, err)
+		return pathErrorResponse(err), nil
+	}
+
+	var bodyReader io.Reader
+	var model string // 公平排队使用的模型，分块上传的请求为空
+	respHeaders := make(map[string]string)
+	if upload, ok := req.Body.(*uploadBody); ok && len(c.transformers) == 0 {
+		// 分块上传的请求体 (音频、文件等大请求) 直接流式转发，不在 Exit 缓存，也不做 model 校验
+		bodyReader = upload
+	} else {
+		// 读取原始请求体
+		var bodyBytes []byte
+		if req.Body != nil {
+			var err error
+			bodyBytes, err = io.ReadAll(req.Body)
+			if err != nil {
+				return nil, fmt.Errorf("读取请求体失败: %w", err)
+			}
+			req.Body.Close()
+		}
+
+		// 校验 model 字段，缺失时直接返回 400，不转发到后端
+		if err := openai.ValidateModel(req.URL.Path, bodyBytes); err != nil {
+			return newErrorResponse(http.StatusBadRequest, openai.ModelRequiredError()), nil
+		}
+		if c.scheduler != nil {
+			model = extractModel(bodyBytes)
+		}
+
+		// 执行请求改写钩子
+		for _, t := range c.transformers {
+			newBody, headers, err := t.Transform(bodyBytes)
+			if err != nil {
+				return nil, fmt.Errorf("改写请求失败: %w", err)
+			}
+			bodyBytes = newBody
+			for k, v := range headers {
+				respHeaders[k] = v
+			}
+		}
+		bodyReader = bytes.NewReader(bodyBytes)
 	}
 
-	// 读取原始请求体
-	var bodyBytes []byte
-	if req.Body != nil {
-		var err error
-		bodyBytes, err = io.ReadAll(req.Body)
+	// 请求 ID 在切换实例前确定，重试时保持不变
+	requestID := c.applyRequestID(req)
+
+	release, err := c.beginRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	// 后端并发达到上限时按模型公平排队，配额随请求结束 (响应体关闭) 归还
+	if c.scheduler != nil {
+		releaseSlot, err := c.scheduler.Acquire(req.Context(), c.ctx, model)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("等待后端并发配额失败: %w", err)
+		}
+		endRequest := release
+		release = sync.OnceFunc(func() {
+			releaseSlot()
+			endRequest()
+		})
+	}
+
+	// 后端返回 429 时按 rate_limit_retry 等待后重试，其余瞬时错误按 backend_retry 指数退避重试
+	// 分块上传的请求体无法重放，不重试
+	_, replayable := bodyReader.(*bytes.Reader)
+	var resp *http.Response
+	var start time.Time
+	for attempt := 1; ; attempt++ {
+		resp, start, err = c.sendToBackends(req, httpClient, bodyReader)
+		if !replayable {
+			break
+		}
+		var wait time.Duration
+		ok := false
+		if err == nil {
+			if wait, ok = c.rateLimitWait(resp, attempt); ok {
+				log.Printf("AI 后端限流 (429)，%v 后重试 (第 %d/%d 次)", wait, attempt+1, c.rateLimit.MaxAttempts)
+			}
+		}
+		if !ok {
+			if wait, ok = c.retryWait(resp, err, attempt); ok {
+				cause := err
+				if cause == nil {
+					cause = fmt.Errorf("状态码 %d", resp.StatusCode)
+				}
+				log.Printf("AI 后端暂时不可用 (%v)，%v 后重试 (%d/%d)", cause, wait, attempt, c.retry.MaxRetries)
+			}
+		}
+		if !ok {
+			break
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleepContext(req.Context(), c.ctx, wait); err != nil {
+			release()
+			return nil, fmt.Errorf("等待重试时取消: %w", err)
+		}
+		bodyReader.(*bytes.Reader).Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	if c.accessLog {
+		backendID := backendResponseID(resp)
+		log.Printf("访问日志: %s %s %d %v request_id=%s backend_id=%s",
+			req.Method, req.URL.Path, resp.StatusCode, time.Since(start).Round(time.Millisecond),
+			orDash(requestID), orDash(backendID))
+	}
+
+	// 回显请求 ID: 优先使用后端返回的 ID
+	if requestID != "" && resp.Header.Get(c.requestID.Header) == "" {
+		resp.Header.Set(c.requestID.Header, requestID)
+	}
+
+	for k, v := range respHeaders {
+		resp.Header.Set(k, v)
+	}
+
+	// 响应体关闭 (流式响应转发完毕) 后请求才算结束
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// sendToBackends 依次尝试各实例发送请求，连接失败时切换到下一个，返回响应及发送时间
+func (c *AIClient) sendToBackends(req *http.Request, httpClient *http.Client, bodyReader io.Reader) (*http.Response, time.Time, error) {
+	var start time.Time
+	candidates := c.candidates()
+	for i, b := range candidates {
+		newReq, err := c.newBackendRequest(req, b.url, bodyReader)
 		if err != nil {
-			return nil, fmt.Errorf("读取请求体失败: %w", err)
+			return nil, start, err
 		}
-		req.Body.Close()
+
+		// 发送请求
+		start = time.Now()
+		resp, err := httpClient.Do(newReq)
+		if err == nil {
+			c.setHealthy(b, nil)
+			return resp, start, nil
+		}
+		if !isDialError(err) || i == len(candidates)-1 {
+			return nil, start, fmt.Errorf("请求 AI 后端失败: %w", err)
+		}
+		c.setHealthy(b, err)
+		log.Printf("AI 后端 %s 连接失败，切换到 %s", b.url, candidates[i+1].url)
+		// 连接阶段失败时请求体尚未读取，缓存的请求体从头重放
+		if r, ok := bodyReader.(*bytes.Reader); ok {
+			r.Seek(0, io.SeekStart)
+		}
+	}
+	return nil, start, errors.New("没有可用的 AI 后端")
+}
+
+// sleepContext 等待 d，任一上下文取消时提前返回其错误
+func sleepContext(ctx, shutdown context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-shutdown.Done():
+		return shutdown.Err()
 	}
+}
+
+// beginRequest 登记一个进行中的后端请求，返回可重复调用的结束函数；Shutdown 开始后返回 ErrAIClientClosed
+func (c *AIClient) beginRequest() (func(), error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing {
+		return nil, ErrAIClientClosed
+	}
+	c.inflight.Add(1)
+	return sync.OnceFunc(c.inflight.Done), nil
+}
 
-	// 创建新请求
-	newReq, err := http.NewRequest(req.Method, targetURL, bytes.NewReader(bodyBytes))
+// Shutdown 停止接受新请求，等待进行中的后端请求完成；超过 grace 时取消剩余请求
+// 返回时剩余请求均已取消 (后端连接关闭，读取响应体返回错误)
+func (c *AIClient) Shutdown(grace time.Duration) {
+	c.mu.Lock()
+	c.closing = true
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		log.Printf("关闭 Exit: 取消 %v 后仍未完成的后端请求", grace)
+	}
+	c.cancel()
+}
+
+// releaseOnClose 响应体关闭时结束请求登记
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// newBackendRequest 构建发往指定实例的请求，复制原请求的 headers 并注入认证
+func (c *AIClient) newBackendRequest(req *http.Request, baseURL string, body io.Reader) (*http.Request, error) {
+	// 构建目标 URL
+	// 使用转义形式拼接，解码后的 ?、# 等字符不会改变目标 URL 的结构
+	targetURL := baseURL + req.URL.EscapedPath()
+	if req.URL.RawQuery != "" {
+		targetURL += "?" + req.URL.RawQuery
+	}
+
+	// 创建新请求 (Exit 关闭时随共享上下文取消)
+	newReq, err := http.NewRequestWithContext(c.ctx, req.Method, targetURL, body)
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
+	if _, ok := body.(*uploadBody); ok {
+		newReq.ContentLength = req.ContentLength // -1 时以 chunked 编码发送
+	}
 
 	// 复制必要的 headers
 	for key, values := range req.Header {
@@ -78,22 +698,8 @@ func (c *AIClient) buildRequest(req *http.Request, httpClient *http.Client) (*ht
 	}
 
 	// 注入认证 headers
-	// 优先级: 配置 headers > api_key
-	if len(c.headers) > 0 {
-		for key, value := range c.headers {
-			newReq.Header.Set(key, value)
-		}
-	} else if c.apiKey != "" {
-		newReq.Header.Set("Authorization", "Bearer "+c.apiKey)
-	}
-
-	// 发送请求
-	resp, err := httpClient.Do(newReq)
-	if err != nil {
-		return nil, fmt.Errorf("请求 AI 后端失败: %w", err)
-	}
-
-	return resp, nil
+	c.injectAuth(newReq)
+	return newReq, nil
 }
 
 // Forward 转发请求到 AI 后端
@@ -106,6 +712,53 @@ func (c *AIClient) ForwardStream(req *http.Request) (*http.Response, error) {
 	return c.buildRequest(req, c.streamClient)
 }
 
+// responseIDPeekSize 访问日志提取后端响应 ID 时最多读取的响应体前缀 (读取后放回，不整体缓存)
+const responseIDPeekSize = 64 << 10
+
+// backendResponseIDHeaders 后端在响应头中返回的请求 ID (OpenAI、Anthropic 等)
+var backendResponseIDHeaders = []string{"X-Request-Id", "Request-Id"}
+
+// backendResponseID 提取后端的响应 ID，用于关联网关日志与后端服务商日志
+// 非流式 JSON 响应优先取 body 的 id 字段 (如 chatcmpl-xxx)，读取后 body 会被替换为等价副本；
+// 流式响应不读取 body，只取响应头
+func backendResponseID(resp *http.Response) string {
+	if !IsSSEResponse(resp) && resp.Body != nil {
+		body := resp.Body
+		prefix, err := io.ReadAll(io.LimitReader(body, responseIDPeekSize))
+		rest := io.Reader(body)
+		if err != nil {
+			// 读取中途失败: 保留已读部分，原样把错误交给下游
+			rest = errReader{err}
+		}
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(prefix), rest), body}
+		if id, ok := scanField(prefix, "id"); err == nil && ok && id != "" {
+			return id
+		}
+	}
+	for _, h := range backendResponseIDHeaders {
+		if id := resp.Header.Get(h); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// errReader 总是返回指定错误的 Reader
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// orDash 空字符串记为 "-"
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
 // IsSSEResponse 检查响应是否为 SSE 流
 func IsSSEResponse(resp *http.Response) bool {
 	ct := resp.Header.Get("Content-Type")
@@ -128,3 +781,20 @@ var hopByHopHeaders = map[string]bool{
 func isHopByHopHeader(header string) bool {
 	return hopByHopHeaders[header]
 }
+
+// newErrorResponse 构造 OpenAI 风格的错误响应 (不经过 AI 后端)
+func newErrorResponse(status int, detail openai.ErrorDetail) *http.Response {
+	body, _ := json.Marshal(openai.ErrorResponse{Error: detail})
+	resp := &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	return resp
+}
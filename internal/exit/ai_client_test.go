@@ -2,11 +2,20 @@ package exit
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/config"
 )
 
 func newTestAIClient(t *testing.T, handler http.HandlerFunc) (*AIClient, *httptest.Server) {
@@ -176,7 +185,7 @@ func TestAIClient_ForwardStream_SSEResponse(t *testing.T) {
 		flusher.Flush()
 	})
 
-	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", bytes.NewReader([]byte(`{"stream":true}`)))
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", bytes.NewReader([]byte(`{"model":"test","stream":true}`)))
 	resp, err := client.ForwardStream(req)
 	if err != nil {
 		t.Fatalf("ForwardStream failed: %v", err)
@@ -242,3 +251,705 @@ func TestIsHopByHopHeader(t *testing.T) {
 		})
 	}
 }
+
+func TestAIClient_CheckHealth_DefaultPath(t *testing.T) {
+	var gotMethod, gotPath string
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	})
+
+	if err := client.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("CheckHealth failed: %v", err)
+	}
+	if gotMethod != http.MethodGet || gotPath != "/v1/models" {
+		t.Errorf("probe = %s %s, want GET /v1/models", gotMethod, gotPath)
+	}
+}
+
+func TestAIClient_CheckHealth_ConfiguredPath(t *testing.T) {
+	var gotMethod, gotPath, gotAuth string
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		if r.URL.Path == "/api/tags" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	client.apiKey = "sk-test-key"
+	client.SetHealthCheck(config.HealthCheck{Path: "/api/tags", Method: http.MethodHead, ExpectedStatus: http.StatusNoContent})
+
+	if err := client.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("CheckHealth failed: %v", err)
+	}
+	if gotMethod != http.MethodHead || gotPath != "/api/tags" {
+		t.Errorf("probe = %s %s, want HEAD /api/tags", gotMethod, gotPath)
+	}
+	if gotAuth != "Bearer sk-test-key" {
+		t.Errorf("Authorization = %q, want Bearer sk-test-key", gotAuth)
+	}
+}
+
+func TestAIClient_CheckHealth_UnexpectedStatus(t *testing.T) {
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	client.SetHealthCheck(config.HealthCheck{Path: "/health"})
+
+	if err := client.CheckHealth(context.Background()); err == nil {
+		t.Fatal("CheckHealth should fail on unexpected status")
+	}
+}
+
+func TestAIClient_CheckHealth_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	client := NewAIClient(url, "", nil)
+	if err := client.CheckHealth(context.Background()); err == nil {
+		t.Fatal("CheckHealth should fail when backend is unreachable")
+	}
+
+	// 禁用健康检查时始终视为健康
+	client.SetHealthCheck(config.HealthCheck{Disabled: true})
+	if err := client.CheckHealth(context.Background()); err != nil {
+		t.Errorf("disabled CheckHealth should succeed, got %v", err)
+	}
+}
+
+func TestAIClient_RequestID_GeneratedAndForwarded(t *testing.T) {
+	var gotID string
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotID = r.Header.Get("X-Request-ID")
+		w.WriteHeader(http.StatusOK)
+	})
+	client.SetRequestID(config.RequestID{Header: "x-request-id", Generate: true})
+
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", nil)
+	resp, err := client.Forward(req)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if !strings.HasPrefix(gotID, "req-") {
+		t.Fatalf("backend should receive generated request ID, got %q", gotID)
+	}
+	if echoed := resp.Header.Get("X-Request-ID"); echoed != gotID {
+		t.Errorf("echoed request ID = %q, want %q", echoed, gotID)
+	}
+}
+
+func TestAIClient_RequestID_SuppliedPreserved(t *testing.T) {
+	var gotID string
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotID = r.Header.Get("X-Request-ID")
+		w.WriteHeader(http.StatusOK)
+	})
+	client.SetRequestID(config.RequestID{Header: "X-Request-ID", Generate: true})
+
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", nil)
+	req.Header.Set("X-Request-ID", "client-123")
+	resp, err := client.Forward(req)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if gotID != "client-123" {
+		t.Errorf("backend request ID = %q, want client-123", gotID)
+	}
+	if echoed := resp.Header.Get("X-Request-ID"); echoed != "client-123" {
+		t.Errorf("echoed request ID = %q, want client-123", echoed)
+	}
+}
+
+func TestAIClient_RequestID_BackendIDEchoed(t *testing.T) {
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", "backend-456")
+		w.WriteHeader(http.StatusOK)
+	})
+	client.SetRequestID(config.RequestID{Header: "X-Request-ID", Generate: true})
+
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", nil)
+	resp, err := client.Forward(req)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if echoed := resp.Header.Get("X-Request-ID"); echoed != "backend-456" {
+		t.Errorf("echoed request ID = %q, want backend-456", echoed)
+	}
+}
+
+func TestAIClient_RequestID_NoGenerate(t *testing.T) {
+	var gotID string
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotID = r.Header.Get("X-Request-ID")
+		w.WriteHeader(http.StatusOK)
+	})
+	client.SetRequestID(config.RequestID{Header: "X-Request-ID"})
+
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", nil)
+	resp, err := client.Forward(req)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if gotID != "" {
+		t.Errorf("request ID should not be generated, got %q", gotID)
+	}
+}
+
+func TestAIClient_Forward_ModelRequired(t *testing.T) {
+	var called atomic.Bool
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	})
+
+	for _, body := range []string{`{"model":""}`, `{"messages":[]}`, `{"model":" \n"}`} {
+		req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(body))
+		resp, err := client.Forward(req)
+		if err != nil {
+			t.Fatalf("Forward failed: %v", err)
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("body %s: StatusCode = %d, want 400", body, resp.StatusCode)
+		}
+		if !strings.Contains(string(respBody), "model is required") {
+			t.Errorf("body %s: response = %s, want model is required", body, respBody)
+		}
+	}
+	if called.Load() {
+		t.Error("model 校验失败的请求不应转发到后端")
+	}
+}
+
+// captureLog 捕获测试期间的标准日志输出
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestAIClient_AccessLog_BackendResponseID(t *testing.T) {
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"chatcmpl-abc123","choices":[{"message":{"content":"hello"}}]}`))
+	})
+	client.SetRequestID(config.RequestID{Header: "X-Request-ID"})
+	client.SetAccessLog(true)
+	logs := captureLog(t)
+
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"test"}`))
+	req.Header.Set("X-Request-ID", "gw-1")
+	resp, err := client.Forward(req)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	line := logs.String()
+	for _, want := range []string{"POST /v1/chat/completions 200", "request_id=gw-1", "backend_id=chatcmpl-abc123"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("access log missing %q: %s", want, line)
+		}
+	}
+
+	// 提取 ID 后响应体仍完整可读
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "hello") {
+		t.Errorf("response body altered: %s", body)
+	}
+}
+
+func TestAIClient_AccessLog_HeaderFallback(t *testing.T) {
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Request-Id", "req_anthropic_1")
+		w.Write([]byte("data: {\"id\":\"ignored\"}\n\n"))
+	})
+	client.SetAccessLog(true)
+	logs := captureLog(t)
+
+	req, _ := http.NewRequest("POST", "http://dummy/v1/messages", strings.NewReader(`{"model":"claude","stream":true}`))
+	resp, err := client.ForwardStream(req)
+	if err != nil {
+		t.Fatalf("ForwardStream failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	line := logs.String()
+	if !strings.Contains(line, "request_id=- backend_id=req_anthropic_1") {
+		t.Errorf("access log = %q, want backend id from Request-Id header", line)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "ignored") {
+		t.Errorf("stream body should be untouched: %s", body)
+	}
+}
+
+// countingBody 记录已从底层读取的字节数
+type countingBody struct {
+	r      io.Reader
+	read   int
+	closed bool
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.read += n
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestBackendResponseID_ReadsBoundedPrefix(t *testing.T) {
+	payload := `{"id":"chatcmpl-big","data":"` + strings.Repeat("x", 4*responseIDPeekSize) + `"}`
+	body := &countingBody{r: strings.NewReader(payload)}
+	resp := &http.Response{Header: http.Header{"Content-Type": {"application/json"}}, Body: body}
+
+	if id := backendResponseID(resp); id != "chatcmpl-big" {
+		t.Errorf("backendResponseID = %q, want chatcmpl-big", id)
+	}
+	if body.read > responseIDPeekSize {
+		t.Errorf("read %d bytes before forwarding, want at most %d", body.read, responseIDPeekSize)
+	}
+
+	// 已读前缀放回，响应体完整可读，关闭传递给原响应体
+	got, _ := io.ReadAll(resp.Body)
+	if string(got) != payload {
+		t.Errorf("response body altered: got %d bytes, want %d", len(got), len(payload))
+	}
+	resp.Body.Close()
+	if !body.closed {
+		t.Error("Close was not passed to the backend body")
+	}
+}
+
+func TestAIClient_AccessLog_Disabled(t *testing.T) {
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"chatcmpl-abc123"}`))
+	})
+	logs := captureLog(t)
+
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"test"}`))
+	resp, err := client.Forward(req)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if strings.Contains(logs.String(), "访问日志") {
+		t.Errorf("access log written while disabled: %s", logs.String())
+	}
+}
+
+// newNamedBackend 启动返回自身名称的测试后端，healthy 为 false 时健康端点返回 503
+// 关闭长连接，使后端关闭后的请求确定地表现为连接失败 (而不是复用已断开的空闲连接)
+func newNamedBackend(t *testing.T, name string, healthy *atomic.Bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			if healthy != nil && !healthy.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"backend":"` + name + `","echo":` + string(body) + `}`))
+	}))
+	server.Config.SetKeepAlivesEnabled(false)
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// forwardBackend 转发一次请求，返回处理该请求的后端名称
+func forwardBackend(t *testing.T, client *AIClient, stream bool) string {
+	t.Helper()
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+	forward := client.Forward
+	if stream {
+		forward = client.ForwardStream
+	}
+	resp, err := forward(req)
+	if err != nil {
+		t.Fatalf("forward failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Backend string          `json:"backend"`
+		Echo    json.RawMessage `json:"echo"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if string(out.Echo) != `{"model":"m"}` {
+		t.Errorf("backend %s received body %s, want the full request body", out.Backend, out.Echo)
+	}
+	return out.Backend
+}
+
+func TestAIClient_FailoverWhenBackendGoesDown(t *testing.T) {
+	primary := newNamedBackend(t, "primary", nil)
+	secondary := newNamedBackend(t, "secondary", nil)
+	client := NewAIClientWithBackends([]string{primary.URL, secondary.URL}, "", nil)
+
+	if got := forwardBackend(t, client, false); got != "primary" {
+		t.Fatalf("backend = %s, want primary while it is up", got)
+	}
+
+	// 运行中关闭首选后端: 请求继续由备用后端处理
+	primary.Close()
+	for i := 0; i < 3; i++ {
+		if got := forwardBackend(t, client, i%2 == 1); got != "secondary" {
+			t.Fatalf("request %d backend = %s, want secondary after primary went down", i, got)
+		}
+	}
+
+	health := client.BackendHealth()
+	if len(health) != 2 || health[0].Healthy || !health[1].Healthy {
+		t.Errorf("BackendHealth = %+v, want primary down and secondary up", health)
+	}
+}
+
+func TestAIClient_HealthProbeMarksBackends(t *testing.T) {
+	var primaryHealthy atomic.Bool
+	primaryHealthy.Store(true)
+	primary := newNamedBackend(t, "primary", &primaryHealthy)
+	secondary := newNamedBackend(t, "secondary", nil)
+
+	client := NewAIClientWithBackends([]string{primary.URL, secondary.URL}, "", nil)
+	client.SetHealthCheck(config.HealthCheck{Interval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.StartHealthProbe(ctx)
+
+	waitHealth := func(want bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for client.BackendHealth()[0].Healthy != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("primary healthy never became %v", want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// 健康端点失败的实例被跳过，即使它仍能接受连接
+	primaryHealthy.Store(false)
+	waitHealth(false)
+	if got := forwardBackend(t, client, false); got != "secondary" {
+		t.Errorf("backend = %s, want secondary while primary is marked down", got)
+	}
+
+	// 恢复后重新优先使用首选实例
+	primaryHealthy.Store(true)
+	waitHealth(true)
+	if got := forwardBackend(t, client, false); got != "primary" {
+		t.Errorf("backend = %s, want primary after recovery", got)
+	}
+}
+
+func TestAIClient_CheckHealth_AnyBackendHealthy(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	up := newNamedBackend(t, "up", nil)
+
+	client := NewAIClientWithBackends([]string{down.URL, up.URL}, "", nil)
+	if err := client.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("CheckHealth should pass when any backend is healthy: %v", err)
+	}
+	if health := client.BackendHealth(); health[0].Healthy || !health[1].Healthy {
+		t.Errorf("BackendHealth = %+v, want first down, second up", health)
+	}
+
+	client = NewAIClientWithBackends([]string{down.URL, down.URL}, "", nil)
+	if err := client.CheckHealth(context.Background()); err == nil {
+		t.Fatal("CheckHealth should fail when every backend is down")
+	}
+}
+
+func TestAIClient_ShutdownWaitsForInflight(t *testing.T) {
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"done"}`))
+	})
+
+	result := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+		resp, err := client.Forward(req)
+		if err == nil {
+			_, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		result <- err
+	}()
+	<-started
+
+	shutdown := make(chan struct{})
+	go func() {
+		client.Shutdown(5 * time.Second)
+		close(shutdown)
+	}()
+
+	// 进行中的请求结束前 Shutdown 不返回，且不再接受新请求
+	select {
+	case <-shutdown:
+		t.Fatal("Shutdown returned while a request was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+	if _, err := client.Forward(req); !errors.Is(err, ErrAIClientClosed) {
+		t.Errorf("Forward after Shutdown err = %v, want ErrAIClientClosed", err)
+	}
+
+	close(finish)
+	if err := <-result; err != nil {
+		t.Errorf("in-flight request failed: %v", err)
+	}
+	select {
+	case <-shutdown:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return after in-flight request completed")
+	}
+}
+
+func TestAIClient_RateLimitRetry_HonorsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	var bodies []string
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"id":"ok"}`))
+	})
+	client.SetRateLimitRetry(config.RateLimitRetry{MaxAttempts: 3, MaxWait: 2 * time.Second})
+
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+	start := time.Now()
+	resp, err := client.Forward(req)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want 200 after retry", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least Retry-After (1s)", elapsed)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("backend calls = %d, want 2", calls.Load())
+	}
+	for i, b := range bodies {
+		if b != `{"model":"m"}` {
+			t.Errorf("attempt %d body = %q, want replayed request body", i+1, b)
+		}
+	}
+}
+
+func TestAIClient_RateLimitRetry_Bounded(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		cfg        config.RateLimitRetry
+		wantCalls  int32
+	}{
+		{"disabled", "0", config.RateLimitRetry{}, 1},
+		{"attempts exhausted", "0", config.RateLimitRetry{MaxAttempts: 3}, 3},
+		{"wait exceeds max", "30", config.RateLimitRetry{MaxAttempts: 3, MaxWait: time.Second}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.Header().Set("Retry-After", tt.retryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+			})
+			client.SetRateLimitRetry(tt.cfg)
+
+			req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+			resp, err := client.Forward(req)
+			if err != nil {
+				t.Fatalf("Forward failed: %v", err)
+			}
+			resp.Body.Close()
+
+			// 超出重试范围时原样返回 429 (含 Retry-After)，由 Client 决定如何处理
+			if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != tt.retryAfter {
+				t.Errorf("response = %d Retry-After=%q, want 429 passed through", resp.StatusCode, resp.Header.Get("Retry-After"))
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("backend calls = %d, want %d", calls.Load(), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"5", 5 * time.Second, true},
+		{now.Add(3 * time.Second).Format(http.TimeFormat), 3 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestAIClient_BackendRetry_TransientFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(w http.ResponseWriter)
+	}{
+		{"503", func(w http.ResponseWriter) { w.WriteHeader(http.StatusServiceUnavailable) }},
+		{"connection reset", func(w http.ResponseWriter) {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			var bodies []string
+			client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				bodies = append(bodies, string(body))
+				if calls.Add(1) <= 2 {
+					tt.fail(w)
+					return
+				}
+				w.Write([]byte(`{"id":"ok"}`))
+			})
+			client.SetBackendRetry(config.BackendRetry{MaxRetries: 3, BaseDelay: 20 * time.Millisecond})
+
+			req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+			start := time.Now()
+			resp, err := client.Forward(req)
+			if err != nil {
+				t.Fatalf("Forward failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+				t.Errorf("status = %d after %d calls, want 200 on the third attempt", resp.StatusCode, calls.Load())
+			}
+			// 指数退避: 20ms + 40ms
+			if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+				t.Errorf("retried after %v, want at least 60ms of backoff", elapsed)
+			}
+			for i, b := range bodies {
+				if b != `{"model":"m"}` {
+					t.Errorf("attempt %d body = %q, want replayed request body", i+1, b)
+				}
+			}
+		})
+	}
+}
+
+func TestAIClient_BackendRetry_HonorsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"id":"ok"}`))
+	})
+	client.SetBackendRetry(config.BackendRetry{MaxRetries: 2, BaseDelay: time.Millisecond})
+
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+	start := time.Now()
+	resp, err := client.Forward(req)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("status = %d after %d calls, want 200 on the second attempt", resp.StatusCode, calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want Retry-After (1s) instead of the base delay", elapsed)
+	}
+}
+
+func TestAIClient_BackendRetry_Bounded(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		cfg        config.BackendRetry
+		wantCalls  int32
+	}{
+		{"disabled", http.StatusServiceUnavailable, "", config.BackendRetry{}, 1},
+		{"retries exhausted", http.StatusBadGateway, "", config.BackendRetry{MaxRetries: 2, BaseDelay: time.Millisecond}, 3},
+		{"status not retryable", http.StatusInternalServerError, "", config.BackendRetry{MaxRetries: 2}, 1},
+		{"custom statuses", http.StatusInternalServerError, "", config.BackendRetry{MaxRetries: 1, BaseDelay: time.Millisecond, Statuses: []int{500}}, 2},
+		{"retry-after exceeds max delay", http.StatusServiceUnavailable, "30", config.BackendRetry{MaxRetries: 2}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+			})
+			client.SetBackendRetry(tt.cfg)
+
+			req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+			resp, err := client.Forward(req)
+			if err != nil {
+				t.Fatalf("Forward failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status || calls.Load() != tt.wantCalls {
+				t.Errorf("status = %d after %d calls, want %d after %d", resp.StatusCode, calls.Load(), tt.status, tt.wantCalls)
+			}
+		})
+	}
+}
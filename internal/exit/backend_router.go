@@ -0,0 +1,147 @@
+package exit
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/binn/tokengo/internal/config"
+)
+
+// backendRoute 一条模型路由规则
+type backendRoute struct {
+	patterns []string
+	client   *AIClient
+}
+
+// BackendRouter 按解密后请求体中的 model 字段选择 AI 后端
+// 规则按添加顺序匹配，未匹配或无 model 字段的请求使用默认后端
+type BackendRouter struct {
+	routes   []backendRoute
+	fallback *AIClient
+}
+
+// NewBackendRouter 创建后端路由器，fallback 为默认后端
+func NewBackendRouter(fallback *AIClient) *BackendRouter {
+	return &BackendRouter{fallback: fallback}
+}
+
+// AddRoute 添加路由规则: model 匹配任一模式时使用 client
+func (r *BackendRouter) AddRoute(patterns []string, client *AIClient) error {
+	if len(patterns) == 0 {
+		return fmt.Errorf("路由规则缺少 models")
+	}
+	for _, p := range patterns {
+		if p == "" {
+			return fmt.Errorf("模型模式不能为空")
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("无效的模型模式 %q: %w", p, err)
+		}
+	}
+	r.routes = append(r.routes, backendRoute{patterns: patterns, client: client})
+	return nil
+}
+
+// Clients 返回默认后端和所有路由规则的后端
+func (r *BackendRouter) Clients() []*AIClient {
+	clients := []*AIClient{r.fallback}
+	for _, route := range r.routes {
+		clients = append(clients, route.client)
+	}
+	return clients
+}
+
+// Match 返回 model 对应的后端
+func (r *BackendRouter) Match(model string) *AIClient {
+	if model != "" {
+		for _, route := range r.routes {
+			for _, p := range route.patterns {
+				if matchModel(p, model) {
+					return route.client
+				}
+			}
+		}
+	}
+	return r.fallback
+}
+
+// Route 按请求指定的 model 选择后端，读取的请求体随后还原 (分块上传的请求体只读取前缀)
+func (r *BackendRouter) Route(req *http.Request) (*AIClient, error) {
+	if len(r.routes) == 0 {
+		return r.fallback, nil
+	}
+
+	model, _, err := requestModel(req)
+	if err != nil {
+		return nil, err
+	}
+	return r.Match(model), nil
+}
+
+// matchModel 匹配模型名: 以单个 * 结尾的模式按前缀匹配 (允许模型名包含 /)，其余按 path.Match 通配
+func matchModel(pattern, model string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok && !strings.ContainsAny(prefix, "*?[\\") {
+		return strings.HasPrefix(model, prefix)
+	}
+	ok, _ := path.Match(pattern, model)
+	return ok
+}
+
+// newAIClientFromConfig 按后端配置创建 AI 客户端 (健康检查、请求 ID、模型拆分、响应归一化、限流重试、路径允许列表、并发公平排队)
+func newAIClientFromConfig(cfg config.AIBackend) (*AIClient, error) {
+	for i, u := range cfg.URLs {
+		if u == "" {
+			return nil, fmt.Errorf("urls 第 %d 项为空", i+1)
+		}
+	}
+	aiClient := NewAIClientWithBackends(append([]string{cfg.URL}, cfg.URLs...), cfg.APIKey, cfg.Headers)
+	aiClient.SetHealthCheck(cfg.HealthCheck)
+	aiClient.SetRequestID(cfg.RequestID)
+	aiClient.SetResponseNormalizer(NewResponseNormalizer(cfg.Normalize))
+	aiClient.SetRateLimitRetry(cfg.RateLimitRetry)
+	aiClient.SetAllowedPaths(cfg.AllowedPaths)
+	if cfg.MaxConcurrent < 0 {
+		return nil, fmt.Errorf("max_concurrent 不能为负数: %d", cfg.MaxConcurrent)
+	}
+	for model, w := range cfg.ModelWeights {
+		if w <= 0 {
+			return nil, fmt.Errorf("model_weights 中模型 %q 的权重必须为正数: %d", model, w)
+		}
+	}
+	if cfg.QueueTimeout < 0 {
+		return nil, fmt.Errorf("queue_timeout 不能为负数: %v", cfg.QueueTimeout)
+	}
+	aiClient.SetQueueTimeout(cfg.QueueTimeout)
+	aiClient.SetConcurrency(cfg.MaxConcurrent, cfg.ModelWeights)
+	if len(cfg.ModelSplits) > 0 {
+		splitter, err := NewModelSplitter(cfg.ModelSplits)
+		if err != nil {
+			return nil, fmt.Errorf("解析模型拆分配置失败: %w", err)
+		}
+		aiClient.AddTransformer(splitter)
+	}
+	return aiClient, nil
+}
+
+// newBackendRouter 按配置创建后端路由器，未配置规则时返回 nil (只使用默认后端)
+func newBackendRouter(fallback *AIClient, rules []config.BackendRule) (*BackendRouter, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	router := NewBackendRouter(fallback)
+	for i, rule := range rules {
+		if rule.Backend.URL == "" {
+			return nil, fmt.Errorf("第 %d 条后端规则缺少 url", i+1)
+		}
+		client, err := newAIClientFromConfig(rule.Backend)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 条后端规则: %w", i+1, err)
+		}
+		if err := router.AddRoute(rule.Models, client); err != nil {
+			return nil, fmt.Errorf("第 %d 条后端规则: %w", i+1, err)
+		}
+	}
+	return router, nil
+}
@@ -0,0 +1,179 @@
+package exit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/crypto"
+)
+
+func TestMatchModel(t *testing.T) {
+	tests := []struct {
+		pattern, model string
+		want           bool
+	}{
+		{"gpt-4o", "gpt-4o", true},
+		{"gpt-4o", "gpt-4o-mini", false},
+		{"gpt-4*", "gpt-4o-mini", true},
+		{"gpt-4*", "gpt-3.5-turbo", false},
+		{"meta-llama/*", "meta-llama/Llama-3-8B", true},
+		{"llama3*:?b", "llama3.1:8b", true},
+		{"llama3*:?b", "llama3.1:70b", false},
+	}
+	for _, tt := range tests {
+		if got := matchModel(tt.pattern, tt.model); got != tt.want {
+			t.Errorf("matchModel(%q, %q) = %v, want %v", tt.pattern, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestBackendRouter_Match(t *testing.T) {
+	fallback := NewAIClient("http://default", "", nil)
+	openai := NewAIClient("http://openai", "", nil)
+	ollama := NewAIClient("http://ollama", "", nil)
+
+	router := NewBackendRouter(fallback)
+	if err := router.AddRoute([]string{"gpt-4*", "o1"}, openai); err != nil {
+		t.Fatalf("AddRoute failed: %v", err)
+	}
+	if err := router.AddRoute([]string{"llama*"}, ollama); err != nil {
+		t.Fatalf("AddRoute failed: %v", err)
+	}
+
+	tests := map[string]*AIClient{
+		"gpt-4o":   openai,
+		"o1":       openai,
+		"llama3.1": ollama,
+		"claude":   fallback,
+		"":         fallback,
+	}
+	for model, want := range tests {
+		if got := router.Match(model); got != want {
+			t.Errorf("Match(%q) = %s, want %s", model, got.baseURL, want.baseURL)
+		}
+	}
+}
+
+func TestBackendRouter_AddRouteInvalid(t *testing.T) {
+	router := NewBackendRouter(nil)
+	for _, patterns := range [][]string{nil, {""}, {"gpt-[4"}} {
+		if err := router.AddRoute(patterns, nil); err == nil {
+			t.Errorf("AddRoute(%q) 应失败", patterns)
+		}
+	}
+}
+
+func TestBackendRouter_RoutePreservesBody(t *testing.T) {
+	fallback := NewAIClient("http://default", "", nil)
+	ollama := NewAIClient("http://ollama", "", nil)
+	router := NewBackendRouter(fallback)
+	router.AddRoute([]string{"llama*"}, ollama)
+
+	body := `{"model":"llama3","messages":[]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	got, err := router.Route(req)
+	if err != nil {
+		t.Fatalf("Route failed: %v", err)
+	}
+	if got != ollama {
+		t.Errorf("Route = %s, want ollama", got.baseURL)
+	}
+	if b, _ := io.ReadAll(req.Body); string(b) != body {
+		t.Errorf("请求体未还原: %q", b)
+	}
+
+	// 非 JSON 和无请求体使用默认后端
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/v1/audio/transcriptions", strings.NewReader("binary")),
+		httptest.NewRequest("GET", "/v1/models", nil),
+	} {
+		if got, err := router.Route(req); err != nil || got != fallback {
+			t.Errorf("Route(%s %s) = %v, %v, want fallback", req.Method, req.URL.Path, got, err)
+		}
+	}
+}
+
+func TestNewBackendRouter_NoRules(t *testing.T) {
+	router, err := newBackendRouter(NewAIClient("http://default", "", nil), nil)
+	if err != nil || router != nil {
+		t.Errorf("未配置规则时应返回 nil 路由器, got %v, %v", router, err)
+	}
+	if _, err := newBackendRouter(nil, []config.BackendRule{{Models: []string{"gpt-4*"}}}); err == nil {
+		t.Error("缺少 url 的规则应失败")
+	}
+}
+
+// TestOHTTPHandler_RoutesByModel 两个模型经同一 Exit 路由到两个不同的后端
+func TestOHTTPHandler_RoutesByModel(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Model string `json:"model"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"backend": name, "model": req.Model})
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	defaultBackend := newBackend("default")
+	openaiBackend := newBackend("openai")
+	ollamaBackend := newBackend("ollama")
+
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	fallback := NewAIClient(defaultBackend.URL, "", nil)
+	router, err := newBackendRouter(fallback, []config.BackendRule{
+		{Models: []string{"gpt-4*"}, Backend: config.AIBackend{URL: openaiBackend.URL}},
+		{Models: []string{"llama*"}, Backend: config.AIBackend{URL: ollamaBackend.URL}},
+	})
+	if err != nil {
+		t.Fatalf("newBackendRouter failed: %v", err)
+	}
+	handler, err := NewOHTTPHandler(kp.KeyID, kp.PrivateKey, kp.PublicKey, fallback)
+	if err != nil {
+		t.Fatalf("NewOHTTPHandler failed: %v", err)
+	}
+	handler.SetBackendRouter(router)
+	ohttpClient, err := crypto.NewOHTTPClient(kp.KeyID, kp.PublicKey)
+	if err != nil {
+		t.Fatalf("NewOHTTPClient failed: %v", err)
+	}
+
+	tests := map[string]string{
+		"gpt-4o":  "openai",
+		"llama3":  "ollama",
+		"mistral": "default",
+	}
+	for model, wantBackend := range tests {
+		reqBody := []byte(`{"model":"` + model + `","messages":[]}`)
+		ohttpReq, clientCtx := encryptRequest(t, ohttpClient, "POST", "/v1/chat/completions", reqBody)
+		ohttpResp, err := handler.ProcessRequest(ohttpReq)
+		if err != nil {
+			t.Fatalf("ProcessRequest(%s) failed: %v", model, err)
+		}
+		resp, err := clientCtx.DecapsulateResponse(ohttpResp)
+		if err != nil {
+			t.Fatalf("DecapsulateResponse failed: %v", err)
+		}
+		var got map[string]string
+		json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+
+		if got["backend"] != wantBackend {
+			t.Errorf("model %s routed to %q, want %q", model, got["backend"], wantBackend)
+		}
+		// 路由后请求体完整转发给后端
+		if got["model"] != model {
+			t.Errorf("backend received model %q, want %q", got["model"], model)
+		}
+	}
+}
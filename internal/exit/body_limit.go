@@ -0,0 +1,107 @@
+package exit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/binn/tokengo/pkg/openai"
+)
+
+// ErrRequestTooLarge 解密后的请求体超过 max_request_bytes
+var ErrRequestTooLarge = errors.New("请求体超过大小上限")
+
+// ErrResponseTooLarge AI 后端响应体超过 max_response_bytes
+var ErrResponseTooLarge = errors.New("AI 后端响应体超过大小上限")
+
+// BodyLimit 请求体/响应体大小上限，0 表示不限制
+type BodyLimit struct {
+	MaxRequestBytes  int64 // 解密后的请求体最大字节数
+	MaxResponseBytes int64 // AI 后端响应体最大字节数 (流式响应按累计字节数计算)
+}
+
+// checkRequest 校验请求体大小: 已知长度超限时立即拒绝，分块上传的请求体在读取时累计校验
+func (l BodyLimit) checkRequest(req *http.Request) error {
+	if l.MaxRequestBytes <= 0 {
+		return nil
+	}
+	if req.ContentLength > l.MaxRequestBytes {
+		return fmt.Errorf("%w: %d > %d 字节", ErrRequestTooLarge, req.ContentLength, l.MaxRequestBytes)
+	}
+	if upload, ok := req.Body.(*uploadBody); ok {
+		upload.limit = l.MaxRequestBytes
+	}
+	return nil
+}
+
+// limitResponse 包装响应体，累计读取超过上限时返回 ErrResponseTooLarge
+func (l BodyLimit) limitResponse(r io.Reader) io.Reader {
+	if l.MaxResponseBytes <= 0 {
+		return r
+	}
+	return &limitedReader{r: r, remaining: l.MaxResponseBytes, err: ErrResponseTooLarge}
+}
+
+// readResponse 在上限内将非流式响应体读入内存并替换 resp.Body，超限时不再继续读取
+func (l BodyLimit) readResponse(resp *http.Response) error {
+	if l.MaxResponseBytes <= 0 {
+		return nil
+	}
+	if resp.ContentLength > l.MaxResponseBytes {
+		return fmt.Errorf("%w: %d > %d 字节", ErrResponseTooLarge, resp.ContentLength, l.MaxResponseBytes)
+	}
+	body, err := io.ReadAll(l.limitResponse(resp.Body))
+	if errors.Is(err, ErrResponseTooLarge) {
+		return fmt.Errorf("%w: > %d 字节", err, l.MaxResponseBytes)
+	}
+	if err != nil {
+		return fmt.Errorf("读取响应体失败: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+// limitedReader 最多读取 remaining 字节，之后再有数据时返回 err
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr.remaining < 0 {
+		return 0, lr.err
+	}
+	// 多读 1 字节用于判断是否超限
+	if int64(len(p)) > lr.remaining+1 {
+		p = p[:lr.remaining+1]
+	}
+	n, err := lr.r.Read(p)
+	if int64(n) <= lr.remaining {
+		lr.remaining -= int64(n)
+		return n, err
+	}
+	n = int(lr.remaining)
+	lr.remaining = -1
+	return n, lr.err
+}
+
+// requestTooLargeResponse 请求体超限时返回给 Client 的 413 错误
+func requestTooLargeResponse(limit int64) *http.Response {
+	return newErrorResponse(http.StatusRequestEntityTooLarge, openai.ErrorDetail{
+		Message: fmt.Sprintf("Request body exceeds the exit limit of %d bytes", limit),
+		Type:    "invalid_request_error",
+		Code:    "request_too_large",
+	})
+}
+
+// responseTooLargeResponse AI 后端响应体超限时返回给 Client 的 502 错误
+func responseTooLargeResponse(limit int64) *http.Response {
+	return newErrorResponse(http.StatusBadGateway, openai.ErrorDetail{
+		Message: fmt.Sprintf("AI backend response exceeds the exit limit of %d bytes", limit),
+		Type:    "gateway_error",
+		Code:    "response_too_large",
+	})
+}
@@ -0,0 +1,82 @@
+package exit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// responseCompression Exit 压缩非流式响应体的配置
+type responseCompression struct {
+	flag    byte // protocol.Compression*，CompressionNone 表示不压缩 (默认)
+	minSize int  // 响应体达到该字节数才压缩
+}
+
+// SetCompression 设置响应压缩: Client 声明接受压缩时，非流式响应体在 HPKE 加密前按 cfg.Algorithm 压缩
+// (小于 cfg.MinSize 时不压缩)；未配置算法时不压缩响应 (默认)，Client 压缩的请求体始终会解压
+func (h *OHTTPHandler) SetCompression(cfg config.Compression) error {
+	flag, err := protocol.ParseCompression(cfg.Algorithm)
+	if err != nil {
+		return err
+	}
+	minSize := cfg.MinSize
+	if minSize <= 0 {
+		minSize = protocol.DefaultCompressionMinSize
+	}
+	h.compression = responseCompression{flag: flag, minSize: minSize}
+	return nil
+}
+
+// decompressRequest 请求带压缩头时解析标志字节并还原请求体 (转发给后端前移除该头)，
+// 返回 Client 是否接受压缩的响应；解压后超过 max_request_bytes 时返回 ErrRequestTooLarge
+func (h *OHTTPHandler) decompressRequest(req *http.Request) (bool, error) {
+	if req.Header.Get(protocol.CompressionHeader) == "" {
+		return false, nil
+	}
+	req.Header.Del(protocol.CompressionHeader)
+	if req.Body == nil || req.Body == http.NoBody {
+		return true, nil
+	}
+
+	framed, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return false, fmt.Errorf("读取请求体失败: %w", err)
+	}
+	body, err := protocol.DecompressBody(framed, h.bodyLimit.MaxRequestBytes)
+	if errors.Is(err, protocol.ErrDecompressedTooLarge) {
+		return false, fmt.Errorf("%w: %w", ErrRequestTooLarge, err)
+	}
+	if err != nil {
+		return false, fmt.Errorf("解压请求体失败: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return true, nil
+}
+
+// compressResponse 压缩已读入内存的响应体并在响应头中回显算法，未配置响应压缩时不处理
+func (h *OHTTPHandler) compressResponse(resp *http.Response) error {
+	if h.compression.flag == protocol.CompressionNone {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("读取响应体失败: %w", err)
+	}
+	framed, err := protocol.CompressBody(body, h.compression.flag, h.compression.minSize)
+	if err != nil {
+		return err
+	}
+	resp.Header.Set(protocol.CompressionHeader, protocol.CompressionName(h.compression.flag))
+	resp.Header.Del("Content-Length")
+	resp.Body = io.NopCloser(bytes.NewReader(framed))
+	resp.ContentLength = int64(len(framed))
+	return nil
+}
@@ -0,0 +1,141 @@
+package exit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// encryptCompressedRequest 以压缩标志字节封装请求体并声明接受压缩的响应
+func encryptCompressedRequest(t *testing.T, client *crypto.OHTTPClient, body []byte, flag byte) ([]byte, *crypto.ClientContext) {
+	t.Helper()
+	framed, err := protocol.CompressBody(body, flag, 0)
+	if err != nil {
+		t.Fatalf("CompressBody: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, "http://ai-backend/v1/chat/completions", bytes.NewReader(framed))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(protocol.CompressionHeader, protocol.CompressionName(flag))
+	ohttpReq, ctx, err := client.EncapsulateRequest(req)
+	if err != nil {
+		t.Fatalf("EncapsulateRequest: %v", err)
+	}
+	return ohttpReq, ctx
+}
+
+func TestOHTTPHandler_DecompressesRequestWithoutCompressingResponse(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"content":"hello"},`), 500)
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		got, _ := io.ReadAll(r.Body)
+		if r.Header.Get(protocol.CompressionHeader) != "" || !bytes.Equal(got, body) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write(got)
+	})
+
+	// 未配置响应压缩: 请求体仍会解压，响应不回显压缩头
+	ohttpReq, clientCtx := encryptCompressedRequest(t, ohttpClient, body, protocol.CompressionGzip)
+	ohttpResp, err := handler.ProcessRequest(ohttpReq)
+	if err != nil {
+		t.Fatalf("ProcessRequest: %v", err)
+	}
+	resp, err := clientCtx.DecapsulateResponse(ohttpResp)
+	if err != nil {
+		t.Fatalf("DecapsulateResponse: %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(got, body) {
+		t.Errorf("response = %d (%d bytes), want 200 echoing the decompressed body", resp.StatusCode, len(got))
+	}
+	if resp.Header.Get(protocol.CompressionHeader) != "" {
+		t.Error("response compressed although the exit has no compression configured")
+	}
+}
+
+func TestOHTTPHandler_DecompressedRequestTooLarge(t *testing.T) {
+	var called atomic.Bool
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	})
+	handler.SetBodyLimit(BodyLimit{MaxRequestBytes: 1024})
+
+	// 压缩后远小于上限，解压后超限
+	ohttpReq, clientCtx := encryptCompressedRequest(t, ohttpClient, bytes.Repeat([]byte("a"), 64*1024), protocol.CompressionZstd)
+	ohttpResp, err := handler.ProcessRequest(ohttpReq)
+	if err != nil {
+		t.Fatalf("ProcessRequest: %v", err)
+	}
+	if status, code := decryptErrorCode(t, clientCtx, ohttpResp); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d (%s), want 413", status, code)
+	}
+	if called.Load() {
+		t.Error("oversized decompressed request reached the backend")
+	}
+}
+
+func TestOHTTPHandler_DecompressedStreamRequestTooLarge(t *testing.T) {
+	var called atomic.Bool
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	})
+	handler.SetBodyLimit(BodyLimit{MaxRequestBytes: 1024})
+
+	framed, err := protocol.CompressBody(bytes.Repeat([]byte("a"), 64*1024), protocol.CompressionZstd, 0)
+	if err != nil {
+		t.Fatalf("CompressBody: %v", err)
+	}
+	newRequest := func(sendHead bool) ([]byte, *crypto.ClientContext) {
+		req, _ := http.NewRequest(http.MethodPost, "http://ai-backend/v1/chat/completions", bytes.NewReader(framed))
+		req.Header.Set(protocol.CompressionHeader, protocol.CompressionName(protocol.CompressionZstd))
+		if sendHead {
+			req.Header.Set(protocol.StreamHeadHeader, "1")
+		}
+		ohttpReq, ctx, err := ohttpClient.EncapsulateRequest(req)
+		if err != nil {
+			t.Fatalf("EncapsulateRequest: %v", err)
+		}
+		return ohttpReq, ctx
+	}
+
+	// 不支持 StreamHead 的旧版 Client 仍收到 ErrRequestTooLarge
+	ohttpReq, _ := newRequest(false)
+	if err := handler.ProcessStreamRequest(ohttpReq, &bytes.Buffer{}); !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("ProcessStreamRequest err = %v, want ErrRequestTooLarge", err)
+	}
+
+	// 413 随加密的 StreamHead 返回，错误体在其后的数据块中
+	ohttpReq, clientCtx := newRequest(true)
+	var buf bytes.Buffer
+	if err := handler.ProcessStreamRequest(ohttpReq, &buf); err != nil {
+		t.Fatalf("ProcessStreamRequest: %v", err)
+	}
+	decryptor, _ := clientCtx.NewStreamDecryptor()
+	reader := bytes.NewReader(buf.Bytes())
+	head, err := protocol.Decode(reader)
+	if err != nil || head.Type != protocol.MessageTypeStreamHead {
+		t.Fatalf("first message = %v, %v; want StreamHead", head, err)
+	}
+	block, _ := decryptor.DecryptChunk(head.Payload)
+	if !strings.Contains(string(block), protocol.StreamStatusHeader+": 413") {
+		t.Errorf("StreamHead = %q, want status 413", block)
+	}
+	chunk, err := protocol.Decode(reader)
+	if err != nil || chunk.Type != protocol.MessageTypeStreamChunk {
+		t.Fatalf("second message = %v, %v; want StreamChunk", chunk, err)
+	}
+	body, _ := decryptor.DecryptChunk(chunk.Payload)
+	if !strings.Contains(string(body), "request_too_large") {
+		t.Errorf("body = %s, want request_too_large", body)
+	}
+	if called.Load() {
+		t.Error("oversized decompressed stream request reached the backend")
+	}
+}
@@ -3,15 +3,23 @@ package exit
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"sync"
+	"time"
 
+	"github.com/binn/tokengo/internal/bootstrap"
 	"github.com/binn/tokengo/internal/config"
 	"github.com/binn/tokengo/internal/crypto"
 	"github.com/binn/tokengo/internal/dht"
+	"github.com/binn/tokengo/internal/metrics"
+	"github.com/binn/tokengo/internal/netutil"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/cloudflare/circl/hpke"
 )
 
 // ExitNode 出口节点
@@ -22,11 +30,43 @@ type ExitNode struct {
 	dhtNode      *dht.Node
 	discovery    *dht.Discovery
 	provider     *dht.Provider
+	metrics      metrics.Sink
+	usage        *UsageTracker   // 按模型累计的 token 用量
+	models       *ModelDiscovery // 从后端发现的可服务模型，未启用 advertise.discover_models 时为 nil
 	publicKey    []byte
 	keyID        uint8
-	staticRelay  string // 静态 Relay 地址（用于 serve 命令）
+	aeads        []hpke.AEAD // 接受的 AEAD 算法 (按偏好顺序)，为空表示只接受 AES-128-GCM
+	staticRelay  string      // 静态 Relay 地址（用于 serve 命令）
+
+	ready     chan struct{} // 隧道注册和 DHT 服务注册均完成 (或启动失败) 后关闭
+	readyOnce sync.Once
+	readyErr  error // Ready 关闭的原因，nil 表示启动成功
+
+	httpMu      sync.Mutex
+	httpServer  *http.Server // 直连模式 HTTP OHTTP 服务，未配置 listen 时为 nil
+	httpAddr    string       // HTTP 服务实际监听地址
+	httpStopped bool         // Stop 之后不再启动 HTTP 服务
+
+	backendRetry  time.Duration // 等待后端就绪的初始重试间隔，0 使用默认值
+	shutdownGrace time.Duration // 关闭时等待进行中后端请求的宽限期，0 使用默认值
+
+	aiClients   []*AIClient     // 所有 AI 后端 (默认后端在前，随后按路由规则顺序)
+	probeCtx    context.Context // 后端健康探测的生命周期，Stop 时取消
+	probeCancel context.CancelFunc
 }
 
+// 启动时等待 AI 后端就绪的重试间隔 (指数退避)
+const (
+	defaultBackendRetry = time.Second
+	maxBackendRetry     = 30 * time.Second
+)
+
+// defaultShutdownGrace 关闭时等待进行中后端请求完成的宽限期，超过后取消请求
+const defaultShutdownGrace = 5 * time.Second
+
+// ErrExitStopped Exit 在就绪前被停止
+var ErrExitStopped = errors.New("Exit 已停止")
+
 // New 创建出口节点（DHT 发现模式）
 func New(cfg *config.ExitConfig) (*ExitNode, error) {
 	return newExitNode(cfg, "")
@@ -39,73 +79,182 @@ func NewStatic(cfg *config.ExitConfig, relayAddr string) (*ExitNode, error) {
 
 // newExitNode 内部构造函数
 func newExitNode(cfg *config.ExitConfig, staticRelay string) (*ExitNode, error) {
-	// 加载私钥
-	privKeyData, err := os.ReadFile(cfg.OHTTPPrivateKeyFile)
+	// 优先使用显式配置的公钥路径，否则回退到私钥文件 + ".pub"
+	pubKeyPath := cfg.OHTTPPublicKeyFile
+	if pubKeyPath == "" {
+		pubKeyPath = cfg.OHTTPPrivateKeyFile + ".pub"
+	}
+	primary, err := loadKeyPair(cfg.OHTTPPrivateKeyFile, pubKeyPath)
 	if err != nil {
-		return nil, fmt.Errorf("读取私钥文件失败: %w", err)
+		return nil, err
+	}
+	keyID, publicKey := primary.KeyID, primary.PublicKey
+
+	// 轮换重叠期内仍接受的其他密钥
+	keys := []*crypto.KeyPair{primary}
+	for _, path := range cfg.AdditionalOHTTPKeyFiles {
+		kp, err := loadKeyPair(path, path+".pub")
+		if err != nil {
+			return nil, fmt.Errorf("加载附加密钥 %s 失败: %w", path, err)
+		}
+		keys = append(keys, kp)
 	}
 
-	privateKey, err := base64.StdEncoding.DecodeString(string(privKeyData))
+	aeads, err := crypto.ParseAEADs(cfg.OHTTPAEADs)
 	if err != nil {
-		return nil, fmt.Errorf("解码私钥失败: %w", err)
+		return nil, fmt.Errorf("解析 ohttp_aeads 失败: %w", err)
 	}
 
-	// 优先使用显式配置的公钥路径，否则回退到私钥文件 + ".pub"
-	pubKeyPath := cfg.OHTTPPublicKeyFile
-	if pubKeyPath == "" {
-		pubKeyPath = cfg.OHTTPPrivateKeyFile + ".pub"
+	if err := protocol.ValidateCapabilities(cfg.Capabilities); err != nil {
+		return nil, fmt.Errorf("解析端点能力配置失败: %w", err)
+	}
+	if cfg.Advertise.Weight < 0 {
+		return nil, fmt.Errorf("advertise.weight 不能为负数: %d", cfg.Advertise.Weight)
+	}
+	if cfg.Advertise.Capacity < 0 {
+		return nil, fmt.Errorf("advertise.capacity 不能为负数: %d", cfg.Advertise.Capacity)
+	}
+	if cfg.RequestTimeout < 0 {
+		return nil, fmt.Errorf("request_timeout 不能为负数: %v", cfg.RequestTimeout)
+	}
+	if cfg.MaxConcurrentStreams < 0 {
+		return nil, fmt.Errorf("max_concurrent_streams 不能为负数: %d", cfg.MaxConcurrentStreams)
+	}
+	if cfg.StreamWorkers < 0 || cfg.StreamQueue < 0 {
+		return nil, fmt.Errorf("stream_workers/stream_queue 不能为负数")
 	}
-	pubKeyData, err := os.ReadFile(pubKeyPath)
+	if cfg.MaxRequestBytes < 0 || cfg.MaxResponseBytes < 0 {
+		return nil, fmt.Errorf("max_request_bytes/max_response_bytes 不能为负数")
+	}
+	if r := cfg.BackendRetry; r.MaxRetries < 0 || r.BaseDelay < 0 || r.MaxDelay < 0 {
+		return nil, fmt.Errorf("backend_retry 的 max_retries/base_delay/max_delay 不能为负数")
+	}
+	addrFamily, err := netutil.ParseAddrFamily(cfg.AddressFamily)
 	if err != nil {
-		return nil, fmt.Errorf("读取公钥文件失败: %w", err)
+		return nil, fmt.Errorf("解析地址族偏好失败: %w", err)
+	}
+	quicParams := cfg.QUIC.WithDefaults(config.DefaultExitQUICParams())
+	if err := quicParams.Validate(); err != nil {
+		return nil, err
 	}
 
-	keyID, publicKey, err := crypto.LoadPublicKeyConfig(string(pubKeyData))
+	// 创建 AI 客户端 (默认后端)
+	aiClient, err := newAIClientFromConfig(cfg.AIBackend)
 	if err != nil {
-		return nil, fmt.Errorf("解析公钥配置失败: %w", err)
+		return nil, err
 	}
 
-	// 创建 AI 客户端
-	aiClient := NewAIClient(cfg.AIBackend.URL, cfg.AIBackend.APIKey, cfg.AIBackend.Headers)
+	// 按 model 路由的附加后端
+	router, err := newBackendRouter(aiClient, cfg.Backends)
+	if err != nil {
+		return nil, fmt.Errorf("解析后端路由配置失败: %w", err)
+	}
+
+	// 访问日志和瞬时错误重试对所有后端生效
+	clients := []*AIClient{aiClient}
+	if router != nil {
+		clients = router.Clients()
+	}
+	for _, c := range clients {
+		c.SetAccessLog(cfg.AccessLog)
+		c.SetBackendRetry(cfg.BackendRetry)
+	}
 
 	// 创建 OHTTP 处理器
-	ohttpHandler, err := NewOHTTPHandler(keyID, privateKey, publicKey, aiClient)
+	ohttpHandler, err := NewOHTTPHandlerWithKeys(keys, aiClient, aeads...)
 	if err != nil {
 		return nil, fmt.Errorf("创建 OHTTP 处理器失败: %w", err)
 	}
+	if router != nil {
+		ohttpHandler.SetBackendRouter(router)
+	}
+	ohttpHandler.SetHeaderLimit(HeaderLimit{
+		MaxCount: cfg.MaxResponseHeaders,
+		MaxBytes: cfg.MaxResponseHeaderBytes,
+	})
+	ohttpHandler.SetBodyLimit(BodyLimit{
+		MaxRequestBytes:  cfg.MaxRequestBytes,
+		MaxResponseBytes: cfg.MaxResponseBytes,
+	})
+	ohttpHandler.SetSSEKeepalive(cfg.SSEKeepalive)
+	if err := ohttpHandler.SetAccessControl(cfg.AccessControl); err != nil {
+		return nil, fmt.Errorf("解析访问控制配置失败: %w", err)
+	}
+	if err := ohttpHandler.SetCompression(cfg.Compression); err != nil {
+		return nil, fmt.Errorf("解析压缩配置失败: %w", err)
+	}
 
 	// 计算公钥哈希 (用于在 Relay 侧标识此 Exit)
 	pubKeyHash := crypto.PubKeyHash(publicKey)
 
-	// 编码 KeyConfig (注册到 Relay 时附带，供 Client 查询)
-	keyConfig := crypto.EncodeKeyConfig(keyID, publicKey)
+	// 所有有效密钥的 KeyConfig (注册到 Relay 时附带，供 Client 查询)
+	keyConfig := ohttpHandler.KeyConfig()
+
+	// 指标输出 (请求次数、失败数、处理耗时)
+	sink, err := metrics.New(cfg.Metrics)
+	if err != nil {
+		return nil, fmt.Errorf("创建指标输出失败: %w", err)
+	}
+	usage := NewUsageTracker(sink)
+	ohttpHandler.SetUsageTracker(usage)
 
+	probeCtx, probeCancel := context.WithCancel(context.Background())
 	node := &ExitNode{
-		cfg:           cfg,
-		ohttpHandler:  ohttpHandler,
-		publicKey:     publicKey,
-		keyID:         keyID,
-		staticRelay:   staticRelay,
+		cfg:          cfg,
+		ohttpHandler: ohttpHandler,
+		metrics:      sink,
+		usage:        usage,
+		publicKey:    publicKey,
+		keyID:        keyID,
+		aeads:        aeads,
+		aiClients:    clients,
+		probeCtx:     probeCtx,
+		probeCancel:  probeCancel,
+		staticRelay:  staticRelay,
+		ready:        make(chan struct{}),
+	}
+	if cfg.Advertise.DiscoverModels {
+		node.models = NewModelDiscovery(clients, cfg.Advertise.Models)
 	}
 
 	// 静态模式（用于 serve 命令）
 	if staticRelay != "" {
 		node.tunnel = NewTunnelClientStatic(staticRelay, pubKeyHash, keyConfig, ohttpHandler)
+		node.tunnel.SetQUICParams(quicParams)
+		node.tunnel.SetMaxRegisterAttempts(cfg.MaxRegisterAttempts)
+		node.tunnel.SetCapabilities(cfg.Capabilities)
+		node.tunnel.SetAdvertise(cfg.Advertise)
+		node.tunnel.SetRequestTimeout(cfg.RequestTimeout)
+		node.tunnel.SetMaxConcurrentStreams(cfg.MaxConcurrentStreams)
+		node.tunnel.SetStreamPool(cfg.StreamWorkers, cfg.StreamQueue)
+		node.tunnel.SetMetrics(sink)
 		return node, nil
 	}
 
 	// DHT 发现模式（私有网络）
 	dhtCfg := &dht.Config{
-		PrivateKeyPath: cfg.DHT.PrivateKeyFile,
-		BootstrapPeers: cfg.DHT.BootstrapPeers,
-		ListenAddrs:    cfg.DHT.ListenAddrs,
-		ExternalAddrs:  cfg.DHT.ExternalAddrs,
-		Mode:           "server",
-		ServiceType:    "exit",
+		PrivateKeyPath:  cfg.DHT.PrivateKeyFile,
+		BootstrapPeers:  cfg.DHT.BootstrapPeers,
+		ListenAddrs:     cfg.DHT.ListenAddrs,
+		ExternalAddrs:   cfg.DHT.ExternalAddrs,
+		Mode:            "server",
+		ServiceType:     "exit",
+		NoAutoGenerate:  cfg.NoAutoGenerate,
+		ProviderTimeout: cfg.DHT.ProviderTimeout,
+
+		RegisterMinBackoff: cfg.DHT.RegisterMinBackoff,
+		RegisterMaxBackoff: cfg.DHT.RegisterMaxBackoff,
+		RegisterMaxRetries: cfg.DHT.RegisterMaxRetries,
+		EnableMDNS:         cfg.DHT.EnableMDNS,
+		CacheFile:          cfg.DHT.CacheFile, // 缓存的 Relay 由 selectBestRelay 探测后使用
+		NetworkID:          cfg.DHT.NetworkID,
+
+		TransitionalKeyPath: cfg.DHT.TransitionalPrivateKeyFile,
 	}
 
 	dhtNode, err := dht.NewNode(dhtCfg)
 	if err != nil {
+		sink.Close()
 		return nil, fmt.Errorf("创建 DHT 节点失败: %w", err)
 	}
 	node.dhtNode = dhtNode
@@ -114,18 +263,85 @@ func newExitNode(cfg *config.ExitConfig, staticRelay string) (*ExitNode, error)
 
 	// 创建反向隧道客户端（传入 DHT 发现器）
 	node.tunnel = NewTunnelClient(node.discovery, pubKeyHash, keyConfig, ohttpHandler)
+	node.tunnel.SetProbeConcurrency(cfg.RelayProbeConcurrency)
+	if cfg.BootstrapRelayFallback {
+		node.tunnel.SetBootstrapFallback(bootstrap.NewClient(cfg.BootstrapRelayURLs))
+	}
+	node.tunnel.SetAddressFamily(addrFamily)
+	node.tunnel.SetQUICParams(quicParams)
+	node.tunnel.SetMaxRegisterAttempts(cfg.MaxRegisterAttempts)
+	node.tunnel.SetCapabilities(cfg.Capabilities)
+	node.tunnel.SetAdvertise(cfg.Advertise)
+	node.tunnel.SetRequestTimeout(cfg.RequestTimeout)
+	node.tunnel.SetMaxConcurrentStreams(cfg.MaxConcurrentStreams)
+	node.tunnel.SetStreamPool(cfg.StreamWorkers, cfg.StreamQueue)
+	node.tunnel.SetMetrics(sink)
 
 	return node, nil
 }
 
+// loadKeyPair 加载 OHTTP 密钥对 (私钥为 base64，公钥为 base64 编码的 KeyConfig)
+func loadKeyPair(privPath, pubPath string) (*crypto.KeyPair, error) {
+	privKeyData, err := os.ReadFile(privPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取私钥文件失败: %w", err)
+	}
+
+	privateKey, err := base64.StdEncoding.DecodeString(string(privKeyData))
+	if err != nil {
+		return nil, fmt.Errorf("解码私钥失败: %w", err)
+	}
+
+	pubKeyData, err := os.ReadFile(pubPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取公钥文件失败: %w", err)
+	}
+
+	keyID, publicKey, err := crypto.LoadPublicKeyConfig(string(pubKeyData))
+	if err != nil {
+		return nil, fmt.Errorf("解析公钥配置失败: %w", err)
+	}
+
+	return &crypto.KeyPair{KeyID: keyID, PrivateKey: privateKey, PublicKey: publicKey}, nil
+}
+
 // Start 启动出口节点
 func (e *ExitNode) Start() error {
 	ctx := context.Background()
 
+	// 0. 后端就绪前不注册，避免通告一个必然失败的 Exit
+	if e.cfg.WaitForBackend {
+		if err := e.waitForBackend(ctx); err != nil {
+			e.markReady(err)
+			return err
+		}
+	}
+
+	// 配置了多个实例的后端在后台探测健康状态，转发时跳过不可用的实例
+	for _, c := range e.aiClients {
+		c.StartHealthProbe(e.probeCtx)
+	}
+	if e.usage != nil {
+		e.usage.StartLogging(e.probeCtx, e.cfg.UsageLogInterval)
+	}
+
+	// 启用模型发现时，注册前先查询一次后端的模型列表，之后定期刷新并通知 Relay
+	advertisedModels := e.cfg.Advertise.Models
+	if e.models != nil {
+		if _, err := e.models.Refresh(ctx); err != nil {
+			log.Printf("警告: 查询后端模型列表失败: %v", err)
+		}
+		advertisedModels = e.models.Models()
+		e.tunnel.UpdateModels(ctx, advertisedModels) // 尚未连接 Relay，只更新注册时附带的列表
+		e.models.Start(e.probeCtx, e.cfg.Advertise.ModelsRefresh, e.onModelsChanged)
+	}
+
 	// 1. 先启动 DHT 节点（仅 DHT 模式）
 	if e.dhtNode != nil {
 		if err := e.dhtNode.Start(ctx); err != nil {
-			return fmt.Errorf("启动 DHT 节点失败: %w", err)
+			err = fmt.Errorf("启动 DHT 节点失败: %w", err)
+			e.markReady(err)
+			return err
 		}
 		log.Printf("DHT 节点已启动, PeerID: %s", e.dhtNode.PeerID())
 
@@ -143,7 +359,7 @@ func (e *ExitNode) Start() error {
 	}
 
 	// 打印公钥信息
-	pubKeyConfig := crypto.EncodeKeyConfig(e.keyID, e.publicKey)
+	pubKeyConfig := crypto.EncodeKeyConfig(e.keyID, e.publicKey, e.aeads...)
 	pubKeyBase64 := base64.StdEncoding.EncodeToString(pubKeyConfig)
 	pubKeyHash := crypto.PubKeyHash(e.publicKey)
 	log.Printf("")
@@ -151,7 +367,28 @@ func (e *ExitNode) Start() error {
 	log.Printf("  %s", pubKeyBase64)
 	log.Printf("Exit pubKeyHash: %s", pubKeyHash)
 	log.Printf("")
-	log.Printf("AI 后端: %s", e.cfg.AIBackend.URL)
+	for i, c := range e.aiClients {
+		suffix := ""
+		if i > 0 {
+			suffix = fmt.Sprintf(" (模型 %v)", e.cfg.Backends[i-1].Models)
+		}
+		logBackendHealth(c, suffix)
+	}
+	if len(e.cfg.Capabilities) > 0 {
+		log.Printf("端点能力: %v", e.cfg.Capabilities)
+	}
+	if e.cfg.RequestTimeout > 0 {
+		log.Printf("推荐请求超时: %v", e.cfg.RequestTimeout)
+	}
+	if e.cfg.Advertise.Weight > 0 || len(advertisedModels) > 0 {
+		log.Printf("通告权重: %d, 模型: %v", e.cfg.Advertise.Weight, advertisedModels)
+	}
+	if e.cfg.MaxConcurrentStreams > 0 {
+		log.Printf("并发请求流上限: %d", e.cfg.MaxConcurrentStreams)
+	}
+	if e.cfg.MaxRequestBytes > 0 || e.cfg.MaxResponseBytes > 0 {
+		log.Printf("请求体/响应体上限: %d / %d 字节 (0 表示不限制)", e.cfg.MaxRequestBytes, e.cfg.MaxResponseBytes)
+	}
 
 	// 打印连接模式
 	if e.staticRelay != "" {
@@ -161,33 +398,191 @@ func (e *ExitNode) Start() error {
 	}
 	log.Printf("")
 
-	// 优雅关闭
-	go e.handleShutdown()
+	// 2. 启动直连模式 HTTP 服务 (仅配置了 listen 时)
+	if err := e.startHTTPServer(); err != nil {
+		e.markReady(err)
+		return err
+	}
+
+	// 3. 启动反向隧道
+	// DHT 服务注册已在上面同步完成，隧道首次注册成功即整体就绪
+	go func() {
+		select {
+		case <-e.tunnel.Ready():
+			e.markReady(nil)
+		case <-e.ready:
+		}
+	}()
+
+	if err := e.tunnel.Start(context.Background()); err != nil {
+		e.markReady(fmt.Errorf("Exit 注册失败: %w", err))
+		return err
+	}
+	return nil
+}
+
+// onModelsChanged 后端模型列表刷新后变化时通知 Relay (DHT 记录只含服务 CID，不携带模型)
+func (e *ExitNode) onModelsChanged(models []string) {
+	log.Printf("后端模型列表已变化，通告模型: %v", models)
+	ctx, cancel := context.WithTimeout(e.probeCtx, drainNotifyTimeout)
+	defer cancel()
+	if err := e.tunnel.UpdateModels(ctx, models); err != nil {
+		log.Printf("警告: %v", err)
+	}
+}
+
+// logBackendHealth 打印后端各实例的地址，多实例时附带当前健康状态
+func logBackendHealth(c *AIClient, suffix string) {
+	statuses := c.BackendHealth()
+	if len(statuses) == 1 {
+		log.Printf("AI 后端: %s%s", statuses[0].URL, suffix)
+		return
+	}
+	for _, st := range statuses {
+		state := "健康"
+		if !st.Healthy {
+			state = "不可用"
+		}
+		log.Printf("AI 后端: %s%s [%s]", st.URL, suffix, state)
+	}
+}
+
+// waitForBackend 反复探测 AI 后端健康端点直到通过，Stop 时返回 ErrExitStopped
+func (e *ExitNode) waitForBackend(ctx context.Context) error {
+	hc := e.cfg.AIBackend.HealthCheck
+	if hc.Disabled {
+		log.Printf("AI 后端健康检查已禁用，跳过启动检查")
+		return nil
+	}
+
+	delay := e.backendRetry
+	if delay <= 0 {
+		delay = defaultBackendRetry
+	}
+	for {
+		err := e.ohttpHandler.aiClient.CheckHealth(ctx)
+		if err == nil {
+			log.Printf("AI 后端已就绪")
+			return nil
+		}
+		log.Printf("AI 后端未就绪: %v，%v 后重试 (暂不注册)", err, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-e.ready:
+			timer.Stop()
+			return ErrExitStopped
+		}
+		delay = min(delay*2, maxBackendRetry)
+	}
+}
+
+// startHTTPServer 在配置了 listen 时启动直连模式 HTTP OHTTP 服务
+// 同步完成监听，地址不可用时直接返回错误；纯隧道模式下不启动任何 HTTP 服务
+func (e *ExitNode) startHTTPServer() error {
+	if e.cfg.Listen == "" {
+		return nil
+	}
 
-	// 2. 启动反向隧道
-	return e.tunnel.Start(context.Background())
+	e.httpMu.Lock()
+	defer e.httpMu.Unlock()
+	if e.httpStopped {
+		return ErrExitStopped
+	}
+
+	ln, err := net.Listen("tcp", e.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("HTTP 服务监听 %s 失败: %w", e.cfg.Listen, err)
+	}
+	e.httpServer = &http.Server{
+		Handler:           e.ohttpHandler.Routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	e.httpAddr = ln.Addr().String()
+	log.Printf("直连 HTTP OHTTP 服务监听: %s", e.httpAddr)
+
+	srv := e.httpServer
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP 服务错误: %v", err)
+		}
+	}()
+	return nil
 }
 
-// handleShutdown 处理优雅关闭
-func (e *ExitNode) handleShutdown() {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+// HTTPAddr 返回直连模式 HTTP 服务的监听地址，未启动时返回空字符串
+func (e *ExitNode) HTTPAddr() string {
+	e.httpMu.Lock()
+	defer e.httpMu.Unlock()
+	return e.httpAddr
+}
 
-	<-sigChan
-	log.Println("收到关闭信号，正在关闭...")
+// stopHTTPServer 关闭直连模式 HTTP 服务 (若已启动)
+func (e *ExitNode) stopHTTPServer() error {
+	e.httpMu.Lock()
+	defer e.httpMu.Unlock()
+	e.httpStopped = true
+	if e.httpServer == nil {
+		return nil
+	}
+	return e.httpServer.Close()
+}
 
-	if err := e.Stop(); err != nil {
-		log.Printf("关闭失败: %v", err)
+// shutdownBackends 并行关闭所有 AI 后端客户端，最多等待 shutdownGrace
+func (e *ExitNode) shutdownBackends() {
+	grace := e.shutdownGrace
+	if grace <= 0 {
+		grace = defaultShutdownGrace
 	}
+	var wg sync.WaitGroup
+	for _, c := range e.aiClients {
+		wg.Add(1)
+		go func(c *AIClient) {
+			defer wg.Done()
+			c.Shutdown(grace)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// markReady 关闭 Ready channel 并记录原因，仅首次调用生效
+func (e *ExitNode) markReady(err error) {
+	e.readyOnce.Do(func() {
+		e.readyErr = err
+		close(e.ready)
+	})
 }
 
-// Ready 返回一个在 Exit 首次注册到 Relay 后关闭的 channel
+// Ready 返回一个在 Exit 就绪后关闭的 channel: 反向隧道已注册到 Relay 且 DHT 服务注册已完成
+// 启动失败 (如注册次数耗尽) 或被停止时同样会关闭，调用 Err 区分原因；Start 之前调用也是安全的
 func (e *ExitNode) Ready() <-chan struct{} {
-	return e.tunnel.Ready()
+	return e.ready
+}
+
+// Err 返回 Ready 关闭的原因: 就绪时为 nil，启动失败或被停止时为对应错误
+// Ready 关闭前调用返回 nil
+func (e *ExitNode) Err() error {
+	select {
+	case <-e.ready:
+		return e.readyErr
+	default:
+		return nil
+	}
 }
 
 // Stop 停止出口节点
 func (e *ExitNode) Stop() error {
+	e.markReady(ErrExitStopped)
+
+	if e.probeCancel != nil {
+		e.probeCancel()
+	}
+
+	if err := e.stopHTTPServer(); err != nil {
+		log.Printf("关闭 HTTP 服务失败: %v", err)
+	}
+
 	// 停止 DHT 服务
 	if e.provider != nil {
 		e.provider.Unregister()
@@ -195,6 +590,12 @@ func (e *ExitNode) Stop() error {
 	if e.dhtNode != nil {
 		e.dhtNode.Stop()
 	}
+	if e.metrics != nil {
+		e.metrics.Close()
+	}
+
+	// 进行中的后端请求在宽限期内完成 (隧道仍可写回响应)，超时后取消，避免关闭被慢速后端拖住
+	e.shutdownBackends()
 
 	// 停止反向隧道
 	if e.tunnel != nil {
@@ -202,3 +603,20 @@ func (e *ExitNode) Stop() error {
 	}
 	return nil
 }
+
+// RoutingTableReport 返回 DHT 路由表快照，静态模式 (无 DHT) 或未启动时返回 nil
+// dhtNode 只在构造时设置，可在 Start 期间并发调用
+func (e *ExitNode) RoutingTableReport(sample int) *dht.RoutingTableReport {
+	if e.dhtNode == nil {
+		return nil
+	}
+	return e.dhtNode.RoutingTableReport(sample)
+}
+
+// HeartbeatRTT 返回与当前 Relay 的心跳往返时间滑动平均，未连接或尚未测得时返回 0
+func (e *ExitNode) HeartbeatRTT() time.Duration {
+	if e.tunnel == nil {
+		return 0
+	}
+	return e.tunnel.HeartbeatRTT()
+}
@@ -0,0 +1,325 @@
+package exit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// newTestExitNode 创建连接到指定 Relay 的静态模式 Exit (不加载密钥文件)
+func newTestExitNode(t *testing.T, relayAddr string, maxAttempts int) *ExitNode {
+	t.Helper()
+	tc := NewTunnelClientStatic(relayAddr, "hash", nil, nil)
+	tc.initialBackoff = 10 * time.Millisecond
+	tc.SetMaxRegisterAttempts(maxAttempts)
+
+	e := &ExitNode{
+		cfg:         &config.ExitConfig{},
+		tunnel:      tc,
+		staticRelay: relayAddr,
+		ready:       make(chan struct{}),
+	}
+	t.Cleanup(func() { e.Stop() })
+	return e
+}
+
+func waitReady(t *testing.T, e *ExitNode) {
+	t.Helper()
+	select {
+	case <-e.Ready():
+	case <-time.After(10 * time.Second):
+		t.Fatal("Ready 未关闭")
+	}
+}
+
+func TestExitNode_ReadyAfterRegistration(t *testing.T) {
+	relayAddr := startFakeRelay(t, protocol.NewRegisterAckMessage([]byte{protocol.ProtocolVersion}))
+	e := newTestExitNode(t, relayAddr, 0)
+
+	go e.Start()
+	waitReady(t, e)
+
+	if err := e.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil after successful registration", err)
+	}
+}
+
+func TestExitNode_ReadyUnblocksOnRegistrationFailure(t *testing.T) {
+	relayAddr := startRejectingRelay(t)
+	e := newTestExitNode(t, relayAddr, 2)
+
+	go e.Start()
+	waitReady(t, e)
+
+	if err := e.Err(); !errors.Is(err, ErrRegistrationExhausted) {
+		t.Errorf("Err() = %v, want ErrRegistrationExhausted", err)
+	}
+}
+
+func TestExitNode_ReadyBeforeStart(t *testing.T) {
+	e := newTestExitNode(t, "127.0.0.1:1", 0)
+
+	select {
+	case <-e.Ready():
+		t.Fatal("Ready 不应在 Start 之前关闭")
+	default:
+	}
+	if err := e.Err(); err != nil {
+		t.Errorf("Err() before Ready = %v, want nil", err)
+	}
+
+	// 未就绪时停止同样解除等待
+	e.Stop()
+	waitReady(t, e)
+	if err := e.Err(); !errors.Is(err, ErrExitStopped) {
+		t.Errorf("Err() = %v, want ErrExitStopped", err)
+	}
+}
+
+func TestExitNode_NoHTTPServerWithoutListen(t *testing.T) {
+	relayAddr := startFakeRelay(t, protocol.NewRegisterAckMessage([]byte{protocol.ProtocolVersion}))
+	e := newTestExitNode(t, relayAddr, 0)
+
+	go e.Start()
+	waitReady(t, e)
+
+	// 纯隧道模式不启动 HTTP 服务
+	if addr := e.HTTPAddr(); addr != "" {
+		t.Errorf("HTTPAddr() = %q, want empty in tunnel-only mode", addr)
+	}
+}
+
+func TestExitNode_HTTPServerWhenConfigured(t *testing.T) {
+	relayAddr := startFakeRelay(t, protocol.NewRegisterAckMessage([]byte{protocol.ProtocolVersion}))
+	handler, _, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {})
+	e := newTestExitNode(t, relayAddr, 0)
+	e.cfg.Listen = "127.0.0.1:0"
+	e.ohttpHandler = handler
+
+	go e.Start()
+	waitReady(t, e)
+	if err := e.Err(); err != nil {
+		t.Fatalf("Err() = %v, want nil", err)
+	}
+
+	addr := e.HTTPAddr()
+	if addr == "" {
+		t.Fatal("HTTPAddr() is empty, want configured HTTP server")
+	}
+	resp, err := http.Get("http://" + addr + "/ohttp-keys")
+	if err != nil {
+		t.Fatalf("GET /ohttp-keys failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/ohttp-keys" {
+		t.Errorf("GET /ohttp-keys = %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Stop 后 HTTP 服务关闭
+	e.Stop()
+	if _, err := http.Get("http://" + addr + "/ohttp-keys"); err == nil {
+		t.Error("HTTP server should be closed after Stop")
+	}
+}
+
+func TestExitNode_HTTPListenFailure(t *testing.T) {
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer occupied.Close()
+
+	e := newTestExitNode(t, "127.0.0.1:1", 0)
+	e.cfg.Listen = occupied.Addr().String()
+
+	if err := e.Start(); err == nil {
+		t.Fatal("Start should fail when the listen address is in use")
+	}
+	waitReady(t, e)
+	if e.Err() == nil {
+		t.Error("Err() = nil, want listen failure")
+	}
+}
+
+// newBackendCheckedExitNode 创建启用启动后端检查的 Exit，后端健康端点由 healthy 控制
+func newBackendCheckedExitNode(t *testing.T, relayAddr string, healthy *atomic.Bool) *ExitNode {
+	t.Helper()
+	handler, _, backend := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && healthy.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	handler.aiClient.SetHealthCheck(config.HealthCheck{Path: "/health"})
+
+	e := newTestExitNode(t, relayAddr, 0)
+	e.cfg.WaitForBackend = true
+	e.cfg.AIBackend.URL = backend.URL
+	e.ohttpHandler = handler
+	e.backendRetry = 10 * time.Millisecond
+	return e
+}
+
+func TestExitNode_WaitForBackendReachable(t *testing.T) {
+	relayAddr := startFakeRelay(t, protocol.NewRegisterAckMessage([]byte{protocol.ProtocolVersion}))
+	var healthy atomic.Bool
+	healthy.Store(true)
+	e := newBackendCheckedExitNode(t, relayAddr, &healthy)
+
+	go e.Start()
+	waitReady(t, e)
+	if err := e.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestExitNode_WaitForBackendDelaysRegistration(t *testing.T) {
+	relayAddr := startFakeRelay(t, protocol.NewRegisterAckMessage([]byte{protocol.ProtocolVersion}))
+	var healthy atomic.Bool
+	e := newBackendCheckedExitNode(t, relayAddr, &healthy)
+
+	go e.Start()
+
+	// 后端不可用时不注册
+	select {
+	case <-e.Ready():
+		t.Fatalf("后端不可用时不应就绪, Err() = %v", e.Err())
+	case <-time.After(100 * time.Millisecond):
+	}
+	if v := e.tunnel.ProtocolVersion(); v != 0 {
+		t.Errorf("后端就绪前不应注册到 Relay, ProtocolVersion() = %d", v)
+	}
+
+	// 后端恢复后完成注册
+	healthy.Store(true)
+	waitReady(t, e)
+	if err := e.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestExitNode_WaitForBackendStopped(t *testing.T) {
+	var healthy atomic.Bool
+	e := newBackendCheckedExitNode(t, "127.0.0.1:1", &healthy)
+
+	done := make(chan error, 1)
+	go func() { done <- e.Start() }()
+
+	time.Sleep(50 * time.Millisecond)
+	e.Stop()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrExitStopped) {
+			t.Errorf("Start() = %v, want ErrExitStopped", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop 应中断后端等待")
+	}
+}
+
+func TestExitNode_WaitForBackendHealthCheckDisabled(t *testing.T) {
+	relayAddr := startFakeRelay(t, protocol.NewRegisterAckMessage([]byte{protocol.ProtocolVersion}))
+	var healthy atomic.Bool
+	e := newBackendCheckedExitNode(t, relayAddr, &healthy)
+	e.cfg.AIBackend.HealthCheck.Disabled = true
+
+	go e.Start()
+	waitReady(t, e)
+	if err := e.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil when health check is disabled", err)
+	}
+}
+
+func TestNew_DHTModeAdvertisesInRegister(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "ohttp_private.key")
+	if _, _, err := crypto.EnsureKeyPair(keyFile, true); err != nil {
+		t.Fatalf("EnsureKeyPair failed: %v", err)
+	}
+	cfg := &config.ExitConfig{
+		OHTTPPrivateKeyFile: keyFile,
+		AIBackend:           config.AIBackend{URL: "http://127.0.0.1:1"},
+		DHT:                 config.DHTConfig{PrivateKeyFile: filepath.Join(dir, "identity.key")},
+		Advertise:           config.ExitAdvertise{Weight: 5, Models: []string{"gpt-4o", "llama3"}},
+	}
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { e.Stop() })
+	if e.dhtNode == nil {
+		t.Fatal("New should create a DHT-mode exit")
+	}
+
+	// DHT 模式的隧道向 Relay 注册时同样附带通告的权重和模型
+	relayAddr, received := startRecordingRelay(t, protocol.NewRegisterAckMessage([]byte{protocol.ProtocolVersion}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.tunnel.connectAndRegister(ctx, relayAddr, ""); err != nil {
+		t.Fatalf("connectAndRegister: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		_, meta, err := protocol.DecodeRegisterPayload(msg.Payload)
+		if err != nil {
+			t.Fatalf("DecodeRegisterPayload: %v", err)
+		}
+		if meta.Weight != 5 || !slices.Equal(meta.Models, cfg.Advertise.Models) {
+			t.Errorf("register metadata = weight %d models %v, want weight 5 models %v", meta.Weight, meta.Models, cfg.Advertise.Models)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not receive register message")
+	}
+}
+
+func TestExitNode_StopCancelsInflightBackendRequest(t *testing.T) {
+	started := make(chan struct{})
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body) // 读完请求体后服务端才能感知连接关闭
+		close(started)
+		<-r.Context().Done() // 模拟长时间生成的后端，直到连接被取消
+	})
+
+	e := newTestExitNode(t, "127.0.0.1:1", 0)
+	e.aiClients = []*AIClient{client}
+	e.shutdownGrace = 100 * time.Millisecond
+
+	result := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+		resp, err := client.Forward(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		result <- err
+	}()
+	<-started
+
+	start := time.Now()
+	e.Stop()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Stop took %v, want about the grace period", elapsed)
+	}
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("in-flight backend request should be cancelled")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("in-flight backend request not cancelled after grace period")
+	}
+}
@@ -0,0 +1,165 @@
+package exit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrQueueTimeout 请求排队等待后端并发配额超过 queue_timeout
+var ErrQueueTimeout = errors.New("等待后端并发配额超时")
+
+// fairScheduler 后端并发预算的按模型加权公平调度
+// 配额有空闲且无人排队时直接授予；否则按模型排队，配额释放时授予虚拟时间最小的模型 (同值时先到先得)
+// 每个模型获得一个配额后虚拟时间前进 1/weight，一个模型的突发请求只能按权重分得份额，不会饿死其他模型
+type fairScheduler struct {
+	mu           sync.Mutex
+	capacity     int
+	inUse        int
+	waiting      int
+	seq          uint64         // 排队序号，虚拟时间相同时先到先得
+	vtime        float64        // 最近一次授予配额时的虚拟时间
+	weights      map[string]int // 模型权重，未配置的模型为 1
+	models       map[string]*modelQueue
+	queueTimeout time.Duration // 排队等待上限，0 表示不限制
+}
+
+// modelQueue 单个模型的排队状态
+type modelQueue struct {
+	pass    float64 // 下一个配额的虚拟开始时间
+	waiters []*fairWaiter
+}
+
+type fairWaiter struct {
+	seq     uint64
+	ready   chan struct{}
+	granted bool // 已授予配额 (受 fairScheduler.mu 保护)
+}
+
+// newFairScheduler 创建公平调度器，capacity 为后端并发上限 (> 0)
+func newFairScheduler(capacity int, weights map[string]int) *fairScheduler {
+	return &fairScheduler{
+		capacity: capacity,
+		weights:  weights,
+		models:   make(map[string]*modelQueue),
+	}
+}
+
+// Acquire 为模型申请一个并发配额，返回释放函数 (可重复调用)
+// ctx 取消或 shutdown 结束时放弃排队并返回对应错误，排队超过 queueTimeout 时返回 ErrQueueTimeout
+func (s *fairScheduler) Acquire(ctx, shutdown context.Context, model string) (func(), error) {
+	s.mu.Lock()
+	q := s.queue(model)
+	if s.inUse < s.capacity && s.waiting == 0 {
+		s.grant(model, q)
+		s.mu.Unlock()
+		return sync.OnceFunc(s.release), nil
+	}
+	s.seq++
+	w := &fairWaiter{seq: s.seq, ready: make(chan struct{})}
+	q.waiters = append(q.waiters, w)
+	s.waiting++
+	s.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if s.queueTimeout > 0 {
+		timer := time.NewTimer(s.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-w.ready:
+		return sync.OnceFunc(s.release), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-shutdown.Done():
+		err = shutdown.Err()
+	case <-timeout:
+		err = fmt.Errorf("%w (%v)", ErrQueueTimeout, s.queueTimeout)
+	}
+
+	s.mu.Lock()
+	if w.granted {
+		// 放弃前已被授予配额，归还给其他排队者
+		s.mu.Unlock()
+		s.release()
+		return nil, err
+	}
+	for i, qw := range q.waiters {
+		if qw == w {
+			q.waiters = append(q.waiters[:i:i], q.waiters[i+1:]...)
+			break
+		}
+	}
+	s.waiting--
+	s.mu.Unlock()
+	return nil, err
+}
+
+// queue 返回模型的排队状态 (调用者需持有 mu)
+// 模型空闲后重新排队时虚拟时间不低于全局虚拟时间，空闲期间不积累份额
+func (s *fairScheduler) queue(model string) *modelQueue {
+	q, ok := s.models[model]
+	if !ok {
+		q = &modelQueue{}
+		s.models[model] = q
+	}
+	if len(q.waiters) == 0 && q.pass < s.vtime {
+		q.pass = s.vtime
+	}
+	return q
+}
+
+// grant 为模型授予一个配额并推进其虚拟时间 (调用者需持有 mu)
+func (s *fairScheduler) grant(model string, q *modelQueue) {
+	s.inUse++
+	s.vtime = q.pass
+	weight := s.weights[model]
+	if weight <= 0 {
+		weight = 1
+	}
+	q.pass += 1 / float64(weight)
+}
+
+// release 归还配额，并按虚拟时间授予排队的模型
+func (s *fairScheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inUse--
+
+	for s.inUse < s.capacity && s.waiting > 0 {
+		var next string
+		var nq *modelQueue
+		for model, q := range s.models {
+			if len(q.waiters) == 0 {
+				continue
+			}
+			if nq == nil || q.pass < nq.pass || (q.pass == nq.pass && q.waiters[0].seq < nq.waiters[0].seq) {
+				next, nq = model, q
+			}
+		}
+		w := nq.waiters[0]
+		nq.waiters = nq.waiters[1:]
+		s.waiting--
+		w.granted = true
+		s.grant(next, nq)
+		close(w.ready)
+	}
+
+	// 无人排队时不存在竞争，重置调度状态；否则清理空闲且不再领先全局虚拟时间的模型 (重新排队时状态相同)
+	// 模型名来自请求，避免无限增长
+	if s.waiting == 0 {
+		clear(s.models)
+		s.vtime = 0
+		return
+	}
+	for model, q := range s.models {
+		if len(q.waiters) == 0 && q.pass <= s.vtime {
+			delete(s.models, model)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package exit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// grantOrder 占满唯一配额后按顺序排队 burst，再逐个释放，返回排队请求获得配额的顺序
+func grantOrder(t *testing.T, weights map[string]int, burst ...string) string {
+	t.Helper()
+	s := newFairScheduler(1, weights)
+	ctx := context.Background()
+	hold, err := s.Acquire(ctx, ctx, "A")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	type grant struct {
+		model   string
+		release func()
+	}
+	granted := make(chan grant)
+	for i, model := range burst {
+		go func() {
+			release, err := s.Acquire(ctx, ctx, model)
+			if err != nil {
+				t.Errorf("Acquire(%s): %v", model, err)
+				return
+			}
+			granted <- grant{model, release}
+		}()
+		waitQueued(t, s, i+1)
+	}
+
+	var order strings.Builder
+	hold()
+	for range burst {
+		select {
+		case g := <-granted:
+			order.WriteString(g.model)
+			g.release()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("queued request not granted, order so far %q", order.String())
+		}
+	}
+	return order.String()
+}
+
+// waitQueued 等待排队请求数达到 n
+func waitQueued(t *testing.T, s *fairScheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		waiting := s.waiting
+		s.mu.Unlock()
+		if waiting == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("waiting = %d, want %d", waiting, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFairScheduler_BurstDoesNotStarveOtherModel(t *testing.T) {
+	// 模型 A 的突发请求先排队，随后到达的 B 与 A 交替获得配额，而不是排在整个突发之后
+	if got := grantOrder(t, nil, "A", "A", "A", "A", "A", "B", "B", "B"); got != "BABABAAA" {
+		t.Errorf("grant order = %s, want BABABAAA", got)
+	}
+	// 权重 2 的模型在竞争时获得两倍份额
+	if got := grantOrder(t, map[string]int{"B": 2}, "A", "A", "A", "A", "B", "B", "B", "B"); got != "BBABBAAA" {
+		t.Errorf("weighted grant order = %s, want BBABBAAA", got)
+	}
+}
+
+func TestFairScheduler_CancelWhileQueued(t *testing.T) {
+	s := newFairScheduler(1, nil)
+	bg := context.Background()
+	hold, _ := s.Acquire(bg, bg, "A")
+
+	ctx, cancel := context.WithCancel(bg)
+	errc := make(chan error)
+	go func() {
+		_, err := s.Acquire(ctx, bg, "B")
+		errc <- err
+	}()
+	waitQueued(t, s, 1)
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire after cancel = %v, want context.Canceled", err)
+	}
+
+	// 取消的排队者不占用配额，释放后新请求直接获得配额
+	hold()
+	hold() // 重复调用无效
+	release, err := s.Acquire(bg, bg, "C")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	release()
+	if s.inUse != 0 || s.waiting != 0 || len(s.models) != 0 {
+		t.Errorf("scheduler state after release: inUse=%d waiting=%d models=%d, want all 0", s.inUse, s.waiting, len(s.models))
+	}
+}
+
+func TestAIClient_ConcurrencyFairAcrossModels(t *testing.T) {
+	arrived := make(chan string, 16)
+	unblock := make(chan struct{})
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		arrived <- extractModel(body)
+		<-unblock
+		w.WriteHeader(http.StatusOK)
+	})
+	client.SetConcurrency(1, nil)
+
+	forward := func(model string) {
+		req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"`+model+`"}`))
+		resp, err := client.Forward(req)
+		if err != nil {
+			t.Errorf("Forward(%s): %v", model, err)
+			return
+		}
+		resp.Body.Close()
+	}
+
+	// 模型 a 的一个请求占用唯一配额，a 的突发请求先排队，b 的请求随后到达
+	go forward("a")
+	<-arrived
+	burst := []string{"a", "a", "a", "b"}
+	for i, model := range burst {
+		go forward(model)
+		waitQueued(t, client.scheduler, i+1)
+	}
+	close(unblock)
+
+	var order strings.Builder
+	for range burst {
+		select {
+		case model := <-arrived:
+			order.WriteString(model)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("queued request did not reach the backend, order so far %q", order.String())
+		}
+	}
+	if got := order.String(); got != "baaa" {
+		t.Errorf("backend arrival order = %s, want b before the rest of the a burst", got)
+	}
+}
+
+func TestFairScheduler_QueueTimeout(t *testing.T) {
+	s := newFairScheduler(1, nil)
+	s.queueTimeout = 50 * time.Millisecond
+	bg := context.Background()
+	hold, _ := s.Acquire(bg, bg, "A")
+
+	// 配额一直被占用: 超过排队上限后拒绝，而不是无限等待
+	start := time.Now()
+	if _, err := s.Acquire(bg, bg, "B"); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("Acquire while saturated = %v, want ErrQueueTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < s.queueTimeout {
+		t.Errorf("rejected after %v, want at least %v", elapsed, s.queueTimeout)
+	}
+
+	// 排队期间配额释放: 在上限内获得配额
+	granted := make(chan error)
+	go func() {
+		release, err := s.Acquire(bg, bg, "C")
+		if err == nil {
+			release()
+		}
+		granted <- err
+	}()
+	waitQueued(t, s, 1)
+	hold()
+	if err := <-granted; err != nil {
+		t.Fatalf("Acquire released in time = %v, want nil", err)
+	}
+	if s.inUse != 0 || s.waiting != 0 {
+		t.Errorf("scheduler state: inUse=%d waiting=%d, want 0", s.inUse, s.waiting)
+	}
+}
+
+func TestAIClient_QueueTimeoutRejectsRequest(t *testing.T) {
+	arrived := make(chan struct{}, 4)
+	unblock := make(chan struct{})
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-unblock
+		w.WriteHeader(http.StatusOK)
+	})
+	client.SetQueueTimeout(50 * time.Millisecond)
+	client.SetConcurrency(1, nil)
+
+	forward := func() error {
+		req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+		resp, err := client.Forward(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// 慢请求占用唯一配额，排队的请求超时后被拒绝，不会到达后端
+	first := make(chan error, 1)
+	go func() { first <- forward() }()
+	<-arrived
+	if err := forward(); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("queued Forward = %v, want ErrQueueTimeout", err)
+	}
+	if len(arrived) != 0 {
+		t.Error("timed out request reached the backend")
+	}
+
+	// 配额在上限内释放时，排队的请求正常转发
+	queued := make(chan error, 1)
+	go func() { queued <- forward() }()
+	waitQueued(t, client.scheduler, 1)
+	close(unblock)
+	if err := <-first; err != nil {
+		t.Fatalf("first Forward: %v", err)
+	}
+	if err := <-queued; err != nil {
+		t.Errorf("Forward started in time = %v, want nil", err)
+	}
+}
@@ -0,0 +1,93 @@
+package exit
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// 响应头限制默认值
+const (
+	defaultMaxResponseHeaders     = 100
+	defaultMaxResponseHeaderBytes = 64 * 1024
+)
+
+// essentialResponseHeaders 始终保留的响应头 (不计入丢弃候选)
+// 压缩头排在最前: 丢弃后 Client 无法还原响应体
+var essentialResponseHeaders = []string{protocol.CompressionHeader, "Content-Type", "Content-Length", "Content-Encoding"}
+
+// HeaderLimit 转发给 Client 的响应头数量/大小上限
+type HeaderLimit struct {
+	MaxCount int // 最大 header 行数
+	MaxBytes int // 最大 header 总字节数 (name + value)
+}
+
+// limitResponseHeaders 按上限裁剪响应头，超出部分丢弃并记录警告
+// 必要 header 优先保留，其余按名称排序后依次保留直到达到上限
+func limitResponseHeaders(h http.Header, limit HeaderLimit) {
+	count, size := 0, 0
+	fits := func(key, value string) bool {
+		n := len(key) + len(value)
+		if count+1 > limit.MaxCount || size+n > limit.MaxBytes {
+			return false
+		}
+		count++
+		size += n
+		return true
+	}
+
+	kept := make(http.Header, len(h))
+	dropped := 0
+	for _, key := range essentialResponseHeaders {
+		for _, v := range h.Values(key) {
+			if fits(key, v) {
+				kept.Add(key, v)
+			} else {
+				dropped++
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		if _, ok := kept[key]; ok || isEssentialResponseHeader(key) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, v := range h[key] {
+			if fits(key, v) {
+				kept[key] = append(kept[key], v)
+			} else {
+				dropped++
+			}
+		}
+	}
+
+	if dropped == 0 {
+		return
+	}
+
+	log.Printf("警告: AI 后端响应头超出限制 (%d 行 / %d 字节)，已丢弃 %d 行", limit.MaxCount, limit.MaxBytes, dropped)
+	for key := range h {
+		delete(h, key)
+	}
+	for key, values := range kept {
+		h[key] = values
+	}
+}
+
+// isEssentialResponseHeader 检查是否为始终保留的响应头
+func isEssentialResponseHeader(key string) bool {
+	for _, k := range essentialResponseHeaders {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package exit
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLimitResponseHeaders_WithinLimit(t *testing.T) {
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Request-ID", "abc")
+
+	limitResponseHeaders(h, HeaderLimit{MaxCount: 10, MaxBytes: 1024})
+
+	if len(h) != 2 {
+		t.Errorf("len(h) = %d, want 2", len(h))
+	}
+}
+
+func TestLimitResponseHeaders_CountCapped(t *testing.T) {
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	h.Set("X-A", "1")
+	h.Set("X-B", "2")
+	h.Set("X-C", "3")
+
+	limitResponseHeaders(h, HeaderLimit{MaxCount: 2, MaxBytes: 1024})
+
+	if h.Get("Content-Type") != "application/json" {
+		t.Error("Content-Type should be kept first")
+	}
+	if h.Get("X-A") != "1" {
+		t.Error("X-A should be kept (sorted first)")
+	}
+	if h.Get("X-B") != "" || h.Get("X-C") != "" {
+		t.Errorf("X-B/X-C should be dropped, got %v", h)
+	}
+}
+
+func TestLimitResponseHeaders_BytesCapped(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Small", "ok")
+	h.Set("X-Huge", strings.Repeat("x", 10000))
+
+	limitResponseHeaders(h, HeaderLimit{MaxCount: 100, MaxBytes: 100})
+
+	if h.Get("X-Huge") != "" {
+		t.Error("X-Huge should be dropped")
+	}
+	if h.Get("X-Small") != "ok" {
+		t.Error("X-Small should be kept")
+	}
+}
+
+func TestOHTTPHandler_SetHeaderLimit_Defaults(t *testing.T) {
+	h := &OHTTPHandler{}
+	h.SetHeaderLimit(HeaderLimit{})
+
+	if h.headerLimit.MaxCount != defaultMaxResponseHeaders || h.headerLimit.MaxBytes != defaultMaxResponseHeaderBytes {
+		t.Errorf("headerLimit = %+v, want defaults", h.headerLimit)
+	}
+}
@@ -0,0 +1,166 @@
+package exit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/binn/tokengo/pkg/openai"
+)
+
+// modelsPath 后端列出可用模型的端点 (OpenAI 兼容)
+const modelsPath = "/v1/models"
+
+const (
+	// defaultModelsRefresh 刷新后端模型列表的默认间隔
+	defaultModelsRefresh = 10 * time.Minute
+	// modelsQueryTimeout 单次查询后端模型列表的超时
+	modelsQueryTimeout = 10 * time.Second
+)
+
+// ListModels 查询后端 GET /v1/models 返回的模型 ID，依次尝试各实例 (健康的在前)，任一实例成功即返回
+func (c *AIClient) ListModels(ctx context.Context) ([]string, error) {
+	var errs []error
+	for _, b := range c.candidates() {
+		models, err := c.listModels(ctx, b.url)
+		if err == nil {
+			return models, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// listModels 查询单个后端实例的模型列表
+func (c *AIClient) listModels(ctx context.Context, baseURL string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, modelsQueryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+modelsPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建模型列表请求失败: %w", err)
+	}
+	c.injectAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("AI 后端不可达: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("查询模型列表失败: GET %s 返回 %d", modelsPath, resp.StatusCode)
+	}
+
+	var list openai.ModelList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("解析模型列表失败: %w", err)
+	}
+	models := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		if m.ID != "" {
+			models = append(models, m.ID)
+		}
+	}
+	return models, nil
+}
+
+// ModelDiscovery 从各 AI 后端查询可服务的模型，与配置的 advertise.models 合并为 Exit 通告的模型列表
+// 某个后端查询失败时沿用其上次成功查询的结果
+type ModelDiscovery struct {
+	clients []*AIClient
+	static  []string // 配置的 advertise.models
+
+	mu         sync.Mutex
+	discovered [][]string // 各后端最近一次成功查询的模型 (与 clients 一一对应)
+	models     []string   // 当前通告的模型 (排序去重)
+}
+
+// NewModelDiscovery 创建后端模型发现，static 为配置中固定通告的模型
+func NewModelDiscovery(clients []*AIClient, static []string) *ModelDiscovery {
+	return &ModelDiscovery{
+		clients:    clients,
+		static:     static,
+		discovered: make([][]string, len(clients)),
+		models:     mergeModels(static),
+	}
+}
+
+// Models 返回当前通告的模型
+func (d *ModelDiscovery) Models() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.models
+}
+
+// Refresh 查询所有后端的模型列表并更新通告的模型，返回列表是否变化
+// 部分后端查询失败时仍更新其余后端的结果，并返回合并后的错误
+func (d *ModelDiscovery) Refresh(ctx context.Context) (changed bool, err error) {
+	var errs []error
+	results := make([][]string, len(d.clients))
+	for i, c := range d.clients {
+		models, err := c.ListModels(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		results[i] = models
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, models := range results {
+		if models != nil {
+			d.discovered[i] = models
+		}
+	}
+	merged := mergeModels(append([][]string{d.static}, d.discovered...)...)
+	changed = !slices.Equal(merged, d.models)
+	d.models = merged
+	return changed, errors.Join(errs...)
+}
+
+// Start 在后台按 interval 定期刷新 (interval <= 0 时使用默认间隔)，列表变化时调用 onChange，ctx 取消时停止
+func (d *ModelDiscovery) Start(ctx context.Context, interval time.Duration, onChange func(models []string)) {
+	if interval <= 0 {
+		interval = defaultModelsRefresh
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				changed, err := d.Refresh(ctx)
+				if err != nil {
+					log.Printf("警告: 刷新后端模型列表失败: %v", err)
+				}
+				if changed {
+					onChange(d.Models())
+				}
+			}
+		}
+	}()
+}
+
+// mergeModels 合并多个模型列表，返回排序去重后的结果 (全部为空时返回 nil)
+func mergeModels(lists ...[]string) []string {
+	var merged []string
+	for _, models := range lists {
+		merged = append(merged, models...)
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	slices.Sort(merged)
+	return slices.Compact(merged)
+}
@@ -0,0 +1,148 @@
+package exit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// modelsBackend 返回可修改模型列表的 /v1/models 后端，down 为 true 时返回 503
+type modelsBackend struct {
+	mu     sync.Mutex
+	models []string
+	down   bool
+	auth   string // 最近一次请求的 Authorization 头
+}
+
+func (b *modelsBackend) set(down bool, models ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.down, b.models = down, models
+}
+
+func (b *modelsBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.auth = r.Header.Get("Authorization")
+	if r.URL.Path != modelsPath || b.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	data := make([]string, len(b.models))
+	for i, m := range b.models {
+		data[i] = fmt.Sprintf(`{"id":%q,"object":"model"}`, m)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"object":"list","data":[%s]}`, strings.Join(data, ","))
+}
+
+func startModelsBackend(t *testing.T, models ...string) (*modelsBackend, *AIClient) {
+	t.Helper()
+	b := &modelsBackend{models: models}
+	server := httptest.NewServer(b)
+	t.Cleanup(server.Close)
+	return b, NewAIClient(server.URL, "sk-test", nil)
+}
+
+func TestAIClient_ListModels(t *testing.T) {
+	b, client := startModelsBackend(t, "gpt-4o", "gpt-4o-mini")
+
+	models, err := client.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if !slices.Equal(models, []string{"gpt-4o", "gpt-4o-mini"}) {
+		t.Errorf("models = %v", models)
+	}
+	b.mu.Lock()
+	auth := b.auth
+	b.mu.Unlock()
+	if auth != "Bearer sk-test" {
+		t.Errorf("Authorization = %q, want the backend api key", auth)
+	}
+
+	b.set(true)
+	if _, err := client.ListModels(context.Background()); err == nil {
+		t.Error("ListModels should fail when the backend returns 503")
+	}
+}
+
+func TestModelDiscovery_Refresh(t *testing.T) {
+	b1, c1 := startModelsBackend(t, "gpt-4o")
+	_, c2 := startModelsBackend(t, "llama3:8b", "gpt-4o")
+
+	d := NewModelDiscovery([]*AIClient{c1, c2}, []string{"claude-*"})
+	if got := d.Models(); !slices.Equal(got, []string{"claude-*"}) {
+		t.Fatalf("initial models = %v, want the configured models", got)
+	}
+
+	// 合并配置的模型和各后端的结果，排序去重
+	changed, err := d.Refresh(context.Background())
+	if err != nil || !changed {
+		t.Fatalf("Refresh = %v, %v; want changed", changed, err)
+	}
+	want := []string{"claude-*", "gpt-4o", "llama3:8b"}
+	if got := d.Models(); !slices.Equal(got, want) {
+		t.Errorf("models = %v, want %v", got, want)
+	}
+
+	// 列表未变化
+	if changed, _ := d.Refresh(context.Background()); changed {
+		t.Error("Refresh reported a change for an identical list")
+	}
+
+	// 后端新增模型
+	b1.set(false, "gpt-4o", "o1")
+	if changed, _ := d.Refresh(context.Background()); !changed {
+		t.Error("Refresh should report the new model")
+	}
+	if got := d.Models(); !slices.Contains(got, "o1") {
+		t.Errorf("models = %v, want o1 included", got)
+	}
+
+	// 查询失败时沿用上次的结果
+	b1.set(true)
+	changed, err = d.Refresh(context.Background())
+	if err == nil || changed {
+		t.Errorf("Refresh = %v, %v; want an error and no change", changed, err)
+	}
+	if got := d.Models(); !slices.Contains(got, "o1") {
+		t.Errorf("models = %v, want the previous result kept", got)
+	}
+}
+
+func TestModelDiscovery_StartNotifiesChanges(t *testing.T) {
+	b, client := startModelsBackend(t, "gpt-4o")
+	d := NewModelDiscovery([]*AIClient{client}, nil)
+	if _, err := d.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []string, 4)
+	d.Start(ctx, 10*time.Millisecond, func(models []string) { updates <- models })
+
+	b.set(false, "gpt-4o", "gpt-4.1")
+	select {
+	case got := <-updates:
+		if !slices.Equal(got, []string{"gpt-4.1", "gpt-4o"}) {
+			t.Errorf("onChange models = %v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("onChange was not called after the backend list changed")
+	}
+
+	// 列表不变时不再通知
+	select {
+	case got := <-updates:
+		t.Errorf("unexpected onChange with %v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
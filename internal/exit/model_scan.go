@@ -0,0 +1,161 @@
+package exit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+const (
+	// modelPeekSize 分块上传的请求体查找 model 时最多读取的前缀 (读取后放回，不整体缓存)
+	modelPeekSize = 64 << 10
+	// maxModelFieldSize multipart 表单 model 字段的最大长度
+	maxModelFieldSize = 1 << 10
+)
+
+// scanModel 流式扫描 JSON 请求体的顶层 model 字段，找到后立即返回，不解析其后的内容
+// model 在前的大请求体 (如长 messages) 只需扫描开头几十字节；model 在后时需逐个缓冲跳过的值，开销高于完整解析
+// ok=false 表示扫描未得出结论 (非对象、语法错误、model 非字符串)，调用方应回退完整解析
+func scanModel(body []byte) (model string, ok bool) {
+	return scanField(body, "model")
+}
+
+// scanField 流式扫描 JSON 对象的顶层字符串字段 name，语义同 scanModel
+// body 可以是截断的前缀: 字段出现在截断位置之前即可得出结果
+func scanField(body []byte, name string) (value string, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return "", false
+	}
+
+	var skip json.RawMessage
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", false
+		}
+		key, isKey := tok.(string)
+		if !isKey {
+			return "", false
+		}
+		// 与 json.Unmarshal 的字段匹配一致: 键名不区分大小写
+		if strings.EqualFold(key, name) {
+			if err := dec.Decode(&value); err != nil {
+				return "", false
+			}
+			return value, true
+		}
+		// 跳过其他字段的值 (复用缓冲区，嵌套对象中的同名字段不参与匹配)
+		if err := dec.Decode(&skip); err != nil {
+			return "", false
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return "", false
+	}
+	return "", true
+}
+
+// extractModel 提取请求体中的 model 字段，流式扫描失败时回退完整解析
+func extractModel(body []byte) string {
+	if model, ok := scanModel(body); ok {
+		return model
+	}
+	var partial struct {
+		Model string `json:"model"`
+	}
+	if json.Unmarshal(body, &partial) != nil {
+		return ""
+	}
+	return partial.Model
+}
+
+// requestModel 返回请求指定的模型: Gemini 风格路径 (/models/<name>:<method>) 中的模型优先，
+// 其次为 JSON 请求体顶层或 multipart 表单的 model 字段；读取的请求体随后还原
+// 分块上传的请求体只检查前 modelPeekSize 字节，且保持 *uploadBody 不变 (仍边收边转发)
+// hasBody=false 表示请求不带请求体
+func requestModel(req *http.Request) (model string, hasBody bool, err error) {
+	if model := pathModel(req.URL.Path); model != "" {
+		return model, true, nil
+	}
+	body, complete, err := peekBody(req)
+	if err != nil || len(body) == 0 {
+		return "", false, err
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		return multipartModel(body, params["boundary"]), true, nil
+	}
+	if complete {
+		return extractModel(body), true, nil
+	}
+	model, _ = scanModel(body)
+	return model, true, nil
+}
+
+// peekBody 读取请求体用于查找 model 并还原: 内存中的请求体 (已解密的完整消息) 整体读取，
+// 分块上传的请求体只读取前缀并放回 uploadBody；complete 表示返回的是完整请求体
+func peekBody(req *http.Request) (body []byte, complete bool, err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	if upload, ok := req.Body.(*uploadBody); ok {
+		prefix, err := io.ReadAll(io.LimitReader(upload, modelPeekSize+1))
+		upload.unread(prefix)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(prefix) > modelPeekSize {
+			return prefix[:modelPeekSize], false, nil
+		}
+		return prefix, true, nil
+	}
+
+	body, err = io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, false, fmt.Errorf("读取请求体失败: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true, nil
+}
+
+// multipartModel 返回 multipart 表单的 model 字段 (如音频转写)，model 位于读取的前缀之外时返回空串
+func multipartModel(body []byte, boundary string) string {
+	if boundary == "" {
+		return ""
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return ""
+		}
+		if part.FormName() == "model" {
+			value, err := io.ReadAll(io.LimitReader(part, maxModelFieldSize))
+			if err != nil {
+				return ""
+			}
+			return strings.TrimSpace(string(value))
+		}
+	}
+}
+
+// pathModel 返回 Gemini 风格路径中的模型 (如 /v1beta/models/gemini-pro:generateContent)，不含时返回空串
+func pathModel(p string) string {
+	_, rest, ok := strings.Cut(p, "/models/")
+	if !ok {
+		return ""
+	}
+	model, _, ok := strings.Cut(rest, ":")
+	if !ok {
+		return ""
+	}
+	return model
+}
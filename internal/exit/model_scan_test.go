@@ -0,0 +1,101 @@
+package exit
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestScanModel(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		model string
+		ok    bool
+	}{
+		{"首个字段", `{"model":"gpt-4o","messages":[]}`, "gpt-4o", true},
+		{"后置字段", `{"messages":[{"role":"user","content":"hi"}],"stream":true,"model":"llama3"}`, "llama3", true},
+		{"嵌套 model 不匹配", `{"meta":{"model":"inner"},"model":"outer"}`, "outer", true},
+		{"转义字符", `{"model":"a\"bé"}`, "a\"bé", true},
+		{"键名大小写", `{"Model":"gpt-4o"}`, "gpt-4o", true},
+		{"null", `{"model":null}`, "", true},
+		{"无 model", `{"messages":[]}`, "", true},
+		{"model 非字符串", `{"model":42}`, "", false},
+		{"非对象", `["model","gpt-4o"]`, "", false},
+		{"非 JSON", `binary`, "", false},
+		{"model 前语法错误", `{"messages":[,"model":"x"}`, "", false},
+		{"截断", `{"messages":[]`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, ok := scanModel([]byte(tt.body))
+			if model != tt.model || ok != tt.ok {
+				t.Errorf("scanModel(%s) = %q, %v, want %q, %v", tt.body, model, ok, tt.model, tt.ok)
+			}
+		})
+	}
+}
+
+func TestExtractModel(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{`{"model":"gpt-4o","messages":[]}`, "gpt-4o"},
+		// model 之后的内容不会被扫描
+		{`{"model":"gpt-4o","messages":[`, "gpt-4o"},
+		{`{"model":42}`, ""},
+		{`binary`, ""},
+		{``, ""},
+	}
+	for _, tt := range tests {
+		if got := extractModel([]byte(tt.body)); got != tt.want {
+			t.Errorf("extractModel(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+// largeChatBody 构造 model 在前、messages 很大的请求体
+func largeChatBody(b testing.TB) []byte {
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	msgs := make([]message, 2000)
+	for i := range msgs {
+		msgs[i] = message{Role: "user", Content: strings.Repeat("lorem ipsum ", 40)}
+	}
+	// 结构体按字段顺序编码，保证 model 在前 (map 会按键名排序)
+	body, err := json.Marshal(struct {
+		Model    string    `json:"model"`
+		Messages []message `json:"messages"`
+	}{"gpt-4o", msgs})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return body
+}
+
+func BenchmarkExtractModel_Scan(b *testing.B) {
+	body := largeChatBody(b)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if extractModel(body) != "gpt-4o" {
+			b.Fatal("model 不匹配")
+		}
+	}
+}
+
+func BenchmarkExtractModel_Unmarshal(b *testing.B) {
+	body := largeChatBody(b)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var partial struct {
+			Model string `json:"model"`
+		}
+		if json.Unmarshal(body, &partial) != nil || partial.Model != "gpt-4o" {
+			b.Fatal("model 不匹配")
+		}
+	}
+}
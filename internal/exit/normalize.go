@@ -0,0 +1,181 @@
+package exit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/binn/tokengo/internal/config"
+)
+
+// syntheticUsage 后端未返回 usage 时补全的零值用量
+var syntheticUsage = json.RawMessage(`{"prompt_tokens":0,"completion_tokens":0,"total_tokens":0}`)
+
+// ResponseNormalizer 将非标准后端的响应改写为 OpenAI 规范格式
+// 改写 choices[].finish_reason，并可为缺少 usage 的非流式响应补全 usage
+type ResponseNormalizer struct {
+	finishReasons   map[string]string
+	synthesizeUsage bool
+}
+
+// NewResponseNormalizer 创建响应归一化器，未配置任何规则时返回 nil
+func NewResponseNormalizer(cfg config.Normalize) *ResponseNormalizer {
+	if len(cfg.FinishReasons) == 0 && !cfg.SynthesizeUsage {
+		return nil
+	}
+	return &ResponseNormalizer{
+		finishReasons:   cfg.FinishReasons,
+		synthesizeUsage: cfg.SynthesizeUsage,
+	}
+}
+
+// NormalizeResponse 改写 2xx 响应: SSE 响应逐个事件改写，JSON 响应读入内存后整体改写
+// 非流式响应体应已受 max_response_bytes 约束
+func (n *ResponseNormalizer) NormalizeResponse(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil
+	}
+
+	if IsSSEResponse(resp) {
+		resp.Body = &sseNormalizer{src: bufio.NewReader(resp.Body), closer: resp.Body, n: n}
+		return nil
+	}
+	if !strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "json") {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("读取响应体失败: %w", err)
+	}
+	body = n.Normalize(body, false)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// Normalize 改写单个响应对象 (stream 为 true 时是 SSE 数据块，不补全 usage)
+// 非 JSON 对象或无需改写时原样返回
+func (n *ResponseNormalizer) Normalize(body []byte, stream bool) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return body
+	}
+
+	changed := false
+	if len(n.finishReasons) > 0 {
+		if choices, ok := n.normalizeChoices(fields["choices"]); ok {
+			fields["choices"] = choices
+			changed = true
+		}
+	}
+
+	// 只为包含 choices 的补全响应补全 usage，避免改写错误响应或其他接口的响应
+	if n.synthesizeUsage && !stream {
+		if _, hasChoices := fields["choices"]; hasChoices && isNullOrMissing(fields["usage"]) {
+			fields["usage"] = syntheticUsage
+			changed = true
+		}
+	}
+
+	if !changed {
+		return body
+	}
+	newBody, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return newBody
+}
+
+// normalizeChoices 按映射改写 choices[].finish_reason，有改写时返回新的 choices
+func (n *ResponseNormalizer) normalizeChoices(raw json.RawMessage) (json.RawMessage, bool) {
+	var choices []map[string]json.RawMessage
+	if len(raw) == 0 || json.Unmarshal(raw, &choices) != nil {
+		return nil, false
+	}
+
+	changed := false
+	for _, choice := range choices {
+		var reason string
+		if json.Unmarshal(choice["finish_reason"], &reason) != nil {
+			continue
+		}
+		canonical, ok := n.finishReasons[reason]
+		if !ok || canonical == reason {
+			continue
+		}
+		choice["finish_reason"], _ = json.Marshal(canonical)
+		changed = true
+	}
+	if !changed {
+		return nil, false
+	}
+
+	newRaw, err := json.Marshal(choices)
+	if err != nil {
+		return nil, false
+	}
+	return newRaw, true
+}
+
+// isNullOrMissing 判断 JSON 字段是否缺失或为 null
+func isNullOrMissing(raw json.RawMessage) bool {
+	return len(raw) == 0 || bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// sseNormalizer 逐行读取 SSE 响应，改写 data 行中的 JSON 数据块
+type sseNormalizer struct {
+	src     *bufio.Reader
+	closer  io.Closer
+	n       *ResponseNormalizer
+	pending []byte
+	err     error
+}
+
+func (s *sseNormalizer) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		var line []byte
+		line, s.err = s.src.ReadBytes('\n')
+		s.pending = s.normalizeLine(line)
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *sseNormalizer) Close() error {
+	return s.closer.Close()
+}
+
+// normalizeLine 改写 "data: {...}" 行，保留原有的行尾
+func (s *sseNormalizer) normalizeLine(line []byte) []byte {
+	content := bytes.TrimRight(line, "\r\n")
+	data, ok := bytes.CutPrefix(content, []byte("data:"))
+	if !ok {
+		return line
+	}
+	payload := bytes.TrimSpace(data)
+	if len(payload) == 0 || payload[0] != '{' {
+		return line
+	}
+
+	normalized := s.n.Normalize(payload, true)
+	if bytes.Equal(normalized, payload) {
+		return line
+	}
+	out := make([]byte, 0, len(normalized)+len(line)-len(payload)+1)
+	out = append(out, "data: "...)
+	out = append(out, normalized...)
+	return append(out, line[len(content):]...)
+}
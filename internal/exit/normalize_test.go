@@ -0,0 +1,150 @@
+package exit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/binn/tokengo/internal/config"
+)
+
+func newTestNormalizer(t *testing.T) *ResponseNormalizer {
+	t.Helper()
+	n := NewResponseNormalizer(config.Normalize{
+		FinishReasons:   map[string]string{"stop_sequence": "stop", "max_tokens": "length"},
+		SynthesizeUsage: true,
+	})
+	if n == nil {
+		t.Fatal("NewResponseNormalizer returned nil for non-empty config")
+	}
+	return n
+}
+
+func TestNewResponseNormalizer_Empty(t *testing.T) {
+	if n := NewResponseNormalizer(config.Normalize{}); n != nil {
+		t.Error("empty config should disable normalization")
+	}
+}
+
+func TestResponseNormalizer_FinishReason(t *testing.T) {
+	n := newTestNormalizer(t)
+
+	body := n.Normalize([]byte(`{"choices":[{"index":0,"finish_reason":"stop_sequence"},{"index":1,"finish_reason":"max_tokens"},{"index":2,"finish_reason":"stop"}],"usage":{"total_tokens":3}}`), false)
+
+	var resp struct {
+		Choices []struct {
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("normalized body invalid: %v", err)
+	}
+	want := []string{"stop", "length", "stop"}
+	for i, c := range resp.Choices {
+		if c.FinishReason != want[i] {
+			t.Errorf("choices[%d].finish_reason = %q, want %q", i, c.FinishReason, want[i])
+		}
+	}
+	if resp.Usage.TotalTokens != 3 {
+		t.Errorf("existing usage overwritten: %s", body)
+	}
+}
+
+func TestResponseNormalizer_SynthesizeUsage(t *testing.T) {
+	n := newTestNormalizer(t)
+
+	for _, in := range []string{
+		`{"choices":[{"finish_reason":"stop"}]}`,
+		`{"choices":[{"finish_reason":"stop"}],"usage":null}`,
+	} {
+		body := n.Normalize([]byte(in), false)
+		var resp map[string]json.RawMessage
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("normalized body invalid: %v", err)
+		}
+		if string(resp["usage"]) != string(syntheticUsage) {
+			t.Errorf("Normalize(%s) usage = %s, want %s", in, resp["usage"], syntheticUsage)
+		}
+	}
+
+	// 流式数据块、错误响应和非 JSON 响应不补全
+	for _, in := range []string{`{"choices":[{"delta":{}}]}`, `{"error":{"message":"x"}}`, `not json`} {
+		stream := strings.Contains(in, "delta")
+		if got := n.Normalize([]byte(in), stream); string(got) != in {
+			t.Errorf("Normalize(%s) = %s, want unchanged", in, got)
+		}
+	}
+}
+
+func TestResponseNormalizer_SSE(t *testing.T) {
+	n := newTestNormalizer(t)
+
+	events := "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"},\"finish_reason\":null}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop_sequence\"}]}\r\n\r\n" +
+		"data: [DONE]\n\n"
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(events)),
+	}
+	if err := n.NormalizeResponse(resp); err != nil {
+		t.Fatalf("NormalizeResponse failed: %v", err)
+	}
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+
+	want := "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"},\"finish_reason\":null}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\r\n\r\n" +
+		"data: [DONE]\n\n"
+	if string(got) != want {
+		t.Errorf("SSE body =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestAIClient_Forward_NormalizeResponse(t *testing.T) {
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"x","choices":[{"message":{"content":"ok"},"finish_reason":"stop_sequence"}]}`))
+	})
+	client.SetResponseNormalizer(newTestNormalizer(t))
+
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", strings.NewReader(`{"model":"claude"}`))
+	resp, err := client.Forward(req)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := client.normalizeResponse(resp); err != nil {
+		t.Fatalf("normalizeResponse failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	var out struct {
+		Choices []struct {
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Fatalf("normalized body invalid: %v", err)
+	}
+	if len(out.Choices) != 1 || out.Choices[0].FinishReason != "stop" {
+		t.Errorf("finish_reason not normalized: %s", body)
+	}
+	if out.Usage == nil {
+		t.Errorf("usage not synthesized: %s", body)
+	}
+	if cl := resp.Header.Get("Content-Length"); cl != strconv.Itoa(len(body)) {
+		t.Errorf("Content-Length = %s, want %d", cl, len(body))
+	}
+}
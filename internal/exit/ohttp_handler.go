@@ -3,47 +3,160 @@ package exit
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/binn/tokengo/internal/crypto"
 	"github.com/binn/tokengo/internal/protocol"
+	"github.com/cloudflare/circl/hpke"
 )
 
+// ErrDecryptRequest 无法解密 OHTTP 请求 (如 Client 仍在使用已轮换掉的公钥)
+var ErrDecryptRequest = errors.New("解密请求失败")
+
 // OHTTPHandler OHTTP 请求处理器
 type OHTTPHandler struct {
 	ohttpServer *crypto.OHTTPServer
-	aiClient    *AIClient
-	keyConfig   []byte // 公钥配置 (用于 /ohttp-keys 端点)
+	aiClient    *AIClient      // 默认后端
+	router      *BackendRouter // 按 model 路由的后端，nil 时只使用默认后端
+	keyConfig   []byte         // 公钥配置列表 (用于 /ohttp-keys 端点和 Relay 注册)
+	headerLimit HeaderLimit
+	bodyLimit   BodyLimit
+	access      accessControl // Exit 级别的路径/模型允许列表，默认不限制
+	usage       *UsageTracker // token 用量统计，nil 表示不统计
+	compression responseCompression
+
+	sseKeepalive time.Duration // SSE 响应空闲时注入注释保活的间隔，0 表示禁用
 }
 
 // NewOHTTPHandler 创建 OHTTP 处理器
 func NewOHTTPHandler(keyID uint8, privateKey, publicKey []byte, aiClient *AIClient) (*OHTTPHandler, error) {
-	server, err := crypto.NewOHTTPServer(keyID, privateKey)
+	return NewOHTTPHandlerWithKeys([]*crypto.KeyPair{{KeyID: keyID, PrivateKey: privateKey, PublicKey: publicKey}}, aiClient)
+}
+
+// NewOHTTPHandlerWithKeys 创建持有多个密钥的 OHTTP 处理器
+// 首个密钥为主密钥，在 KeyConfig 列表中排在最前 (Client 默认使用)；其余密钥在轮换重叠期内仍可解密
+// aeads 为接受的 AEAD 算法 (按偏好顺序，Client 选择首个)，未指定时只接受 AES-128-GCM
+func NewOHTTPHandlerWithKeys(keys []*crypto.KeyPair, aiClient *AIClient, aeads ...hpke.AEAD) (*OHTTPHandler, error) {
+	privateKeys := make(map[uint8][]byte, len(keys))
+	for _, kp := range keys {
+		if _, dup := privateKeys[kp.KeyID]; dup {
+			return nil, fmt.Errorf("OHTTP KeyID 重复: %d", kp.KeyID)
+		}
+		privateKeys[kp.KeyID] = kp.PrivateKey
+	}
+
+	server, err := crypto.NewOHTTPServerWithKeys(privateKeys, aeads...)
 	if err != nil {
 		return nil, err
 	}
-
-	keyConfig := crypto.EncodeKeyConfig(keyID, publicKey)
+	configs := make([]crypto.KeyConfig, 0, len(keys))
+	for _, kp := range keys {
+		configs = append(configs, crypto.KeyConfig{KeyID: kp.KeyID, PublicKey: kp.PublicKey, AEADs: server.AEADs()})
+	}
 
 	return &OHTTPHandler{
 		ohttpServer: server,
 		aiClient:    aiClient,
-		keyConfig:   keyConfig,
+		keyConfig:   crypto.EncodeKeyConfigs(configs),
+		headerLimit: HeaderLimit{
+			MaxCount: defaultMaxResponseHeaders,
+			MaxBytes: defaultMaxResponseHeaderBytes,
+		},
 	}, nil
 }
 
+// KeyConfig 返回所有有效密钥的 KeyConfig 列表 (主密钥在前)
+func (h *OHTTPHandler) KeyConfig() []byte {
+	return h.keyConfig
+}
+
+// SetHeaderLimit 设置转发给 Client 的响应头上限，未填写 (<=0) 的字段使用默认值
+func (h *OHTTPHandler) SetHeaderLimit(limit HeaderLimit) {
+	if limit.MaxCount <= 0 {
+		limit.MaxCount = defaultMaxResponseHeaders
+	}
+	if limit.MaxBytes <= 0 {
+		limit.MaxBytes = defaultMaxResponseHeaderBytes
+	}
+	h.headerLimit = limit
+}
+
+// SetBodyLimit 设置请求体/响应体大小上限
+func (h *OHTTPHandler) SetBodyLimit(limit BodyLimit) {
+	h.bodyLimit = limit
+}
+
+// SetSSEKeepalive 设置 SSE 保活间隔: 流式 SSE 响应超过 d 未收到后端数据时注入注释事件 (": keepalive")，
+// 与普通数据块一样加密转发，避免首个 token 前长时间无数据导致中间代理或 Client 写超时断开；d <= 0 表示禁用 (默认)
+func (h *OHTTPHandler) SetSSEKeepalive(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.sseKeepalive = d
+}
+
+// SetUsageTracker 设置 token 用量统计: 解析非流式 JSON 响应和流式 SSE 响应中的 usage 字段并按模型累计
+func (h *OHTTPHandler) SetUsageTracker(u *UsageTracker) {
+	h.usage = u
+}
+
+// SetBackendRouter 设置按 model 字段路由的后端
+func (h *OHTTPHandler) SetBackendRouter(router *BackendRouter) {
+	h.router = router
+}
+
+// backendFor 为解密后的请求选择 AI 后端
+func (h *OHTTPHandler) backendFor(req *http.Request) (*AIClient, error) {
+	if h.router == nil {
+		return h.aiClient, nil
+	}
+	return h.router.Route(req)
+}
+
 // decryptAndForward 核心逻辑: 解密 OHTTP → 转发到 AI → 加密响应
 func (h *OHTTPHandler) decryptAndForward(ohttpReqData []byte) ([]byte, error) {
 	innerReq, ctx, err := h.ohttpServer.DecapsulateRequest(ohttpReqData)
 	if err != nil {
-		return nil, fmt.Errorf("解密请求失败: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrDecryptRequest, err)
 	}
 
-	innerResp, err := h.aiClient.Forward(innerReq)
+	// 请求体超限 (含解压后超限) 时不转发，直接返回加密的 413
+	acceptCompressed, err := h.decompressRequest(innerReq)
+	if err == nil {
+		err = h.bodyLimit.checkRequest(innerReq)
+	}
+	if errors.Is(err, ErrRequestTooLarge) {
+		log.Printf("拒绝请求: %v", err)
+		return h.encapsulate(ctx, requestTooLargeResponse(h.bodyLimit.MaxRequestBytes))
+	} else if err != nil {
+		return nil, err
+	}
+
+	// 访问控制拒绝时不转发，返回加密的 403
+	if err := h.access.check(innerReq); errors.Is(err, ErrAccessDenied) {
+		log.Printf("拒绝请求: %v", err)
+		return h.encapsulate(ctx, accessDeniedResponse(err))
+	} else if err != nil {
+		return nil, err
+	}
+
+	aiClient, err := h.backendFor(innerReq)
+	if err != nil {
+		return nil, err
+	}
+
+	innerResp, err := aiClient.Forward(innerReq)
+	if errors.Is(err, ErrQueueTimeout) {
+		// 请求未到达后端，交给 Client 换 Exit 重试
+		return nil, err
+	}
 	if err != nil {
 		log.Printf("转发请求失败: %v", err)
 		innerResp = &http.Response{
@@ -53,12 +166,40 @@ func (h *OHTTPHandler) decryptAndForward(ohttpReqData []byte) ([]byte, error) {
 			ProtoMajor: 1,
 			ProtoMinor: 1,
 			Header:     make(http.Header),
-			Body:       io.NopCloser(bytes.NewReader([]byte(`{"error":"AI backend unavailable"}`))),
+			Body:       io.NopCloser(bytes.NewReader([]byte(`{"error":{"message":"AI backend unavailable","type":"gateway_error","param":null,"code":"backend_unavailable"}}`))),
 		}
 		innerResp.Header.Set("Content-Type", "application/json")
 	}
 	defer innerResp.Body.Close()
 
+	// 响应体在上限内读入内存后再加密，超限时丢弃后端响应
+	if err := h.bodyLimit.readResponse(innerResp); errors.Is(err, ErrResponseTooLarge) {
+		log.Printf("丢弃后端响应: %v", err)
+		return h.encapsulate(ctx, responseTooLargeResponse(h.bodyLimit.MaxResponseBytes))
+	} else if err != nil {
+		return nil, err
+	}
+	if err := aiClient.normalizeResponse(innerResp); err != nil {
+		return nil, err
+	}
+	if h.usage != nil {
+		if err := h.usage.observeResponse(innerResp); err != nil {
+			return nil, err
+		}
+	}
+	if acceptCompressed {
+		if err := h.compressResponse(innerResp); err != nil {
+			return nil, err
+		}
+	}
+
+	return h.encapsulate(ctx, innerResp)
+}
+
+// encapsulate 裁剪响应头后加密响应
+func (h *OHTTPHandler) encapsulate(ctx *crypto.ServerContext, innerResp *http.Response) ([]byte, error) {
+	limitResponseHeaders(innerResp.Header, h.headerLimit)
+
 	ohttpResp, err := ctx.EncapsulateResponse(innerResp)
 	if err != nil {
 		return nil, fmt.Errorf("加密响应失败: %w", err)
@@ -71,73 +212,297 @@ func (h *OHTTPHandler) decryptAndForward(ohttpReqData []byte) ([]byte, error) {
 type streamContext struct {
 	encryptor *crypto.StreamEncryptor
 	resp      *http.Response
+	sendHead  bool   // Client 声明可处理 StreamHead，先发送后端响应头
+	sequenced bool   // Client 声明可处理带序号的 StreamChunk (需同时发送 StreamHead 告知 Client)
+	nextSeq   uint64 // 下一个 StreamChunk 的序号
+	usage     streamUsage
+}
+
+// sealChunk 加密一个流式数据块，协商了序号时附带递增序号
+func (sc *streamContext) sealChunk(data []byte) ([]byte, error) {
+	if !sc.sequenced {
+		return sc.encryptor.EncryptChunk(data)
+	}
+	seq := sc.nextSeq
+	sc.nextSeq++
+	return sc.encryptor.EncryptSequencedChunk(seq, data)
 }
 
 // prepareStream 解密请求并建立流式转发连接
-func (h *OHTTPHandler) prepareStream(ohttpReqData []byte) (*streamContext, error) {
+// 请求体分块上传时从 upstream 读取后续的 RequestChunk/RequestEnd (upstream 为 nil 时不支持)
+func (h *OHTTPHandler) prepareStream(ohttpReqData []byte, upstream io.Reader) (*streamContext, error) {
 	innerReq, ctx, err := h.ohttpServer.DecapsulateRequest(ohttpReqData)
 	if err != nil {
-		return nil, fmt.Errorf("解密请求失败: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrDecryptRequest, err)
+	}
+
+	if err := attachUploadBody(innerReq, ctx, upstream); err != nil {
+		return nil, err
 	}
+	sendHead := innerReq.Header.Get(protocol.StreamHeadHeader) != ""
+	sequenced := sendHead && innerReq.Header.Get(protocol.StreamSeqHeader) != ""
+	innerReq.Header.Del(protocol.StreamHeadHeader)
+	innerReq.Header.Del(protocol.StreamSeqHeader)
 
 	encryptor, err := ctx.NewStreamEncryptor()
 	if err != nil {
 		return nil, fmt.Errorf("创建流加密器失败: %w", err)
 	}
 
-	innerResp, err := h.aiClient.ForwardStream(innerReq)
+	// 流式响应逐块加密，不压缩；只还原 Client 压缩的请求体
+	// 请求体超限 (含解压后超限) 时不转发；Client 可处理 StreamHead 时 413 随加密的响应头和响应体返回
+	_, err = h.decompressRequest(innerReq)
+	if err == nil {
+		err = h.bodyLimit.checkRequest(innerReq)
+	}
+	if err != nil {
+		if !errors.Is(err, ErrRequestTooLarge) || !sendHead {
+			return nil, err
+		}
+		log.Printf("拒绝请求: %v", err)
+		return &streamContext{encryptor: encryptor, resp: requestTooLargeResponse(h.bodyLimit.MaxRequestBytes), sendHead: sendHead, sequenced: sequenced}, nil
+	}
+
+	// 访问控制拒绝的请求不转发；Client 可处理 StreamHead 时 403 随加密的响应头和响应体返回
+	if err := h.access.check(innerReq); err != nil {
+		if !errors.Is(err, ErrAccessDenied) || !sendHead {
+			return nil, err
+		}
+		log.Printf("拒绝请求: %v", err)
+		return &streamContext{encryptor: encryptor, resp: accessDeniedResponse(err), sendHead: sendHead, sequenced: sequenced}, nil
+	}
+
+	aiClient, err := h.backendFor(innerReq)
+	if err != nil {
+		return nil, err
+	}
+
+	innerResp, err := aiClient.ForwardStream(innerReq)
 	if err != nil {
 		return nil, fmt.Errorf("转发请求失败: %w", err)
 	}
 
-	if innerResp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(innerResp.Body)
+	// Client 可处理 StreamHead 时，非 200 响应的状态码随响应头发送、响应体原样转发，调用方收到后端的原始错误
+	if innerResp.StatusCode != http.StatusOK && !sendHead {
+		body, _ := io.ReadAll(h.bodyLimit.limitResponse(innerResp.Body))
 		innerResp.Body.Close()
 		return nil, fmt.Errorf("AI 后端返回错误: %d - %s", innerResp.StatusCode, string(body))
 	}
 
-	return &streamContext{encryptor: encryptor, resp: innerResp}, nil
+	// 流式响应按累计字节数限制，超限时中止转发
+	innerResp.Body = struct {
+		io.Reader
+		io.Closer
+	}{h.bodyLimit.limitResponse(innerResp.Body), innerResp.Body}
+	if innerResp.StatusCode == http.StatusOK {
+		if err := aiClient.normalizeResponse(innerResp); err != nil {
+			innerResp.Body.Close()
+			return nil, err
+		}
+	}
+
+	return &streamContext{encryptor: encryptor, resp: innerResp, sendHead: sendHead, sequenced: sequenced}, nil
+}
+
+// writeStreamHead 加密后端响应头 (MIME header 块) 并写入 StreamHead，Client 据此还原 Content-Type 等响应头
+func (h *OHTTPHandler) writeStreamHead(sc *streamContext, writer io.Writer) error {
+	limitResponseHeaders(sc.resp.Header, h.headerLimit)
+
+	// 回显序号协商结果 (在裁剪之后设置，不会被丢弃)
+	header := sc.resp.Header
+	if sc.sequenced || sc.resp.StatusCode != http.StatusOK {
+		header = header.Clone()
+	}
+	if sc.sequenced {
+		header.Set(protocol.StreamSeqHeader, "1")
+	}
+	if sc.resp.StatusCode != http.StatusOK {
+		header.Set(protocol.StreamStatusHeader, strconv.Itoa(sc.resp.StatusCode))
+	}
+
+	var buf bytes.Buffer
+	if err := header.Write(&buf); err != nil {
+		return fmt.Errorf("序列化响应头失败: %w", err)
+	}
+	encrypted, err := sc.encryptor.EncryptChunk(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("加密响应头失败: %w", err)
+	}
+	if err := protocol.WriteMessage(writer, protocol.NewStreamHeadMessage(encrypted)); err != nil {
+		return fmt.Errorf("写入流式响应头失败: %w", err)
+	}
+	return nil
 }
 
 // writeStreamChunks 从 AI 响应读取 SSE 事件，加密并写入 StreamChunk/StreamEnd
 func (h *OHTTPHandler) writeStreamChunks(sc *streamContext, writer io.Writer) error {
 	defer sc.resp.Body.Close()
 
-	scanner := bufio.NewScanner(sc.resp.Body)
-	var eventBuf strings.Builder
+	if sc.sendHead {
+		if err := h.writeStreamHead(sc, writer); err != nil {
+			return err
+		}
+	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		eventBuf.WriteString(line)
-		eventBuf.WriteString("\n")
+	// 非 SSE 响应 (Client 按路径配置强制内部流式) 和后端的错误响应按原始字节分块转发
+	if !IsSSEResponse(sc.resp) || sc.resp.StatusCode != http.StatusOK {
+		return h.writeRawChunks(sc, writer)
+	}
 
-		// SSE 事件以空行分隔
-		if line == "" && eventBuf.Len() > 1 {
-			event := eventBuf.String()
-			eventBuf.Reset()
+	// 后台读取完整事件，本 goroutine 负责全部写入: 保活注释只在事件之间插入，不会打断事件
+	events := make(chan sseRead)
+	done := make(chan struct{})
+	defer close(done)
+	go readSSEEvents(sc.resp.Body, events, done)
+	if h.usage != nil {
+		// 截断或中断的流同样记录已出现的用量
+		defer h.usage.recordStream(&sc.usage)
+	}
 
-			encrypted, err := sc.encryptor.EncryptChunk([]byte(event))
-			if err != nil {
-				log.Printf("加密流式块失败: %v", err)
-				break
-			}
+	var keepalive *time.Timer
+	var keepaliveC <-chan time.Time
+	if h.sseKeepalive > 0 {
+		keepalive = time.NewTimer(h.sseKeepalive)
+		defer keepalive.Stop()
+		keepaliveC = keepalive.C
+	}
 
-			msg := protocol.NewStreamChunkMessage(encrypted)
-			if _, err := writer.Write(msg.Encode()); err != nil {
-				log.Printf("写入流式块失败: %v", err)
-				break
+loop:
+	for {
+		select {
+		case r := <-events:
+			// 响应超限时不发送结束标记，Client 不会把截断的响应当作完整响应
+			if errors.Is(r.err, ErrResponseTooLarge) {
+				return fmt.Errorf("%w: > %d 字节", r.err, h.bodyLimit.MaxResponseBytes)
+			}
+			if r.err != nil {
+				break loop
+			}
+			if err := h.writeStreamChunk(sc, writer, r.event); err != nil {
+				log.Printf("%v", err)
+				break loop
+			}
+			if h.usage != nil {
+				sc.usage.observe(r.event)
+			}
+			if keepalive != nil {
+				if !keepalive.Stop() {
+					<-keepalive.C
+				}
+				keepalive.Reset(h.sseKeepalive)
 			}
+		case <-keepaliveC:
+			if err := h.writeStreamChunk(sc, writer, sseKeepaliveComment); err != nil {
+				log.Printf("%v", err)
+				break loop
+			}
+			keepalive.Reset(h.sseKeepalive)
 		}
 	}
 
 	endMsg := protocol.NewStreamEndMessage()
-	if _, err := writer.Write(endMsg.Encode()); err != nil {
+	if err := protocol.WriteMessage(writer, endMsg); err != nil {
 		return fmt.Errorf("写入流式结束标记失败: %w", err)
 	}
 
 	return nil
 }
 
+// sseKeepaliveComment SSE 注释事件，按规范被客户端忽略，只用于保持连接活跃
+var sseKeepaliveComment = []byte(": keepalive\n\n")
+
+// sseRead 从后端读取的一个完整 SSE 事件，或读取结束的原因 (含 io.EOF)
+type sseRead struct {
+	event []byte
+	err   error
+}
+
+// readSSEEvents 从后端响应按事件读取并发送到 events，读取结束时发送结束原因后退出；done 关闭时放弃发送
+// SSE 事件以空行分隔；event:/id:/retry: 等字段 (如 Anthropic 的命名事件) 与 data 行一起
+// 作为不透明字节转发，保留原始行尾，Client 拼接后与后端输出逐字节一致
+func readSSEEvents(body io.Reader, events chan<- sseRead, done <-chan struct{}) {
+	send := func(r sseRead) bool {
+		select {
+		case events <- r:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	reader := bufio.NewReader(body)
+	var event []byte
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if errors.Is(readErr, ErrResponseTooLarge) {
+			send(sseRead{err: readErr})
+			return
+		}
+		event = append(event, line...)
+
+		// 事件之前的多余空行并入下一个事件；流末尾没有空行结尾的残余字节也原样转发
+		endOfEvent := isBlankLine(line) && len(event) > len(line)
+		if endOfEvent || (readErr != nil && len(event) > 0) {
+			if !send(sseRead{event: event}) {
+				return
+			}
+			event = nil
+		}
+		if readErr != nil {
+			send(sseRead{err: readErr})
+			return
+		}
+	}
+}
+
+// writeStreamChunk 加密一个 SSE 事件并写入 StreamChunk
+func (h *OHTTPHandler) writeStreamChunk(sc *streamContext, writer io.Writer, event []byte) error {
+	encrypted, err := sc.sealChunk(event)
+	if err != nil {
+		return fmt.Errorf("加密流式块失败: %w", err)
+	}
+	if err := protocol.WriteMessage(writer, protocol.NewStreamChunkMessage(encrypted)); err != nil {
+		return fmt.Errorf("写入流式块失败: %w", err)
+	}
+	return nil
+}
+
+// isBlankLine 判断是否为以换行结尾的空行 (LF 或 CRLF)
+func isBlankLine(line []byte) bool {
+	return string(line) == "\n" || string(line) == "\r\n"
+}
+
+// rawChunkSize 非 SSE 响应分块转发的块大小
+const rawChunkSize = 32 * 1024
+
+// writeRawChunks 将非 SSE 响应体按固定大小分块加密转发，拼接后与原响应体逐字节一致
+func (h *OHTTPHandler) writeRawChunks(sc *streamContext, writer io.Writer) error {
+	buf := make([]byte, rawChunkSize)
+	for {
+		n, readErr := sc.resp.Body.Read(buf)
+		if n > 0 {
+			encrypted, err := sc.sealChunk(buf[:n])
+			if err != nil {
+				return fmt.Errorf("加密流式块失败: %w", err)
+			}
+			if err := protocol.WriteMessage(writer, protocol.NewStreamChunkMessage(encrypted)); err != nil {
+				return fmt.Errorf("写入流式块失败: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("读取响应体失败: %w", readErr)
+		}
+	}
+
+	if err := protocol.WriteMessage(writer, protocol.NewStreamEndMessage()); err != nil {
+		return fmt.Errorf("写入流式结束标记失败: %w", err)
+	}
+	return nil
+}
+
 // flushWriter 自动 flush 的 io.Writer 包装器 (HTTP 流式响应使用)
 type flushWriter struct {
 	w io.Writer
@@ -172,6 +537,11 @@ func (h *OHTTPHandler) HandleOHTTP(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	ohttpResp, err := h.decryptAndForward(ohttpReq)
+	if errors.Is(err, ErrQueueTimeout) {
+		log.Printf("拒绝请求: %v", err)
+		http.Error(w, "Queue timeout", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		log.Printf("%v", err)
 		http.Error(w, "Failed to process request", http.StatusInternalServerError)
@@ -204,7 +574,17 @@ func (h *OHTTPHandler) HandleOHTTPStream(w http.ResponseWriter, r *http.Request)
 	}
 	defer r.Body.Close()
 
-	sc, err := h.prepareStream(ohttpReq)
+	sc, err := h.prepareStream(ohttpReq, nil)
+	if errors.Is(err, ErrRequestTooLarge) {
+		log.Printf("拒绝请求: %v", err)
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if errors.Is(err, ErrQueueTimeout) {
+		log.Printf("拒绝请求: %v", err)
+		http.Error(w, "Queue timeout", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		log.Printf("%v", err)
 		http.Error(w, "Failed to process stream request", http.StatusBadGateway)
@@ -233,12 +613,23 @@ func (h *OHTTPHandler) ProcessRequest(ohttpReq []byte) ([]byte, error) {
 }
 
 // ProcessStreamRequest 处理流式 OHTTP 请求 (隧道模式)
-func (h *OHTTPHandler) ProcessStreamRequest(ohttpReq []byte, writer io.Writer) error {
-	sc, err := h.prepareStream(ohttpReq)
+// 加密的流式块写入 stream；请求体分块上传时同时从 stream 读取后续的请求体块
+func (h *OHTTPHandler) ProcessStreamRequest(ohttpReq []byte, stream io.ReadWriter) error {
+	sc, err := h.prepareStream(ohttpReq, stream)
 	if err != nil {
 		return err
 	}
-	return h.writeStreamChunks(sc, writer)
+	return h.writeStreamChunks(sc, stream)
+}
+
+// Routes 返回直连模式 HTTP 服务的路由: /ohttp、/ohttp-stream、/ohttp-keys、/ready
+func (h *OHTTPHandler) Routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ohttp", h.HandleOHTTP)
+	mux.HandleFunc("/ohttp-stream", h.HandleOHTTPStream)
+	mux.HandleFunc("/ohttp-keys", h.HandleKeys)
+	mux.HandleFunc("/ready", h.HandleReady)
+	return mux
 }
 
 // HandleKeys 返回 OHTTP 公钥配置
@@ -253,3 +644,22 @@ func (h *OHTTPHandler) HandleKeys(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(h.keyConfig)
 }
+
+// HandleReady 就绪检查: 按配置的健康检查探测 AI 后端，不可达时返回 503
+func (h *OHTTPHandler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := h.aiClient.CheckHealth(r.Context()); err != nil {
+		log.Printf("就绪检查失败: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "unavailable", "error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+}
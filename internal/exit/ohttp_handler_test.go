@@ -3,12 +3,18 @@ package exit
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/binn/tokengo/internal/config"
 	"github.com/binn/tokengo/internal/crypto"
 	"github.com/binn/tokengo/internal/protocol"
 )
@@ -228,7 +234,7 @@ func TestOHTTPHandler_ProcessStreamRequest_VerifyDecryption(t *testing.T) {
 		flusher.Flush()
 	})
 
-	ohttpReq, clientCtx := encryptRequest(t, ohttpClient, "POST", "/v1/chat/completions", []byte(`{"stream":true}`))
+	ohttpReq, clientCtx := encryptRequest(t, ohttpClient, "POST", "/v1/chat/completions", []byte(`{"model":"test","stream":true}`))
 
 	var buf bytes.Buffer
 	err := handler.ProcessStreamRequest(ohttpReq, &buf)
@@ -265,6 +271,193 @@ func TestOHTTPHandler_ProcessStreamRequest_VerifyDecryption(t *testing.T) {
 	}
 }
 
+func TestOHTTPHandler_ProcessStreamRequest_NonSSEBody(t *testing.T) {
+	// 非 SSE 响应 (如非流式 JSON 被强制内部流式) 按原始字节分块，拼接后与原响应一致
+	respBody := `{"id":"1","choices":[{"message":{"content":"` + strings.Repeat("x", 3*rawChunkSize) + `"}}]}`
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(respBody))
+	})
+
+	ohttpReq, clientCtx := encryptRequest(t, ohttpClient, "POST", "/v1/chat/completions", []byte(`{"model":"test"}`))
+
+	var buf bytes.Buffer
+	if err := handler.ProcessStreamRequest(ohttpReq, &buf); err != nil {
+		t.Fatalf("ProcessStreamRequest failed: %v", err)
+	}
+
+	decryptor, err := clientCtx.NewStreamDecryptor()
+	if err != nil {
+		t.Fatalf("NewStreamDecryptor failed: %v", err)
+	}
+
+	reader := bytes.NewReader(buf.Bytes())
+	var combined bytes.Buffer
+	chunks := 0
+	for {
+		msg, err := protocol.Decode(reader)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if msg.Type == protocol.MessageTypeStreamEnd {
+			break
+		}
+		plain, err := decryptor.DecryptChunk(msg.Payload)
+		if err != nil {
+			t.Fatalf("DecryptChunk failed: %v", err)
+		}
+		combined.Write(plain)
+		chunks++
+	}
+
+	if combined.String() != respBody {
+		t.Errorf("reassembled body mismatch: got %d bytes, want %d", combined.Len(), len(respBody))
+	}
+	if chunks < 2 {
+		t.Errorf("large body should be split into multiple chunks, got %d", chunks)
+	}
+}
+
+func TestOHTTPHandler_ProcessStreamRequest_AnthropicNamedEvents(t *testing.T) {
+	// Anthropic Messages API 的命名事件流: event: 行、CRLF 行尾、末尾事件缺少空行
+	events := []string{
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\"}}\n\n",
+		"event: ping\ndata: {\"type\": \"ping\"}\n\n",
+		"event: content_block_delta\r\nid: 3\r\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"Hi\"}}\r\n\r\n",
+		": keep-alive comment\n\n",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n",
+	}
+	source := strings.Join(events, "")
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(source))
+	})
+
+	ohttpReq, clientCtx := encryptRequest(t, ohttpClient, "POST", "/v1/messages", []byte(`{"model":"claude","stream":true}`))
+
+	var buf bytes.Buffer
+	if err := handler.ProcessStreamRequest(ohttpReq, &buf); err != nil {
+		t.Fatalf("ProcessStreamRequest failed: %v", err)
+	}
+
+	decryptor, err := clientCtx.NewStreamDecryptor()
+	if err != nil {
+		t.Fatalf("NewStreamDecryptor failed: %v", err)
+	}
+	reader := bytes.NewReader(buf.Bytes())
+	var chunks []string
+	for {
+		msg, err := protocol.Decode(reader)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if msg.Type == protocol.MessageTypeStreamEnd {
+			break
+		}
+		plain, err := decryptor.DecryptChunk(msg.Payload)
+		if err != nil {
+			t.Fatalf("DecryptChunk failed: %v", err)
+		}
+		chunks = append(chunks, string(plain))
+	}
+
+	if got := strings.Join(chunks, ""); got != source {
+		t.Errorf("reassembled stream mismatch:\ngot  %q\nwant %q", got, source)
+	}
+	// 每个事件独立成块
+	if len(chunks) != len(events) {
+		t.Errorf("chunks = %q, want one per event (%d)", chunks, len(events))
+	}
+}
+
+func TestOHTTPHandler_ProcessStreamRequest_SSEKeepalive(t *testing.T) {
+	// 慢速首 token: 后端先返回响应头，300ms 后才输出第一个事件
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("data: first\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	})
+	handler.SetSSEKeepalive(50 * time.Millisecond)
+
+	ohttpReq, clientCtx := encryptRequest(t, ohttpClient, "POST", "/v1/chat/completions", []byte(`{"model":"test","stream":true}`))
+
+	var buf bytes.Buffer
+	if err := handler.ProcessStreamRequest(ohttpReq, &buf); err != nil {
+		t.Fatalf("ProcessStreamRequest failed: %v", err)
+	}
+
+	decryptor, err := clientCtx.NewStreamDecryptor()
+	if err != nil {
+		t.Fatalf("NewStreamDecryptor failed: %v", err)
+	}
+	reader := bytes.NewReader(buf.Bytes())
+	var chunks []string
+	for {
+		msg, err := protocol.Decode(reader)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if msg.Type == protocol.MessageTypeStreamEnd {
+			break
+		}
+		plain, err := decryptor.DecryptChunk(msg.Payload)
+		if err != nil {
+			t.Fatalf("DecryptChunk failed: %v", err)
+		}
+		chunks = append(chunks, string(plain))
+	}
+
+	// 首个数据事件之前是若干保活注释，数据事件完整且保持顺序
+	first := slices.Index(chunks, "data: first\n\n")
+	if first < 2 {
+		t.Fatalf("chunks = %q, want several keepalives before the first data event", chunks)
+	}
+	for _, c := range chunks[:first] {
+		if c != string(sseKeepaliveComment) {
+			t.Errorf("chunk before data = %q, want keepalive comment", c)
+		}
+	}
+	if chunks[len(chunks)-1] != "data: [DONE]\n\n" {
+		t.Errorf("last chunk = %q, want [DONE]", chunks[len(chunks)-1])
+	}
+}
+
+func TestOHTTPHandler_ProcessStreamRequest_NoKeepaliveByDefault(t *testing.T) {
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("data: first\n\n"))
+	})
+
+	ohttpReq, _ := encryptRequest(t, ohttpClient, "POST", "/v1/chat/completions", []byte(`{"model":"test","stream":true}`))
+
+	var buf bytes.Buffer
+	if err := handler.ProcessStreamRequest(ohttpReq, &buf); err != nil {
+		t.Fatalf("ProcessStreamRequest failed: %v", err)
+	}
+	reader := bytes.NewReader(buf.Bytes())
+	chunks := 0
+	for {
+		msg, err := protocol.Decode(reader)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if msg.Type == protocol.MessageTypeStreamEnd {
+			break
+		}
+		chunks++
+	}
+	if chunks != 1 {
+		t.Errorf("chunks = %d, want only the data event", chunks)
+	}
+}
+
 func TestOHTTPHandler_HandleKeys(t *testing.T) {
 	handler, _, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -299,6 +492,61 @@ func TestOHTTPHandler_HandleKeys(t *testing.T) {
 	_ = keyID
 }
 
+func TestOHTTPHandler_MultipleKeys(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(backend.Close)
+
+	current, _ := crypto.GenerateKeyPair()
+	previous, _ := crypto.GenerateKeyPair()
+	previous.KeyID = current.KeyID + 1
+
+	handler, err := NewOHTTPHandlerWithKeys([]*crypto.KeyPair{current, previous}, NewAIClient(backend.URL, "", nil))
+	if err != nil {
+		t.Fatalf("NewOHTTPHandlerWithKeys failed: %v", err)
+	}
+
+	// /ohttp-keys 返回全部 KeyConfig，主密钥在前
+	rec := httptest.NewRecorder()
+	handler.HandleKeys(rec, httptest.NewRequest(http.MethodGet, "/ohttp-keys", nil))
+	configs, err := crypto.DecodeKeyConfigs(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("DecodeKeyConfigs failed: %v", err)
+	}
+	if len(configs) != 2 || configs[0].KeyID != current.KeyID || configs[1].KeyID != previous.KeyID {
+		t.Fatalf("configs = %+v, want [current, previous]", configs)
+	}
+
+	// 旧密钥加密的请求在重叠期内仍可处理
+	for _, kp := range []*crypto.KeyPair{current, previous} {
+		client, _ := crypto.NewOHTTPClient(kp.KeyID, kp.PublicKey)
+		ohttpReq, clientCtx := encryptRequest(t, client, "POST", "/v1/chat/completions", []byte(`{"model":"test"}`))
+		ohttpResp, err := handler.ProcessRequest(ohttpReq)
+		if err != nil {
+			t.Fatalf("KeyID %d: ProcessRequest failed: %v", kp.KeyID, err)
+		}
+		resp, err := clientCtx.DecapsulateResponse(ohttpResp)
+		if err != nil {
+			t.Fatalf("KeyID %d: DecapsulateResponse failed: %v", kp.KeyID, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("KeyID %d: StatusCode = %d, want 200", kp.KeyID, resp.StatusCode)
+		}
+	}
+}
+
+func TestNewOHTTPHandlerWithKeys_DuplicateKeyID(t *testing.T) {
+	a, _ := crypto.GenerateKeyPair()
+	b, _ := crypto.GenerateKeyPair()
+	b.KeyID = a.KeyID
+
+	if _, err := NewOHTTPHandlerWithKeys([]*crypto.KeyPair{a, b}, nil); err == nil {
+		t.Error("duplicate KeyID should be rejected")
+	}
+}
+
 func TestOHTTPHandler_HandleOHTTP_MethodNotAllowed(t *testing.T) {
 	handler, _, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -328,3 +576,359 @@ func TestOHTTPHandler_HandleKeys_MethodNotAllowed(t *testing.T) {
 		t.Errorf("StatusCode = %d, want 405", rec.Code)
 	}
 }
+
+func TestOHTTPHandler_HandleReady(t *testing.T) {
+	healthy := true
+	handler, _, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	handler.aiClient.SetHealthCheck(config.HealthCheck{Path: "/health"})
+
+	// 经路由访问 /ready，确认端点已注册
+	routes := handler.Routes()
+	req := httptest.NewRequest("GET", "/ready", nil)
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("healthy backend: status = %d, want 200", w.Code)
+	}
+
+	healthy = false
+	w = httptest.NewRecorder()
+	routes.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("unhealthy backend: status = %d, want 503", w.Code)
+	}
+}
+
+func TestOHTTPHandler_ProcessRequest_OversizedHeadersCapped(t *testing.T) {
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		for i := 0; i < 50; i++ {
+			w.Header().Set(fmt.Sprintf("X-Junk-%02d", i), strings.Repeat("a", 1024))
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ok":true}`))
+	})
+	handler.SetHeaderLimit(HeaderLimit{MaxCount: 10, MaxBytes: 4096})
+
+	ohttpReq, clientCtx := encryptRequest(t, ohttpClient, "GET", "/v1/models", nil)
+	ohttpResp, err := handler.ProcessRequest(ohttpReq)
+	if err != nil {
+		t.Fatalf("ProcessRequest failed: %v", err)
+	}
+
+	resp, err := clientCtx.DecapsulateResponse(ohttpResp)
+	if err != nil {
+		t.Fatalf("DecapsulateResponse failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	junk := 0
+	for key := range resp.Header {
+		if strings.HasPrefix(key, "X-Junk-") {
+			junk++
+		}
+	}
+	if junk == 0 || junk > 3 {
+		t.Errorf("forwarded %d junk headers, want between 1 and 3 under 4096 byte limit", junk)
+	}
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type should be preserved, got %q", resp.Header.Get("Content-Type"))
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != `{"ok":true}` {
+		t.Errorf("body = %s, want {\"ok\":true}", body)
+	}
+}
+
+// uploadStream 模拟隧道流: 从 upload 读取请求体块，响应写入 out
+type uploadStream struct {
+	io.Reader
+	out bytes.Buffer
+}
+
+func (s *uploadStream) Write(p []byte) (int, error) { return s.out.Write(p) }
+
+// encryptChunkedRequest 加密分块上传的请求头部，并将 chunks 编码为 RequestChunk 消息 (final 为 true 时追加 RequestEnd)
+func encryptChunkedRequest(t *testing.T, client *crypto.OHTTPClient, path string, length int64, chunks [][]byte, final bool) ([]byte, *bytes.Buffer) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, "http://ai-backend"+path, nil)
+	req.Header.Set(protocol.ChunkedBodyHeader, fmt.Sprint(length))
+	ohttpReq, ctx, err := client.EncapsulateRequest(req)
+	if err != nil {
+		t.Fatalf("EncapsulateRequest failed: %v", err)
+	}
+	sealer, err := ctx.NewRequestBodySealer()
+	if err != nil {
+		t.Fatalf("NewRequestBodySealer failed: %v", err)
+	}
+
+	var upload bytes.Buffer
+	for _, c := range chunks {
+		upload.Write(protocol.NewRequestChunkMessage(sealer.SealChunk(c)).Encode())
+	}
+	if final {
+		upload.Write(protocol.NewRequestEndMessage(sealer.SealFinal()).Encode())
+	}
+	return ohttpReq, &upload
+}
+
+func TestOHTTPHandler_ProcessStreamRequest_ChunkedUpload(t *testing.T) {
+	var received []byte
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		if r.Header.Get(protocol.ChunkedBodyHeader) != "" {
+			t.Error("chunked upload marker forwarded to backend")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	})
+
+	ohttpReq, upload := encryptChunkedRequest(t, ohttpClient, "/v1/audio/transcriptions", -1,
+		[][]byte{[]byte("part-1,"), []byte("part-2")}, true)
+	stream := &uploadStream{Reader: upload}
+	if err := handler.ProcessStreamRequest(ohttpReq, stream); err != nil {
+		t.Fatalf("ProcessStreamRequest failed: %v", err)
+	}
+	if string(received) != "part-1,part-2" {
+		t.Errorf("backend received %q, want %q", received, "part-1,part-2")
+	}
+}
+
+func TestOHTTPHandler_ProcessStreamRequest_TruncatedUpload(t *testing.T) {
+	var called atomic.Bool
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		// 请求体未通过完整性校验时后端不应收到完整请求
+		if _, err := io.ReadAll(r.Body); err == nil {
+			called.Store(true)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// 缺少 RequestEnd: 中间人截断了请求体
+	ohttpReq, upload := encryptChunkedRequest(t, ohttpClient, "/v1/audio/transcriptions", -1,
+		[][]byte{[]byte("part-1")}, false)
+	err := handler.ProcessStreamRequest(ohttpReq, &uploadStream{Reader: upload})
+	if err == nil {
+		t.Fatal("expected truncated upload to fail")
+	}
+	if called.Load() {
+		t.Error("backend accepted a truncated body")
+	}
+}
+
+func TestOHTTPHandler_PrepareStream_ChunkedUploadNeedsUpstream(t *testing.T) {
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("backend should not be called")
+	})
+
+	ohttpReq, _ := encryptChunkedRequest(t, ohttpClient, "/v1/files", 10, nil, true)
+	if _, err := handler.prepareStream(ohttpReq, nil); err == nil {
+		t.Fatal("expected chunked upload without upstream to be rejected")
+	}
+}
+
+// decryptErrorCode 解密非流式响应，返回状态码和 OpenAI 错误码
+func decryptErrorCode(t *testing.T, clientCtx *crypto.ClientContext, ohttpResp []byte) (int, string) {
+	t.Helper()
+
+	resp, err := clientCtx.DecapsulateResponse(ohttpResp)
+	if err != nil {
+		t.Fatalf("DecapsulateResponse failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body.Error.Code
+}
+
+func TestOHTTPHandler_ProcessRequest_OversizedRequest(t *testing.T) {
+	var called atomic.Bool
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+		w.WriteHeader(http.StatusOK)
+	})
+	handler.SetBodyLimit(BodyLimit{MaxRequestBytes: 1024})
+
+	reqBody := []byte(`{"model":"test","input":"` + strings.Repeat("x", 2048) + `"}`)
+	ohttpReq, clientCtx := encryptRequest(t, ohttpClient, "POST", "/v1/embeddings", reqBody)
+	ohttpResp, err := handler.ProcessRequest(ohttpReq)
+	if err != nil {
+		t.Fatalf("ProcessRequest failed: %v", err)
+	}
+
+	if status, code := decryptErrorCode(t, clientCtx, ohttpResp); status != http.StatusRequestEntityTooLarge || code != "request_too_large" {
+		t.Errorf("got %d %q, want 413 request_too_large", status, code)
+	}
+	if called.Load() {
+		t.Error("oversized request should not reach the backend")
+	}
+}
+
+func TestOHTTPHandler_ProcessRequest_OversizedResponse(t *testing.T) {
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// 分块传输 (无 Content-Length)，只能边读边计数
+		for i := 0; i < 64; i++ {
+			w.Write([]byte(strings.Repeat("x", 1024)))
+			w.(http.Flusher).Flush()
+		}
+	})
+	handler.SetBodyLimit(BodyLimit{MaxResponseBytes: 16 * 1024})
+
+	ohttpReq, clientCtx := encryptRequest(t, ohttpClient, "POST", "/v1/chat/completions", []byte(`{"model":"test"}`))
+	ohttpResp, err := handler.ProcessRequest(ohttpReq)
+	if err != nil {
+		t.Fatalf("ProcessRequest failed: %v", err)
+	}
+
+	if status, code := decryptErrorCode(t, clientCtx, ohttpResp); status != http.StatusBadGateway || code != "response_too_large" {
+		t.Errorf("got %d %q, want 502 response_too_large", status, code)
+	}
+
+	// 上限内的响应原样转发
+	handler.SetBodyLimit(BodyLimit{MaxResponseBytes: 64 * 1024})
+	ohttpReq, clientCtx = encryptRequest(t, ohttpClient, "POST", "/v1/chat/completions", []byte(`{"model":"test"}`))
+	ohttpResp, err = handler.ProcessRequest(ohttpReq)
+	if err != nil {
+		t.Fatalf("ProcessRequest failed: %v", err)
+	}
+	resp, err := clientCtx.DecapsulateResponse(ohttpResp)
+	if err != nil {
+		t.Fatalf("DecapsulateResponse failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || len(body) != 64*1024 {
+		t.Errorf("got %d with %d bytes, want 200 with %d bytes", resp.StatusCode, len(body), 64*1024)
+	}
+}
+
+func TestOHTTPHandler_ProcessStreamRequest_ResponseCapped(t *testing.T) {
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(w, "data: %s\n\n", strings.Repeat("x", 100))
+		}
+	})
+	handler.SetBodyLimit(BodyLimit{MaxResponseBytes: 1024})
+
+	ohttpReq, _ := encryptRequest(t, ohttpClient, "POST", "/v1/chat/completions", []byte(`{"model":"test","stream":true}`))
+	var buf bytes.Buffer
+	err := handler.ProcessStreamRequest(ohttpReq, &buf)
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("err = %v, want ErrResponseTooLarge", err)
+	}
+
+	// 已转发的块不超过上限，且不发送结束标记
+	reader := bytes.NewReader(buf.Bytes())
+	chunks := 0
+	for reader.Len() > 0 {
+		msg, err := protocol.Decode(reader)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if msg.Type == protocol.MessageTypeStreamEnd {
+			t.Fatal("capped stream should not end with StreamEnd")
+		}
+		chunks++
+	}
+	if chunks == 0 || chunks > 1024/106 {
+		t.Errorf("forwarded %d chunks, want between 1 and %d", chunks, 1024/106)
+	}
+}
+
+func TestOHTTPHandler_ProcessStreamRequest_OversizedUpload(t *testing.T) {
+	var received atomic.Int64
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		received.Store(n)
+		w.WriteHeader(http.StatusOK)
+	})
+	handler.SetBodyLimit(BodyLimit{MaxRequestBytes: 10})
+
+	// 声明长度超限: 不读取请求体直接拒绝
+	ohttpReq, upload := encryptChunkedRequest(t, ohttpClient, "/v1/files", 11, [][]byte{[]byte("0123456789a")}, true)
+	if _, err := handler.prepareStream(ohttpReq, upload); !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("declared length: err = %v, want ErrRequestTooLarge", err)
+	}
+
+	// 未知长度: 读取到超限的块时中止上传
+	ohttpReq, upload = encryptChunkedRequest(t, ohttpClient, "/v1/files", -1,
+		[][]byte{[]byte("0123456"), []byte("789ab")}, true)
+	if err := handler.ProcessStreamRequest(ohttpReq, &uploadStream{Reader: upload}); err == nil {
+		t.Error("expected oversized upload to fail")
+	}
+	if n := received.Load(); n > 10 {
+		t.Errorf("backend received %d bytes, want at most 10", n)
+	}
+}
+
+func TestOHTTPHandler_ProcessStreamRequest_SequencedChunks(t *testing.T) {
+	var backendSeq string
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		backendSeq = r.Header.Get(protocol.StreamSeqHeader)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 0\n\ndata: 1\n\ndata: 2\n\n"))
+	})
+
+	body := []byte(`{"model":"m","stream":true}`)
+	req, _ := http.NewRequest("POST", "http://ai-backend/v1/chat/completions", bytes.NewReader(body))
+	req.Header.Set(protocol.StreamHeadHeader, "1")
+	req.Header.Set(protocol.StreamSeqHeader, "1")
+	ohttpReq, clientCtx, err := ohttpClient.EncapsulateRequest(req)
+	if err != nil {
+		t.Fatalf("EncapsulateRequest failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := handler.ProcessStreamRequest(ohttpReq, &buf); err != nil {
+		t.Fatalf("ProcessStreamRequest failed: %v", err)
+	}
+	if backendSeq != "" {
+		t.Errorf("backend received %s = %q, want it stripped", protocol.StreamSeqHeader, backendSeq)
+	}
+
+	decryptor, _ := clientCtx.NewStreamDecryptor()
+	reader := bytes.NewReader(buf.Bytes())
+
+	// StreamHead 回显序号协商，之后的块按 0、1、2 编号
+	head, err := protocol.Decode(reader)
+	if err != nil || head.Type != protocol.MessageTypeStreamHead {
+		t.Fatalf("first message = %v, %v; want StreamHead", head, err)
+	}
+	block, _ := decryptor.DecryptChunk(head.Payload)
+	if !strings.Contains(string(block), protocol.StreamSeqHeader+": 1") {
+		t.Errorf("StreamHead = %q, want %s echoed", block, protocol.StreamSeqHeader)
+	}
+	for want := uint64(0); ; want++ {
+		msg, err := protocol.Decode(reader)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if msg.Type == protocol.MessageTypeStreamEnd {
+			if want != 3 {
+				t.Errorf("got %d chunks, want 3", want)
+			}
+			break
+		}
+		seq, plain, err := decryptor.DecryptSequencedChunk(msg.Payload)
+		if err != nil || seq != want || string(plain) != fmt.Sprintf("data: %d\n\n", want) {
+			t.Errorf("chunk = %d %q, %v; want %d", seq, plain, err, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package exit
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/binn/tokengo/pkg/openai"
+)
+
+var (
+	// errInvalidPath 请求路径不是规范的绝对路径 (含 . / .. 段、反斜杠或控制字符)
+	errInvalidPath = errors.New("invalid request path")
+	// errPathNotAllowed 请求路径不在后端允许的路径前缀内
+	errPathNotAllowed = errors.New("request path not allowed")
+)
+
+// checkPath 校验解密后的请求路径，拒绝路径穿越，配置 allowed 时只允许其中的前缀
+// 校验解码后的路径，%2e%2e 等编码形式同样被拒绝
+func checkPath(u *url.URL, allowed []string) error {
+	p := u.Path
+	if !strings.HasPrefix(p, "/") || strings.ContainsAny(p, "\\") {
+		return errInvalidPath
+	}
+	for _, r := range p {
+		if r < 0x20 || r == 0x7f {
+			return errInvalidPath
+		}
+	}
+	for _, seg := range strings.Split(p[1:], "/") {
+		if seg == "." || seg == ".." {
+			return errInvalidPath
+		}
+	}
+
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, prefix := range allowed {
+		if pathHasPrefix(p, prefix) {
+			return nil
+		}
+	}
+	return errPathNotAllowed
+}
+
+// pathHasPrefix 按路径段匹配前缀: /v1/chat 匹配 /v1/chat 和 /v1/chat/completions，不匹配 /v1/chatx
+// 以 / 结尾的前缀匹配其下所有路径
+func pathHasPrefix(p, prefix string) bool {
+	if !strings.HasPrefix(p, prefix) {
+		return false
+	}
+	return len(p) == len(prefix) || strings.HasSuffix(prefix, "/") || p[len(prefix)] == '/'
+}
+
+// pathErrorResponse 路径校验失败时返回给调用方的错误响应 (不转发到后端)
+func pathErrorResponse(err error) *http.Response {
+	if errors.Is(err, errPathNotAllowed) {
+		return newErrorResponse(http.StatusForbidden, openai.ErrorDetail{
+			Message: err.Error(),
+			Type:    "invalid_request_error",
+			Code:    "path_not_allowed",
+		})
+	}
+	return newErrorResponse(http.StatusBadRequest, openai.ErrorDetail{
+		Message: err.Error(),
+		Type:    "invalid_request_error",
+		Code:    "invalid_path",
+	})
+}
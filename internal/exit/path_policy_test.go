@@ -0,0 +1,102 @@
+package exit
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckPath_Traversal(t *testing.T) {
+	for _, raw := range []string{
+		"/v1/../admin",
+		"/v1/chat/completions/..",
+		"/./v1/models",
+		"/v1/%2e%2e/admin",
+		"/v1/%2E%2E%2Fadmin",
+		"/v1\\..\\admin",
+		"/v1/models%00",
+	} {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("url.Parse(%q): %v", raw, err)
+		}
+		if err := checkPath(u, nil); !errors.Is(err, errInvalidPath) {
+			t.Errorf("checkPath(%q) = %v, want errInvalidPath", raw, err)
+		}
+	}
+
+	u, _ := url.Parse("/v1/chat/completions")
+	if err := checkPath(u, nil); err != nil {
+		t.Errorf("checkPath(/v1/chat/completions) = %v, want nil", err)
+	}
+}
+
+func TestCheckPath_AllowedPrefixes(t *testing.T) {
+	allowed := []string{"/v1/chat", "/v1/models/"}
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"/v1/chat", nil},
+		{"/v1/chat/completions", nil},
+		{"/v1/models/llama3", nil},
+		{"/v1/chatx", errPathNotAllowed},
+		{"/v1/models", errPathNotAllowed},
+		{"/v1/embeddings", errPathNotAllowed},
+		{"/admin", errPathNotAllowed},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.path)
+		if err := checkPath(u, allowed); !errors.Is(err, tt.want) {
+			t.Errorf("checkPath(%q) = %v, want %v", tt.path, err, tt.want)
+		}
+	}
+}
+
+func TestAIClient_Forward_RejectsDisallowedPaths(t *testing.T) {
+	var calls atomic.Int32
+	var gotPath string
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		gotPath = r.URL.EscapedPath()
+		w.WriteHeader(http.StatusOK)
+	})
+	client.SetAllowedPaths([]string{"/v1/chat"})
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/v1/chat/../../admin", http.StatusBadRequest},
+		{"/v1/chat/%2e%2e/%2e%2e/admin", http.StatusBadRequest},
+		{"/v1/embeddings", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "http://dummy"+tt.path, strings.NewReader(`{"model":"m"}`))
+		resp, err := client.Forward(req)
+		if err != nil {
+			t.Fatalf("Forward(%q) failed: %v", tt.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("Forward(%q) status = %d, want %d", tt.path, resp.StatusCode, tt.status)
+		}
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("rejected requests reached the backend %d times", calls.Load())
+	}
+
+	// 允许的路径正常转发，编码字符保持原样
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions%3Fx", strings.NewReader(`{"model":"m"}`))
+	resp, err := client.Forward(req)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || gotPath != "/v1/chat/completions%3Fx" {
+		t.Errorf("status = %d, backend path = %q, want 200 and escaped path preserved", resp.StatusCode, gotPath)
+	}
+}
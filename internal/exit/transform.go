@@ -0,0 +1,86 @@
+package exit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/binn/tokengo/internal/config"
+)
+
+// ModelVariantHeader 响应头: 实际处理请求的模型版本
+const ModelVariantHeader = "X-TokenGo-Model-Variant"
+
+// RequestTransformer 请求改写钩子，在转发到 AI 后端前改写请求体
+// 返回改写后的请求体和需要附加到响应上的 headers (可为 nil)
+type RequestTransformer interface {
+	Transform(body []byte) ([]byte, map[string]string, error)
+}
+
+// ModelSplitter 按配置比例在模型版本间拆分流量
+type ModelSplitter struct {
+	splits map[string]config.ModelSplit
+	random func() float64 // 返回 [0, 1)，测试可替换
+}
+
+// NewModelSplitter 创建模型流量拆分器
+func NewModelSplitter(splits []config.ModelSplit) (*ModelSplitter, error) {
+	m := &ModelSplitter{
+		splits: make(map[string]config.ModelSplit, len(splits)),
+		random: rand.Float64,
+	}
+	for _, s := range splits {
+		if s.Model == "" || s.Canary == "" {
+			return nil, fmt.Errorf("模型拆分配置缺少 model 或 canary")
+		}
+		if s.CanaryPercent < 0 || s.CanaryPercent > 100 {
+			return nil, fmt.Errorf("模型 %s 的 canary_percent 超出范围: %v", s.Model, s.CanaryPercent)
+		}
+		if s.Primary == "" {
+			s.Primary = s.Model
+		}
+		m.splits[s.Model] = s
+	}
+	return m, nil
+}
+
+// Transform 按权重随机选择模型版本并改写请求体中的 model 字段
+// 非 JSON 或未配置拆分的模型原样返回
+func (m *ModelSplitter) Transform(body []byte) ([]byte, map[string]string, error) {
+	if len(body) == 0 || len(m.splits) == 0 {
+		return body, nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body, nil, nil
+	}
+
+	var model string
+	if raw, ok := fields["model"]; !ok || json.Unmarshal(raw, &model) != nil {
+		return body, nil, nil
+	}
+
+	split, ok := m.splits[model]
+	if !ok {
+		return body, nil, nil
+	}
+
+	variant := split.Primary
+	if m.random()*100 < split.CanaryPercent {
+		variant = split.Canary
+	}
+
+	rawModel, err := json.Marshal(variant)
+	if err != nil {
+		return nil, nil, fmt.Errorf("编码模型名失败: %w", err)
+	}
+	fields["model"] = rawModel
+
+	newBody, err := json.Marshal(fields)
+	if err != nil {
+		return nil, nil, fmt.Errorf("改写请求体失败: %w", err)
+	}
+
+	return newBody, map[string]string{ModelVariantHeader: variant}, nil
+}
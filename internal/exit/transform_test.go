@@ -0,0 +1,122 @@
+package exit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/binn/tokengo/internal/config"
+)
+
+func TestModelSplitter_Distribution(t *testing.T) {
+	splitter, err := NewModelSplitter([]config.ModelSplit{
+		{Model: "gpt-4", Primary: "gpt-4-v1", Canary: "gpt-4-v2", CanaryPercent: 20},
+	})
+	if err != nil {
+		t.Fatalf("NewModelSplitter failed: %v", err)
+	}
+
+	const n = 10000
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		body, headers, err := splitter.Transform([]byte(`{"model":"gpt-4","messages":[]}`))
+		if err != nil {
+			t.Fatalf("Transform failed: %v", err)
+		}
+
+		var req struct {
+			Model string `json:"model"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatalf("rewritten body invalid: %v", err)
+		}
+		if headers[ModelVariantHeader] != req.Model {
+			t.Fatalf("variant tag = %q, want %q", headers[ModelVariantHeader], req.Model)
+		}
+		counts[req.Model]++
+	}
+
+	if counts["gpt-4-v1"]+counts["gpt-4-v2"] != n {
+		t.Fatalf("unexpected models: %v", counts)
+	}
+	canaryPct := float64(counts["gpt-4-v2"]) / n * 100
+	if math.Abs(canaryPct-20) > 2 {
+		t.Errorf("canary share = %.2f%%, want 20%% ± 2%%", canaryPct)
+	}
+}
+
+func TestModelSplitter_Passthrough(t *testing.T) {
+	splitter, err := NewModelSplitter([]config.ModelSplit{
+		{Model: "gpt-4", Canary: "gpt-4-v2", CanaryPercent: 100},
+	})
+	if err != nil {
+		t.Fatalf("NewModelSplitter failed: %v", err)
+	}
+
+	for _, body := range []string{`{"model":"other"}`, `not json`, ``} {
+		got, headers, err := splitter.Transform([]byte(body))
+		if err != nil {
+			t.Fatalf("Transform(%q) failed: %v", body, err)
+		}
+		if string(got) != body || headers != nil {
+			t.Errorf("Transform(%q) = %q, %v; want unchanged", body, got, headers)
+		}
+	}
+
+	// Primary 未配置时默认为原模型
+	splitter.random = func() float64 { return 0.999 }
+	splitter.splits["gpt-4"] = config.ModelSplit{Model: "gpt-4", Primary: "gpt-4", Canary: "gpt-4-v2", CanaryPercent: 50}
+	_, headers, _ := splitter.Transform([]byte(`{"model":"gpt-4"}`))
+	if headers[ModelVariantHeader] != "gpt-4" {
+		t.Errorf("variant = %q, want gpt-4", headers[ModelVariantHeader])
+	}
+}
+
+func TestNewModelSplitter_Invalid(t *testing.T) {
+	tests := []config.ModelSplit{
+		{Canary: "b", CanaryPercent: 10},
+		{Model: "a", CanaryPercent: 10},
+		{Model: "a", Canary: "b", CanaryPercent: 120},
+		{Model: "a", Canary: "b", CanaryPercent: -1},
+	}
+	for _, split := range tests {
+		if _, err := NewModelSplitter([]config.ModelSplit{split}); err == nil {
+			t.Errorf("NewModelSplitter(%+v) should fail", split)
+		}
+	}
+}
+
+func TestAIClient_Forward_ModelSplit(t *testing.T) {
+	var gotModel string
+	client, _ := newTestAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		gotModel = req.Model
+		w.WriteHeader(http.StatusOK)
+	})
+
+	splitter, _ := NewModelSplitter([]config.ModelSplit{
+		{Model: "llama3", Canary: "llama3.1", CanaryPercent: 100},
+	})
+	client.AddTransformer(splitter)
+
+	req, _ := http.NewRequest("POST", "http://dummy/v1/chat/completions", bytes.NewReader([]byte(`{"model":"llama3"}`)))
+	resp, err := client.Forward(req)
+	if err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if gotModel != "llama3.1" {
+		t.Errorf("backend model = %q, want llama3.1", gotModel)
+	}
+	if v := resp.Header.Get(ModelVariantHeader); v != "llama3.1" {
+		t.Errorf("%s = %q, want llama3.1", ModelVariantHeader, v)
+	}
+}
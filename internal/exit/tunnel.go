@@ -3,14 +3,21 @@ package exit
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"math"
+	"math/rand/v2"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/binn/tokengo/internal/bootstrap"
 	"github.com/binn/tokengo/internal/cert"
+	"github.com/binn/tokengo/internal/config"
 	"github.com/binn/tokengo/internal/dht"
+	"github.com/binn/tokengo/internal/logging"
+	"github.com/binn/tokengo/internal/metrics"
 	"github.com/binn/tokengo/internal/netutil"
 	"github.com/binn/tokengo/internal/protocol"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -23,50 +30,290 @@ type TunnelClient struct {
 	discovery       *dht.Discovery
 	staticRelayAddr string // 静态 Relay 地址（用于 serve 命令）
 	pubKeyHash      string
-	keyConfig       []byte // OHTTP KeyConfig (注册时发送给 Relay)
+	keyConfig       []byte               // OHTTP KeyConfig (注册时发送给 Relay)
+	capabilities    []string             // 通告的端点族 (注册时附带，为空表示不通告)
+	requestTimeout  time.Duration        // 通告的推荐请求超时 (注册时附带，0 表示不通告)
+	advertise       config.ExitAdvertise // 通告的选择权重和可服务模型 (注册时附带)
+	streamSlots     chan struct{}        // 并发请求流信号量，nil 表示不限制
+	streamPool      *streamPool          // 入站流处理池，worker 和队列均满时拒绝新流
+	activeRequests  atomic.Int64         // 各连接上进行中的请求数 (心跳据此通告负载)
 	ohttpHandler    *OHTTPHandler
+	metrics         metrics.Sink
+	logger          logging.Logger
 	conn            quic.Connection
+	serving         map[*tunnelConn]struct{} // 仍在接收新请求的连接 (回收时新旧连接短暂并存)
 	connMu          sync.Mutex
 	ctx             context.Context
 	cancel          context.CancelFunc
 	activeRelayAddr string
+	protocolVersion uint8 // 与当前 Relay 协商的协议版本
 	currentRelayID  peer.ID
 	ready           chan struct{}
 	readyOnce       sync.Once
+
+	discoverFn func(ctx context.Context) ([]peer.AddrInfo, error) // Relay 发现实现，nil 时使用 discovery
+	bootstrap  *bootstrap.Client                                  // DHT 发现失败或为空时的备用 Relay 来源，nil 表示不回退
+
+	probeConcurrency int // 并行探测 Relay 的最大并发数
+	probeFn          func(ctx context.Context, addr string, peerID peer.ID) (time.Duration, error)
+	addrFamily       netutil.AddrFamily     // Relay 同时通告 IPv4/IPv6 时的拨号偏好
+	quicParams       config.QUICParams      // 反向隧道的 QUIC 保活参数
+	sessionCache     tls.ClientSessionCache // TLS 会话票据，重连同一 Relay 时恢复会话
+
+	rttMu   sync.Mutex
+	rttConn quic.Connection // rtt 测量所在的连接，切换 Relay 后重新测量
+	rtt     time.Duration   // 流心跳往返时间的滑动平均
+
+	maxRegisterAttempts int           // 连续注册失败上限，0 表示无限重试
+	registerFailures    int           // 当前连续注册失败次数
+	initialBackoff      time.Duration // 首次注册的初始退避时间
 }
 
+// ErrRegistrationExhausted 连续注册失败次数达到上限，没有 Relay 接受此 Exit
+var ErrRegistrationExhausted = errors.New("没有 Relay 接受注册")
+
+const (
+	// defaultProbeConcurrency 默认并行探测 Relay 的并发上限
+	defaultProbeConcurrency = 4
+	// probeTimeout 整轮 Relay 探测的截止时间
+	probeTimeout = 10 * time.Second
+	// recycleRetryInterval 回收连接时建立新连接失败后的重试间隔
+	recycleRetryInterval = 30 * time.Second
+	// drainNotifyTimeout 等待 Relay 处理回收通知的超时
+	drainNotifyTimeout = 5 * time.Second
+	// retireCloseDelay 旧连接上的流全部完成后，关闭连接前等待最后的响应数据送达的时间
+	retireCloseDelay = time.Second
+)
+
 // NewTunnelClient 创建反向隧道客户端（DHT 发现模式）
 func NewTunnelClient(discovery *dht.Discovery, pubKeyHash string, keyConfig []byte, ohttpHandler *OHTTPHandler) *TunnelClient {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &TunnelClient{
-		discovery:    discovery,
-		pubKeyHash:   pubKeyHash,
-		keyConfig:    keyConfig,
-		ohttpHandler: ohttpHandler,
-		ctx:          ctx,
-		cancel:       cancel,
-		ready:        make(chan struct{}),
+	t := &TunnelClient{
+		discovery:        discovery,
+		pubKeyHash:       pubKeyHash,
+		keyConfig:        keyConfig,
+		ohttpHandler:     ohttpHandler,
+		ctx:              ctx,
+		cancel:           cancel,
+		metrics:          metrics.Nop{},
+		logger:           logging.New("exit").With(logging.KeyExitHash, pubKeyHash),
+		ready:            make(chan struct{}),
+		probeConcurrency: defaultProbeConcurrency,
+		initialBackoff:   3 * time.Second,
+		quicParams:       config.DefaultExitQUICParams(),
+		sessionCache:     cert.NewSessionCache(),
+		streamPool:       newStreamPool(0, 0),
 	}
+	t.probeFn = t.probeRelay
+	return t
 }
 
 // NewTunnelClientStatic 创建反向隧道客户端（静态地址模式，用于 serve 命令）
 func NewTunnelClientStatic(relayAddr string, pubKeyHash string, keyConfig []byte, ohttpHandler *OHTTPHandler) *TunnelClient {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &TunnelClient{
-		staticRelayAddr: relayAddr,
-		pubKeyHash:      pubKeyHash,
-		keyConfig:       keyConfig,
-		ohttpHandler:    ohttpHandler,
-		ctx:             ctx,
-		cancel:          cancel,
-		ready:           make(chan struct{}),
+	t := &TunnelClient{
+		staticRelayAddr:  relayAddr,
+		pubKeyHash:       pubKeyHash,
+		keyConfig:        keyConfig,
+		ohttpHandler:     ohttpHandler,
+		ctx:              ctx,
+		cancel:           cancel,
+		metrics:          metrics.Nop{},
+		logger:           logging.New("exit").With(logging.KeyExitHash, pubKeyHash),
+		ready:            make(chan struct{}),
+		probeConcurrency: defaultProbeConcurrency,
+		initialBackoff:   3 * time.Second,
+		quicParams:       config.DefaultExitQUICParams(),
+		sessionCache:     cert.NewSessionCache(),
+		streamPool:       newStreamPool(0, 0),
+	}
+	t.probeFn = t.probeRelay
+	return t
+}
+
+// SetBootstrapFallback 设置备用 Relay 来源: DHT 发现失败或未发现 Relay 时，从 bootstrap.json 的 relays 列表选择 Relay
+// (用于 DHT 被屏蔽的网络)；nil 表示不回退 (默认)
+func (t *TunnelClient) SetBootstrapFallback(b *bootstrap.Client) {
+	t.bootstrap = b
+}
+
+// SetMaxRegisterAttempts 设置连续注册失败上限 (<=0 表示无限重试)
+// 达到上限后 Start 返回 ErrRegistrationExhausted，便于运维发现 Exit 无法加入网络
+func (t *TunnelClient) SetMaxRegisterAttempts(n int) {
+	if n < 0 {
+		n = 0
+	}
+	t.maxRegisterAttempts = n
+}
+
+// SetCapabilities 设置注册时通告的端点族，为空表示不通告 (Client 视为支持全部端点)
+func (t *TunnelClient) SetCapabilities(caps []string) {
+	t.capabilities = caps
+}
+
+// SetAdvertise 设置注册时通告的选择权重和可服务模型
+func (t *TunnelClient) SetAdvertise(adv config.ExitAdvertise) {
+	adv.Weight = max(adv.Weight, 0)
+	t.advertise = adv
+}
+
+// SetRequestTimeout 设置注册时通告的推荐请求超时，0 表示不通告 (Client 使用全局超时)
+func (t *TunnelClient) SetRequestTimeout(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	t.requestTimeout = d
+}
+
+// SetMaxConcurrentStreams 设置同时处理的请求流上限 (注册时一并通告给 Relay)，0 表示不限制
+func (t *TunnelClient) SetMaxConcurrentStreams(n int) {
+	if n <= 0 {
+		t.streamSlots = nil
+		return
+	}
+	t.streamSlots = make(chan struct{}, n)
+}
+
+// SetStreamPool 设置入站流处理池的 worker 数和等待队列长度
+// workers <= 0 时按 CPU 数取默认值 (每 CPU 64 个)，queue <= 0 时与 workers 相同
+func (t *TunnelClient) SetStreamPool(workers, queue int) {
+	t.streamPool = newStreamPool(workers, queue)
+}
+
+// acquireStreamSlot 非阻塞地占用一个请求流名额，返回释放函数；名额已满时返回 false
+func (t *TunnelClient) acquireStreamSlot() (func(), bool) {
+	if t.streamSlots == nil {
+		return func() {}, true
+	}
+	select {
+	case t.streamSlots <- struct{}{}:
+		return func() { <-t.streamSlots }, true
+	default:
+		return nil, false
 	}
 }
 
+// currentLoad 返回通告的负载百分比: 进行中的请求数占额定并发数的比例
+// 额定并发数取 advertise.capacity，未配置时取 max_concurrent_streams；两者均未配置时返回 false (不通告负载)
+func (t *TunnelClient) currentLoad() (int, bool) {
+	capacity := t.advertise.Capacity
+	if capacity <= 0 {
+		capacity = cap(t.streamSlots)
+	}
+	if capacity <= 0 {
+		return 0, false
+	}
+	return min(int(t.activeRequests.Load()*100/int64(capacity)), 100), true
+}
+
+// heartbeatMessage 创建心跳消息，可计算负载时附带当前负载，已测得往返时间时一并附带
+func (t *TunnelClient) heartbeatMessage() *protocol.Message {
+	var load *int
+	if l, ok := t.currentLoad(); ok {
+		load = &l
+	}
+	rtt := t.HeartbeatRTT()
+	if load == nil && rtt == 0 {
+		return protocol.NewHeartbeatMessage()
+	}
+	return protocol.NewExitHeartbeatStatusMessage(load, rtt)
+}
+
+// heartbeatRTTWeight 新样本在往返时间滑动平均中的权重 (同 TCP SRTT 的 1/8)
+const heartbeatRTTWeight = 8
+
+// recordHeartbeatRTT 记录一次流心跳的往返时间，连接变化后从新样本重新开始平均
+func (t *TunnelClient) recordHeartbeatRTT(conn quic.Connection, sample time.Duration) {
+	t.rttMu.Lock()
+	if conn != t.rttConn || t.rtt == 0 {
+		t.rttConn, t.rtt = conn, sample
+	} else {
+		t.rtt += (sample - t.rtt) / heartbeatRTTWeight
+	}
+	t.rttMu.Unlock()
+	t.metrics.Timing(metrics.ExitHeartbeatRTT, sample)
+}
+
+// HeartbeatRTT 返回与当前 Relay 的心跳往返时间滑动平均，尚未测得 (或以 datagram 发送心跳) 时返回 0
+func (t *TunnelClient) HeartbeatRTT() time.Duration {
+	t.connMu.Lock()
+	conn := t.conn
+	t.connMu.Unlock()
+
+	t.rttMu.Lock()
+	defer t.rttMu.Unlock()
+	if conn == nil || conn != t.rttConn {
+		return 0
+	}
+	return t.rtt
+}
+
+// SetMetrics 设置指标输出 (请求次数、失败数和处理耗时)
+func (t *TunnelClient) SetMetrics(sink metrics.Sink) {
+	if sink == nil {
+		sink = metrics.Nop{}
+	}
+	t.metrics = sink
+}
+
+// SetLogger 设置日志输出，默认为附加本 Exit 公钥哈希的 exit 组件日志
+func (t *TunnelClient) SetLogger(logger logging.Logger) {
+	t.logger = logger
+}
+
+// ProtocolVersion 返回与当前 Relay 协商的协议版本，未注册时返回 0
+func (t *TunnelClient) ProtocolVersion() uint8 {
+	t.connMu.Lock()
+	defer t.connMu.Unlock()
+	return t.protocolVersion
+}
+
+// RegisterFailures 返回当前连续注册失败次数
+func (t *TunnelClient) RegisterFailures() int {
+	t.connMu.Lock()
+	defer t.connMu.Unlock()
+	return t.registerFailures
+}
+
+// recordRegisterResult 记录一次注册结果，连续失败达到上限时返回 ErrRegistrationExhausted
+func (t *TunnelClient) recordRegisterResult(err error) error {
+	t.connMu.Lock()
+	defer t.connMu.Unlock()
+
+	if err == nil {
+		t.registerFailures = 0
+		return nil
+	}
+	t.registerFailures++
+	if t.maxRegisterAttempts > 0 && t.registerFailures >= t.maxRegisterAttempts {
+		return fmt.Errorf("%w: 连续 %d 次注册失败，最后错误: %v", ErrRegistrationExhausted, t.registerFailures, err)
+	}
+	return nil
+}
+
+// SetProbeConcurrency 设置并行探测 Relay 的最大并发数 (<=0 使用默认值)
+func (t *TunnelClient) SetProbeConcurrency(n int) {
+	if n <= 0 {
+		n = defaultProbeConcurrency
+	}
+	t.probeConcurrency = n
+}
+
+// SetAddressFamily 设置 Relay 同时通告 IPv4/IPv6 时的拨号偏好
+// happy-eyeballs 模式下对两个地址族竞速探测，使用先完成握手的地址
+func (t *TunnelClient) SetAddressFamily(f netutil.AddrFamily) {
+	t.addrFamily = f
+}
+
+// SetQUICParams 设置反向隧道的 QUIC 保活参数，未设置的字段使用 Exit 默认值
+func (t *TunnelClient) SetQUICParams(p config.QUICParams) {
+	t.quicParams = p.WithDefaults(config.DefaultExitQUICParams())
+}
+
 // Start 启动反向隧道
 func (t *TunnelClient) Start(ctx context.Context) error {
 	// 1. 带重试的初始连接
-	backoff := 3 * time.Second
+	backoff := t.initialBackoff
 	const maxBackoff = 60 * time.Second
 
 	for {
@@ -79,9 +326,14 @@ func (t *TunnelClient) Start(ctx context.Context) error {
 		// 选择最佳 Relay
 		addr, peerID, err := t.selectRelay(t.ctx)
 		if err != nil {
-			log.Printf("选择 Relay 失败: %v，%v 后重试...", err, backoff)
+			if exhausted := t.recordRegisterResult(err); exhausted != nil {
+				t.logger.Error("注册失败次数已达上限", logging.KeyError, exhausted)
+				return exhausted
+			}
+			wait := fullJitter(backoff)
+			t.logger.Warn("选择 Relay 失败，稍后重试", logging.KeyError, err, "backoff", wait.String())
 			select {
-			case <-time.After(backoff):
+			case <-time.After(wait):
 				backoff = nextBackoff(backoff, maxBackoff)
 				continue
 			case <-t.ctx.Done():
@@ -89,13 +341,18 @@ func (t *TunnelClient) Start(ctx context.Context) error {
 			}
 		}
 
-		log.Printf("选择 Relay: %s", addr)
+		t.logger.Info("选择 Relay", logging.KeyRelay, addr, logging.KeyPeerID, peerID.String())
 
 		// 连接并注册
 		if err := t.connectAndRegister(t.ctx, addr, peerID); err != nil {
-			log.Printf("连接 Relay %s 失败: %v，%v 后重试...", addr, err, backoff)
+			if exhausted := t.recordRegisterResult(err); exhausted != nil {
+				t.logger.Error("注册失败次数已达上限", logging.KeyError, exhausted)
+				return exhausted
+			}
+			wait := fullJitter(backoff)
+			t.logger.Warn("连接 Relay 失败，稍后重试", logging.KeyRelay, addr, logging.KeyError, err, "backoff", wait.String())
 			select {
-			case <-time.After(backoff):
+			case <-time.After(wait):
 				backoff = nextBackoff(backoff, maxBackoff)
 				continue
 			case <-t.ctx.Done():
@@ -103,19 +360,47 @@ func (t *TunnelClient) Start(ctx context.Context) error {
 			}
 		}
 
-		log.Printf("已注册到 Relay %s (pubKeyHash=%s)", addr, t.pubKeyHash)
+		t.logger.Info("已注册到 Relay", logging.KeyRelay, addr, logging.KeyPeerID, peerID.String(), "protocol_version", t.ProtocolVersion())
+		t.recordRegisterResult(nil)
 		t.currentRelayID = peerID
 		t.readyOnce.Do(func() { close(t.ready) })
 		break
 	}
 
 	// 2. 启动心跳和流接收 goroutine
+	current := t.serve()
+
+	// 3. 启动重连循环 (阻塞)
+	return t.reconnectLoop(current)
+}
+
+// tunnelConn 一条已注册的隧道连接及其心跳和流接收 goroutine
+type tunnelConn struct {
+	conn      quic.Connection
+	cancel    context.CancelFunc // 停止该连接的心跳和流接收
+	accepting chan struct{}      // acceptStreams 退出时关闭
+	inflight  sync.WaitGroup     // 该连接上正在处理的流
+	expiresAt time.Time          // 达到最长存活时间的时刻，零值表示不限制
+}
+
+// serve 为当前已注册的连接启动心跳和流接收
+func (t *TunnelClient) serve() *tunnelConn {
 	// 在锁保护下捕获 conn 值，避免数据竞争
 	t.connMu.Lock()
 	conn := t.conn
 	t.connMu.Unlock()
 
 	connCtx, connCancel := context.WithCancel(t.ctx)
+	tc := &tunnelConn{conn: conn, cancel: connCancel, accepting: make(chan struct{})}
+	if t.quicParams.MaxLifetime > 0 {
+		tc.expiresAt = time.Now().Add(t.quicParams.MaxLifetime)
+	}
+	t.connMu.Lock()
+	if t.serving == nil {
+		t.serving = make(map[*tunnelConn]struct{})
+	}
+	t.serving[tc] = struct{}{}
+	t.connMu.Unlock()
 	go func() {
 		// 当 QUIC 连接断开或 Stop() 被调用时取消 connCtx
 		select {
@@ -123,13 +408,11 @@ func (t *TunnelClient) Start(ctx context.Context) error {
 		case <-t.ctx.Done():
 		}
 		connCancel()
+		t.stopServing(tc)
 	}()
 	go t.heartbeatLoop(connCtx)
-	go t.acceptStreams(connCtx, conn)
-
-	// 3. 启动重连循环 (阻塞)
-	t.reconnectLoop()
-	return nil
+	go t.acceptStreams(connCtx, tc)
+	return tc
 }
 
 // selectRelay 选择 Relay 节点（静态地址或 DHT 发现）
@@ -140,47 +423,110 @@ func (t *TunnelClient) selectRelay(ctx context.Context) (string, peer.ID, error)
 	}
 
 	// DHT 发现模式
-	if t.discovery == nil {
-		return "", "", fmt.Errorf("DHT 未启用，无法发现 Relay 节点")
+	relays, err := t.discoverRelays(ctx)
+	if err == nil && len(relays) == 0 {
+		err = fmt.Errorf("DHT 未发现任何 Relay 节点")
 	}
-
-	relays, err := t.discovery.DiscoverRelays(ctx)
 	if err != nil {
-		return "", "", fmt.Errorf("DHT 发现 Relay 失败: %w", err)
-	}
-	if len(relays) == 0 {
-		return "", "", fmt.Errorf("DHT 未发现任何 Relay 节点")
+		if t.bootstrap == nil {
+			return "", "", err
+		}
+		// DHT 被屏蔽或超时: 回退到 Bootstrap 列表中的 Relay
+		t.logger.Warn("DHT 发现 Relay 失败，回退到 Bootstrap Relay 列表", logging.KeyError, err)
+		if relays, err = t.bootstrap.FetchRelays(ctx); err != nil {
+			return "", "", fmt.Errorf("从 Bootstrap 获取 Relay 失败: %w", err)
+		}
+		if len(relays) == 0 {
+			return "", "", fmt.Errorf("DHT 和 Bootstrap 均未发现任何 Relay 节点")
+		}
+		t.logger.Info("从 Bootstrap 获取 Relay 节点", "count", len(relays))
+	} else {
+		t.logger.Info("从 DHT 发现 Relay 节点", "count", len(relays))
 	}
 
-	log.Printf("从 DHT 发现 %d 个 Relay 节点", len(relays))
-
 	// 从 peer.AddrInfo 提取地址并探测 RTT
 	return t.selectBestRelay(ctx, relays)
 }
 
+// discoverRelays 通过 DHT 发现 Relay 节点
+func (t *TunnelClient) discoverRelays(ctx context.Context) ([]peer.AddrInfo, error) {
+	if t.discoverFn != nil {
+		return t.discoverFn(ctx)
+	}
+	if t.discovery == nil {
+		return nil, fmt.Errorf("DHT 未启用，无法发现 Relay 节点")
+	}
+	relays, err := t.discovery.DiscoverRelays(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("DHT 发现 Relay 失败: %w", err)
+	}
+	return relays, nil
+}
+
 // selectBestRelay 从 DHT 发现的 Relay 中选择延迟最低的
+// 以 probeConcurrency 为上限并行探测，所有探测完成或到达截止时间后从已完成的结果中选择
 func (t *TunnelClient) selectBestRelay(ctx context.Context, relays []peer.AddrInfo) (string, peer.ID, error) {
-	var bestAddr string
-	var bestPeerID peer.ID
-	var bestRTT time.Duration
+	type probeResult struct {
+		addr   string
+		peerID peer.ID
+		rtt    time.Duration
+		err    error
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	results := make(chan probeResult, len(relays))
+	sem := make(chan struct{}, t.probeConcurrency)
+	pending := 0
 
 	for _, relay := range relays {
-		addr := netutil.ExtractQUICAddress(relay.Addrs)
-		if addr == "" {
+		addrs := netutil.ResolveQUICAddresses(ctx, relay.Addrs, t.addrFamily)
+		if len(addrs) == 0 {
 			continue
 		}
+		pending++
 
-		rtt, err := t.probeRelay(ctx, addr, relay.ID)
-		if err != nil {
-			log.Printf("探测 Relay %s 失败: %v", addr, err)
-			continue
-		}
+		go func(addrs []string, peerID peer.ID) {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results <- probeResult{addr: addrs[0], peerID: peerID, err: ctx.Err()}
+				return
+			}
+			rtt, addr, err := netutil.RaceDial(ctx, addrs, netutil.HappyEyeballsDelay,
+				func(ctx context.Context, addr string) (time.Duration, error) {
+					return t.probeFn(ctx, addr, peerID)
+				}, nil)
+			if err != nil {
+				addr = addrs[0]
+			}
+			results <- probeResult{addr: addr, peerID: peerID, rtt: rtt, err: err}
+		}(addrs, relay.ID)
+	}
+
+	var bestAddr string
+	var bestPeerID peer.ID
+	var bestRTT time.Duration
 
-		log.Printf("Relay %s RTT: %v", addr, rtt)
-		if bestAddr == "" || rtt < bestRTT {
-			bestAddr = addr
-			bestPeerID = relay.ID
-			bestRTT = rtt
+collect:
+	for ; pending > 0; pending-- {
+		select {
+		case r := <-results:
+			if r.err != nil {
+				t.logger.Warn("探测 Relay 失败", logging.KeyRelay, r.addr, logging.KeyError, r.err)
+				continue
+			}
+			t.logger.Info("Relay 探测完成", logging.KeyRelay, r.addr, "rtt", r.rtt.String())
+			if bestAddr == "" || r.rtt < bestRTT {
+				bestAddr = r.addr
+				bestPeerID = r.peerID
+				bestRTT = r.rtt
+			}
+		case <-ctx.Done():
+			t.logger.Warn("Relay 探测超时", "pending", pending)
+			break collect
 		}
 	}
 
@@ -220,74 +566,132 @@ func (t *TunnelClient) connectAndRegister(ctx context.Context, addr string, peer
 			MinVersion:         tls.VersionTLS13,
 		}
 	}
-
-	// 1. 建立 QUIC 连接
-	conn, err := quic.DialAddr(ctx, addr, tlsConfig, &quic.Config{
-		KeepAlivePeriod: 10 * time.Second,
-		MaxIdleTimeout:  60 * time.Second,
-	})
+	// 重连同一 Relay 时恢复 TLS 会话，省去完整握手
+	cert.UseSessionCache(tlsConfig, t.sessionCache, peerID)
+
+	// 1. 建立 QUIC 连接 (启用 0-RTT 时注册消息随握手一起发送)
+	quicConfig := &quic.Config{
+		KeepAlivePeriod: t.quicParams.KeepAlivePeriod,
+		MaxIdleTimeout:  t.quicParams.MaxIdleTimeout,
+		EnableDatagrams: t.quicParams.EnableDatagrams,
+	}
+	var conn quic.Connection
+	var err error
+	if t.quicParams.Enable0RTT {
+		conn, err = quic.DialAddrEarly(ctx, addr, tlsConfig, quicConfig)
+	} else {
+		conn, err = quic.DialAddr(ctx, addr, tlsConfig, quicConfig)
+	}
 	if err != nil {
 		return fmt.Errorf("QUIC 连接 Relay 失败: %w", err)
 	}
 
+	version, err := t.register(ctx, conn)
+	if errors.Is(err, quic.Err0RTTRejected) {
+		// Relay 拒绝 0-RTT (如重启后票据失效) 时丢弃了注册消息，在握手完成的连接上重新注册
+		conn = conn.(quic.EarlyConnection).NextConnection()
+		version, err = t.register(ctx, conn)
+	}
+	if err != nil {
+		conn.CloseWithError(1, "register failed")
+		return err
+	}
+
+	// 5. 保存连接
+	t.connMu.Lock()
+	t.conn = conn
+	t.activeRelayAddr = addr
+	t.protocolVersion = version
+	t.connMu.Unlock()
+
+	return nil
+}
+
+// register 在连接上发送注册消息并等待确认，返回协商的协议版本
+func (t *TunnelClient) register(ctx context.Context, conn quic.Connection) (uint8, error) {
 	// 2. 打开注册流
 	stream, err := conn.OpenStreamSync(ctx)
 	if err != nil {
-		conn.CloseWithError(1, "open stream failed")
-		return fmt.Errorf("打开注册流失败: %w", err)
+		return 0, fmt.Errorf("打开注册流失败: %w", err)
 	}
+	// 注册完成后关闭注册流
+	defer stream.Close()
 
-	// 3. 发送注册消息 (附带 KeyConfig)
-	regMsg := protocol.NewRegisterMessage(t.pubKeyHash, t.keyConfig)
-	if _, err := stream.Write(regMsg.Encode()); err != nil {
-		stream.Close()
-		conn.CloseWithError(1, "write register failed")
-		return fmt.Errorf("发送注册消息失败: %w", err)
+	// 3. 发送注册消息 (附带 KeyConfig 和端点能力)
+	t.connMu.Lock()
+	models := t.advertise.Models // 刷新后端模型列表时由 UpdateModels 更新
+	t.connMu.Unlock()
+	regMsg := protocol.NewRegisterMessage(t.pubKeyHash, protocol.EncodeRegisterPayload(t.keyConfig, protocol.ExitMetadata{
+		Capabilities:         t.capabilities,
+		RequestTimeout:       t.requestTimeout,
+		MaxConcurrentStreams: cap(t.streamSlots),
+		Weight:               t.advertise.Weight,
+		Models:               models,
+		Features:             []string{protocol.FeatureChunkedUpload, protocol.FeatureBinaryHTTP},
+	}))
+	if err := protocol.WriteMessage(stream, regMsg); err != nil {
+		return 0, fmt.Errorf("发送注册消息失败: %w", err)
 	}
 
 	// 4. 读取注册确认
 	ackMsg, err := protocol.Decode(stream)
 	if err != nil {
-		stream.Close()
-		conn.CloseWithError(1, "read register ack failed")
-		return fmt.Errorf("读取注册确认失败: %w", err)
+		return 0, fmt.Errorf("读取注册确认失败: %w", err)
 	}
 
+	if ackMsg.Type == protocol.MessageTypeError {
+		return 0, fmt.Errorf("Relay 拒绝注册: %s", ackMsg.Payload)
+	}
 	if ackMsg.Type != protocol.MessageTypeRegisterAck {
-		stream.Close()
-		conn.CloseWithError(1, "unexpected message type")
-		return fmt.Errorf("期望 RegisterAck，收到类型 0x%02x", ackMsg.Type)
+		return 0, fmt.Errorf("期望 RegisterAck，收到类型 0x%02x", ackMsg.Type)
 	}
 
-	// 5. 关闭注册流
-	stream.Close()
-
-	// 6. 保存连接
-	t.connMu.Lock()
-	t.conn = conn
-	t.activeRelayAddr = addr
-	t.connMu.Unlock()
-
-	return nil
+	// RegisterAck 负载携带 Relay 协商的版本，旧版 Relay 负载为空
+	var relayVersion uint8
+	if len(ackMsg.Payload) > 0 {
+		relayVersion = ackMsg.Payload[0]
+	}
+	version, err := protocol.NegotiateVersion(relayVersion)
+	if err != nil {
+		return 0, fmt.Errorf("Relay 协议版本不兼容: %w", err)
+	}
+	return version, nil
 }
 
 // acceptStreams 循环接收 Relay 转发过来的流
-func (t *TunnelClient) acceptStreams(ctx context.Context, conn quic.Connection) {
+func (t *TunnelClient) acceptStreams(ctx context.Context, tc *tunnelConn) {
+	defer close(tc.accepting)
 	for {
-		stream, err := conn.AcceptStream(ctx)
+		stream, err := tc.conn.AcceptStream(ctx)
 		if err != nil {
 			if ctx.Err() != nil {
 				// 上下文取消，正常退出
 				return
 			}
-			log.Printf("接收流失败 (连接可能已断开): %v", err)
+			t.logger.Warn("接收流失败 (连接可能已断开)", logging.KeyError, err)
 			return
 		}
 
-		go t.handleIncomingStream(stream)
+		tc.inflight.Add(1)
+		accepted := t.streamPool.Submit(func() {
+			defer tc.inflight.Done()
+			t.handleIncomingStream(stream)
+		})
+		if !accepted {
+			tc.inflight.Done()
+			t.rejectStream(stream)
+		}
 	}
 }
 
+// rejectStream 处理池已满时拒绝入站流: 不读取消息，直接返回 "too many requests"
+func (t *TunnelClient) rejectStream(stream quic.Stream) {
+	t.logger.Warn("流处理池已满，拒绝请求")
+	stream.CancelRead(0)
+	protocol.WriteMessage(stream, protocol.NewErrorMessage(protocol.ErrTooManyRequests))
+	stream.Close()
+}
+
 // handleIncomingStream 处理从 Relay 转发过来的单个流
 func (t *TunnelClient) handleIncomingStream(stream quic.Stream) {
 	defer stream.Close()
@@ -295,49 +699,93 @@ func (t *TunnelClient) handleIncomingStream(stream quic.Stream) {
 	// 1. 读取消息
 	msg, err := protocol.Decode(stream)
 	if err != nil {
-		log.Printf("解码入站消息失败: %v", err)
-		errMsg := protocol.NewErrorMessage(fmt.Sprintf("decode error: %v", err))
-		stream.Write(errMsg.Encode())
+		t.logger.Warn("解码入站消息失败", logging.KeyError, err)
+		errMsg := protocol.NewErrorMessage(fmt.Sprintf("%s: %v", protocol.ErrDecodePrefix, err))
+		protocol.WriteMessage(stream, errMsg)
 		return
 	}
 
-	// 2. 根据消息类型分发处理
+	// 2. 请求流受并发上限约束，超出时立即拒绝而不是排队 (心跳、排空通知不受限)
+	if msg.Type == protocol.MessageTypeRequest || msg.Type == protocol.MessageTypeStreamRequest {
+		release, ok := t.acquireStreamSlot()
+		if !ok {
+			errMsg := protocol.NewErrorMessage(protocol.ErrTooManyRequests)
+			protocol.WriteMessage(stream, errMsg)
+			return
+		}
+		defer release()
+		t.activeRequests.Add(1)
+		defer t.activeRequests.Add(-1)
+	}
+
+	// 3. 根据消息类型分发处理
 	switch msg.Type {
 	case protocol.MessageTypeRequest:
 		// 非流式请求
+		start := time.Now()
 		respBytes, err := t.ohttpHandler.ProcessRequest(msg.Payload)
+		t.observeRequest(start, err)
 		if err != nil {
-			log.Printf("处理请求失败: %v", err)
-			errMsg := protocol.NewErrorMessage(fmt.Sprintf("process error: %v", err))
-			stream.Write(errMsg.Encode())
+			t.logger.Warn("处理请求失败", logging.KeyError, err)
+			protocol.WriteMessage(stream, protocol.NewErrorMessage(errorReason(protocol.ErrProcessPrefix, err)))
 			return
 		}
 		respMsg := protocol.NewResponseMessage(respBytes)
-		if _, err := stream.Write(respMsg.Encode()); err != nil {
-			log.Printf("写回响应失败: %v", err)
+		if err := protocol.WriteMessage(stream, respMsg); err != nil {
+			t.logger.Warn("写回响应失败", logging.KeyError, err)
 		}
 
 	case protocol.MessageTypeStreamRequest:
 		// 流式请求，直接将加密的流式块写入 stream
-		if err := t.ohttpHandler.ProcessStreamRequest(msg.Payload, stream); err != nil {
-			log.Printf("处理流式请求失败: %v", err)
+		start := time.Now()
+		err := t.ohttpHandler.ProcessStreamRequest(msg.Payload, stream)
+		t.observeRequest(start, err)
+		if err != nil {
+			t.logger.Warn("处理流式请求失败", logging.KeyError, err)
 			// 尝试写入错误消息 (流可能已经部分写入)
-			errMsg := protocol.NewErrorMessage(fmt.Sprintf("stream error: %v", err))
-			stream.Write(errMsg.Encode())
+			protocol.WriteMessage(stream, protocol.NewErrorMessage(errorReason(protocol.ErrStreamPrefix, err)))
 		}
 
 	case protocol.MessageTypeHeartbeat:
 		// 备选心跳路径: Relay 发起的心跳
 		ackMsg := protocol.NewHeartbeatAckMessage()
-		if _, err := stream.Write(ackMsg.Encode()); err != nil {
-			log.Printf("写回心跳确认失败: %v", err)
+		if err := protocol.WriteMessage(stream, ackMsg); err != nil {
+			t.logger.Warn("写回心跳确认失败", logging.KeyError, err)
 		}
 
+	case protocol.MessageTypeDrain:
+		// Relay 即将关闭: 已转发的请求继续处理，连接关闭后由重连循环切换 Relay
+		t.logger.Info("Relay 正在排空，连接关闭后将重新选择 Relay")
+
 	default:
-		log.Printf("收到未知消息类型: 0x%02x", msg.Type)
-		errMsg := protocol.NewErrorMessage(fmt.Sprintf("unknown message type: 0x%02x", msg.Type))
-		stream.Write(errMsg.Encode())
+		t.logger.Warn("收到未知消息类型", "message_type", msg.Type)
+		errMsg := protocol.NewErrorMessage(fmt.Sprintf("%s: 0x%02x", protocol.ErrUnknownMessagePrefix, msg.Type))
+		protocol.WriteMessage(stream, errMsg)
+	}
+}
+
+// errorReason 请求处理失败时发给 Client 的错误原因: 可识别的错误使用协议定义的原因，其余为 "<prefix>: <详情>"
+func errorReason(prefix string, err error) string {
+	switch {
+	case errors.Is(err, ErrRequestTooLarge):
+		return protocol.ErrRequestTooLarge
+	case errors.Is(err, ErrDecryptRequest):
+		return protocol.ErrDecryptRequest
+	case errors.Is(err, ErrQueueTimeout):
+		return protocol.ErrQueueTimeout
+	case errors.Is(err, ErrAccessDenied):
+		return protocol.ErrAccessDenied
+	}
+	return fmt.Sprintf("%s: %v", prefix, err)
+}
+
+// observeRequest 记录一次请求处理的次数、失败数和耗时
+func (t *TunnelClient) observeRequest(start time.Time, err error) {
+	t.metrics.Count(metrics.ExitRequestTotal, 1)
+	if err != nil {
+		t.metrics.Count(metrics.ExitRequestErrors, 1)
 	}
+	t.metrics.Timing(metrics.ExitRequestDuration, time.Since(start))
 }
 
 // heartbeatLoop 定期发送心跳保持连接活跃
@@ -351,13 +799,14 @@ func (t *TunnelClient) heartbeatLoop(ctx context.Context) {
 			return
 		case <-ticker.C:
 			if err := t.sendHeartbeat(ctx); err != nil {
-				log.Printf("发送心跳失败: %v", err)
+				t.logger.Warn("发送心跳失败", logging.KeyError, err)
 			}
 		}
 	}
 }
 
 // sendHeartbeat 发送单次心跳
+// 与 Relay 协商了 QUIC datagram 时以 datagram 发送 (不等待确认)，否则或发送失败时回退到流
 func (t *TunnelClient) sendHeartbeat(ctx context.Context) error {
 	t.connMu.Lock()
 	conn := t.conn
@@ -367,6 +816,14 @@ func (t *TunnelClient) sendHeartbeat(ctx context.Context) error {
 		return fmt.Errorf("连接不可用")
 	}
 
+	if t.quicParams.EnableDatagrams && conn.ConnectionState().SupportsDatagrams {
+		err := conn.SendDatagram(t.heartbeatMessage().Encode())
+		if err == nil {
+			return nil
+		}
+		t.logger.Debug("datagram 心跳发送失败，回退到流", logging.KeyError, err)
+	}
+
 	hbCtx, hbCancel := context.WithTimeout(ctx, 5*time.Second)
 	defer hbCancel()
 
@@ -377,8 +834,9 @@ func (t *TunnelClient) sendHeartbeat(ctx context.Context) error {
 	defer stream.Close()
 
 	// 发送心跳
-	hbMsg := protocol.NewHeartbeatMessage()
-	if _, err := stream.Write(hbMsg.Encode()); err != nil {
+	hbMsg := t.heartbeatMessage()
+	sentAt := time.Now()
+	if err := protocol.WriteMessage(stream, hbMsg); err != nil {
 		return fmt.Errorf("写入心跳消息失败: %w", err)
 	}
 
@@ -391,26 +849,29 @@ func (t *TunnelClient) sendHeartbeat(ctx context.Context) error {
 	if ackMsg.Type != protocol.MessageTypeHeartbeatAck {
 		return fmt.Errorf("期望 HeartbeatAck，收到类型 0x%02x", ackMsg.Type)
 	}
+	t.recordHeartbeatRTT(conn, time.Since(sentAt))
 
 	return nil
 }
 
-// reconnectLoop 等待连接断开后进行指数退避重连
-func (t *TunnelClient) reconnectLoop() {
+// reconnectLoop 等待连接断开后进行指数退避重连，连接达到最长存活时间时优雅回收
+// 连续注册失败达到上限时返回 ErrRegistrationExhausted
+func (t *TunnelClient) reconnectLoop(current *tunnelConn) error {
 	for {
-		// 等待当前连接断开
-		t.connMu.Lock()
-		conn := t.conn
-		t.connMu.Unlock()
-
-		if conn != nil {
-			select {
-			case <-conn.Context().Done():
-				log.Printf("与 Relay %s 的连接断开，准备重连...", t.activeRelayAddr)
-			case <-t.ctx.Done():
-				return
+		// 等待当前连接断开或到期
+		disconnected, err := t.waitConn(current)
+		if err != nil || t.ctx.Err() != nil {
+			return nil
+		}
+		if !disconnected {
+			if next := t.recycle(current); next != nil {
+				current = next
+			} else {
+				current.expiresAt = time.Now().Add(recycleRetryInterval)
 			}
+			continue
 		}
+		t.logger.Warn("与 Relay 的连接断开，准备重连", logging.KeyRelay, t.activeRelayAddr)
 
 		// 指数退避重连
 		backoff := 1 * time.Second
@@ -419,61 +880,186 @@ func (t *TunnelClient) reconnectLoop() {
 		for {
 			select {
 			case <-t.ctx.Done():
-				return
+				return nil
 			default:
 			}
 
-			log.Printf("尝试重连 Relay (退避 %v)...", backoff)
+			// 随机化等待时间，避免 Relay 重启后所有 Exit 同时重连
+			wait := fullJitter(backoff)
+			t.logger.Info("尝试重连 Relay", "backoff", wait.String())
 
 			// 使用 select 替换 time.Sleep，以便响应 Stop()
 			select {
-			case <-time.After(backoff):
+			case <-time.After(wait):
 				// 继续退避
 			case <-t.ctx.Done():
-				return // 立即响应 shutdown
+				return nil // 立即响应 shutdown
 			}
 
 			// 重新选择 Relay
 			addr, peerID, err := t.selectRelay(t.ctx)
 			if err != nil {
-				log.Printf("选择 Relay 失败: %v", err)
+				if exhausted := t.recordRegisterResult(err); exhausted != nil {
+					t.logger.Error("注册失败次数已达上限", logging.KeyError, exhausted)
+					return exhausted
+				}
+				t.logger.Warn("选择 Relay 失败", logging.KeyError, err)
 				backoff = nextBackoff(backoff, maxBackoff)
 				continue
 			}
 
 			// 连接并注册
 			if err := t.connectAndRegister(t.ctx, addr, peerID); err != nil {
-				log.Printf("重连 Relay %s 失败: %v", addr, err)
+				if exhausted := t.recordRegisterResult(err); exhausted != nil {
+					t.logger.Error("注册失败次数已达上限", logging.KeyError, exhausted)
+					return exhausted
+				}
+				t.logger.Warn("重连 Relay 失败", logging.KeyRelay, addr, logging.KeyError, err)
 				backoff = nextBackoff(backoff, maxBackoff)
 				continue
 			}
 
-			log.Printf("重连成功，已重新注册到 Relay %s", addr)
+			t.logger.Info("重连成功，已重新注册到 Relay", logging.KeyRelay, addr, logging.KeyPeerID, peerID.String())
+			t.recordRegisterResult(nil)
 			t.currentRelayID = peerID
 
 			// 重连成功，重新启动心跳和流接收
-			// 在锁保护下捕获 conn 值，避免数据竞争
-			t.connMu.Lock()
-			conn := t.conn
-			t.connMu.Unlock()
-
-			connCtx, connCancel := context.WithCancel(t.ctx)
-			go func() {
-				// 当 QUIC 连接断开或 Stop() 被调用时取消 connCtx
-				select {
-				case <-conn.Context().Done():
-				case <-t.ctx.Done():
-				}
-				connCancel()
-			}()
-			go t.heartbeatLoop(connCtx)
-			go t.acceptStreams(connCtx, conn)
+			current = t.serve()
 
 			break // 退出退避循环，回到外层等待断开
 		}
 	}
 }
 
+// waitConn 等待连接断开 (返回 true) 或达到最长存活时间 (返回 false)，Stop 时返回错误
+func (t *TunnelClient) waitConn(tc *tunnelConn) (bool, error) {
+	var expired <-chan time.Time
+	if !tc.expiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(tc.expiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-tc.conn.Context().Done():
+		return true, nil
+	case <-expired:
+		return false, nil
+	case <-t.ctx.Done():
+		return false, t.ctx.Err()
+	}
+}
+
+// recycle 回收到期的连接: 先向同一 Relay 建立并注册新连接，再让旧连接排空后关闭
+// 建立新连接失败时保留旧连接并返回 nil，由调用方稍后重试
+func (t *TunnelClient) recycle(old *tunnelConn) *tunnelConn {
+	t.connMu.Lock()
+	addr := t.activeRelayAddr
+	t.connMu.Unlock()
+
+	t.logger.Info("隧道连接达到最长存活时间，开始回收", logging.KeyRelay, addr, "max_lifetime", t.quicParams.MaxLifetime.String())
+	if err := t.connectAndRegister(t.ctx, addr, t.currentRelayID); err != nil {
+		t.logger.Warn("回收时建立新连接失败，保留当前连接", logging.KeyRelay, addr, logging.KeyError, err)
+		return nil
+	}
+
+	next := t.serve()
+	go t.retire(old)
+	return next
+}
+
+// stopServing 将连接移出接收新请求的连接集合 (断开或开始回收时)
+func (t *TunnelClient) stopServing(tc *tunnelConn) {
+	t.connMu.Lock()
+	delete(t.serving, tc)
+	t.connMu.Unlock()
+}
+
+// retire 通知 Relay 不再向旧连接转发新请求，等待其上进行中的请求完成后关闭旧连接
+func (t *TunnelClient) retire(old *tunnelConn) {
+	t.stopServing(old)
+	ctx, cancel := context.WithTimeout(t.ctx, drainNotifyTimeout)
+	err := sendDrain(ctx, old.conn)
+	cancel()
+	if err != nil {
+		t.logger.Warn("通知 Relay 回收连接失败", logging.KeyError, err)
+	}
+
+	// Relay 已停止向旧连接转发，停止接收后等待进行中的流完成
+	old.cancel()
+	<-old.accepting
+	done := make(chan struct{})
+	go func() {
+		old.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		// CloseWithError 会丢弃尚未送达的响应数据，稍等片刻再关闭
+		select {
+		case <-time.After(retireCloseDelay):
+		case <-t.ctx.Done():
+		}
+	case <-t.ctx.Done():
+	}
+	old.conn.CloseWithError(0, "connection recycled")
+	t.logger.Info("旧隧道连接已排空并关闭")
+}
+
+// sendDrain 在连接上发送 Drain 消息，并等待 Relay 处理完成后关闭流
+func sendDrain(ctx context.Context, conn quic.Connection) error {
+	if err := sendControl(ctx, conn, protocol.NewDrainMessage()); err != nil {
+		return fmt.Errorf("通知回收失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateModels 更新通告的可服务模型: 之后的注册附带新列表，并立即通知每条仍在接收请求的连接
+func (t *TunnelClient) UpdateModels(ctx context.Context, models []string) error {
+	t.connMu.Lock()
+	t.advertise.Models = models
+	conns := make([]quic.Connection, 0, len(t.serving))
+	for tc := range t.serving {
+		conns = append(conns, tc.conn)
+	}
+	t.connMu.Unlock()
+	if len(conns) == 0 {
+		return nil
+	}
+
+	msg, err := protocol.NewUpdateModelsMessage(models)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, conn := range conns {
+		if err := sendControl(ctx, conn, msg); err != nil {
+			errs = append(errs, fmt.Errorf("通知 Relay 更新模型失败: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sendControl 在新流上发送控制消息，并等待 Relay 处理完成后关闭流 (作为确认)
+func sendControl(ctx context.Context, conn quic.Connection, msg *protocol.Message) error {
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return fmt.Errorf("打开控制流失败: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetReadDeadline(deadline)
+	}
+	if err := protocol.WriteMessage(stream, msg); err != nil {
+		stream.CancelRead(0)
+		return fmt.Errorf("发送控制消息失败: %w", err)
+	}
+	stream.Close()
+	if _, err := io.Copy(io.Discard, stream); err != nil {
+		return fmt.Errorf("等待 Relay 确认失败: %w", err)
+	}
+	return nil
+}
+
 // Stop 停止反向隧道客户端
 func (t *TunnelClient) Stop() error {
 	t.cancel()
@@ -490,8 +1076,17 @@ func (t *TunnelClient) Ready() <-chan struct{} {
 	return t.ready
 }
 
-// nextBackoff 计算下一次退避时间 (指数退避，上限 maxBackoff)
+// nextBackoff 计算下一次退避上限 (指数退避，上限 maxBackoff)，实际等待时间由 fullJitter 随机化
 func nextBackoff(current, max time.Duration) time.Duration {
 	next := time.Duration(math.Min(float64(current*2), float64(max)))
 	return next
 }
+
+// fullJitter 返回 [0, d] 内均匀分布的随机等待时间 (full jitter)
+// Relay 重启后大量 Exit 的重连时间被打散，而不是按相同的指数序列同时重连
+func fullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d + 1)
+}
@@ -1,8 +1,28 @@
 package exit
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/binn/tokengo/internal/bootstrap"
+	"github.com/binn/tokengo/internal/cert"
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/identity"
+	"github.com/binn/tokengo/internal/protocol"
+	"github.com/binn/tokengo/internal/testutil"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/quic-go/quic-go"
 )
 
 func TestNextBackoff(t *testing.T) {
@@ -30,3 +50,711 @@ func TestNextBackoff(t *testing.T) {
 		})
 	}
 }
+
+func TestFullJitter(t *testing.T) {
+	const maxBackoff = 60 * time.Second
+
+	// 按重连循环的方式推进退避上限，每次等待时间都在 [0, 上限] 内
+	sequence := func() []time.Duration {
+		var waits []time.Duration
+		backoff := time.Second
+		for i := 0; i < 10; i++ {
+			wait := fullJitter(backoff)
+			if wait < 0 || wait > backoff {
+				t.Fatalf("fullJitter(%v) = %v, want within [0, %v]", backoff, wait, backoff)
+			}
+			waits = append(waits, wait)
+			backoff = nextBackoff(backoff, maxBackoff)
+		}
+		if backoff != maxBackoff {
+			t.Fatalf("backoff cap = %v, want %v", backoff, maxBackoff)
+		}
+		return waits
+	}
+
+	first := sequence()
+	deterministic := true
+	for i := 0; i < 5 && deterministic; i++ {
+		next := sequence()
+		for j := range first {
+			if next[j] != first[j] {
+				deterministic = false
+				break
+			}
+		}
+	}
+	if deterministic {
+		t.Errorf("backoff sequence is deterministic: %v", first)
+	}
+
+	if got := fullJitter(0); got != 0 {
+		t.Errorf("fullJitter(0) = %v, want 0", got)
+	}
+}
+
+func TestSelectBestRelay_ParallelProbing(t *testing.T) {
+	const probeDelay = 100 * time.Millisecond
+	rtts := map[string]time.Duration{
+		"127.0.0.1:4001": 30 * time.Millisecond,
+		"127.0.0.1:4002": 10 * time.Millisecond,
+		"127.0.0.1:4003": 50 * time.Millisecond,
+		"127.0.0.1:4004": 20 * time.Millisecond,
+		"127.0.0.1:4005": 40 * time.Millisecond,
+	}
+
+	var relays []peer.AddrInfo
+	for addr := range rtts {
+		host, port, _ := strings.Cut(addr, ":")
+		maddr, err := ma.NewMultiaddr(fmt.Sprintf("/ip4/%s/udp/%s/quic-v1", host, port))
+		if err != nil {
+			t.Fatalf("NewMultiaddr: %v", err)
+		}
+		relays = append(relays, peer.AddrInfo{ID: peer.ID(addr), Addrs: []ma.Multiaddr{maddr}})
+	}
+
+	tc := NewTunnelClientStatic("", "hash", nil, nil)
+	tc.SetProbeConcurrency(len(relays))
+	tc.probeFn = func(ctx context.Context, addr string, _ peer.ID) (time.Duration, error) {
+		select {
+		case <-time.After(probeDelay):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		return rtts[addr], nil
+	}
+
+	start := time.Now()
+	addr, peerID, err := tc.selectBestRelay(context.Background(), relays)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("selectBestRelay: %v", err)
+	}
+	if addr != "127.0.0.1:4002" || peerID != peer.ID("127.0.0.1:4002") {
+		t.Errorf("selected %s (%s), want lowest RTT relay 127.0.0.1:4002", addr, peerID)
+	}
+	serial := probeDelay * time.Duration(len(relays))
+	if elapsed >= serial/2 {
+		t.Errorf("parallel probing took %v, serial would take %v", elapsed, serial)
+	}
+}
+
+func TestSelectBestRelay_AllFail(t *testing.T) {
+	maddr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/udp/4001/quic-v1")
+	tc := NewTunnelClientStatic("", "hash", nil, nil)
+	tc.probeFn = func(ctx context.Context, addr string, _ peer.ID) (time.Duration, error) {
+		return 0, errors.New("unreachable")
+	}
+
+	_, _, err := tc.selectBestRelay(context.Background(), []peer.AddrInfo{{ID: "r1", Addrs: []ma.Multiaddr{maddr}}})
+	if err == nil {
+		t.Fatal("expected error when all relays are unreachable")
+	}
+}
+
+// startRejectingRelay 启动一个拒绝所有 Exit 注册的 Relay
+func startRejectingRelay(t *testing.T) string {
+	t.Helper()
+	return startFakeRelay(t, protocol.NewErrorMessage("exit not allowed"))
+}
+
+// startFakeRelay 启动一个对所有注册请求回复固定消息的 Relay
+func startFakeRelay(t *testing.T, reply *protocol.Message) string {
+	t.Helper()
+	addr, _ := startRecordingRelay(t, reply)
+	return addr
+}
+
+// startRecordingRelay 同 startFakeRelay，并通过 channel 返回收到的注册消息
+func startRecordingRelay(t *testing.T, reply *protocol.Message) (string, <-chan *protocol.Message) {
+	t.Helper()
+	addr, _, received := startRecordingPeerRelay(t, reply)
+	return addr, received
+}
+
+// startRecordingPeerRelay 同 startRecordingRelay，并返回 Relay 的 PeerID
+func startRecordingPeerRelay(t *testing.T, reply *protocol.Message) (string, peer.ID, <-chan *protocol.Message) {
+	t.Helper()
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("identity.Generate: %v", err)
+	}
+	tlsCert, err := cert.GeneratePeerIDCert(id.PrivKey, "")
+	if err != nil {
+		t.Fatalf("GeneratePeerIDCert: %v", err)
+	}
+	listener, err := quic.ListenAddr("127.0.0.1:0", cert.CreateServerTLSConfig(tlsCert), nil)
+	if err != nil {
+		t.Fatalf("ListenAddr: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan *protocol.Message, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				if msg, err := protocol.Decode(stream); err == nil {
+					select {
+					case received <- msg:
+					default:
+					}
+				}
+				stream.Write(reply.Encode())
+				stream.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String(), id.PeerID, received
+}
+
+func TestTunnelClient_FallsBackToBootstrapRelays(t *testing.T) {
+	relayAddr, relayID, received := startRecordingPeerRelay(t, protocol.NewRegisterAckMessage([]byte{protocol.ProtocolVersion}))
+	_, port, _ := net.SplitHostPort(relayAddr)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"version":1,"peers":[],"relays":["/ip4/127.0.0.1/udp/%s/quic-v1/p2p/%s"]}`, port, relayID)
+	}))
+	defer server.Close()
+
+	// DHT 未发现任何 Relay (如网络屏蔽了 DHT)
+	tc := NewTunnelClient(nil, "hash", nil, nil)
+	tc.discoverFn = func(context.Context) ([]peer.AddrInfo, error) { return nil, nil }
+	tc.SetBootstrapFallback(bootstrap.NewClient([]string{server.URL}))
+	defer tc.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addr, id, err := tc.selectRelay(ctx)
+	if err != nil {
+		t.Fatalf("selectRelay: %v", err)
+	}
+	if addr != relayAddr || id != relayID {
+		t.Errorf("selectRelay = %s %s, want the bootstrap relay %s %s", addr, id, relayAddr, relayID)
+	}
+
+	// 选出的 Relay 可以正常注册
+	if err := tc.connectAndRegister(ctx, addr, id); err != nil {
+		t.Fatalf("connectAndRegister: %v", err)
+	}
+	select {
+	case msg := <-received:
+		if msg.Type != protocol.MessageTypeRegister {
+			t.Errorf("relay received message type 0x%02x, want Register", msg.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("bootstrap relay did not receive a register message")
+	}
+}
+
+func TestTunnelClient_RegistersUpdatedModels(t *testing.T) {
+	relayAddr, received := startRecordingRelay(t, protocol.NewRegisterAckMessage([]byte{protocol.ProtocolVersion}))
+
+	tc := NewTunnelClientStatic(relayAddr, "hash", nil, nil)
+	tc.SetAdvertise(config.ExitAdvertise{Models: []string{"gpt-4o"}})
+	defer tc.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 尚未连接 Relay 时只更新注册附带的列表
+	if err := tc.UpdateModels(ctx, []string{"gpt-4o", "o1"}); err != nil {
+		t.Fatalf("UpdateModels: %v", err)
+	}
+	if err := tc.connectAndRegister(ctx, relayAddr, ""); err != nil {
+		t.Fatalf("connectAndRegister: %v", err)
+	}
+	select {
+	case msg := <-received:
+		_, meta, err := protocol.DecodeRegisterPayload(msg.Payload)
+		if err != nil {
+			t.Fatalf("DecodeRegisterPayload: %v", err)
+		}
+		if !slices.Equal(meta.Models, []string{"gpt-4o", "o1"}) {
+			t.Errorf("registered models = %v, want the updated list", meta.Models)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not receive a register message")
+	}
+}
+
+// startControlRelay 启动一个应答注册和心跳的 Relay，通过 channel 返回每条连接上收到的 UpdateModels 消息 (以连接的远端端口区分)
+func startControlRelay(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	id, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("identity.Generate: %v", err)
+	}
+	tlsCert, err := cert.GeneratePeerIDCert(id.PrivKey, "")
+	if err != nil {
+		t.Fatalf("GeneratePeerIDCert: %v", err)
+	}
+	listener, err := quic.ListenAddr("127.0.0.1:0", cert.CreateServerTLSConfig(tlsCert), nil)
+	if err != nil {
+		t.Fatalf("ListenAddr: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	updates := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					msg, err := protocol.Decode(stream)
+					if err != nil {
+						stream.Close()
+						continue
+					}
+					switch msg.Type {
+					case protocol.MessageTypeRegister:
+						protocol.WriteMessage(stream, protocol.NewRegisterAckMessage([]byte{protocol.ProtocolVersion}))
+					case protocol.MessageTypeHeartbeat:
+						protocol.WriteMessage(stream, protocol.NewHeartbeatAckMessage())
+					case protocol.MessageTypeUpdateModels:
+						updates <- addrPort(conn.RemoteAddr())
+					}
+					stream.Close()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), updates
+}
+
+// addrPort 返回地址的端口 (Exit 监听通配地址，本地地址与 Relay 看到的远端地址只有端口相同)
+func addrPort(addr net.Addr) string {
+	_, port, _ := net.SplitHostPort(addr.String())
+	return port
+}
+
+func TestTunnelClient_UpdateModelsNotifiesEveryServingConnection(t *testing.T) {
+	relayAddr, updates := startControlRelay(t)
+
+	tc := NewTunnelClientStatic(relayAddr, "hash", nil, nil)
+	defer tc.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 回收期间新旧连接都在接收请求
+	var conns []*tunnelConn
+	for range 2 {
+		if err := tc.connectAndRegister(ctx, relayAddr, ""); err != nil {
+			t.Fatalf("connectAndRegister: %v", err)
+		}
+		conns = append(conns, tc.serve())
+	}
+
+	if err := tc.UpdateModels(ctx, []string{"gpt-4o", "o1"}); err != nil {
+		t.Fatalf("UpdateModels: %v", err)
+	}
+	notified := make(map[string]bool)
+	for range conns {
+		select {
+		case addr := <-updates:
+			notified[addr] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("relay received UpdateModels on %d connections, want %d", len(notified), len(conns))
+		}
+	}
+	for _, c := range conns {
+		if !notified[addrPort(c.conn.LocalAddr())] {
+			t.Errorf("connection %s was not notified", c.conn.LocalAddr())
+		}
+	}
+
+	// 开始回收的连接不再接收新请求，不再通知
+	tc.stopServing(conns[0])
+	if err := tc.UpdateModels(ctx, []string{"gpt-4o"}); err != nil {
+		t.Fatalf("UpdateModels: %v", err)
+	}
+	select {
+	case addr := <-updates:
+		if addr != addrPort(conns[1].conn.LocalAddr()) {
+			t.Errorf("retired connection %s was notified", addr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serving connection was not notified")
+	}
+}
+
+func TestSelectRelay_NoBootstrapFallback(t *testing.T) {
+	tc := NewTunnelClient(nil, "hash", nil, nil)
+	tc.discoverFn = func(context.Context) ([]peer.AddrInfo, error) { return nil, errors.New("dht timeout") }
+	defer tc.Stop()
+
+	if _, _, err := tc.selectRelay(context.Background()); err == nil || !strings.Contains(err.Error(), "dht timeout") {
+		t.Errorf("selectRelay err = %v, want the DHT error without a bootstrap fallback", err)
+	}
+}
+
+func TestConnectAndRegister_NegotiatesVersion(t *testing.T) {
+	relayAddr := startFakeRelay(t, protocol.NewRegisterAckMessage([]byte{protocol.ProtocolVersion}))
+
+	tc := NewTunnelClientStatic(relayAddr, "hash", nil, nil)
+	defer tc.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tc.connectAndRegister(ctx, relayAddr, ""); err != nil {
+		t.Fatalf("connectAndRegister: %v", err)
+	}
+	if got := tc.ProtocolVersion(); got != protocol.ProtocolVersion {
+		t.Errorf("ProtocolVersion() = %d, want %d", got, protocol.ProtocolVersion)
+	}
+}
+
+func TestConnectAndRegister_IncompatibleRelayVersion(t *testing.T) {
+	relayAddr := startFakeRelay(t, protocol.NewRegisterAckMessage([]byte{protocol.ProtocolVersion + 1}))
+
+	tc := NewTunnelClientStatic(relayAddr, "hash", nil, nil)
+	defer tc.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := tc.connectAndRegister(ctx, relayAddr, "")
+	if !errors.Is(err, protocol.ErrUnsupportedVersion) {
+		t.Fatalf("err = %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestTunnelClient_PersistentRejectionExhausts(t *testing.T) {
+	relayAddr := startRejectingRelay(t)
+
+	tc := NewTunnelClientStatic(relayAddr, "hash", nil, nil)
+	tc.initialBackoff = 10 * time.Millisecond
+	tc.SetMaxRegisterAttempts(3)
+	defer tc.Stop()
+
+	done := make(chan error, 1)
+	go func() { done <- tc.Start(context.Background()) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrRegistrationExhausted) {
+			t.Fatalf("Start err = %v, want ErrRegistrationExhausted", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Start should give up after max register attempts")
+	}
+
+	if got := tc.RegisterFailures(); got != 3 {
+		t.Errorf("RegisterFailures() = %d, want 3", got)
+	}
+}
+
+func TestTunnelClient_RecordRegisterResult(t *testing.T) {
+	tc := NewTunnelClientStatic("", "hash", nil, nil)
+	tc.SetMaxRegisterAttempts(2)
+
+	if err := tc.recordRegisterResult(errors.New("fail")); err != nil {
+		t.Fatalf("first failure should not exhaust: %v", err)
+	}
+	tc.recordRegisterResult(nil)
+	if got := tc.RegisterFailures(); got != 0 {
+		t.Errorf("success should reset failures, got %d", got)
+	}
+
+	tc.recordRegisterResult(errors.New("fail"))
+	if err := tc.recordRegisterResult(errors.New("fail")); !errors.Is(err, ErrRegistrationExhausted) {
+		t.Errorf("err = %v, want ErrRegistrationExhausted", err)
+	}
+
+	tc.SetMaxRegisterAttempts(0)
+	for i := 0; i < 10; i++ {
+		if err := tc.recordRegisterResult(errors.New("fail")); err != nil {
+			t.Fatalf("unlimited attempts should never exhaust: %v", err)
+		}
+	}
+}
+
+func TestTunnelClient_MaxConcurrentStreams(t *testing.T) {
+	const limit = 2
+	entered := make(chan struct{}, limit)
+	unblock := make(chan struct{})
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-unblock
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"ok"}`))
+	})
+
+	tc := NewTunnelClientStatic("", "hash", nil, handler)
+	tc.SetMaxConcurrentStreams(limit)
+
+	// send 在新流上发送一条消息并交给 handleIncomingStream 处理，返回 Client 端
+	send := func(msg *protocol.Message) *testutil.MockPipeStream {
+		client, server := testutil.NewStreamPair()
+		go tc.handleIncomingStream(server)
+		if _, err := client.Write(msg.Encode()); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		return client
+	}
+	request := func() *protocol.Message {
+		ohttpReq, _ := encryptRequest(t, ohttpClient, "POST", "/v1/chat/completions", []byte(`{"model":"m"}`))
+		return protocol.NewRequestMessage("", ohttpReq)
+	}
+
+	// 占满并发名额: 请求阻塞在后端
+	var busy []*testutil.MockPipeStream
+	for i := 0; i < limit; i++ {
+		busy = append(busy, send(request()))
+	}
+	for i := 0; i < limit; i++ {
+		select {
+		case <-entered:
+		case <-time.After(5 * time.Second):
+			t.Fatal("request did not reach backend")
+		}
+	}
+
+	// 超出上限的请求立即被拒绝，不会排队
+	for _, msg := range []*protocol.Message{request(), protocol.NewStreamRequestMessage("", request().Payload)} {
+		excess := send(msg)
+		reply, err := protocol.Decode(excess)
+		if err != nil {
+			t.Fatalf("decode reply: %v", err)
+		}
+		if reply.Type != protocol.MessageTypeError || string(reply.Payload) != protocol.ErrTooManyRequests {
+			t.Errorf("excess reply = 0x%02x %q, want error %q", reply.Type, reply.Payload, protocol.ErrTooManyRequests)
+		}
+	}
+
+	// 心跳不占用名额
+	hb := send(protocol.NewHeartbeatMessage())
+	if reply, err := protocol.Decode(hb); err != nil || reply.Type != protocol.MessageTypeHeartbeatAck {
+		t.Errorf("heartbeat reply = %v, %v; want HeartbeatAck", reply, err)
+	}
+
+	// 名额释放后恢复处理
+	close(unblock)
+	for _, s := range busy {
+		reply, err := protocol.Decode(s)
+		if err != nil || reply.Type != protocol.MessageTypeResponse {
+			t.Fatalf("busy reply = %v, %v; want Response", reply, err)
+		}
+		io.Copy(io.Discard, s) // 读到 EOF: 名额在关闭流之前释放
+	}
+	s := send(request())
+	if reply, err := protocol.Decode(s); err != nil || reply.Type != protocol.MessageTypeResponse {
+		t.Errorf("reply after release = %v, %v; want Response", reply, err)
+	}
+}
+
+func TestTunnelClient_HeartbeatLoad(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-unblock
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"ok"}`))
+	})
+
+	tc := NewTunnelClientStatic("", "hash", nil, handler)
+
+	// 未配置额定并发数时心跳不附带负载
+	if hb := tc.heartbeatMessage(); len(hb.Payload) != 0 {
+		t.Errorf("heartbeat payload = %q, want empty", hb.Payload)
+	}
+
+	tc.SetAdvertise(config.ExitAdvertise{Capacity: 4})
+	if load, ok := protocol.DecodeHeartbeatLoad(tc.heartbeatMessage().Payload); !ok || load != 0 {
+		t.Errorf("idle load = %d, %v, want 0, true", load, ok)
+	}
+
+	client, server := testutil.NewStreamPair()
+	go tc.handleIncomingStream(server)
+	ohttpReq, _ := encryptRequest(t, ohttpClient, "POST", "/v1/chat/completions", []byte(`{"model":"m"}`))
+	if _, err := client.Write(protocol.NewRequestMessage("", ohttpReq).Encode()); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request did not reach backend")
+	}
+
+	// 1 个进行中的请求 / 额定 4 个
+	if load, _ := protocol.DecodeHeartbeatLoad(tc.heartbeatMessage().Payload); load != 25 {
+		t.Errorf("busy load = %d, want 25", load)
+	}
+
+	close(unblock)
+	if reply, err := protocol.Decode(client); err != nil || reply.Type != protocol.MessageTypeResponse {
+		t.Fatalf("reply = %v, %v; want Response", reply, err)
+	}
+	io.Copy(io.Discard, client)
+	if load, _ := protocol.DecodeHeartbeatLoad(tc.heartbeatMessage().Payload); load != 0 {
+		t.Errorf("load after completion = %d, want 0", load)
+	}
+}
+
+func TestSendHeartbeat_Datagram(t *testing.T) {
+	tc := NewTunnelClientStatic("", "hash", nil, nil)
+	tc.SetQUICParams(config.QUICParams{EnableDatagrams: true})
+
+	conn := testutil.NewMockConn(1)
+	conn.EnableDatagrams()
+	tc.conn = conn
+
+	if err := tc.sendHeartbeat(context.Background()); err != nil {
+		t.Fatalf("sendHeartbeat failed: %v", err)
+	}
+
+	select {
+	case data := <-conn.SentDatagrams():
+		msg, err := protocol.Decode(bytes.NewReader(data))
+		if err != nil || msg.Type != protocol.MessageTypeHeartbeat {
+			t.Errorf("datagram = %v, %v; want Heartbeat", msg, err)
+		}
+	default:
+		t.Fatal("heartbeat was not sent as a datagram")
+	}
+}
+
+func TestSendHeartbeat_StreamFallback(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		enableDatagrams bool // 本端配置
+		peerDatagrams   bool // 连接是否协商了 datagram
+	}{
+		{"disabled locally", false, true},
+		{"not negotiated", true, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := NewTunnelClientStatic("", "hash", nil, nil)
+			tc.SetQUICParams(config.QUICParams{EnableDatagrams: tt.enableDatagrams})
+
+			conn := testutil.NewMockConn(1)
+			if tt.peerDatagrams {
+				conn.EnableDatagrams()
+			}
+			tc.conn = conn
+
+			client, server := testutil.NewStreamPair()
+			conn.PushOpenStream(client)
+			go func() {
+				msg, err := protocol.Decode(server)
+				if err != nil || msg.Type != protocol.MessageTypeHeartbeat {
+					t.Errorf("stream message = %v, %v; want Heartbeat", msg, err)
+					return
+				}
+				server.Write(protocol.NewHeartbeatAckMessage().Encode())
+			}()
+
+			if err := tc.sendHeartbeat(context.Background()); err != nil {
+				t.Fatalf("sendHeartbeat failed: %v", err)
+			}
+			select {
+			case <-conn.SentDatagrams():
+				t.Error("heartbeat should not be sent as a datagram")
+			default:
+			}
+		})
+	}
+}
+
+func TestSendHeartbeat_RecordsRTT(t *testing.T) {
+	tc := NewTunnelClientStatic("", "hash", nil, nil)
+	conn := testutil.NewMockConn(1)
+	tc.conn = conn
+
+	// 尚未测得往返时间时心跳不附带 RTT
+	if _, ok := protocol.DecodeHeartbeatRTT(tc.heartbeatMessage().Payload); ok {
+		t.Error("heartbeat should not carry RTT before any measurement")
+	}
+
+	const delay = 20 * time.Millisecond
+	client, server := testutil.NewStreamPair()
+	conn.PushOpenStream(client)
+	go func() {
+		if _, err := protocol.Decode(server); err != nil {
+			t.Errorf("reading heartbeat failed: %v", err)
+			return
+		}
+		time.Sleep(delay)
+		server.Write(protocol.NewHeartbeatAckMessage().Encode())
+	}()
+
+	if err := tc.sendHeartbeat(context.Background()); err != nil {
+		t.Fatalf("sendHeartbeat failed: %v", err)
+	}
+	rtt := tc.HeartbeatRTT()
+	if rtt < delay {
+		t.Errorf("HeartbeatRTT = %v, want >= %v", rtt, delay)
+	}
+	// 下一次心跳向 Relay 通告测得的往返时间
+	if got, ok := protocol.DecodeHeartbeatRTT(tc.heartbeatMessage().Payload); !ok || got != rtt.Truncate(time.Microsecond) {
+		t.Errorf("advertised RTT = %v, %v, want %v", got, ok, rtt)
+	}
+
+	// 换连接后旧连接的测量不再有效
+	tc.conn = testutil.NewMockConn(2)
+	if got := tc.HeartbeatRTT(); got != 0 {
+		t.Errorf("HeartbeatRTT after reconnect = %v, want 0", got)
+	}
+}
+
+func TestTunnelClient_StreamPoolOverflowRejected(t *testing.T) {
+	entered := make(chan struct{}, 4)
+	unblock := make(chan struct{})
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-unblock
+		w.Write([]byte(`{"id":"ok"}`))
+	})
+
+	tc := NewTunnelClientStatic("", "hash", nil, handler)
+	tc.SetStreamPool(1, 1)
+
+	conn := testutil.NewMockConn(1)
+	tunnel := &tunnelConn{conn: conn, accepting: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tc.acceptStreams(ctx, tunnel)
+
+	send := func() *testutil.MockPipeStream {
+		client, server := testutil.NewStreamPair()
+		conn.PushAcceptStream(server)
+		ohttpReq, _ := encryptRequest(t, ohttpClient, "POST", "/v1/chat/completions", []byte(`{"model":"m"}`))
+		go client.Write(protocol.NewRequestMessage("", ohttpReq).Encode())
+		return client
+	}
+
+	// 1 个 worker 处理中、1 个排队，第 3 个流被拒绝
+	busy := send()
+	<-entered
+	queued := send()
+	excess := send()
+	reply, err := protocol.Decode(excess)
+	if err != nil {
+		t.Fatalf("decode reply: %v", err)
+	}
+	if reply.Type != protocol.MessageTypeError || string(reply.Payload) != protocol.ErrTooManyRequests {
+		t.Errorf("excess reply = 0x%02x %q, want error %q", reply.Type, reply.Payload, protocol.ErrTooManyRequests)
+	}
+
+	// 已接受的流 (含排队的) 全部正常完成
+	close(unblock)
+	for _, s := range []*testutil.MockPipeStream{busy, queued} {
+		if reply, err := protocol.Decode(s); err != nil || reply.Type != protocol.MessageTypeResponse {
+			t.Errorf("accepted reply = %v, %v; want Response", reply, err)
+		}
+	}
+	tunnel.inflight.Wait()
+}
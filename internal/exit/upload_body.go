@@ -0,0 +1,104 @@
+package exit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/binn/tokengo/internal/crypto"
+	"github.com/binn/tokengo/internal/protocol"
+)
+
+// ErrRequestBodyTruncated 分块上传的请求体在结束标记之前中断
+var ErrRequestBodyTruncated = errors.New("分块上传的请求体被截断")
+
+// uploadBody 分块上传的请求体: 按需从流中读取 RequestChunk 并按序解密，校验 RequestEnd 后返回 io.EOF
+// 请求体不在 Exit 整体缓存，边收边转发给 AI 后端
+type uploadBody struct {
+	r      io.Reader
+	opener *crypto.RequestBodyOpener
+	buf    []byte
+	err    error // 终止状态: io.EOF 表示请求体完整
+	limit  int64 // 请求体大小上限，0 表示不限制
+	read   int64 // 已解密的字节数
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		b.err = b.next()
+		b.read += int64(len(b.buf))
+		if b.limit > 0 && b.read > b.limit {
+			b.buf = nil
+			b.err = fmt.Errorf("%w: > %d 字节", ErrRequestTooLarge, b.limit)
+		}
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+// next 读取并解密下一条请求体消息
+func (b *uploadBody) next() error {
+	msg, err := protocol.Decode(b.r)
+	if err == io.EOF {
+		return ErrRequestBodyTruncated
+	}
+	if err != nil {
+		return fmt.Errorf("读取请求体块失败: %w", err)
+	}
+
+	switch msg.Type {
+	case protocol.MessageTypeRequestChunk:
+		b.buf, err = b.opener.OpenChunk(msg.Payload)
+		return err
+	case protocol.MessageTypeRequestEnd:
+		if err := b.opener.OpenFinal(msg.Payload); err != nil {
+			return err
+		}
+		return io.EOF
+	default:
+		return fmt.Errorf("无效的请求体消息类型: %d", msg.Type)
+	}
+}
+
+// unread 将已读出的数据放回请求体开头 (检查 model 时读取的前缀)，之后的 Read 先返回这部分数据
+func (b *uploadBody) unread(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	b.buf = append(p[:len(p):len(p)], b.buf...)
+}
+
+// Close 不关闭底层流 (由隧道在请求结束时关闭)
+func (b *uploadBody) Close() error { return nil }
+
+// attachUploadBody 请求声明了分块上传时，将请求体替换为从 upstream 读取的 uploadBody
+// upstream 为 nil (HTTP 直连模式) 时不支持分块上传
+func attachUploadBody(req *http.Request, ctx *crypto.ServerContext, upstream io.Reader) error {
+	declared := req.Header.Get(protocol.ChunkedBodyHeader)
+	if declared == "" {
+		return nil
+	}
+	req.Header.Del(protocol.ChunkedBodyHeader)
+
+	if upstream == nil {
+		return fmt.Errorf("当前模式不支持分块上传的请求体")
+	}
+	length, err := strconv.ParseInt(declared, 10, 64)
+	if err != nil || length < -1 {
+		return fmt.Errorf("无效的分块上传长度: %q", declared)
+	}
+
+	opener, err := ctx.NewRequestBodyOpener()
+	if err != nil {
+		return fmt.Errorf("创建请求体解密器失败: %w", err)
+	}
+	req.Body = &uploadBody{r: upstream, opener: opener}
+	req.ContentLength = length
+	return nil
+}
@@ -0,0 +1,229 @@
+package exit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/binn/tokengo/internal/metrics"
+	"github.com/binn/tokengo/pkg/openai"
+)
+
+// defaultUsageLogInterval 输出 token 用量日志的默认间隔
+const defaultUsageLogInterval = 5 * time.Minute
+
+// unknownModel 响应未携带 model 字段时使用的模型名
+const unknownModel = "unknown"
+
+// UsageTracker 按模型累计 Exit 转发的 token 用量 (从后端响应的 usage 字段解析)，
+// 同时输出到指标 (按 model 标签区分) 和周期性日志
+type UsageTracker struct {
+	mu      sync.Mutex
+	models  map[string]*openai.Usage
+	changed bool // 上次输出日志后是否有新的用量
+	metrics metrics.Sink
+}
+
+// NewUsageTracker 创建 token 用量统计，sink 为 nil 时只在内存中累计
+func NewUsageTracker(sink metrics.Sink) *UsageTracker {
+	if sink == nil {
+		sink = metrics.Nop{}
+	}
+	return &UsageTracker{models: make(map[string]*openai.Usage), metrics: sink}
+}
+
+// Record 累计一次请求的 token 用量
+func (u *UsageTracker) Record(model string, usage openai.Usage) {
+	if model == "" {
+		model = unknownModel
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	u.mu.Lock()
+	total, ok := u.models[model]
+	if !ok {
+		total = &openai.Usage{}
+		u.models[model] = total
+	}
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+	u.changed = true
+	u.mu.Unlock()
+
+	u.metrics.Count(metrics.WithLabel(metrics.ExitPromptTokens, "model", model), int64(usage.PromptTokens))
+	u.metrics.Count(metrics.WithLabel(metrics.ExitCompletionTokens, "model", model), int64(usage.CompletionTokens))
+	u.metrics.Count(metrics.WithLabel(metrics.ExitTotalTokens, "model", model), int64(usage.TotalTokens))
+}
+
+// Snapshot 返回各模型累计的 token 用量
+func (u *UsageTracker) Snapshot() map[string]openai.Usage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	snapshot := make(map[string]openai.Usage, len(u.models))
+	for model, usage := range u.models {
+		snapshot[model] = *usage
+	}
+	return snapshot
+}
+
+// StartLogging 启动周期性用量日志 (interval <= 0 时使用默认间隔)，ctx 取消时停止
+// 期间没有新用量时不输出
+func (u *UsageTracker) StartLogging(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultUsageLogInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if line, ok := u.summary(); ok {
+					log.Print(line)
+				}
+			}
+		}
+	}()
+}
+
+// summary 返回按模型排序的累计用量日志行，上次输出后没有新用量时 ok 为 false
+func (u *UsageTracker) summary() (line string, ok bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.changed {
+		return "", false
+	}
+	u.changed = false
+
+	models := make([]string, 0, len(u.models))
+	for model := range u.models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	parts := make([]string, 0, len(models))
+	for _, model := range models {
+		usage := u.models[model]
+		parts = append(parts, fmt.Sprintf("%s prompt=%d completion=%d total=%d",
+			model, usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens))
+	}
+	return "Token 用量 (累计): " + strings.Join(parts, "; "), true
+}
+
+// usageBody 响应体 (非流式响应或流式响应的单个事件) 中与用量有关的字段
+type usageBody struct {
+	Model string        `json:"model"`
+	Usage *openai.Usage `json:"usage"`
+}
+
+// observeResponse 解析非流式 JSON 响应的 usage 字段并累计，读取后还原响应体
+// 非 JSON 响应 (二进制、SSE 等) 不读取
+func (u *UsageTracker) observeResponse(resp *http.Response) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/json" || resp.Body == nil || resp.Body == http.NoBody {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("读取响应体失败: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var parsed usageBody
+	if json.Unmarshal(body, &parsed) != nil || parsed.Usage == nil {
+		return nil
+	}
+	u.Record(parsed.Model, *parsed.Usage)
+	return nil
+}
+
+// streamUsage 流式响应中累计出现的用量
+// 各字段取所有事件中的最大值: 部分后端在每个块中都携带累计用量 (取最大即最后一次，避免重复累计)，
+// Anthropic 在 message_start 中给出 input_tokens、在 message_delta 中只给出 output_tokens，需要合并
+type streamUsage struct {
+	model string
+	usage *openai.Usage
+}
+
+// eventUsage 单个 SSE 事件中的 usage，同时兼容 OpenAI 与 Anthropic 的字段名
+type eventUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	InputTokens      int `json:"input_tokens"`
+	OutputTokens     int `json:"output_tokens"`
+}
+
+// usageEvent SSE 事件中与用量有关的字段 (Anthropic message_start 的用量位于 message 下)
+type usageEvent struct {
+	Model   string      `json:"model"`
+	Usage   *eventUsage `json:"usage"`
+	Message *struct {
+		Model string      `json:"model"`
+		Usage *eventUsage `json:"usage"`
+	} `json:"message"`
+}
+
+// observe 从一个 SSE 事件的 data 行中提取 usage 并与之前的事件合并
+func (s *streamUsage) observe(event []byte) {
+	if !bytes.Contains(event, []byte(`"usage"`)) {
+		return
+	}
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		data, ok := bytes.CutPrefix(bytes.TrimRight(line, "\r"), []byte("data:"))
+		if !ok {
+			continue
+		}
+		var parsed usageEvent
+		if json.Unmarshal(bytes.TrimSpace(data), &parsed) != nil {
+			continue
+		}
+		s.merge(parsed.Model, parsed.Usage)
+		if parsed.Message != nil {
+			s.merge(parsed.Message.Model, parsed.Message.Usage)
+		}
+	}
+}
+
+// merge 按字段取最大值合并一次用量 (usage 为 nil 时忽略)
+func (s *streamUsage) merge(model string, usage *eventUsage) {
+	if usage == nil {
+		return
+	}
+	if model != "" {
+		s.model = model
+	}
+	if s.usage == nil {
+		s.usage = &openai.Usage{}
+	}
+	s.usage.PromptTokens = max(s.usage.PromptTokens, usage.PromptTokens, usage.InputTokens)
+	s.usage.CompletionTokens = max(s.usage.CompletionTokens, usage.CompletionTokens, usage.OutputTokens)
+	s.usage.TotalTokens = max(s.usage.TotalTokens, usage.TotalTokens)
+}
+
+// recordStream 流结束时记录流式响应的用量 (未出现 usage 时不记录)
+func (u *UsageTracker) recordStream(s *streamUsage) {
+	if s.usage == nil {
+		return
+	}
+	usage := *s.usage
+	if usage.TotalTokens < usage.PromptTokens+usage.CompletionTokens {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	u.Record(s.model, usage)
+}
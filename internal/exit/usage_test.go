@@ -0,0 +1,140 @@
+package exit
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/binn/tokengo/internal/metrics"
+	"github.com/binn/tokengo/pkg/openai"
+)
+
+func TestOHTTPHandler_RecordsUsageFromJSONResponse(t *testing.T) {
+	const respBody = `{"id":"chatcmpl-1","model":"gpt-4o","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":30,"total_tokens":42}}`
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(respBody))
+	})
+	sink := metrics.NewPrometheus(metrics.DefaultPrefix)
+	usage := NewUsageTracker(sink)
+	handler.SetUsageTracker(usage)
+
+	for i := 0; i < 2; i++ {
+		ohttpReq, clientCtx := encryptRequest(t, ohttpClient, http.MethodPost, "/v1/chat/completions", []byte(`{"model":"gpt-4o"}`))
+		ohttpResp, err := handler.ProcessRequest(ohttpReq)
+		if err != nil {
+			t.Fatalf("ProcessRequest: %v", err)
+		}
+		resp, err := clientCtx.DecapsulateResponse(ohttpResp)
+		if err != nil {
+			t.Fatalf("DecapsulateResponse: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != respBody {
+			t.Errorf("response body = %s, want the backend body unchanged", body)
+		}
+	}
+
+	want := openai.Usage{PromptTokens: 24, CompletionTokens: 60, TotalTokens: 84}
+	if got := usage.Snapshot()["gpt-4o"]; got != want {
+		t.Errorf("usage = %+v, want %+v", got, want)
+	}
+	rendered := sink.Render()
+	for _, line := range []string{
+		`tokengo_exit_prompt_tokens{model="gpt-4o"} 24`,
+		`tokengo_exit_completion_tokens{model="gpt-4o"} 60`,
+		`tokengo_exit_total_tokens{model="gpt-4o"} 84`,
+	} {
+		if !strings.Contains(rendered, line+"\n") {
+			t.Errorf("metrics missing %q:\n%s", line, rendered)
+		}
+	}
+}
+
+func TestOHTTPHandler_UsageSkipsNonJSONResponse(t *testing.T) {
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(`{"model":"tts","usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	})
+	usage := NewUsageTracker(nil)
+	handler.SetUsageTracker(usage)
+
+	ohttpReq, _ := encryptRequest(t, ohttpClient, http.MethodPost, "/v1/audio/speech", []byte(`{"model":"tts"}`))
+	if _, err := handler.ProcessRequest(ohttpReq); err != nil {
+		t.Fatalf("ProcessRequest: %v", err)
+	}
+	if got := usage.Snapshot(); len(got) != 0 {
+		t.Errorf("usage = %v, want nothing recorded for a binary response", got)
+	}
+}
+
+func TestOHTTPHandler_RecordsUsageFromStream(t *testing.T) {
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// 部分后端在每个块中携带累计用量: 按字段取最大值，不重复累计
+		w.Write([]byte(`data: {"model":"llama3","choices":[{"delta":{"content":"hi"}}],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}` + "\n\n"))
+		w.Write([]byte(`data: {"model":"llama3","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":3}}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	})
+	usage := NewUsageTracker(nil)
+	handler.SetUsageTracker(usage)
+
+	ohttpReq, _ := encryptRequest(t, ohttpClient, http.MethodPost, "/v1/chat/completions", []byte(`{"model":"llama3","stream":true}`))
+	var buf bytes.Buffer
+	if err := handler.ProcessStreamRequest(ohttpReq, &buf); err != nil {
+		t.Fatalf("ProcessStreamRequest: %v", err)
+	}
+
+	want := openai.Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8}
+	if got := usage.Snapshot()["llama3"]; got != want {
+		t.Errorf("usage = %+v, want %+v", got, want)
+	}
+}
+
+func TestOHTTPHandler_RecordsAnthropicStreamUsage(t *testing.T) {
+	handler, ohttpClient, _ := setupTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// input_tokens 只出现在 message_start 中，message_delta 只携带 output_tokens
+		w.Write([]byte("event: message_start\n" + `data: {"type":"message_start","message":{"id":"msg_1","model":"claude-x","usage":{"input_tokens":25,"output_tokens":1}}}` + "\n\n"))
+		w.Write([]byte("event: content_block_delta\n" + `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}` + "\n\n"))
+		w.Write([]byte("event: message_delta\n" + `data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":15}}` + "\n\n"))
+		w.Write([]byte("event: message_stop\n" + `data: {"type":"message_stop"}` + "\n\n"))
+	})
+	usage := NewUsageTracker(nil)
+	handler.SetUsageTracker(usage)
+
+	ohttpReq, _ := encryptRequest(t, ohttpClient, http.MethodPost, "/v1/messages", []byte(`{"model":"claude-x","stream":true}`))
+	var buf bytes.Buffer
+	if err := handler.ProcessStreamRequest(ohttpReq, &buf); err != nil {
+		t.Fatalf("ProcessStreamRequest: %v", err)
+	}
+
+	want := openai.Usage{PromptTokens: 25, CompletionTokens: 15, TotalTokens: 40}
+	if got := usage.Snapshot()["claude-x"]; got != want {
+		t.Errorf("usage = %+v, want %+v", got, want)
+	}
+}
+
+func TestUsageTracker_Summary(t *testing.T) {
+	usage := NewUsageTracker(nil)
+	if _, ok := usage.summary(); ok {
+		t.Error("summary reported before any usage")
+	}
+	usage.Record("gpt-4o", openai.Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3})
+	usage.Record("", openai.Usage{PromptTokens: 4})
+
+	line, ok := usage.summary()
+	if !ok {
+		t.Fatal("summary not reported after new usage")
+	}
+	want := "Token 用量 (累计): gpt-4o prompt=1 completion=2 total=3; unknown prompt=4 completion=0 total=4"
+	if line != want {
+		t.Errorf("summary = %q, want %q", line, want)
+	}
+	if _, ok := usage.summary(); ok {
+		t.Error("summary repeated without new usage")
+	}
+}
@@ -0,0 +1,72 @@
+package exit
+
+import (
+	"runtime"
+	"sync"
+)
+
+// defaultStreamWorkersPerCPU 每个 CPU 的默认流处理 worker 数
+// 请求处理主要等待后端 I/O，worker 数远大于 CPU 数
+const defaultStreamWorkersPerCPU = 64
+
+// defaultStreamWorkers 默认流处理 worker 数 (按 CPU 数计算)
+func defaultStreamWorkers() int {
+	return defaultStreamWorkersPerCPU * runtime.NumCPU()
+}
+
+// streamPool 有界的流处理池: 最多 maxWorkers 个 worker 并发执行，其余任务在缓冲队列中等待
+// worker 按需启动，队列为空时退出，空闲时不占用 goroutine
+type streamPool struct {
+	jobs       chan func()
+	mu         sync.Mutex
+	workers    int // 运行中的 worker 数 (受 mu 保护)
+	maxWorkers int
+}
+
+// newStreamPool 创建流处理池，workers <= 0 时按 CPU 数取默认值，queue <= 0 时队列长度与 worker 数相同
+func newStreamPool(workers, queue int) *streamPool {
+	if workers <= 0 {
+		workers = defaultStreamWorkers()
+	}
+	if queue <= 0 {
+		queue = workers
+	}
+	return &streamPool{
+		jobs:       make(chan func(), queue),
+		maxWorkers: workers,
+	}
+}
+
+// Submit 提交任务；worker 已满且队列已满时返回 false，任务不会执行
+func (p *streamPool) Submit(job func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.workers < p.maxWorkers {
+		p.workers++
+		go p.work(job)
+		return true
+	}
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// work 执行任务后继续处理队列，队列为空时退出
+// 取任务与退出在同一把锁内判断，入队的任务总能被某个运行中的 worker 取走
+func (p *streamPool) work(job func()) {
+	for {
+		job()
+		p.mu.Lock()
+		select {
+		case job = <-p.jobs:
+			p.mu.Unlock()
+		default:
+			p.workers--
+			p.mu.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package exit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStreamPool_RejectsBeyondWorkersAndQueue(t *testing.T) {
+	const workers, queue = 2, 3
+	pool := newStreamPool(workers, queue)
+
+	var running, peak atomic.Int32
+	var done sync.WaitGroup
+	unblock := make(chan struct{})
+	job := func() {
+		defer done.Done()
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-unblock
+		running.Add(-1)
+	}
+
+	// worker 数 + 队列长度以内的任务全部接受，超出的立即拒绝而不是无限增长
+	accepted, rejected := 0, 0
+	for i := 0; i < workers+queue+5; i++ {
+		done.Add(1)
+		if pool.Submit(job) {
+			accepted++
+		} else {
+			done.Done()
+			rejected++
+		}
+	}
+	if accepted != workers+queue || rejected != 5 {
+		t.Fatalf("accepted = %d, rejected = %d, want %d and 5", accepted, rejected, workers+queue)
+	}
+
+	// 排队的任务在 worker 空出后依次执行，并发数始终不超过 worker 数
+	close(unblock)
+	finished := make(chan struct{})
+	go func() {
+		done.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued jobs did not run")
+	}
+	if p := peak.Load(); p > workers {
+		t.Errorf("peak concurrency = %d, want <= %d", p, workers)
+	}
+
+	// 队列清空后 worker 退出，新任务重新被接受
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pool.mu.Lock()
+		idle := pool.workers
+		pool.mu.Unlock()
+		if idle == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("workers after drain = %d, want 0", idle)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ran := make(chan struct{})
+	if !pool.Submit(func() { close(ran) }) {
+		t.Fatal("Submit rejected on an idle pool")
+	}
+	<-ran
+}
+
+func TestNewStreamPool_Defaults(t *testing.T) {
+	pool := newStreamPool(0, 0)
+	if pool.maxWorkers != defaultStreamWorkers() || cap(pool.jobs) != pool.maxWorkers {
+		t.Errorf("workers = %d, queue = %d, want %d for both", pool.maxWorkers, cap(pool.jobs), defaultStreamWorkers())
+	}
+}
@@ -3,6 +3,7 @@ package identity
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 
@@ -10,6 +11,9 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 )
 
+// ErrKeyNotFound 身份密钥文件不存在且禁用了自动生成
+var ErrKeyNotFound = errors.New("身份密钥文件不存在")
+
 // Identity 节点身份
 type Identity struct {
 	PrivKey crypto.PrivKey
@@ -61,6 +65,14 @@ func LoadOrGenerate(keyPath string) (*Identity, error) {
 	return identity, nil
 }
 
+// LoadExisting 加载已有的节点身份，文件不存在时返回 ErrKeyNotFound 而不是生成新身份
+func LoadExisting(keyPath string) (*Identity, error) {
+	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s (已禁用自动生成)", ErrKeyNotFound, keyPath)
+	}
+	return Load(keyPath)
+}
+
 // Load 从文件加载节点身份
 func Load(keyPath string) (*Identity, error) {
 	data, err := os.ReadFile(keyPath)
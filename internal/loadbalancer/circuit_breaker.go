@@ -0,0 +1,217 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ErrAllCircuitsOpen 所有候选节点均处于熔断状态
+var ErrAllCircuitsOpen = fmt.Errorf("%w: 所有节点均已熔断", ErrNoAvailableNodes)
+
+// CircuitState 熔断器状态
+type CircuitState int
+
+const (
+	// CircuitClosed 正常放行
+	CircuitClosed CircuitState = iota
+	// CircuitOpen 熔断中，节点被完全排除
+	CircuitOpen
+	// CircuitHalfOpen 冷却结束，仅放行一个探测请求
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// breaker 单个节点的熔断状态
+type breaker struct {
+	state        CircuitState
+	failures     int       // 当前窗口内的连续失败次数
+	firstFailure time.Time // 当前窗口的起点
+	openedAt     time.Time // 进入 open 的时间
+	probeAt      time.Time // 半开状态下放行探测请求的时间，零值表示尚未放行
+}
+
+// CircuitBreakerSelector 熔断选择器
+// 包装任意 Selector: 节点在 window 内连续失败 threshold 次后熔断 cooldown 时长，
+// 冷却结束进入半开状态并只放行一个探测请求，探测成功则恢复，失败则重新熔断
+type CircuitBreakerSelector struct {
+	inner     Selector
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	now       func() time.Time
+
+	breakers map[peer.ID]*breaker
+	mu       sync.Mutex
+}
+
+// NewCircuitBreakerSelector 创建熔断选择器
+// threshold <= 0 时按 1 处理；window <= 0 表示连续失败不受时间窗口限制
+func NewCircuitBreakerSelector(inner Selector, threshold int, window, cooldown time.Duration) *CircuitBreakerSelector {
+	return &CircuitBreakerSelector{
+		inner:     inner,
+		threshold: max(threshold, 1),
+		window:    window,
+		cooldown:  cooldown,
+		now:       time.Now,
+		breakers:  make(map[peer.ID]*breaker),
+	}
+}
+
+// Select 排除熔断中的节点后交由内部选择器选择
+func (s *CircuitBreakerSelector) Select(ctx context.Context, candidates []peer.AddrInfo) (*peer.AddrInfo, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoAvailableNodes
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	allowed := make([]peer.AddrInfo, 0, len(candidates))
+	for _, c := range candidates {
+		if s.allowLocked(c.ID, now) {
+			allowed = append(allowed, c)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, ErrAllCircuitsOpen
+	}
+
+	selected, err := s.inner.Select(ctx, allowed)
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := s.breakers[selected.ID]; ok && b.state == CircuitHalfOpen {
+		b.probeAt = now // 半开状态只放行这一个探测请求
+	}
+	return selected, nil
+}
+
+// allowLocked 判断节点当前是否可被选择，必要时推进 open → half-open (调用者需持有锁)
+func (s *CircuitBreakerSelector) allowLocked(id peer.ID, now time.Time) bool {
+	b, ok := s.breakers[id]
+	if !ok {
+		return true
+	}
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < s.cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probeAt = time.Time{}
+		return true
+	case CircuitHalfOpen:
+		// 探测请求未回报结果时，再等待一个冷却周期后允许重新探测
+		return b.probeAt.IsZero() || now.Sub(b.probeAt) >= s.cooldown
+	default:
+		return true
+	}
+}
+
+// ReportSuccess 报告成功，节点熔断器恢复为 closed
+func (s *CircuitBreakerSelector) ReportSuccess(peerID peer.ID) {
+	s.inner.ReportSuccess(peerID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.breakers, peerID)
+}
+
+// ReportFailure 报告失败，达到阈值或半开探测失败时熔断节点
+func (s *CircuitBreakerSelector) ReportFailure(peerID peer.ID) {
+	s.inner.ReportFailure(peerID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b, ok := s.breakers[peerID]
+	if !ok {
+		b = &breaker{}
+		s.breakers[peerID] = b
+	}
+
+	switch b.state {
+	case CircuitHalfOpen:
+		b.state = CircuitOpen
+		b.openedAt = now
+	case CircuitOpen:
+		// 已熔断 (如熔断前发出的请求迟到的失败)，不延长冷却时间
+	default:
+		if b.failures == 0 || (s.window > 0 && now.Sub(b.firstFailure) > s.window) {
+			b.failures = 0
+			b.firstFailure = now
+		}
+		b.failures++
+		if b.failures >= s.threshold {
+			b.state = CircuitOpen
+			b.openedAt = now
+		}
+	}
+}
+
+// ReportLatency 转发延迟观测值 (内部选择器支持时)
+func (s *CircuitBreakerSelector) ReportLatency(peerID peer.ID, d time.Duration) {
+	if lr, ok := s.inner.(LatencyReporter); ok {
+		lr.ReportLatency(peerID, d)
+	}
+}
+
+// State 返回节点当前的熔断状态
+func (s *CircuitBreakerSelector) State(peerID peer.ID) CircuitState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[peerID]
+	if !ok {
+		return CircuitClosed
+	}
+	if b.state == CircuitOpen && s.now().Sub(b.openedAt) >= s.cooldown {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// Describe 返回候选节点的当前权重和健康状态 (用于拓扑导出)，熔断中的节点标记为不健康
+func (s *CircuitBreakerSelector) Describe(candidates []peer.AddrInfo) []NodeInfo {
+	var infos []NodeInfo
+	if d, ok := s.inner.(interface {
+		Describe([]peer.AddrInfo) []NodeInfo
+	}); ok {
+		infos = d.Describe(candidates)
+	} else {
+		infos = make([]NodeInfo, 0, len(candidates))
+		for _, c := range candidates {
+			addrs := make([]string, 0, len(c.Addrs))
+			for _, a := range c.Addrs {
+				addrs = append(addrs, a.String())
+			}
+			infos = append(infos, NodeInfo{PeerID: c.ID, Addrs: addrs, Weight: 1, Healthy: true})
+		}
+	}
+
+	for i := range infos {
+		if s.State(infos[i].PeerID) == CircuitOpen {
+			infos[i].Weight = 0
+			infos[i].Healthy = false
+		}
+	}
+	return infos
+}
@@ -0,0 +1,179 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// firstSelector 总是选择第一个候选节点，便于观察熔断过滤效果
+type firstSelector struct{}
+
+func (firstSelector) Select(ctx context.Context, candidates []peer.AddrInfo) (*peer.AddrInfo, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoAvailableNodes
+	}
+	return &candidates[0], nil
+}
+func (firstSelector) ReportSuccess(peer.ID) {}
+func (firstSelector) ReportFailure(peer.ID) {}
+
+// fakeClock 可手动推进的时钟
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(threshold int, window, cooldown time.Duration) (*CircuitBreakerSelector, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	s := NewCircuitBreakerSelector(firstSelector{}, threshold, window, cooldown)
+	s.now = clock.Now
+	return s, clock
+}
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	s, clock := newTestBreaker(3, time.Minute, 10*time.Second)
+	candidates := makeCandidates(2)
+	a, b := candidates[0].ID, candidates[1].ID
+
+	for i := 0; i < 2; i++ {
+		s.ReportFailure(a)
+	}
+	if st := s.State(a); st != CircuitClosed {
+		t.Fatalf("below threshold: expected closed, got %v", st)
+	}
+
+	s.ReportFailure(a)
+	if st := s.State(a); st != CircuitOpen {
+		t.Fatalf("expected open after threshold, got %v", st)
+	}
+
+	// open: A 被完全排除
+	for i := 0; i < 5; i++ {
+		got, err := s.Select(context.Background(), candidates)
+		if err != nil {
+			t.Fatalf("Select failed: %v", err)
+		}
+		if got.ID != b {
+			t.Fatalf("open peer selected: %v", got.ID)
+		}
+	}
+
+	// 冷却结束: half-open，只放行一个探测请求
+	clock.Advance(10 * time.Second)
+	if st := s.State(a); st != CircuitHalfOpen {
+		t.Fatalf("expected half-open after cooldown, got %v", st)
+	}
+	got, err := s.Select(context.Background(), candidates)
+	if err != nil || got.ID != a {
+		t.Fatalf("expected probe to go to %v, got %v (err %v)", a, got, err)
+	}
+	got, err = s.Select(context.Background(), candidates)
+	if err != nil || got.ID != b {
+		t.Fatalf("expected second request to skip in-flight probe, got %v (err %v)", got, err)
+	}
+
+	// 探测成功: closed
+	s.ReportSuccess(a)
+	if st := s.State(a); st != CircuitClosed {
+		t.Fatalf("expected closed after successful probe, got %v", st)
+	}
+	got, _ = s.Select(context.Background(), candidates)
+	if got.ID != a {
+		t.Fatalf("closed peer should be selectable, got %v", got.ID)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenFailureReopens(t *testing.T) {
+	s, clock := newTestBreaker(1, time.Minute, 10*time.Second)
+	candidates := makeCandidates(1)
+	a := candidates[0].ID
+
+	s.ReportFailure(a)
+	clock.Advance(10 * time.Second)
+	if _, err := s.Select(context.Background(), candidates); err != nil {
+		t.Fatalf("probe Select failed: %v", err)
+	}
+
+	s.ReportFailure(a)
+	if st := s.State(a); st != CircuitOpen {
+		t.Fatalf("expected reopen after failed probe, got %v", st)
+	}
+
+	// 冷却时间从探测失败时重新计算
+	clock.Advance(5 * time.Second)
+	if st := s.State(a); st != CircuitOpen {
+		t.Fatalf("expected still open mid-cooldown, got %v", st)
+	}
+}
+
+func TestCircuitBreaker_WindowResetsFailures(t *testing.T) {
+	s, clock := newTestBreaker(3, 10*time.Second, time.Minute)
+	id := peer.ID("node-A")
+
+	s.ReportFailure(id)
+	s.ReportFailure(id)
+	clock.Advance(11 * time.Second)
+	s.ReportFailure(id) // 超出窗口，重新计数
+
+	if st := s.State(id); st != CircuitClosed {
+		t.Fatalf("failures outside window should not open, got %v", st)
+	}
+
+	s.ReportFailure(id)
+	s.ReportFailure(id)
+	if st := s.State(id); st != CircuitOpen {
+		t.Fatalf("expected open after threshold within window, got %v", st)
+	}
+}
+
+func TestCircuitBreaker_AllOpen(t *testing.T) {
+	s, _ := newTestBreaker(1, time.Minute, time.Minute)
+	candidates := makeCandidates(2)
+	for _, c := range candidates {
+		s.ReportFailure(c.ID)
+	}
+
+	_, err := s.Select(context.Background(), candidates)
+	if !errors.Is(err, ErrAllCircuitsOpen) || !errors.Is(err, ErrNoAvailableNodes) {
+		t.Fatalf("expected ErrAllCircuitsOpen, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_StaleProbeRetried(t *testing.T) {
+	s, clock := newTestBreaker(1, time.Minute, 10*time.Second)
+	candidates := makeCandidates(1)
+
+	s.ReportFailure(candidates[0].ID)
+	clock.Advance(10 * time.Second)
+	if _, err := s.Select(context.Background(), candidates); err != nil {
+		t.Fatalf("probe Select failed: %v", err)
+	}
+	if _, err := s.Select(context.Background(), candidates); !errors.Is(err, ErrAllCircuitsOpen) {
+		t.Fatalf("expected in-flight probe to block, got %v", err)
+	}
+
+	// 探测结果一直未回报，冷却一个周期后允许重新探测
+	clock.Advance(10 * time.Second)
+	if _, err := s.Select(context.Background(), candidates); err != nil {
+		t.Fatalf("expected new probe after stale probe, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_DescribeMarksOpenUnhealthy(t *testing.T) {
+	s, _ := newTestBreaker(1, time.Minute, time.Minute)
+	s.inner = NewWeightedSelector()
+	candidates := makeCandidates(2)
+	s.ReportFailure(candidates[0].ID)
+
+	infos := s.Describe(candidates)
+	if infos[0].Healthy || infos[0].Weight != 0 {
+		t.Fatalf("open peer should be unhealthy with zero weight: %+v", infos[0])
+	}
+	if !infos[1].Healthy {
+		t.Fatalf("closed peer should be healthy: %+v", infos[1])
+	}
+}
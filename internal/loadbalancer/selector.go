@@ -3,8 +3,10 @@ package loadbalancer
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math/rand/v2"
 	"sync"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
 )
@@ -31,6 +33,28 @@ type Selector interface {
 	ReportFailure(peerID peer.ID)
 }
 
+// NewSelector 按名称创建选择器: weighted (默认)、latency、round_robin、random
+func NewSelector(name string) (Selector, error) {
+	switch name {
+	case "", "weighted":
+		return NewWeightedSelector(), nil
+	case "latency":
+		return NewLatencySelector(), nil
+	case "round_robin":
+		return NewRoundRobinSelector(), nil
+	case "random":
+		return NewRandomSelector(), nil
+	default:
+		return nil, fmt.Errorf("未知的选择策略: %q (支持: weighted, latency, round_robin, random)", name)
+	}
+}
+
+// LatencyReporter 可接收延迟观测值的选择器
+type LatencyReporter interface {
+	// ReportLatency 报告一次对节点的延迟观测 (RTT 或请求往返时间)
+	ReportLatency(peerID peer.ID, d time.Duration)
+}
+
 // filterHealthy 过滤健康节点 (失败次数 < threshold 的节点)
 // 如果全部不健康，返回原列表并清空 failures
 func filterHealthy(candidates []peer.AddrInfo, failures map[peer.ID]int, threshold int) ([]peer.AddrInfo, bool) {
@@ -152,6 +176,27 @@ func (s *WeightedSelector) ReportFailure(peerID peer.ID) {
 	}
 }
 
+// Describe 返回候选节点的当前权重和健康状态 (用于拓扑导出)
+func (s *WeightedSelector) Describe(candidates []peer.AddrInfo) []NodeInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := make([]NodeInfo, 0, len(candidates))
+	for _, c := range candidates {
+		addrs := make([]string, 0, len(c.Addrs))
+		for _, a := range c.Addrs {
+			addrs = append(addrs, a.String())
+		}
+		infos = append(infos, NodeInfo{
+			PeerID:  c.ID,
+			Addrs:   addrs,
+			Weight:  s.getWeight(c.ID),
+			Healthy: s.failures[c.ID] < 3,
+		})
+	}
+	return infos
+}
+
 // SetWeight 设置节点权重
 func (s *WeightedSelector) SetWeight(peerID peer.ID, weight float64) {
 	s.mu.Lock()
@@ -257,3 +302,147 @@ func (s *RandomSelector) ReportFailure(peerID peer.ID) {
 	defer s.mu.Unlock()
 	s.failures[peerID]++
 }
+
+// defaultLatencyAlpha EWMA 平滑系数，越大越偏向最近的观测值
+const defaultLatencyAlpha = 0.3
+
+// LatencySelector 延迟感知选择器
+// 按每个节点的 RTT 指数加权移动平均 (EWMA) 做反比加权随机选择，连续失败 3 次的节点暂时排除
+type LatencySelector struct {
+	ewma     map[peer.ID]float64 // 平滑后的延迟 (纳秒)
+	failures map[peer.ID]int
+	alpha    float64
+	mu       sync.Mutex
+}
+
+// NewLatencySelector 创建延迟感知选择器
+func NewLatencySelector() *LatencySelector {
+	return &LatencySelector{
+		ewma:     make(map[peer.ID]float64),
+		failures: make(map[peer.ID]int),
+		alpha:    defaultLatencyAlpha,
+	}
+}
+
+// Select 按延迟反比加权随机选择
+func (s *LatencySelector) Select(ctx context.Context, candidates []peer.AddrInfo) (*peer.AddrInfo, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoAvailableNodes
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	healthy, resetNeeded := filterHealthy(candidates, s.failures, 3)
+	if resetNeeded {
+		s.failures = make(map[peer.ID]int)
+	}
+
+	weights := s.weights(healthy)
+	var totalWeight float64
+	for _, w := range weights {
+		totalWeight += w
+	}
+
+	r := rand.Float64() * totalWeight
+	var cumulative float64
+	for i, w := range weights {
+		cumulative += w
+		if r <= cumulative {
+			return &healthy[i], nil
+		}
+	}
+	return &healthy[len(healthy)-1], nil
+}
+
+// weights 计算候选节点的选择权重 (调用者需持有锁)
+// 尚无观测值的节点按已知节点的平均延迟计算，使新节点有机会被探索
+func (s *LatencySelector) weights(candidates []peer.AddrInfo) []float64 {
+	var sum float64
+	var known int
+	for _, c := range candidates {
+		if l, ok := s.ewma[c.ID]; ok {
+			sum += l
+			known++
+		}
+	}
+
+	weights := make([]float64, len(candidates))
+	for i, c := range candidates {
+		l, ok := s.ewma[c.ID]
+		if !ok {
+			if known == 0 {
+				weights[i] = 1.0
+				continue
+			}
+			l = sum / float64(known)
+		}
+		weights[i] = float64(time.Second) / max(l, 1) // 延迟越低权重越高
+	}
+	return weights
+}
+
+// ReportLatency 以 EWMA 方式更新节点延迟
+func (s *LatencySelector) ReportLatency(peerID peer.ID, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sample := float64(d)
+	if prev, ok := s.ewma[peerID]; ok {
+		s.ewma[peerID] = s.alpha*sample + (1-s.alpha)*prev
+	} else {
+		s.ewma[peerID] = sample
+	}
+}
+
+// Latency 返回节点当前的平滑延迟，无观测值时返回 false
+func (s *LatencySelector) Latency(peerID peer.ID) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.ewma[peerID]
+	return time.Duration(l), ok
+}
+
+// ReportSuccess 报告成功
+func (s *LatencySelector) ReportSuccess(peerID peer.ID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, peerID)
+}
+
+// ReportFailure 报告失败
+func (s *LatencySelector) ReportFailure(peerID peer.ID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[peerID]++
+}
+
+// Describe 返回候选节点的当前权重和健康状态 (用于拓扑导出)
+func (s *LatencySelector) Describe(candidates []peer.AddrInfo) []NodeInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	weights := s.weights(candidates)
+	infos := make([]NodeInfo, 0, len(candidates))
+	for i, c := range candidates {
+		addrs := make([]string, 0, len(c.Addrs))
+		for _, a := range c.Addrs {
+			addrs = append(addrs, a.String())
+		}
+		healthy := s.failures[c.ID] < 3
+		w := weights[i]
+		if !healthy {
+			w = 0
+		}
+		infos = append(infos, NodeInfo{
+			PeerID:  c.ID,
+			Addrs:   addrs,
+			Weight:  w,
+			Healthy: healthy,
+		})
+	}
+	return infos
+}
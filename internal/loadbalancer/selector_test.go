@@ -2,8 +2,10 @@ package loadbalancer
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
 )
@@ -86,6 +88,28 @@ func TestWeightedSelector_ReportSuccessClearsFailures(t *testing.T) {
 	}
 }
 
+func TestWeightedSelector_Describe(t *testing.T) {
+	s := NewWeightedSelector()
+	candidates := makeCandidates(2)
+	for i := 0; i < 3; i++ {
+		s.ReportFailure(candidates[1].ID)
+	}
+
+	infos := s.Describe(candidates)
+	if len(infos) != 2 {
+		t.Fatalf("Describe 应返回 2 个节点, got %d", len(infos))
+	}
+	if infos[0].PeerID != candidates[0].ID || !infos[0].Healthy || infos[0].Weight != 1.0 {
+		t.Errorf("未失败节点应健康且权重为 1.0, got %+v", infos[0])
+	}
+	if infos[1].Healthy {
+		t.Errorf("连续失败 3 次的节点应标记为不健康, got %+v", infos[1])
+	}
+	if infos[1].Weight >= infos[0].Weight {
+		t.Errorf("失败节点权重应低于健康节点: %v >= %v", infos[1].Weight, infos[0].Weight)
+	}
+}
+
 func TestWeightedSelector_WeightCap(t *testing.T) {
 	s := NewWeightedSelector()
 	id := peer.ID("node-A")
@@ -316,3 +340,119 @@ func TestConcurrentSelectorAccess(t *testing.T) {
 		wg.Wait()
 	}
 }
+
+// --- LatencySelector ---
+
+func TestLatencySelector_PrefersFastPeer(t *testing.T) {
+	s := NewLatencySelector()
+	candidates := makeCandidates(2)
+	fast, slow := candidates[0].ID, candidates[1].ID
+
+	for i := 0; i < 10; i++ {
+		s.ReportLatency(fast, 10*time.Millisecond)
+		s.ReportLatency(slow, 200*time.Millisecond)
+	}
+
+	counts := make(map[peer.ID]int)
+	const rounds = 5000
+	for i := 0; i < rounds; i++ {
+		selected, err := s.Select(context.Background(), candidates)
+		if err != nil {
+			t.Fatalf("Select failed: %v", err)
+		}
+		counts[selected.ID]++
+	}
+
+	// 权重比 20:1，慢节点期望约占 5%
+	if counts[slow]*10 > rounds {
+		t.Errorf("慢节点被选中 %d/%d 次，应远少于快节点 (%d 次)", counts[slow], rounds, counts[fast])
+	}
+	if counts[slow] == 0 {
+		t.Error("慢节点仍应有少量机会被选中")
+	}
+}
+
+func TestLatencySelector_EWMA(t *testing.T) {
+	s := NewLatencySelector()
+	id := peer.ID("node-A")
+
+	if _, ok := s.Latency(id); ok {
+		t.Fatal("未观测的节点不应有延迟值")
+	}
+
+	s.ReportLatency(id, 100*time.Millisecond)
+	s.ReportLatency(id, 200*time.Millisecond)
+
+	// 0.3*200 + 0.7*100 = 130ms
+	got, ok := s.Latency(id)
+	if !ok || got != 130*time.Millisecond {
+		t.Fatalf("Latency = %v, want 130ms", got)
+	}
+
+	// 非正值不影响平均值
+	s.ReportLatency(id, 0)
+	if got, _ := s.Latency(id); got != 130*time.Millisecond {
+		t.Errorf("零值观测不应改变延迟, got %v", got)
+	}
+}
+
+func TestLatencySelector_ExcludesFailedPeer(t *testing.T) {
+	s := NewLatencySelector()
+	candidates := makeCandidates(2)
+	fast, slow := candidates[0].ID, candidates[1].ID
+
+	s.ReportLatency(fast, time.Millisecond)
+	s.ReportLatency(slow, time.Second)
+	for i := 0; i < 3; i++ {
+		s.ReportFailure(fast)
+	}
+
+	for i := 0; i < 50; i++ {
+		selected, _ := s.Select(context.Background(), candidates)
+		if selected.ID != slow {
+			t.Fatalf("连续失败 3 次的节点不应被选中, got %s", selected.ID)
+		}
+	}
+
+	// 恢复后重新参与选择
+	s.ReportSuccess(fast)
+	infos := s.Describe(candidates)
+	if !infos[0].Healthy || infos[0].Weight <= infos[1].Weight {
+		t.Errorf("恢复后的快节点应健康且权重更高, got %+v", infos)
+	}
+}
+
+func TestLatencySelector_UnknownPeerUsesAverage(t *testing.T) {
+	s := NewLatencySelector()
+	candidates := makeCandidates(3)
+	s.ReportLatency(candidates[0].ID, 10*time.Millisecond)
+	s.ReportLatency(candidates[1].ID, 30*time.Millisecond)
+
+	infos := s.Describe(candidates)
+	// 未观测节点按平均 20ms 计算，权重介于两者之间
+	if !(infos[2].Weight < infos[0].Weight && infos[2].Weight > infos[1].Weight) {
+		t.Errorf("未观测节点权重应介于已知节点之间, got %+v", infos)
+	}
+}
+
+func TestNewSelector(t *testing.T) {
+	for name, want := range map[string]string{
+		"":            "*loadbalancer.WeightedSelector",
+		"weighted":    "*loadbalancer.WeightedSelector",
+		"latency":     "*loadbalancer.LatencySelector",
+		"round_robin": "*loadbalancer.RoundRobinSelector",
+		"random":      "*loadbalancer.RandomSelector",
+	} {
+		s, err := NewSelector(name)
+		if err != nil {
+			t.Fatalf("NewSelector(%q) failed: %v", name, err)
+		}
+		if got := fmt.Sprintf("%T", s); got != want {
+			t.Errorf("NewSelector(%q) = %s, want %s", name, got, want)
+		}
+	}
+
+	if _, err := NewSelector("fastest"); err == nil {
+		t.Error("unknown selector name should fail")
+	}
+}
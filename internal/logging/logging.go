@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// 日志格式
+const (
+	FormatText = "text" // 人类可读文本 (默认)，经标准库 log 输出
+	FormatJSON = "json" // 每行一个 JSON 对象，供日志管道解析
+)
+
+// 结构化字段名
+const (
+	KeyComponent = "component" // 节点组件: client / relay / exit
+	KeyPeerID    = "peer_id"   // 节点或对端的 libp2p PeerID
+	KeyExitHash  = "exit_hash" // Exit 公钥哈希
+	KeyRelay     = "relay"     // Relay 地址
+	KeyRemote    = "remote"    // 对端网络地址
+	KeyError     = "error"     // 错误详情
+)
+
+// Logger 结构化日志接口，args 为交替的键值对
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+	// With 返回附加了固定字段的 Logger
+	With(args ...any) Logger
+}
+
+// slogLogger 基于 log/slog 的 Logger 实现
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// New 创建指定组件的 Logger，输出到 Setup 配置的全局日志
+// 需在 Setup 之后创建，之前创建的 Logger 保持默认文本格式
+func New(component string) Logger {
+	return &slogLogger{l: slog.Default().With(KeyComponent, component)}
+}
+
+// NewWithHandler 使用指定 handler 创建 Logger (测试或嵌入场景)
+func NewWithHandler(h slog.Handler, component string) Logger {
+	return &slogLogger{l: slog.New(h).With(KeyComponent, component)}
+}
+
+func (s *slogLogger) Debug(msg string, args ...any) { s.l.Debug(msg, args...) }
+func (s *slogLogger) Info(msg string, args ...any)  { s.l.Info(msg, args...) }
+func (s *slogLogger) Warn(msg string, args ...any)  { s.l.Warn(msg, args...) }
+func (s *slogLogger) Error(msg string, args ...any) { s.l.Error(msg, args...) }
+
+func (s *slogLogger) With(args ...any) Logger {
+	return &slogLogger{l: s.l.With(args...)}
+}
+
+// ParseLevel 解析日志级别: debug / info / warn / error，空字符串为 info
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("无效的日志级别 %q (可选 debug/info/warn/error)", s)
+	}
+	return level, nil
+}
+
+// NewJSONHandler 创建 JSON 格式的 handler: 时间字段为 ts，级别为小写
+func NewJSONHandler(w io.Writer, level slog.Level) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.TimeKey:
+				a.Key = "ts"
+			case slog.LevelKey:
+				a.Value = slog.StringValue(strings.ToLower(a.Value.String()))
+			}
+			return a
+		},
+	})
+}
+
+// Setup 按格式和级别配置全局日志，需在创建各节点之前调用
+// JSON 模式下尚未迁移的标准库 log 输出同样转为 JSON 行 (级别为 info)
+func Setup(format, level string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "", FormatText:
+		slog.SetLogLoggerLevel(lvl)
+	case FormatJSON:
+		slog.SetDefault(slog.New(NewJSONHandler(os.Stderr, lvl)))
+	default:
+		return fmt.Errorf("无效的日志格式 %q (可选 text/json)", format)
+	}
+	return nil
+}
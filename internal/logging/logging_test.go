@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestJSONLogger_Fields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewWithHandler(NewJSONHandler(&buf, slog.LevelInfo), "relay").With(KeyPeerID, "12D3KooTest")
+
+	logger.Info("Exit 注册成功", KeyExitHash, "abc123", "instances", 2)
+	logger.Debug("低于级别的日志不输出")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1: %q", len(lines), buf.String())
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", lines[0], err)
+	}
+
+	want := map[string]any{
+		"component": "relay",
+		"peer_id":   "12D3KooTest",
+		"exit_hash": "abc123",
+		"level":     "info",
+		"msg":       "Exit 注册成功",
+		"instances": float64(2),
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s = %v, want %v", k, entry[k], v)
+		}
+	}
+	if _, ok := entry["ts"]; !ok {
+		t.Errorf("missing ts field: %v", entry)
+	}
+	if _, ok := entry["time"]; ok {
+		t.Errorf("time should be renamed to ts: %v", entry)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want slog.Level
+		ok   bool
+	}{
+		{"", slog.LevelInfo, true},
+		{"debug", slog.LevelDebug, true},
+		{"WARN", slog.LevelWarn, true},
+		{"error", slog.LevelError, true},
+		{"verbose", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.in)
+		if (err == nil) != tt.ok || (tt.ok && got != tt.want) {
+			t.Errorf("ParseLevel(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestSetup_Invalid(t *testing.T) {
+	if err := Setup("xml", "info"); err == nil {
+		t.Error("expected invalid format to be rejected")
+	}
+	if err := Setup(FormatText, "verbose"); err == nil {
+		t.Error("expected invalid level to be rejected")
+	}
+}
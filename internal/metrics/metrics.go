@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/binn/tokengo/internal/config"
+)
+
+// 指标名称 (Prometheus 以 "_" 连接前缀，StatsD 以 "." 连接前缀)
+const (
+	RelayForwardTotal     = "relay_forward_total"      // Relay 转发的请求数
+	RelayForwardErrors    = "relay_forward_errors"     // Relay 转发失败数
+	RelayForwardDuration  = "relay_forward_duration"   // Relay 单次转发耗时
+	RelayRegisteredExits  = "relay_registered_exits"   // Relay 当前在线的 Exit 连接数
+	RelayExitHeartbeatRTT = "relay_exit_heartbeat_rtt" // Exit 心跳通告的往返时间
+	RelayRateLimited      = "relay_rate_limited"       // Relay 因 Client 来源地址超出请求速率拒绝的请求数
+	ExitRequestTotal      = "exit_request_total"       // Exit 处理的请求数
+	ExitRequestErrors     = "exit_request_errors"      // Exit 处理失败数
+	ExitRequestDuration   = "exit_request_duration"    // Exit 单次请求处理耗时 (含后端)
+	ExitHeartbeatRTT      = "exit_heartbeat_rtt"       // Exit 与 Relay 的心跳往返时间
+	ExitPromptTokens      = "exit_prompt_tokens"       // Exit 转发的输入 token 数 (按 model 标签区分)
+	ExitCompletionTokens  = "exit_completion_tokens"   // Exit 转发的输出 token 数 (按 model 标签区分)
+	ExitTotalTokens       = "exit_total_tokens"        // Exit 转发的总 token 数 (按 model 标签区分)
+)
+
+// DefaultPrefix 默认指标名前缀
+const DefaultPrefix = "tokengo"
+
+// Sink 指标输出接口
+type Sink interface {
+	// Count 累加计数器
+	Count(name string, delta int64)
+	// Gauge 设置瞬时值
+	Gauge(name string, value float64)
+	// Timing 记录一次耗时
+	Timing(name string, d time.Duration)
+	// Close 释放资源 (停止 HTTP 服务或关闭 UDP 连接)
+	Close() error
+}
+
+// WithLabel 为指标名附加一个标签 (如按模型区分的计数器)
+// Prometheus 输出为 name{key="value"}，StatsD 输出为 DogStatsD 标签 |#key:value
+func WithLabel(name, key, value string) string {
+	return name + "{" + key + "=" + value + "}"
+}
+
+// splitLabel 拆分 WithLabel 生成的指标名，没有标签时 key 为空
+func splitLabel(name string) (base, key, value string) {
+	i := strings.IndexByte(name, '{')
+	if i < 0 || !strings.HasSuffix(name, "}") {
+		return name, "", ""
+	}
+	key, value, _ = strings.Cut(name[i+1:len(name)-1], "=")
+	return name[:i], key, value
+}
+
+// Nop 丢弃所有指标 (未配置 metrics 时使用)
+type Nop struct{}
+
+func (Nop) Count(string, int64)          {}
+func (Nop) Gauge(string, float64)        {}
+func (Nop) Timing(string, time.Duration) {}
+func (Nop) Close() error                 { return nil }
+
+// New 按配置创建指标输出: prometheus (HTTP 拉取)、statsd (UDP 推送)，未配置时返回 Nop
+func New(cfg config.MetricsConfig) (Sink, error) {
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+
+	switch cfg.Backend {
+	case "", "none":
+		return Nop{}, nil
+	case "prometheus":
+		if cfg.Listen == "" {
+			return nil, fmt.Errorf("prometheus 指标需要配置 metrics.listen")
+		}
+		return ServePrometheus(cfg.Listen, prefix)
+	case "statsd":
+		if cfg.Address == "" {
+			return nil, fmt.Errorf("statsd 指标需要配置 metrics.address")
+		}
+		return NewStatsD(cfg.Address, prefix)
+	default:
+		return nil, fmt.Errorf("未知的指标后端: %q (支持: prometheus, statsd)", cfg.Backend)
+	}
+}
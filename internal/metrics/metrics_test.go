@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/config"
+)
+
+// startMockStatsD 启动 UDP 接收端，返回地址和读取 n 个数据包的函数
+func startMockStatsD(t *testing.T) (string, func(n int) []string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	read := func(n int) []string {
+		packets := make([]string, 0, n)
+		buf := make([]byte, 1500)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for len(packets) < n {
+			size, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("read packet %d/%d: %v", len(packets)+1, n, err)
+			}
+			packets = append(packets, string(buf[:size]))
+		}
+		return packets
+	}
+	return conn.LocalAddr().String(), read
+}
+
+func TestStatsD_EmitsPackets(t *testing.T) {
+	addr, read := startMockStatsD(t)
+
+	sink, err := New(config.MetricsConfig{Backend: "statsd", Address: addr})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer sink.Close()
+
+	sink.Count(RelayForwardTotal, 1)
+	sink.Gauge(RelayRegisteredExits, 3)
+	sink.Timing(RelayForwardDuration, 1500*time.Microsecond)
+
+	got := read(3)
+	sort.Strings(got)
+	want := []string{
+		"tokengo.relay_forward_duration:1.5|ms",
+		"tokengo.relay_forward_total:1|c",
+		"tokengo.relay_registered_exits:3|g",
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("packet %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestStatsD_CustomPrefix(t *testing.T) {
+	addr, read := startMockStatsD(t)
+
+	sink, err := NewStatsD(addr, "edge")
+	if err != nil {
+		t.Fatalf("NewStatsD: %v", err)
+	}
+	defer sink.Close()
+
+	sink.Count(ExitRequestErrors, 2)
+	if got := read(1)[0]; got != "edge.exit_request_errors:2|c" {
+		t.Errorf("packet = %q", got)
+	}
+}
+
+func TestPrometheus_ServesMetrics(t *testing.T) {
+	sink, err := New(config.MetricsConfig{Backend: "prometheus", Listen: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer sink.Close()
+
+	sink.Count(ExitRequestTotal, 2)
+	sink.Gauge(RelayRegisteredExits, 1)
+	sink.Timing(ExitRequestDuration, 250*time.Millisecond)
+	sink.Timing(ExitRequestDuration, 250*time.Millisecond)
+
+	resp, err := http.Get("http://" + sink.(*Prometheus).Addr() + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, want := range []string{
+		"# TYPE tokengo_exit_request_total counter\ntokengo_exit_request_total 2\n",
+		"# TYPE tokengo_relay_registered_exits gauge\ntokengo_relay_registered_exits 1\n",
+		"tokengo_exit_request_duration_seconds_sum 0.5\n",
+		"tokengo_exit_request_duration_seconds_count 2\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("response missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestPrometheus_LabeledCounters(t *testing.T) {
+	p := NewPrometheus(DefaultPrefix)
+	p.Count(WithLabel(ExitTotalTokens, "model", "gpt-4o"), 30)
+	p.Count(WithLabel(ExitTotalTokens, "model", `llama3"8b`), 5)
+	p.Count(WithLabel(ExitTotalTokens, "model", "gpt-4o"), 12)
+	p.Count(ExitRequestTotal, 1)
+
+	want := "# TYPE tokengo_exit_request_total counter\ntokengo_exit_request_total 1\n" +
+		"# TYPE tokengo_exit_total_tokens counter\n" +
+		"tokengo_exit_total_tokens{model=\"gpt-4o\"} 42\n" +
+		"tokengo_exit_total_tokens{model=\"llama3\\\"8b\"} 5\n"
+	if got := p.Render(); got != want {
+		t.Errorf("Render() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestStatsD_LabelAsTag(t *testing.T) {
+	addr, read := startMockStatsD(t)
+
+	sink, err := NewStatsD(addr, "")
+	if err != nil {
+		t.Fatalf("NewStatsD: %v", err)
+	}
+	defer sink.Close()
+
+	sink.Count(WithLabel(ExitPromptTokens, "model", "gpt-4o"), 7)
+	if got := read(1)[0]; got != "exit_prompt_tokens:7|c|#model:gpt-4o" {
+		t.Errorf("packet = %q", got)
+	}
+}
+
+func TestNew_Backends(t *testing.T) {
+	sink, err := New(config.MetricsConfig{})
+	if err != nil {
+		t.Fatalf("New(empty): %v", err)
+	}
+	if _, ok := sink.(Nop); !ok {
+		t.Errorf("empty backend = %T, want Nop", sink)
+	}
+
+	for _, cfg := range []config.MetricsConfig{
+		{Backend: "graphite"},
+		{Backend: "prometheus"},
+		{Backend: "statsd"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) should fail", cfg)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prometheus 以 Prometheus 文本格式暴露指标 (/metrics)
+// Timing 按 summary 输出 _sum (秒) 和 _count
+type Prometheus struct {
+	prefix   string
+	mu       sync.Mutex
+	counters map[string]int64
+	gauges   map[string]float64
+	timings  map[string]*timingStat
+
+	server   *http.Server
+	listener net.Listener
+}
+
+type timingStat struct {
+	sum   time.Duration
+	count int64
+}
+
+// NewPrometheus 创建 Prometheus 指标输出 (不启动 HTTP 服务，可自行挂载 Handler)
+func NewPrometheus(prefix string) *Prometheus {
+	return &Prometheus{
+		prefix:   prefix,
+		counters: make(map[string]int64),
+		gauges:   make(map[string]float64),
+		timings:  make(map[string]*timingStat),
+	}
+}
+
+// ServePrometheus 创建 Prometheus 指标输出并在 addr 上提供 /metrics
+func ServePrometheus(addr, prefix string) (*Prometheus, error) {
+	p := NewPrometheus(prefix)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("启动指标 HTTP 服务失败: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", p)
+	p.listener = ln
+	p.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := p.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("指标 HTTP 服务异常退出: %v", err)
+		}
+	}()
+	log.Printf("Prometheus 指标: http://%s/metrics", ln.Addr())
+	return p, nil
+}
+
+// Addr 返回指标 HTTP 服务的实际监听地址，未启动时为空
+func (p *Prometheus) Addr() string {
+	if p.listener == nil {
+		return ""
+	}
+	return p.listener.Addr().String()
+}
+
+// Count 累加计数器
+func (p *Prometheus) Count(name string, delta int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counters[name] += delta
+}
+
+// Gauge 设置瞬时值
+func (p *Prometheus) Gauge(name string, value float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gauges[name] = value
+}
+
+// Timing 记录一次耗时
+func (p *Prometheus) Timing(name string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.timings[name]
+	if !ok {
+		t = &timingStat{}
+		p.timings[name] = t
+	}
+	t.sum += d
+	t.count++
+}
+
+// ServeHTTP 输出 Prometheus 文本格式
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(p.Render()))
+}
+
+// Render 按名称排序渲染所有指标，同名不同标签的指标共用一行 TYPE
+func (p *Prometheus) Render() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b strings.Builder
+	typed := make(map[string]bool)
+	writeType := func(full, kind string) {
+		if !typed[full] {
+			typed[full] = true
+			fmt.Fprintf(&b, "# TYPE %s %s\n", full, kind)
+		}
+	}
+	for _, name := range sortedKeys(p.counters) {
+		full, labels := p.series(name, "")
+		writeType(full, "counter")
+		fmt.Fprintf(&b, "%s%s %d\n", full, labels, p.counters[name])
+	}
+	for _, name := range sortedKeys(p.gauges) {
+		full, labels := p.series(name, "")
+		writeType(full, "gauge")
+		fmt.Fprintf(&b, "%s%s %g\n", full, labels, p.gauges[name])
+	}
+	for _, name := range sortedKeys(p.timings) {
+		full, labels := p.series(name, "_seconds")
+		writeType(full, "summary")
+		t := p.timings[name]
+		fmt.Fprintf(&b, "%s_sum%s %g\n%s_count%s %d\n", full, labels, t.sum.Seconds(), full, labels, t.count)
+	}
+	return b.String()
+}
+
+// series 返回带前缀的指标名 (附加 suffix) 和标签部分 ({key="value"}，没有标签时为空)
+func (p *Prometheus) series(name, suffix string) (full, labels string) {
+	base, key, value := splitLabel(name)
+	full = p.name(base) + suffix
+	if key != "" {
+		labels = "{" + key + "=\"" + labelEscaper.Replace(value) + "\"}"
+	}
+	return full, labels
+}
+
+// labelEscaper 按 Prometheus 文本格式转义标签值
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Close 停止指标 HTTP 服务
+func (p *Prometheus) Close() error {
+	if p.server == nil {
+		return nil
+	}
+	return p.server.Close()
+}
+
+func (p *Prometheus) name(name string) string {
+	if p.prefix == "" {
+		return name
+	}
+	return p.prefix + "_" + name
+}
+
+// sortedKeys 按基础名称、再按标签排序，同名指标相邻输出
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		bi, ki, vi := splitLabel(keys[i])
+		bj, kj, vj := splitLabel(keys[j])
+		if bi != bj {
+			return bi < bj
+		}
+		if ki != kj {
+			return ki < kj
+		}
+		return vi < vj
+	})
+	return keys
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsD 以 StatsD 行协议通过 UDP 推送指标 (DogStatsD 兼容)
+// 每个指标单独发送一个数据包；UDP 发送失败直接丢弃，不影响转发路径
+type StatsD struct {
+	prefix string
+	conn   net.Conn
+}
+
+// NewStatsD 创建 StatsD 指标输出，addr 为 host:port
+func NewStatsD(addr, prefix string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接 StatsD %s 失败: %w", addr, err)
+	}
+	return &StatsD{prefix: prefix, conn: conn}, nil
+}
+
+// Count 发送计数器 (name:delta|c)
+func (s *StatsD) Count(name string, delta int64) {
+	s.send(name, strconv.FormatInt(delta, 10), "c")
+}
+
+// Gauge 发送瞬时值 (name:value|g)
+func (s *StatsD) Gauge(name string, value float64) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g")
+}
+
+// Timing 发送耗时，单位毫秒 (name:ms|ms)
+func (s *StatsD) Timing(name string, d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	s.send(name, strconv.FormatFloat(ms, 'f', -1, 64), "ms")
+}
+
+// Close 关闭 UDP 连接
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+func (s *StatsD) send(name, value, kind string) {
+	name, key, label := splitLabel(name)
+	if s.prefix != "" {
+		name = s.prefix + "." + name
+	}
+	packet := name + ":" + value + "|" + kind
+	if key != "" {
+		packet += "|#" + key + ":" + tagEscaper.Replace(label)
+	}
+	s.conn.Write([]byte(packet))
+}
+
+// tagEscaper 替换 DogStatsD 标签值中的分隔符
+var tagEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
@@ -0,0 +1,146 @@
+package netutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// AddrFamily 节点同时通告 IPv4 和 IPv6 地址时的拨号偏好
+type AddrFamily string
+
+const (
+	AddrFamilyAny           AddrFamily = ""               // 使用通告顺序中的第一个地址 (默认)
+	AddrFamilyPreferIPv4    AddrFamily = "prefer-v4"      // 优先 IPv4，无 IPv4 地址时回退 IPv6
+	AddrFamilyPreferIPv6    AddrFamily = "prefer-v6"      // 优先 IPv6，无 IPv6 地址时回退 IPv4
+	AddrFamilyHappyEyeballs AddrFamily = "happy-eyeballs" // 两个地址族竞速，使用先连通的一个
+)
+
+// HappyEyeballsDelay 竞速拨号时启动下一个候选地址前的等待时间 (RFC 8305 建议值)
+const HappyEyeballsDelay = 250 * time.Millisecond
+
+// ParseAddrFamily 解析地址族偏好配置
+func ParseAddrFamily(s string) (AddrFamily, error) {
+	switch f := AddrFamily(s); f {
+	case AddrFamilyAny, AddrFamilyPreferIPv4, AddrFamilyPreferIPv6, AddrFamilyHappyEyeballs:
+		return f, nil
+	default:
+		return "", fmt.Errorf("无效的地址族偏好 %q (可选 prefer-v4/prefer-v6/happy-eyeballs)", s)
+	}
+}
+
+// SelectQUICAddresses 按地址族偏好从 multiaddr 列表选出待拨号的 host:port 地址
+// 每个地址族内与 ExtractQUICAddress 一样优先 UDP 地址；
+// happy-eyeballs 模式返回每个地址族各一个地址 (IPv6 在前)，其余模式最多返回一个
+func SelectQUICAddresses(addrs []ma.Multiaddr, family AddrFamily) []string {
+	if family == AddrFamilyAny {
+		if addr := ExtractQUICAddress(addrs); addr != "" {
+			return []string{addr}
+		}
+		return nil
+	}
+
+	var v4, v6 []ma.Multiaddr
+	for _, addr := range addrs {
+		a, ok := parseQUICAddr(addr)
+		if !ok {
+			continue
+		}
+		if a.ipv6 {
+			v6 = append(v6, addr)
+		} else {
+			v4 = append(v4, addr)
+		}
+	}
+	best4, best6 := ExtractQUICAddress(v4), ExtractQUICAddress(v6)
+
+	var ordered []string
+	switch family {
+	case AddrFamilyPreferIPv4:
+		ordered = []string{best4, best6}
+	default:
+		ordered = []string{best6, best4}
+	}
+
+	var result []string
+	for _, addr := range ordered {
+		if addr == "" {
+			continue
+		}
+		result = append(result, addr)
+		if family != AddrFamilyHappyEyeballs {
+			break
+		}
+	}
+	return result
+}
+
+// RaceDial 按 Happy Eyeballs 方式竞速拨号: 依次启动候选地址，前一个尝试在 delay 内未成功或已失败时启动下一个，
+// 返回最先成功的结果及其地址；竞速失败但随后连通的结果交给 closeFn 释放 (可为 nil)
+func RaceDial[T any](ctx context.Context, addrs []string, delay time.Duration,
+	dial func(ctx context.Context, addr string) (T, error), closeFn func(T)) (T, string, error) {
+	var zero T
+	if len(addrs) == 0 {
+		return zero, "", errors.New("没有可拨号的地址")
+	}
+	if len(addrs) == 1 {
+		conn, err := dial(ctx, addrs[0])
+		return conn, addrs[0], err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn T
+		addr string
+		err  error
+	}
+	results := make(chan result, len(addrs))
+
+	next, running := 0, 0
+	var nextAttempt <-chan time.Time
+	start := func() {
+		addr := addrs[next]
+		next++
+		running++
+		go func() {
+			conn, err := dial(ctx, addr)
+			results <- result{conn: conn, addr: addr, err: err}
+		}()
+		nextAttempt = nil
+		if next < len(addrs) {
+			nextAttempt = time.After(delay)
+		}
+	}
+
+	start()
+	var errs []error
+	for running > 0 {
+		select {
+		case r := <-results:
+			running--
+			if r.err == nil {
+				// 释放仍在进行的尝试中随后成功的连接
+				go func(n int) {
+					for i := 0; i < n; i++ {
+						if late := <-results; late.err == nil && closeFn != nil {
+							closeFn(late.conn)
+						}
+					}
+				}(running)
+				return r.conn, r.addr, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", r.addr, r.err))
+			if next < len(addrs) {
+				start()
+			}
+		case <-nextAttempt:
+			start()
+		}
+	}
+	return zero, "", errors.Join(errs...)
+}
@@ -0,0 +1,165 @@
+package netutil
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func mustAddrs(t *testing.T, ss ...string) []ma.Multiaddr {
+	t.Helper()
+	addrs := make([]ma.Multiaddr, len(ss))
+	for i, s := range ss {
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			t.Fatalf("NewMultiaddr(%q): %v", s, err)
+		}
+		addrs[i] = a
+	}
+	return addrs
+}
+
+func TestParseAddrFamily(t *testing.T) {
+	for _, s := range []string{"", "prefer-v4", "prefer-v6", "happy-eyeballs"} {
+		if f, err := ParseAddrFamily(s); err != nil || string(f) != s {
+			t.Errorf("ParseAddrFamily(%q) = %q, %v", s, f, err)
+		}
+	}
+	if _, err := ParseAddrFamily("ipv4"); err == nil {
+		t.Error("ParseAddrFamily should reject unknown value")
+	}
+}
+
+func TestExtractQUICAddress_IPv6(t *testing.T) {
+	addrs := mustAddrs(t, "/ip6/2001:db8::1/udp/4433/quic-v1")
+	if got := ExtractQUICAddress(addrs); got != "[2001:db8::1]:4433" {
+		t.Errorf("ExtractQUICAddress = %q, want bracketed IPv6 host:port", got)
+	}
+}
+
+func TestSelectQUICAddresses(t *testing.T) {
+	addrs := mustAddrs(t,
+		"/ip4/10.0.0.1/tcp/4003",
+		"/ip6/2001:db8::1/udp/4433/quic-v1",
+		"/ip4/10.0.0.1/udp/4433/quic-v1",
+	)
+
+	tests := []struct {
+		name   string
+		addrs  []ma.Multiaddr
+		family AddrFamily
+		want   []string
+	}{
+		{"any uses first udp", addrs, AddrFamilyAny, []string{"[2001:db8::1]:4433"}},
+		{"prefer v4", addrs, AddrFamilyPreferIPv4, []string{"10.0.0.1:4433"}},
+		{"prefer v6", addrs, AddrFamilyPreferIPv6, []string{"[2001:db8::1]:4433"}},
+		{"happy eyeballs v6 first", addrs, AddrFamilyHappyEyeballs, []string{"[2001:db8::1]:4433", "10.0.0.1:4433"}},
+		{"prefer v6 falls back to v4", mustAddrs(t, "/ip4/10.0.0.1/udp/4433/quic-v1"), AddrFamilyPreferIPv6, []string{"10.0.0.1:4433"}},
+		{"happy eyeballs single family", mustAddrs(t, "/ip4/10.0.0.1/udp/4433/quic-v1"), AddrFamilyHappyEyeballs, []string{"10.0.0.1:4433"}},
+		{"dns6 grouped as v6", mustAddrs(t, "/dns4/relay.example.com/udp/4433", "/dns6/relay.example.com/udp/4433"), AddrFamilyPreferIPv6, []string{"relay.example.com:4433"}},
+		{"no usable address", mustAddrs(t, "/dnsaddr/relay.example.com"), AddrFamilyPreferIPv4, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SelectQUICAddresses(tt.addrs, tt.family); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SelectQUICAddresses = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRaceDial_UsesFirstToConnect(t *testing.T) {
+	// IPv6 先启动但连接缓慢，IPv4 在等待 delay 后启动并更早完成
+	delays := map[string]time.Duration{
+		"[2001:db8::1]:4433": 500 * time.Millisecond,
+		"10.0.0.1:4433":      10 * time.Millisecond,
+	}
+	var closed atomic.Int32
+	dial := func(ctx context.Context, addr string) (string, error) {
+		select {
+		case <-time.After(delays[addr]):
+			return addr, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	start := time.Now()
+	conn, addr, err := RaceDial(context.Background(),
+		[]string{"[2001:db8::1]:4433", "10.0.0.1:4433"}, 20*time.Millisecond,
+		dial, func(string) { closed.Add(1) })
+	if err != nil {
+		t.Fatalf("RaceDial failed: %v", err)
+	}
+	if addr != "10.0.0.1:4433" || conn != addr {
+		t.Errorf("RaceDial = (%q, %q), want the IPv4 address", conn, addr)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("RaceDial took %v, should not wait for the slow address", elapsed)
+	}
+	// 落败的尝试被取消，不会产生需要关闭的连接
+	time.Sleep(50 * time.Millisecond)
+	if n := closed.Load(); n != 0 {
+		t.Errorf("closeFn called %d times for a cancelled attempt", n)
+	}
+}
+
+func TestRaceDial_FailureStartsNextImmediately(t *testing.T) {
+	dial := func(ctx context.Context, addr string) (string, error) {
+		if addr == "bad" {
+			return "", errors.New("unreachable")
+		}
+		return addr, nil
+	}
+
+	start := time.Now()
+	_, addr, err := RaceDial(context.Background(), []string{"bad", "good"}, time.Minute, dial, nil)
+	if err != nil {
+		t.Fatalf("RaceDial failed: %v", err)
+	}
+	if addr != "good" {
+		t.Errorf("addr = %q, want good", addr)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("RaceDial waited %v after first failure", elapsed)
+	}
+}
+
+func TestRaceDial_AllFail(t *testing.T) {
+	dial := func(ctx context.Context, addr string) (int, error) {
+		return 0, errors.New("unreachable")
+	}
+	if _, _, err := RaceDial(context.Background(), []string{"a", "b"}, time.Millisecond, dial, nil); err == nil {
+		t.Fatal("RaceDial should fail when every address fails")
+	}
+}
+
+func TestRaceDial_ClosesLateWinner(t *testing.T) {
+	// 竞速失败的尝试忽略取消并随后连通，其连接应被释放
+	closed := make(chan string, 1)
+	dial := func(ctx context.Context, addr string) (string, error) {
+		if addr == "slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return addr, nil
+	}
+
+	_, addr, err := RaceDial(context.Background(), []string{"slow", "fast"}, 5*time.Millisecond,
+		dial, func(c string) { closed <- c })
+	if err != nil || addr != "fast" {
+		t.Fatalf("RaceDial = %q, %v; want fast", addr, err)
+	}
+	select {
+	case c := <-closed:
+		if c != "slow" {
+			t.Errorf("closed %q, want slow", c)
+		}
+	case <-time.After(time.Second):
+		t.Error("late connection was not closed")
+	}
+}
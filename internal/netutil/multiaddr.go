@@ -1,41 +1,90 @@
 package netutil
 
 import (
-	"fmt"
-	"strings"
+	"context"
+	"net"
 
 	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
 )
 
+// quicAddr 从 multiaddr 解析出的可拨号地址
+type quicAddr struct {
+	hostPort string
+	udp      bool
+	ipv6     bool
+}
+
+// parseQUICAddr 解析 multiaddr 中的主机和端口，缺少任一部分时返回 false
+// 主机可以是 IP (ip4/ip6) 或域名 (dns/dns4/dns6，拨号时解析)；IPv6 地址按 host:port 规则加方括号
+// /dns 不限定地址族，按 IPv4 分组；/dnsaddr 需先经 ResolveDNSAddrs 展开
+func parseQUICAddr(addr ma.Multiaddr) (quicAddr, bool) {
+	var host, port string
+	var a quicAddr
+	ma.ForEach(addr, func(c ma.Component) bool {
+		switch c.Protocol().Code {
+		case ma.P_IP4, ma.P_DNS4, ma.P_DNS:
+			host = c.Value()
+			a.ipv6 = false
+		case ma.P_IP6, ma.P_DNS6:
+			host = c.Value()
+			a.ipv6 = true
+		case ma.P_UDP:
+			port = c.Value()
+			a.udp = true
+		case ma.P_TCP:
+			port = c.Value()
+		}
+		return true
+	})
+	if host == "" || port == "" {
+		return quicAddr{}, false
+	}
+	a.hostPort = net.JoinHostPort(host, port)
+	return a, true
+}
+
+// dnsResolver 展开 /dnsaddr 地址使用的解析器 (测试可替换)
+var dnsResolver = madns.DefaultResolver
+
+// ResolveDNSAddrs 展开 /dnsaddr 地址 (查询 _dnsaddr TXT 记录)，其余地址原样保留
+// /dns、/dns4、/dns6 地址无需预先解析，拨号时按域名解析；解析失败的 /dnsaddr 地址被跳过
+func ResolveDNSAddrs(ctx context.Context, addrs []ma.Multiaddr) []ma.Multiaddr {
+	var result []ma.Multiaddr
+	for _, addr := range addrs {
+		if _, err := addr.ValueForProtocol(ma.P_DNSADDR); err != nil {
+			result = append(result, addr)
+			continue
+		}
+		resolved, err := dnsResolver.Resolve(ctx, addr)
+		if err != nil {
+			continue
+		}
+		result = append(result, resolved...)
+	}
+	return result
+}
+
+// ResolveQUICAddresses 展开 /dnsaddr 地址后按地址族偏好选出待拨号的 host:port 地址
+func ResolveQUICAddresses(ctx context.Context, addrs []ma.Multiaddr, family AddrFamily) []string {
+	return SelectQUICAddresses(ResolveDNSAddrs(ctx, addrs), family)
+}
+
 // ExtractQUICAddress 从 multiaddr 列表提取 host:port 地址
 // 优先返回 UDP 地址（QUIC 运行在 UDP 上），TCP 地址仅作为回退
 func ExtractQUICAddress(addrs []ma.Multiaddr) string {
 	var fallbackAddr string
 
 	for _, addr := range addrs {
-		addrStr := addr.String()
-		parts := strings.Split(addrStr, "/")
-		var ip, port string
-		var isUDP bool
-		for i := 0; i < len(parts)-1; i++ {
-			if parts[i] == "ip4" || parts[i] == "ip6" {
-				ip = parts[i+1]
-			}
-			if parts[i] == "udp" {
-				port = parts[i+1]
-				isUDP = true
-			} else if parts[i] == "tcp" {
-				port = parts[i+1]
-			}
+		a, ok := parseQUICAddr(addr)
+		if !ok {
+			continue
+		}
+		if a.udp {
+			return a.hostPort // UDP 优先，直接返回
 		}
-		if ip != "" && port != "" {
-			result := fmt.Sprintf("%s:%s", ip, port)
-			if isUDP {
-				return result // UDP 优先，直接返回
-			}
-			if fallbackAddr == "" {
-				fallbackAddr = result
-			}
+		if fallbackAddr == "" {
+			fallbackAddr = a.hostPort
 		}
 	}
 	return fallbackAddr
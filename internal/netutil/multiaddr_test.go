@@ -0,0 +1,62 @@
+package netutil
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	madns "github.com/multiformats/go-multiaddr-dns"
+)
+
+func TestExtractQUICAddress_DialStrings(t *testing.T) {
+	tests := []struct {
+		name string
+		addr string
+		want string
+	}{
+		{"ip4", "/ip4/203.0.113.10/udp/4433/quic-v1", "203.0.113.10:4433"},
+		{"ip6", "/ip6/2001:db8::1/udp/4433/quic-v1", "[2001:db8::1]:4433"},
+		{"dns4", "/dns4/relay.example.com/udp/4433/quic-v1", "relay.example.com:4433"},
+		{"dns6", "/dns6/relay.example.com/udp/4433/quic-v1", "relay.example.com:4433"},
+		{"dns", "/dns/relay.example.com/udp/4433/quic-v1", "relay.example.com:4433"},
+		{"with peer id", "/ip6/::1/udp/4433/quic-v1/p2p/12D3KooWGzBt1KNrUo4HYHEXqqcdj6S5W8ALGsGXzbnD8Uv4wQcN", "[::1]:4433"},
+		{"missing port", "/dns4/relay.example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractQUICAddress(mustAddrs(t, tt.addr)); got != tt.want {
+				t.Errorf("ExtractQUICAddress(%s) = %q, want %q", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveQUICAddresses_ExpandsDNSAddr(t *testing.T) {
+	resolver, err := madns.NewResolver(madns.WithDefaultResolver(&madns.MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.relays.example.com": {
+				"dnsaddr=/ip6/2001:db8::1/udp/4433/quic-v1",
+				"dnsaddr=/dns4/relay.example.com/udp/4433/quic-v1",
+			},
+		},
+	}))
+	if err != nil {
+		t.Fatalf("NewResolver failed: %v", err)
+	}
+	orig := dnsResolver
+	dnsResolver = resolver
+	t.Cleanup(func() { dnsResolver = orig })
+
+	addrs := mustAddrs(t, "/dnsaddr/relays.example.com", "/dnsaddr/missing.example.com")
+	got := ResolveQUICAddresses(context.Background(), addrs, AddrFamilyHappyEyeballs)
+	want := []string{"[2001:db8::1]:4433", "relay.example.com:4433"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveQUICAddresses = %v, want %v", got, want)
+	}
+
+	// 不含 /dnsaddr 的地址不查询 DNS
+	plain := mustAddrs(t, "/ip4/203.0.113.10/udp/4433/quic-v1")
+	if got := ResolveDNSAddrs(context.Background(), plain); !reflect.DeepEqual(got, plain) {
+		t.Errorf("ResolveDNSAddrs = %v, want unchanged %v", got, plain)
+	}
+}
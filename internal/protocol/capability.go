@@ -0,0 +1,199 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Exit 支持的端点族 (能力)
+const (
+	CapabilityChat       = "chat"       // 对话/补全: chat/completions, completions, messages, responses, generateContent
+	CapabilityEmbeddings = "embeddings" // 向量: embeddings, embedContent
+	CapabilityImages     = "images"     // 图像: images/*
+	CapabilityAudio      = "audio"      // 音频: audio/*
+)
+
+// KnownCapabilities 所有已知的端点族
+var KnownCapabilities = []string{CapabilityChat, CapabilityEmbeddings, CapabilityImages, CapabilityAudio}
+
+// Exit 通告的协议特性: Client 只对通告了对应特性的 Exit 使用新的请求格式，未通告的 (旧版) Exit 按原格式发送
+const (
+	FeatureChunkedUpload = "chunked_upload" // 接受以 RequestChunk/RequestEnd 分块上传的请求体
+	FeatureBinaryHTTP    = "bhttp"          // 解析 Binary HTTP (RFC 9292) 编码的内层请求 (旧版 Exit 只解析 HTTP/1.1 文本)
+)
+
+// capabilityFooterMagic 注册负载中元数据尾部的标记
+// 格式: [KeyConfig...][JSON 元数据][Len(2)]["TGCP"]
+// 元数据放在尾部，只解析首个 KeyConfig 的旧版 Relay/Client 不受影响
+var capabilityFooterMagic = []byte("TGCP")
+
+// ValidateCapabilities 校验能力列表只包含已知端点族
+func ValidateCapabilities(caps []string) error {
+	for _, c := range caps {
+		if !slices.Contains(KnownCapabilities, c) {
+			return fmt.Errorf("未知的端点能力: %q (支持: %s)", c, strings.Join(KnownCapabilities, ", "))
+		}
+	}
+	return nil
+}
+
+// EndpointCapability 返回请求路径所属的端点族，不属于任何端点族 (如 /v1/models) 时返回空字符串
+func EndpointCapability(path string) string {
+	switch {
+	case strings.HasSuffix(path, "/embeddings"),
+		strings.HasSuffix(path, ":embedContent"),
+		strings.HasSuffix(path, ":batchEmbedContents"):
+		return CapabilityEmbeddings
+	case strings.Contains(path, "/images/"):
+		return CapabilityImages
+	case strings.Contains(path, "/audio/"):
+		return CapabilityAudio
+	case strings.HasSuffix(path, "/completions"),
+		strings.HasSuffix(path, "/messages"),
+		strings.HasSuffix(path, "/responses"),
+		strings.HasSuffix(path, ":generateContent"),
+		strings.HasSuffix(path, ":streamGenerateContent"):
+		return CapabilityChat
+	default:
+		return ""
+	}
+}
+
+// SupportsCapability 检查能力列表是否支持指定端点族
+// 能力列表为空 (旧版 Exit 未通告) 或端点不属于任何端点族时视为支持
+func SupportsCapability(caps []string, capability string) bool {
+	return capability == "" || len(caps) == 0 || slices.Contains(caps, capability)
+}
+
+// SupportsFeature 检查 Exit 是否通告了指定协议特性 (未通告视为不支持)
+func SupportsFeature(features []string, feature string) bool {
+	return slices.Contains(features, feature)
+}
+
+// SupportsModel 检查 Exit 通告的模型列表是否包含指定模型
+// 模型列表为空 (未通告) 或请求未指定模型时视为支持；列表项以 * 结尾时按前缀匹配
+func SupportsModel(models []string, model string) bool {
+	if model == "" || len(models) == 0 {
+		return true
+	}
+	for _, m := range models {
+		if prefix, ok := strings.CutSuffix(m, "*"); ok {
+			if strings.HasPrefix(model, prefix) {
+				return true
+			}
+		} else if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// ExitMetadata Exit 注册时通告的元数据
+type ExitMetadata struct {
+	Capabilities         []string      // 支持的端点族，为空表示未通告
+	RequestTimeout       time.Duration // 推荐的请求超时，0 表示未通告 (Client 使用全局超时)
+	MaxConcurrentStreams int           // 单个连接同时处理的请求上限，0 表示不限制
+	Weight               int           // 按后端容量通告的选择权重，0 表示未通告 (Client 按 1 处理)
+	Models               []string      // 可服务的模型 (支持 * 结尾的前缀)，为空表示未通告
+	Features             []string      // 支持的协议特性 (Feature*)，为空表示未通告
+}
+
+// exitMetadataJSON ExitMetadata 的线上格式
+type exitMetadataJSON struct {
+	Capabilities         []string `json:"capabilities,omitempty"`
+	RequestTimeoutMs     int64    `json:"request_timeout_ms,omitempty"`
+	MaxConcurrentStreams int      `json:"max_concurrent_streams,omitempty"`
+	Weight               int      `json:"weight,omitempty"`
+	Models               []string `json:"models,omitempty"`
+	Features             []string `json:"features,omitempty"`
+}
+
+// empty 是否没有任何需要通告的元数据
+func (m ExitMetadata) empty() bool {
+	return len(m.Capabilities) == 0 && m.onlyCapabilities()
+}
+
+// onlyCapabilities 除能力列表外是否没有其他元数据
+func (m ExitMetadata) onlyCapabilities() bool {
+	return m.RequestTimeout <= 0 && m.MaxConcurrentStreams <= 0 && m.Weight <= 0 && len(m.Models) == 0 && len(m.Features) == 0
+}
+
+// EncodeRegisterPayload 编码 Exit 注册负载: KeyConfig 列表，元数据非空时追加尾部
+// 只通告能力时尾部为 JSON 数组，与只认识能力列表的 Relay 兼容；通告其他元数据时为 JSON 对象
+func EncodeRegisterPayload(keyConfig []byte, meta ExitMetadata) []byte {
+	if meta.empty() {
+		return keyConfig
+	}
+	var data []byte
+	if meta.onlyCapabilities() {
+		data, _ = json.Marshal(meta.Capabilities)
+	} else {
+		data, _ = json.Marshal(exitMetadataJSON{
+			Capabilities:         meta.Capabilities,
+			RequestTimeoutMs:     meta.RequestTimeout.Milliseconds(),
+			MaxConcurrentStreams: max(meta.MaxConcurrentStreams, 0),
+			Weight:               max(meta.Weight, 0),
+			Models:               meta.Models,
+			Features:             meta.Features,
+		})
+	}
+
+	buf := make([]byte, 0, len(keyConfig)+len(data)+2+len(capabilityFooterMagic))
+	buf = append(buf, keyConfig...)
+	buf = append(buf, data...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(data)))
+	return append(buf, capabilityFooterMagic...)
+}
+
+// DecodeRegisterPayload 解码 Exit 注册负载，返回 KeyConfig 列表和元数据
+// 没有元数据尾部 (旧版 Exit) 时整个负载即为 KeyConfig，元数据为空
+func DecodeRegisterPayload(payload []byte) (keyConfig []byte, meta ExitMetadata, err error) {
+	footer := 2 + len(capabilityFooterMagic)
+	if len(payload) < footer || !bytes.HasSuffix(payload, capabilityFooterMagic) {
+		return payload, ExitMetadata{}, nil
+	}
+
+	end := len(payload) - len(capabilityFooterMagic)
+	dataLen := int(binary.BigEndian.Uint16(payload[end-2 : end]))
+	start := end - 2 - dataLen
+	if start < 0 {
+		return nil, ExitMetadata{}, fmt.Errorf("元数据长度无效: %d", dataLen)
+	}
+
+	data := bytes.TrimSpace(payload[start : end-2])
+	if len(data) > 0 && data[0] == '[' {
+		// 只包含能力列表的旧格式
+		if err := json.Unmarshal(data, &meta.Capabilities); err != nil {
+			return nil, ExitMetadata{}, fmt.Errorf("解析能力列表失败: %w", err)
+		}
+		return payload[:start], meta, nil
+	}
+
+	var wire exitMetadataJSON
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return nil, ExitMetadata{}, fmt.Errorf("解析 Exit 元数据失败: %w", err)
+	}
+	if wire.RequestTimeoutMs < 0 {
+		return nil, ExitMetadata{}, fmt.Errorf("请求超时无效: %dms", wire.RequestTimeoutMs)
+	}
+	if wire.MaxConcurrentStreams < 0 {
+		return nil, ExitMetadata{}, fmt.Errorf("并发上限无效: %d", wire.MaxConcurrentStreams)
+	}
+	if wire.Weight < 0 {
+		return nil, ExitMetadata{}, fmt.Errorf("权重无效: %d", wire.Weight)
+	}
+	meta = ExitMetadata{
+		Capabilities:         wire.Capabilities,
+		RequestTimeout:       time.Duration(wire.RequestTimeoutMs) * time.Millisecond,
+		MaxConcurrentStreams: wire.MaxConcurrentStreams,
+		Weight:               wire.Weight,
+		Models:               wire.Models,
+		Features:             wire.Features,
+	}
+	return payload[:start], meta, nil
+}
@@ -0,0 +1,228 @@
+package protocol
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEndpointCapability(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v1/chat/completions", CapabilityChat},
+		{"/v1/completions", CapabilityChat},
+		{"/v1/messages", CapabilityChat},
+		{"/v1/responses", CapabilityChat},
+		{"/v1beta/models/gemini-pro:generateContent", CapabilityChat},
+		{"/v1beta/models/gemini-pro:streamGenerateContent", CapabilityChat},
+		{"/v1/embeddings", CapabilityEmbeddings},
+		{"/v1beta/models/embedding-001:embedContent", CapabilityEmbeddings},
+		{"/v1/images/generations", CapabilityImages},
+		{"/v1/audio/transcriptions", CapabilityAudio},
+		{"/v1/models", ""},
+	}
+	for _, tt := range tests {
+		if got := EndpointCapability(tt.path); got != tt.want {
+			t.Errorf("EndpointCapability(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSupportsCapability(t *testing.T) {
+	embeddingsOnly := []string{CapabilityEmbeddings}
+
+	if !SupportsCapability(embeddingsOnly, CapabilityEmbeddings) {
+		t.Error("embeddings exit should support embeddings")
+	}
+	if SupportsCapability(embeddingsOnly, CapabilityChat) {
+		t.Error("embeddings exit should not support chat")
+	}
+	if !SupportsCapability(embeddingsOnly, "") {
+		t.Error("endpoints outside any family should be supported")
+	}
+	if !SupportsCapability(nil, CapabilityImages) {
+		t.Error("exit without advertised capabilities should support everything")
+	}
+}
+
+func TestValidateCapabilities(t *testing.T) {
+	if err := ValidateCapabilities([]string{CapabilityChat, CapabilityEmbeddings}); err != nil {
+		t.Errorf("valid capabilities rejected: %v", err)
+	}
+	if err := ValidateCapabilities([]string{"video"}); err == nil {
+		t.Error("unknown capability should be rejected")
+	}
+}
+
+func TestRegisterPayload_RoundTrip(t *testing.T) {
+	keyConfig := []byte{0x01, 0x00, 0x20, 0x00, 0x03, 0xaa, 0xbb, 0xcc, 0x00, 0x04, 0x00, 0x01, 0x00, 0x01}
+	caps := []string{CapabilityEmbeddings, CapabilityImages}
+
+	payload := EncodeRegisterPayload(keyConfig, ExitMetadata{Capabilities: caps})
+	if !bytes.HasPrefix(payload, keyConfig) {
+		t.Fatal("payload should start with KeyConfig so legacy parsers still read the first key")
+	}
+
+	gotKeyConfig, meta, err := DecodeRegisterPayload(payload)
+	if err != nil {
+		t.Fatalf("DecodeRegisterPayload failed: %v", err)
+	}
+	if !bytes.Equal(gotKeyConfig, keyConfig) {
+		t.Errorf("KeyConfig = %x, want %x", gotKeyConfig, keyConfig)
+	}
+	if !slices.Equal(meta.Capabilities, caps) || meta.RequestTimeout != 0 {
+		t.Errorf("meta = %+v, want caps %v without timeout", meta, caps)
+	}
+}
+
+func TestRegisterPayload_RequestTimeout(t *testing.T) {
+	keyConfig := []byte{0x01, 0x00, 0x20, 0x00, 0x01, 0xaa, 0x00, 0x04, 0x00, 0x01, 0x00, 0x01}
+	want := ExitMetadata{Capabilities: []string{CapabilityChat}, RequestTimeout: 90 * time.Second}
+
+	gotKeyConfig, meta, err := DecodeRegisterPayload(EncodeRegisterPayload(keyConfig, want))
+	if err != nil {
+		t.Fatalf("DecodeRegisterPayload failed: %v", err)
+	}
+	if !bytes.Equal(gotKeyConfig, keyConfig) {
+		t.Errorf("KeyConfig = %x, want %x", gotKeyConfig, keyConfig)
+	}
+	if !slices.Equal(meta.Capabilities, want.Capabilities) || meta.RequestTimeout != want.RequestTimeout {
+		t.Errorf("meta = %+v, want %+v", meta, want)
+	}
+
+	// 只通告超时
+	_, meta, err = DecodeRegisterPayload(EncodeRegisterPayload(keyConfig, ExitMetadata{RequestTimeout: 5 * time.Minute}))
+	if err != nil {
+		t.Fatalf("DecodeRegisterPayload failed: %v", err)
+	}
+	if meta.Capabilities != nil || meta.RequestTimeout != 5*time.Minute {
+		t.Errorf("meta = %+v, want timeout only", meta)
+	}
+}
+
+func TestRegisterPayload_MaxConcurrentStreams(t *testing.T) {
+	keyConfig := []byte{0x01}
+	_, meta, err := DecodeRegisterPayload(EncodeRegisterPayload(keyConfig, ExitMetadata{
+		Capabilities:         []string{CapabilityChat},
+		MaxConcurrentStreams: 32,
+	}))
+	if err != nil {
+		t.Fatalf("DecodeRegisterPayload failed: %v", err)
+	}
+	if meta.MaxConcurrentStreams != 32 || !slices.Equal(meta.Capabilities, []string{CapabilityChat}) {
+		t.Errorf("meta = %+v, want capabilities and limit", meta)
+	}
+
+	data := []byte(`{"max_concurrent_streams":-1}`)
+	payload := append([]byte{0x01}, data...)
+	payload = append(payload, 0x00, byte(len(data)))
+	payload = append(payload, capabilityFooterMagic...)
+	if _, _, err := DecodeRegisterPayload(payload); err == nil {
+		t.Error("negative concurrency limit should be rejected")
+	}
+}
+
+func TestRegisterPayload_CapabilitiesOnlyStaysArray(t *testing.T) {
+	// 只通告能力时保持 JSON 数组格式，兼容只认识能力列表的 Relay
+	payload := EncodeRegisterPayload([]byte{0x01}, ExitMetadata{Capabilities: []string{CapabilityAudio}})
+	if !bytes.Contains(payload, []byte(`["audio"]`)) {
+		t.Errorf("payload = %q, want JSON array footer", payload)
+	}
+}
+
+func TestRegisterPayload_NegativeTimeout(t *testing.T) {
+	data := []byte(`{"request_timeout_ms":-1}`)
+	payload := append([]byte{0x01}, data...)
+	payload = append(payload, 0x00, byte(len(data)))
+	payload = append(payload, capabilityFooterMagic...)
+	if _, _, err := DecodeRegisterPayload(payload); err == nil {
+		t.Error("negative request timeout should be rejected")
+	}
+}
+
+func TestRegisterPayload_Legacy(t *testing.T) {
+	keyConfig := []byte{0x01, 0x00, 0x20, 0x00, 0x01, 0xaa, 0x00, 0x04, 0x00, 0x01, 0x00, 0x01}
+
+	// 无能力时负载即 KeyConfig
+	if payload := EncodeRegisterPayload(keyConfig, ExitMetadata{}); !bytes.Equal(payload, keyConfig) {
+		t.Errorf("payload without caps = %x, want raw KeyConfig", payload)
+	}
+
+	gotKeyConfig, meta, err := DecodeRegisterPayload(keyConfig)
+	if err != nil {
+		t.Fatalf("DecodeRegisterPayload failed: %v", err)
+	}
+	if !bytes.Equal(gotKeyConfig, keyConfig) || meta.Capabilities != nil || meta.RequestTimeout != 0 {
+		t.Errorf("legacy payload decoded as (%x, %+v)", gotKeyConfig, meta)
+	}
+}
+
+func TestRegisterPayload_CorruptFooter(t *testing.T) {
+	payload := append([]byte{0x01, 0x02}, 0xff, 0xff)
+	payload = append(payload, capabilityFooterMagic...)
+	if _, _, err := DecodeRegisterPayload(payload); err == nil {
+		t.Error("oversized capability length should be rejected")
+	}
+}
+
+func TestRegisterPayload_WeightAndModels(t *testing.T) {
+	keyConfig := []byte{0x01}
+	want := ExitMetadata{Weight: 8, Models: []string{"llama3:70b", "qwen2*"}}
+
+	gotKeyConfig, meta, err := DecodeRegisterPayload(EncodeRegisterPayload(keyConfig, want))
+	if err != nil {
+		t.Fatalf("DecodeRegisterPayload failed: %v", err)
+	}
+	if !bytes.Equal(gotKeyConfig, keyConfig) {
+		t.Errorf("KeyConfig = %x, want %x", gotKeyConfig, keyConfig)
+	}
+	if meta.Weight != want.Weight || !slices.Equal(meta.Models, want.Models) {
+		t.Errorf("meta = %+v, want %+v", meta, want)
+	}
+
+	data := []byte(`{"weight":-1}`)
+	payload := append([]byte{0x01}, data...)
+	payload = append(payload, 0x00, byte(len(data)))
+	payload = append(payload, capabilityFooterMagic...)
+	if _, _, err := DecodeRegisterPayload(payload); err == nil {
+		t.Error("negative weight should be rejected")
+	}
+}
+
+func TestRegisterPayload_Features(t *testing.T) {
+	// 只通告协议特性时也使用 JSON 对象尾部 (能力列表数组格式无法携带)
+	want := ExitMetadata{Capabilities: []string{CapabilityAudio}, Features: []string{FeatureChunkedUpload}}
+	_, meta, err := DecodeRegisterPayload(EncodeRegisterPayload([]byte{0x01}, want))
+	if err != nil {
+		t.Fatalf("DecodeRegisterPayload failed: %v", err)
+	}
+	if !slices.Equal(meta.Features, want.Features) || !slices.Equal(meta.Capabilities, want.Capabilities) {
+		t.Errorf("meta = %+v, want %+v", meta, want)
+	}
+	if !SupportsFeature(meta.Features, FeatureChunkedUpload) || SupportsFeature(nil, FeatureChunkedUpload) {
+		t.Error("SupportsFeature should report only advertised features")
+	}
+}
+
+func TestSupportsModel(t *testing.T) {
+	models := []string{"llama3:70b", "qwen2*"}
+	tests := []struct {
+		models []string
+		model  string
+		want   bool
+	}{
+		{models, "llama3:70b", true},
+		{models, "llama3:8b", false},
+		{models, "qwen2:7b", true},
+		{models, "", true},
+		{nil, "gpt-4o", true},
+	}
+	for _, tt := range tests {
+		if got := SupportsModel(tt.models, tt.model); got != tt.want {
+			t.Errorf("SupportsModel(%v, %q) = %v, want %v", tt.models, tt.model, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionHeader 内层请求/响应头: 请求或响应体以压缩标志字节开头 (HPKE 加密前的内层 HTTP 体)
+// 请求中的值为 Client 接受的响应压缩算法，Exit 转发给后端前移除该头并解压请求体；
+// Exit 压缩响应时在响应头中回显实际使用的算法，旧版 Exit 不回显，响应体不带标志字节
+const CompressionHeader = "Tokengo-Compression"
+
+// 压缩标志字节: 带压缩的内层 HTTP 体格式为 [Flag(1)] [Body(N)]，空体不带标志字节
+const (
+	CompressionNone byte = 0x00 // 未压缩 (体过小或压缩后没有变小)
+	CompressionGzip byte = 0x01
+	CompressionZstd byte = 0x02
+)
+
+// DefaultCompressionMinSize 未配置 min_size 时启用压缩的最小体积，更小的体不压缩
+const DefaultCompressionMinSize = 1024
+
+// maxDecompressedSize 未指定上限时解压后的最大体积 (与单条消息的负载上限一致)
+const maxDecompressedSize = 16 * 1024 * 1024
+
+// ErrDecompressedTooLarge 解压后的体积超过上限 (防止压缩炸弹)
+var ErrDecompressedTooLarge = errors.New("decompressed body too large")
+
+// ParseCompression 解析压缩算法名: gzip、zstd，空字符串或 none 表示不压缩
+func ParseCompression(name string) (byte, error) {
+	switch name {
+	case "", "none":
+		return CompressionNone, nil
+	case "gzip":
+		return CompressionGzip, nil
+	case "zstd":
+		return CompressionZstd, nil
+	default:
+		return 0, fmt.Errorf("未知的压缩算法: %q (支持: gzip, zstd)", name)
+	}
+}
+
+// CompressionName 返回压缩标志对应的算法名
+func CompressionName(flag byte) string {
+	switch flag {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+// CompressBody 按标志压缩内层 HTTP 体并加上标志字节
+// 体小于 minSize、flag 为 CompressionNone 或压缩后没有变小时以 CompressionNone 原样携带
+func CompressBody(body []byte, flag byte, minSize int) ([]byte, error) {
+	if len(body) == 0 {
+		return body, nil
+	}
+	if flag != CompressionNone && len(body) >= minSize {
+		var buf bytes.Buffer
+		buf.WriteByte(flag)
+		if err := compressTo(&buf, body, flag); err != nil {
+			return nil, err
+		}
+		if buf.Len() < len(body)+1 {
+			return buf.Bytes(), nil
+		}
+	}
+	return append([]byte{CompressionNone}, body...), nil
+}
+
+// compressTo 将 data 以指定算法压缩写入 w
+func compressTo(w io.Writer, data []byte, flag byte) error {
+	var zw io.WriteCloser
+	switch flag {
+	case CompressionGzip:
+		zw = gzip.NewWriter(w)
+	case CompressionZstd:
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			return fmt.Errorf("创建 zstd 编码器失败: %w", err)
+		}
+		zw = enc
+	default:
+		return fmt.Errorf("未知的压缩标志: 0x%02x", flag)
+	}
+	if _, err := zw.Write(data); err != nil {
+		zw.Close()
+		return fmt.Errorf("压缩失败: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("压缩失败: %w", err)
+	}
+	return nil
+}
+
+// DecompressBody 解析标志字节并解压内层 HTTP 体，limit <= 0 时使用 16MB 上限
+// 解压后超过上限时返回 ErrDecompressedTooLarge
+func DecompressBody(framed []byte, limit int64) ([]byte, error) {
+	if len(framed) == 0 {
+		return framed, nil
+	}
+	if limit <= 0 {
+		limit = maxDecompressedSize
+	}
+	flag, data := framed[0], framed[1:]
+
+	var r io.Reader
+	switch flag {
+	case CompressionNone:
+		if int64(len(data)) > limit {
+			return nil, fmt.Errorf("%w: %d > %d", ErrDecompressedTooLarge, len(data), limit)
+		}
+		return data, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("解压失败: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	case CompressionZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("解压失败: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("未知的压缩标志: 0x%02x", flag)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("解压失败: %w", err)
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: > %d", ErrDecompressedTooLarge, limit)
+	}
+	return body, nil
+}
@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompressBody_RoundTrip(t *testing.T) {
+	body := []byte(strings.Repeat(`{"role":"user","content":"hello world"},`, 200))
+	for _, name := range []string{"gzip", "zstd"} {
+		t.Run(name, func(t *testing.T) {
+			flag, err := ParseCompression(name)
+			if err != nil {
+				t.Fatalf("ParseCompression: %v", err)
+			}
+			framed, err := CompressBody(body, flag, DefaultCompressionMinSize)
+			if err != nil {
+				t.Fatalf("CompressBody: %v", err)
+			}
+			if framed[0] != flag {
+				t.Errorf("flag byte = 0x%02x, want 0x%02x", framed[0], flag)
+			}
+			if len(framed) >= len(body)/4 {
+				t.Errorf("compressed size = %d, want well below %d", len(framed), len(body))
+			}
+			got, err := DecompressBody(framed, 0)
+			if err != nil {
+				t.Fatalf("DecompressBody: %v", err)
+			}
+			if !bytes.Equal(got, body) {
+				t.Error("round-tripped body differs from the original")
+			}
+		})
+	}
+}
+
+func TestCompressBody_TinyPayloadUncompressed(t *testing.T) {
+	body := []byte(`{"model":"gpt-4"}`)
+	framed, err := CompressBody(body, CompressionZstd, DefaultCompressionMinSize)
+	if err != nil {
+		t.Fatalf("CompressBody: %v", err)
+	}
+	if framed[0] != CompressionNone || !bytes.Equal(framed[1:], body) {
+		t.Errorf("tiny payload framed as %q, want the none flag followed by the raw body", framed)
+	}
+	got, err := DecompressBody(framed, 0)
+	if err != nil || !bytes.Equal(got, body) {
+		t.Errorf("DecompressBody = %q, %v", got, err)
+	}
+
+	// 空体不带标志字节
+	if framed, _ := CompressBody(nil, CompressionGzip, 0); len(framed) != 0 {
+		t.Errorf("empty body framed as %q, want empty", framed)
+	}
+}
+
+func TestCompressBody_IncompressibleKeptRaw(t *testing.T) {
+	body := make([]byte, 4096)
+	rand.Read(body)
+	framed, _ := CompressBody(body, CompressionGzip, 0)
+	if got, err := DecompressBody(framed, 0); err != nil || !bytes.Equal(got, body) {
+		t.Fatalf("DecompressBody = %v", err)
+	}
+	if framed[0] != CompressionNone || len(framed) != len(body)+1 {
+		t.Errorf("framed size = %d, want at most %d", len(framed), len(body)+1)
+	}
+}
+
+func TestDecompressBody_Limit(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 64*1024)
+	framed, _ := CompressBody(body, CompressionZstd, 0)
+	if _, err := DecompressBody(framed, 1024); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("DecompressBody err = %v, want ErrDecompressedTooLarge", err)
+	}
+	if _, err := DecompressBody([]byte{0x7f, 1, 2}, 0); err == nil {
+		t.Error("DecompressBody accepted an unknown flag")
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for name, want := range map[string]byte{"": CompressionNone, "none": CompressionNone, "gzip": CompressionGzip, "zstd": CompressionZstd} {
+		if got, err := ParseCompression(name); err != nil || got != want {
+			t.Errorf("ParseCompression(%q) = 0x%02x, %v", name, got, err)
+		}
+	}
+	if _, err := ParseCompression("brotli"); err == nil {
+		t.Error("ParseCompression accepted an unknown algorithm")
+	}
+}
@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ExitKeysEncodingGzip Exit 公钥列表响应的 gzip 压缩编码
+const ExitKeysEncodingGzip = "gzip"
+
+// exitKeysCompressThreshold JSON 超过该大小时才压缩，小响应压缩收益不抵开销
+const exitKeysCompressThreshold = 4 * 1024
+
+// maxExitKeysSize 解压后 Exit 公钥列表的最大大小，防止压缩炸弹
+const maxExitKeysSize = 16 * 1024 * 1024
+
+// gzipMagic gzip 数据的起始字节，JSON 不会以此开头，据此区分压缩与未压缩响应
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// queryExitKeysOptions QueryExitKeys 负载: Client 支持的响应编码
+// 旧版 Client 负载为空，旧版 Relay 忽略负载，均回退为未压缩 JSON
+type queryExitKeysOptions struct {
+	AcceptEncoding []string `json:"accept_encoding,omitempty"`
+}
+
+// AcceptedExitKeysEncodings 返回 QueryExitKeys 消息中 Client 声明支持的响应编码
+// 负载为空 (旧版 Client) 或无法解析时返回 nil
+func AcceptedExitKeysEncodings(msg *Message) []string {
+	if len(msg.Payload) == 0 {
+		return nil
+	}
+	var opts queryExitKeysOptions
+	if err := json.Unmarshal(msg.Payload, &opts); err != nil {
+		return nil
+	}
+	return opts.AcceptEncoding
+}
+
+// NewExitKeysResponseMessageFor 按 Client 支持的编码创建 Exit 公钥列表响应
+// Client 支持 gzip 且 JSON 超过阈值时压缩，否则与 NewExitKeysResponseMessage 相同
+func NewExitKeysResponseMessageFor(entries []ExitKeyEntry, acceptEncoding []string) (*Message, error) {
+	msg, err := NewExitKeysResponseMessage(entries)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.Payload) <= exitKeysCompressThreshold || !slices.Contains(acceptEncoding, ExitKeysEncodingGzip) {
+		return msg, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(msg.Payload); err != nil {
+		return nil, fmt.Errorf("压缩 Exit 公钥列表失败: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("压缩 Exit 公钥列表失败: %w", err)
+	}
+	if buf.Len() < len(msg.Payload) {
+		msg.Payload = buf.Bytes()
+	}
+	return msg, nil
+}
+
+// DecodeExitKeysResponse 解析 Exit 公钥列表响应负载，自动识别 gzip 压缩
+func DecodeExitKeysResponse(payload []byte) ([]ExitKeyEntry, error) {
+	data := payload
+	if bytes.HasPrefix(payload, gzipMagic) {
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("解压 Exit 公钥列表失败: %w", err)
+		}
+		defer zr.Close()
+
+		data, err = io.ReadAll(io.LimitReader(zr, maxExitKeysSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("解压 Exit 公钥列表失败: %w", err)
+		}
+		if len(data) > maxExitKeysSize {
+			return nil, fmt.Errorf("Exit 公钥列表过大: 超过 %d 字节", maxExitKeysSize)
+		}
+	}
+
+	var entries []ExitKeyEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("解析 Exit 公钥列表失败: %w", err)
+	}
+	return entries, nil
+}
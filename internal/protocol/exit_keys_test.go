@@ -0,0 +1,144 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"testing"
+)
+
+// newExitKeyEntries 生成 n 个带完整 KeyConfig 的 Exit 条目
+func newExitKeyEntries(n int) []ExitKeyEntry {
+	entries := make([]ExitKeyEntry, n)
+	for i := range entries {
+		keyConfig := make([]byte, 41)
+		for j := range keyConfig {
+			keyConfig[j] = byte(i + j)
+		}
+		entries[i] = ExitKeyEntry{
+			PubKeyHash:   fmt.Sprintf("%064x", i),
+			KeyConfig:    keyConfig,
+			Capabilities: []string{CapabilityChat},
+		}
+	}
+	return entries
+}
+
+func TestExitKeysResponse_LargeCompressed(t *testing.T) {
+	entries := newExitKeyEntries(200)
+
+	query, err := Decode(bytes.NewReader(NewQueryExitKeysMessage(ExitKeysEncodingGzip).Encode()))
+	if err != nil {
+		t.Fatalf("Decode query failed: %v", err)
+	}
+	msg, err := NewExitKeysResponseMessageFor(entries, AcceptedExitKeysEncodings(query))
+	if err != nil {
+		t.Fatalf("NewExitKeysResponseMessageFor failed: %v", err)
+	}
+
+	plain, _ := NewExitKeysResponseMessage(entries)
+	if !bytes.HasPrefix(msg.Payload, gzipMagic) {
+		t.Fatal("large response should be gzip compressed")
+	}
+	if len(msg.Payload) >= len(plain.Payload) {
+		t.Errorf("compressed size %d, want < %d", len(msg.Payload), len(plain.Payload))
+	}
+
+	decoded, err := Decode(bytes.NewReader(msg.Encode()))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	got, err := DecodeExitKeysResponse(decoded.Payload)
+	if err != nil {
+		t.Fatalf("DecodeExitKeysResponse failed: %v", err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("got %d entries, want %d", len(got), len(entries))
+	}
+	if got[199].PubKeyHash != entries[199].PubKeyHash || !bytes.Equal(got[199].KeyConfig, entries[199].KeyConfig) {
+		t.Errorf("entry mismatch after round trip: %+v", got[199])
+	}
+}
+
+func TestExitKeysResponse_SmallUncompressed(t *testing.T) {
+	entries := newExitKeyEntries(2)
+
+	msg, err := NewExitKeysResponseMessageFor(entries, []string{ExitKeysEncodingGzip})
+	if err != nil {
+		t.Fatalf("NewExitKeysResponseMessageFor failed: %v", err)
+	}
+	if bytes.HasPrefix(msg.Payload, gzipMagic) {
+		t.Error("small response should stay uncompressed")
+	}
+	got, err := DecodeExitKeysResponse(msg.Payload)
+	if err != nil || len(got) != 2 {
+		t.Fatalf("DecodeExitKeysResponse = (%d entries, %v), want 2 entries", len(got), err)
+	}
+}
+
+func TestExitKeysResponse_LegacyClientUncompressed(t *testing.T) {
+	// 旧版 Client 的查询负载为空，大响应也不压缩
+	query := NewQueryExitKeysMessage()
+	if len(query.Payload) != 0 {
+		t.Fatalf("legacy query payload = %q, want empty", query.Payload)
+	}
+	if enc := AcceptedExitKeysEncodings(query); enc != nil {
+		t.Fatalf("AcceptedExitKeysEncodings = %v, want nil", enc)
+	}
+
+	msg, err := NewExitKeysResponseMessageFor(newExitKeyEntries(200), AcceptedExitKeysEncodings(query))
+	if err != nil {
+		t.Fatalf("NewExitKeysResponseMessageFor failed: %v", err)
+	}
+	if bytes.HasPrefix(msg.Payload, gzipMagic) {
+		t.Error("response for legacy client should stay uncompressed")
+	}
+}
+
+func TestAcceptedExitKeysEncodings_InvalidPayload(t *testing.T) {
+	msg := &Message{Type: MessageTypeQueryExitKeys, Payload: []byte("not json")}
+	if enc := AcceptedExitKeysEncodings(msg); enc != nil {
+		t.Errorf("AcceptedExitKeysEncodings = %v, want nil", enc)
+	}
+}
+
+func TestDecodeExitKeysResponse_Invalid(t *testing.T) {
+	if _, err := DecodeExitKeysResponse(append([]byte{}, 0x1f, 0x8b, 0x00)); err == nil {
+		t.Error("corrupt gzip should be rejected")
+	}
+
+	// 解压后超过上限 (压缩炸弹)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(bytes.Repeat([]byte{' '}, maxExitKeysSize+1))
+	zw.Close()
+	if _, err := DecodeExitKeysResponse(buf.Bytes()); err == nil {
+		t.Error("oversized decompressed payload should be rejected")
+	}
+}
+
+func TestExitKeysResponse_WeightAndModels(t *testing.T) {
+	entries := newExitKeyEntries(2)
+	entries[0].Weight = 5
+	entries[0].Models = []string{"llama3*"}
+
+	msg, err := NewExitKeysResponseMessage(entries)
+	if err != nil {
+		t.Fatalf("NewExitKeysResponseMessage failed: %v", err)
+	}
+	if bytes.Count(msg.Payload, []byte(`"weight"`)) != 1 {
+		t.Errorf("payload = %s, want weight omitted when not advertised", msg.Payload)
+	}
+
+	decoded, err := DecodeExitKeysResponse(msg.Payload)
+	if err != nil {
+		t.Fatalf("DecodeExitKeysResponse failed: %v", err)
+	}
+	if decoded[0].SelectionWeight() != 5 || len(decoded[0].Models) != 1 || decoded[0].Models[0] != "llama3*" {
+		t.Errorf("entry 0 = %+v, want weight 5 and models", decoded[0])
+	}
+	// 未通告权重的 Exit (含旧版 Exit) 按 1 处理
+	if decoded[1].Weight != 0 || decoded[1].SelectionWeight() != 1 || decoded[1].Models != nil {
+		t.Errorf("entry 1 = %+v, want default weight and no models", decoded[1])
+	}
+}
@@ -1,12 +1,35 @@
 package protocol
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// ProtocolVersion 当前支持的协议主版本
+// 无版本标记的原始帧格式视为版本 1，版本 1 的消息仍按原始格式编码以兼容旧节点
+const ProtocolVersion uint8 = 1
+
+// versionMarker 带版本帧的首字节 (非有效消息类型)
+// 带版本帧格式: [Marker(1)] [Version(1)] [Type(1)] [TargetLen(2)] [Target(N)] [PayloadLen(4)] [Payload(N)]
+const versionMarker byte = 0xFE
+
+// tenantSeparator 目标段中分隔 Target 与 Tenant 的字节 (pubKeyHash 为十六进制，不会包含该字节)
+const tenantSeparator byte = 0x00
+
+// MaxTenantLength 租户标识最大长度
+const MaxTenantLength = 256
+
+// ErrUnsupportedVersion 对端使用了无法识别的协议主版本
+var ErrUnsupportedVersion = errors.New("unsupported protocol version")
+
 // MessageType 消息类型
 type MessageType uint8
 
@@ -21,6 +44,12 @@ const (
 	MessageTypeStreamChunk MessageType = 0x04
 	// MessageTypeStreamEnd 流式结束标记
 	MessageTypeStreamEnd MessageType = 0x05
+	// MessageTypeRequestChunk 分块上传的请求体块 (Client→Exit，紧跟在 StreamRequest 之后)
+	MessageTypeRequestChunk MessageType = 0x06
+	// MessageTypeRequestEnd 分块上传结束标记 (负载为加密的结束块，防止请求体被截断)
+	MessageTypeRequestEnd MessageType = 0x07
+	// MessageTypeStreamHead 流式响应头 (加密的 MIME header 块，在首个 StreamChunk 之前发送)
+	MessageTypeStreamHead MessageType = 0x08
 
 	// MessageTypeRegister Exit→Relay 注册 (Target=pubKeyHash)
 	MessageTypeRegister MessageType = 0x10
@@ -31,38 +60,190 @@ const (
 	MessageTypeQueryExitKeys MessageType = 0x12
 	// MessageTypeExitKeysResponse Relay→Client: 返回 Exit 公钥列表
 	MessageTypeExitKeysResponse MessageType = 0x13
+	// MessageTypeStatus Client→Relay: 查询 Relay 运行状态 (运维用)
+	MessageTypeStatus MessageType = 0x14
+	// MessageTypeStatusResponse Relay→Client: 返回 Relay 运行状态
+	MessageTypeStatusResponse MessageType = 0x15
+	// MessageTypeQueryExitModels Client→Relay: 查询各 Exit 通告的可服务模型
+	MessageTypeQueryExitModels MessageType = 0x16
+	// MessageTypeExitModelsResponse Relay→Client: 返回各 Exit 通告的可服务模型
+	MessageTypeExitModelsResponse MessageType = 0x17
 
-	// MessageTypeHeartbeat Exit→Relay 心跳
+	// MessageTypeHeartbeat Exit→Relay 心跳 (Client 空闲探活复用此类型)
 	MessageTypeHeartbeat MessageType = 0x20
-	// MessageTypeHeartbeatAck Relay→Exit 心跳确认
+	// MessageTypeHeartbeatAck Relay→Exit/Client 心跳确认
 	MessageTypeHeartbeatAck MessageType = 0x21
 
+	// MessageTypeDrain Relay→Exit: Relay 即将关闭，不再转发新请求
+	// Exit→Relay: Exit 回收该隧道连接，Relay 不再向其转发新请求
+	MessageTypeDrain MessageType = 0x30
+	// MessageTypeUpdateModels Exit→Relay: 更新通告的可服务模型 (后端模型列表刷新后发送，关闭流作为确认)
+	MessageTypeUpdateModels MessageType = 0x31
+
 	// MessageTypeError 错误消息
 	MessageTypeError MessageType = 0xFF
 )
 
+// Error 消息负载中使用的错误原因 (Relay/Exit → Client)
+// Client 依据这些值映射为 OpenAI 风格的错误对象
+const (
+	ErrMissingTarget        = "missing target address"
+	ErrExitNotFound         = "exit not found"
+	ErrExitReconnecting     = "exit reconnecting"
+	ErrRelayDraining        = "relay draining"
+	ErrConnectionExpired    = "connection expired"
+	ErrTooManyRequests      = "too many requests"
+	ErrRequestTooLarge      = "request too large"
+	ErrDecryptRequest       = "decrypt request failed" // Exit 无法用当前私钥解密请求 (Client 缓存的公钥已过期)
+	ErrQueueTimeout         = "queue timeout"          // 请求在 Exit 排队等待后端并发配额超时
+	ErrRateLimited          = "rate limited"           // Client 来源地址超出 Relay 的请求速率限制
+	ErrAccessDenied         = "access denied"          // 流式请求的路径或模型不在 Exit 的访问控制允许列表内
+	ErrExitConnectionFailed = "exit connection failed"
+	ErrWriteToExitFailed    = "write to exit failed"
+	ErrReadExitResponse     = "read exit response failed"
+	ErrInvalidMessageType   = "invalid message type"
+	ErrSerializeExitKeys    = "failed to serialize exit keys"
+	ErrSerializeStatus      = "failed to serialize status"
+	ErrSerializeExitModels  = "failed to serialize exit models"
+	ErrExpectedRegister     = "expected register message"
+	ErrMissingPubKeyHash    = "missing pubKeyHash"
+	ErrIncompatibleVersion  = "incompatible protocol version"
+	ErrDecodePrefix         = "decode error"
+	ErrProcessPrefix        = "process error"
+	ErrStreamPrefix         = "stream error"
+	ErrUnknownMessagePrefix = "unknown message type"
+)
+
+// ChunkedBodyHeader 内层请求头: 请求体不随 StreamRequest 发送，而是以 RequestChunk/RequestEnd 分块上传
+// 值为原始请求体长度 (未知时为 -1)，Exit 转发给后端前移除该头
+const ChunkedBodyHeader = "Tokengo-Chunked-Body"
+
+// StreamHeadHeader 内层请求头: Client 能处理 StreamHead，Exit 据此在流式响应前发送后端响应头
+// 旧版 Client 不发送该头，Exit 不会向其发送无法识别的消息；Exit 转发给后端前移除该头
+const StreamHeadHeader = "Tokengo-Stream-Head"
+
+// StreamSeqHeader 内层请求头: Client 能处理带序号的 StreamChunk，Exit 转发给后端前移除该头
+// Exit 支持时在 StreamHead 的响应头中回显该头 (Client 移除后再交给调用方)，之后每个 StreamChunk
+// 的负载为 [Seq(8)][加密块]，Client 按序号重排并检测缺失的块；旧版 Exit 不回显，块按到达顺序处理
+const StreamSeqHeader = "Tokengo-Stream-Seq"
+
+// StreamStatusHeader StreamHead 响应头: 后端返回非 200 状态码时 Exit 在 StreamHead 中附带该状态码 (Client 移除后以其作为响应状态)，
+// 随后的 StreamChunk 为后端的原始响应体；Client 未声明 StreamHeadHeader 时 Exit 仍以错误消息返回
+const StreamStatusHeader = "Tokengo-Stream-Status"
+
 // Message 通用消息结构
 type Message struct {
 	Type    MessageType
+	Version uint8  // 协议主版本 (0 或 1 按原始格式编码，解码原始格式时为 1)
 	Target  string // 目标标识 (请求消息中为 Exit pubKeyHash，注册消息中为 pubKeyHash)
+	Tenant  string // 可选，计费租户标识 (仅 Client→Relay 请求使用，Relay 不转发给 Exit)
 	Payload []byte
+
+	// 可选，Client 的请求截止时间 (仅 Client→Relay 请求使用)，Relay 据此限定 Exit 流的生命周期
+	// 线上以剩余毫秒数编码，解码时换算为本地时间，不受两端时钟偏差影响
+	Deadline time.Time
+}
+
+// NewVersionedMessage 创建携带当前协议版本的消息
+func NewVersionedMessage(msgType MessageType, target string, payload []byte) *Message {
+	return &Message{
+		Type:    msgType,
+		Version: ProtocolVersion,
+		Target:  target,
+		Payload: payload,
+	}
 }
 
 // Encode 编码消息为字节流
 // 格式: [Type(1)] [TargetLen(2)] [Target(N)] [PayloadLen(4)] [Payload(N)]
+// 版本大于 1 时在前面加上 [Marker(1)] [Version(1)]
+// 带租户时目标段为 [Target] [0x00] [Tenant]，带截止时间时再追加 [0x00] [剩余毫秒数 (十进制)]
 func (m *Message) Encode() []byte {
-	targetBytes := []byte(m.Target)
-	buf := make([]byte, 1+2+len(targetBytes)+4+len(m.Payload))
-	buf[0] = byte(m.Type)
-	binary.BigEndian.PutUint16(buf[1:3], uint16(len(targetBytes)))
-	copy(buf[3:3+len(targetBytes)], targetBytes)
-	binary.BigEndian.PutUint32(buf[3+len(targetBytes):7+len(targetBytes)], uint32(len(m.Payload)))
-	copy(buf[7+len(targetBytes):], m.Payload)
-	return buf
+	return m.appendFrame(make([]byte, 0, m.frameSizeHint()))
+}
+
+// maxPooledFrameSize 放回池中的编码缓冲区容量上限，更大的缓冲区 (大请求/响应) 交给 GC 回收
+const maxPooledFrameSize = 128 * 1024
+
+// framePool 复用 EncodeTo 的编码缓冲区
+var framePool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
+// EncodeTo 将编码后的消息完整写入 w，编码缓冲区从池中复用 (流式数据块等热路径使用，避免每条消息分配)
+// 写入内容与 Encode 输出相同，短写时继续写入剩余部分
+func (m *Message) EncodeTo(w io.Writer) (int, error) {
+	bp := framePool.Get().(*[]byte)
+	buf := (*bp)[:0]
+	if size := m.frameSizeHint(); cap(buf) < size {
+		buf = make([]byte, 0, size) // 一次分配足够的容量，避免追加负载时反复扩容
+	}
+	frame := m.appendFrame(buf)
+	n, err := writeFull(w, frame)
+	if cap(frame) <= maxPooledFrameSize {
+		*bp = frame
+		framePool.Put(bp)
+	}
+	return n, err
+}
+
+// WriteMessage 将消息完整写入 w (如 QUIC 流)
+// Writer 在背压下返回短写 (n < len 且无错误) 时继续写入剩余部分，直到写完或出错，避免对端读到截断的消息
+func WriteMessage(w io.Writer, m *Message) error {
+	_, err := m.EncodeTo(w)
+	return err
+}
+
+// writeFull 循环写入直到 p 全部写完，Writer 既未写入也未返回错误时返回 io.ErrShortWrite (避免死循环)
+func writeFull(w io.Writer, p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n, err := w.Write(p[written:])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+// frameSizeHint 编码后长度的估计值 (截止时间的十进制长度按上限估计)
+func (m *Message) frameSizeHint() int {
+	return 2 + 1 + 2 + len(m.Target) + 1 + len(m.Tenant) + 1 + 20 + 4 + len(m.Payload)
+}
+
+// appendFrame 将编码后的消息追加到 b
+func (m *Message) appendFrame(b []byte) []byte {
+	if m.Version > 1 {
+		b = append(b, versionMarker, m.Version)
+	}
+	b = append(b, byte(m.Type), 0, 0)
+	targetAt := len(b)
+	b = append(b, m.Target...)
+	if m.Tenant != "" || !m.Deadline.IsZero() {
+		b = append(append(b, tenantSeparator), m.Tenant...)
+	}
+	if !m.Deadline.IsZero() {
+		remaining := time.Until(m.Deadline).Milliseconds()
+		if remaining < 1 {
+			remaining = 1 // 已过期的截止时间仍需编码，Relay 立即取消
+		}
+		b = strconv.AppendInt(append(b, tenantSeparator), remaining, 10)
+	}
+	binary.BigEndian.PutUint16(b[targetAt-2:targetAt], uint16(len(b)-targetAt))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(m.Payload)))
+	return append(b, m.Payload...)
 }
 
 // Decode 从字节流解码消息
 // 格式: [Type(1)] [TargetLen(2)] [Target(N)] [PayloadLen(4)] [Payload(N)]
+// 带版本帧的主版本高于 ProtocolVersion 时返回 ErrUnsupportedVersion
 func Decode(r io.Reader) (*Message, error) {
 	// 读取类型和目标长度
 	header := make([]byte, 3)
@@ -70,6 +251,19 @@ func Decode(r io.Reader) (*Message, error) {
 		return nil, fmt.Errorf("读取消息头失败: %w", err)
 	}
 
+	// 带版本帧: 校验主版本后重新读取原始帧头
+	version := uint8(1)
+	if header[0] == versionMarker {
+		version = header[1]
+		if version == 0 || version > ProtocolVersion {
+			return nil, fmt.Errorf("%w: v%d (支持 v%d)", ErrUnsupportedVersion, version, ProtocolVersion)
+		}
+		header[0] = header[2]
+		if _, err := io.ReadFull(r, header[1:]); err != nil {
+			return nil, fmt.Errorf("读取消息头失败: %w", err)
+		}
+	}
+
 	msgType := MessageType(header[0])
 	targetLen := binary.BigEndian.Uint16(header[1:3])
 
@@ -105,13 +299,57 @@ func Decode(r io.Reader) (*Message, error) {
 		return nil, fmt.Errorf("读取负载失败: %w", err)
 	}
 
+	// 拆分目标段中的租户标识和截止时间
+	var tenant []byte
+	var deadline time.Time
+	if i := bytes.IndexByte(target, tenantSeparator); i >= 0 {
+		target, tenant = target[:i], target[i+1:]
+		if j := bytes.IndexByte(tenant, tenantSeparator); j >= 0 {
+			remaining, err := strconv.ParseInt(string(tenant[j+1:]), 10, 64)
+			if err != nil || remaining <= 0 {
+				return nil, fmt.Errorf("无效的截止时间: %q", tenant[j+1:])
+			}
+			tenant = tenant[:j]
+			deadline = time.Now().Add(time.Duration(remaining) * time.Millisecond)
+		}
+		if len(tenant) > MaxTenantLength {
+			return nil, fmt.Errorf("租户标识过长: %d > %d", len(tenant), MaxTenantLength)
+		}
+	}
+
 	return &Message{
-		Type:    msgType,
-		Target:  string(target),
-		Payload: payload,
+		Type:     msgType,
+		Version:  version,
+		Target:   string(target),
+		Tenant:   string(tenant),
+		Payload:  payload,
+		Deadline: deadline,
 	}, nil
 }
 
+// ValidateTenant 校验租户标识可编码进消息头
+func ValidateTenant(tenant string) error {
+	if len(tenant) > MaxTenantLength {
+		return fmt.Errorf("租户标识过长: %d > %d", len(tenant), MaxTenantLength)
+	}
+	if strings.IndexByte(tenant, tenantSeparator) >= 0 {
+		return fmt.Errorf("租户标识不能包含 NUL 字节")
+	}
+	return nil
+}
+
+// NegotiateVersion 根据对端版本协商双方共同使用的协议版本
+// 对端版本 0 视为未声明版本的旧节点 (版本 1)
+func NegotiateVersion(peer uint8) (uint8, error) {
+	if peer == 0 {
+		peer = 1
+	}
+	if peer > ProtocolVersion {
+		return 0, fmt.Errorf("%w: v%d (支持 v%d)", ErrUnsupportedVersion, peer, ProtocolVersion)
+	}
+	return peer, nil
+}
+
 // NewRequestMessage 创建请求消息
 func NewRequestMessage(target string, ohttpPayload []byte) *Message {
 	return &Message{
@@ -146,6 +384,14 @@ func NewStreamChunkMessage(encryptedChunk []byte) *Message {
 	}
 }
 
+// NewStreamHeadMessage 创建流式响应头消息
+func NewStreamHeadMessage(encryptedHeader []byte) *Message {
+	return &Message{
+		Type:    MessageTypeStreamHead,
+		Payload: encryptedHeader,
+	}
+}
+
 // NewStreamEndMessage 创建流式结束标记消息
 func NewStreamEndMessage() *Message {
 	return &Message{
@@ -153,6 +399,22 @@ func NewStreamEndMessage() *Message {
 	}
 }
 
+// NewRequestChunkMessage 创建请求体块消息
+func NewRequestChunkMessage(encryptedChunk []byte) *Message {
+	return &Message{
+		Type:    MessageTypeRequestChunk,
+		Payload: encryptedChunk,
+	}
+}
+
+// NewRequestEndMessage 创建请求体结束标记消息
+func NewRequestEndMessage(encryptedFinal []byte) *Message {
+	return &Message{
+		Type:    MessageTypeRequestEnd,
+		Payload: encryptedFinal,
+	}
+}
+
 // NewErrorMessage 创建错误消息
 func NewErrorMessage(errMsg string) *Message {
 	return &Message{
@@ -163,14 +425,11 @@ func NewErrorMessage(errMsg string) *Message {
 
 // NewRegisterMessage 创建 Exit 注册消息
 func NewRegisterMessage(pubKeyHash string, payload []byte) *Message {
-	return &Message{
-		Type:    MessageTypeRegister,
-		Target:  pubKeyHash,
-		Payload: payload,
-	}
+	return NewVersionedMessage(MessageTypeRegister, pubKeyHash, payload)
 }
 
 // NewRegisterAckMessage 创建注册确认消息
+// Relay 在负载首字节中返回协商后的协议版本
 func NewRegisterAckMessage(payload []byte) *Message {
 	return &Message{
 		Type:    MessageTypeRegisterAck,
@@ -185,6 +444,61 @@ func NewHeartbeatMessage() *Message {
 	}
 }
 
+// HeartbeatLoad Exit 心跳负载中携带的运行状态 (旧版 Exit 的心跳负载为空)
+type HeartbeatLoad struct {
+	Load  *int  `json:"load,omitempty"`   // 当前负载百分比 (0-100)，未配置额定并发数时不通告
+	RTTUs int64 `json:"rtt_us,omitempty"` // Exit 测得的心跳往返时间滑动平均 (微秒)，尚未测得时不通告
+}
+
+// NewExitHeartbeatMessage 创建附带当前负载百分比的 Exit 心跳消息
+func NewExitHeartbeatMessage(load int) *Message {
+	return NewExitHeartbeatStatusMessage(&load, 0)
+}
+
+// NewExitHeartbeatStatusMessage 创建附带运行状态的 Exit 心跳消息，load 为 nil 或 rtt 为 0 时不通告对应字段
+func NewExitHeartbeatStatusMessage(load *int, rtt time.Duration) *Message {
+	var hb HeartbeatLoad
+	if load != nil {
+		l := min(max(*load, 0), 100)
+		hb.Load = &l
+	}
+	if rtt > 0 {
+		hb.RTTUs = max(rtt.Microseconds(), 1)
+	}
+	payload, _ := json.Marshal(hb)
+	return &Message{
+		Type:    MessageTypeHeartbeat,
+		Payload: payload,
+	}
+}
+
+// decodeHeartbeat 解析心跳负载，负载为空或无法解析时返回 false
+func decodeHeartbeat(payload []byte) (HeartbeatLoad, bool) {
+	var hb HeartbeatLoad
+	if len(payload) == 0 || json.Unmarshal(payload, &hb) != nil {
+		return HeartbeatLoad{}, false
+	}
+	return hb, true
+}
+
+// DecodeHeartbeatLoad 解析心跳负载中的负载百分比，未通告负载或无法解析时返回 false
+func DecodeHeartbeatLoad(payload []byte) (int, bool) {
+	hb, ok := decodeHeartbeat(payload)
+	if !ok || hb.Load == nil {
+		return 0, false
+	}
+	return min(max(*hb.Load, 0), 100), true
+}
+
+// DecodeHeartbeatRTT 解析心跳负载中 Exit 测得的往返时间，未通告或无法解析时返回 false
+func DecodeHeartbeatRTT(payload []byte) (time.Duration, bool) {
+	hb, ok := decodeHeartbeat(payload)
+	if !ok || hb.RTTUs <= 0 {
+		return 0, false
+	}
+	return time.Duration(hb.RTTUs) * time.Microsecond, true
+}
+
 // NewHeartbeatAckMessage 创建心跳确认消息
 func NewHeartbeatAckMessage() *Message {
 	return &Message{
@@ -192,17 +506,46 @@ func NewHeartbeatAckMessage() *Message {
 	}
 }
 
+// NewDrainMessage 创建 Relay 排空通知消息
+func NewDrainMessage() *Message {
+	return &Message{
+		Type: MessageTypeDrain,
+	}
+}
+
 // ExitKeyEntry Exit 公钥条目 (用于 Relay 返回给 Client)
 type ExitKeyEntry struct {
-	PubKeyHash string `json:"pub_key_hash"`
-	KeyConfig  []byte `json:"key_config"` // OHTTP KeyConfig 编码 (RFC 9458)
+	PubKeyHash       string   `json:"pub_key_hash"`
+	KeyConfig        []byte   `json:"key_config"`                   // OHTTP KeyConfig 编码 (RFC 9458)
+	Reconnecting     bool     `json:"reconnecting,omitempty"`       // Exit 断线重连中 (宽限期内仍通告)
+	Capabilities     []string `json:"capabilities,omitempty"`       // 支持的端点族，为空表示未通告 (视为全部支持)
+	RequestTimeoutMs int64    `json:"request_timeout_ms,omitempty"` // Exit 推荐的请求超时 (毫秒)，0 表示未通告
+	Weight           int      `json:"weight,omitempty"`             // Exit 按后端容量通告的选择权重，0 表示未通告
+	Models           []string `json:"models,omitempty"`             // Exit 可服务的模型 (支持 * 结尾的前缀)，为空表示未通告
+	Load             int      `json:"load,omitempty"`               // Exit 最近心跳通告的负载百分比 (0-100)，0 表示空闲或未通告
+	Features         []string `json:"features,omitempty"`           // Exit 支持的协议特性 (Feature*)，为空表示未通告
+}
+
+// RequestTimeout 返回 Exit 推荐的请求超时，未通告时返回 0
+func (e ExitKeyEntry) RequestTimeout() time.Duration {
+	return time.Duration(e.RequestTimeoutMs) * time.Millisecond
+}
+
+// SelectionWeight 返回 Exit 的选择权重，未通告时按 1 处理
+func (e ExitKeyEntry) SelectionWeight() int {
+	return max(e.Weight, 1)
 }
 
 // NewQueryExitKeysMessage 创建查询 Exit 公钥列表消息 (Client → Relay)
-func NewQueryExitKeysMessage() *Message {
-	return &Message{
+// acceptEncoding 为 Client 支持的响应编码 (如 ExitKeysEncodingGzip)，为空时负载为空
+func NewQueryExitKeysMessage(acceptEncoding ...string) *Message {
+	msg := &Message{
 		Type: MessageTypeQueryExitKeys,
 	}
+	if len(acceptEncoding) > 0 {
+		msg.Payload, _ = json.Marshal(queryExitKeysOptions{AcceptEncoding: acceptEncoding})
+	}
+	return msg
 }
 
 // NewExitKeysResponseMessage 创建 Exit 公钥列表响应消息 (Relay → Client)
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"io"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestEncodeDecodeRequest(t *testing.T) {
@@ -191,6 +194,56 @@ func TestEncodeDecodeHeartbeat(t *testing.T) {
 	}
 }
 
+func TestExitHeartbeatLoad(t *testing.T) {
+	decoded, err := Decode(bytes.NewReader(NewExitHeartbeatMessage(42).Encode()))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded.Type != MessageTypeHeartbeat {
+		t.Errorf("Type = 0x%02x, want 0x%02x", decoded.Type, MessageTypeHeartbeat)
+	}
+	if load, ok := DecodeHeartbeatLoad(decoded.Payload); !ok || load != 42 {
+		t.Errorf("DecodeHeartbeatLoad = %d, %v, want 42, true", load, ok)
+	}
+
+	// 超出范围的负载被截断
+	if load, _ := DecodeHeartbeatLoad(NewExitHeartbeatMessage(250).Payload); load != 100 {
+		t.Errorf("load = %d, want 100", load)
+	}
+
+	// 旧版 Exit 的空心跳和无法解析的负载视为未通告
+	for _, payload := range [][]byte{nil, []byte("garbage")} {
+		if _, ok := DecodeHeartbeatLoad(payload); ok {
+			t.Errorf("DecodeHeartbeatLoad(%q) should report no load", payload)
+		}
+	}
+}
+
+func TestExitHeartbeatRTT(t *testing.T) {
+	load := 30
+	payload := NewExitHeartbeatStatusMessage(&load, 1500*time.Microsecond).Payload
+	if rtt, ok := DecodeHeartbeatRTT(payload); !ok || rtt != 1500*time.Microsecond {
+		t.Errorf("DecodeHeartbeatRTT = %v, %v, want 1.5ms, true", rtt, ok)
+	}
+	if got, ok := DecodeHeartbeatLoad(payload); !ok || got != 30 {
+		t.Errorf("DecodeHeartbeatLoad = %d, %v, want 30, true", got, ok)
+	}
+
+	// 只通告往返时间时不视为通告了负载
+	payload = NewExitHeartbeatStatusMessage(nil, 2*time.Millisecond).Payload
+	if _, ok := DecodeHeartbeatLoad(payload); ok {
+		t.Error("RTT-only heartbeat should report no load")
+	}
+	if rtt, ok := DecodeHeartbeatRTT(payload); !ok || rtt != 2*time.Millisecond {
+		t.Errorf("DecodeHeartbeatRTT = %v, %v, want 2ms, true", rtt, ok)
+	}
+
+	// 只通告负载的心跳不含往返时间
+	if _, ok := DecodeHeartbeatRTT(NewExitHeartbeatMessage(42).Payload); ok {
+		t.Error("load-only heartbeat should report no RTT")
+	}
+}
+
 func TestEncodeDecodeHeartbeatAck(t *testing.T) {
 	msg := NewHeartbeatAckMessage()
 	encoded := msg.Encode()
@@ -364,3 +417,253 @@ func TestDecodePayloadTruncated(t *testing.T) {
 		t.Fatal("expected error for truncated payload")
 	}
 }
+
+func TestVersionedMessage_V1KeepsLegacyFormat(t *testing.T) {
+	legacy := NewRequestMessage("hash", []byte("payload")).Encode()
+	versioned := NewVersionedMessage(MessageTypeRequest, "hash", []byte("payload")).Encode()
+	if !bytes.Equal(legacy, versioned) {
+		t.Fatal("版本 1 消息应与原始格式逐字节一致")
+	}
+
+	decoded, err := Decode(bytes.NewReader(legacy))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded.Version != 1 {
+		t.Errorf("Version = %d, want 1 for legacy frame", decoded.Version)
+	}
+}
+
+func TestDecodeVersionedFrame(t *testing.T) {
+	// 显式带版本标记的 v1 帧
+	frame := append([]byte{versionMarker, 1}, NewRequestMessage("hash", []byte("payload")).Encode()...)
+
+	decoded, err := Decode(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded.Type != MessageTypeRequest || decoded.Target != "hash" || string(decoded.Payload) != "payload" {
+		t.Errorf("decoded = %+v", decoded)
+	}
+	if decoded.Version != 1 {
+		t.Errorf("Version = %d, want 1", decoded.Version)
+	}
+}
+
+func TestDecodeUnsupportedVersion(t *testing.T) {
+	msg := &Message{Type: MessageTypeRequest, Version: ProtocolVersion + 1, Target: "hash", Payload: []byte("x")}
+	encoded := msg.Encode()
+	if encoded[0] != versionMarker {
+		t.Fatalf("高版本消息应带版本标记, got 0x%02x", encoded[0])
+	}
+
+	_, err := Decode(bytes.NewReader(encoded))
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("err = %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		peer    uint8
+		want    uint8
+		wantErr bool
+	}{
+		{peer: 0, want: 1},
+		{peer: 1, want: 1},
+		{peer: ProtocolVersion + 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NegotiateVersion(tt.peer)
+		if tt.wantErr {
+			if !errors.Is(err, ErrUnsupportedVersion) {
+				t.Errorf("NegotiateVersion(%d) err = %v, want ErrUnsupportedVersion", tt.peer, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NegotiateVersion(%d) = %d, %v, want %d", tt.peer, got, err, tt.want)
+		}
+	}
+}
+
+func TestEncodeDecodeTenant(t *testing.T) {
+	msg := NewRequestMessage("exit-hash", []byte("payload"))
+	msg.Tenant = "team-a"
+
+	decoded, err := Decode(bytes.NewReader(msg.Encode()))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded.Target != "exit-hash" || decoded.Tenant != "team-a" {
+		t.Errorf("Target = %q, Tenant = %q", decoded.Target, decoded.Tenant)
+	}
+	if string(decoded.Payload) != "payload" {
+		t.Errorf("Payload = %q", decoded.Payload)
+	}
+
+	// 无租户时保持原始编码
+	legacy := NewRequestMessage("exit-hash", []byte("payload")).Encode()
+	if want := 1 + 2 + len("exit-hash") + 4 + len("payload"); len(legacy) != want {
+		t.Errorf("未设置租户时编码长度 = %d, want %d", len(legacy), want)
+	}
+	decoded, err = Decode(bytes.NewReader(legacy))
+	if err != nil || decoded.Tenant != "" {
+		t.Errorf("Tenant = %q, err = %v, want empty", decoded.Tenant, err)
+	}
+}
+
+func TestEncodeDecodeDeadline(t *testing.T) {
+	for _, tenant := range []string{"", "team-a"} {
+		msg := NewStreamRequestMessage("exit-hash", []byte("payload"))
+		msg.Tenant = tenant
+		msg.Deadline = time.Now().Add(5 * time.Second)
+
+		decoded, err := Decode(bytes.NewReader(msg.Encode()))
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if decoded.Target != "exit-hash" || decoded.Tenant != tenant {
+			t.Errorf("Target = %q, Tenant = %q, want exit-hash, %q", decoded.Target, decoded.Tenant, tenant)
+		}
+		// 按剩余时间编码，解码后的截止时间与原值相差不超过传输耗时
+		if diff := decoded.Deadline.Sub(msg.Deadline); diff < -time.Second || diff > time.Second {
+			t.Errorf("Deadline differs by %v", diff)
+		}
+	}
+
+	// 未设置截止时间时解码为零值
+	decoded, err := Decode(bytes.NewReader(NewRequestMessage("exit-hash", nil).Encode()))
+	if err != nil || !decoded.Deadline.IsZero() {
+		t.Errorf("Deadline = %v, err = %v, want zero", decoded.Deadline, err)
+	}
+}
+
+func TestDecodeInvalidDeadline(t *testing.T) {
+	msg := NewRequestMessage("exit-hash\x00team-a\x00soon", nil)
+	if _, err := Decode(bytes.NewReader(msg.Encode())); err == nil {
+		t.Error("无效的截止时间应解码失败")
+	}
+}
+
+func TestDecodeTenantTooLong(t *testing.T) {
+	msg := NewRequestMessage("exit-hash", nil)
+	msg.Tenant = strings.Repeat("t", MaxTenantLength+1)
+	if _, err := Decode(bytes.NewReader(msg.Encode())); err == nil {
+		t.Error("超长租户标识应解码失败")
+	}
+}
+
+func TestValidateTenant(t *testing.T) {
+	for _, tenant := range []string{"", "team-a", strings.Repeat("t", MaxTenantLength)} {
+		if err := ValidateTenant(tenant); err != nil {
+			t.Errorf("ValidateTenant(%q) = %v", tenant, err)
+		}
+	}
+	for _, tenant := range []string{"a\x00b", strings.Repeat("t", MaxTenantLength+1)} {
+		if err := ValidateTenant(tenant); err == nil {
+			t.Errorf("ValidateTenant(%q) 应失败", tenant)
+		}
+	}
+}
+
+func TestEncodeTo_MatchesEncode(t *testing.T) {
+	msgs := []*Message{
+		NewStreamChunkMessage(bytes.Repeat([]byte{0xab}, 1024)),
+		NewStreamEndMessage(),
+		{Type: MessageTypeRequest, Version: 2, Target: "hash", Tenant: "team-a", Payload: []byte("payload")},
+		NewResponseMessage(bytes.Repeat([]byte("x"), maxPooledFrameSize+1)), // 超过池化上限的大消息
+	}
+	for _, msg := range msgs {
+		var buf bytes.Buffer
+		n, err := msg.EncodeTo(&buf)
+		if err != nil {
+			t.Fatalf("EncodeTo failed: %v", err)
+		}
+		if want := msg.Encode(); n != len(want) || !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("EncodeTo(type 0x%02x) = %d bytes, differs from Encode (%d bytes)", msg.Type, n, len(want))
+		}
+	}
+
+	// 带截止时间的消息可正常解码
+	msg := &Message{Type: MessageTypeRequest, Target: "hash", Payload: []byte("p"), Deadline: time.Now().Add(time.Minute)}
+	var buf bytes.Buffer
+	msg.EncodeTo(&buf)
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded.Target != "hash" || decoded.Deadline.IsZero() {
+		t.Errorf("decoded = %+v", decoded)
+	}
+}
+
+func BenchmarkEncode_1KBChunk(b *testing.B) {
+	msg := NewStreamChunkMessage(bytes.Repeat([]byte{0xab}, 1024))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		io.Discard.Write(msg.Encode())
+	}
+}
+
+func BenchmarkEncodeTo_1KBChunk(b *testing.B) {
+	msg := NewStreamChunkMessage(bytes.Repeat([]byte{0xab}, 1024))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg.EncodeTo(io.Discard)
+	}
+}
+
+// shortWriter 每次最多写入 max 字节且不返回错误，模拟背压下的短写
+type shortWriter struct {
+	buf   bytes.Buffer
+	max   int
+	calls int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if len(p) > w.max {
+		p = p[:w.max]
+	}
+	return w.buf.Write(p)
+}
+
+func TestWriteMessage_ShortWrites(t *testing.T) {
+	msg := NewStreamChunkMessage(bytes.Repeat([]byte("chunk"), 300))
+	w := &shortWriter{max: 7}
+	if err := WriteMessage(w, msg); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+	if !bytes.Equal(w.buf.Bytes(), msg.Encode()) {
+		t.Fatalf("wrote %d bytes, want the full %d byte message", w.buf.Len(), len(msg.Encode()))
+	}
+	if w.calls < 2 {
+		t.Errorf("Write called %d times, want the short writes to be retried", w.calls)
+	}
+	decoded, err := Decode(&w.buf)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !bytes.Equal(decoded.Payload, msg.Payload) {
+		t.Error("decoded payload differs from the original")
+	}
+}
+
+func TestWriteMessage_StalledWriter(t *testing.T) {
+	// 既不写入也不返回错误的 Writer 不会导致死循环
+	if err := WriteMessage(&shortWriter{max: 0}, NewStreamEndMessage()); !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("WriteMessage err = %v, want io.ErrShortWrite", err)
+	}
+
+	// 写入失败时返回底层错误
+	errReset := errors.New("stream reset")
+	if err := WriteMessage(errorWriter{errReset}, NewStreamEndMessage()); !errors.Is(err, errReset) {
+		t.Errorf("WriteMessage err = %v, want the writer error", err)
+	}
+}
+
+// errorWriter 写入总是失败
+type errorWriter struct{ err error }
+
+func (w errorWriter) Write([]byte) (int, error) { return 0, w.err }
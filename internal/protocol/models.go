@@ -0,0 +1,59 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ExitModels 各 Exit 通告的可服务模型 (QueryExitModels 的响应)，键为 pubKeyHash
+// 未通告模型的 Exit 不出现在结果中 (Client 视为支持全部模型)
+type ExitModels map[string][]string
+
+// NewQueryExitModelsMessage 创建查询 Exit 可服务模型的消息 (Client → Relay)
+func NewQueryExitModelsMessage() *Message {
+	return &Message{
+		Type: MessageTypeQueryExitModels,
+	}
+}
+
+// NewExitModelsResponseMessage 创建 Exit 可服务模型响应消息 (Relay → Client)
+func NewExitModelsResponseMessage(models ExitModels) (*Message, error) {
+	data, err := json.Marshal(models)
+	if err != nil {
+		return nil, fmt.Errorf("marshal exit models: %w", err)
+	}
+	return &Message{
+		Type:    MessageTypeExitModelsResponse,
+		Payload: data,
+	}, nil
+}
+
+// DecodeExitModelsResponse 解析 Exit 可服务模型响应负载
+func DecodeExitModelsResponse(payload []byte) (ExitModels, error) {
+	var models ExitModels
+	if err := json.Unmarshal(payload, &models); err != nil {
+		return nil, fmt.Errorf("解析 Exit 模型列表失败: %w", err)
+	}
+	return models, nil
+}
+
+// NewUpdateModelsMessage 创建更新可服务模型的消息 (Exit → Relay)，models 为空表示不再限制模型
+func NewUpdateModelsMessage(models []string) (*Message, error) {
+	data, err := json.Marshal(models)
+	if err != nil {
+		return nil, fmt.Errorf("marshal models: %w", err)
+	}
+	return &Message{
+		Type:    MessageTypeUpdateModels,
+		Payload: data,
+	}, nil
+}
+
+// DecodeUpdateModels 解析 Exit 更新的可服务模型列表
+func DecodeUpdateModels(payload []byte) ([]string, error) {
+	var models []string
+	if err := json.Unmarshal(payload, &models); err != nil {
+		return nil, fmt.Errorf("解析模型列表失败: %w", err)
+	}
+	return models, nil
+}
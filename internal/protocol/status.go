@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RelayStatus Relay 运行状态 (Status 查询的响应)
+type RelayStatus struct {
+	UptimeMs int64        `json:"uptime_ms"` // Relay 启动以来的运行时间 (毫秒)
+	Exits    []ExitStatus `json:"exits"`     // 已注册的 Exit，按 pubKeyHash 排序
+}
+
+// ExitStatus 单个 Exit (同一 pubKeyHash 的全部实例) 的注册状态
+type ExitStatus struct {
+	PubKeyHash         string `json:"pub_key_hash"`
+	Instances          int    `json:"instances"`                  // 已注册的实例连接数 (含重连宽限期内的)
+	LastHeartbeatAgeMs int64  `json:"last_heartbeat_age_ms"`      // 各实例中最近一次心跳距今的时间 (毫秒)
+	Reconnecting       bool   `json:"reconnecting,omitempty"`     // 所有实例均处于断线重连宽限期
+	HeartbeatRTTUs     int64  `json:"heartbeat_rtt_us,omitempty"` // 在线实例通告的心跳往返时间平均值 (微秒)，0 表示未通告
+}
+
+// Uptime 返回 Relay 运行时间
+func (s *RelayStatus) Uptime() time.Duration {
+	return time.Duration(s.UptimeMs) * time.Millisecond
+}
+
+// LastHeartbeatAge 返回最近一次心跳距今的时间
+func (e ExitStatus) LastHeartbeatAge() time.Duration {
+	return time.Duration(e.LastHeartbeatAgeMs) * time.Millisecond
+}
+
+// HeartbeatRTT 返回 Exit 与 Relay 的心跳往返时间，0 表示未通告
+func (e ExitStatus) HeartbeatRTT() time.Duration {
+	return time.Duration(e.HeartbeatRTTUs) * time.Microsecond
+}
+
+// NewStatusMessage 创建 Relay 状态查询消息 (Client → Relay)
+func NewStatusMessage() *Message {
+	return &Message{
+		Type: MessageTypeStatus,
+	}
+}
+
+// NewStatusResponseMessage 创建 Relay 状态响应消息 (Relay → Client)
+func NewStatusResponseMessage(status *RelayStatus) (*Message, error) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return nil, fmt.Errorf("marshal relay status: %w", err)
+	}
+	return &Message{
+		Type:    MessageTypeStatusResponse,
+		Payload: data,
+	}, nil
+}
+
+// DecodeStatusResponse 解析 Relay 状态响应负载
+func DecodeStatusResponse(payload []byte) (*RelayStatus, error) {
+	var status RelayStatus
+	if err := json.Unmarshal(payload, &status); err != nil {
+		return nil, fmt.Errorf("解析 Relay 状态失败: %w", err)
+	}
+	return &status, nil
+}
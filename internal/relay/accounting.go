@@ -0,0 +1,80 @@
+package relay
+
+import (
+	"sort"
+	"sync"
+)
+
+// TenantUsage 单个租户的累计用量
+type TenantUsage struct {
+	Requests int64 // 已转发的请求数
+	BytesIn  int64 // Client→Exit 方向的 OHTTP 负载字节数
+	BytesOut int64 // Exit→Client 方向的 OHTTP 负载字节数
+}
+
+// Accounting 按租户统计转发用量 (仅统计加密负载大小，Relay 无法看到请求内容)
+type Accounting struct {
+	mu    sync.Mutex
+	usage map[string]*TenantUsage
+}
+
+// NewAccounting 创建用量统计
+func NewAccounting() *Accounting {
+	return &Accounting{
+		usage: make(map[string]*TenantUsage),
+	}
+}
+
+// Record 记录一次转发，未携带租户标识的请求不统计
+func (a *Accounting) Record(tenant string, bytesIn, bytesOut int) {
+	if tenant == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	u, ok := a.usage[tenant]
+	if !ok {
+		u = &TenantUsage{}
+		a.usage[tenant] = u
+	}
+	u.Requests++
+	u.BytesIn += int64(bytesIn)
+	u.BytesOut += int64(bytesOut)
+}
+
+// Usage 返回指定租户的累计用量
+func (a *Accounting) Usage(tenant string) TenantUsage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if u, ok := a.usage[tenant]; ok {
+		return *u
+	}
+	return TenantUsage{}
+}
+
+// Snapshot 返回所有租户用量的副本
+func (a *Accounting) Snapshot() map[string]TenantUsage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	snapshot := make(map[string]TenantUsage, len(a.usage))
+	for tenant, u := range a.usage {
+		snapshot[tenant] = *u
+	}
+	return snapshot
+}
+
+// Tenants 返回已记录用量的租户列表 (按名称排序)
+func (a *Accounting) Tenants() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tenants := make([]string, 0, len(a.usage))
+	for tenant := range a.usage {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
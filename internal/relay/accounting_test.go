@@ -0,0 +1,57 @@
+package relay
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestAccounting_RecordPerTenant(t *testing.T) {
+	a := NewAccounting()
+	a.Record("team-a", 100, 1000)
+	a.Record("team-a", 50, 500)
+	a.Record("team-b", 10, 20)
+	a.Record("", 999, 999) // 未携带租户不统计
+
+	if got, want := a.Usage("team-a"), (TenantUsage{Requests: 2, BytesIn: 150, BytesOut: 1500}); got != want {
+		t.Errorf("team-a = %+v, want %+v", got, want)
+	}
+	if got, want := a.Usage("team-b"), (TenantUsage{Requests: 1, BytesIn: 10, BytesOut: 20}); got != want {
+		t.Errorf("team-b = %+v, want %+v", got, want)
+	}
+	if got := a.Usage("unknown"); got != (TenantUsage{}) {
+		t.Errorf("unknown = %+v, want zero", got)
+	}
+	if got, want := a.Tenants(), []string{"team-a", "team-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tenants = %v, want %v", got, want)
+	}
+}
+
+func TestAccounting_SnapshotIsCopy(t *testing.T) {
+	a := NewAccounting()
+	a.Record("team-a", 1, 2)
+
+	snapshot := a.Snapshot()
+	a.Record("team-a", 1, 2)
+
+	if snapshot["team-a"].Requests != 1 {
+		t.Errorf("snapshot 不应随后续记录变化: %+v", snapshot["team-a"])
+	}
+}
+
+func TestAccounting_Concurrent(t *testing.T) {
+	a := NewAccounting()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.Record("team-a", 3, 7)
+		}()
+	}
+	wg.Wait()
+
+	if got, want := a.Usage("team-a"), (TenantUsage{Requests: 50, BytesIn: 150, BytesOut: 350}); got != want {
+		t.Errorf("team-a = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+package relay
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/binn/tokengo/internal/logging"
+)
+
+// AdminServer Relay 管理 HTTP 接口，所有请求需携带 "Authorization: Bearer <token>"
+//
+//	GET  /admin/exits                    列出各 Exit 实例的运行统计 (负载、心跳往返时间、进行中的流等)
+//	POST /admin/exits/{pubKeyHash}/kick  踢出 Exit (移除注册并关闭连接)
+type AdminServer struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+// NewAdminHandler 创建管理接口的 HTTP 处理器 (可自行挂载)
+func NewAdminHandler(registry *Registry, token string, logger logging.Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/exits", func(w http.ResponseWriter, r *http.Request) {
+		stats := registry.Stats()
+		exits := make([]adminExitStats, 0, len(stats))
+		for _, s := range stats {
+			exits = append(exits, newAdminExitStats(s))
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]any{"exits": exits})
+	})
+	mux.HandleFunc("POST /admin/exits/{pubKeyHash}/kick", func(w http.ResponseWriter, r *http.Request) {
+		pubKeyHash := r.PathValue("pubKeyHash")
+		if !registry.Kick(pubKeyHash) {
+			writeAdminJSON(w, http.StatusNotFound, map[string]any{"error": "exit not registered"})
+			return
+		}
+		logger.Warn("管理接口踢出 Exit", logging.KeyExitHash, pubKeyHash, logging.KeyRemote, r.RemoteAddr)
+		writeAdminJSON(w, http.StatusOK, map[string]any{"kicked": pubKeyHash})
+	})
+	return requireAdminToken(token, mux)
+}
+
+// adminExitStats 管理接口输出的单个 Exit 实例统计 (时长以微秒表示，与状态查询一致)
+type adminExitStats struct {
+	PubKeyHash     string    `json:"pub_key_hash"`
+	RemoteAddr     string    `json:"remote_addr,omitempty"`
+	Load           int       `json:"load,omitempty"`
+	HeartbeatRTTUs int64     `json:"heartbeat_rtt_us,omitempty"`
+	LastHeartbeat  time.Time `json:"last_heartbeat"`
+	ActiveStreams  int       `json:"active_streams"`
+	Reconnecting   bool      `json:"reconnecting,omitempty"`
+}
+
+func newAdminExitStats(s ExitStats) adminExitStats {
+	return adminExitStats{
+		PubKeyHash:     s.PubKeyHash,
+		RemoteAddr:     s.RemoteAddr,
+		Load:           s.Load,
+		HeartbeatRTTUs: s.RTT.Microseconds(),
+		LastHeartbeat:  s.LastHeartbeat,
+		ActiveStreams:  s.ActiveStreams,
+		Reconnecting:   s.Reconnecting,
+	}
+}
+
+// requireAdminToken 校验 Bearer token (常量时间比较)，不匹配时返回 401
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAdminJSON(w, http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ServeAdmin 在 addr 上启动管理接口，token 不能为空
+func ServeAdmin(addr, token string, registry *Registry, logger logging.Logger) (*AdminServer, error) {
+	if token == "" {
+		return nil, fmt.Errorf("管理接口需要配置 admin.token")
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("启动管理 HTTP 服务失败: %w", err)
+	}
+	a := &AdminServer{
+		listener: ln,
+		server:   &http.Server{Handler: NewAdminHandler(registry, token, logger), ReadHeaderTimeout: 10 * time.Second},
+	}
+	go func() {
+		if err := a.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("管理 HTTP 服务异常退出", logging.KeyError, err)
+		}
+	}()
+	logger.Info("管理接口启动", "listen", ln.Addr().String())
+	return a, nil
+}
+
+// Addr 返回管理接口的实际监听地址
+func (a *AdminServer) Addr() string {
+	return a.listener.Addr().String()
+}
+
+// Close 关闭管理接口
+func (a *AdminServer) Close() error {
+	return a.server.Close()
+}
@@ -0,0 +1,85 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/binn/tokengo/internal/logging"
+)
+
+func TestAdminHandler_Kick(t *testing.T) {
+	registry := NewRegistry()
+	conn := newMockConn(1)
+	registry.Register("hash1", conn, []byte("key"))
+	handler := NewAdminHandler(registry, "secret", logging.New("relay"))
+
+	kick := func(hash, auth string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/exits/"+hash+"/kick", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 未认证的请求不生效
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		if code := kick("hash1", auth); code != http.StatusUnauthorized {
+			t.Errorf("kick with Authorization %q = %d, want 401", auth, code)
+		}
+	}
+	if _, ok := registry.Lookup("hash1"); !ok || conn.closeCalls.Load() != 0 {
+		t.Fatal("unauthenticated request affected the exit")
+	}
+
+	if code := kick("hash1", "Bearer secret"); code != http.StatusOK {
+		t.Fatalf("kick = %d, want 200", code)
+	}
+	if _, ok := registry.Lookup("hash1"); ok || conn.closeCalls.Load() != 1 {
+		t.Error("kicked exit should be removed and its connection closed")
+	}
+	if code := kick("hash1", "Bearer secret"); code != http.StatusNotFound {
+		t.Errorf("kick unregistered = %d, want 404", code)
+	}
+}
+
+func TestAdminHandler_ListExits(t *testing.T) {
+	registry := NewRegistry()
+	conn := newMockConn(1)
+	registry.Register("hash1", conn, []byte("key"))
+	registry.UpdateRTTIfMatch("hash1", conn, 15*time.Millisecond)
+	handler := NewAdminHandler(registry, "secret", logging.New("relay"))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/exits", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("list without token = %d, want 401", w.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list = %d, want 200", w.Code)
+	}
+	var body struct {
+		Exits []adminExitStats `json:"exits"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(body.Exits) != 1 || body.Exits[0].PubKeyHash != "hash1" || body.Exits[0].HeartbeatRTTUs != 15000 {
+		t.Errorf("exits = %+v, want hash1 with a 15ms heartbeat RTT", body.Exits)
+	}
+}
+
+func TestServeAdmin_RequiresToken(t *testing.T) {
+	if _, err := ServeAdmin("127.0.0.1:0", "", NewRegistry(), logging.New("relay")); err == nil {
+		t.Fatal("ServeAdmin without token should fail")
+	}
+}
@@ -1,58 +1,180 @@
 package relay
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/logging"
+	"github.com/binn/tokengo/internal/metrics"
 	"github.com/binn/tokengo/internal/protocol"
 	"github.com/quic-go/quic-go"
 )
 
+// expiredCloseDelay 到期连接上的流全部完成后，关闭连接前等待最后的响应数据送达的时间
+const expiredCloseDelay = time.Second
+
 // QUICServer QUIC 服务器
 type QUICServer struct {
-	listener  *quic.Listener
-	registry  *Registry
-	addr      string
-	tlsConfig *tls.Config
-	wg        sync.WaitGroup // 追踪所有 goroutine
-	ready     chan struct{}
-	readyOnce sync.Once
+	listener   io.Closer // *quic.Listener，启用 0-RTT 时为 *quic.EarlyListener
+	registry   *Registry
+	accounting *Accounting
+	metrics    metrics.Sink
+	logger     logging.Logger
+	addr       string
+	tlsConfig  *tls.Config
+	wg         sync.WaitGroup // 追踪所有 goroutine
+	ready      chan struct{}
+	readyOnce  sync.Once
+	startedAt  time.Time         // 开始监听的时间，用于状态查询的运行时间
+	quicParams config.QUICParams // Client/Exit 连接的 QUIC 保活参数
+
+	// maxRequestTimeout Client 携带截止时间时 Exit 流的最长生命周期
+	maxRequestTimeout time.Duration
+
+	// rateLimiter 按 Client 来源 IP 限制转发请求速率 (未配置时为 nil)
+	rateLimiter *RateLimiter
+
+	// 排空状态: draining 后拒绝新的 Client 流，活跃流归零时关闭 drained
+	streamMu      sync.Mutex
+	draining      bool
+	activeStreams int
+	drained       chan struct{}
 }
 
 // NewQUICServer 创建 QUIC 服务器
 func NewQUICServer(addr string, tlsConfig *tls.Config, registry *Registry) *QUICServer {
 	return &QUICServer{
-		addr:      addr,
-		tlsConfig: tlsConfig,
-		registry:  registry,
-		ready:     make(chan struct{}),
+		addr:       addr,
+		tlsConfig:  tlsConfig,
+		registry:   registry,
+		accounting: NewAccounting(),
+		metrics:    metrics.Nop{},
+		logger:     logging.New("relay"),
+		quicParams: config.DefaultQUICParams(),
+		ready:      make(chan struct{}),
+
+		maxRequestTimeout: defaultMaxRequestTimeout,
+	}
+}
+
+// Exit 流超时默认值
+const (
+	// openExitStreamTimeout Client 未携带截止时间时打开 Exit 流的超时 (旧版 Client)
+	openExitStreamTimeout = 30 * time.Second
+	// defaultMaxRequestTimeout Client 携带截止时间时 Exit 流生命周期的默认上限
+	defaultMaxRequestTimeout = 10 * time.Minute
+)
+
+// SetMaxRequestTimeout 设置 Client 携带截止时间时 Exit 流生命周期的上限，<= 0 时使用默认值 10m
+func (s *QUICServer) SetMaxRequestTimeout(d time.Duration) {
+	if d <= 0 {
+		d = defaultMaxRequestTimeout
+	}
+	s.maxRequestTimeout = d
+}
+
+// exitStreamContext 返回在 Exit 连接上打开流使用的上下文
+// Client 携带截止时间时，上下文在截止时间 (不超过 maxRequestTimeout) 到期后取消，bounded 为 true，
+// 调用方应随之取消 Exit 流；未携带时只限制打开流的耗时，不限制请求时长
+func (s *QUICServer) exitStreamContext(msg *protocol.Message) (ctx context.Context, cancel context.CancelFunc, bounded bool) {
+	if msg.Deadline.IsZero() {
+		ctx, cancel = context.WithTimeout(context.Background(), openExitStreamTimeout)
+		return ctx, cancel, false
+	}
+	deadline := msg.Deadline
+	maxTimeout := s.maxRequestTimeout
+	if maxTimeout <= 0 {
+		maxTimeout = defaultMaxRequestTimeout
+	}
+	if limit := time.Now().Add(maxTimeout); deadline.After(limit) {
+		deadline = limit
 	}
+	ctx, cancel = context.WithDeadline(context.Background(), deadline)
+	return ctx, cancel, true
+}
+
+// cancelExitStreamOnDone 上下文到期时中断 Exit 流 (Exit 读写返回错误，停止处理请求)，返回的函数解除关联
+func cancelExitStreamOnDone(ctx context.Context, exitStream quic.Stream) func() bool {
+	return context.AfterFunc(ctx, func() {
+		exitStream.CancelRead(0)
+		exitStream.CancelWrite(0)
+	})
+}
+
+// Accounting 返回按租户统计的转发用量
+func (s *QUICServer) Accounting() *Accounting {
+	return s.accounting
+}
+
+// SetClientRateLimit 按 Client 来源 IP 限制转发请求速率: 每秒 rps 个请求，允许 burst 个突发请求
+// (burst <= 0 时取 rps 向上取整)；超出时返回 rate limited 错误而不转发；rps <= 0 表示不限流 (默认)
+func (s *QUICServer) SetClientRateLimit(rps float64, burst int) {
+	if rps <= 0 {
+		s.rateLimiter = nil
+		return
+	}
+	s.rateLimiter = NewRateLimiter(rps, burst)
+}
+
+// SetMetrics 设置指标输出 (转发次数、耗时、在线 Exit 数)
+func (s *QUICServer) SetMetrics(sink metrics.Sink) {
+	if sink == nil {
+		sink = metrics.Nop{}
+	}
+	s.metrics = sink
+}
+
+// SetLogger 设置日志输出 (如附加本 Relay 的 PeerID)
+func (s *QUICServer) SetLogger(logger logging.Logger) {
+	s.logger = logger
+}
+
+// SetQUICParams 设置 Client/Exit 连接的 QUIC 保活参数 (需在 Start 前调用)，未设置的字段使用默认值
+func (s *QUICServer) SetQUICParams(p config.QUICParams) {
+	s.quicParams = p.WithDefaults(config.DefaultQUICParams())
 }
 
 // Start 启动 QUIC 服务器
 func (s *QUICServer) Start(ctx context.Context) error {
 	// QUIC 配置
 	quicConfig := &quic.Config{
-		MaxIdleTimeout:  120_000_000_000, // 120 秒 (纳秒)
-		KeepAlivePeriod: 30_000_000_000,  // 30 秒
+		MaxIdleTimeout:  s.quicParams.MaxIdleTimeout,
+		KeepAlivePeriod: s.quicParams.KeepAlivePeriod,
+		EnableDatagrams: s.quicParams.EnableDatagrams,
 	}
 
-	// 启动监听
-	listener, err := quic.ListenAddr(s.addr, s.tlsConfig, quicConfig)
-	if err != nil {
-		return fmt.Errorf("启动 QUIC 监听失败: %w", err)
+	// 启动监听 (启用 0-RTT 时接受恢复会话的连接随握手发送的数据)
+	var accept func(context.Context) (quic.Connection, error)
+	if s.quicParams.Enable0RTT {
+		quicConfig.Allow0RTT = true
+		listener, err := quic.ListenAddrEarly(s.addr, s.tlsConfig, quicConfig)
+		if err != nil {
+			return fmt.Errorf("启动 QUIC 监听失败: %w", err)
+		}
+		s.listener = listener
+		accept = func(ctx context.Context) (quic.Connection, error) { return listener.Accept(ctx) }
+	} else {
+		listener, err := quic.ListenAddr(s.addr, s.tlsConfig, quicConfig)
+		if err != nil {
+			return fmt.Errorf("启动 QUIC 监听失败: %w", err)
+		}
+		s.listener = listener
+		accept = listener.Accept
 	}
-	s.listener = listener
+	s.startedAt = time.Now()
 
 	// 标记为就绪
 	s.readyOnce.Do(func() { close(s.ready) })
 
-	log.Printf("QUIC 服务器启动，监听 %s", s.addr)
+	s.logger.Info("QUIC 服务器启动", "listen", s.addr)
 
 	// 接受连接
 	for {
@@ -62,13 +184,13 @@ func (s *QUICServer) Start(ctx context.Context) error {
 			s.wg.Wait()
 			return nil
 		default:
-			conn, err := listener.Accept(ctx)
+			conn, err := accept(ctx)
 			if err != nil {
-				if ctx.Err() != nil {
+				if ctx.Err() != nil || errors.Is(err, quic.ErrServerClosed) {
 					s.wg.Wait()
 					return nil
 				}
-				log.Printf("接受连接失败: %v", err)
+				s.logger.Warn("接受连接失败", logging.KeyError, err)
 				continue
 			}
 
@@ -84,7 +206,7 @@ func (s *QUICServer) Start(ctx context.Context) error {
 // handleConnection 处理单个 QUIC 连接，根据 ALPN 区分 Client 和 Exit
 func (s *QUICServer) handleConnection(ctx context.Context, conn quic.Connection) {
 	alpn := conn.ConnectionState().TLS.NegotiatedProtocol
-	log.Printf("新连接: %s, ALPN: %s", conn.RemoteAddr(), alpn)
+	s.logger.Info("新连接", logging.KeyRemote, conn.RemoteAddr().String(), "alpn", alpn, "protocol_version", protocol.ProtocolVersion)
 
 	switch alpn {
 	case "tokengo-exit":
@@ -96,12 +218,33 @@ func (s *QUICServer) handleConnection(ctx context.Context, conn quic.Connection)
 }
 
 // handleClientConnection 处理 Client 连接（原有逻辑）
+// 配置 max_lifetime 时连接到期后拒绝新流 (Client 收到后换新连接重试)，进行中的流完成后关闭连接
 func (s *QUICServer) handleClientConnection(ctx context.Context, conn quic.Connection) {
-	defer conn.CloseWithError(0, "connection closed")
-
 	var streamWg sync.WaitGroup
+	var expiredMu sync.Mutex // 保证到期后不再 streamWg.Add，避免与 Wait 并发
+	expired := false
+	if lifetime := s.quicParams.MaxLifetime; lifetime > 0 {
+		timer := time.AfterFunc(lifetime, func() {
+			expiredMu.Lock()
+			expired = true
+			expiredMu.Unlock()
+			s.logger.Info("Client 连接达到最长存活时间，等待进行中的请求完成后关闭", logging.KeyRemote, conn.RemoteAddr().String())
+			// 进行中的流完成后稍等片刻再关闭连接 (CloseWithError 会丢弃尚未送达的响应数据)，AcceptStream 随之返回
+			streamWg.Wait()
+			select {
+			case <-time.After(expiredCloseDelay):
+			case <-conn.Context().Done():
+			}
+			conn.CloseWithError(0, "connection lifetime exceeded")
+		})
+		defer timer.Stop()
+	}
+
+	defer conn.CloseWithError(0, "connection closed")
 	defer streamWg.Wait() // 确保所有流处理完成
 
+	remote := rateLimitKey(conn.RemoteAddr())
+
 	for {
 		stream, err := conn.AcceptStream(ctx)
 		if err != nil {
@@ -113,34 +256,55 @@ func (s *QUICServer) handleClientConnection(ctx context.Context, conn quic.Conne
 			case <-conn.Context().Done():
 				return
 			default:
-				log.Printf("接受流失败: %v", err)
+				s.logger.Warn("接受流失败", logging.KeyRemote, conn.RemoteAddr().String(), logging.KeyError, err)
 				return
 			}
 		}
 
+		expiredMu.Lock()
+		if expired {
+			expiredMu.Unlock()
+			go rejectExpired(stream)
+			continue
+		}
 		streamWg.Add(1)
+		expiredMu.Unlock()
+
 		go func(stream quic.Stream) {
 			defer streamWg.Done()
-			s.handleStream(stream)
+			s.handleStream(stream, remote)
 		}(stream)
 	}
 }
 
+// rejectExpired 拒绝已到期连接上的新流，Client 收到后换新连接重试
+func rejectExpired(stream quic.Stream) {
+	defer stream.Close()
+	if _, err := protocol.Decode(stream); err != nil {
+		return
+	}
+	protocol.WriteMessage(stream, protocol.NewErrorMessage(protocol.ErrConnectionExpired))
+}
+
 // handleExitConnection 处理 Exit 节点的反向隧道连接
 func (s *QUICServer) handleExitConnection(ctx context.Context, conn quic.Connection) {
 	// 不 defer CloseWithError，因为连接需要长期保持
+	logger := s.logger.With(logging.KeyRemote, conn.RemoteAddr().String())
 
 	// 1. AcceptStream 读取第一条消息（注册消息）
 	regStream, err := conn.AcceptStream(ctx)
 	if err != nil {
-		log.Printf("Exit 连接 %s: 接受注册流失败: %v", conn.RemoteAddr(), err)
+		logger.Warn("Exit 连接接受注册流失败", logging.KeyError, err)
 		conn.CloseWithError(1, "accept register stream failed")
 		return
 	}
 
 	msg, err := protocol.Decode(regStream)
 	if err != nil {
-		log.Printf("Exit 连接 %s: 读取注册消息失败: %v", conn.RemoteAddr(), err)
+		logger.Warn("Exit 连接读取注册消息失败", logging.KeyError, err)
+		if errors.Is(err, protocol.ErrUnsupportedVersion) {
+			protocol.WriteMessage(regStream, protocol.NewErrorMessage(protocol.ErrIncompatibleVersion))
+		}
 		regStream.Close()
 		conn.CloseWithError(1, "read register message failed")
 		return
@@ -148,9 +312,9 @@ func (s *QUICServer) handleExitConnection(ctx context.Context, conn quic.Connect
 
 	// 2. 验证是 MessageTypeRegister
 	if msg.Type != protocol.MessageTypeRegister {
-		log.Printf("Exit 连接 %s: 期望 Register 消息，收到类型 %d", conn.RemoteAddr(), msg.Type)
-		errMsg := protocol.NewErrorMessage("expected register message")
-		regStream.Write(errMsg.Encode())
+		logger.Warn("Exit 连接期望 Register 消息", "message_type", msg.Type)
+		errMsg := protocol.NewErrorMessage(protocol.ErrExpectedRegister)
+		protocol.WriteMessage(regStream, errMsg)
 		regStream.Close()
 		conn.CloseWithError(1, "unexpected message type")
 		return
@@ -159,34 +323,72 @@ func (s *QUICServer) handleExitConnection(ctx context.Context, conn quic.Connect
 	// 3. 从 msg.Target 取 pubKeyHash
 	pubKeyHash := msg.Target
 	if pubKeyHash == "" {
-		log.Printf("Exit 连接 %s: 注册消息缺少 pubKeyHash", conn.RemoteAddr())
-		errMsg := protocol.NewErrorMessage("missing pubKeyHash")
-		regStream.Write(errMsg.Encode())
+		logger.Warn("Exit 注册消息缺少 pubKeyHash")
+		errMsg := protocol.NewErrorMessage(protocol.ErrMissingPubKeyHash)
+		protocol.WriteMessage(regStream, errMsg)
 		regStream.Close()
 		conn.CloseWithError(1, "missing pubKeyHash")
 		return
 	}
+	logger = logger.With(logging.KeyExitHash, pubKeyHash)
+
+	// 4. 协商协议版本，拒绝不兼容的 Exit
+	version, err := protocol.NegotiateVersion(msg.Version)
+	if err != nil {
+		logger.Warn("Exit 协议版本不兼容", logging.KeyError, err)
+		errMsg := protocol.NewErrorMessage(protocol.ErrIncompatibleVersion)
+		protocol.WriteMessage(regStream, errMsg)
+		regStream.Close()
+		conn.CloseWithError(1, "incompatible protocol version")
+		return
+	}
 
-	// 4. 先发送 RegisterAck，再注册（避免注册窗口期的请求被路由到未就绪的 Exit）
-	ackMsg := protocol.NewRegisterAckMessage(nil)
-	if _, err := regStream.Write(ackMsg.Encode()); err != nil {
-		log.Printf("Exit %s: 发送 RegisterAck 失败: %v", pubKeyHash, err)
+	// 5. 先发送 RegisterAck，再注册（避免注册窗口期的请求被路由到未就绪的 Exit）
+	ackMsg := protocol.NewRegisterAckMessage([]byte{version})
+	if err := protocol.WriteMessage(regStream, ackMsg); err != nil {
+		logger.Warn("发送 RegisterAck 失败", logging.KeyError, err)
 		regStream.Close()
 		conn.CloseWithError(1, "send register ack failed")
 		return
 	}
 	regStream.Close()
 
-	// 5. 然后注册到 registry (附带 KeyConfig)
-	s.registry.Register(pubKeyHash, conn, msg.Payload)
+	// 6. 然后注册到 registry (附带 KeyConfig 和 Exit 元数据)
+	keyConfig, meta, err := protocol.DecodeRegisterPayload(msg.Payload)
+	if err != nil {
+		// 元数据尾部损坏时按旧版 Exit 处理 (视为支持全部端点)
+		logger.Warn("忽略 Exit 元数据", logging.KeyError, err)
+		keyConfig, meta = msg.Payload, protocol.ExitMetadata{}
+	}
+	s.registry.RegisterWithMetadata(pubKeyHash, conn, keyConfig, meta)
+	s.metrics.Gauge(metrics.RelayRegisteredExits, float64(s.registry.Count()))
+	if len(meta.Capabilities) > 0 {
+		logger.Info("Exit 通告端点能力", "capabilities", meta.Capabilities)
+	}
+	if meta.RequestTimeout > 0 {
+		logger.Info("Exit 通告推荐请求超时", "request_timeout", meta.RequestTimeout.String())
+	}
+	if meta.MaxConcurrentStreams > 0 {
+		logger.Info("Exit 通告并发请求流上限", "max_concurrent_streams", meta.MaxConcurrentStreams)
+	}
+	if meta.Weight > 0 || len(meta.Models) > 0 {
+		logger.Info("Exit 通告权重和模型", "weight", meta.Weight, "models", meta.Models)
+	}
+
+	datagrams := conn.ConnectionState().SupportsDatagrams
+	logger.Info("Exit 注册完成，开始心跳监听", "protocol_version", version, "datagrams", datagrams)
 
-	log.Printf("Exit %s: 注册完成，开始心跳监听", pubKeyHash)
+	// 已协商 datagram 时 Exit 可能以 datagram 发送心跳，流心跳仍然受理
+	if datagrams {
+		go s.receiveExitDatagrams(ctx, conn, pubKeyHash, logger)
+	}
 
-	// 6. 心跳监听循环
+	// 7. 心跳监听循环
 	defer func() {
-		s.registry.RemoveIfMatch(pubKeyHash, conn)
+		s.registry.MarkDisconnected(pubKeyHash, conn)
+		s.metrics.Gauge(metrics.RelayRegisteredExits, float64(s.registry.Count()))
 		conn.CloseWithError(0, "exit connection closed")
-		log.Printf("Exit %s: 连接已关闭", pubKeyHash)
+		logger.Info("Exit 连接已关闭")
 	}()
 
 	for {
@@ -197,10 +399,10 @@ func (s *QUICServer) handleExitConnection(ctx context.Context, conn quic.Connect
 			}
 			select {
 			case <-conn.Context().Done():
-				log.Printf("Exit %s: 连接断开", pubKeyHash)
+				logger.Info("Exit 连接断开")
 				return
 			default:
-				log.Printf("Exit %s: 接受心跳流失败: %v", pubKeyHash, err)
+				logger.Warn("接受心跳流失败", logging.KeyError, err)
 				return
 			}
 		}
@@ -210,33 +412,100 @@ func (s *QUICServer) handleExitConnection(ctx context.Context, conn quic.Connect
 			defer stream.Close()
 			hbMsg, err := protocol.Decode(stream)
 			if err != nil {
-				log.Printf("Exit %s: 读取心跳消息失败: %v", pubKeyHash, err)
+				logger.Warn("读取心跳消息失败", logging.KeyError, err)
 				return
 			}
 
-			if hbMsg.Type == protocol.MessageTypeHeartbeat {
-				s.registry.UpdateHeartbeat(pubKeyHash)
+			switch hbMsg.Type {
+			case protocol.MessageTypeHeartbeat:
+				s.recordExitHeartbeat(pubKeyHash, conn, hbMsg.Payload)
 				ackMsg := protocol.NewHeartbeatAckMessage()
-				stream.Write(ackMsg.Encode())
-			} else {
-				log.Printf("Exit %s: 心跳阶段收到非心跳消息类型 %d", pubKeyHash, hbMsg.Type)
+				protocol.WriteMessage(stream, ackMsg)
+			case protocol.MessageTypeDrain:
+				// Exit 回收该连接: 不再向其转发新请求，已转发的请求继续完成，关闭流作为确认
+				s.registry.MarkDisconnected(pubKeyHash, conn)
+				s.metrics.Gauge(metrics.RelayRegisteredExits, float64(s.registry.Count()))
+				logger.Info("Exit 回收连接，停止转发新请求")
+			case protocol.MessageTypeUpdateModels:
+				// Exit 刷新了后端模型列表，之后的 Exit 公钥查询返回新列表；关闭流作为确认
+				models, err := protocol.DecodeUpdateModels(hbMsg.Payload)
+				if err != nil {
+					logger.Warn("解析 Exit 模型列表失败", logging.KeyError, err)
+					return
+				}
+				if s.registry.UpdateModelsIfMatch(pubKeyHash, conn, models) {
+					logger.Info("Exit 更新可服务模型", "models", len(models))
+				}
+			default:
+				logger.Warn("心跳阶段收到非心跳消息", "message_type", hbMsg.Type)
 			}
 		}(hbStream)
 	}
 }
 
+// receiveExitDatagrams 处理 Exit 以 QUIC datagram 发送的控制消息 (目前仅心跳，无需确认)
+// 连接关闭时 ReceiveDatagram 返回错误，循环退出
+func (s *QUICServer) receiveExitDatagrams(ctx context.Context, conn quic.Connection, pubKeyHash string, logger logging.Logger) {
+	for {
+		data, err := conn.ReceiveDatagram(ctx)
+		if err != nil {
+			return
+		}
+		msg, err := protocol.Decode(bytes.NewReader(data))
+		if err != nil {
+			logger.Warn("解析 datagram 失败", logging.KeyError, err)
+			continue
+		}
+		if msg.Type == protocol.MessageTypeHeartbeat {
+			s.recordExitHeartbeat(pubKeyHash, conn, msg.Payload)
+		} else {
+			logger.Warn("datagram 收到非心跳消息", "message_type", msg.Type)
+		}
+	}
+}
+
+// recordExitHeartbeat 刷新 Exit 心跳时间，心跳附带负载和往返时间时一并记录
+func (s *QUICServer) recordExitHeartbeat(pubKeyHash string, conn quic.Connection, payload []byte) {
+	s.registry.UpdateHeartbeatIfMatch(pubKeyHash, conn)
+	if load, ok := protocol.DecodeHeartbeatLoad(payload); ok {
+		s.registry.UpdateLoadIfMatch(pubKeyHash, conn, load)
+	}
+	if rtt, ok := protocol.DecodeHeartbeatRTT(payload); ok && s.registry.UpdateRTTIfMatch(pubKeyHash, conn, rtt) {
+		s.metrics.Timing(metrics.RelayExitHeartbeatRTT, rtt)
+	}
+}
+
 // handleStream 处理单个 QUIC 流
-func (s *QUICServer) handleStream(stream quic.Stream) {
+func (s *QUICServer) handleStream(stream quic.Stream, remote string) {
 	defer stream.Close()
 
 	// 读取消息
 	msg, err := protocol.Decode(stream)
 	if err != nil {
 		if err != io.EOF {
-			log.Printf("读取消息失败: %v", err)
+			s.logger.Warn("读取消息失败", logging.KeyError, err)
+		}
+		if errors.Is(err, protocol.ErrUnsupportedVersion) {
+			protocol.WriteMessage(stream, protocol.NewErrorMessage(protocol.ErrIncompatibleVersion))
+		}
+		return
+	}
+
+	// 超出来源地址的请求速率时拒绝转发 (不占用 Exit 容量)
+	if msg.Type == protocol.MessageTypeRequest || msg.Type == protocol.MessageTypeStreamRequest {
+		if s.rateLimiter != nil && !s.rateLimiter.Allow(remote) {
+			s.metrics.Count(metrics.RelayRateLimited, 1)
+			protocol.WriteMessage(stream, protocol.NewErrorMessage(protocol.ErrRateLimited))
+			return
 		}
+	}
+
+	// 排空期间拒绝新请求，Client 收到后换 Relay 重试
+	if !s.beginStream() {
+		protocol.WriteMessage(stream, protocol.NewErrorMessage(protocol.ErrRelayDraining))
 		return
 	}
+	defer s.endStream()
 
 	// 根据消息类型处理
 	switch msg.Type {
@@ -246,141 +515,354 @@ func (s *QUICServer) handleStream(stream quic.Stream) {
 		s.handleStreamForwardRequest(stream, msg)
 	case protocol.MessageTypeQueryExitKeys:
 		entries := s.registry.ListExitKeys()
-		resp, err := protocol.NewExitKeysResponseMessage(entries)
+		resp, err := protocol.NewExitKeysResponseMessageFor(entries, protocol.AcceptedExitKeysEncodings(msg))
 		if err != nil {
-			log.Printf("序列化 Exit 公钥列表失败: %v", err)
-			errMsg := protocol.NewErrorMessage("failed to serialize exit keys")
-			stream.Write(errMsg.Encode())
+			s.logger.Error("序列化 Exit 公钥列表失败", logging.KeyError, err)
+			errMsg := protocol.NewErrorMessage(protocol.ErrSerializeExitKeys)
+			protocol.WriteMessage(stream, errMsg)
 			return
 		}
-		stream.Write(resp.Encode())
+		protocol.WriteMessage(stream, resp)
+	case protocol.MessageTypeQueryExitModels:
+		resp, err := protocol.NewExitModelsResponseMessage(s.registry.ExitModels())
+		if err != nil {
+			s.logger.Error("序列化 Exit 模型列表失败", logging.KeyError, err)
+			protocol.WriteMessage(stream, protocol.NewErrorMessage(protocol.ErrSerializeExitModels))
+			return
+		}
+		protocol.WriteMessage(stream, resp)
+	case protocol.MessageTypeStatus:
+		s.handleStatus(stream)
+	case protocol.MessageTypeHeartbeat:
+		// Client 空闲连接探活
+		protocol.WriteMessage(stream, protocol.NewHeartbeatAckMessage())
 	default:
-		log.Printf("无效的消息类型: %d", msg.Type)
-		errMsg := protocol.NewErrorMessage("invalid message type")
-		stream.Write(errMsg.Encode())
+		s.logger.Warn("无效的消息类型", "message_type", msg.Type)
+		errMsg := protocol.NewErrorMessage(protocol.ErrInvalidMessageType)
+		protocol.WriteMessage(stream, errMsg)
 	}
 }
 
+// handleStatus 返回 Relay 运行时间和已注册 Exit 的状态
+func (s *QUICServer) handleStatus(stream quic.Stream) {
+	now := time.Now()
+	status := &protocol.RelayStatus{Exits: s.registry.ExitStatuses(now)}
+	if !s.startedAt.IsZero() {
+		status.UptimeMs = now.Sub(s.startedAt).Milliseconds()
+	}
+	resp, err := protocol.NewStatusResponseMessage(status)
+	if err != nil {
+		s.logger.Error("序列化 Relay 状态失败", logging.KeyError, err)
+		protocol.WriteMessage(stream, protocol.NewErrorMessage(protocol.ErrSerializeStatus))
+		return
+	}
+	protocol.WriteMessage(stream, resp)
+}
+
 // handleForwardRequest 处理转发请求（通过反向隧道转发到 Exit）
 func (s *QUICServer) handleForwardRequest(stream quic.Stream, msg *protocol.Message) {
+	start := time.Now()
+	ok := false
+	defer func() { s.observeForward(start, ok) }()
+
 	// 验证目标地址（pubKeyHash）
 	if msg.Target == "" {
-		log.Printf("请求缺少目标地址")
-		errMsg := protocol.NewErrorMessage("missing target address")
-		stream.Write(errMsg.Encode())
+		s.logger.Warn("请求缺少目标地址")
+		errMsg := protocol.NewErrorMessage(protocol.ErrMissingTarget)
+		protocol.WriteMessage(stream, errMsg)
 		return
 	}
 
-	// 从 registry 查找 Exit 连接
-	exitConn, ok := s.registry.Lookup(msg.Target)
-	if !ok {
-		log.Printf("Exit %s 未注册或已断开", msg.Target)
-		errMsg := protocol.NewErrorMessage("exit not found")
-		stream.Write(errMsg.Encode())
+	// 从 registry 查找 Exit 连接（同一 pubKeyHash 有多个实例时轮询）
+	exitConns := s.registry.LookupAll(msg.Target)
+	if len(exitConns) == 0 {
+		s.writeExitUnavailable(stream, msg.Target)
 		return
 	}
 
 	// 在 Exit 连接上打开新流（使用带超时的 context，避免客户端断开后阻塞）
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Client 携带截止时间时，到期后中断 Exit 流，不再占用 Exit
+	ctx, cancel, bounded := s.exitStreamContext(msg)
 	defer cancel()
 
-	exitStream, err := exitConn.OpenStreamSync(ctx)
+	exitStream, release, err := s.openExitStream(ctx, msg.Target, exitConns)
 	if err != nil {
-		log.Printf("打开 Exit %s 流失败: %v", msg.Target, err)
-		// Exit 连接可能已断开，只移除匹配的连接（避免 TOCTOU 竞争）
-		s.registry.RemoveIfMatch(msg.Target, exitConn)
-		errMsg := protocol.NewErrorMessage("exit connection failed")
-		stream.Write(errMsg.Encode())
+		s.writeOpenExitError(stream, msg.Target, err)
 		return
 	}
+	defer release()
 	defer exitStream.Close()
+	if bounded {
+		defer cancelExitStreamOnDone(ctx, exitStream)()
+	}
 
 	// 写入 Request 消息到 Exit（Target 为空，Payload 为 OHTTP 数据）
 	reqMsg := protocol.NewRequestMessage("", msg.Payload)
-	if _, err := exitStream.Write(reqMsg.Encode()); err != nil {
-		log.Printf("写入 Exit %s 请求失败: %v", msg.Target, err)
-		errMsg := protocol.NewErrorMessage("write to exit failed")
-		stream.Write(errMsg.Encode())
+	if err := protocol.WriteMessage(exitStream, reqMsg); err != nil {
+		s.logger.Warn("写入 Exit 请求失败", logging.KeyExitHash, msg.Target, logging.KeyError, err)
+		errMsg := protocol.NewErrorMessage(protocol.ErrWriteToExitFailed)
+		protocol.WriteMessage(stream, errMsg)
 		return
 	}
 
 	// 从 Exit 流读取响应消息
 	respMsg, err := protocol.Decode(exitStream)
 	if err != nil {
-		log.Printf("读取 Exit %s 响应失败: %v", msg.Target, err)
-		errMsg := protocol.NewErrorMessage("read exit response failed")
-		stream.Write(errMsg.Encode())
+		s.logger.Warn("读取 Exit 响应失败", logging.KeyExitHash, msg.Target, logging.KeyError, err)
+		errMsg := protocol.NewErrorMessage(protocol.ErrReadExitResponse)
+		protocol.WriteMessage(stream, errMsg)
 		return
 	}
 
 	// 将响应写回 Client 流
-	if _, err := stream.Write(respMsg.Encode()); err != nil {
-		log.Printf("写入客户端响应失败: %v", err)
+	if err := protocol.WriteMessage(stream, respMsg); err != nil {
+		s.logger.Warn("写入客户端响应失败", logging.KeyExitHash, msg.Target, logging.KeyError, err)
+	} else {
+		ok = respMsg.Type != protocol.MessageTypeError
+	}
+	s.accounting.Record(msg.Tenant, len(msg.Payload), len(respMsg.Payload))
+}
+
+// observeForward 记录一次转发的次数、失败数和耗时
+func (s *QUICServer) observeForward(start time.Time, ok bool) {
+	s.metrics.Count(metrics.RelayForwardTotal, 1)
+	if !ok {
+		s.metrics.Count(metrics.RelayForwardErrors, 1)
 	}
+	s.metrics.Timing(metrics.RelayForwardDuration, time.Since(start))
+}
+
+// errExitBusy Exit 的所有实例连接均已达到通告的并发请求流上限
+var errExitBusy = errors.New("exit busy")
+
+// openExitStream 依次在 Exit 的各实例连接上打开流，打开失败的连接标记为断开后尝试下一个
+// 已达并发上限的连接直接跳过；全部连接均已满时返回 errExitBusy，成功时返回的 release 需在流结束后调用
+func (s *QUICServer) openExitStream(ctx context.Context, target string, conns []quic.Connection) (quic.Stream, func(), error) {
+	lastErr := errExitBusy
+	for _, conn := range conns {
+		release, ok := s.registry.AcquireStream(target, conn)
+		if !ok {
+			continue
+		}
+		exitStream, err := conn.OpenStreamSync(ctx)
+		if err == nil {
+			return exitStream, release, nil
+		}
+		release()
+		s.logger.Warn("打开 Exit 流失败", logging.KeyExitHash, target, logging.KeyRemote, conn.RemoteAddr().String(), logging.KeyError, err)
+		// Exit 连接可能已断开，只标记匹配的连接（避免 TOCTOU 竞争）
+		s.registry.MarkDisconnected(target, conn)
+		lastErr = err
+	}
+	return nil, nil, lastErr
+}
+
+// writeOpenExitError 返回打开 Exit 流失败的错误，并发上限已满时返回 "too many requests"
+func (s *QUICServer) writeOpenExitError(stream quic.Stream, target string, err error) {
+	reason := protocol.ErrExitConnectionFailed
+	if errors.Is(err, errExitBusy) {
+		s.logger.Warn("Exit 并发请求流已达上限", logging.KeyExitHash, target)
+		reason = protocol.ErrTooManyRequests
+	}
+	protocol.WriteMessage(stream, protocol.NewErrorMessage(reason))
+}
+
+// writeExitUnavailable 返回 Exit 不可用错误，区分重连宽限期与未注册
+func (s *QUICServer) writeExitUnavailable(stream quic.Stream, target string) {
+	reason := protocol.ErrExitNotFound
+	if s.registry.IsReconnecting(target) {
+		s.logger.Info("Exit 正在重连", logging.KeyExitHash, target)
+		reason = protocol.ErrExitReconnecting
+	} else {
+		s.logger.Info("Exit 未注册或已断开", logging.KeyExitHash, target)
+	}
+	protocol.WriteMessage(stream, protocol.NewErrorMessage(reason))
 }
 
 // handleStreamForwardRequest 处理流式转发请求（通过反向隧道）
 func (s *QUICServer) handleStreamForwardRequest(stream quic.Stream, msg *protocol.Message) {
+	start := time.Now()
+	ok := false
+	defer func() { s.observeForward(start, ok) }()
+
 	if msg.Target == "" {
-		log.Printf("流式请求缺少目标地址")
-		errMsg := protocol.NewErrorMessage("missing target address")
-		stream.Write(errMsg.Encode())
+		s.logger.Warn("流式请求缺少目标地址")
+		errMsg := protocol.NewErrorMessage(protocol.ErrMissingTarget)
+		protocol.WriteMessage(stream, errMsg)
 		return
 	}
 
-	// 从 registry 查找 Exit 连接
-	exitConn, ok := s.registry.Lookup(msg.Target)
-	if !ok {
-		log.Printf("Exit %s 未注册或已断开", msg.Target)
-		errMsg := protocol.NewErrorMessage("exit not found")
-		stream.Write(errMsg.Encode())
+	// 从 registry 查找 Exit 连接（同一 pubKeyHash 有多个实例时轮询）
+	exitConns := s.registry.LookupAll(msg.Target)
+	if len(exitConns) == 0 {
+		s.writeExitUnavailable(stream, msg.Target)
 		return
 	}
 
 	// 在 Exit 连接上打开新流（使用带超时的 context，避免客户端断开后阻塞）
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Client 携带截止时间时，到期后中断 Exit 流，不再占用 Exit
+	ctx, cancel, bounded := s.exitStreamContext(msg)
 	defer cancel()
 
-	exitStream, err := exitConn.OpenStreamSync(ctx)
+	exitStream, release, err := s.openExitStream(ctx, msg.Target, exitConns)
 	if err != nil {
-		log.Printf("打开 Exit %s 流失败: %v", msg.Target, err)
-		// Exit 连接可能已断开，只移除匹配的连接（避免 TOCTOU 竞争）
-		s.registry.RemoveIfMatch(msg.Target, exitConn)
-		errMsg := protocol.NewErrorMessage("exit connection failed")
-		stream.Write(errMsg.Encode())
+		s.writeOpenExitError(stream, msg.Target, err)
 		return
 	}
+	defer release()
 	defer exitStream.Close()
+	if bounded {
+		defer cancelExitStreamOnDone(ctx, exitStream)()
+	}
 
 	// 写入 StreamRequest 消息到 Exit（Target 为空，Payload 为 OHTTP 数据）
 	reqMsg := protocol.NewStreamRequestMessage("", msg.Payload)
-	if _, err := exitStream.Write(reqMsg.Encode()); err != nil {
-		log.Printf("写入 Exit %s 流式请求失败: %v", msg.Target, err)
-		errMsg := protocol.NewErrorMessage("write to exit failed")
-		stream.Write(errMsg.Encode())
+	if err := protocol.WriteMessage(exitStream, reqMsg); err != nil {
+		s.logger.Warn("写入 Exit 流式请求失败", logging.KeyExitHash, msg.Target, logging.KeyError, err)
+		errMsg := protocol.NewErrorMessage(protocol.ErrWriteToExitFailed)
+		protocol.WriteMessage(stream, errMsg)
 		return
 	}
 
+	// 上行转发：Client 分块上传请求体时，将后续的 RequestChunk/RequestEnd 原样转发给 Exit
+	// 不上传请求体的 Client 发送 StreamRequest 后立即关闭写入端，上行转发随即结束
+	bytesOut := 0
+	var bytesUp atomic.Int64
+	defer func() { s.accounting.Record(msg.Tenant, len(msg.Payload)+int(bytesUp.Load()), bytesOut) }()
+	upDone := make(chan struct{})
+	go func() {
+		defer close(upDone)
+		s.pipeRequestBody(stream, exitStream, &bytesUp)
+	}()
+	defer func() {
+		// 响应已结束但上传未完成 (如后端提前返回错误): 中断上行，避免阻塞在 Client 或 Exit 流上
+		select {
+		case <-upDone:
+		default:
+			stream.CancelRead(0)
+			exitStream.CancelWrite(0)
+			<-upDone
+		}
+	}()
+
 	// 管道式转发：从 Exit 流读取 StreamChunk/StreamEnd，逐个写回 Client 流
 	for {
 		chunkMsg, err := protocol.Decode(exitStream)
 		if err != nil {
 			if err != io.EOF {
-				log.Printf("读取 Exit %s 流式响应失败: %v", msg.Target, err)
+				s.logger.Warn("读取 Exit 流式响应失败", logging.KeyExitHash, msg.Target, logging.KeyError, err)
 			}
 			return
 		}
 
 		// 将消息直接写回 Client 流
-		if _, err := stream.Write(chunkMsg.Encode()); err != nil {
-			log.Printf("写入客户端流式响应失败: %v", err)
+		bytesOut += len(chunkMsg.Payload)
+		if err := protocol.WriteMessage(stream, chunkMsg); err != nil {
+			s.logger.Warn("写入客户端流式响应失败", logging.KeyExitHash, msg.Target, logging.KeyError, err)
 			return
 		}
 
-		// 如果是 StreamEnd 或 Error，结束转发
+		// 如果是 StreamEnd 或 Error，结束转发；Exit 之后发送的任何数据均被丢弃，不会到达 Client
 		if chunkMsg.Type == protocol.MessageTypeStreamEnd || chunkMsg.Type == protocol.MessageTypeError {
+			ok = chunkMsg.Type == protocol.MessageTypeStreamEnd
+			exitStream.CancelRead(0)
+			return
+		}
+	}
+}
+
+// pipeRequestBody 将 Client 分块上传的请求体消息转发给 Exit，直到 RequestEnd 或 Client 关闭写入端
+// 请求体块已由 Client 端到端加密，Relay 只做转发，uploaded 累计转发的负载字节数
+func (s *QUICServer) pipeRequestBody(stream, exitStream quic.Stream, uploaded *atomic.Int64) {
+	for {
+		// 读写失败时上传已中断，Exit 校验不到 RequestEnd 会拒绝不完整的请求体，无需在此回报
+		m, err := protocol.Decode(stream)
+		if err != nil {
+			return
+		}
+		if m.Type != protocol.MessageTypeRequestChunk && m.Type != protocol.MessageTypeRequestEnd {
+			s.logger.Warn("流式请求中收到无效的上行消息", "message_type", m.Type)
 			return
 		}
+
+		uploaded.Add(int64(len(m.Payload)))
+		if err := protocol.WriteMessage(exitStream, m); err != nil {
+			return
+		}
+		if m.Type == protocol.MessageTypeRequestEnd {
+			return
+		}
+	}
+}
+
+// beginStream 登记一个活跃的 Client 流，排空期间返回 false
+func (s *QUICServer) beginStream() bool {
+	s.streamMu.Lock()
+	defer s.streamMu.Unlock()
+	if s.draining {
+		return false
+	}
+	s.activeStreams++
+	return true
+}
+
+// endStream 注销活跃流，排空期间最后一个流结束时通知 Drain
+func (s *QUICServer) endStream() {
+	s.streamMu.Lock()
+	defer s.streamMu.Unlock()
+	s.activeStreams--
+	if s.activeStreams == 0 && s.drained != nil {
+		close(s.drained)
+		s.drained = nil
+	}
+}
+
+// Drain 优雅关闭: 拒绝新的 Client 流，通知已注册的 Exit，等待进行中的流完成后关闭服务器
+// ctx 到期时不再等待，直接关闭 (剩余的流被中断)
+func (s *QUICServer) Drain(ctx context.Context) error {
+	s.streamMu.Lock()
+	s.draining = true
+	active := s.activeStreams
+	var drained chan struct{}
+	if active > 0 {
+		if s.drained == nil {
+			s.drained = make(chan struct{})
+		}
+		drained = s.drained
+	}
+	s.streamMu.Unlock()
+
+	s.logger.Info("Relay 开始排空: 拒绝新请求，等待进行中的请求完成", "active_streams", active)
+	s.notifyExitsDraining(ctx)
+
+	var drainErr error
+	if drained != nil {
+		select {
+		case <-drained:
+			s.logger.Info("进行中的请求已全部完成")
+		case <-ctx.Done():
+			drainErr = fmt.Errorf("等待进行中的请求完成超时: %w", ctx.Err())
+		}
+	}
+
+	return errors.Join(drainErr, s.Stop())
+}
+
+// notifyExitsDraining 向所有在线 Exit 发送排空通知
+func (s *QUICServer) notifyExitsDraining(ctx context.Context) {
+	msg := protocol.NewDrainMessage()
+	for pubKeyHash, conns := range s.registry.OnlineConns() {
+		for _, conn := range conns {
+			stream, err := conn.OpenStreamSync(ctx)
+			if err != nil {
+				s.logger.Warn("打开排空通知流失败", logging.KeyExitHash, pubKeyHash, logging.KeyError, err)
+				continue
+			}
+			if err := protocol.WriteMessage(stream, msg); err != nil {
+				s.logger.Warn("发送排空通知失败", logging.KeyExitHash, pubKeyHash, logging.KeyError, err)
+			}
+			stream.Close()
+		}
 	}
 }
 
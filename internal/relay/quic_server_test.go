@@ -2,9 +2,18 @@ package relay
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/binn/tokengo/internal/logging"
+	"github.com/binn/tokengo/internal/metrics"
 	"github.com/binn/tokengo/internal/protocol"
 	"github.com/binn/tokengo/internal/testutil"
 )
@@ -14,8 +23,11 @@ func setupServerWithRegistry(t *testing.T) (*QUICServer, *Registry) {
 	t.Helper()
 	registry := NewRegistry()
 	server := &QUICServer{
-		registry: registry,
-		ready:    make(chan struct{}),
+		registry:   registry,
+		accounting: NewAccounting(),
+		metrics:    metrics.Nop{},
+		logger:     logging.New("relay"),
+		ready:      make(chan struct{}),
 	}
 	return server, registry
 }
@@ -70,7 +82,7 @@ func TestHandleStream_Request(t *testing.T) {
 	}()
 
 	// Server 侧：处理流
-	server.handleStream(serverStream)
+	server.handleStream(serverStream, "")
 
 	if err := <-errCh; err != nil {
 		t.Fatalf("Client side failed: %v", err)
@@ -144,7 +156,7 @@ func TestHandleStream_StreamRequest(t *testing.T) {
 		resultCh <- streamResult{msgs: msgs}
 	}()
 
-	server.handleStream(serverStream)
+	server.handleStream(serverStream, "")
 
 	result := <-resultCh
 	if result.err != nil {
@@ -169,6 +181,65 @@ func TestHandleStream_StreamRequest(t *testing.T) {
 	}
 }
 
+func TestHandleStream_StreamRequestDropsDataAfterEnd(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	exitConn := testutil.NewMockConn(1)
+	registry.Register("exit-hash-1", exitConn, []byte("keyconfig"))
+
+	exitClient, exitServer := testutil.NewStreamPair()
+	exitConn.PushOpenStream(exitClient)
+
+	// Exit 在 StreamEnd 之后继续发送数据 (协议违规)
+	lateErr := make(chan error, 1)
+	go func() {
+		if _, err := protocol.Decode(exitServer); err != nil {
+			lateErr <- err
+			return
+		}
+		exitServer.Write(protocol.NewStreamChunkMessage([]byte("chunk-1")).Encode())
+		exitServer.Write(protocol.NewStreamEndMessage().Encode())
+		_, err := exitServer.Write(protocol.NewStreamChunkMessage([]byte("late")).Encode())
+		lateErr <- err
+	}()
+
+	clientStream, serverStream := testutil.NewStreamPair()
+
+	msgsCh := make(chan []*protocol.Message, 1)
+	go func() {
+		reqMsg := protocol.NewStreamRequestMessage("exit-hash-1", []byte("encrypted-stream-req"))
+		clientStream.Write(reqMsg.Encode())
+		clientStream.Close()
+
+		var msgs []*protocol.Message
+		for {
+			msg, err := protocol.Decode(clientStream)
+			if err != nil {
+				msgsCh <- msgs
+				return
+			}
+			msgs = append(msgs, msg)
+		}
+	}()
+
+	server.handleStream(serverStream, "")
+	serverStream.Close()
+
+	msgs := <-msgsCh
+	if len(msgs) != 2 || msgs[0].Type != protocol.MessageTypeStreamChunk || msgs[1].Type != protocol.MessageTypeStreamEnd {
+		t.Fatalf("client received %d messages, want chunk + end only", len(msgs))
+	}
+
+	select {
+	case err := <-lateErr:
+		if err == nil {
+			t.Error("write after StreamEnd should fail once the relay stops reading")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("exit write after StreamEnd blocked; relay did not stop reading")
+	}
+}
+
 func TestHandleStream_QueryExitKeys(t *testing.T) {
 	server, registry := setupServerWithRegistry(t)
 
@@ -196,7 +267,7 @@ func TestHandleStream_QueryExitKeys(t *testing.T) {
 		errCh <- nil
 	}()
 
-	server.handleStream(serverStream)
+	server.handleStream(serverStream, "")
 
 	if err := <-errCh; err != nil {
 		t.Fatalf("Client side failed: %v", err)
@@ -215,6 +286,94 @@ func TestHandleStream_QueryExitKeys(t *testing.T) {
 	}
 }
 
+func TestHandleStream_QueryExitModels(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	registry.RegisterWithMetadata("hash-A", testutil.NewMockConn(1), []byte("kc-A"), protocol.ExitMetadata{Models: []string{"gpt-4o", "llama3*"}})
+	registry.Register("hash-B", testutil.NewMockConn(2), []byte("kc-B"))
+
+	clientStream, serverStream := testutil.NewStreamPair()
+	go func() {
+		protocol.WriteMessage(clientStream, protocol.NewQueryExitModelsMessage())
+		clientStream.Close()
+	}()
+	respCh := make(chan *protocol.Message, 1)
+	go func() {
+		msg, err := protocol.Decode(clientStream)
+		if err != nil {
+			t.Errorf("reading response failed: %v", err)
+		}
+		respCh <- msg
+	}()
+
+	server.handleStream(serverStream, "")
+
+	respMsg := <-respCh
+	if respMsg == nil {
+		t.FailNow()
+	}
+	if respMsg.Type != protocol.MessageTypeExitModelsResponse {
+		t.Fatalf("type = 0x%02x, want ExitModelsResponse", respMsg.Type)
+	}
+	models, err := protocol.DecodeExitModelsResponse(respMsg.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未通告模型的 Exit 不列出
+	if len(models) != 1 || !slices.Equal(models["hash-A"], []string{"gpt-4o", "llama3*"}) {
+		t.Errorf("models = %v, want only hash-A", models)
+	}
+}
+
+func TestHandleStream_QueryExitKeysCompressed(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	// 大量 Exit 使响应超过压缩阈值
+	const exits = 100
+	for i := 0; i < exits; i++ {
+		registry.Register(fmt.Sprintf("hash-%03d", i), testutil.NewMockConn(i), bytes.Repeat([]byte{byte(i)}, 41))
+	}
+
+	clientStream, serverStream := testutil.NewStreamPair()
+
+	var respMsg *protocol.Message
+	errCh := make(chan error, 1)
+	go func() {
+		queryMsg := protocol.NewQueryExitKeysMessage(protocol.ExitKeysEncodingGzip)
+		if _, err := clientStream.Write(queryMsg.Encode()); err != nil {
+			errCh <- err
+			return
+		}
+		clientStream.Close()
+
+		msg, err := protocol.Decode(clientStream)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		respMsg = msg
+		errCh <- nil
+	}()
+
+	server.handleStream(serverStream, "")
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Client side failed: %v", err)
+	}
+
+	var plain []protocol.ExitKeyEntry
+	if json.Unmarshal(respMsg.Payload, &plain) == nil {
+		t.Error("payload should be compressed for a gzip-capable client")
+	}
+	entries, err := protocol.DecodeExitKeysResponse(respMsg.Payload)
+	if err != nil {
+		t.Fatalf("DecodeExitKeysResponse failed: %v", err)
+	}
+	if len(entries) != exits {
+		t.Fatalf("expected %d entries, got %d", exits, len(entries))
+	}
+}
+
 func TestHandleStream_InvalidType(t *testing.T) {
 	server, _ := setupServerWithRegistry(t)
 
@@ -223,7 +382,7 @@ func TestHandleStream_InvalidType(t *testing.T) {
 	var respMsg *protocol.Message
 	errCh := make(chan error, 1)
 	go func() {
-		unknownMsg := &protocol.Message{Type: protocol.MessageTypeHeartbeat}
+		unknownMsg := &protocol.Message{Type: protocol.MessageType(0x7E)}
 		if _, err := clientStream.Write(unknownMsg.Encode()); err != nil {
 			errCh <- err
 			return
@@ -239,7 +398,7 @@ func TestHandleStream_InvalidType(t *testing.T) {
 		errCh <- nil
 	}()
 
-	server.handleStream(serverStream)
+	server.handleStream(serverStream, "")
 
 	if err := <-errCh; err != nil {
 		t.Fatalf("Client side failed: %v", err)
@@ -249,6 +408,133 @@ func TestHandleStream_InvalidType(t *testing.T) {
 	}
 }
 
+func TestHandleStream_UnsupportedVersion(t *testing.T) {
+	server, _ := setupServerWithRegistry(t)
+
+	clientStream, serverStream := testutil.NewStreamPair()
+
+	var respMsg *protocol.Message
+	errCh := make(chan error, 1)
+	go func() {
+		futureMsg := &protocol.Message{
+			Type:    protocol.MessageTypeRequest,
+			Version: protocol.ProtocolVersion + 1,
+			Target:  "exit-hash-1",
+		}
+		// 服务端读到版本号即停止读取，写入放到独立 goroutine 避免同步管道阻塞
+		go func() {
+			clientStream.Write(futureMsg.Encode())
+			clientStream.Close()
+		}()
+
+		msg, err := protocol.Decode(clientStream)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		respMsg = msg
+		errCh <- nil
+	}()
+
+	server.handleStream(serverStream, "")
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Client side failed: %v", err)
+	}
+	if respMsg.Type != protocol.MessageTypeError {
+		t.Fatalf("type = 0x%02x, want Error", respMsg.Type)
+	}
+	if string(respMsg.Payload) != protocol.ErrIncompatibleVersion {
+		t.Errorf("payload = %q, want %q", respMsg.Payload, protocol.ErrIncompatibleVersion)
+	}
+}
+
+func TestHandleStream_ClientHeartbeat(t *testing.T) {
+	server, _ := setupServerWithRegistry(t)
+
+	clientStream, serverStream := testutil.NewStreamPair()
+
+	var respMsg *protocol.Message
+	errCh := make(chan error, 1)
+	go func() {
+		if _, err := clientStream.Write(protocol.NewHeartbeatMessage().Encode()); err != nil {
+			errCh <- err
+			return
+		}
+		clientStream.Close()
+
+		msg, err := protocol.Decode(clientStream)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		respMsg = msg
+		errCh <- nil
+	}()
+
+	server.handleStream(serverStream, "")
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Client side failed: %v", err)
+	}
+	if respMsg.Type != protocol.MessageTypeHeartbeatAck {
+		t.Errorf("type = 0x%02x, want HeartbeatAck", respMsg.Type)
+	}
+}
+
+func TestHandleStream_RateLimited(t *testing.T) {
+	server, _ := setupServerWithRegistry(t)
+	server.SetClientRateLimit(1, 2)
+
+	// roundTrip 以 remote 的身份发送一条消息并返回 Relay 的响应
+	roundTrip := func(msg *protocol.Message, remote string) *protocol.Message {
+		t.Helper()
+		clientStream, serverStream := testutil.NewStreamPair()
+		respCh := make(chan *protocol.Message, 1)
+		go func() {
+			clientStream.Write(msg.Encode())
+			clientStream.Close()
+			resp, err := protocol.Decode(clientStream)
+			if err != nil {
+				t.Errorf("reading response failed: %v", err)
+			}
+			respCh <- resp
+		}()
+		server.handleStream(serverStream, remote)
+		resp := <-respCh
+		if resp == nil {
+			t.FailNow()
+		}
+		return resp
+	}
+	request := protocol.NewRequestMessage("unknown-exit", []byte("payload"))
+
+	// 突发配额内的请求照常转发 (目标 Exit 不存在)
+	for i := 0; i < 2; i++ {
+		if resp := roundTrip(request, "192.0.2.1"); string(resp.Payload) != protocol.ErrExitNotFound {
+			t.Fatalf("request %d = %q, want %q", i, resp.Payload, protocol.ErrExitNotFound)
+		}
+	}
+	resp := roundTrip(request, "192.0.2.1")
+	if resp.Type != protocol.MessageTypeError || string(resp.Payload) != protocol.ErrRateLimited {
+		t.Errorf("request past the burst = 0x%02x %q, want %q", resp.Type, resp.Payload, protocol.ErrRateLimited)
+	}
+
+	// 探活不计入限流，其他来源地址不受影响
+	if resp := roundTrip(protocol.NewHeartbeatMessage(), "192.0.2.1"); resp.Type != protocol.MessageTypeHeartbeatAck {
+		t.Errorf("heartbeat = 0x%02x, want HeartbeatAck", resp.Type)
+	}
+	if resp := roundTrip(request, "192.0.2.2"); string(resp.Payload) == protocol.ErrRateLimited {
+		t.Error("another source address should not be rate limited")
+	}
+
+	// 令牌补充后恢复
+	time.Sleep(1100 * time.Millisecond)
+	if resp := roundTrip(request, "192.0.2.1"); string(resp.Payload) == protocol.ErrRateLimited {
+		t.Error("request after the refill window should not be rate limited")
+	}
+}
+
 func TestHandleStream_MissingTarget(t *testing.T) {
 	server, _ := setupServerWithRegistry(t)
 
@@ -273,7 +559,7 @@ func TestHandleStream_MissingTarget(t *testing.T) {
 		errCh <- nil
 	}()
 
-	server.handleStream(serverStream)
+	server.handleStream(serverStream, "")
 
 	if err := <-errCh; err != nil {
 		t.Fatalf("Client side failed: %v", err)
@@ -310,7 +596,7 @@ func TestHandleStream_ExitNotFound(t *testing.T) {
 		errCh <- nil
 	}()
 
-	server.handleStream(serverStream)
+	server.handleStream(serverStream, "")
 
 	if err := <-errCh; err != nil {
 		t.Fatalf("Client side failed: %v", err)
@@ -360,6 +646,59 @@ func TestHandleExitConnection_Registration(t *testing.T) {
 	}
 }
 
+func TestHandleExitConnection_RegistrationWithMetadata(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	exitConn := testutil.NewMockConnWithALPN(1, "tokengo-exit")
+	regClient, regServer := testutil.NewStreamPair()
+	exitConn.PushAcceptStream(regServer)
+
+	var entries []protocol.ExitKeyEntry
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		payload := protocol.EncodeRegisterPayload([]byte("test-keyconfig"), protocol.ExitMetadata{
+			Capabilities:   []string{protocol.CapabilityEmbeddings},
+			RequestTimeout: 3 * time.Minute,
+			Weight:         4,
+			Models:         []string{"nomic-embed*"},
+		})
+		regClient.Write(protocol.NewRegisterMessage("test-exit-hash", payload).Encode())
+		if _, err := protocol.Decode(regClient); err != nil {
+			t.Errorf("reading RegisterAck failed: %v", err)
+		}
+
+		// RegisterAck 先于注册发送，等待注册表更新
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if entries = registry.ListExitKeys(); len(entries) > 0 {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		exitConn.CloseWithError(0, "test done")
+	}()
+
+	server.handleExitConnection(exitConn.Context(), exitConn)
+	<-done
+
+	if len(entries) != 1 {
+		t.Fatalf("ListExitKeys = %d entries, want 1", len(entries))
+	}
+	if string(entries[0].KeyConfig) != "test-keyconfig" {
+		t.Errorf("KeyConfig = %q, want capability footer stripped", entries[0].KeyConfig)
+	}
+	if len(entries[0].Capabilities) != 1 || entries[0].Capabilities[0] != protocol.CapabilityEmbeddings {
+		t.Errorf("Capabilities = %v, want [embeddings]", entries[0].Capabilities)
+	}
+	if entries[0].RequestTimeout() != 3*time.Minute {
+		t.Errorf("RequestTimeout = %v, want 3m", entries[0].RequestTimeout())
+	}
+	if entries[0].Weight != 4 || len(entries[0].Models) != 1 || entries[0].Models[0] != "nomic-embed*" {
+		t.Errorf("Weight/Models = %d/%v, want 4/[nomic-embed*]", entries[0].Weight, entries[0].Models)
+	}
+}
+
 func TestHandleExitConnection_HeartbeatLoop(t *testing.T) {
 	server, registry := setupServerWithRegistry(t)
 
@@ -400,8 +739,8 @@ func TestHandleExitConnection_HeartbeatLoop(t *testing.T) {
 
 		// 验证心跳已更新（在 handleExitConnection 退出前检查）
 		registry.mu.RLock()
-		if entry, ok := registry.entries["hb-exit"]; ok {
-			if entry.LastHeartbeat.IsZero() {
+		if group, ok := registry.entries["hb-exit"]; ok {
+			if group.entries[0].LastHeartbeat.IsZero() {
 				t.Error("LastHeartbeat should be updated")
 			}
 		}
@@ -413,3 +752,615 @@ func TestHandleExitConnection_HeartbeatLoop(t *testing.T) {
 
 	server.handleExitConnection(exitConn.Context(), exitConn)
 }
+
+func TestHandleExitConnection_DrainRemovesInstance(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	// Exit 回收连接时先注册新连接，再在旧连接上发送 Drain
+	newConn := testutil.NewMockConnWithALPN(2, "tokengo-exit")
+	registry.Register("drain-exit", newConn, []byte("kc"))
+
+	oldConn := testutil.NewMockConnWithALPN(1, "tokengo-exit")
+	regClient, regServer := testutil.NewStreamPair()
+	oldConn.PushAcceptStream(regServer)
+	drainClient, drainServer := testutil.NewStreamPair()
+	oldConn.PushAcceptStream(drainServer)
+
+	go func() {
+		defer oldConn.CloseWithError(0, "test done")
+
+		regClient.Write(protocol.NewRegisterMessage("drain-exit", []byte("kc")).Encode())
+		if _, err := protocol.Decode(regClient); err != nil {
+			t.Errorf("reading RegisterAck failed: %v", err)
+			return
+		}
+		if n := len(registry.LookupAll("drain-exit")); n != 2 {
+			t.Errorf("instances before drain = %d, want 2", n)
+		}
+
+		drainClient.Write(protocol.NewDrainMessage().Encode())
+		// Relay 处理完成后关闭流作为确认
+		if _, err := io.ReadAll(drainClient); err != nil {
+			t.Errorf("waiting for drain ack failed: %v", err)
+		}
+
+		conns := registry.LookupAll("drain-exit")
+		if len(conns) != 1 || conns[0] != newConn {
+			t.Errorf("after drain conns = %v, want only the new connection", conns)
+		}
+	}()
+
+	server.handleExitConnection(oldConn.Context(), oldConn)
+}
+
+func TestHandleExitConnection_UpdateModels(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	exitConn := testutil.NewMockConnWithALPN(1, "tokengo-exit")
+	regClient, regServer := testutil.NewStreamPair()
+	exitConn.PushAcceptStream(regServer)
+	updateClient, updateServer := testutil.NewStreamPair()
+	exitConn.PushAcceptStream(updateServer)
+
+	go func() {
+		defer exitConn.CloseWithError(0, "test done")
+
+		payload := protocol.EncodeRegisterPayload([]byte("kc"), protocol.ExitMetadata{Models: []string{"gpt-4o"}})
+		protocol.WriteMessage(regClient, protocol.NewRegisterMessage("models-exit", payload))
+		if _, err := protocol.Decode(regClient); err != nil {
+			t.Errorf("reading RegisterAck failed: %v", err)
+			return
+		}
+
+		msg, err := protocol.NewUpdateModelsMessage([]string{"gpt-4o", "gpt-4o-mini"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		protocol.WriteMessage(updateClient, msg)
+		// Relay 处理完成后关闭流作为确认
+		if _, err := io.ReadAll(updateClient); err != nil {
+			t.Errorf("waiting for update ack failed: %v", err)
+		}
+
+		keys := registry.ListExitKeys()
+		if len(keys) != 1 || !slices.Equal(keys[0].Models, []string{"gpt-4o", "gpt-4o-mini"}) {
+			t.Errorf("after update keys = %+v, want updated models", keys)
+		}
+	}()
+
+	server.handleExitConnection(exitConn.Context(), exitConn)
+}
+
+func TestHandleExitConnection_DatagramHeartbeat(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	exitConn := testutil.NewMockConnWithALPN(1, "tokengo-exit")
+	exitConn.EnableDatagrams()
+
+	regClient, regServer := testutil.NewStreamPair()
+	exitConn.PushAcceptStream(regServer)
+
+	lastHeartbeat := func() time.Time {
+		registry.mu.RLock()
+		defer registry.mu.RUnlock()
+		if group, ok := registry.entries["dg-exit"]; ok {
+			return group.entries[0].LastHeartbeat
+		}
+		return time.Time{}
+	}
+
+	go func() {
+		defer exitConn.CloseWithError(0, "test done")
+
+		regClient.Write(protocol.NewRegisterMessage("dg-exit", []byte("kc")).Encode())
+		if _, err := protocol.Decode(regClient); err != nil {
+			t.Errorf("reading RegisterAck failed: %v", err)
+			return
+		}
+
+		// RegisterAck 先于注册发送，等待注册表更新
+		deadline := time.Now().Add(2 * time.Second)
+		for lastHeartbeat().IsZero() && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		registered := lastHeartbeat()
+		if registered.IsZero() {
+			t.Error("exit not registered")
+			return
+		}
+
+		// 以 datagram 发送心跳，不打开流
+		time.Sleep(10 * time.Millisecond)
+		exitConn.PushDatagram(protocol.NewHeartbeatMessage().Encode())
+		for !lastHeartbeat().After(registered) {
+			if time.Now().After(deadline) {
+				t.Error("datagram heartbeat did not update LastHeartbeat")
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	server.handleExitConnection(exitConn.Context(), exitConn)
+}
+
+// sendClientRequest 模拟 Client 在新流上发送请求，返回读取到的响应消息
+func sendClientRequest(server *QUICServer, target string) <-chan *protocol.Message {
+	respCh := make(chan *protocol.Message, 1)
+	clientStream, serverStream := testutil.NewStreamPair()
+	go func() {
+		clientStream.Write(protocol.NewRequestMessage(target, []byte("payload")).Encode())
+		clientStream.Close()
+		msg, err := protocol.Decode(clientStream)
+		if err != nil {
+			msg = nil
+		}
+		respCh <- msg
+	}()
+	go server.handleStream(serverStream, "")
+	return respCh
+}
+
+func TestDrain_InFlightCompletesNewRefused(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	exitConn := testutil.NewMockConn(1)
+	registry.Register("exit-hash-1", exitConn, []byte("keyconfig"))
+
+	// 第一个流用于转发进行中的请求，第二个流接收排空通知
+	exitClient, exitServer := testutil.NewStreamPair()
+	exitConn.PushOpenStream(exitClient)
+	drainClient, drainServer := testutil.NewStreamPair()
+	exitConn.PushOpenStream(drainClient)
+
+	received := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		if _, err := protocol.Decode(exitServer); err != nil {
+			t.Errorf("Exit decode failed: %v", err)
+			return
+		}
+		close(received)
+		<-release
+		exitServer.Write(protocol.NewResponseMessage([]byte("slow-response")).Encode())
+		exitServer.Close()
+	}()
+
+	inFlight := sendClientRequest(server, "exit-hash-1")
+	<-received
+
+	drainDone := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		drainDone <- server.Drain(ctx)
+	}()
+
+	// Exit 收到排空通知
+	drainMsg, err := protocol.Decode(drainServer)
+	if err != nil {
+		t.Fatalf("读取排空通知失败: %v", err)
+	}
+	if drainMsg.Type != protocol.MessageTypeDrain {
+		t.Errorf("drain message type = 0x%02x, want Drain", drainMsg.Type)
+	}
+
+	// 排空期间的新请求被拒绝
+	refused := <-sendClientRequest(server, "exit-hash-1")
+	if refused == nil || refused.Type != protocol.MessageTypeError || string(refused.Payload) != protocol.ErrRelayDraining {
+		t.Fatalf("新请求应返回 %q 错误，got %+v", protocol.ErrRelayDraining, refused)
+	}
+
+	select {
+	case err := <-drainDone:
+		t.Fatalf("进行中的请求完成前 Drain 不应返回: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 进行中的请求正常完成
+	close(release)
+	resp := <-inFlight
+	if resp == nil || resp.Type != protocol.MessageTypeResponse || string(resp.Payload) != "slow-response" {
+		t.Fatalf("进行中的请求应正常完成，got %+v", resp)
+	}
+
+	select {
+	case err := <-drainDone:
+		if err != nil {
+			t.Errorf("Drain failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("请求完成后 Drain 应返回")
+	}
+}
+
+func TestDrain_DeadlineExceeded(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	exitConn := testutil.NewMockConn(1)
+	registry.Register("exit-hash-1", exitConn, []byte("keyconfig"))
+	exitClient, exitServer := testutil.NewStreamPair()
+	exitConn.PushOpenStream(exitClient)
+	drainClient, drainServer := testutil.NewStreamPair()
+	exitConn.PushOpenStream(drainClient)
+	go protocol.Decode(drainServer)
+
+	received := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	go func() {
+		protocol.Decode(exitServer)
+		close(received)
+		<-release
+		exitServer.Close()
+	}()
+
+	sendClientRequest(server, "exit-hash-1")
+	<-received
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain err = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestDrain_Idle(t *testing.T) {
+	server, _ := setupServerWithRegistry(t)
+
+	if err := server.Drain(context.Background()); err != nil {
+		t.Fatalf("空闲时 Drain 应立即返回: %v", err)
+	}
+
+	resp := <-sendClientRequest(server, "exit-hash-1")
+	if resp == nil || string(resp.Payload) != protocol.ErrRelayDraining {
+		t.Errorf("排空后的请求应被拒绝，got %+v", resp)
+	}
+}
+
+func TestHandleStream_TenantAccounting(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	exitConn := testutil.NewMockConn(1)
+	registry.Register("exit-hash-1", exitConn, []byte("keyconfig"))
+	exitClient, exitServer := testutil.NewStreamPair()
+	exitConn.PushOpenStream(exitClient)
+
+	// Exit 不应收到租户标识
+	go func() {
+		msg, err := protocol.Decode(exitServer)
+		if err != nil {
+			t.Errorf("Exit decode failed: %v", err)
+			return
+		}
+		if msg.Tenant != "" {
+			t.Errorf("Exit 收到租户标识 %q", msg.Tenant)
+		}
+		exitServer.Write(protocol.NewResponseMessage(make([]byte, 300)).Encode())
+		exitServer.Close()
+	}()
+
+	clientStream, serverStream := testutil.NewStreamPair()
+	done := make(chan error, 1)
+	go func() {
+		reqMsg := protocol.NewRequestMessage("exit-hash-1", make([]byte, 120))
+		reqMsg.Tenant = "team-a"
+		clientStream.Write(reqMsg.Encode())
+		clientStream.Close()
+		_, err := protocol.Decode(clientStream)
+		done <- err
+	}()
+
+	server.handleStream(serverStream, "")
+	if err := <-done; err != nil {
+		t.Fatalf("Client side failed: %v", err)
+	}
+
+	want := TenantUsage{Requests: 1, BytesIn: 120, BytesOut: 300}
+	if got := server.Accounting().Usage("team-a"); got != want {
+		t.Errorf("team-a usage = %+v, want %+v", got, want)
+	}
+}
+
+func TestHandleStream_TenantAccountingStream(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	exitConn := testutil.NewMockConn(1)
+	registry.Register("exit-hash-1", exitConn, []byte("keyconfig"))
+	exitClient, exitServer := testutil.NewStreamPair()
+	exitConn.PushOpenStream(exitClient)
+
+	go func() {
+		protocol.Decode(exitServer)
+		exitServer.Write(protocol.NewStreamChunkMessage(make([]byte, 40)).Encode())
+		exitServer.Write(protocol.NewStreamChunkMessage(make([]byte, 60)).Encode())
+		exitServer.Write(protocol.NewStreamEndMessage().Encode())
+		exitServer.Close()
+	}()
+
+	clientStream, serverStream := testutil.NewStreamPair()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reqMsg := protocol.NewStreamRequestMessage("exit-hash-1", make([]byte, 80))
+		reqMsg.Tenant = "team-b"
+		clientStream.Write(reqMsg.Encode())
+		clientStream.Close()
+		for {
+			msg, err := protocol.Decode(clientStream)
+			if err != nil || msg.Type == protocol.MessageTypeStreamEnd {
+				return
+			}
+		}
+	}()
+
+	server.handleStream(serverStream, "")
+	<-done
+
+	want := TenantUsage{Requests: 1, BytesIn: 80, BytesOut: 100}
+	if got := server.Accounting().Usage("team-b"); got != want {
+		t.Errorf("team-b usage = %+v, want %+v", got, want)
+	}
+}
+
+func TestHandleStream_StreamRequestPipesUploadChunks(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	exitConn := testutil.NewMockConn(1)
+	registry.Register("exit-hash-1", exitConn, []byte("keyconfig"))
+	exitClient, exitServer := testutil.NewStreamPair()
+	exitConn.PushOpenStream(exitClient)
+
+	// Exit 端: 读完请求体后才返回响应
+	exitGot := make(chan []*protocol.Message, 1)
+	go func() {
+		var msgs []*protocol.Message
+		defer func() { exitGot <- msgs }()
+		for {
+			msg, err := protocol.Decode(exitServer)
+			if err != nil {
+				t.Errorf("Exit decode failed: %v", err)
+				return
+			}
+			msgs = append(msgs, msg)
+			if msg.Type == protocol.MessageTypeRequestEnd {
+				break
+			}
+		}
+		exitServer.Write(protocol.NewStreamChunkMessage([]byte("ok")).Encode())
+		exitServer.Write(protocol.NewStreamEndMessage().Encode())
+		exitServer.Close()
+	}()
+
+	clientStream, serverStream := testutil.NewStreamPair()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reqMsg := protocol.NewStreamRequestMessage("exit-hash-1", make([]byte, 10))
+		reqMsg.Tenant = "team-u"
+		clientStream.Write(reqMsg.Encode())
+		clientStream.Write(protocol.NewRequestChunkMessage([]byte("part-1")).Encode())
+		clientStream.Write(protocol.NewRequestChunkMessage([]byte("part-2")).Encode())
+		clientStream.Write(protocol.NewRequestEndMessage([]byte("end")).Encode())
+		clientStream.Close()
+		for {
+			msg, err := protocol.Decode(clientStream)
+			if err != nil || msg.Type == protocol.MessageTypeStreamEnd {
+				return
+			}
+		}
+	}()
+
+	server.handleStream(serverStream, "")
+	<-done
+
+	msgs := <-exitGot
+	wantTypes := []protocol.MessageType{
+		protocol.MessageTypeStreamRequest,
+		protocol.MessageTypeRequestChunk,
+		protocol.MessageTypeRequestChunk,
+		protocol.MessageTypeRequestEnd,
+	}
+	if len(msgs) != len(wantTypes) {
+		t.Fatalf("Exit got %d messages, want %d", len(msgs), len(wantTypes))
+	}
+	for i, want := range wantTypes {
+		if msgs[i].Type != want {
+			t.Errorf("msg%d type = 0x%02x, want 0x%02x", i, msgs[i].Type, want)
+		}
+	}
+	if string(msgs[1].Payload) != "part-1" || string(msgs[2].Payload) != "part-2" {
+		t.Error("upload chunks forwarded out of order or modified")
+	}
+
+	want := TenantUsage{Requests: 1, BytesIn: 10 + 6 + 6 + 3, BytesOut: 2}
+	if got := server.Accounting().Usage("team-u"); got != want {
+		t.Errorf("team-u usage = %+v, want %+v", got, want)
+	}
+}
+
+func TestHandleStream_RequestRetriesNextExitInstance(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	// 同一 pubKeyHash 注册两个实例，轮询先选中的 dead 连接已断开
+	dead := testutil.NewMockConn(1)
+	live := testutil.NewMockConn(2)
+	registry.Register("exit-hash-1", dead, []byte("keyconfig"))
+	registry.Register("exit-hash-1", live, []byte("keyconfig"))
+	dead.CloseWithError(0, "gone")
+
+	exitClient, exitServer := testutil.NewStreamPair()
+	live.PushOpenStream(exitClient)
+	go func() {
+		if _, err := protocol.Decode(exitServer); err != nil {
+			t.Errorf("Exit decode failed: %v", err)
+			return
+		}
+		exitServer.Write(protocol.NewResponseMessage([]byte("encrypted-response")).Encode())
+		exitServer.Close()
+	}()
+
+	respMsg := <-sendClientRequest(server, "exit-hash-1")
+	if respMsg == nil || respMsg.Type != protocol.MessageTypeResponse {
+		t.Fatalf("response = %+v, want Response from the live instance", respMsg)
+	}
+
+	// 失败的实例被移除，其余实例继续服务
+	if all := registry.LookupAll("exit-hash-1"); len(all) != 1 || all[0] != live {
+		t.Errorf("LookupAll = %v, want only the live instance", all)
+	}
+}
+
+func TestHandleStream_RecordsForwardMetrics(t *testing.T) {
+	server, _ := setupServerWithRegistry(t)
+	sink := metrics.NewPrometheus("")
+	server.SetMetrics(sink)
+
+	// 目标 Exit 未注册，转发失败
+	clientStream, serverStream := testutil.NewStreamPair()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		clientStream.Write(protocol.NewRequestMessage("missing-exit", []byte("payload")).Encode())
+		clientStream.Close()
+		protocol.Decode(clientStream)
+	}()
+	server.handleStream(serverStream, "")
+	<-done
+
+	out := sink.Render()
+	for _, want := range []string{
+		"relay_forward_total 1\n",
+		"relay_forward_errors 1\n",
+		"relay_forward_duration_seconds_count 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHandleStream_MaxConcurrentStreams(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+
+	const limit = 2
+	exitConn := testutil.NewMockConn(1)
+	registry.RegisterWithMetadata("exit-hash-1", exitConn, []byte("keyconfig"), protocol.ExitMetadata{MaxConcurrentStreams: limit})
+
+	// Exit 读取请求后阻塞，直到 unblock 关闭
+	received := make(chan struct{}, limit)
+	unblock := make(chan struct{})
+	for i := 0; i < limit; i++ {
+		exitClient, exitServer := testutil.NewStreamPair()
+		exitConn.PushOpenStream(exitClient)
+		go func() {
+			if _, err := protocol.Decode(exitServer); err != nil {
+				t.Errorf("Exit decode failed: %v", err)
+				return
+			}
+			received <- struct{}{}
+			<-unblock
+			exitServer.Write(protocol.NewResponseMessage([]byte("encrypted-response")).Encode())
+			exitServer.Close()
+		}()
+	}
+
+	var inFlight []<-chan *protocol.Message
+	for i := 0; i < limit; i++ {
+		inFlight = append(inFlight, sendClientRequest(server, "exit-hash-1"))
+	}
+	for i := 0; i < limit; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("request did not reach Exit")
+		}
+	}
+
+	// 超出上限的请求立即返回错误，不在 Exit 上打开新流
+	select {
+	case respMsg := <-sendClientRequest(server, "exit-hash-1"):
+		if respMsg == nil || respMsg.Type != protocol.MessageTypeError || string(respMsg.Payload) != protocol.ErrTooManyRequests {
+			t.Errorf("excess response = %+v, want error %q", respMsg, protocol.ErrTooManyRequests)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("excess request should be rejected immediately")
+	}
+
+	close(unblock)
+	for _, ch := range inFlight {
+		if respMsg := <-ch; respMsg == nil || respMsg.Type != protocol.MessageTypeResponse {
+			t.Errorf("in-flight response = %+v, want Response", respMsg)
+		}
+	}
+}
+
+func TestHandleStream_ClientDeadlineCancelsExitStream(t *testing.T) {
+	server, registry := setupServerWithRegistry(t)
+	server.SetMaxRequestTimeout(time.Minute)
+
+	exitConn := testutil.NewMockConn(1)
+	registry.Register("exit-hash-1", exitConn, []byte("keyconfig"))
+	exitClient, exitServer := testutil.NewStreamPair()
+	exitConn.PushOpenStream(exitClient)
+
+	// Exit 收到请求后不响应，等待 Relay 中断流
+	exitCanceled := make(chan error, 1)
+	go func() {
+		msg, err := protocol.Decode(exitServer)
+		if err != nil {
+			t.Errorf("Exit decode failed: %v", err)
+			return
+		}
+		if !msg.Deadline.IsZero() {
+			t.Error("截止时间不应转发给 Exit")
+		}
+		_, err = io.ReadAll(exitServer)
+		exitCanceled <- err
+	}()
+
+	clientStream, serverStream := testutil.NewStreamPair()
+	respCh := make(chan *protocol.Message, 1)
+	go func() {
+		reqMsg := protocol.NewRequestMessage("exit-hash-1", []byte("payload"))
+		reqMsg.Deadline = time.Now().Add(100 * time.Millisecond)
+		clientStream.Write(reqMsg.Encode())
+		clientStream.Close()
+		msg, _ := protocol.Decode(clientStream)
+		respCh <- msg
+	}()
+	go server.handleStream(serverStream, "")
+
+	select {
+	case err := <-exitCanceled:
+		if err == nil {
+			t.Error("Exit 流应被中断，而不是正常结束")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Client 截止时间到期后 Exit 流未被中断")
+	}
+	if resp := <-respCh; resp == nil || resp.Type != protocol.MessageTypeError {
+		t.Errorf("Client 应收到错误消息，got %+v", resp)
+	}
+}
+
+func TestExitStreamContext(t *testing.T) {
+	server, _ := setupServerWithRegistry(t)
+	server.SetMaxRequestTimeout(time.Second)
+
+	// 未携带截止时间: 只限制打开流，不中断请求
+	_, cancel, bounded := server.exitStreamContext(&protocol.Message{})
+	cancel()
+	if bounded {
+		t.Error("未携带截止时间时不应限制 Exit 流")
+	}
+
+	// 截止时间超过上限时按上限截断
+	ctx, cancel, bounded := server.exitStreamContext(&protocol.Message{Deadline: time.Now().Add(time.Hour)})
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	if !bounded || time.Until(deadline) > time.Second {
+		t.Errorf("bounded = %v, deadline in %v, want at most max_request_timeout (1s)", bounded, time.Until(deadline))
+	}
+}
@@ -0,0 +1,88 @@
+package relay
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval 清理空闲令牌桶的间隔
+const rateLimitSweepInterval = time.Minute
+
+// RateLimiter 按 Client 来源地址的令牌桶限流
+// Client 匿名接入，来源 IP 是唯一可用的区分依据；同一 NAT 后的 Client 共享配额
+type RateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // 每秒补充的令牌数
+	burst     float64 // 桶容量
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time // 当前时间 (测试可替换)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter 创建限流器，rps 为每秒允许的请求数，burst 为允许的突发请求数 (<= 0 时取 rps 向上取整)
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	if burst <= 0 {
+		burst = int(math.Ceil(rps))
+	}
+	return &RateLimiter{
+		rate:    rps,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Allow 消耗 key 的一个令牌，配额耗尽时返回 false
+func (l *RateLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep 定期移除已补满的令牌桶 (与新建的桶等价)，避免来源地址无限增长 (调用者需持有 mu)
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimitKey 返回连接的限流键 (来源 IP，不含端口)
+func rateLimitKey(addr net.Addr) string {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return udp.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
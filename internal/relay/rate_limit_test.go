@@ -0,0 +1,80 @@
+package relay
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_BurstThenRecover(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewRateLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("10.0.0.1") {
+			t.Fatalf("request %d within burst rejected", i)
+		}
+	}
+	if l.Allow("10.0.0.1") {
+		t.Error("request past the burst should be rejected")
+	}
+	// 其他来源地址不受影响
+	if !l.Allow("10.0.0.2") {
+		t.Error("another source address should have its own quota")
+	}
+
+	// 每秒补充 2 个令牌
+	now = now.Add(500 * time.Millisecond)
+	if !l.Allow("10.0.0.1") {
+		t.Error("request after refill should be allowed")
+	}
+	if l.Allow("10.0.0.1") {
+		t.Error("only one token should have been refilled")
+	}
+
+	// 空闲足够久后恢复完整突发配额，但不超过桶容量
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		if !l.Allow("10.0.0.1") {
+			t.Fatalf("request %d after recovery rejected", i)
+		}
+	}
+	if l.Allow("10.0.0.1") {
+		t.Error("recovered quota should be capped at the burst")
+	}
+}
+
+func TestRateLimiter_DefaultBurstAndSweep(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewRateLimiter(1.5, 0)
+	l.now = func() time.Time { return now }
+	if l.burst != 2 {
+		t.Errorf("default burst = %v, want 2", l.burst)
+	}
+
+	l.Allow("10.0.0.1")
+	now = now.Add(2 * rateLimitSweepInterval)
+	l.Allow("10.0.0.2")
+	if _, ok := l.buckets["10.0.0.1"]; ok {
+		t.Error("refilled bucket should be swept")
+	}
+	if len(l.buckets) != 1 {
+		t.Errorf("buckets = %d, want 1", len(l.buckets))
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	for _, tt := range []struct {
+		addr net.Addr
+		want string
+	}{
+		{&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4433}, "192.0.2.1"},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4433}, "2001:db8::1"},
+		{&net.TCPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 80}, "192.0.2.2"},
+	} {
+		if got := rateLimitKey(tt.addr); got != tt.want {
+			t.Errorf("rateLimitKey(%v) = %s, want %s", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -2,106 +2,427 @@ package relay
 
 import (
 	"context"
-	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/binn/tokengo/internal/logging"
 	"github.com/binn/tokengo/internal/protocol"
 	"github.com/quic-go/quic-go"
 )
 
 // ExitEntry 已注册的 Exit 节点条目
 type ExitEntry struct {
-	PubKeyHash    string
-	Conn          quic.Connection
-	KeyConfig     []byte // OHTTP KeyConfig (RFC 9458)
-	RegisteredAt  time.Time
-	LastHeartbeat time.Time
+	PubKeyHash     string
+	Conn           quic.Connection
+	KeyConfig      []byte        // OHTTP KeyConfig 列表 (RFC 9458，多个密钥时拼接，主密钥在前)
+	Capabilities   []string      // Exit 通告的端点族，为空表示未通告
+	RequestTimeout time.Duration // Exit 通告的推荐请求超时，0 表示未通告
+	Weight         int           // Exit 通告的选择权重，0 表示未通告
+	Models         []string      // Exit 通告的可服务模型，为空表示未通告
+	Features       []string      // Exit 通告的协议特性，为空表示未通告
+	RegisteredAt   time.Time
+	LastHeartbeat  time.Time
+	DisconnectAt   time.Time     // 连接断开时间，零值表示在线；非零时处于重连宽限期
+	Load           int           // Exit 最近心跳通告的负载百分比 (0-100)
+	LoadUpdatedAt  time.Time     // 最近一次通告负载的时间，零值表示未通告
+	RTT            time.Duration // Exit 心跳通告的与本 Relay 的往返时间 (滑动平均)，0 表示未通告
+
+	MaxConcurrentStreams int // Exit 通告的并发请求流上限，0 表示不限制
+	activeStreams        int // 当前转发中的请求流数 (受 Registry.mu 保护)
+}
+
+// loadStaleAfter 负载超过该时间未随心跳刷新时视为过期 (Exit 每 15s 发送一次心跳)
+const loadStaleAfter = 45 * time.Second
+
+// Reconnecting 是否处于断线重连宽限期
+func (e *ExitEntry) Reconnecting() bool {
+	return !e.DisconnectAt.IsZero()
+}
+
+// exitGroup 共享同一 pubKeyHash 的 Exit 连接 (同一 OHTTP 密钥水平扩展的多个实例)
+type exitGroup struct {
+	entries []*ExitEntry
+	next    atomic.Uint64 // 轮询游标
+}
+
+// online 返回在线 (非重连宽限期) 的条目
+func (g *exitGroup) online() []*ExitEntry {
+	online := make([]*ExitEntry, 0, len(g.entries))
+	for _, entry := range g.entries {
+		if !entry.Reconnecting() {
+			online = append(online, entry)
+		}
+	}
+	return online
+}
+
+// latest 返回以其元数据为准的实例: 最新注册的在线实例，全部断开时为最新的条目 (online 为 false)
+func (g *exitGroup) latest() (entry *ExitEntry, online bool) {
+	candidates := g.online()
+	online = len(candidates) > 0
+	if !online {
+		candidates = g.entries
+	}
+	if len(candidates) == 0 {
+		return nil, false
+	}
+	return candidates[len(candidates)-1], online
+}
+
+// load 返回在线实例中未过期负载的平均值，没有实例通告负载时返回 0
+func (g *exitGroup) load(now time.Time) int {
+	total, n := 0, 0
+	for _, entry := range g.online() {
+		if entry.LoadUpdatedAt.IsZero() || now.Sub(entry.LoadUpdatedAt) > loadStaleAfter {
+			continue
+		}
+		total += entry.Load
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / n
+}
+
+// find 返回连接对应的条目下标，不存在时返回 -1
+func (g *exitGroup) find(conn quic.Connection) int {
+	for i, entry := range g.entries {
+		if entry.Conn == conn {
+			return i
+		}
+	}
+	return -1
+}
+
+// remove 移除下标 i 的条目
+func (g *exitGroup) remove(i int) {
+	g.entries = append(g.entries[:i:i], g.entries[i+1:]...)
 }
 
 // Registry Exit 节点注册表
+// 同一 pubKeyHash 可注册多个连接，转发时轮询选择
 type Registry struct {
 	mu      sync.RWMutex
-	entries map[string]*ExitEntry
+	entries map[string]*exitGroup
+	grace   time.Duration // 断线重连宽限期，0 表示断线立即移除
+	logger  logging.Logger
 }
 
 // NewRegistry 创建注册表
 func NewRegistry() *Registry {
 	return &Registry{
-		entries: make(map[string]*ExitEntry),
+		entries: make(map[string]*exitGroup),
+		logger:  logging.New("relay"),
 	}
 }
 
-// Register 注册 Exit 节点，如果已有旧连接则关闭旧的
+// SetLogger 设置日志输出 (需在注册 Exit 之前调用)
+func (r *Registry) SetLogger(logger logging.Logger) {
+	r.logger = logger
+}
+
+// SetReconnectGrace 设置断线重连宽限期
+// 宽限期内断开的 Exit 仍在公钥列表中通告 (标记为重连中)，但不接受转发
+func (r *Registry) SetReconnectGrace(grace time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.grace = grace
+}
+
+// Register 注册 Exit 节点
 func (r *Registry) Register(pubKeyHash string, conn quic.Connection, keyConfig []byte) {
+	r.RegisterWithMetadata(pubKeyHash, conn, keyConfig, protocol.ExitMetadata{})
+}
+
+// RegisterWithMetadata 注册 Exit 节点并记录其通告的元数据 (端点族、推荐请求超时)
+// 同一 pubKeyHash 已有在线连接时追加为新实例；已断开或处于重连宽限期的旧连接被替换
+func (r *Registry) RegisterWithMetadata(pubKeyHash string, conn quic.Connection, keyConfig []byte, meta protocol.ExitMetadata) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// 如果已有旧连接，关闭旧的
-	if old, ok := r.entries[pubKeyHash]; ok {
-		log.Printf("Exit %s 重新注册，关闭旧连接 %s", pubKeyHash, old.Conn.RemoteAddr())
+	group, ok := r.entries[pubKeyHash]
+	if !ok {
+		group = &exitGroup{}
+		r.entries[pubKeyHash] = group
+	}
+
+	// 保留仍在线的其他实例，关闭已失效的旧连接
+	kept := make([]*ExitEntry, 0, len(group.entries)+1)
+	for _, old := range group.entries {
+		switch {
+		case old.Conn == conn:
+			// 同一连接重复注册，以新条目为准
+			continue
+		case old.Reconnecting():
+			r.logger.Info("Exit 在宽限期内重连", logging.KeyExitHash, pubKeyHash, "disconnected_for", time.Since(old.DisconnectAt).Round(time.Millisecond).String())
+		case old.Conn.Context().Err() != nil:
+			r.logger.Info("Exit 重新注册，替换已断开的旧连接", logging.KeyExitHash, pubKeyHash, logging.KeyRemote, old.Conn.RemoteAddr().String())
+		default:
+			kept = append(kept, old)
+			continue
+		}
 		old.Conn.CloseWithError(0, "replaced by new connection")
 	}
 
 	now := time.Now()
-	r.entries[pubKeyHash] = &ExitEntry{
-		PubKeyHash:    pubKeyHash,
-		Conn:          conn,
-		KeyConfig:     keyConfig,
-		RegisteredAt:  now,
-		LastHeartbeat: now,
-	}
-	log.Printf("Exit 注册成功: %s (来自 %s), 当前注册数: %d", pubKeyHash, conn.RemoteAddr(), len(r.entries))
+	group.entries = append(kept, &ExitEntry{
+		PubKeyHash:     pubKeyHash,
+		Conn:           conn,
+		KeyConfig:      keyConfig,
+		Capabilities:   meta.Capabilities,
+		RequestTimeout: meta.RequestTimeout,
+		Weight:         meta.Weight,
+		Models:         meta.Models,
+		Features:       meta.Features,
+		RegisteredAt:   now,
+		LastHeartbeat:  now,
+
+		MaxConcurrentStreams: meta.MaxConcurrentStreams,
+	})
+	r.logger.Info("Exit 注册成功", logging.KeyExitHash, pubKeyHash, logging.KeyRemote, conn.RemoteAddr().String(),
+		"instances", len(group.entries), "registered", len(r.entries))
 }
 
-// Lookup 查找 Exit 节点连接
+// Lookup 轮询选择 Exit 节点连接 (宽限期内的断线 Exit 视为不可用)
 func (r *Registry) Lookup(pubKeyHash string) (quic.Connection, bool) {
+	conns := r.LookupAll(pubKeyHash)
+	if len(conns) == 0 {
+		return nil, false
+	}
+	return conns[0], true
+}
+
+// LookupAll 返回 Exit 的全部在线连接，从轮询位置开始排列 (首个连接失败时依次尝试后续连接)
+func (r *Registry) LookupAll(pubKeyHash string) []quic.Connection {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	entry, ok := r.entries[pubKeyHash]
+	group, ok := r.entries[pubKeyHash]
+	if !ok {
+		return nil
+	}
+	online := group.online()
+	if len(online) == 0 {
+		return nil
+	}
+
+	start := int((group.next.Add(1) - 1) % uint64(len(online)))
+	conns := make([]quic.Connection, 0, len(online))
+	for i := range online {
+		conns = append(conns, online[(start+i)%len(online)].Conn)
+	}
+	return conns
+}
+
+// AcquireStream 在 Exit 的指定连接上占用一个请求流名额，返回释放函数
+// 连接已达通告的并发上限时返回 false；连接不在注册表中时不做限制
+func (r *Registry) AcquireStream(pubKeyHash string, conn quic.Connection) (func(), bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.entries[pubKeyHash]
 	if !ok {
+		return func() {}, true
+	}
+	i := group.find(conn)
+	if i < 0 {
+		return func() {}, true
+	}
+	entry := group.entries[i]
+	if entry.MaxConcurrentStreams > 0 && entry.activeStreams >= entry.MaxConcurrentStreams {
 		return nil, false
 	}
-	return entry.Conn, true
+	entry.activeStreams++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			entry.activeStreams--
+			r.mu.Unlock()
+		})
+	}, true
+}
+
+// IsReconnecting 检查 Exit 是否处于断线重连宽限期 (所有实例均已断开)
+func (r *Registry) IsReconnecting(pubKeyHash string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	group, ok := r.entries[pubKeyHash]
+	return ok && len(group.online()) == 0
 }
 
-// Remove 移除 Exit 节点
+// Remove 移除 Exit 节点 (全部实例)
 func (r *Registry) Remove(pubKeyHash string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if _, ok := r.entries[pubKeyHash]; ok {
 		delete(r.entries, pubKeyHash)
-		log.Printf("Exit 已移除: %s, 当前注册数: %d", pubKeyHash, len(r.entries))
+		r.logger.Info("Exit 已移除", logging.KeyExitHash, pubKeyHash, "registered", len(r.entries))
 	}
 }
 
-// RemoveIfMatch 移除 Exit 节点，但只有在连接匹配时才移除（避免 TOCTOU 竞争）
+// Kick 管理员踢出 Exit: 移除全部实例 (包括重连宽限期内的) 并关闭其连接，返回该 Exit 是否存在
+// Exit 仍可重新连接注册，需同时在 Exit 侧处理根本问题
+func (r *Registry) Kick(pubKeyHash string) bool {
+	r.mu.Lock()
+	group, ok := r.entries[pubKeyHash]
+	if ok {
+		delete(r.entries, pubKeyHash)
+	}
+	remaining := len(r.entries)
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	// 在锁外关闭连接: 连接关闭触发的 MarkDisconnected 需要获取锁 (此时条目已移除，不再生效)
+	for _, entry := range group.entries {
+		if entry.Conn != nil {
+			entry.Conn.CloseWithError(1, "kicked by relay admin")
+		}
+	}
+	r.logger.Warn("Exit 已被管理员踢出", logging.KeyExitHash, pubKeyHash, "instances", len(group.entries), "registered", remaining)
+	return true
+}
+
+// RemoveIfMatch 移除 Exit 节点的指定连接（避免 TOCTOU 竞争），同一 pubKeyHash 的其他实例保留
 func (r *Registry) RemoveIfMatch(pubKeyHash string, conn quic.Connection) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if entry, ok := r.entries[pubKeyHash]; ok {
-		if entry.Conn == conn { // 比较连接是否相同
-			delete(r.entries, pubKeyHash)
-			log.Printf("Exit 已移除 (匹配): %s, 当前注册数: %d", pubKeyHash, len(r.entries))
+	group, ok := r.entries[pubKeyHash]
+	if !ok {
+		return false
+	}
+	i := group.find(conn)
+	if i < 0 {
+		r.logger.Debug("Exit 连接已更新，跳过移除", logging.KeyExitHash, pubKeyHash)
+		return false
+	}
+	r.removeEntry(pubKeyHash, group, i)
+	return true
+}
+
+// removeEntry 移除实例，实例全部移除时删除该 pubKeyHash (调用者需持有写锁)
+func (r *Registry) removeEntry(pubKeyHash string, group *exitGroup, i int) {
+	group.remove(i)
+	if len(group.entries) == 0 {
+		delete(r.entries, pubKeyHash)
+		r.logger.Info("Exit 已移除 (匹配)", logging.KeyExitHash, pubKeyHash, "registered", len(r.entries))
+		return
+	}
+	r.logger.Info("Exit 移除一个实例", logging.KeyExitHash, pubKeyHash, "instances", len(group.entries))
+}
+
+// MarkDisconnected Exit 连接断开时调用 (仅当连接匹配时生效)
+// 同一 pubKeyHash 仍有其他在线实例或未配置宽限期时直接移除该连接；
+// 否则保留条目并标记为重连中，宽限期过后由 cleanup 移除
+func (r *Registry) MarkDisconnected(pubKeyHash string, conn quic.Connection) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.entries[pubKeyHash]
+	if !ok {
+		return false
+	}
+	i := group.find(conn)
+	if i < 0 {
+		return false
+	}
+	entry := group.entries[i]
+
+	// 其他实例仍可服务时无需保留重连宽限期
+	others := len(group.online())
+	if !entry.Reconnecting() {
+		others--
+	}
+	if r.grace <= 0 || others > 0 {
+		r.removeEntry(pubKeyHash, group, i)
+		return true
+	}
+
+	if !entry.Reconnecting() {
+		entry.DisconnectAt = time.Now()
+		r.logger.Info("Exit 连接断开，保留条目等待重连", logging.KeyExitHash, pubKeyHash, "grace", r.grace.String())
+	}
+	return true
+}
+
+// UpdateHeartbeat 更新心跳时间 (全部实例)
+func (r *Registry) UpdateHeartbeat(pubKeyHash string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if group, ok := r.entries[pubKeyHash]; ok {
+		now := time.Now()
+		for _, entry := range group.entries {
+			entry.LastHeartbeat = now
+		}
+	}
+}
+
+// UpdateHeartbeatIfMatch 更新心跳时间，但只有在连接匹配时才更新
+// 避免已被替换的旧连接上的心跳刷新新注册条目
+func (r *Registry) UpdateHeartbeatIfMatch(pubKeyHash string, conn quic.Connection) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if group, ok := r.entries[pubKeyHash]; ok {
+		if i := group.find(conn); i >= 0 {
+			group.entries[i].LastHeartbeat = time.Now()
 			return true
 		}
-		log.Printf("Exit %s 连接已更新，跳过移除", pubKeyHash)
-		return false
 	}
 	return false
 }
 
-// UpdateHeartbeat 更新心跳时间
-func (r *Registry) UpdateHeartbeat(pubKeyHash string) {
+// UpdateLoadIfMatch 记录 Exit 心跳通告的负载，只有在连接匹配时才更新
+func (r *Registry) UpdateLoadIfMatch(pubKeyHash string, conn quic.Connection, load int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if group, ok := r.entries[pubKeyHash]; ok {
+		if i := group.find(conn); i >= 0 {
+			group.entries[i].Load = load
+			group.entries[i].LoadUpdatedAt = time.Now()
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateModelsIfMatch 更新 Exit 通告的可服务模型，只有在连接匹配时才更新
+func (r *Registry) UpdateModelsIfMatch(pubKeyHash string, conn quic.Connection, models []string) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if entry, ok := r.entries[pubKeyHash]; ok {
-		entry.LastHeartbeat = time.Now()
+	if group, ok := r.entries[pubKeyHash]; ok {
+		if i := group.find(conn); i >= 0 {
+			group.entries[i].Models = models
+			return true
+		}
 	}
+	return false
+}
+
+// UpdateRTTIfMatch 记录 Exit 心跳通告的往返时间，只有在连接匹配时才更新
+func (r *Registry) UpdateRTTIfMatch(pubKeyHash string, conn quic.Connection, rtt time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if group, ok := r.entries[pubKeyHash]; ok {
+		if i := group.find(conn); i >= 0 {
+			group.entries[i].RTT = rtt
+			return true
+		}
+	}
+	return false
 }
 
 // StartCleanup 启动后台清理 goroutine，清理超时的 Entry
@@ -119,44 +440,220 @@ func (r *Registry) StartCleanup(ctx context.Context, timeout time.Duration) {
 			}
 		}
 	}()
-	log.Printf("Registry 清理任务已启动，超时时间: %v", timeout)
+	r.logger.Info("Registry 清理任务已启动", "timeout", timeout.String())
 }
 
 // cleanup 清理超时的 Exit 条目
+// 先在读锁下收集候选，再逐个在写锁下复核（连接未被替换且心跳仍超时）后移除，
+// 连接在锁外关闭，避免与并发的重新注册竞争而误关新连接
 func (r *Registry) cleanup(timeout time.Duration) {
+	type candidate struct {
+		hash string
+		conn quic.Connection
+	}
+
+	r.mu.RLock()
+	now := time.Now()
+	var candidates []candidate
+	for hash, group := range r.entries {
+		for _, entry := range group.entries {
+			if r.expired(entry, now, timeout) {
+				candidates = append(candidates, candidate{hash: hash, conn: entry.Conn})
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, c := range candidates {
+		if r.removeIfStale(c.hash, c.conn, timeout) {
+			c.conn.CloseWithError(0, "heartbeat timeout")
+		}
+	}
+}
+
+// removeIfStale 仅当指定连接仍在注册表中且心跳超时时移除
+func (r *Registry) removeIfStale(pubKeyHash string, conn quic.Connection, timeout time.Duration) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	group, ok := r.entries[pubKeyHash]
+	if !ok {
+		return false
+	}
+	i := group.find(conn)
+	if i < 0 {
+		return false
+	}
+	entry := group.entries[i]
+
 	now := time.Now()
-	for hash, entry := range r.entries {
-		if now.Sub(entry.LastHeartbeat) > timeout {
-			log.Printf("Exit %s 心跳超时 (%v)，移除", hash, now.Sub(entry.LastHeartbeat))
-			entry.Conn.CloseWithError(0, "heartbeat timeout")
-			delete(r.entries, hash)
-		}
+	if !r.expired(entry, now, timeout) {
+		return false
+	}
+
+	r.removeEntry(pubKeyHash, group, i)
+	if entry.Reconnecting() {
+		r.logger.Info("Exit 重连宽限期已过，移除", logging.KeyExitHash, pubKeyHash, "grace", r.grace.String())
+	} else {
+		r.logger.Warn("Exit 心跳超时，移除", logging.KeyExitHash, pubKeyHash, "since_heartbeat", now.Sub(entry.LastHeartbeat).String())
+	}
+	return true
+}
+
+// expired 条目是否应被清理: 心跳超时，或断线后超过重连宽限期 (调用者需持有锁)
+func (r *Registry) expired(entry *ExitEntry, now time.Time, timeout time.Duration) bool {
+	if entry.Reconnecting() && now.Sub(entry.DisconnectAt) > r.grace {
+		return true
 	}
+	return now.Sub(entry.LastHeartbeat) > timeout
 }
 
-// ListExitKeys 返回所有已注册 Exit 的公钥信息
+// ListExitKeys 返回所有已注册 Exit 的公钥信息 (同一 pubKeyHash 的多个实例只通告一次)
+// 负载取在线实例最近通告负载的平均值，超过 loadStaleAfter 未刷新的负载不计入
 func (r *Registry) ListExitKeys() []protocol.ExitKeyEntry {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	now := time.Now()
 	var entries []protocol.ExitKeyEntry
-	for _, entry := range r.entries {
+	for hash, group := range r.entries {
+		entry, online := group.latest()
+		if entry == nil {
+			continue
+		}
 		if len(entry.KeyConfig) > 0 {
 			entries = append(entries, protocol.ExitKeyEntry{
-				PubKeyHash: entry.PubKeyHash,
-				KeyConfig:  entry.KeyConfig,
+				PubKeyHash:       hash,
+				KeyConfig:        entry.KeyConfig,
+				Reconnecting:     !online,
+				Capabilities:     entry.Capabilities,
+				RequestTimeoutMs: entry.RequestTimeout.Milliseconds(),
+				Weight:           entry.Weight,
+				Models:           entry.Models,
+				Load:             group.load(now),
+				Features:         entry.Features,
 			})
 		}
 	}
 	return entries
 }
 
-// Count 返回已注册的 Exit 数量
+// ExitModels 返回各 Exit 通告的可服务模型 (以最新注册的在线实例为准)，未通告模型的 Exit 不列出
+func (r *Registry) ExitModels() protocol.ExitModels {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	models := make(protocol.ExitModels, len(r.entries))
+	for hash, group := range r.entries {
+		if entry, _ := group.latest(); entry != nil && len(entry.Models) > 0 {
+			models[hash] = entry.Models
+		}
+	}
+	return models
+}
+
+// OnlineConns 返回所有在线 Exit 的连接 (pubKeyHash → 各实例连接)，不含重连宽限期内的条目
+func (r *Registry) OnlineConns() map[string][]quic.Connection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	conns := make(map[string][]quic.Connection, len(r.entries))
+	for hash, group := range r.entries {
+		for _, entry := range group.online() {
+			conns[hash] = append(conns[hash], entry.Conn)
+		}
+	}
+	return conns
+}
+
+// Count 返回已注册的 Exit 数量 (按 pubKeyHash 计)
 func (r *Registry) Count() int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	return len(r.entries)
 }
+
+// ExitStats 单个 Exit 实例 (连接) 的运行统计
+type ExitStats struct {
+	PubKeyHash    string
+	RemoteAddr    string
+	Load          int           // 最近通告的负载百分比，未通告时为 0
+	RTT           time.Duration // 最近通告的心跳往返时间，未通告时为 0
+	LastHeartbeat time.Time
+	ActiveStreams int
+	Reconnecting  bool
+}
+
+// Stats 返回所有 Exit 实例的运行统计 (按 pubKeyHash 排序，同一 Exit 按注册顺序)
+func (r *Registry) Stats() []ExitStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var stats []ExitStats
+	for hash, group := range r.entries {
+		for _, entry := range group.entries {
+			s := ExitStats{
+				PubKeyHash:    hash,
+				Load:          entry.Load,
+				RTT:           entry.RTT,
+				LastHeartbeat: entry.LastHeartbeat,
+				ActiveStreams: entry.activeStreams,
+				Reconnecting:  entry.Reconnecting(),
+			}
+			if entry.Conn != nil {
+				s.RemoteAddr = entry.Conn.RemoteAddr().String()
+			}
+			stats = append(stats, s)
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].PubKeyHash < stats[j].PubKeyHash
+	})
+	return stats
+}
+
+// rtt 返回在线实例通告的往返时间平均值，没有实例通告时返回 0
+func (g *exitGroup) rtt() time.Duration {
+	var total time.Duration
+	n := 0
+	for _, entry := range g.online() {
+		if entry.RTT > 0 {
+			total += entry.RTT
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / time.Duration(n)
+}
+
+// ExitStatuses 返回各 Exit 的注册状态 (按 pubKeyHash 排序)，供运维状态查询
+func (r *Registry) ExitStatuses(now time.Time) []protocol.ExitStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make([]protocol.ExitStatus, 0, len(r.entries))
+	for hash, group := range r.entries {
+		if len(group.entries) == 0 {
+			continue
+		}
+		var last time.Time
+		for _, entry := range group.entries {
+			if entry.LastHeartbeat.After(last) {
+				last = entry.LastHeartbeat
+			}
+		}
+		statuses = append(statuses, protocol.ExitStatus{
+			PubKeyHash:         hash,
+			Instances:          len(group.entries),
+			LastHeartbeatAgeMs: now.Sub(last).Milliseconds(),
+			Reconnecting:       len(group.online()) == 0,
+			HeartbeatRTTUs:     group.rtt().Microseconds(),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].PubKeyHash < statuses[j].PubKeyHash
+	})
+	return statuses
+}
@@ -1,14 +1,20 @@
 package relay
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/binn/tokengo/internal/logging"
+	"github.com/binn/tokengo/internal/protocol"
 	"github.com/quic-go/quic-go"
 )
 
@@ -197,8 +203,8 @@ func TestRegistry_HeartbeatCleanup(t *testing.T) {
 
 	// 手动修改 stale 的 LastHeartbeat 使其超时
 	r.mu.Lock()
-	if entry, ok := r.entries["stale"]; ok {
-		entry.LastHeartbeat = time.Now().Add(-2 * time.Minute)
+	if group, ok := r.entries["stale"]; ok {
+		group.entries[0].LastHeartbeat = time.Now().Add(-2 * time.Minute)
 	}
 	r.mu.Unlock()
 
@@ -243,7 +249,8 @@ func TestRegistry_ReRegister(t *testing.T) {
 		t.Fatal("conn1 应已注册")
 	}
 
-	// 重新注册同一 pubKeyHash 的新连接
+	// 旧连接断开后 (尚未被检测到) 重新注册同一 pubKeyHash 的新连接
+	conn1.cancel()
 	conn2 := newMockConn(2)
 	r.Register(hash, conn2, []byte("kc2"))
 
@@ -285,6 +292,133 @@ func TestRegistry_ListExitKeys(t *testing.T) {
 	}
 }
 
+func TestRegistry_ListExitKeysLoad(t *testing.T) {
+	r := NewRegistry()
+	const hash = "exit-loaded"
+
+	conn1, conn2, conn3 := newMockConn(1), newMockConn(2), newMockConn(3)
+	r.Register(hash, conn1, []byte("kc"))
+	r.Register(hash, conn2, []byte("kc"))
+	r.Register(hash, conn3, []byte("kc"))
+
+	if keys := r.ListExitKeys(); len(keys) != 1 || keys[0].Load != 0 {
+		t.Fatalf("未通告负载时 Load 应为 0: %+v", keys)
+	}
+
+	// 在线实例取平均值，过期的负载不计入
+	r.UpdateLoadIfMatch(hash, conn1, 80)
+	r.UpdateLoadIfMatch(hash, conn2, 40)
+	r.UpdateLoadIfMatch(hash, conn3, 100)
+	r.mu.Lock()
+	r.entries[hash].entries[2].LoadUpdatedAt = time.Now().Add(-2 * loadStaleAfter)
+	r.mu.Unlock()
+	if keys := r.ListExitKeys(); keys[0].Load != 60 {
+		t.Errorf("Load = %d, want 60", keys[0].Load)
+	}
+
+	// 已替换的连接不能刷新负载
+	if r.UpdateLoadIfMatch(hash, newMockConn(4), 10) {
+		t.Error("UpdateLoadIfMatch should reject unknown conn")
+	}
+}
+
+func TestRegistry_UpdateModelsIfMatch(t *testing.T) {
+	r := NewRegistry()
+	const hash = "exit-models"
+
+	conn := newMockConn(1)
+	r.RegisterWithMetadata(hash, conn, []byte("kc"), protocol.ExitMetadata{Models: []string{"gpt-4o"}})
+	if models := r.ExitModels(); len(models[hash]) != 1 {
+		t.Fatalf("ExitModels = %v, want registered models", models)
+	}
+
+	if !r.UpdateModelsIfMatch(hash, conn, []string{"gpt-4o", "o1"}) {
+		t.Fatal("UpdateModelsIfMatch should accept the registered conn")
+	}
+	if keys := r.ListExitKeys(); len(keys[0].Models) != 2 {
+		t.Errorf("Models = %v, want updated list", keys[0].Models)
+	}
+
+	// 已替换的连接不能更新模型
+	if r.UpdateModelsIfMatch(hash, newMockConn(2), nil) {
+		t.Error("UpdateModelsIfMatch should reject unknown conn")
+	}
+
+	// 清空后视为未通告，不再出现在 ExitModels 中
+	r.UpdateModelsIfMatch(hash, conn, nil)
+	if models := r.ExitModels(); len(models) != 0 {
+		t.Errorf("ExitModels = %v, want empty", models)
+	}
+}
+
+func TestRegistry_ExitStatuses(t *testing.T) {
+	r := NewRegistry()
+	r.SetReconnectGrace(time.Minute)
+
+	r.Register("h2", newMockConn(1), []byte("kc2"))
+	r.Register("h1", newMockConn(2), []byte("kc1"))
+	r.Register("h1", newMockConn(3), []byte("kc1"))
+	offline := newMockConn(4)
+	r.Register("h3", offline, []byte("kc3"))
+	r.MarkDisconnected("h3", offline)
+
+	// h1 的两个实例中较新的心跳为 5 秒前
+	now := time.Now()
+	r.mu.Lock()
+	r.entries["h1"].entries[0].LastHeartbeat = now.Add(-30 * time.Second)
+	r.entries["h1"].entries[1].LastHeartbeat = now.Add(-5 * time.Second)
+	r.mu.Unlock()
+
+	statuses := r.ExitStatuses(now)
+	if len(statuses) != 3 {
+		t.Fatalf("len(statuses) = %d, want 3", len(statuses))
+	}
+	if statuses[0].PubKeyHash != "h1" || statuses[1].PubKeyHash != "h2" || statuses[2].PubKeyHash != "h3" {
+		t.Errorf("statuses not sorted by hash: %+v", statuses)
+	}
+	if statuses[0].Instances != 2 || statuses[0].LastHeartbeatAge() != 5*time.Second {
+		t.Errorf("h1 = %+v, want 2 instances and 5s heartbeat age", statuses[0])
+	}
+	if statuses[0].Reconnecting || !statuses[2].Reconnecting {
+		t.Errorf("reconnecting flags = %v/%v, want false/true", statuses[0].Reconnecting, statuses[2].Reconnecting)
+	}
+}
+
+func TestRegistry_RTTStats(t *testing.T) {
+	r := NewRegistry()
+	c1, c2 := newMockConn(1), newMockConn(2)
+	r.Register("h1", c1, []byte("kc"))
+	r.Register("h1", c2, []byte("kc"))
+	r.Register("h2", newMockConn(3), []byte("kc"))
+
+	if !r.UpdateRTTIfMatch("h1", c1, 10*time.Millisecond) || !r.UpdateRTTIfMatch("h1", c2, 30*time.Millisecond) {
+		t.Fatal("UpdateRTTIfMatch should match registered connections")
+	}
+	if r.UpdateRTTIfMatch("h1", newMockConn(9), time.Second) {
+		t.Error("UpdateRTTIfMatch should ignore an unknown connection")
+	}
+
+	stats := r.Stats()
+	if len(stats) != 3 {
+		t.Fatalf("len(stats) = %d, want 3", len(stats))
+	}
+	if stats[0].PubKeyHash != "h1" || stats[0].RTT != 10*time.Millisecond || stats[1].RTT != 30*time.Millisecond {
+		t.Errorf("h1 stats = %+v, %+v, want RTT 10ms and 30ms", stats[0], stats[1])
+	}
+	if stats[2].PubKeyHash != "h2" || stats[2].RTT != 0 {
+		t.Errorf("h2 stats = %+v, want no RTT", stats[2])
+	}
+
+	// 状态汇总在线实例的平均往返时间，未通告的 Exit 不输出
+	statuses := r.ExitStatuses(time.Now())
+	if statuses[0].HeartbeatRTT() != 20*time.Millisecond {
+		t.Errorf("h1 HeartbeatRTT = %v, want 20ms", statuses[0].HeartbeatRTT())
+	}
+	if statuses[1].HeartbeatRTTUs != 0 {
+		t.Errorf("h2 HeartbeatRTTUs = %d, want 0", statuses[1].HeartbeatRTTUs)
+	}
+}
+
 func TestRegistry_StartCleanup(t *testing.T) {
 	r := NewRegistry()
 	ctx, cancel := context.WithCancel(context.Background())
@@ -295,8 +429,8 @@ func TestRegistry_StartCleanup(t *testing.T) {
 
 	// 将心跳时间设置为过去
 	r.mu.Lock()
-	if entry, ok := r.entries["stale"]; ok {
-		entry.LastHeartbeat = time.Now().Add(-5 * time.Second)
+	if group, ok := r.entries["stale"]; ok {
+		group.entries[0].LastHeartbeat = time.Now().Add(-5 * time.Second)
 	}
 	r.mu.Unlock()
 
@@ -314,3 +448,398 @@ func TestRegistry_StartCleanup(t *testing.T) {
 		t.Fatal("stale 连接应被关闭")
 	}
 }
+
+func TestRegistry_CleanupRacesReRegister(t *testing.T) {
+	r := NewRegistry()
+	const n = 200
+
+	for i := 0; i < n; i++ {
+		hash := fmt.Sprintf("exit-%d", i)
+		oldConn := newMockConn(i)
+		r.Register(hash, oldConn, []byte("kc-old"))
+
+		// 旧连接心跳超时
+		r.mu.Lock()
+		r.entries[hash].entries[0].LastHeartbeat = time.Now().Add(-2 * time.Minute)
+		r.mu.Unlock()
+
+		newConn := newMockConn(i + n)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r.cleanup(60 * time.Second)
+		}()
+		go func() {
+			defer wg.Done()
+			r.Register(hash, newConn, []byte("kc-new"))
+		}()
+		wg.Wait()
+
+		// 无论先后顺序，最终注册的都应是新连接，且新连接不能被清理关闭
+		got, ok := r.Lookup(hash)
+		if !ok || got != newConn {
+			t.Fatalf("%s: 重新注册的连接应保留在 Registry 中", hash)
+		}
+		if newConn.closeCalls.Load() != 0 {
+			t.Fatalf("%s: 新连接不应被 cleanup 关闭", hash)
+		}
+		if oldConn.closeCalls.Load() == 0 {
+			t.Fatalf("%s: 旧连接应被关闭", hash)
+		}
+	}
+}
+
+func TestRegistry_UpdateHeartbeatIfMatch(t *testing.T) {
+	r := NewRegistry()
+	const hash = "exit-hb"
+
+	oldConn := newMockConn(1)
+	r.Register(hash, oldConn, []byte("kc"))
+	oldConn.cancel()
+	newConn := newMockConn(2)
+	r.Register(hash, newConn, []byte("kc"))
+
+	r.mu.Lock()
+	r.entries[hash].entries[0].LastHeartbeat = time.Now().Add(-2 * time.Minute)
+	r.mu.Unlock()
+
+	// 旧连接上迟到的心跳不应刷新新条目
+	if r.UpdateHeartbeatIfMatch(hash, oldConn) {
+		t.Fatal("旧连接的心跳不应被接受")
+	}
+	r.cleanup(60 * time.Second)
+	if _, ok := r.Lookup(hash); ok {
+		t.Fatal("心跳超时的条目应被清理")
+	}
+
+	r.Register(hash, newConn, []byte("kc"))
+	if !r.UpdateHeartbeatIfMatch(hash, newConn) {
+		t.Fatal("当前连接的心跳应被接受")
+	}
+}
+
+func TestRegistry_ReconnectGrace_BriefDisconnectStaysAdvertised(t *testing.T) {
+	r := NewRegistry()
+	r.SetReconnectGrace(time.Second)
+
+	conn1 := newMockConn(1)
+	r.Register("hash-A", conn1, []byte("key-config"))
+
+	if !r.MarkDisconnected("hash-A", conn1) {
+		t.Fatal("MarkDisconnected should match current connection")
+	}
+
+	// 宽限期内: 仍在公钥列表中通告，但不可路由
+	keys := r.ListExitKeys()
+	if len(keys) != 1 || keys[0].PubKeyHash != "hash-A" || !keys[0].Reconnecting {
+		t.Fatalf("ListExitKeys = %+v, want hash-A marked reconnecting", keys)
+	}
+	if _, ok := r.Lookup("hash-A"); ok {
+		t.Error("reconnecting exit should not be routable")
+	}
+	if !r.IsReconnecting("hash-A") {
+		t.Error("IsReconnecting should be true")
+	}
+
+	r.cleanup(90 * time.Second)
+	if r.Count() != 1 {
+		t.Fatal("cleanup within grace window should keep the exit")
+	}
+
+	// 重连后恢复正常
+	conn2 := newMockConn(2)
+	r.Register("hash-A", conn2, []byte("key-config"))
+
+	keys = r.ListExitKeys()
+	if len(keys) != 1 || keys[0].Reconnecting {
+		t.Fatalf("ListExitKeys = %+v, want hash-A online", keys)
+	}
+	if got, ok := r.Lookup("hash-A"); !ok || got != conn2 {
+		t.Error("re-registered exit should be routable on new connection")
+	}
+}
+
+func TestRegistry_ReconnectGrace_Expires(t *testing.T) {
+	r := NewRegistry()
+	r.SetReconnectGrace(50 * time.Millisecond)
+
+	conn := newMockConn(1)
+	r.Register("hash-A", conn, []byte("key-config"))
+	r.MarkDisconnected("hash-A", conn)
+
+	time.Sleep(80 * time.Millisecond)
+	r.cleanup(90 * time.Second)
+
+	if r.Count() != 0 {
+		t.Error("exit should be removed after grace window")
+	}
+	if len(r.ListExitKeys()) != 0 {
+		t.Error("expired exit should no longer be advertised")
+	}
+}
+
+func TestRegistry_MarkDisconnected_NoGrace(t *testing.T) {
+	r := NewRegistry()
+
+	conn := newMockConn(1)
+	r.Register("hash-A", conn, []byte("key-config"))
+
+	if r.MarkDisconnected("hash-A", newMockConn(2)) {
+		t.Error("MarkDisconnected should ignore non-matching connection")
+	}
+	if !r.MarkDisconnected("hash-A", conn) {
+		t.Fatal("MarkDisconnected should match current connection")
+	}
+	if r.Count() != 0 {
+		t.Error("without grace window, disconnect should remove immediately")
+	}
+}
+
+func TestRegistry_MultipleInstancesRoundRobin(t *testing.T) {
+	r := NewRegistry()
+	const hash = "exit-scaled"
+
+	conns := []*mockConn{newMockConn(1), newMockConn(2), newMockConn(3)}
+	for _, conn := range conns {
+		r.Register(hash, conn, []byte("kc"))
+	}
+
+	// 在线的同 key 实例不互相替换
+	for _, conn := range conns {
+		if conn.closeCalls.Load() != 0 {
+			t.Fatalf("conn %d 不应被关闭", conn.id)
+		}
+	}
+	if r.Count() != 1 {
+		t.Fatalf("同一 pubKeyHash 应计为 1 个注册，实际 %d", r.Count())
+	}
+	if keys := r.ListExitKeys(); len(keys) != 1 {
+		t.Fatalf("同一 pubKeyHash 应只通告一次，实际 %d", len(keys))
+	}
+
+	picks := make(map[quic.Connection]int)
+	for i := 0; i < 3*len(conns); i++ {
+		conn, ok := r.Lookup(hash)
+		if !ok {
+			t.Fatal("Lookup 应成功")
+		}
+		picks[conn]++
+	}
+	for _, conn := range conns {
+		if picks[conn] != 3 {
+			t.Errorf("conn %d 被选中 %d 次，期望 3 次", conn.id, picks[conn])
+		}
+	}
+
+	// LookupAll 从轮询位置开始返回全部实例
+	if all := r.LookupAll(hash); len(all) != len(conns) {
+		t.Fatalf("LookupAll 返回 %d 个连接，期望 %d", len(all), len(conns))
+	}
+}
+
+func TestRegistry_RemoveIfMatchKeepsOtherInstances(t *testing.T) {
+	r := NewRegistry()
+	const hash = "exit-scaled"
+
+	conn1 := newMockConn(1)
+	conn2 := newMockConn(2)
+	r.Register(hash, conn1, []byte("kc"))
+	r.Register(hash, conn2, []byte("kc"))
+
+	if !r.RemoveIfMatch(hash, conn1) {
+		t.Fatal("RemoveIfMatch 应移除 conn1")
+	}
+	for i := 0; i < 4; i++ {
+		if got, ok := r.Lookup(hash); !ok || got != conn2 {
+			t.Fatal("移除 conn1 后应只路由到 conn2")
+		}
+	}
+	if conn2.closeCalls.Load() != 0 {
+		t.Fatal("conn2 不应被关闭")
+	}
+
+	if !r.RemoveIfMatch(hash, conn2) {
+		t.Fatal("RemoveIfMatch 应移除 conn2")
+	}
+	if r.Count() != 0 {
+		t.Fatalf("全部实例移除后注册数应为 0，实际 %d", r.Count())
+	}
+}
+
+func TestRegistry_ReconnectGrace_MultipleInstances(t *testing.T) {
+	r := NewRegistry()
+	r.SetReconnectGrace(time.Minute)
+	const hash = "exit-scaled"
+
+	conn1 := newMockConn(1)
+	conn2 := newMockConn(2)
+	r.Register(hash, conn1, []byte("kc"))
+	r.Register(hash, conn2, []byte("kc"))
+
+	// 仍有其他实例在线时断开的连接直接移除，不进入宽限期
+	r.MarkDisconnected(hash, conn1)
+	if r.IsReconnecting(hash) {
+		t.Fatal("仍有在线实例时不应处于重连中")
+	}
+	if all := r.LookupAll(hash); len(all) != 1 || all[0] != conn2 {
+		t.Fatalf("LookupAll = %v, want only conn2", all)
+	}
+
+	// 最后一个实例断开后进入宽限期
+	r.MarkDisconnected(hash, conn2)
+	if !r.IsReconnecting(hash) {
+		t.Fatal("全部实例断开后应处于重连中")
+	}
+
+	// 宽限期内重连替换断开的条目
+	conn3 := newMockConn(3)
+	r.Register(hash, conn3, []byte("kc"))
+	if all := r.LookupAll(hash); len(all) != 1 || all[0] != conn3 {
+		t.Fatalf("LookupAll = %v, want only conn3", all)
+	}
+	if keys := r.ListExitKeys(); len(keys) != 1 || keys[0].Reconnecting {
+		t.Fatalf("ListExitKeys = %+v, want hash online", keys)
+	}
+}
+
+func TestRegistry_ConcurrentInstances(t *testing.T) {
+	r := NewRegistry()
+	const hash = "exit-scaled"
+	const n = 50
+
+	conns := make([]*mockConn, n)
+	for i := range conns {
+		conns[i] = newMockConn(i)
+	}
+
+	// 并发注册同一 pubKeyHash 的多个实例，同时并发查找
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(2)
+		go func(c *mockConn) {
+			defer wg.Done()
+			r.Register(hash, c, []byte("kc"))
+		}(conn)
+		go func() {
+			defer wg.Done()
+			r.Lookup(hash)
+		}()
+	}
+	wg.Wait()
+
+	if all := r.LookupAll(hash); len(all) != n {
+		t.Fatalf("并发注册后应有 %d 个实例，实际 %d", n, len(all))
+	}
+
+	// 并发移除一半实例，同时并发查找和刷新心跳
+	for i, conn := range conns {
+		wg.Add(2)
+		go func(i int, c *mockConn) {
+			defer wg.Done()
+			if i%2 == 0 {
+				r.RemoveIfMatch(hash, c)
+			} else {
+				r.UpdateHeartbeatIfMatch(hash, c)
+			}
+		}(i, conn)
+		go func() {
+			defer wg.Done()
+			r.LookupAll(hash)
+		}()
+	}
+	wg.Wait()
+
+	remaining := make(map[quic.Connection]bool)
+	for _, conn := range r.LookupAll(hash) {
+		remaining[conn] = true
+	}
+	if len(remaining) != n/2 {
+		t.Fatalf("移除后应剩 %d 个实例，实际 %d", n/2, len(remaining))
+	}
+	for i, conn := range conns {
+		if remaining[conn] != (i%2 == 1) {
+			t.Errorf("conn %d: remaining = %v", i, remaining[conn])
+		}
+	}
+}
+
+func TestRegistry_AcquireStream(t *testing.T) {
+	registry := NewRegistry()
+	conn := newMockConn(1)
+	registry.RegisterWithMetadata("exit-hash-1", conn, nil, protocol.ExitMetadata{MaxConcurrentStreams: 1})
+
+	release, ok := registry.AcquireStream("exit-hash-1", conn)
+	if !ok {
+		t.Fatal("first acquire should succeed")
+	}
+	if _, ok := registry.AcquireStream("exit-hash-1", conn); ok {
+		t.Fatal("acquire beyond limit should fail")
+	}
+	release()
+	release() // 重复释放无副作用
+	if _, ok := registry.AcquireStream("exit-hash-1", conn); !ok {
+		t.Fatal("acquire after release should succeed")
+	}
+	if _, ok := registry.AcquireStream("exit-hash-1", conn); ok {
+		t.Fatal("double release must not free an extra slot")
+	}
+
+	// 未通告上限的 Exit 不受限制
+	other := newMockConn(2)
+	registry.Register("exit-hash-2", other, nil)
+	for i := 0; i < 10; i++ {
+		if _, ok := registry.AcquireStream("exit-hash-2", other); !ok {
+			t.Fatal("unlimited exit should always accept")
+		}
+	}
+}
+
+func TestRegistry_StructuredLogFields(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRegistry()
+	r.SetLogger(logging.NewWithHandler(logging.NewJSONHandler(&buf, slog.LevelInfo), "relay"))
+
+	r.Register("exit-hash-1", newMockConn(1), []byte("kc"))
+
+	var entry map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("invalid JSON log %q: %v", buf.String(), err)
+	}
+	if entry["exit_hash"] != "exit-hash-1" || entry["component"] != "relay" || entry["remote"] != "10.0.0.1:5001" {
+		t.Errorf("log entry = %v, want exit_hash/component/remote as structured keys", entry)
+	}
+	if strings.Contains(entry["msg"].(string), "exit-hash-1") {
+		t.Errorf("exit hash should not be embedded in msg: %q", entry["msg"])
+	}
+}
+
+func TestRegistry_Kick(t *testing.T) {
+	r := NewRegistry()
+	r.SetReconnectGrace(time.Minute)
+	conn1, conn2, other := newMockConn(1), newMockConn(2), newMockConn(3)
+	r.Register("hash1", conn1, []byte("key"))
+	r.Register("hash1", conn2, []byte("key"))
+	r.Register("hash2", other, []byte("key"))
+
+	if !r.Kick("hash1") {
+		t.Fatal("Kick(registered) = false, want true")
+	}
+	if _, ok := r.Lookup("hash1"); ok {
+		t.Error("kicked exit still registered")
+	}
+	if conn1.closeCalls.Load() != 1 || conn2.closeCalls.Load() != 1 {
+		t.Errorf("close calls = %d/%d, want every instance closed once", conn1.closeCalls.Load(), conn2.closeCalls.Load())
+	}
+	// 连接关闭后 handleExitConnection 的 MarkDisconnected 不会恢复已踢出的条目
+	if r.MarkDisconnected("hash1", conn1) || r.IsReconnecting("hash1") {
+		t.Error("kicked exit entered the reconnect grace period")
+	}
+
+	if other.closeCalls.Load() != 0 || r.Count() != 1 {
+		t.Errorf("other exit affected: closed=%d count=%d", other.closeCalls.Load(), r.Count())
+	}
+	if r.Kick("hash1") || r.Kick("unknown") {
+		t.Error("Kick(unregistered) = true, want false")
+	}
+}
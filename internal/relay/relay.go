@@ -5,15 +5,16 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
-	"os"
-	"os/signal"
-	"syscall"
+	"sync"
 	"time"
 
 	"github.com/binn/tokengo/internal/cert"
 	"github.com/binn/tokengo/internal/config"
 	"github.com/binn/tokengo/internal/dht"
 	"github.com/binn/tokengo/internal/identity"
+	"github.com/binn/tokengo/internal/logging"
+	"github.com/binn/tokengo/internal/metrics"
+	"github.com/libp2p/go-libp2p/core/crypto"
 )
 
 // RelayNode 中继节点
@@ -23,12 +24,21 @@ type RelayNode struct {
 	registry   *Registry
 	dhtNode    *dht.Node
 	provider   *dht.Provider
+	metrics    metrics.Sink
+	admin      *AdminServer // 管理接口，未配置时为 nil
 	ctx        context.Context
 	cancel     context.CancelFunc
+
+	unregisterOnce sync.Once // Drain 和 Stop 共用，DHT 服务注册只取消一次
 }
 
 // New 创建中继节点
 func New(cfg *config.RelayConfig) (*RelayNode, error) {
+	quicParams := cfg.QUIC.WithDefaults(config.DefaultQUICParams())
+	if err := quicParams.Validate(); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	node := &RelayNode{
@@ -39,13 +49,18 @@ func New(cfg *config.RelayConfig) (*RelayNode, error) {
 
 	// 创建 Exit 注册表
 	node.registry = NewRegistry()
+	node.registry.SetReconnectGrace(cfg.ExitReconnectGrace)
 
 	// 加载或创建 DHT 身份
 	var id*identity.Identity
 	var err error
 
 	if cfg.DHT.PrivateKeyFile != "" {
-		id, err = identity.LoadOrGenerate(cfg.DHT.PrivateKeyFile)
+		if cfg.NoAutoGenerate {
+			id, err = identity.LoadExisting(cfg.DHT.PrivateKeyFile)
+		} else {
+			id, err = identity.LoadOrGenerate(cfg.DHT.PrivateKeyFile)
+		}
 		if err != nil {
 			cancel()
 			return nil, fmt.Errorf("加载 DHT 身份失败: %w", err)
@@ -59,14 +74,38 @@ func New(cfg *config.RelayConfig) (*RelayNode, error) {
 		}
 	}
 
-	// 生成绑定 PeerID 的 TLS 证书（自动生成）
-	tlsCert, err := cert.GeneratePeerIDCert(id.PrivKey, "./certs")
+	// 身份密钥轮换期间加载旧身份，证书同时由新旧身份签名
+	var transitional []crypto.PrivKey
+	if cfg.DHT.TransitionalPrivateKeyFile != "" {
+		old, err := identity.LoadExisting(cfg.DHT.TransitionalPrivateKeyFile)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("加载过渡身份失败: %w", err)
+		}
+		transitional = append(transitional, old.PrivKey)
+		log.Printf("身份密钥轮换中，过渡 PeerID: %s", old.PeerID)
+	}
+
+	// 生成绑定 PeerID 的 TLS 证书（自动生成），附加配置的域名/IP
+	sans, err := cert.ParseSANs(cfg.CertSANs)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("解析证书 SAN 配置失败: %w", err)
+	}
+	tlsCert, err := cert.GenerateTransitionalPeerIDCert(id.PrivKey, transitional, "./certs", sans)
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("生成 TLS 证书失败: %w", err)
 	}
 	log.Printf("已自动生成 TLS 证书 (PeerID: %s)", id.PeerID)
 
+	// 结构化日志附加本 Relay 的 PeerID
+	logger := logging.New("relay").With(logging.KeyPeerID, id.PeerID.String())
+	node.registry.SetLogger(logger)
+	if len(cfg.CertSANs) > 0 {
+		log.Printf("证书附加 SAN: %v", cfg.CertSANs)
+	}
+
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{*tlsCert},
 		NextProtos:   []string{"tokengo-relay", "tokengo-exit"},
@@ -82,6 +121,15 @@ func New(cfg *config.RelayConfig) (*RelayNode, error) {
 			ExternalAddrs:  cfg.DHT.ExternalAddrs,
 			Mode:           "server",
 			ServiceType:    "relay",
+			NoAutoGenerate: cfg.NoAutoGenerate,
+
+			RegisterMinBackoff: cfg.DHT.RegisterMinBackoff,
+			RegisterMaxBackoff: cfg.DHT.RegisterMaxBackoff,
+			RegisterMaxRetries: cfg.DHT.RegisterMaxRetries,
+			EnableMDNS:         cfg.DHT.EnableMDNS,
+			NetworkID:          cfg.DHT.NetworkID,
+
+			TransitionalKeyPath: cfg.DHT.TransitionalPrivateKeyFile,
 		}
 
 		dhtNode, err := dht.NewNode(dhtCfg)
@@ -93,8 +141,38 @@ func New(cfg *config.RelayConfig) (*RelayNode, error) {
 		node.provider = dht.NewProvider(dhtNode, "relay")
 	}
 
+	// 创建指标输出
+	sink, err := metrics.New(cfg.Metrics)
+	if err != nil {
+		if node.dhtNode != nil {
+			node.dhtNode.Stop()
+		}
+		cancel()
+		return nil, fmt.Errorf("创建指标输出失败: %w", err)
+	}
+	node.metrics = sink
+
 	// 创建 QUIC 服务器
 	node.quicServer = NewQUICServer(cfg.Listen, tlsConfig, node.registry)
+	node.quicServer.SetMetrics(sink)
+	node.quicServer.SetLogger(logger)
+	node.quicServer.SetQUICParams(quicParams)
+	node.quicServer.SetMaxRequestTimeout(cfg.MaxRequestTimeout)
+	node.quicServer.SetClientRateLimit(cfg.ClientRateLimit.RequestsPerSecond, cfg.ClientRateLimit.Burst)
+
+	// 启动管理接口
+	if cfg.Admin.Listen != "" {
+		admin, err := ServeAdmin(cfg.Admin.Listen, cfg.Admin.Token, node.registry, logger)
+		if err != nil {
+			sink.Close()
+			if node.dhtNode != nil {
+				node.dhtNode.Stop()
+			}
+			cancel()
+			return nil, err
+		}
+		node.admin = admin
+	}
 
 	return node, nil
 }
@@ -126,38 +204,67 @@ func (r *RelayNode) Start() error {
 		}
 	}
 
-	// 处理关闭信号
-	go r.handleShutdown()
-
 	// 启动 QUIC 服务器
 	return r.quicServer.Start(r.ctx)
 }
 
-// handleShutdown 处理优雅关闭
-func (r *RelayNode) handleShutdown() {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	<-sigChan
-	log.Println("收到关闭信号，正在关闭...")
-	r.Stop()
-}
-
 // Stop 停止中继节点
 func (r *RelayNode) Stop() error {
 	// 停止 DHT 服务
-	if r.provider != nil {
-		r.provider.Unregister()
-	}
+	r.unregister()
 	if r.dhtNode != nil {
 		r.dhtNode.Stop()
 	}
 
 	r.cancel()
-	return r.quicServer.Stop()
+	if r.admin != nil {
+		r.admin.Close()
+	}
+	err := r.quicServer.Stop()
+	r.logUsage()
+	r.metrics.Close()
+	return err
+}
+
+// Accounting 返回按租户统计的转发用量
+func (r *RelayNode) Accounting() *Accounting {
+	return r.quicServer.Accounting()
+}
+
+// logUsage 输出各租户的累计用量
+func (r *RelayNode) logUsage() {
+	accounting := r.quicServer.Accounting()
+	for _, tenant := range accounting.Tenants() {
+		u := accounting.Usage(tenant)
+		log.Printf("租户 %s 用量: %d 个请求，上行 %d 字节，下行 %d 字节", tenant, u.Requests, u.BytesIn, u.BytesOut)
+	}
+}
+
+// Drain 优雅排空 QUIC 服务器: 拒绝新请求，等待进行中的请求完成 (最长到 ctx 截止)
+// 排空前先取消 DHT 服务注册，Client 不再发现正在排空的 Relay；之后仍需调用 Stop 停止 DHT 节点和后台任务
+func (r *RelayNode) Drain(ctx context.Context) error {
+	r.unregister()
+	return r.quicServer.Drain(ctx)
+}
+
+// unregister 取消 DHT 服务注册，Drain 和 Stop 都会调用，只执行一次
+func (r *RelayNode) unregister() {
+	if r.provider == nil {
+		return
+	}
+	r.unregisterOnce.Do(r.provider.Unregister)
 }
 
 // Ready 返回就绪信号 channel，当 Relay 节点成功启动后会关闭该 channel
 func (r *RelayNode) Ready() <-chan struct{} {
 	return r.quicServer.Ready()
 }
+
+// RoutingTableReport 返回 DHT 路由表快照，未启用 DHT 或未启动时返回 nil
+// dhtNode 只在构造时设置，可在 Start 期间并发调用
+func (r *RelayNode) RoutingTableReport(sample int) *dht.RoutingTableReport {
+	if r.dhtNode == nil {
+		return nil
+	}
+	return r.dhtNode.RoutingTableReport(sample)
+}
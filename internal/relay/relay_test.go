@@ -0,0 +1,25 @@
+package relay
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/binn/tokengo/internal/config"
+	"github.com/binn/tokengo/internal/identity"
+)
+
+func TestNew_NoAutoGenerateMissingIdentity(t *testing.T) {
+	cfg := &config.RelayConfig{
+		Listen: "127.0.0.1:0",
+		DHT: config.DHTConfig{
+			PrivateKeyFile: filepath.Join(t.TempDir(), "identity.key"),
+		},
+		NoAutoGenerate: true,
+	}
+
+	_, err := New(cfg)
+	if !errors.Is(err, identity.ErrKeyNotFound) {
+		t.Fatalf("err = %v, want identity.ErrKeyNotFound", err)
+	}
+}
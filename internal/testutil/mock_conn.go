@@ -27,20 +27,50 @@ type MockConn struct {
 
 	alpn string
 	mu   sync.Mutex
+
+	// QUIC datagram 支持: 未启用时 SendDatagram/ReceiveDatagram 返回错误
+	datagrams  bool
+	sentDgrams chan []byte
+	recvDgrams chan []byte
 }
 
 // NewMockConn 创建新的 mock 连接
 func NewMockConn(id int) *MockConn {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &MockConn{
-		ID:       id,
-		ctx:      ctx,
-		cancel:   cancel,
-		acceptCh: make(chan quic.Stream, 16),
-		openCh:   make(chan quic.Stream, 16),
+		ID:         id,
+		ctx:        ctx,
+		cancel:     cancel,
+		acceptCh:   make(chan quic.Stream, 16),
+		openCh:     make(chan quic.Stream, 16),
+		sentDgrams: make(chan []byte, 16),
+		recvDgrams: make(chan []byte, 16),
 	}
 }
 
+// EnableDatagrams 模拟双方协商启用了 QUIC datagram
+func (m *MockConn) EnableDatagrams() {
+	m.mu.Lock()
+	m.datagrams = true
+	m.mu.Unlock()
+}
+
+// PushDatagram 预装一个 datagram 供 ReceiveDatagram 返回
+func (m *MockConn) PushDatagram(data []byte) {
+	m.recvDgrams <- data
+}
+
+// SentDatagrams 返回 SendDatagram 发出的 datagram
+func (m *MockConn) SentDatagrams() <-chan []byte {
+	return m.sentDgrams
+}
+
+func (m *MockConn) supportsDatagrams() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.datagrams
+}
+
 // NewMockConnWithALPN 创建带 ALPN 的 mock 连接
 func NewMockConnWithALPN(id int, alpn string) *MockConn {
 	mc := NewMockConn(id)
@@ -127,13 +157,28 @@ func (m *MockConn) ConnectionState() quic.ConnectionState {
 		TLS: tls.ConnectionState{
 			NegotiatedProtocol: m.alpn,
 		},
+		SupportsDatagrams: m.supportsDatagrams(),
 	}
 }
 
-func (m *MockConn) SendDatagram(_ []byte) error {
-	return fmt.Errorf("not implemented")
+func (m *MockConn) SendDatagram(data []byte) error {
+	if !m.supportsDatagrams() {
+		return fmt.Errorf("datagram support disabled")
+	}
+	m.sentDgrams <- append([]byte(nil), data...)
+	return nil
 }
 
-func (m *MockConn) ReceiveDatagram(_ context.Context) ([]byte, error) {
-	return nil, fmt.Errorf("not implemented")
+func (m *MockConn) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	if !m.supportsDatagrams() {
+		return nil, fmt.Errorf("datagram support disabled")
+	}
+	select {
+	case data := <-m.recvDgrams:
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-m.ctx.Done():
+		return nil, fmt.Errorf("connection closed")
+	}
 }
@@ -0,0 +1,61 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrModelRequired 请求的 model 字段缺失或为空
+var ErrModelRequired = errors.New("model is required")
+
+// modelRequiredSuffixes 请求体必须携带 model 的端点 (OpenAI / Anthropic 风格)
+// Gemini 等在路径中指定模型的协议不在此列
+var modelRequiredSuffixes = []string{"/completions", "/embeddings", "/messages", "/responses"}
+
+// ValidateModel 校验请求体中的 model 字段
+// JSON 请求体中出现的 model 不能为 null、空串或纯空白；上述端点的请求必须包含 model
+// 非 JSON 对象的请求体不做校验
+func ValidateModel(path string, body []byte) error {
+	var fields map[string]json.RawMessage
+	if len(body) == 0 || json.Unmarshal(body, &fields) != nil {
+		return nil
+	}
+
+	raw, ok := fields["model"]
+	if !ok {
+		if requiresModel(path) {
+			return ErrModelRequired
+		}
+		return nil
+	}
+
+	if string(raw) == "null" {
+		return ErrModelRequired
+	}
+	var model string
+	if json.Unmarshal(raw, &model) == nil && strings.TrimSpace(model) == "" {
+		return ErrModelRequired
+	}
+	return nil
+}
+
+// ModelRequiredError model 校验失败时返回给调用方的错误详情
+func ModelRequiredError() ErrorDetail {
+	param := "model"
+	return ErrorDetail{
+		Message: ErrModelRequired.Error(),
+		Type:    "invalid_request_error",
+		Param:   &param,
+		Code:    "model_required",
+	}
+}
+
+func requiresModel(path string) bool {
+	for _, suffix := range modelRequiredSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
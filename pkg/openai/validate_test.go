@@ -0,0 +1,37 @@
+package openai
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		wantErr bool
+	}{
+		{"valid", "/v1/chat/completions", `{"model":"gpt-4","messages":[]}`, false},
+		{"empty", "/v1/chat/completions", `{"model":"","messages":[]}`, true},
+		{"whitespace", "/v1/chat/completions", `{"model":"  \t","messages":[]}`, true},
+		{"null", "/v1/chat/completions", `{"model":null,"messages":[]}`, true},
+		{"missing", "/v1/chat/completions", `{"messages":[]}`, true},
+		{"missing anthropic", "/v1/messages", `{"messages":[]}`, true},
+		{"missing on path without model", "/v1beta/models/gemini-pro:generateContent", `{"contents":[]}`, false},
+		{"empty on any path", "/v1beta/models/gemini-pro:generateContent", `{"model":" "}`, true},
+		{"non-json body", "/v1/chat/completions", `not json`, false},
+		{"no body", "/v1/models", ``, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateModel(tt.path, []byte(tt.body))
+			if tt.wantErr && !errors.Is(err, ErrModelRequired) {
+				t.Errorf("err = %v, want ErrModelRequired", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("err = %v, want nil", err)
+			}
+		})
+	}
+}
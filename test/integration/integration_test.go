@@ -16,6 +16,7 @@ import (
 
 	"github.com/binn/tokengo/internal/cert"
 	"github.com/binn/tokengo/internal/client"
+	"github.com/binn/tokengo/internal/config"
 	"github.com/binn/tokengo/internal/crypto"
 	"github.com/binn/tokengo/internal/exit"
 	"github.com/binn/tokengo/internal/identity"
@@ -30,6 +31,7 @@ type testEnv struct {
 	keyConfig  []byte
 	pubKeyHash string
 	registry   *relay.Registry
+	accounting *relay.Accounting
 	cancel     context.CancelFunc
 }
 
@@ -47,6 +49,12 @@ func getFreeUDPAddr(t *testing.T) string {
 // setupIntegrationTest 启动完整的 Client→Relay→Exit 链路
 func setupIntegrationTest(t *testing.T, backendHandler http.HandlerFunc) *testEnv {
 	t.Helper()
+	return setupIntegrationTestWithQUIC(t, backendHandler, config.QUICParams{}, config.QUICParams{})
+}
+
+// setupIntegrationTestWithQUIC 启动完整链路，Relay 和 Exit 使用指定的 QUIC 参数 (未设置的字段使用默认值)
+func setupIntegrationTestWithQUIC(t *testing.T, backendHandler http.HandlerFunc, relayQUIC, exitQUIC config.QUICParams) *testEnv {
+	t.Helper()
 
 	// 1. AI 后端
 	backend := httptest.NewServer(backendHandler)
@@ -75,6 +83,7 @@ func setupIntegrationTest(t *testing.T, backendHandler http.HandlerFunc) *testEn
 	relayAddr := getFreeUDPAddr(t)
 	registry := relay.NewRegistry()
 	quicServer := relay.NewQUICServer(relayAddr, serverTLSConfig, registry)
+	quicServer.SetQUICParams(relayQUIC)
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -101,6 +110,7 @@ func setupIntegrationTest(t *testing.T, backendHandler http.HandlerFunc) *testEn
 	}
 
 	tunnel := exit.NewTunnelClientStatic(relayAddr, pubKeyHash, keyConfig, ohttpHandler)
+	tunnel.SetQUICParams(exitQUIC)
 
 	go func() {
 		tunnel.Start(ctx)
@@ -127,6 +137,7 @@ func setupIntegrationTest(t *testing.T, backendHandler http.HandlerFunc) *testEn
 		keyConfig:  keyConfig,
 		pubKeyHash: pubKeyHash,
 		registry:   registry,
+		accounting: quicServer.Accounting(),
 		cancel:     cancel,
 	}
 }
@@ -303,6 +314,46 @@ func TestIntegration_QueryExitKeys(t *testing.T) {
 	}
 }
 
+func TestIntegration_QueryStatus(t *testing.T) {
+	testStart := time.Now()
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	c := newTestClient(t, env)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status, err := c.QueryStatus(ctx)
+	if err != nil {
+		t.Fatalf("QueryStatus failed: %v", err)
+	}
+
+	if uptime := status.Uptime(); uptime < 0 || uptime > time.Since(testStart) {
+		t.Errorf("Uptime = %v, want within the test's lifetime", uptime)
+	}
+	if len(status.Exits) != 1 {
+		t.Fatalf("len(Exits) = %d, want 1", len(status.Exits))
+	}
+	e := status.Exits[0]
+	if e.PubKeyHash != env.pubKeyHash {
+		t.Errorf("PubKeyHash = %s, want %s", e.PubKeyHash, env.pubKeyHash)
+	}
+	if e.Instances != 1 || e.Reconnecting {
+		t.Errorf("exit status = %+v, want one online instance", e)
+	}
+	if age := e.LastHeartbeatAge(); age < 0 || age > time.Minute {
+		t.Errorf("LastHeartbeatAge = %v, want a recent heartbeat", age)
+	}
+
+	var out strings.Builder
+	client.PrintStatus(&out, env.relayAddr, status)
+	if !strings.Contains(out.String(), env.pubKeyHash) {
+		t.Errorf("PrintStatus output missing pubKeyHash:\n%s", out.String())
+	}
+}
+
 func TestIntegration_MultipleRequests(t *testing.T) {
 	var requestCount atomic.Int32
 	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
@@ -350,3 +401,636 @@ func TestIntegration_MultipleRequests(t *testing.T) {
 		t.Errorf("AI backend received %d requests, want 10", got)
 	}
 }
+
+func TestIntegration_DiagnoseRegisteredExit(t *testing.T) {
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list","data":[]}`))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	report := client.Diagnose(ctx, env.relayAddr, env.pubKeyHash)
+	if !report.OK() {
+		t.Fatalf("diagnose should succeed, failed step: %+v", report.Failed())
+	}
+	if len(report.Steps) != 3 {
+		t.Errorf("len(Steps) = %d, want 3", len(report.Steps))
+	}
+}
+
+func TestIntegration_DiagnoseUnregisteredExit(t *testing.T) {
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	report := client.Diagnose(ctx, env.relayAddr, "nonexistent-exit-hash")
+	if report.OK() {
+		t.Fatal("diagnose should fail for unregistered exit")
+	}
+	failed := report.Failed()
+	if failed.Name != client.StepExitRegistered {
+		t.Errorf("failed step = %q, want %q", failed.Name, client.StepExitRegistered)
+	}
+	if !strings.Contains(failed.Detail, "未在 Relay 注册") {
+		t.Errorf("failure detail should explain exit is not registered, got: %s", failed.Detail)
+	}
+
+	var out bytes.Buffer
+	report.Print(&out)
+	if !strings.Contains(out.String(), "FAIL") {
+		t.Errorf("report should mark failed step, got:\n%s", out.String())
+	}
+}
+
+func TestIntegration_ClientPingRelay(t *testing.T) {
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	c := newTestClient(t, env)
+
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+}
+
+func TestIntegration_ProxyBasePath(t *testing.T) {
+	var gotPath atomic.Value
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath.Store(r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	})
+
+	proxy, err := client.NewStaticProxy("127.0.0.1:0", env.relayAddr, env.ohttpKeys.KeyID, env.ohttpKeys.PublicKey)
+	if err != nil {
+		t.Fatalf("NewStaticProxy failed: %v", err)
+	}
+	t.Cleanup(func() { proxy.Stop() })
+	proxy.SetBasePath("/ai/")
+
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+
+	reqBody := `{"model":"test","messages":[{"role":"user","content":"hi"}]}`
+	resp, err := http.Post(server.URL+"/ai/v1/chat/completions", "application/json", strings.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("StatusCode = %d, want 200", resp.StatusCode)
+	}
+	if p, _ := gotPath.Load().(string); p != "/v1/chat/completions" {
+		t.Errorf("backend path = %q, want prefix stripped /v1/chat/completions", p)
+	}
+
+	// 前缀之外的请求不转发
+	resp, err = http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unprefixed StatusCode = %d, want 404", resp.StatusCode)
+	}
+}
+
+// TestIntegration_ProxyTopology 验证拓扑导出端点包含当前 Relay 和已注册的 Exit
+func TestIntegration_ProxyTopology(t *testing.T) {
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	})
+
+	proxy, err := client.NewStaticProxy("127.0.0.1:0", env.relayAddr, env.ohttpKeys.KeyID, env.ohttpKeys.PublicKey)
+	if err != nil {
+		t.Fatalf("NewStaticProxy failed: %v", err)
+	}
+	t.Cleanup(func() { proxy.Stop() })
+	proxy.SetBasePath("/ai")
+
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + "/ai" + client.TopologyPath)
+	if err != nil {
+		t.Fatalf("GET topology failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("StatusCode = %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	var topo client.Topology
+	if err := json.NewDecoder(resp.Body).Decode(&topo); err != nil {
+		t.Fatalf("decode topology: %v", err)
+	}
+	if topo.Error != "" {
+		t.Fatalf("topology error: %s", topo.Error)
+	}
+
+	if len(topo.Relays) != 1 || len(topo.Relays[0].Addrs) != 1 || topo.Relays[0].Addrs[0] != env.relayAddr {
+		t.Errorf("Relays = %+v, want single relay %s", topo.Relays, env.relayAddr)
+	}
+	if topo.Relays[0].RTTMs <= 0 {
+		t.Errorf("Relay RTT 应大于 0, got %v", topo.Relays[0].RTTMs)
+	}
+
+	found := false
+	for _, e := range topo.Exits {
+		if e.PubKeyHash == env.pubKeyHash {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Exits = %+v, want to include %s", topo.Exits, env.pubKeyHash)
+	}
+}
+
+// TestIntegration_ResponseModeStream 验证 stream 模式下非流式请求内部流式传输，客户端仍收到完整 JSON
+func TestIntegration_ResponseModeStream(t *testing.T) {
+	respBody := `{"object":"list","data":[{"embedding":[` + strings.Repeat("0.1,", 20000) + `0.1]}]}`
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(respBody))
+	})
+
+	proxy, err := client.NewStaticProxy("127.0.0.1:0", env.relayAddr, env.ohttpKeys.KeyID, env.ohttpKeys.PublicKey)
+	if err != nil {
+		t.Fatalf("NewStaticProxy failed: %v", err)
+	}
+	t.Cleanup(func() { proxy.Stop() })
+	if err := proxy.SetResponseModes(map[string]string{"/v1/embeddings": client.ResponseModeStream}); err != nil {
+		t.Fatalf("SetResponseModes failed: %v", err)
+	}
+
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+
+	resp, err := http.Post(server.URL+"/v1/embeddings", "application/json", strings.NewReader(`{"model":"test","input":"hi"}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("StatusCode = %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != respBody {
+		t.Errorf("body mismatch: got %d bytes, want %d", len(body), len(respBody))
+	}
+}
+
+// TestIntegration_ResponseModeBuffer 验证 buffer 模式下流式请求被整体缓冲，事件完整返回
+func TestIntegration_ResponseModeBuffer(t *testing.T) {
+	events := []string{
+		`data: {"choices":[{"delta":{"content":"Hello"}}]}`,
+		`data: {"choices":[{"delta":{"content":" world"}}]}`,
+		`data: [DONE]`,
+	}
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			fmt.Fprintf(w, "%s\n\n", e)
+		}
+	})
+
+	proxy, err := client.NewStaticProxy("127.0.0.1:0", env.relayAddr, env.ohttpKeys.KeyID, env.ohttpKeys.PublicKey)
+	if err != nil {
+		t.Fatalf("NewStaticProxy failed: %v", err)
+	}
+	t.Cleanup(func() { proxy.Stop() })
+	if err := proxy.SetResponseModes(map[string]string{"/v1/*": client.ResponseModeBuffer}); err != nil {
+		t.Fatalf("SetResponseModes failed: %v", err)
+	}
+
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+
+	reqBody := `{"model":"test","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("StatusCode = %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, e := range events {
+		if !bytes.Contains(body, []byte(e)) {
+			t.Errorf("buffered body missing event %q", e)
+		}
+	}
+}
+
+// newIntegrationProxyServer 创建连接测试环境 Relay 的静态代理并以 httptest 提供服务
+func newIntegrationProxyServer(t *testing.T, env *testEnv) *httptest.Server {
+	t.Helper()
+	proxy, err := client.NewStaticProxy("127.0.0.1:0", env.relayAddr, env.ohttpKeys.KeyID, env.ohttpKeys.PublicKey)
+	if err != nil {
+		t.Fatalf("NewStaticProxy failed: %v", err)
+	}
+	t.Cleanup(func() { proxy.Stop() })
+
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestIntegration_EmbeddingsRoundTrip 验证 /v1/embeddings 请求经代理完整往返
+func TestIntegration_EmbeddingsRoundTrip(t *testing.T) {
+	const respBody = `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,-0.2,0.3]}],"model":"embed"}`
+	var gotPath, gotBody atomic.Value
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPath.Store(r.URL.Path)
+		gotBody.Store(string(body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(respBody))
+	})
+	server := newIntegrationProxyServer(t, env)
+
+	reqBody := `{"model":"embed","input":"hello"}`
+	resp, err := http.Post(server.URL+"/v1/embeddings", "application/json", strings.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("StatusCode = %d, want 200", resp.StatusCode)
+	}
+	if p, _ := gotPath.Load().(string); p != "/v1/embeddings" {
+		t.Errorf("backend path = %q, want /v1/embeddings", p)
+	}
+	if b, _ := gotBody.Load().(string); b != reqBody {
+		t.Errorf("backend body = %q, want %q", b, reqBody)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != respBody {
+		t.Errorf("body = %q, want %q", body, respBody)
+	}
+}
+
+// TestIntegration_CompletionsStreaming 验证 /v1/completions 同样按 stream 标志流式转发
+func TestIntegration_CompletionsStreaming(t *testing.T) {
+	events := []string{
+		`data: {"choices":[{"text":"Hel"}]}`,
+		`data: {"choices":[{"text":"lo"}]}`,
+		`data: [DONE]`,
+	}
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			fmt.Fprintf(w, "%s\n\n", e)
+			w.(http.Flusher).Flush()
+		}
+	})
+	server := newIntegrationProxyServer(t, env)
+
+	reqBody := `{"model":"test","prompt":"hi","stream":true}`
+	resp, err := http.Post(server.URL+"/v1/completions", "application/json", strings.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, e := range events {
+		if !bytes.Contains(body, []byte(e)) {
+			t.Errorf("streamed body missing event %q", e)
+		}
+	}
+}
+
+// TestIntegration_NonJSONContentType 验证非 JSON 响应保留后端的 Content-Type
+func TestIntegration_NonJSONContentType(t *testing.T) {
+	audio := []byte{0xff, 0xfb, 0x90, 0x00, 0x01, 0x02, 0x03}
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write(audio)
+	})
+	server := newIntegrationProxyServer(t, env)
+
+	reqBody := `{"model":"tts","input":"hello","voice":"alloy"}`
+	resp, err := http.Post(server.URL+"/v1/audio/speech", "application/json", strings.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("StatusCode = %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "audio/mpeg" {
+		t.Errorf("Content-Type = %q, want audio/mpeg", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(body, audio) {
+		t.Errorf("body = %x, want %x", body, audio)
+	}
+}
+
+// TestIntegration_ResponseHeadersPropagated 验证后端响应头 (请求 ID、限流信息) 经 OHTTP 到达本地调用方
+func TestIntegration_ResponseHeadersPropagated(t *testing.T) {
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "req-from-backend")
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "0")
+		w.Header().Set("Retry-After", "12")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"rate limited","type":"rate_limit_error"}}`))
+	})
+	server := newIntegrationProxyServer(t, env)
+
+	reqBody := `{"model":"test","messages":[{"role":"user","content":"hi"}]}`
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("StatusCode = %d, want 429", resp.StatusCode)
+	}
+	want := map[string]string{
+		"X-Request-Id":                   "req-from-backend",
+		"X-Ratelimit-Remaining-Requests": "0",
+		"Retry-After":                    "12",
+		"Content-Type":                   "application/json",
+	}
+	for key, value := range want {
+		if got := resp.Header.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+// startCapabilityExit 在测试环境的 Relay 上注册一个通告指定端点能力的 Exit
+func startCapabilityExit(t *testing.T, env *testEnv, caps []string, backendHandler http.HandlerFunc) *crypto.KeyPair {
+	t.Helper()
+
+	backend := httptest.NewServer(backendHandler)
+	t.Cleanup(backend.Close)
+
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %v", err)
+	}
+	ohttpHandler, err := exit.NewOHTTPHandler(kp.KeyID, kp.PrivateKey, kp.PublicKey, exit.NewAIClient(backend.URL, "", nil))
+	if err != nil {
+		t.Fatalf("NewOHTTPHandler failed: %v", err)
+	}
+
+	tunnel := exit.NewTunnelClientStatic(env.relayAddr, crypto.PubKeyHash(kp.PublicKey), crypto.EncodeKeyConfig(kp.KeyID, kp.PublicKey), ohttpHandler)
+	tunnel.SetCapabilities(caps)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go tunnel.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		tunnel.Stop()
+	})
+
+	select {
+	case <-tunnel.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Exit 注册超时")
+	}
+	return kp
+}
+
+// TestIntegration_EndpointCapabilityRouting 验证 embeddings 请求只发往通告 embeddings 能力的 Exit
+func TestIntegration_EndpointCapabilityRouting(t *testing.T) {
+	var defaultHits atomic.Int32
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		defaultHits.Add(1)
+		w.Write([]byte(`{"exit":"default"}`))
+	})
+
+	var chatHits, embeddingsHits atomic.Int32
+	chatKeys := startCapabilityExit(t, env, []string{"chat"}, func(w http.ResponseWriter, r *http.Request) {
+		chatHits.Add(1)
+		w.Write([]byte(`{"exit":"chat"}`))
+	})
+	startCapabilityExit(t, env, []string{"embeddings"}, func(w http.ResponseWriter, r *http.Request) {
+		embeddingsHits.Add(1)
+		w.Write([]byte(`{"exit":"embeddings"}`))
+	})
+
+	// 代理默认使用仅支持 chat 的 Exit
+	proxy, err := client.NewStaticProxy("127.0.0.1:0", env.relayAddr, chatKeys.KeyID, chatKeys.PublicKey)
+	if err != nil {
+		t.Fatalf("NewStaticProxy failed: %v", err)
+	}
+	t.Cleanup(func() { proxy.Stop() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := proxy.RefreshExits(ctx); err != nil {
+		t.Fatalf("RefreshExits failed: %v", err)
+	}
+
+	server := httptest.NewServer(proxy.Handler())
+	t.Cleanup(server.Close)
+
+	post := func(path, body string) string {
+		t.Helper()
+		resp, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST %s StatusCode = %d, body %s", path, resp.StatusCode, data)
+		}
+		return string(data)
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := post("/v1/embeddings", `{"model":"test","input":"hi"}`); got != `{"exit":"embeddings"}` {
+			t.Errorf("embeddings response = %s, want from embeddings exit", got)
+		}
+	}
+	if got := post("/v1/chat/completions", `{"model":"test","messages":[]}`); got != `{"exit":"chat"}` {
+		t.Errorf("chat response = %s, want from current chat exit", got)
+	}
+
+	if embeddingsHits.Load() != 3 || chatHits.Load() != 1 || defaultHits.Load() != 0 {
+		t.Errorf("hits: embeddings=%d chat=%d default=%d, want 3/1/0",
+			embeddingsHits.Load(), chatHits.Load(), defaultHits.Load())
+	}
+}
+
+// TestIntegration_TenantAccounting 验证租户标识只到达 Relay 并按租户统计用量
+func TestIntegration_TenantAccounting(t *testing.T) {
+	var leaked atomic.Bool
+	env := setupIntegrationTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(client.TenantHeader) != "" {
+			leaked.Store(true)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list","data":[]}`))
+	})
+	server := newIntegrationProxyServer(t, env)
+
+	send := func(tenant string) {
+		req, _ := http.NewRequest("POST", server.URL+"/v1/embeddings", strings.NewReader(`{"model":"embed","input":"hi"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if tenant != "" {
+			req.Header.Set(client.TenantHeader, tenant)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want 200", resp.StatusCode)
+		}
+	}
+
+	send("team-a")
+	send("team-a")
+	send("team-b")
+	send("")
+
+	if leaked.Load() {
+		t.Error("租户 header 不应到达后端")
+	}
+
+	a, b := env.accounting.Usage("team-a"), env.accounting.Usage("team-b")
+	if a.Requests != 2 || b.Requests != 1 {
+		t.Errorf("requests = team-a:%d team-b:%d, want 2 and 1", a.Requests, b.Requests)
+	}
+	if b.BytesIn == 0 || b.BytesOut == 0 {
+		t.Errorf("team-b bytes = %+v, want non-zero", b)
+	}
+	if a.BytesIn != 2*b.BytesIn || a.BytesOut != 2*b.BytesOut {
+		t.Errorf("team-a = %+v, want twice team-b %+v", a, b)
+	}
+	if got := env.accounting.Tenants(); len(got) != 2 {
+		t.Errorf("tenants = %v, untagged requests should not be recorded", got)
+	}
+}
+
+// slowBackend 第一个请求延迟 delay 后返回，其余请求立即返回；started 在第一个请求到达后关闭
+func slowBackend(delay time.Duration, started chan struct{}) http.HandlerFunc {
+	var first atomic.Bool
+	return func(w http.ResponseWriter, r *http.Request) {
+		if first.CompareAndSwap(false, true) {
+			close(started)
+			time.Sleep(delay)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"ok"}`))
+	}
+}
+
+// sendAsync 在后台发送一个非流式请求，返回响应状态码 (失败时为 0)
+func sendAsync(t *testing.T, c *client.Client) <-chan int {
+	t.Helper()
+	result := make(chan int, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, status, _, err := c.SendRequestRaw(ctx, http.MethodPost, "/v1/chat/completions", []byte(`{"model":"test"}`), nil)
+		if err != nil {
+			t.Logf("request failed: %v", err)
+		}
+		result <- status
+	}()
+	return result
+}
+
+// TestIntegration_ExitTunnelMaxLifetime 验证 Exit 隧道到期后换用新连接，旧连接上进行中的请求正常完成
+func TestIntegration_ExitTunnelMaxLifetime(t *testing.T) {
+	started := make(chan struct{})
+	env := setupIntegrationTestWithQUIC(t, slowBackend(1500*time.Millisecond, started),
+		config.QUICParams{}, config.QUICParams{MaxLifetime: 500 * time.Millisecond})
+
+	original := env.registry.LookupAll(env.pubKeyHash)
+	if len(original) != 1 {
+		t.Fatalf("registered connections = %d, want 1", len(original))
+	}
+	c := newTestClient(t, env)
+
+	// 请求在旧连接上处理期间隧道到期
+	inFlight := sendAsync(t, c)
+	<-started
+
+	select {
+	case status := <-inFlight:
+		if status != http.StatusOK {
+			t.Fatalf("in-flight request status = %d, want 200", status)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("in-flight request did not complete")
+	}
+
+	conns := env.registry.LookupAll(env.pubKeyHash)
+	if len(conns) != 1 || conns[0] == original[0] {
+		t.Fatalf("registry should hold only the recycled connection, got %d (same=%v)", len(conns), len(conns) == 1 && conns[0] == original[0])
+	}
+	select {
+	case <-original[0].Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Error("old tunnel connection was not closed after draining")
+	}
+
+	if status := <-sendAsync(t, c); status != http.StatusOK {
+		t.Errorf("request on recycled tunnel status = %d, want 200", status)
+	}
+}
+
+// TestIntegration_RelayClientMaxLifetime 验证 Client 连接到期后新请求换用新连接，进行中的请求正常完成
+func TestIntegration_RelayClientMaxLifetime(t *testing.T) {
+	started := make(chan struct{})
+	env := setupIntegrationTestWithQUIC(t, slowBackend(1500*time.Millisecond, started),
+		config.QUICParams{MaxLifetime: 500 * time.Millisecond}, config.QUICParams{})
+	c := newTestClient(t, env)
+
+	inFlight := sendAsync(t, c)
+	<-started
+
+	// 连接已到期但仍有进行中的请求: 新请求被拒绝后在新连接上重试
+	time.Sleep(700 * time.Millisecond)
+	if status := <-sendAsync(t, c); status != http.StatusOK {
+		t.Errorf("request after expiry status = %d, want 200", status)
+	}
+
+	select {
+	case status := <-inFlight:
+		if status != http.StatusOK {
+			t.Errorf("in-flight request status = %d, want 200", status)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("in-flight request did not complete")
+	}
+}